@@ -14,8 +14,7 @@ const auth = require('../middleware/auth');
  *         - fullName
  *         - dateOfBirth
  *         - nationality
- *         - idType
- *         - idNumber
+ *         - documents
  *       properties:
  *         address:
  *           type: string
@@ -29,12 +28,27 @@ const auth = require('../middleware/auth');
  *         nationality:
  *           type: string
  *           description: User's nationality
- *         idType:
- *           type: string
- *           description: Type of identification document
- *         idNumber:
- *           type: string
- *           description: Identification number
+ *         documents:
+ *           type: array
+ *           description: Identity documents, at most one of each type per issuing country
+ *           items:
+ *             type: object
+ *             required:
+ *               - type
+ *               - number
+ *               - issuingCountry
+ *             properties:
+ *               type:
+ *                 type: string
+ *                 enum: [PASSPORT, NATIONAL_ID, TAX_ID, DRIVING_LICENSE, RESIDENCE_PERMIT]
+ *               number:
+ *                 type: string
+ *               issuingCountry:
+ *                 type: string
+ *                 description: ISO country code
+ *               expiryDate:
+ *                 type: string
+ *                 description: YYYY-MM-DD, omitted for documents that do not expire
  *         status:
  *           type: string
  *           enum: [PENDING, APPROVED, REJECTED]
@@ -137,12 +151,8 @@ router.get('/kyc/:address', async (req, res) => {
  *           schema:
  *             type: object
  *             required:
- *               - approvedBy
  *               - riskLevel
  *             properties:
- *               approvedBy:
- *                 type: string
- *                 description: ID of the approver
  *               riskLevel:
  *                 type: string
  *                 enum: [LOW, MEDIUM, HIGH]
@@ -157,10 +167,10 @@ router.get('/kyc/:address', async (req, res) => {
  */
 router.post('/kyc/:address/approve', auth, async (req, res) => {
   try {
-    const { approvedBy, riskLevel } = req.body;
+    const { riskLevel } = req.body;
     const { address } = req.params;
     
-    const result = await blockchainService.approveKYC(address, approvedBy, riskLevel);
+    const result = await blockchainService.approveKYC(address, riskLevel);
     
     res.json({
       success: true,
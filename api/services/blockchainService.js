@@ -153,15 +153,20 @@ class BlockchainService {
   // Compliance Contract Methods
   async createKYC(kycData) {
     try {
-      const result = await this.contracts.compliance.submitTransaction(
-        'CreateKYC',
-        kycData.address,
-        kycData.fullName,
-        kycData.dateOfBirth,
-        kycData.nationality,
-        kycData.idType,
-        kycData.idNumber
-      );
+      if (kycData.recordType === 'CORPORATE') {
+        return await this.createCorporateKYC(kycData);
+      }
+
+      // Personal data goes in transient data so it stays off the channel ledger
+      const pii = {
+        fullName: kycData.fullName,
+        dateOfBirth: kycData.dateOfBirth,
+        documents: kycData.documents
+      };
+      const result = await this.contracts.compliance
+        .createTransaction('CreateKYC')
+        .setTransient({ kyc: Buffer.from(JSON.stringify(pii)) })
+        .submit(kycData.address, kycData.nationality);
       
       return { success: true, txId: result.toString() };
     } catch (error) {
@@ -169,13 +174,28 @@ class BlockchainService {
     }
   }
 
-  async approveKYC(address, approvedBy, riskLevel) {
+  async createCorporateKYC(kycData) {
+    // Entity data goes in transient data so it stays off the channel ledger
+    const entity = {
+      legalName: kycData.legalName,
+      registrationNumber: kycData.registrationNumber,
+      directors: kycData.directors || []
+    };
+    const result = await this.contracts.compliance
+      .createTransaction('CreateCorporateKYC')
+      .setTransient({ kyc: Buffer.from(JSON.stringify(entity)) })
+      .submit(kycData.address, kycData.incorporationCountry, kycData.lei || '');
+
+    return { success: true, txId: result.toString() };
+  }
+
+  async approveKYC(address, riskLevel, expectedVersion = 0) {
     try {
       const result = await this.contracts.compliance.submitTransaction(
         'ApproveKYC',
         address,
-        approvedBy,
-        riskLevel
+        riskLevel,
+        expectedVersion.toString()
       );
       
       return { success: true, txId: result.toString() };
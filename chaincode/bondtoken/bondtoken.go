@@ -1,14 +1,61 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+// Names the other bond contracts are deployed under
+const (
+	corporateActionChaincode = "corporateaction"
+	complianceChaincode      = "compliance"
+)
+
+// Composite key object types for bond and holder records. The compliance
+// holds placed on all of an address's holdings are kept under its
+// ADDRESSHOLD~address key, so they also cover holdings it acquires later.
+const (
+	bondObjectType           = "BOND"
+	holderObjectType         = "HOLDER"
+	whitelistObjectType      = "WHITELIST"
+	holderSnapshotObjectType = "HOLDERSNAPSHOT"
+	addressHoldObjectType    = "ADDRESSHOLD"
+)
+
+// registrarRole is the client identity role attribute allowed to manage
+// bond whitelists
+const registrarRole = "REGISTRAR"
+
+// trusteeRole is the client identity role attribute allowed to change bond
+// terms on behalf of the bondholders
+const trusteeRole = "TRUSTEE"
+
+// payingAgentRole is the client identity role attribute allowed to process
+// payments in the CorporateAction contract, including the final redemption
+const payingAgentRole = "PAYING_AGENT"
+
+// bondStatusTransitions lists the statuses UpdateBondStatus may move a bond
+// to from each status. Maturity, voiding and the return from default have
+// their own checks and go through MatureBond, VoidBond and RestructureTerms.
+var bondStatusTransitions = map[string][]string{
+	"ACTIVE": {"DEFAULTED"},
+}
+
+// Client identity role attributes of the Compliance contract, whose holds
+// are applied to holdings here under the compliance user's identity
+const (
+	complianceOfficerRole = "COMPLIANCE_OFFICER"
+	complianceAdminRole   = "COMPLIANCE_ADMIN"
+)
+
 // BondToken represents a bond token on the blockchain
 type BondToken struct {
 	contractapi.Contract
@@ -25,11 +72,123 @@ type Bond struct {
 	IssueDate       time.Time `json:"issueDate"`
 	TotalSupply     int64     `json:"totalSupply"`
 	AvailableSupply int64     `json:"availableSupply"`
-	Status          string    `json:"status"` // "ACTIVE", "MATURED", "DEFAULTED"
-	Currency        string    `json:"currency"`
+	Status          string    `json:"status"` // "ACTIVE", "MATURED", "DEFAULTED", "VOID"
+	Currency        string    `json:"currency"` // denomination currency
 	ISIN            string    `json:"isin"`
 	Rating          string    `json:"rating"`
 	Collateral      string    `json:"collateral"`
+	BondType        string    `json:"bondType"` // "FIXED", "ZERO_COUPON", "FRN"
+	Terms           BondTerms `json:"terms"`
+
+	// Currencies coupons and redemptions may be settled in besides Currency
+	SettlementCurrencies []string `json:"settlementCurrencies,omitempty"`
+
+	// Amortizing bonds repay principal on a schedule; OutstandingFaceValue
+	// is the principal still owed per token
+	OutstandingFaceValue float64             `json:"outstandingFaceValue"`
+	Amortization         []AmortizationEntry `json:"amortization,omitempty"`
+
+	// Restricted (Reg-D/private placement) bonds may only be transferred
+	// between whitelisted addresses
+	Restricted bool `json:"restricted"`
+
+	// Transfers must be a whole multiple of LotSize tokens; 0 means no minimum
+	LotSize int64 `json:"lotSize,omitempty"`
+
+	// Concentration limits from the offering documents: the most any one
+	// investor may hold, in tokens and as a percent of TotalSupply. 0 means
+	// no limit; when both are set the lower applies.
+	MaxHolding        int64   `json:"maxHolding,omitempty"`
+	MaxHoldingPercent float64 `json:"maxHoldingPercent,omitempty"`
+
+	// Set when an issuance is withdrawn before distribution
+	VoidReason string    `json:"voidReason,omitempty"`
+	VoidedAt   time.Time `json:"voidedAt,omitempty"`
+
+	// Taps that re-opened the bond after issuance
+	Tranches []Tranche `json:"tranches,omitempty"`
+
+	Version int64 `json:"version"` // incremented on every write
+}
+
+// Tranche is a further issue of tokens into an existing bond
+type Tranche struct {
+	Number         int       `json:"number"`
+	Quantity       int64     `json:"quantity"`
+	SettlementDate time.Time `json:"settlementDate"`
+	TxID           string    `json:"txId"`
+}
+
+// AmortizationEntry is a scheduled principal repayment per token
+type AmortizationEntry struct {
+	Date    time.Time `json:"date"`
+	Amount  float64   `json:"amount"`
+	Applied bool      `json:"applied"`
+	TxID    string    `json:"txId,omitempty"`
+}
+
+// AmortizationRecord records an applied principal repayment and how it was
+// allocated across holders
+type AmortizationRecord struct {
+	BondID          string               `json:"bondId"`
+	Date            time.Time            `json:"date"`
+	AmountPerToken  float64              `json:"amountPerToken"`
+	TotalPrincipal  float64              `json:"totalPrincipal"`
+	OutstandingFace float64              `json:"outstandingFace"`
+	Allocations     []HolderAmortization `json:"allocations"`
+	TxID            string               `json:"txId"`
+}
+
+// HolderAmortization is a single holder's share of a principal repayment
+type HolderAmortization struct {
+	Address   string  `json:"address"`
+	Quantity  int64   `json:"quantity"`
+	Principal float64 `json:"principal"`
+}
+
+// BondTerms holds the type-specific terms of a bond
+type BondTerms struct {
+	Spread         float64 `json:"spread,omitempty"`         // FRN: margin over the benchmark in basis points
+	BenchmarkIndex string  `json:"benchmarkIndex,omitempty"` // FRN: e.g. "SOFR", "MIBOR"
+	ResetFrequency int     `json:"resetFrequency,omitempty"` // FRN: months between rate resets
+	RateCap        float64 `json:"rateCap,omitempty"`        // FRN: maximum all-in coupon rate in percent, 0 for none
+	RateFloor      float64 `json:"rateFloor,omitempty"`      // FRN: minimum all-in coupon rate in percent
+	IssuePrice     float64 `json:"issuePrice,omitempty"`     // ZERO_COUPON: discounted issue price per token
+
+	// Coupon conventions used by the CorporateAction contract
+	CouponFrequency       int    `json:"couponFrequency,omitempty"`       // payments per year: 1, 2, 4 or 12 (default 2)
+	DayCount              string `json:"dayCount,omitempty"`              // "30/360" (default), "ACT/360", "ACT/365", "ACT/ACT"
+	BusinessDayConvention string `json:"businessDayConvention,omitempty"` // "FOLLOWING" (default), "MODIFIED_FOLLOWING", "PRECEDING", "UNADJUSTED"
+
+	// Holiday calendars kept by the CorporateAction contract, e.g. "USNY",
+	// whose holidays are not business days for the bond's payments
+	HolidayCalendars []string `json:"holidayCalendars,omitempty"`
+
+	// Callable bonds: the issuer may redeem early, giving CallNoticeDays notice
+	CallSchedule   []CallPeriod `json:"callSchedule,omitempty"`
+	CallNoticeDays int          `json:"callNoticeDays,omitempty"`
+
+	// Puttable bonds: holders may tender during each window for redemption
+	// on its put date
+	PutSchedule []PutWindow `json:"putSchedule,omitempty"`
+
+	// Convertible bonds: between ConversionStart and ConversionEnd holders
+	// may convert each token into ConversionRatio units of Underlying
+	ConversionRatio float64 `json:"conversionRatio,omitempty"`
+	ConversionStart string  `json:"conversionStart,omitempty"` // YYYY-MM-DD
+	ConversionEnd   string  `json:"conversionEnd,omitempty"`   // YYYY-MM-DD
+	Underlying      string  `json:"underlying,omitempty"`      // e.g. the share ISIN
+
+	// Claim-basis bonds: holders claim each coupon and redemption
+	// entitlement themselves in the CorporateAction contract
+	ClaimBasis bool `json:"claimBasis,omitempty"`
+}
+
+// CallPeriod is one step of a call schedule: from StartDate the bond may be
+// called at Price, in percent of outstanding face value
+type CallPeriod struct {
+	StartDate string  `json:"startDate"` // YYYY-MM-DD
+	Price     float64 `json:"price"`
 }
 
 // TokenHolder represents a token holder
@@ -37,8 +196,29 @@ type TokenHolder struct {
 	Address     string            `json:"address"`
 	BondID      string            `json:"bondId"`
 	Quantity    int64             `json:"quantity"`
+	Locked      int64             `json:"locked"` // part of Quantity that cannot be transferred
 	LastUpdated time.Time         `json:"lastUpdated"`
 	Metadata    map[string]string `json:"metadata"`
+	Version     int64             `json:"version"` // incremented on every write
+
+	// Frozen holdings cannot be transferred out
+	Frozen       bool   `json:"frozen"`
+	FreezeReason string `json:"freezeReason,omitempty"`
+
+	// IDs of the Compliance contract holds on the holding. It cannot be
+	// transferred out until all of them are released.
+	ComplianceHolds []string `json:"complianceHolds,omitempty"`
+
+	// Tokens from a tap that accrue interest only from the tranche's
+	// settlement date; part of Quantity
+	TapLots []TapLot `json:"tapLots,omitempty"`
+}
+
+// TapLot is the part of a holding that came from a tap
+type TapLot struct {
+	Tranche      int       `json:"tranche"`
+	Quantity     int64     `json:"quantity"`
+	AccrualStart time.Time `json:"accrualStart"`
 }
 
 // TransferEvent represents a token transfer event
@@ -51,14 +231,185 @@ type TransferEvent struct {
 	TxID      string    `json:"txId"`
 }
 
+// TokenBurn is a quantity of tokens burned from one holding
+type TokenBurn struct {
+	Address  string `json:"address"`
+	Quantity int64  `json:"quantity"`
+}
+
+// RedemptionBurnEvent reports the tokens burned for a redemption
+type RedemptionBurnEvent struct {
+	BondID       string      `json:"bondId"`
+	RedemptionID string      `json:"redemptionId"`
+	Burns        []TokenBurn `json:"burns"`
+	Quantity     int64       `json:"quantity"`
+	Timestamp    time.Time   `json:"timestamp"`
+	TxID         string      `json:"txId"`
+}
+
+// HolderPage is a page of a bond's holder register
+type HolderPage struct {
+	Holders  []*TokenHolder `json:"holders"`
+	Count    int32          `json:"count"`
+	Bookmark string         `json:"bookmark"`
+}
+
+// HolderShare is a holder's position as a share of the bond's total holdings
+type HolderShare struct {
+	Address  string  `json:"address"`
+	Quantity int64   `json:"quantity"`
+	Percent  float64 `json:"percent"`
+}
+
+// HolderSnapshot is a bond's holder register frozen as it stood at the close
+// of a record date
+type HolderSnapshot struct {
+	BondID        string         `json:"bondId"`
+	RecordDate    time.Time      `json:"recordDate"`
+	Holders       []*TokenHolder `json:"holders"`
+	HolderCount   int            `json:"holderCount"`
+	TotalQuantity int64          `json:"totalQuantity"`
+	TakenAt       time.Time      `json:"takenAt"`
+	TxID          string         `json:"txId"`
+}
+
+// HolderStats summarises a bond's holder register
+type HolderStats struct {
+	BondID           string         `json:"bondId"`
+	HolderCount      int            `json:"holderCount"`
+	TotalQuantity    int64          `json:"totalQuantity"`
+	LockedQuantity   int64          `json:"lockedQuantity"`
+	FreeQuantity     int64          `json:"freeQuantity"`
+	TopHolders       []*HolderShare `json:"topHolders"`
+	TopConcentration float64        `json:"topConcentration"` // percent held by TopHolders
+}
+
+// BondPrice represents the latest observed market price of a bond
+type BondPrice struct {
+	BondID    string    `json:"bondId"`
+	Price     float64   `json:"price"` // quoted in the same units as FaceValue
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+	TxID      string    `json:"txId"`
+}
+
+// ScreenCriteria holds the filters and sort options for ScreenBonds
+type ScreenCriteria struct {
+	Currency      string  `json:"currency"`
+	BondType      string  `json:"bondType"`
+	RatingBucket  string  `json:"ratingBucket"` // "INVESTMENT_GRADE", "HIGH_YIELD", "UNRATED"
+	MaturityFrom  string  `json:"maturityFrom"` // "2006-01-02"
+	MaturityTo    string  `json:"maturityTo"`   // "2006-01-02"
+	MinCouponRate float64 `json:"minCouponRate"`
+	MaxCouponRate float64 `json:"maxCouponRate"`
+	MinYield      float64 `json:"minYield"`
+	SortBy        string  `json:"sortBy"` // "maturity", "coupon", "yield", "rating"
+	SortDesc      bool    `json:"sortDesc"`
+}
+
+// ScreenedBond is a bond matched by ScreenBonds together with its pricing data
+type ScreenedBond struct {
+	Bond         *Bond   `json:"bond"`
+	RatingBucket string  `json:"ratingBucket"`
+	LatestPrice  float64 `json:"latestPrice"`
+	Yield        float64 `json:"yield"`
+	Priced       bool    `json:"priced"`
+}
+
+// ScreenResult is a page of ScreenBonds results
+type ScreenResult struct {
+	Bonds    []*ScreenedBond `json:"bonds"`
+	Total    int             `json:"total"`
+	Bookmark string          `json:"bookmark"`
+}
+
+// BondDocument anchors an off-chain bond document (prospectus, term sheet,
+// legal opinion) to the bond by its SHA-256 hash
+type BondDocument struct {
+	BondID       string    `json:"bondId"`
+	DocType      string    `json:"docType"` // "PROSPECTUS", "TERM_SHEET", "LEGAL_OPINION"
+	SHA256       string    `json:"sha256"`
+	URI          string    `json:"uri"`
+	Version      string    `json:"version"`
+	RegisteredAt time.Time `json:"registeredAt"`
+	RegisteredBy string    `json:"registeredBy"`
+	TxID         string    `json:"txId"`
+}
+
+// WhitelistEntry records an address approved to hold a restricted bond
+type WhitelistEntry struct {
+	BondID  string    `json:"bondId"`
+	Address string    `json:"address"`
+	AddedBy string    `json:"addedBy"`
+	AddedAt time.Time `json:"addedAt"`
+	TxID    string    `json:"txId"`
+}
+
+// TransferCheck is the outcome of a transfer pre-check. ReasonCode is "OK"
+// when the transfer is allowed, otherwise one of "BOND_NOT_FOUND",
+// "BOND_VOID", "BOND_MATURED", "INVALID_QUANTITY", "LOT_SIZE",
+// "NOT_WHITELISTED", "NO_HOLDING", "HOLDING_FROZEN", "INSUFFICIENT_BALANCE",
+// "HOLDING_CAP" or "NOT_COMPLIANT".
+type TransferCheck struct {
+	Allowed    bool   `json:"allowed"`
+	ReasonCode string `json:"reasonCode"`
+	Reason     string `json:"reason"`
+}
+
+// ComplianceDecision is the subset of the Compliance contract's transfer
+// decision used by Transfer and CanTransfer
+type ComplianceDecision struct {
+	Allowed    bool             `json:"allowed"`
+	Reasons    []*TransferCheck `json:"reasons"`              // one per rule broken
+	MaxHolding int64            `json:"maxHolding,omitempty"` // investor class and KYC tier limit of the receiver, 0 for none
+}
+
+// IssuerDefaultEvent is emitted once when an issuer defaults, listing every
+// bond moved to DEFAULTED
+type IssuerDefaultEvent struct {
+	IssuerID  string    `json:"issuerId"`
+	BondIDs   []string  `json:"bondIds"`
+	Timestamp time.Time `json:"timestamp"`
+	TxID      string    `json:"txId"`
+}
+
+// PutWindow is one holder put opportunity: notices are accepted from
+// WindowStart to WindowEnd and tendered tokens are redeemed on PutDate at
+// Price, in percent of outstanding face value
+type PutWindow struct {
+	WindowStart string  `json:"windowStart"` // YYYY-MM-DD
+	WindowEnd   string  `json:"windowEnd"`
+	PutDate     string  `json:"putDate"`
+	Price       float64 `json:"price"`
+}
+
 // Init initializes the contract
 func (bt *BondToken) Init(ctx contractapi.TransactionContextInterface) error {
 	fmt.Println("BondToken contract initialized")
 	return nil
 }
 
-// IssueBond issues a new bond
+// IssueBond issues a new fixed-rate bond
 func (bt *BondToken) IssueBond(ctx contractapi.TransactionContextInterface, bondID, issuerID, issuerName, currency, isin, rating, collateral string, faceValue float64, couponRate float64, totalSupply int64, maturityDateStr string) error {
+	return bt.IssueTypedBond(ctx, bondID, issuerID, issuerName, currency, isin, rating, collateral, faceValue, couponRate, totalSupply, maturityDateStr, "FIXED", "")
+}
+
+// IssueTypedBond issues a new bond of the given type. termsJSON is a
+// JSON-encoded BondTerms and may be empty for FIXED bonds.
+func (bt *BondToken) IssueTypedBond(ctx contractapi.TransactionContextInterface, bondID, issuerID, issuerName, currency, isin, rating, collateral string, faceValue float64, couponRate float64, totalSupply int64, maturityDateStr, bondType, termsJSON string) error {
+	var terms BondTerms
+	if termsJSON != "" {
+		err := json.Unmarshal([]byte(termsJSON), &terms)
+		if err != nil {
+			return fmt.Errorf("invalid bond terms: %v", err)
+		}
+	}
+
+	err := validateBondTerms(bondType, faceValue, couponRate, terms)
+	if err != nil {
+		return err
+	}
+
 	// Check if bond already exists
 	exists, err := bt.BondExists(ctx, bondID)
 	if err != nil {
@@ -90,17 +441,34 @@ func (bt *BondToken) IssueBond(ctx contractapi.TransactionContextInterface, bond
 		ISIN:            isin,
 		Rating:          rating,
 		Collateral:      collateral,
+		BondType:        bondType,
+		Terms:           terms,
+
+		OutstandingFaceValue: faceValue,
 	}
 
 	// Store bond
-	bondJSON, err := json.Marshal(bond)
+	_, err = bt.putBond(ctx, &bond)
 	if err != nil {
-		return fmt.Errorf("failed to marshal bond: %v", err)
+		return err
 	}
 
-	err = ctx.GetStub().PutState(bondID, bondJSON)
+	// The whole issue is allotted to the issuer, which distributes it by
+	// transfer
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	issuer := &TokenHolder{
+		Address:     issuerID,
+		BondID:      bondID,
+		Quantity:    totalSupply,
+		LastUpdated: txTime,
+		Metadata:    make(map[string]string),
+	}
+	err = bt.putHolder(ctx, issuer)
 	if err != nil {
-		return fmt.Errorf("failed to store bond: %v", err)
+		return fmt.Errorf("failed to store issuer holder: %v", err)
 	}
 
 	// Emit event
@@ -126,36 +494,34 @@ func (bt *BondToken) IssueBond(ctx contractapi.TransactionContextInterface, bond
 	return nil
 }
 
-// Transfer transfers tokens from one address to another
+// Transfer transfers tokens from one address to another. The transfer must
+// pass the ledger-side restrictions and the Compliance contract's rules for
+// the bond, which records the decision against the parties' limits.
 func (bt *BondToken) Transfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64) error {
-	// Check if bond exists
-	exists, err := bt.BondExists(ctx, bondID)
+	check, err := bt.checkTransfer(ctx, from, to, bondID, quantity)
 	if err != nil {
-		return fmt.Errorf("failed to check bond existence: %v", err)
+		return err
 	}
-	if !exists {
-		return fmt.Errorf("bond %s does not exist", bondID)
+	if !check.Allowed {
+		return fmt.Errorf("%s", check.Reason)
 	}
 
-	// Check if quantity is positive
-	if quantity <= 0 {
-		return fmt.Errorf("quantity must be positive")
+	check, err = bt.checkTransferCompliance(ctx, from, to, bondID, quantity, true)
+	if err != nil {
+		return err
+	}
+	if !check.Allowed {
+		return fmt.Errorf("%s", check.Reason)
 	}
 
 	// Get sender's balance
-	senderKey := fmt.Sprintf("%s_%s", from, bondID)
-	senderHolder, err := bt.GetTokenHolder(ctx, senderKey)
+	senderHolder, err := bt.GetTokenHolder(ctx, from, bondID)
 	if err != nil {
 		return fmt.Errorf("failed to get sender holder: %v", err)
 	}
 
-	if senderHolder.Quantity < quantity {
-		return fmt.Errorf("insufficient balance: %d < %d", senderHolder.Quantity, quantity)
-	}
-
 	// Get recipient's balance
-	recipientKey := fmt.Sprintf("%s_%s", to, bondID)
-	recipientHolder, err := bt.GetTokenHolder(ctx, recipientKey)
+	recipientHolder, err := bt.GetTokenHolder(ctx, to, bondID)
 	if err != nil {
 		// Create new holder if doesn't exist
 		recipientHolder = &TokenHolder{
@@ -168,6 +534,7 @@ func (bt *BondToken) Transfer(ctx contractapi.TransactionContextInterface, from,
 	}
 
 	// Update balances
+	moveTapLots(senderHolder, recipientHolder, quantity)
 	senderHolder.Quantity -= quantity
 	senderHolder.LastUpdated = time.Now()
 
@@ -175,22 +542,12 @@ func (bt *BondToken) Transfer(ctx contractapi.TransactionContextInterface, from,
 	recipientHolder.LastUpdated = time.Now()
 
 	// Store updated holders
-	senderJSON, err := json.Marshal(senderHolder)
-	if err != nil {
-		return fmt.Errorf("failed to marshal sender holder: %v", err)
-	}
-
-	recipientJSON, err := json.Marshal(recipientHolder)
-	if err != nil {
-		return fmt.Errorf("failed to marshal recipient holder: %v", err)
-	}
-
-	err = ctx.GetStub().PutState(senderKey, senderJSON)
+	err = bt.putHolder(ctx, senderHolder)
 	if err != nil {
 		return fmt.Errorf("failed to store sender holder: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(recipientKey, recipientJSON)
+	err = bt.putHolder(ctx, recipientHolder)
 	if err != nil {
 		return fmt.Errorf("failed to store recipient holder: %v", err)
 	}
@@ -218,9 +575,247 @@ func (bt *BondToken) Transfer(ctx contractapi.TransactionContextInterface, from,
 	return nil
 }
 
+// CanTransfer reports whether Transfer would accept the given transfer
+// without submitting it. It makes the same ledger-side and compliance checks
+// but records nothing, so it can be evaluated as a query.
+func (bt *BondToken) CanTransfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64) (*TransferCheck, error) {
+	check, err := bt.checkTransfer(ctx, from, to, bondID, quantity)
+	if err != nil || !check.Allowed {
+		return check, err
+	}
+
+	return bt.checkTransferCompliance(ctx, from, to, bondID, quantity, false)
+}
+
+// checkTransferCompliance checks a transfer against the Compliance
+// contract's rules for the bond, which apply to both non-issuer parties,
+// and the holding limit compliance sets for the receiver. When record is
+// set the Compliance contract counts the transfer towards the parties'
+// limits, so only Transfer may set it.
+func (bt *BondToken) checkTransferCompliance(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64, record bool) (*TransferCheck, error) {
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	// The issuer holds no KYC record, so it is passed as an empty party
+	parties := []string{from, to}
+	for i := range parties {
+		if parties[i] == bond.IssuerID {
+			parties[i] = ""
+		}
+	}
+
+	decision, err := complianceCheckTransfer(ctx, parties[0], parties[1], bondID, quantity, record)
+	if err != nil {
+		return nil, err
+	}
+	if !decision.Allowed {
+		reason := decision.Reasons[0]
+		return denyTransfer("NOT_COMPLIANT", "%s: %s", reason.ReasonCode, reason.Reason), nil
+	}
+
+	// Compliance knows the receiver's investor class, the ledger its balance
+	if decision.MaxHolding > 0 && parties[1] != "" && to != from {
+		held := bt.heldQuantity(ctx, to, bondID)
+		if held+quantity > decision.MaxHolding {
+			return denyTransfer("HOLDING_CAP", "transfer would take %s to %d tokens, above the compliance holding limit of %d for bond %s", to, held+quantity, decision.MaxHolding, bondID), nil
+		}
+	}
+
+	return &TransferCheck{Allowed: true, ReasonCode: "OK", Reason: "transfer allowed"}, nil
+}
+
+// checkTransfer evaluates the ledger-side restrictions on a transfer. Rule
+// violations are reported in the returned TransferCheck; an error means the
+// check itself could not be completed.
+func (bt *BondToken) checkTransfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64) (*TransferCheck, error) {
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return denyTransfer("BOND_NOT_FOUND", "failed to get bond: %v", err), nil
+	}
+
+	// Matured and voided bonds can no longer trade
+	if bond.Status == "VOID" {
+		return denyTransfer("BOND_VOID", "bond %s has been voided and can no longer be transferred", bondID), nil
+	}
+	if bond.Status == "MATURED" {
+		return denyTransfer("BOND_MATURED", "bond %s has matured and can no longer be transferred", bondID), nil
+	}
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !txTime.Before(bond.MaturityDate) {
+		return denyTransfer("BOND_MATURED", "bond %s reached maturity on %s and can no longer be transferred", bondID, bond.MaturityDate.Format("2006-01-02")), nil
+	}
+
+	if quantity <= 0 {
+		return denyTransfer("INVALID_QUANTITY", "quantity must be positive"), nil
+	}
+	if bond.LotSize > 0 && quantity%bond.LotSize != 0 {
+		return denyTransfer("LOT_SIZE", "quantity %d is not a multiple of the lot size %d", quantity, bond.LotSize), nil
+	}
+
+	// Restricted bonds only move between whitelisted addresses; the issuer
+	// is always allowed so it can distribute and buy back
+	if bond.Restricted {
+		for _, address := range []string{from, to} {
+			if address == bond.IssuerID {
+				continue
+			}
+			whitelisted, err := bt.IsWhitelisted(ctx, bondID, address)
+			if err != nil {
+				return nil, err
+			}
+			if !whitelisted {
+				return denyTransfer("NOT_WHITELISTED", "address %s is not whitelisted for bond %s", address, bondID), nil
+			}
+		}
+	}
+
+	senderHolder, err := bt.GetTokenHolder(ctx, from, bondID)
+	if err != nil {
+		return denyTransfer("NO_HOLDING", "failed to get sender holder: %v", err), nil
+	}
+	if senderHolder.Frozen {
+		return denyTransfer("HOLDING_FROZEN", "holding of %s in bond %s is frozen: %s", from, bondID, senderHolder.FreezeReason), nil
+	}
+	if len(senderHolder.ComplianceHolds) > 0 {
+		return denyTransfer("COMPLIANCE_HOLD", "holding of %s in bond %s is under compliance hold %s", from, bondID, strings.Join(senderHolder.ComplianceHolds, ", ")), nil
+	}
+	addressHolds, err := getAddressHolds(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if len(addressHolds) > 0 {
+		return denyTransfer("COMPLIANCE_HOLD", "address %s is under compliance hold %s", from, strings.Join(addressHolds, ", ")), nil
+	}
+	if senderHolder.Quantity-senderHolder.Locked < quantity {
+		return denyTransfer("INSUFFICIENT_BALANCE", "insufficient balance: %d < %d", senderHolder.Quantity-senderHolder.Locked, quantity), nil
+	}
+
+	// The issuer holds the undistributed supply and is exempt from caps
+	maxHolding := holdingCap(bond)
+	if maxHolding > 0 && to != bond.IssuerID && to != from {
+		held := bt.heldQuantity(ctx, to, bondID)
+		if held+quantity > maxHolding {
+			return denyTransfer("HOLDING_CAP", "transfer would take %s to %d tokens, above the holding cap of %d for bond %s", to, held+quantity, maxHolding, bondID), nil
+		}
+	}
+
+	return &TransferCheck{Allowed: true, ReasonCode: "OK", Reason: "transfer allowed"}, nil
+}
+
+// FreezeHolding stops an address from transferring any of its tokens in a
+// bond until UnfreezeHolding is called. Restricted to the registrar role.
+func (bt *BondToken) FreezeHolding(ctx contractapi.TransactionContextInterface, bondID, address, reason string) error {
+	return bt.setHoldingFrozen(ctx, bondID, address, true, reason)
+}
+
+// UnfreezeHolding lifts a freeze placed by FreezeHolding. Restricted to the
+// registrar role.
+func (bt *BondToken) UnfreezeHolding(ctx contractapi.TransactionContextInterface, bondID, address string) error {
+	return bt.setHoldingFrozen(ctx, bondID, address, false, "")
+}
+
+// PlaceComplianceHold applies a Compliance contract hold to an address's
+// holding of a bond, or to all its holdings when bondID is empty, and
+// returns the number of holdings it was applied to. A hold on all of an
+// address's holdings is also kept against the address, so it covers the
+// holdings it acquires later. A held holding cannot be transferred out
+// until every hold on it is released; holds are kept
+// apart from registrar freezes so neither lifts the other. It is invoked by
+// the Compliance contract's PlaceHold, which emits the event, and is
+// restricted to compliance officers and the compliance admin.
+func (bt *BondToken) PlaceComplianceHold(ctx contractapi.TransactionContextInterface, holdID, address, bondID string) (int, error) {
+	return bt.setComplianceHold(ctx, holdID, address, bondID, true)
+}
+
+// ReleaseComplianceHold removes a hold placed by PlaceComplianceHold and
+// returns the number of holdings it was removed from. It is invoked by the
+// Compliance contract's ReleaseHold and is restricted to compliance
+// officers and the compliance admin.
+func (bt *BondToken) ReleaseComplianceHold(ctx contractapi.TransactionContextInterface, holdID, address, bondID string) (int, error) {
+	return bt.setComplianceHold(ctx, holdID, address, bondID, false)
+}
+
+// SetLotSize sets the minimum tradeable lot for a bond; transfers must be a
+// whole multiple of it. Restricted to the registrar role.
+func (bt *BondToken) SetLotSize(ctx contractapi.TransactionContextInterface, bondID string, lotSize int64, expectedVersion int64) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	if lotSize < 0 {
+		return fmt.Errorf("lot size cannot be negative")
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	err = checkVersion("bond "+bondID, bond.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	bond.LotSize = lotSize
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetHoldingCap sets the maximum a single investor may hold in a bond, as
+// an absolute token count and/or a percent of total supply (0 disables
+// either limit). Existing holdings above the cap are kept but cannot grow.
+// Restricted to the registrar role.
+func (bt *BondToken) SetHoldingCap(ctx contractapi.TransactionContextInterface, bondID string, maxHolding int64, maxHoldingPercent float64, expectedVersion int64) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	if maxHolding < 0 {
+		return fmt.Errorf("maximum holding cannot be negative")
+	}
+	if maxHoldingPercent < 0 || maxHoldingPercent > 100 {
+		return fmt.Errorf("maximum holding percent must be between 0 and 100")
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	err = checkVersion("bond "+bondID, bond.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	bond.MaxHolding = maxHolding
+	bond.MaxHoldingPercent = maxHoldingPercent
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // GetBond retrieves a bond by ID
 func (bt *BondToken) GetBond(ctx contractapi.TransactionContextInterface, bondID string) (*Bond, error) {
-	bondJSON, err := ctx.GetStub().GetState(bondID)
+	key, err := bondKey(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	bondJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read bond: %v", err)
 	}
@@ -237,14 +832,19 @@ func (bt *BondToken) GetBond(ctx contractapi.TransactionContextInterface, bondID
 	return &bond, nil
 }
 
-// GetTokenHolder retrieves a token holder
-func (bt *BondToken) GetTokenHolder(ctx contractapi.TransactionContextInterface, holderKey string) (*TokenHolder, error) {
-	holderJSON, err := ctx.GetStub().GetState(holderKey)
+// GetTokenHolder retrieves an address's holding of a bond
+func (bt *BondToken) GetTokenHolder(ctx contractapi.TransactionContextInterface, address, bondID string) (*TokenHolder, error) {
+	key, err := holderKey(ctx, bondID, address)
+	if err != nil {
+		return nil, err
+	}
+
+	holderJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read holder: %v", err)
 	}
 	if holderJSON == nil {
-		return nil, fmt.Errorf("holder %s does not exist", holderKey)
+		return nil, fmt.Errorf("holder %s of bond %s does not exist", address, bondID)
 	}
 
 	var holder TokenHolder
@@ -258,7 +858,12 @@ func (bt *BondToken) GetTokenHolder(ctx contractapi.TransactionContextInterface,
 
 // BondExists checks if a bond exists
 func (bt *BondToken) BondExists(ctx contractapi.TransactionContextInterface, bondID string) (bool, error) {
-	bondJSON, err := ctx.GetStub().GetState(bondID)
+	key, err := bondKey(ctx, bondID)
+	if err != nil {
+		return false, err
+	}
+
+	bondJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
 		return false, fmt.Errorf("failed to read bond: %v", err)
 	}
@@ -267,8 +872,7 @@ func (bt *BondToken) BondExists(ctx contractapi.TransactionContextInterface, bon
 
 // GetBalance returns the balance of a specific bond for a specific address
 func (bt *BondToken) GetBalance(ctx contractapi.TransactionContextInterface, address, bondID string) (int64, error) {
-	holderKey := fmt.Sprintf("%s_%s", address, bondID)
-	holder, err := bt.GetTokenHolder(ctx, holderKey)
+	holder, err := bt.GetTokenHolder(ctx, address, bondID)
 	if err != nil {
 		// Return 0 if holder doesn't exist
 		return 0, nil
@@ -278,12 +882,9 @@ func (bt *BondToken) GetBalance(ctx contractapi.TransactionContextInterface, add
 
 // GetAllBonds returns all bonds
 func (bt *BondToken) GetAllBonds(ctx contractapi.TransactionContextInterface) ([]*Bond, error) {
-	startKey := ""
-	endKey := ""
-
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(bondObjectType, []string{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get state by range: %v", err)
+		return nil, fmt.Errorf("failed to get bonds: %v", err)
 	}
 	defer resultsIterator.Close()
 
@@ -294,35 +895,52 @@ func (bt *BondToken) GetAllBonds(ctx contractapi.TransactionContextInterface) ([
 			return nil, fmt.Errorf("failed to iterate results: %v", err)
 		}
 
-		// Check if this is a bond (not a holder)
-		if len(queryResult.Key) < 20 { // Bonds have shorter keys than holders
-			var bond Bond
-			err = json.Unmarshal(queryResult.Value, &bond)
-			if err == nil && bond.ID != "" {
-				bonds = append(bonds, &bond)
-			}
+		var bond Bond
+		err = json.Unmarshal(queryResult.Value, &bond)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal bond: %v", err)
 		}
+		bonds = append(bonds, &bond)
 	}
 
 	return bonds, nil
 }
 
-// UpdateBondStatus updates the status of a bond
-func (bt *BondToken) UpdateBondStatus(ctx contractapi.TransactionContextInterface, bondID, newStatus string) error {
+// UpdateBondStatus moves a bond to newStatus, which must be allowed from its
+// current status by bondStatusTransitions. expectedVersion is the bond
+// version the caller last read, or 0 to skip the concurrency check. Only the
+// trustee or the registrar may change a bond's status.
+func (bt *BondToken) UpdateBondStatus(ctx contractapi.TransactionContextInterface, bondID, newStatus string, expectedVersion int64) error {
+	err := requireRole(ctx, trusteeRole, registrarRole)
+	if err != nil {
+		return err
+	}
+
 	bond, err := bt.GetBond(ctx, bondID)
 	if err != nil {
 		return fmt.Errorf("failed to get bond: %v", err)
 	}
 
-	bond.Status = newStatus
-	bondJSON, err := json.Marshal(bond)
+	err = checkVersion("bond "+bondID, bond.Version, expectedVersion)
 	if err != nil {
-		return fmt.Errorf("failed to marshal bond: %v", err)
+		return err
+	}
+
+	allowed := false
+	for _, status := range bondStatusTransitions[bond.Status] {
+		if status == newStatus {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("bond %s cannot move from %s to %s", bondID, bond.Status, newStatus)
 	}
 
-	err = ctx.GetStub().PutState(bondID, bondJSON)
+	bond.Status = newStatus
+	_, err = bt.putBond(ctx, bond)
 	if err != nil {
-		return fmt.Errorf("failed to update bond: %v", err)
+		return err
 	}
 
 	return nil
@@ -330,12 +948,9 @@ func (bt *BondToken) UpdateBondStatus(ctx contractapi.TransactionContextInterfac
 
 // GetBondHolders returns all holders of a specific bond
 func (bt *BondToken) GetBondHolders(ctx contractapi.TransactionContextInterface, bondID string) ([]*TokenHolder, error) {
-	startKey := ""
-	endKey := ""
-
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holderObjectType, []string{bondID})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get state by range: %v", err)
+		return nil, fmt.Errorf("failed to get bond holders: %v", err)
 	}
 	defer resultsIterator.Close()
 
@@ -346,19 +961,2231 @@ func (bt *BondToken) GetBondHolders(ctx contractapi.TransactionContextInterface,
 			return nil, fmt.Errorf("failed to iterate results: %v", err)
 		}
 
-		// Check if this is a holder for the specific bond
-		if len(queryResult.Key) > 20 && queryResult.Key[len(queryResult.Key)-len(bondID)-1:] == "_"+bondID {
-			var holder TokenHolder
-			err = json.Unmarshal(queryResult.Value, &holder)
-			if err == nil && holder.BondID == bondID {
-				holders = append(holders, &holder)
-			}
+		var holder TokenHolder
+		err = json.Unmarshal(queryResult.Value, &holder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal holder: %v", err)
 		}
+		holders = append(holders, &holder)
 	}
 
 	return holders, nil
 }
 
+// GetBondHoldersAsOf returns a bond's holder register as it stood at the
+// close of asOfDateStr (YYYY-MM-DD), rebuilt from each holder record's
+// history so transfers after that day do not change the result. Holders
+// with no position at that point are omitted.
+func (bt *BondToken) GetBondHoldersAsOf(ctx contractapi.TransactionContextInterface, bondID, asOfDateStr string) ([]*TokenHolder, error) {
+	asOfDate, err := time.Parse("2006-01-02", asOfDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid as-of date format: %v", err)
+	}
+	cutoff := asOfDate.AddDate(0, 0, 1)
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holderObjectType, []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bond holders: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var holders []*TokenHolder
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		holder, err := holderAsOf(ctx, queryResult.Key, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		if holder != nil && holder.Quantity > 0 {
+			holders = append(holders, holder)
+		}
+	}
+
+	return holders, nil
+}
+
+// TakeHolderSnapshot stores a bond's holder register as it stood at the
+// close of recordDateStr (YYYY-MM-DD), for the CorporateAction contract to
+// fix entitlements from. It can only be taken once the record date has
+// closed, and only once per record date, so transfers settling after the
+// record date cannot change who gets paid. Only the registrar may take it.
+func (bt *BondToken) TakeHolderSnapshot(ctx contractapi.TransactionContextInterface, bondID, recordDateStr string) (*HolderSnapshot, error) {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return nil, err
+	}
+
+	recordDate, err := time.Parse("2006-01-02", recordDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record date format: %v", err)
+	}
+
+	exists, err := bt.BondExists(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("bond %s does not exist", bondID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if txTime.Before(recordDate.AddDate(0, 0, 1)) {
+		return nil, fmt.Errorf("record date %s has not closed yet", recordDateStr)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(holderSnapshotObjectType, []string{bondID, recordDate.Format("20060102")})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create holder snapshot key: %v", err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holder snapshot: %v", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("holders of bond %s have already been snapshotted for %s", bondID, recordDateStr)
+	}
+
+	holders, err := bt.GetBondHoldersAsOf(ctx, bondID, recordDateStr)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &HolderSnapshot{
+		BondID:     bondID,
+		RecordDate: recordDate,
+		Holders:    holders,
+		TakenAt:    txTime,
+		TxID:       ctx.GetStub().GetTxID(),
+	}
+	if snapshot.Holders == nil {
+		snapshot.Holders = []*TokenHolder{}
+	}
+	for _, holder := range holders {
+		snapshot.TotalQuantity += holder.Quantity
+	}
+	snapshot.HolderCount = len(holders)
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal holder snapshot: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, snapshotJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store holder snapshot: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("HolderSnapshotTaken", snapshotJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return snapshot, nil
+}
+
+// GetHolderSnapshot returns the holder register snapshot of a bond taken
+// for recordDateStr (YYYY-MM-DD)
+func (bt *BondToken) GetHolderSnapshot(ctx contractapi.TransactionContextInterface, bondID, recordDateStr string) (*HolderSnapshot, error) {
+	recordDate, err := time.Parse("2006-01-02", recordDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record date format: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(holderSnapshotObjectType, []string{bondID, recordDate.Format("20060102")})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create holder snapshot key: %v", err)
+	}
+
+	snapshotJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holder snapshot: %v", err)
+	}
+	if snapshotJSON == nil {
+		return nil, fmt.Errorf("no holder snapshot of bond %s for %s", bondID, recordDateStr)
+	}
+
+	var snapshot HolderSnapshot
+	err = json.Unmarshal(snapshotJSON, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal holder snapshot: %v", err)
+	}
+
+	return &snapshot, nil
+}
+
+// GetBondHoldersWithPagination returns one page of a bond's holder register.
+// Pass the returned bookmark to fetch the next page; it is empty on the last page.
+func (bt *BondToken) GetBondHoldersWithPagination(ctx contractapi.TransactionContextInterface, bondID string, pageSize int32, bookmark string) (*HolderPage, error) {
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(holderObjectType, []string{bondID}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bond holders: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	page := &HolderPage{Holders: []*TokenHolder{}}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var holder TokenHolder
+		err = json.Unmarshal(queryResult.Value, &holder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal holder: %v", err)
+		}
+		page.Holders = append(page.Holders, &holder)
+	}
+
+	page.Count = metadata.FetchedRecordsCount
+	if metadata.FetchedRecordsCount == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+
+	return page, nil
+}
+
+// GetHolderStats returns aggregate statistics for a bond's holder register,
+// including the topN largest holders and their combined concentration
+func (bt *BondToken) GetHolderStats(ctx contractapi.TransactionContextInterface, bondID string, topN int) (*HolderStats, error) {
+	holders, err := bt.GetBondHolders(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &HolderStats{BondID: bondID, TopHolders: []*HolderShare{}}
+	var positions []*TokenHolder
+	for _, holder := range holders {
+		if holder.Quantity <= 0 {
+			continue
+		}
+		stats.HolderCount++
+		stats.TotalQuantity += holder.Quantity
+		stats.LockedQuantity += holder.Locked
+		positions = append(positions, holder)
+	}
+	stats.FreeQuantity = stats.TotalQuantity - stats.LockedQuantity
+
+	if stats.TotalQuantity == 0 {
+		return stats, nil
+	}
+
+	sort.SliceStable(positions, func(i, j int) bool {
+		if positions[i].Quantity != positions[j].Quantity {
+			return positions[i].Quantity > positions[j].Quantity
+		}
+		return positions[i].Address < positions[j].Address
+	})
+
+	if topN <= 0 {
+		topN = 10
+	}
+	for i := 0; i < topN && i < len(positions); i++ {
+		share := &HolderShare{
+			Address:  positions[i].Address,
+			Quantity: positions[i].Quantity,
+			Percent:  float64(positions[i].Quantity) / float64(stats.TotalQuantity) * 100,
+		}
+		stats.TopHolders = append(stats.TopHolders, share)
+		stats.TopConcentration += share.Percent
+	}
+
+	return stats, nil
+}
+
+// MigrationResult reports the progress of a state key migration
+type MigrationResult struct {
+	Bonds    int    `json:"bonds"`
+	Holders  int    `json:"holders"`
+	Skipped  int    `json:"skipped"`
+	Bookmark string `json:"bookmark"`
+}
+
+// MigrateStateKeys moves bond and holder records stored under the legacy
+// flat keys ("bondID" and "address_bondID") to the BOND~id and
+// HOLDER~bond~address composite keys. It processes up to pageSize legacy
+// records per call; keep calling with the returned bookmark, the key to
+// resume from, until it is empty. Only the registrar may migrate state.
+func (bt *BondToken) MigrateStateKeys(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*MigrationResult, error) {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	// Paginated queries may only be used in read-only transactions, so the
+	// page is cut from a plain range query. Composite keys are excluded from
+	// plain range queries, so this only sees records still stored under
+	// legacy keys.
+	resultsIterator, err := ctx.GetStub().GetStateByRange(bookmark, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state by range: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	result := &MigrationResult{}
+	var fetched int32
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+		if fetched == pageSize {
+			result.Bookmark = queryResult.Key
+			break
+		}
+		fetched++
+
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(queryResult.Value, &fields) != nil {
+			result.Skipped++
+			continue
+		}
+
+		var newKey string
+		if _, isHolder := fields["address"]; isHolder {
+			var holder TokenHolder
+			err = json.Unmarshal(queryResult.Value, &holder)
+			if err != nil || queryResult.Key != holder.Address+"_"+holder.BondID {
+				result.Skipped++
+				continue
+			}
+			newKey, err = holderKey(ctx, holder.BondID, holder.Address)
+			result.Holders++
+		} else if _, isBond := fields["issuerId"]; isBond {
+			var bond Bond
+			err = json.Unmarshal(queryResult.Value, &bond)
+			if err != nil || queryResult.Key != bond.ID {
+				result.Skipped++
+				continue
+			}
+			newKey, err = bondKey(ctx, bond.ID)
+			result.Bonds++
+		} else {
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = ctx.GetStub().PutState(newKey, queryResult.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store migrated record: %v", err)
+		}
+		err = ctx.GetStub().DelState(queryResult.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete legacy record: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// MatureBond marks a bond as MATURED once the transaction timestamp has
+// passed its maturity date, which stops further transfers. The final
+// redemption is created and paid by the CorporateAction contract's
+// ProcessMaturity. Only the registrar or the paying agent may mature a bond.
+func (bt *BondToken) MatureBond(ctx contractapi.TransactionContextInterface, bondID string) error {
+	err := requireRole(ctx, registrarRole, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	if bond.Status != "ACTIVE" {
+		return fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if txTime.Before(bond.MaturityDate) {
+		return fmt.Errorf("bond %s does not mature until %s", bondID, bond.MaturityDate.Format("2006-01-02"))
+	}
+
+	bond.Status = "MATURED"
+	bondJSON, err := bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent("BondMatured", bondJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RetireBond settles a bond whose final redemption has been paid by the
+// CorporateAction contract: every holding is burned, the supply goes to zero
+// and the bond is marked MATURED. The bond may still be ACTIVE or already
+// marked MATURED by MatureBond. The CorporateAction contract calls it while
+// processing maturity, so it is restricted to the paying agent. Frozen
+// holdings are burned too, since redemption is mandatory.
+func (bt *BondToken) RetireBond(ctx contractapi.TransactionContextInterface, bondID string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	// A retired bond has no supply left to burn
+	if bond.Status == "MATURED" && bond.TotalSupply == 0 {
+		return fmt.Errorf("bond %s has already been retired", bondID)
+	}
+	if bond.Status != "ACTIVE" && bond.Status != "MATURED" {
+		return fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if txTime.Before(bond.MaturityDate) {
+		return fmt.Errorf("bond %s does not mature until %s", bondID, bond.MaturityDate.Format("2006-01-02"))
+	}
+
+	holders, err := bt.GetBondHolders(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	for _, holder := range holders {
+		if holder.Quantity == 0 {
+			continue
+		}
+		holder.Quantity = 0
+		holder.Locked = 0
+		holder.TapLots = nil
+		holder.LastUpdated = txTime
+		err = bt.putHolder(ctx, holder)
+		if err != nil {
+			return fmt.Errorf("failed to store holder: %v", err)
+		}
+	}
+
+	bond.Status = "MATURED"
+	bond.TotalSupply = 0
+	bond.AvailableSupply = 0
+	bondJSON, err := bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent("BondMatured", bondJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// VoidBond withdraws an issuance that has not been distributed. It is only
+// allowed while every token is still held by the issuer; the bond is marked
+// VOID and can no longer be transferred or have corporate actions raised.
+// Only the registrar may void a bond.
+func (bt *BondToken) VoidBond(ctx contractapi.TransactionContextInterface, bondID, reason string) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("void reason is required")
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	if bond.Status != "ACTIVE" {
+		return fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+
+	holders, err := bt.GetBondHolders(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	for _, holder := range holders {
+		if holder.Address != bond.IssuerID && holder.Quantity > 0 {
+			return fmt.Errorf("bond %s cannot be voided: %d tokens held by %s", bondID, holder.Quantity, holder.Address)
+		}
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	bond.Status = "VOID"
+	bond.VoidReason = reason
+	bond.VoidedAt = txTime
+	bondJSON, err := bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent("BondVoided", bondJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// BurnTokens destroys quantity of a holder's tokens and reduces the bond's
+// total supply. It is used by the CorporateAction contract to settle
+// conversions and is restricted to the registrar.
+func (bt *BondToken) BurnTokens(ctx contractapi.TransactionContextInterface, bondID, address string, quantity int64, reason string) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	if quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	if reason == "" {
+		return fmt.Errorf("burn reason is required")
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+	if bond.Status != "ACTIVE" {
+		return fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+
+	holder, err := bt.GetTokenHolder(ctx, address, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get holder: %v", err)
+	}
+	if holder.Frozen {
+		return fmt.Errorf("holding of %s is frozen: %s", address, holder.FreezeReason)
+	}
+	if len(holder.ComplianceHolds) > 0 {
+		return fmt.Errorf("holding of %s is under compliance hold %s", address, strings.Join(holder.ComplianceHolds, ", "))
+	}
+	if holder.Quantity-holder.Locked < quantity {
+		return fmt.Errorf("insufficient balance: %d < %d", holder.Quantity-holder.Locked, quantity)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	moveTapLots(holder, nil, quantity)
+	holder.Quantity -= quantity
+	holder.LastUpdated = txTime
+	err = bt.putHolder(ctx, holder)
+	if err != nil {
+		return fmt.Errorf("failed to store holder: %v", err)
+	}
+
+	bond.TotalSupply -= quantity
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := TransferEvent{
+		From:      address,
+		To:        "SYSTEM",
+		BondID:    bondID,
+		Quantity:  quantity,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TokensBurned", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// BurnRedeemedTokens burns the tokens paid off by a redemption so they can
+// no longer trade. burnsJSON is a JSON array of {"address", "quantity"}
+// burns, or empty to burn every holding when the whole issue is redeemed.
+// Redemption is mandatory, so locked and frozen tokens are burned too. It is
+// called by the CorporateAction contract and restricted to the paying agent.
+func (bt *BondToken) BurnRedeemedTokens(ctx contractapi.TransactionContextInterface, bondID, burnsJSON, redemptionID string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	if redemptionID == "" {
+		return fmt.Errorf("redemption ID is required")
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+	if bond.Status == "VOID" {
+		return fmt.Errorf("bond %s has been voided", bondID)
+	}
+
+	var burns []TokenBurn
+	if burnsJSON == "" {
+		holders, err := bt.GetBondHolders(ctx, bondID)
+		if err != nil {
+			return err
+		}
+		for _, holder := range holders {
+			if holder.Quantity > 0 {
+				burns = append(burns, TokenBurn{Address: holder.Address, Quantity: holder.Quantity})
+			}
+		}
+	} else {
+		var input []TokenBurn
+		err = json.Unmarshal([]byte(burnsJSON), &input)
+		if err != nil {
+			return fmt.Errorf("invalid burns: %v", err)
+		}
+
+		// Writes are not visible to later reads in the same transaction, so
+		// each holding is burned once for its combined quantity
+		index := make(map[string]int)
+		for _, burn := range input {
+			if burn.Quantity <= 0 {
+				return fmt.Errorf("burn quantity must be positive")
+			}
+			if i, ok := index[burn.Address]; ok {
+				burns[i].Quantity += burn.Quantity
+				continue
+			}
+			index[burn.Address] = len(burns)
+			burns = append(burns, burn)
+		}
+	}
+
+	// Every burn is checked before any holding is written
+	holders := make([]*TokenHolder, len(burns))
+	for i, burn := range burns {
+		holder, err := bt.GetTokenHolder(ctx, burn.Address, bondID)
+		if err != nil {
+			return fmt.Errorf("failed to get holder: %v", err)
+		}
+		if holder.Quantity < burn.Quantity {
+			return fmt.Errorf("insufficient balance of %s: %d < %d", burn.Address, holder.Quantity, burn.Quantity)
+		}
+		holders[i] = holder
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for i, burn := range burns {
+		holder := holders[i]
+		moveTapLots(holder, nil, burn.Quantity)
+		holder.Quantity -= burn.Quantity
+		if holder.Locked > holder.Quantity {
+			holder.Locked = holder.Quantity
+		}
+		holder.LastUpdated = txTime
+		err = bt.putHolder(ctx, holder)
+		if err != nil {
+			return fmt.Errorf("failed to store holder: %v", err)
+		}
+		total += burn.Quantity
+	}
+
+	bond.TotalSupply -= total
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := RedemptionBurnEvent{
+		BondID:       bondID,
+		RedemptionID: redemptionID,
+		Burns:        burns,
+		Quantity:     total,
+		Timestamp:    txTime,
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TokensRedeemed", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// TapBond re-opens an active bond by issuing quantity further tokens to the
+// issuer as a new tranche. The tapped tokens accrue interest only from
+// settlementDateStr, so the first coupon on them is pro-rated until they
+// become fungible with the original issue.
+func (bt *BondToken) TapBond(ctx contractapi.TransactionContextInterface, bondID string, quantity int64, settlementDateStr string) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	if quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+
+	settlementDate, err := time.Parse("2006-01-02", settlementDateStr)
+	if err != nil {
+		return fmt.Errorf("invalid settlement date format: %v", err)
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+	if bond.Status != "ACTIVE" {
+		return fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+	if !settlementDate.After(bond.IssueDate) || !settlementDate.Before(bond.MaturityDate) {
+		return fmt.Errorf("settlement date must be between issue date and maturity")
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	tranche := Tranche{
+		Number:         len(bond.Tranches) + 1,
+		Quantity:       quantity,
+		SettlementDate: settlementDate,
+		TxID:           ctx.GetStub().GetTxID(),
+	}
+
+	issuer, err := bt.GetTokenHolder(ctx, bond.IssuerID, bondID)
+	if err != nil {
+		issuer = &TokenHolder{
+			Address:  bond.IssuerID,
+			BondID:   bondID,
+			Metadata: make(map[string]string),
+		}
+	}
+	issuer.Quantity += quantity
+	issuer.TapLots = append(issuer.TapLots, TapLot{
+		Tranche:      tranche.Number,
+		Quantity:     quantity,
+		AccrualStart: settlementDate,
+	})
+	issuer.LastUpdated = txTime
+	err = bt.putHolder(ctx, issuer)
+	if err != nil {
+		return fmt.Errorf("failed to store issuer holder: %v", err)
+	}
+
+	bond.Tranches = append(bond.Tranches, tranche)
+	bond.TotalSupply += quantity
+	bond.AvailableSupply += quantity
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	trancheJSON, err := json.Marshal(tranche)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tranche: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("BondTapped", trancheJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RestructureTerms applies restructured terms agreed by the bondholders:
+// haircutPercent writes down the outstanding principal, and a non-zero
+// couponRate or non-empty maturityDateStr replace the current ones. A
+// defaulted bond returns to ACTIVE. It is invoked by the CorporateAction
+// contract once the restructuring vote has passed and is restricted to the
+// trustee.
+func (bt *BondToken) RestructureTerms(ctx contractapi.TransactionContextInterface, bondID string, haircutPercent, couponRate float64, maturityDateStr string) error {
+	err := requireRole(ctx, trusteeRole)
+	if err != nil {
+		return err
+	}
+
+	if haircutPercent < 0 || haircutPercent >= 100 {
+		return fmt.Errorf("haircut must be between 0 and 100 percent")
+	}
+	if couponRate < 0 {
+		return fmt.Errorf("coupon rate cannot be negative")
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+	if bond.Status != "ACTIVE" && bond.Status != "DEFAULTED" {
+		return fmt.Errorf("bond %s cannot be restructured: %s", bondID, bond.Status)
+	}
+
+	if haircutPercent > 0 {
+		bond.OutstandingFaceValue = outstandingFace(bond) * (1 - haircutPercent/100)
+		for i := range bond.Amortization {
+			if !bond.Amortization[i].Applied {
+				bond.Amortization[i].Amount *= 1 - haircutPercent/100
+			}
+		}
+	}
+	if couponRate > 0 {
+		if bondTypeOf(bond) != "FIXED" {
+			return fmt.Errorf("coupon rate of a %s bond cannot be changed", bondTypeOf(bond))
+		}
+		bond.CouponRate = couponRate
+	}
+	if maturityDateStr != "" {
+		maturityDate, err := time.Parse("2006-01-02", maturityDateStr)
+		if err != nil {
+			return fmt.Errorf("invalid maturity date format: %v", err)
+		}
+		if maturityDate.Before(bond.MaturityDate) {
+			return fmt.Errorf("maturity can only be extended")
+		}
+		bond.MaturityDate = maturityDate
+	}
+	bond.Status = "ACTIVE"
+
+	bondJSON, err := bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent("BondRestructured", bondJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// DeclareIssuerDefault moves every ACTIVE bond of an issuer to DEFAULTED and
+// suspends their pending coupon payments in the CorporateAction contract.
+// Only the trustee may declare a default.
+func (bt *BondToken) DeclareIssuerDefault(ctx contractapi.TransactionContextInterface, issuerID string) error {
+	err := requireRole(ctx, trusteeRole)
+	if err != nil {
+		return err
+	}
+
+	bonds, err := bt.GetAllBonds(ctx)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	event := IssuerDefaultEvent{
+		IssuerID:  issuerID,
+		BondIDs:   []string{},
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	for _, bond := range bonds {
+		if bond.IssuerID != issuerID || bond.Status != "ACTIVE" {
+			continue
+		}
+
+		bond.Status = "DEFAULTED"
+		_, err = bt.putBond(ctx, bond)
+		if err != nil {
+			return err
+		}
+
+		args := [][]byte{
+			[]byte("SuspendCouponPayments"),
+			[]byte(bond.ID),
+			[]byte("issuer " + issuerID + " in default"),
+		}
+		response := ctx.GetStub().InvokeChaincode(corporateActionChaincode, args, "")
+		if response.Status != shim.OK {
+			return fmt.Errorf("failed to suspend coupon payments for bond %s: %s", bond.ID, response.Message)
+		}
+
+		event.BondIDs = append(event.BondIDs, bond.ID)
+	}
+
+	if len(event.BondIDs) == 0 {
+		return fmt.Errorf("issuer %s has no active bonds", issuerID)
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("IssuerDefault", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// SetSettlementCurrencies sets the currencies, in addition to the
+// denomination currency, that a bond's payments may be settled in.
+// currencies is a comma-separated list of ISO 4217 codes, e.g. "USD,EUR".
+// expectedVersion is the bond version the caller last read, or 0 to skip the
+// concurrency check.
+func (bt *BondToken) SetSettlementCurrencies(ctx contractapi.TransactionContextInterface, bondID, currencies string, expectedVersion int64) error {
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	err = checkVersion("bond "+bondID, bond.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	var settlementCurrencies []string
+	seen := make(map[string]bool)
+	for _, code := range strings.Split(currencies, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" || seen[code] || code == bond.Currency {
+			continue
+		}
+		if !isCurrencyCode(code) {
+			return fmt.Errorf("invalid currency code: %s", code)
+		}
+		seen[code] = true
+		settlementCurrencies = append(settlementCurrencies, code)
+	}
+	sort.Strings(settlementCurrencies)
+
+	bond.SettlementCurrencies = settlementCurrencies
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetAmortizationSchedule sets the principal repayment plan of a bond.
+// scheduleJSON is a JSON array of {"date": "2006-01-02", "amount": n}
+// entries, where amount is the principal repaid per token. expectedVersion is
+// the bond version the caller last read, or 0 to skip the concurrency check.
+// Only the registrar may set the schedule.
+func (bt *BondToken) SetAmortizationSchedule(ctx contractapi.TransactionContextInterface, bondID, scheduleJSON string, expectedVersion int64) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	err = checkVersion("bond "+bondID, bond.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range bond.Amortization {
+		if entry.Applied {
+			return fmt.Errorf("bond %s has already started amortizing", bondID)
+		}
+	}
+
+	var input []struct {
+		Date   string  `json:"date"`
+		Amount float64 `json:"amount"`
+	}
+	err = json.Unmarshal([]byte(scheduleJSON), &input)
+	if err != nil {
+		return fmt.Errorf("invalid amortization schedule: %v", err)
+	}
+
+	var schedule []AmortizationEntry
+	var total float64
+	for i, in := range input {
+		date, err := time.Parse("2006-01-02", in.Date)
+		if err != nil {
+			return fmt.Errorf("invalid amortization date format: %v", err)
+		}
+		if in.Amount <= 0 {
+			return fmt.Errorf("amortization amount must be positive")
+		}
+		if i > 0 && !date.After(schedule[i-1].Date) {
+			return fmt.Errorf("amortization dates must be strictly increasing")
+		}
+		if date.After(bond.MaturityDate) {
+			return fmt.Errorf("amortization date %s is after maturity", in.Date)
+		}
+		total += in.Amount
+		schedule = append(schedule, AmortizationEntry{Date: date, Amount: in.Amount})
+	}
+
+	// Any principal not amortized is repaid as a balloon at maturity
+	if total > bond.FaceValue {
+		return fmt.Errorf("amortization total %.2f exceeds face value %.2f", total, bond.FaceValue)
+	}
+
+	bond.Amortization = schedule
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyAmortization applies the scheduled principal repayment due on
+// dateStr, reducing the outstanding principal of every token and recording
+// each holder's pro-rata share. The CorporateAction contract invokes it when
+// the paying agent processes the repayment; only the paying agent may call it.
+func (bt *BondToken) ApplyAmortization(ctx contractapi.TransactionContextInterface, bondID, dateStr string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	if bond.Status != "ACTIVE" {
+		return fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return fmt.Errorf("invalid amortization date format: %v", err)
+	}
+
+	index := -1
+	for i, entry := range bond.Amortization {
+		if entry.Date.Equal(date) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("no amortization scheduled for bond %s on %s", bondID, dateStr)
+	}
+
+	entry := &bond.Amortization[index]
+	if entry.Applied {
+		return fmt.Errorf("amortization on %s has already been applied", dateStr)
+	}
+	for _, earlier := range bond.Amortization[:index] {
+		if !earlier.Applied {
+			return fmt.Errorf("earlier amortization on %s has not been applied", earlier.Date.Format("2006-01-02"))
+		}
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if txTime.Before(entry.Date) {
+		return fmt.Errorf("amortization on %s is not yet due", dateStr)
+	}
+
+	holders, err := bt.GetBondHolders(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond holders: %v", err)
+	}
+
+	record := AmortizationRecord{
+		BondID:         bondID,
+		Date:           entry.Date,
+		AmountPerToken: entry.Amount,
+		TxID:           ctx.GetStub().GetTxID(),
+	}
+	for _, holder := range holders {
+		if holder.Quantity <= 0 {
+			continue
+		}
+		principal := float64(holder.Quantity) * entry.Amount
+		record.TotalPrincipal += principal
+		record.Allocations = append(record.Allocations, HolderAmortization{
+			Address:   holder.Address,
+			Quantity:  holder.Quantity,
+			Principal: principal,
+		})
+	}
+
+	entry.Applied = true
+	entry.TxID = ctx.GetStub().GetTxID()
+	bond.OutstandingFaceValue = outstandingFace(bond) - entry.Amount
+	record.OutstandingFace = bond.OutstandingFaceValue
+
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	recordKey, err := ctx.GetStub().CreateCompositeKey("AMORTIZATION", []string{bondID, dateStr})
+	if err != nil {
+		return fmt.Errorf("failed to create amortization key: %v", err)
+	}
+
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal amortization record: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store amortization record: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("BondAmortized", recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RecordPrice records the latest market price for a bond
+func (bt *BondToken) RecordPrice(ctx contractapi.TransactionContextInterface, bondID string, price float64, source string) error {
+	exists, err := bt.BondExists(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to check bond existence: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("bond %s does not exist", bondID)
+	}
+
+	if price <= 0 {
+		return fmt.Errorf("price must be positive")
+	}
+
+	priceKey, err := ctx.GetStub().CreateCompositeKey("PRICE", []string{bondID})
+	if err != nil {
+		return fmt.Errorf("failed to create price key: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	bondPrice := BondPrice{
+		BondID:    bondID,
+		Price:     price,
+		Source:    source,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	priceJSON, err := json.Marshal(bondPrice)
+	if err != nil {
+		return fmt.Errorf("failed to marshal price: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(priceKey, priceJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store price: %v", err)
+	}
+
+	return nil
+}
+
+// GetLatestPrice returns the latest recorded price for a bond
+func (bt *BondToken) GetLatestPrice(ctx contractapi.TransactionContextInterface, bondID string) (*BondPrice, error) {
+	priceKey, err := ctx.GetStub().CreateCompositeKey("PRICE", []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create price key: %v", err)
+	}
+
+	priceJSON, err := ctx.GetStub().GetState(priceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price: %v", err)
+	}
+	if priceJSON == nil {
+		return nil, fmt.Errorf("no price recorded for bond %s", bondID)
+	}
+
+	var bondPrice BondPrice
+	err = json.Unmarshal(priceJSON, &bondPrice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal price: %v", err)
+	}
+
+	return &bondPrice, nil
+}
+
+// ScreenBonds filters, sorts and paginates bonds for the investor screener.
+// criteriaJSON is a JSON-encoded ScreenCriteria; bookmark is the offset
+// returned by the previous page ("" for the first page).
+func (bt *BondToken) ScreenBonds(ctx contractapi.TransactionContextInterface, criteriaJSON string, pageSize int, bookmark string) (*ScreenResult, error) {
+	var criteria ScreenCriteria
+	if criteriaJSON != "" {
+		err := json.Unmarshal([]byte(criteriaJSON), &criteria)
+		if err != nil {
+			return nil, fmt.Errorf("invalid screen criteria: %v", err)
+		}
+	}
+
+	var maturityFrom, maturityTo time.Time
+	var err error
+	if criteria.MaturityFrom != "" {
+		maturityFrom, err = time.Parse("2006-01-02", criteria.MaturityFrom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maturityFrom format: %v", err)
+		}
+	}
+	if criteria.MaturityTo != "" {
+		maturityTo, err = time.Parse("2006-01-02", criteria.MaturityTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maturityTo format: %v", err)
+		}
+	}
+
+	offset := 0
+	if bookmark != "" {
+		offset, err = strconv.Atoi(bookmark)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid bookmark: %s", bookmark)
+		}
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	bonds, err := bt.GetAllBonds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bonds: %v", err)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*ScreenedBond
+	for _, bond := range bonds {
+		if criteria.Currency != "" && !strings.EqualFold(bond.Currency, criteria.Currency) {
+			continue
+		}
+		if criteria.BondType != "" && bondTypeOf(bond) != criteria.BondType {
+			continue
+		}
+		bucket := ratingBucket(bond.Rating)
+		if criteria.RatingBucket != "" && bucket != criteria.RatingBucket {
+			continue
+		}
+		if !maturityFrom.IsZero() && bond.MaturityDate.Before(maturityFrom) {
+			continue
+		}
+		if !maturityTo.IsZero() && bond.MaturityDate.After(maturityTo) {
+			continue
+		}
+		if annualCouponRate(bond) < criteria.MinCouponRate {
+			continue
+		}
+		if criteria.MaxCouponRate > 0 && annualCouponRate(bond) > criteria.MaxCouponRate {
+			continue
+		}
+
+		screened := &ScreenedBond{Bond: bond, RatingBucket: bucket}
+		bondPrice, err := bt.GetLatestPrice(ctx, bond.ID)
+		if err == nil {
+			screened.LatestPrice = bondPrice.Price
+			screened.Yield = approximateYield(bond, bondPrice.Price, now)
+			screened.Priced = true
+		}
+
+		// A yield threshold can only be met by bonds with a known price
+		if criteria.MinYield > 0 && (!screened.Priced || screened.Yield < criteria.MinYield) {
+			continue
+		}
+
+		matches = append(matches, screened)
+	}
+
+	sortScreenedBonds(matches, criteria.SortBy, criteria.SortDesc)
+
+	result := &ScreenResult{Total: len(matches)}
+	if offset >= len(matches) {
+		result.Bonds = []*ScreenedBond{}
+		return result, nil
+	}
+
+	end := offset + pageSize
+	if end > len(matches) {
+		end = len(matches)
+	} else {
+		result.Bookmark = strconv.Itoa(end)
+	}
+	result.Bonds = matches[offset:end]
+
+	return result, nil
+}
+
+// RegisterDocument anchors a new version of a bond document to the bond
+func (bt *BondToken) RegisterDocument(ctx contractapi.TransactionContextInterface, bondID, docType, sha256, uri, version string) error {
+	exists, err := bt.BondExists(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to check bond existence: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("bond %s does not exist", bondID)
+	}
+
+	if docType == "" || version == "" {
+		return fmt.Errorf("document type and version are required")
+	}
+
+	hash, err := hex.DecodeString(sha256)
+	if err != nil || len(hash) != 32 {
+		return fmt.Errorf("invalid SHA-256 hash: %s", sha256)
+	}
+
+	docKey, err := ctx.GetStub().CreateCompositeKey("DOCUMENT", []string{bondID, docType, version})
+	if err != nil {
+		return fmt.Errorf("failed to create document key: %v", err)
+	}
+
+	existing, err := ctx.GetStub().GetState(docKey)
+	if err != nil {
+		return fmt.Errorf("failed to read document: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("version %s of %s for bond %s is already registered", version, docType, bondID)
+	}
+
+	registeredBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	document := BondDocument{
+		BondID:       bondID,
+		DocType:      docType,
+		SHA256:       strings.ToLower(sha256),
+		URI:          uri,
+		Version:      version,
+		RegisteredAt: txTime,
+		RegisteredBy: registeredBy,
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+
+	docJSON, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("failed to marshal document: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(docKey, docJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store document: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("DocumentRegistered", docJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetDocuments returns every registered version of every document for a bond
+func (bt *BondToken) GetDocuments(ctx contractapi.TransactionContextInterface, bondID string) ([]*BondDocument, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("DOCUMENT", []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var documents []*BondDocument
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var document BondDocument
+		err = json.Unmarshal(queryResult.Value, &document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal document: %v", err)
+		}
+		documents = append(documents, &document)
+	}
+
+	// Group by document type, oldest version first
+	sort.SliceStable(documents, func(i, j int) bool {
+		if documents[i].DocType != documents[j].DocType {
+			return documents[i].DocType < documents[j].DocType
+		}
+		return documents[i].RegisteredAt.Before(documents[j].RegisteredAt)
+	})
+
+	return documents, nil
+}
+
+// SetBondRestricted turns whitelist enforcement on or off for a bond.
+// Restricted to the registrar role.
+func (bt *BondToken) SetBondRestricted(ctx contractapi.TransactionContextInterface, bondID string, restricted bool, expectedVersion int64) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	bond, err := bt.GetBond(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get bond: %v", err)
+	}
+
+	err = checkVersion("bond "+bondID, bond.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	bond.Restricted = restricted
+	_, err = bt.putBond(ctx, bond)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddToWhitelist approves an address to hold and trade a restricted bond.
+// Restricted to the registrar role.
+func (bt *BondToken) AddToWhitelist(ctx contractapi.TransactionContextInterface, bondID, address string) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	exists, err := bt.BondExists(ctx, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to check bond existence: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("bond %s does not exist", bondID)
+	}
+
+	if address == "" {
+		return fmt.Errorf("address is required")
+	}
+
+	addedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry := WhitelistEntry{
+		BondID:  bondID,
+		Address: address,
+		AddedBy: addedBy,
+		AddedAt: txTime,
+		TxID:    ctx.GetStub().GetTxID(),
+	}
+
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal whitelist entry: %v", err)
+	}
+
+	key, err := whitelistKey(ctx, bondID, address)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, entryJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store whitelist entry: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("WhitelistAdded", entryJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveFromWhitelist revokes an address's approval for a restricted bond.
+// Tokens already held stay put but can no longer be transferred.
+// Restricted to the registrar role.
+func (bt *BondToken) RemoveFromWhitelist(ctx contractapi.TransactionContextInterface, bondID, address string) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	key, err := whitelistKey(ctx, bondID, address)
+	if err != nil {
+		return err
+	}
+
+	entryJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read whitelist entry: %v", err)
+	}
+	if entryJSON == nil {
+		return fmt.Errorf("address %s is not whitelisted for bond %s", address, bondID)
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete whitelist entry: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("WhitelistRemoved", entryJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// IsWhitelisted reports whether an address is approved for a bond
+func (bt *BondToken) IsWhitelisted(ctx contractapi.TransactionContextInterface, bondID, address string) (bool, error) {
+	key, err := whitelistKey(ctx, bondID, address)
+	if err != nil {
+		return false, err
+	}
+
+	entryJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read whitelist entry: %v", err)
+	}
+
+	return entryJSON != nil, nil
+}
+
+// validateBondTerms checks that the type-specific terms are consistent with
+// the bond type
+func validateBondTerms(bondType string, faceValue, couponRate float64, terms BondTerms) error {
+	switch bondType {
+	case "FIXED":
+		if couponRate <= 0 {
+			return fmt.Errorf("fixed-rate bonds require a positive coupon rate")
+		}
+	case "ZERO_COUPON":
+		if couponRate != 0 {
+			return fmt.Errorf("zero-coupon bonds cannot have a coupon rate")
+		}
+		if terms.IssuePrice <= 0 || terms.IssuePrice >= faceValue {
+			return fmt.Errorf("zero-coupon bonds require an issue price below face value")
+		}
+	case "FRN":
+		if terms.BenchmarkIndex == "" {
+			return fmt.Errorf("floating-rate notes require a benchmark index")
+		}
+		switch terms.ResetFrequency {
+		case 1, 3, 6, 12:
+		default:
+			return fmt.Errorf("invalid reset frequency: %d months", terms.ResetFrequency)
+		}
+		if terms.RateFloor < 0 || (terms.RateCap > 0 && terms.RateCap < terms.RateFloor) {
+			return fmt.Errorf("invalid rate cap/floor: %v/%v", terms.RateCap, terms.RateFloor)
+		}
+	default:
+		return fmt.Errorf("invalid bond type: %s", bondType)
+	}
+
+	var previous time.Time
+	for _, period := range terms.CallSchedule {
+		startDate, err := time.Parse("2006-01-02", period.StartDate)
+		if err != nil {
+			return fmt.Errorf("invalid call schedule date: %v", err)
+		}
+		if !startDate.After(previous) {
+			return fmt.Errorf("call schedule dates must be in ascending order")
+		}
+		if period.Price <= 0 {
+			return fmt.Errorf("call price must be positive")
+		}
+		previous = startDate
+	}
+	if terms.CallNoticeDays < 0 {
+		return fmt.Errorf("call notice days cannot be negative")
+	}
+
+	for _, window := range terms.PutSchedule {
+		windowStart, err := time.Parse("2006-01-02", window.WindowStart)
+		if err != nil {
+			return fmt.Errorf("invalid put window start: %v", err)
+		}
+		windowEnd, err := time.Parse("2006-01-02", window.WindowEnd)
+		if err != nil {
+			return fmt.Errorf("invalid put window end: %v", err)
+		}
+		putDate, err := time.Parse("2006-01-02", window.PutDate)
+		if err != nil {
+			return fmt.Errorf("invalid put date: %v", err)
+		}
+		if windowEnd.Before(windowStart) || !putDate.After(windowEnd) {
+			return fmt.Errorf("put window must close before its put date")
+		}
+		if window.Price <= 0 {
+			return fmt.Errorf("put price must be positive")
+		}
+	}
+
+	if terms.ConversionRatio != 0 || terms.ConversionStart != "" || terms.ConversionEnd != "" {
+		if terms.ConversionRatio <= 0 {
+			return fmt.Errorf("conversion ratio must be positive")
+		}
+		if terms.Underlying == "" {
+			return fmt.Errorf("convertible bonds require an underlying")
+		}
+		conversionStart, err := time.Parse("2006-01-02", terms.ConversionStart)
+		if err != nil {
+			return fmt.Errorf("invalid conversion start: %v", err)
+		}
+		conversionEnd, err := time.Parse("2006-01-02", terms.ConversionEnd)
+		if err != nil {
+			return fmt.Errorf("invalid conversion end: %v", err)
+		}
+		if conversionEnd.Before(conversionStart) {
+			return fmt.Errorf("conversion window must end after it starts")
+		}
+	}
+
+	switch terms.CouponFrequency {
+	case 0, 1, 2, 4, 12:
+	default:
+		return fmt.Errorf("invalid coupon frequency: %d per year", terms.CouponFrequency)
+	}
+	switch terms.DayCount {
+	case "", "30/360", "ACT/360", "ACT/365", "ACT/ACT":
+	default:
+		return fmt.Errorf("invalid day count convention: %s", terms.DayCount)
+	}
+	switch terms.BusinessDayConvention {
+	case "", "FOLLOWING", "MODIFIED_FOLLOWING", "PRECEDING", "UNADJUSTED":
+	default:
+		return fmt.Errorf("invalid business day convention: %s", terms.BusinessDayConvention)
+	}
+	for _, calendar := range terms.HolidayCalendars {
+		if calendar == "" || strings.ToUpper(calendar) != calendar {
+			return fmt.Errorf("invalid holiday calendar: %q", calendar)
+		}
+	}
+	return nil
+}
+
+// bondTypeOf returns the bond's type, treating bonds issued before bond
+// types were introduced as FIXED
+func bondTypeOf(bond *Bond) string {
+	if bond.BondType == "" {
+		return "FIXED"
+	}
+	return bond.BondType
+}
+
+// isCurrencyCode reports whether code looks like an ISO 4217 currency code
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// outstandingFace returns the principal still outstanding per token, treating
+// bonds issued before amortization was introduced as unamortized
+func outstandingFace(bond *Bond) float64 {
+	if bond.OutstandingFaceValue == 0 && len(bond.Amortization) == 0 {
+		return bond.FaceValue
+	}
+	return bond.OutstandingFaceValue
+}
+
+// annualCouponRate returns the coupon rate (in percent) currently paid by a
+// bond. FRNs carry their latest reset rate in CouponRate.
+func annualCouponRate(bond *Bond) float64 {
+	if bondTypeOf(bond) == "ZERO_COUPON" {
+		return 0
+	}
+	return bond.CouponRate
+}
+
+// bondKey returns the composite state key of a bond
+func bondKey(ctx contractapi.TransactionContextInterface, bondID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(bondObjectType, []string{bondID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create bond key: %v", err)
+	}
+	return key, nil
+}
+
+// holderKey returns the composite state key of an address's holding of a bond
+func holderKey(ctx contractapi.TransactionContextInterface, bondID, address string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(holderObjectType, []string{bondID, address})
+	if err != nil {
+		return "", fmt.Errorf("failed to create holder key: %v", err)
+	}
+	return key, nil
+}
+
+// putBond bumps the bond's version and stores it under its composite key,
+// returning the stored JSON
+func (bt *BondToken) putBond(ctx contractapi.TransactionContextInterface, bond *Bond) ([]byte, error) {
+	key, err := bondKey(ctx, bond.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	bond.Version++
+	bondJSON, err := json.Marshal(bond)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bond: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, bondJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store bond: %v", err)
+	}
+
+	return bondJSON, nil
+}
+
+// putHolder bumps the holder's version and stores it under its composite key
+func (bt *BondToken) putHolder(ctx contractapi.TransactionContextInterface, holder *TokenHolder) error {
+	key, err := holderKey(ctx, holder.BondID, holder.Address)
+	if err != nil {
+		return err
+	}
+
+	holder.Version++
+	holderJSON, err := json.Marshal(holder)
+	if err != nil {
+		return fmt.Errorf("failed to marshal holder: %v", err)
+	}
+
+	return ctx.GetStub().PutState(key, holderJSON)
+}
+
+// moveTapLots moves the tap lots that leave a holding when quantity tokens
+// are taken out of it to the receiving holding, or drops them when to is
+// nil. Tokens of the original issue leave first, then the newest lots.
+func moveTapLots(from, to *TokenHolder, quantity int64) {
+	var lotted int64
+	for _, lot := range from.TapLots {
+		lotted += lot.Quantity
+	}
+
+	excess := quantity - (from.Quantity - lotted)
+	for i := len(from.TapLots) - 1; i >= 0 && excess > 0; i-- {
+		lot := &from.TapLots[i]
+		moved := lot.Quantity
+		if moved > excess {
+			moved = excess
+		}
+		lot.Quantity -= moved
+		excess -= moved
+
+		if to != nil {
+			merged := false
+			for j := range to.TapLots {
+				if to.TapLots[j].Tranche == lot.Tranche {
+					to.TapLots[j].Quantity += moved
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				to.TapLots = append(to.TapLots, TapLot{
+					Tranche:      lot.Tranche,
+					Quantity:     moved,
+					AccrualStart: lot.AccrualStart,
+				})
+			}
+		}
+	}
+
+	lots := from.TapLots[:0]
+	for _, lot := range from.TapLots {
+		if lot.Quantity > 0 {
+			lots = append(lots, lot)
+		}
+	}
+	from.TapLots = lots
+}
+
+// setHoldingFrozen freezes or unfreezes a holder record
+func (bt *BondToken) setHoldingFrozen(ctx contractapi.TransactionContextInterface, bondID, address string, frozen bool, reason string) error {
+	err := requireRole(ctx, registrarRole)
+	if err != nil {
+		return err
+	}
+
+	if frozen && reason == "" {
+		return fmt.Errorf("freeze reason is required")
+	}
+
+	holder, err := bt.GetTokenHolder(ctx, address, bondID)
+	if err != nil {
+		return fmt.Errorf("failed to get holder: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	holder.Frozen = frozen
+	holder.FreezeReason = reason
+	holder.LastUpdated = txTime
+	err = bt.putHolder(ctx, holder)
+	if err != nil {
+		return fmt.Errorf("failed to store holder: %v", err)
+	}
+
+	eventName := "HoldingUnfrozen"
+	if frozen {
+		eventName = "HoldingFrozen"
+	}
+	holderJSON, err := json.Marshal(holder)
+	if err != nil {
+		return fmt.Errorf("failed to marshal holder: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent(eventName, holderJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// setComplianceHold adds a compliance hold to, or removes it from, an
+// address's holding of a bond or, when bondID is empty, all its holdings
+// and the address itself
+func (bt *BondToken) setComplianceHold(ctx contractapi.TransactionContextInterface, holdID, address, bondID string, held bool) (int, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return 0, err
+	}
+
+	if holdID == "" || address == "" {
+		return 0, fmt.Errorf("hold ID and address are required")
+	}
+
+	var holders []*TokenHolder
+	if bondID != "" {
+		holder, err := bt.GetTokenHolder(ctx, address, bondID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get holder: %v", err)
+		}
+		holders = append(holders, holder)
+	} else {
+		bonds, err := bt.GetAllBonds(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, bond := range bonds {
+			key, err := holderKey(ctx, bond.ID, address)
+			if err != nil {
+				return 0, err
+			}
+			holderJSON, err := ctx.GetStub().GetState(key)
+			if err != nil {
+				return 0, fmt.Errorf("failed to read holder: %v", err)
+			}
+			if holderJSON == nil {
+				continue
+			}
+
+			var holder TokenHolder
+			err = json.Unmarshal(holderJSON, &holder)
+			if err != nil {
+				return 0, fmt.Errorf("failed to unmarshal holder: %v", err)
+			}
+			holders = append(holders, &holder)
+		}
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if bondID == "" {
+		err = setAddressHold(ctx, holdID, address, held)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	changed := 0
+	for _, holder := range holders {
+		var holds []string
+		for _, id := range holder.ComplianceHolds {
+			if id != holdID {
+				holds = append(holds, id)
+			}
+		}
+		if held {
+			holds = append(holds, holdID)
+		}
+		if len(holds) == len(holder.ComplianceHolds) {
+			continue
+		}
+
+		holder.ComplianceHolds = holds
+		holder.LastUpdated = now
+		err = bt.putHolder(ctx, holder)
+		if err != nil {
+			return 0, fmt.Errorf("failed to store holder: %v", err)
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// getAddressHolds returns the IDs of the compliance holds placed on all of
+// an address's holdings
+func getAddressHolds(ctx contractapi.TransactionContextInterface, address string) ([]string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(addressHoldObjectType, []string{address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create address hold key: %v", err)
+	}
+
+	holdsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read address holds: %v", err)
+	}
+	if holdsJSON == nil {
+		return nil, nil
+	}
+
+	var holds []string
+	err = json.Unmarshal(holdsJSON, &holds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal address holds: %v", err)
+	}
+	return holds, nil
+}
+
+// setAddressHold adds a compliance hold to, or removes it from, an
+// address's ADDRESSHOLD record, deleting the record when no hold is left
+func setAddressHold(ctx contractapi.TransactionContextInterface, holdID, address string, held bool) error {
+	current, err := getAddressHolds(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	var holds []string
+	for _, id := range current {
+		if id != holdID {
+			holds = append(holds, id)
+		}
+	}
+	if held {
+		holds = append(holds, holdID)
+	}
+	if len(holds) == len(current) {
+		return nil
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(addressHoldObjectType, []string{address})
+	if err != nil {
+		return fmt.Errorf("failed to create address hold key: %v", err)
+	}
+
+	if len(holds) == 0 {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete address holds: %v", err)
+		}
+		return nil
+	}
+
+	holdsJSON, err := json.Marshal(holds)
+	if err != nil {
+		return fmt.Errorf("failed to marshal address holds: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, holdsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store address holds: %v", err)
+	}
+	return nil
+}
+
+// complianceCheckTransfer asks the Compliance contract whether a transfer
+// meets its KYC, AML and jurisdiction rules for the bond. With record set it
+// calls RecordTransfer, which also counts the decision against the parties'
+// limits, and otherwise the read-only CheckTransfer.
+func complianceCheckTransfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64, record bool) (*ComplianceDecision, error) {
+	function := "CheckTransfer"
+	if record {
+		function = "RecordTransfer"
+	}
+
+	args := [][]byte{[]byte(function), []byte(from), []byte(to), []byte(bondID), []byte(strconv.FormatInt(quantity, 10))}
+	response := ctx.GetStub().InvokeChaincode(complianceChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to check transfer compliance: %s", response.Message)
+	}
+
+	var decision ComplianceDecision
+	err := json.Unmarshal(response.Payload, &decision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal compliance decision: %v", err)
+	}
+
+	return &decision, nil
+}
+
+// holderAsOf returns the last value written to a holder key before cutoff,
+// or nil if the key did not exist then
+func holderAsOf(ctx contractapi.TransactionContextInterface, key string, cutoff time.Time) (*TokenHolder, error) {
+	historyIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holder history: %v", err)
+	}
+	defer historyIterator.Close()
+
+	var holder *TokenHolder
+	var latest time.Time
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate history: %v", err)
+		}
+
+		modifiedAt := time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC()
+		if !modifiedAt.Before(cutoff) || modifiedAt.Before(latest) {
+			continue
+		}
+		latest = modifiedAt
+
+		if modification.IsDelete {
+			holder = nil
+			continue
+		}
+		var value TokenHolder
+		err = json.Unmarshal(modification.Value, &value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal holder: %v", err)
+		}
+		holder = &value
+	}
+
+	return holder, nil
+}
+
+// heldQuantity returns the tokens an address holds in a bond, or 0 when it
+// has no holding
+func (bt *BondToken) heldQuantity(ctx contractapi.TransactionContextInterface, address, bondID string) int64 {
+	holder, err := bt.GetTokenHolder(ctx, address, bondID)
+	if err != nil {
+		return 0
+	}
+	return holder.Quantity
+}
+
+// holdingCap returns the effective per-investor holding limit in tokens,
+// or 0 when the bond has none
+func holdingCap(bond *Bond) int64 {
+	maxHolding := bond.MaxHolding
+	if bond.MaxHoldingPercent > 0 {
+		percentCap := int64(float64(bond.TotalSupply) * bond.MaxHoldingPercent / 100)
+		if maxHolding == 0 || percentCap < maxHolding {
+			maxHolding = percentCap
+		}
+	}
+	return maxHolding
+}
+
+// denyTransfer builds a failed TransferCheck
+func denyTransfer(code, format string, args ...interface{}) *TransferCheck {
+	return &TransferCheck{Allowed: false, ReasonCode: code, Reason: fmt.Sprintf(format, args...)}
+}
+
+// whitelistKey returns the WHITELIST~bond~address composite key
+func whitelistKey(ctx contractapi.TransactionContextInterface, bondID, address string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(whitelistObjectType, []string{bondID, address})
+	if err != nil {
+		return "", fmt.Errorf("failed to create whitelist key: %v", err)
+	}
+	return key, nil
+}
+
+// requireRole checks that the invoking identity carries one of the given
+// values in its "role" certificate attribute
+func requireRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	for _, role := range roles {
+		if ctx.GetClientIdentity().AssertAttributeValue("role", role) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("caller is not authorized: %s role required", strings.Join(roles, " or "))
+}
+
+// checkVersion rejects a write made against a stale view of a record. An
+// expected version of 0 skips the check.
+func checkVersion(record string, current, expected int64) error {
+	if expected != 0 && current != expected {
+		return fmt.Errorf("version conflict: %s is at version %d, expected %d", record, current, expected)
+	}
+	return nil
+}
+
+// txTimestamp returns the timestamp the client set in the transaction
+// proposal, so every endorsing peer computes the same dates from it
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// approximateYield returns the approximate yield to maturity (in percent) of
+// a bond bought at price, using the standard bond-yield approximation
+func approximateYield(bond *Bond, price float64, asOf time.Time) float64 {
+	if price <= 0 {
+		return 0
+	}
+
+	// Coupons accrue on, and redemption repays, the outstanding principal
+	face := outstandingFace(bond)
+	annualCoupon := face * annualCouponRate(bond) / 100
+	years := bond.MaturityDate.Sub(asOf).Hours() / (24 * 365)
+	if years <= 0 {
+		return annualCoupon / price * 100
+	}
+
+	return (annualCoupon + (face-price)/years) / ((face + price) / 2) * 100
+}
+
+// ratingBucket classifies a credit rating such as "AA+" or "CRISIL BBB-"
+// as INVESTMENT_GRADE, HIGH_YIELD or UNRATED
+func ratingBucket(rating string) string {
+	fields := strings.Fields(strings.ToUpper(rating))
+	if len(fields) == 0 {
+		return "UNRATED"
+	}
+
+	grade := strings.TrimRight(fields[len(fields)-1], "+-")
+	switch grade {
+	case "AAA", "AA", "A", "BBB":
+		return "INVESTMENT_GRADE"
+	case "BB", "B", "CCC", "CC", "C", "D":
+		return "HIGH_YIELD"
+	}
+	return "UNRATED"
+}
+
+// ratingRank orders ratings from strongest (0) to weakest for sorting
+func ratingRank(rating string) int {
+	scale := []string{"AAA", "AA+", "AA", "AA-", "A+", "A", "A-", "BBB+", "BBB", "BBB-",
+		"BB+", "BB", "BB-", "B+", "B", "B-", "CCC", "CC", "C", "D"}
+
+	fields := strings.Fields(strings.ToUpper(rating))
+	if len(fields) > 0 {
+		for i, r := range scale {
+			if fields[len(fields)-1] == r {
+				return i
+			}
+		}
+	}
+	return len(scale)
+}
+
+// sortScreenedBonds sorts screener results in place, using the bond ID as a
+// tie-breaker so pagination is stable between calls
+func sortScreenedBonds(bonds []*ScreenedBond, sortBy string, desc bool) {
+	less := func(a, b *ScreenedBond) bool {
+		switch sortBy {
+		case "maturity":
+			if !a.Bond.MaturityDate.Equal(b.Bond.MaturityDate) {
+				return a.Bond.MaturityDate.Before(b.Bond.MaturityDate)
+			}
+		case "coupon":
+			if annualCouponRate(a.Bond) != annualCouponRate(b.Bond) {
+				return annualCouponRate(a.Bond) < annualCouponRate(b.Bond)
+			}
+		case "yield":
+			if a.Yield != b.Yield {
+				return a.Yield < b.Yield
+			}
+		case "rating":
+			if ratingRank(a.Bond.Rating) != ratingRank(b.Bond.Rating) {
+				return ratingRank(a.Bond.Rating) < ratingRank(b.Bond.Rating)
+			}
+		}
+		return a.Bond.ID < b.Bond.ID
+	}
+
+	sort.SliceStable(bonds, func(i, j int) bool {
+		if desc {
+			return less(bonds[j], bonds[i])
+		}
+		return less(bonds[i], bonds[j])
+	})
+}
+
 func main() {
 	chaincode, err := contractapi.NewChaincode(&BondToken{})
 	if err != nil {
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -52,10 +56,86 @@ func (m *MockStub) SetEvent(name string, payload []byte) error {
 	return args.Error(0)
 }
 
+func (m *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	args := m.Called()
+	return args.Get(0).(*timestamp.Timestamp), args.Error(1)
+}
+
+func (m *MockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return compositeKey(objectType, attributes...), nil
+}
+
+func (m *MockStub) GetStateByPartialCompositeKey(objectType string, keys []string) (contractapi.StateQueryIteratorInterface, error) {
+	args := m.Called(objectType, keys)
+	return args.Get(0).(contractapi.StateQueryIteratorInterface), args.Error(1)
+}
+
+func (m *MockStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	called := m.Called(chaincodeName, args, channel)
+	return called.Get(0).(peer.Response)
+}
+
+// compositeKey builds a composite key using the same encoding as the Fabric shim
+func compositeKey(objectType string, attributes ...string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
+}
+
 // MockContext is a mock implementation of the transaction context
 type MockContext struct {
 	mock.Mock
-	stub *MockStub
+	stub     *MockStub
+	identity *MockClientIdentity // defaults to a client of Org1MSP without attributes
+}
+
+func (m *MockContext) GetClientIdentity() cid.ClientIdentity {
+	if m.identity != nil {
+		return m.identity
+	}
+	return &MockClientIdentity{id: "client", mspID: "Org1MSP"}
+}
+
+// MockClientIdentity is a fixed client identity
+type MockClientIdentity struct {
+	id         string
+	mspID      string
+	attributes map[string]string
+}
+
+// Clients holding the REGISTRAR, TRUSTEE, COMPLIANCE_OFFICER and
+// PAYING_AGENT roles
+var (
+	registrar         = &MockClientIdentity{id: "registrar", mspID: "RegistrarMSP", attributes: map[string]string{"role": "REGISTRAR"}}
+	trustee           = &MockClientIdentity{id: "trustee", mspID: "TrusteeMSP", attributes: map[string]string{"role": "TRUSTEE"}}
+	complianceOfficer = &MockClientIdentity{id: "officer", mspID: "ComplianceMSP", attributes: map[string]string{"role": "COMPLIANCE_OFFICER"}}
+	payingAgent       = &MockClientIdentity{id: "agent", mspID: "AgentMSP", attributes: map[string]string{"role": "PAYING_AGENT"}}
+)
+
+func (m *MockClientIdentity) GetID() (string, error) {
+	return m.id, nil
+}
+
+func (m *MockClientIdentity) GetMSPID() (string, error) {
+	return m.mspID, nil
+}
+
+func (m *MockClientIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := m.attributes[name]
+	return value, found, nil
+}
+
+func (m *MockClientIdentity) AssertAttributeValue(name, value string) error {
+	if m.attributes[name] != value {
+		return fmt.Errorf("attribute %s does not have value %s", name, value)
+	}
+	return nil
+}
+
+func (m *MockClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
 }
 
 func (m *MockContext) GetStub() contractapi.TransactionContextInterface {
@@ -86,10 +166,27 @@ func (m *MockContext) SetEvent(name string, payload []byte) error {
 	return m.stub.SetEvent(name, payload)
 }
 
+func (m *MockContext) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return m.stub.GetTxTimestamp()
+}
+
+func (m *MockContext) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return m.stub.CreateCompositeKey(objectType, attributes)
+}
+
+func (m *MockContext) GetStateByPartialCompositeKey(objectType string, keys []string) (contractapi.StateQueryIteratorInterface, error) {
+	return m.stub.GetStateByPartialCompositeKey(objectType, keys)
+}
+
+func (m *MockContext) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	return m.stub.InvokeChaincode(chaincodeName, args, channel)
+}
+
 // MockIterator is a mock implementation of the state query iterator
 type MockIterator struct {
 	mock.Mock
 	results [][]byte
+	keys    []string // optional
 	index   int
 }
 
@@ -105,6 +202,9 @@ func (m *MockIterator) Next() (*contractapi.QueryResult, error) {
 	result := &contractapi.QueryResult{
 		Value: m.results[m.index],
 	}
+	if m.keys != nil {
+		result.Key = m.keys[m.index]
+	}
 	m.index++
 	return result, nil
 }
@@ -163,6 +263,24 @@ func TestBondToken_CreateBond_AlreadyExists(t *testing.T) {
 	assert.Contains(t, err.Error(), "already exists")
 }
 
+func TestBondToken_IssueBond_AllotsIssuer(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "BondIssued", mock.Anything).Return(nil)
+
+	err := bt.IssueBond(ctx, "BOND_001", "ISSUER_001", "Issuer", "USD", "US0000000001", "AA", "NONE", 1000.0, 5.0, 100, "2030-01-01")
+	assert.NoError(t, err)
+
+	var issuer TokenHolder
+	json.Unmarshal(ctx.stub.state[compositeKey("HOLDER", "BOND_001", "ISSUER_001")], &issuer)
+	assert.Equal(t, int64(100), issuer.Quantity)
+}
+
 func TestBondToken_TransferBond(t *testing.T) {
 	bt := &BondToken{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
@@ -254,7 +372,7 @@ func TestBondToken_GetAllBonds(t *testing.T) {
 
 func TestBondToken_UpdateBondStatus(t *testing.T) {
 	bt := &BondToken{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: trustee}
 	
 	// Create a bond
 	bond := Bond{
@@ -275,7 +393,7 @@ func TestBondToken_UpdateBondStatus(t *testing.T) {
 	ctx.stub.On("GetTxID").Return("tx123")
 	ctx.stub.On("SetEvent", "BondEvent", mock.Anything).Return(nil)
 	
-	err := bt.UpdateBondStatus(ctx, "BOND_001", "MATURED")
+	err := bt.UpdateBondStatus(ctx, "BOND_001", "DEFAULTED", 0)
 	assert.NoError(t, err)
 	
 	ctx.stub.AssertExpectations(t)
@@ -328,3 +446,748 @@ func TestBondToken_GetBondsByOwner(t *testing.T) {
 	assert.Equal(t, "alice", bonds[1].Owner)
 }
 
+
+func TestRatingBucket(t *testing.T) {
+	assert.Equal(t, "INVESTMENT_GRADE", ratingBucket("AAA"))
+	assert.Equal(t, "INVESTMENT_GRADE", ratingBucket("CRISIL BBB-"))
+	assert.Equal(t, "HIGH_YIELD", ratingBucket("BB+"))
+	assert.Equal(t, "UNRATED", ratingBucket(""))
+	assert.Equal(t, "UNRATED", ratingBucket("NR"))
+}
+
+func TestApproximateYield(t *testing.T) {
+	asOf := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bond := &Bond{
+		ID:           "BOND_001",
+		FaceValue:    1000.0,
+		CouponRate:   5.0,
+		MaturityDate: asOf.AddDate(5, 0, 0),
+	}
+
+	// At par the yield equals the coupon rate
+	assert.InDelta(t, 5.0, approximateYield(bond, 1000.0, asOf), 0.01)
+
+	// Discount bonds yield more than their coupon
+	assert.Greater(t, approximateYield(bond, 950.0, asOf), 5.0)
+}
+
+func TestSortScreenedBonds(t *testing.T) {
+	bonds := []*ScreenedBond{
+		{Bond: &Bond{ID: "BOND_002", CouponRate: 7.0}, Yield: 6.5},
+		{Bond: &Bond{ID: "BOND_001", CouponRate: 5.0}, Yield: 8.0},
+		{Bond: &Bond{ID: "BOND_003", CouponRate: 5.0}, Yield: 4.0},
+	}
+
+	sortScreenedBonds(bonds, "coupon", false)
+	assert.Equal(t, "BOND_001", bonds[0].Bond.ID)
+	assert.Equal(t, "BOND_003", bonds[1].Bond.ID)
+	assert.Equal(t, "BOND_002", bonds[2].Bond.ID)
+
+	sortScreenedBonds(bonds, "yield", true)
+	assert.Equal(t, "BOND_001", bonds[0].Bond.ID)
+	assert.Equal(t, "BOND_003", bonds[2].Bond.ID)
+}
+
+func TestBondToken_RegisterDocument_InvalidHash(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{ID: "BOND_001", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+
+	err := bt.RegisterDocument(ctx, "BOND_001", "PROSPECTUS", "not-a-hash", "ipfs://prospectus", "1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid SHA-256 hash")
+}
+
+func TestBondToken_MatureBond(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: registrar}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		FaceValue:    1000.0,
+		TotalSupply:  100,
+		MaturityDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2029, 1, 2, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("BOND", "BOND_001"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "BondMatured", mock.Anything).Return(nil)
+
+	err := bt.MatureBond(ctx, "BOND_001")
+	assert.NoError(t, err)
+
+	var stored Bond
+	json.Unmarshal(ctx.stub.state[compositeKey("BOND", "BOND_001")], &stored)
+	assert.Equal(t, "MATURED", stored.Status)
+
+	// The final redemption is left to CorporateAction ProcessMaturity
+	ctx.stub.AssertNotCalled(t, "InvokeChaincode", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBondToken_MatureBond_NotAuthorized(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: trustee}
+
+	err := bt.MatureBond(ctx, "BOND_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "REGISTRAR or PAYING_AGENT role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestBondToken_MatureBond_BeforeMaturity(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: registrar}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		FaceValue:    1000.0,
+		TotalSupply:  100,
+		MaturityDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2028, 12, 31, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	err := bt.MatureBond(ctx, "BOND_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not mature until")
+}
+
+func TestBondToken_RetireBond_AfterMatureBond(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	// MatureBond has already marked the bond, but its holdings are not burned
+	bond := Bond{
+		ID:           "BOND_001",
+		TotalSupply:  100,
+		MaturityDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "MATURED",
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2029, 1, 2, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	holder := TokenHolder{Address: "alice", BondID: "BOND_001", Quantity: 100}
+	holderJSON, _ := json.Marshal(holder)
+	mockIterator := &MockIterator{results: [][]byte{holderJSON}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "HOLDER", []string{"BOND_001"}).Return(mockIterator, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "BondMatured", mock.Anything).Return(nil)
+
+	err := bt.RetireBond(ctx, "BOND_001")
+	assert.NoError(t, err)
+
+	var stored Bond
+	json.Unmarshal(ctx.stub.state[compositeKey("BOND", "BOND_001")], &stored)
+	assert.Equal(t, int64(0), stored.TotalSupply)
+	var burned TokenHolder
+	json.Unmarshal(ctx.stub.state[compositeKey("HOLDER", "BOND_001", "alice")], &burned)
+	assert.Equal(t, int64(0), burned.Quantity)
+}
+
+func TestBondToken_RetireBond_AlreadyRetired(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	bond := Bond{ID: "BOND_001", Status: "MATURED"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+
+	err := bt.RetireBond(ctx, "BOND_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already been retired")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestBondToken_Transfer_AfterMaturity(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		MaturityDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	err := bt.Transfer(ctx, "alice", "bob", "BOND_001", 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "reached maturity")
+}
+
+func TestValidateBondTerms(t *testing.T) {
+	assert.NoError(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{}))
+	assert.Error(t, validateBondTerms("FIXED", 1000.0, 0, BondTerms{}))
+
+	assert.NoError(t, validateBondTerms("ZERO_COUPON", 1000.0, 0, BondTerms{IssuePrice: 820.0}))
+	assert.Error(t, validateBondTerms("ZERO_COUPON", 1000.0, 0, BondTerms{IssuePrice: 1000.0}))
+	assert.Error(t, validateBondTerms("ZERO_COUPON", 1000.0, 2.0, BondTerms{IssuePrice: 820.0}))
+
+	assert.NoError(t, validateBondTerms("FRN", 1000.0, 6.5, BondTerms{BenchmarkIndex: "SOFR", Spread: 150, ResetFrequency: 3}))
+	assert.Error(t, validateBondTerms("FRN", 1000.0, 6.5, BondTerms{Spread: 150, ResetFrequency: 3}))
+	assert.Error(t, validateBondTerms("FRN", 1000.0, 6.5, BondTerms{BenchmarkIndex: "SOFR", ResetFrequency: 5}))
+	assert.Error(t, validateBondTerms("FRN", 1000.0, 6.5, BondTerms{BenchmarkIndex: "SOFR", ResetFrequency: 3, RateCap: 4, RateFloor: 5}))
+
+	assert.Error(t, validateBondTerms("PERPETUAL", 1000.0, 5.0, BondTerms{}))
+
+	assert.NoError(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{CouponFrequency: 4, DayCount: "ACT/365", BusinessDayConvention: "MODIFIED_FOLLOWING"}))
+	assert.Error(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{CouponFrequency: 3}))
+	assert.Error(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{DayCount: "ACT/364"}))
+	assert.NoError(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{HolidayCalendars: []string{"USNY", "GBLO"}}))
+	assert.Error(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{HolidayCalendars: []string{"usny"}}))
+
+	callSchedule := []CallPeriod{{StartDate: "2027-01-01", Price: 102.0}, {StartDate: "2028-01-01", Price: 101.0}}
+	assert.NoError(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{CallSchedule: callSchedule, CallNoticeDays: 30}))
+	assert.Error(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{CallSchedule: []CallPeriod{callSchedule[1], callSchedule[0]}}))
+
+	putWindow := PutWindow{WindowStart: "2027-01-01", WindowEnd: "2027-01-31", PutDate: "2027-03-01", Price: 100.0}
+	assert.NoError(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{PutSchedule: []PutWindow{putWindow}}))
+	putWindow.PutDate = "2027-01-15"
+	assert.Error(t, validateBondTerms("FIXED", 1000.0, 5.0, BondTerms{PutSchedule: []PutWindow{putWindow}}))
+
+	convertible := BondTerms{ConversionRatio: 12.5, ConversionStart: "2026-01-01", ConversionEnd: "2028-12-31", Underlying: "INE002A01018"}
+	assert.NoError(t, validateBondTerms("FIXED", 1000.0, 5.0, convertible))
+	convertible.Underlying = ""
+	assert.Error(t, validateBondTerms("FIXED", 1000.0, 5.0, convertible))
+}
+
+func TestApproximateYield_ZeroCoupon(t *testing.T) {
+	asOf := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bond := &Bond{
+		ID:           "BOND_ZERO",
+		FaceValue:    1000.0,
+		BondType:     "ZERO_COUPON",
+		MaturityDate: asOf.AddDate(5, 0, 0),
+	}
+
+	// Zero-coupon yield comes entirely from the pull to par
+	assert.Equal(t, 0.0, annualCouponRate(bond))
+	assert.Greater(t, approximateYield(bond, 800.0, asOf), 0.0)
+	assert.InDelta(t, 0.0, approximateYield(bond, 1000.0, asOf), 0.01)
+}
+
+func TestBondToken_SetAmortizationSchedule_ExceedsFaceValue(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: registrar}
+
+	bond := Bond{
+		ID:                   "BOND_001",
+		FaceValue:            1000.0,
+		OutstandingFaceValue: 1000.0,
+		MaturityDate:         time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:               "ACTIVE",
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+
+	err := bt.SetAmortizationSchedule(ctx, "BOND_001", `[{"date":"2026-01-01","amount":600},{"date":"2027-01-01","amount":600}]`, 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds face value")
+}
+
+func TestBondToken_ApplyAmortization_NotPayingAgent(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: registrar}
+
+	err := bt.ApplyAmortization(ctx, "BOND_001", "2026-01-01")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestOutstandingFace(t *testing.T) {
+	// Bonds issued before amortization support are fully outstanding
+	assert.Equal(t, 1000.0, outstandingFace(&Bond{FaceValue: 1000.0}))
+
+	assert.Equal(t, 600.0, outstandingFace(&Bond{
+		FaceValue:            1000.0,
+		OutstandingFaceValue: 600.0,
+		Amortization:         []AmortizationEntry{{Amount: 400.0, Applied: true}},
+	}))
+
+	// A fully amortized bond has nothing left outstanding
+	assert.Equal(t, 0.0, outstandingFace(&Bond{
+		FaceValue:    1000.0,
+		Amortization: []AmortizationEntry{{Amount: 1000.0, Applied: true}},
+	}))
+}
+
+func TestIsCurrencyCode(t *testing.T) {
+	assert.True(t, isCurrencyCode("USD"))
+	assert.True(t, isCurrencyCode("INR"))
+	assert.False(t, isCurrencyCode("usd"))
+	assert.False(t, isCurrencyCode("EURO"))
+	assert.False(t, isCurrencyCode(""))
+}
+
+func TestBondToken_GetBondHolders_CompositeKeys(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	holder1 := TokenHolder{Address: "alice", BondID: "BOND_WITH_A_LONG_IDENTIFIER", Quantity: 10}
+	holder2 := TokenHolder{Address: "bob", BondID: "BOND_WITH_A_LONG_IDENTIFIER", Quantity: 5}
+
+	holder1JSON, _ := json.Marshal(holder1)
+	holder2JSON, _ := json.Marshal(holder2)
+
+	mockIterator := &MockIterator{results: [][]byte{holder1JSON, holder2JSON}}
+	mockIterator.On("Close").Return(nil)
+
+	ctx.stub.On("GetStateByPartialCompositeKey", "HOLDER", []string{"BOND_WITH_A_LONG_IDENTIFIER"}).Return(mockIterator, nil)
+
+	holders, err := bt.GetBondHolders(ctx, "BOND_WITH_A_LONG_IDENTIFIER")
+	assert.NoError(t, err)
+	assert.Len(t, holders, 2)
+	assert.Equal(t, "alice", holders[0].Address)
+}
+
+func TestBondToken_GetHolderStats(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	holder1 := TokenHolder{Address: "alice", BondID: "BOND_001", Quantity: 60, Locked: 10}
+	holder2 := TokenHolder{Address: "bob", BondID: "BOND_001", Quantity: 30}
+	holder3 := TokenHolder{Address: "carol", BondID: "BOND_001", Quantity: 10}
+	holder4 := TokenHolder{Address: "dave", BondID: "BOND_001", Quantity: 0}
+
+	holder1JSON, _ := json.Marshal(holder1)
+	holder2JSON, _ := json.Marshal(holder2)
+	holder3JSON, _ := json.Marshal(holder3)
+	holder4JSON, _ := json.Marshal(holder4)
+
+	mockIterator := &MockIterator{results: [][]byte{holder3JSON, holder1JSON, holder4JSON, holder2JSON}}
+	mockIterator.On("Close").Return(nil)
+
+	ctx.stub.On("GetStateByPartialCompositeKey", "HOLDER", []string{"BOND_001"}).Return(mockIterator, nil)
+
+	stats, err := bt.GetHolderStats(ctx, "BOND_001", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.HolderCount)
+	assert.Equal(t, int64(100), stats.TotalQuantity)
+	assert.Equal(t, int64(10), stats.LockedQuantity)
+	assert.Equal(t, int64(90), stats.FreeQuantity)
+	assert.Len(t, stats.TopHolders, 2)
+	assert.Equal(t, "alice", stats.TopHolders[0].Address)
+	assert.InDelta(t, 90.0, stats.TopConcentration, 0.001)
+}
+
+func TestBondToken_GetHolderSnapshot_NotTaken(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	ctx.stub.On("GetState", compositeKey("HOLDERSNAPSHOT", "BOND_001", "20240530")).Return(nil, nil)
+
+	_, err := bt.GetHolderSnapshot(ctx, "BOND_001", "2024-05-30")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no holder snapshot")
+}
+
+func TestBondToken_UpdateBondStatus_VersionConflict(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: trustee}
+
+	bond := Bond{ID: "BOND_001", Status: "ACTIVE", Version: 4}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+
+	err := bt.UpdateBondStatus(ctx, "BOND_001", "DEFAULTED", 3)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "version conflict")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestBondToken_UpdateBondStatus_NotAuthorized(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := bt.UpdateBondStatus(ctx, "BOND_001", "DEFAULTED", 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TRUSTEE or REGISTRAR role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestBondToken_UpdateBondStatus_InvalidTransition(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: trustee}
+
+	bond := Bond{ID: "BOND_001", Status: "DEFAULTED"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+
+	// Leaving default goes through RestructureTerms
+	err := bt.UpdateBondStatus(ctx, "BOND_001", "ACTIVE", 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot move from DEFAULTED to ACTIVE")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestBondToken_VoidBond_NotRegistrar(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: trustee}
+
+	err := bt.VoidBond(ctx, "BOND_001", "prospectus upload error")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "REGISTRAR role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestBondToken_VoidBond_AfterDistribution(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: registrar}
+
+	bond := Bond{ID: "BOND_001", IssuerID: "ISSUER_001", TotalSupply: 100, Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+
+	issuer := TokenHolder{Address: "ISSUER_001", BondID: "BOND_001", Quantity: 90}
+	investor := TokenHolder{Address: "alice", BondID: "BOND_001", Quantity: 10}
+	issuerJSON, _ := json.Marshal(issuer)
+	investorJSON, _ := json.Marshal(investor)
+
+	mockIterator := &MockIterator{results: [][]byte{issuerJSON, investorJSON}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "HOLDER", []string{"BOND_001"}).Return(mockIterator, nil)
+
+	err := bt.VoidBond(ctx, "BOND_001", "prospectus upload error")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be voided")
+}
+
+func TestBondToken_Transfer_Voided(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{ID: "BOND_001", Status: "VOID"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+
+	err := bt.Transfer(ctx, "ISSUER_001", "alice", "BOND_001", 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "voided")
+}
+
+func TestBondToken_Transfer_NotWhitelisted(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		IssuerID:     "ISSUER_001",
+		MaturityDate: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+		Restricted:   true,
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetState", compositeKey("WHITELIST", "BOND_001", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	err := bt.Transfer(ctx, "ISSUER_001", "alice", "BOND_001", 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not whitelisted")
+}
+
+func TestBondToken_CanTransfer_LotSize(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		MaturityDate: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+		LotSize:      10,
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	check, err := bt.CanTransfer(ctx, "alice", "bob", "BOND_001", 15)
+	assert.NoError(t, err)
+	assert.False(t, check.Allowed)
+	assert.Equal(t, "LOT_SIZE", check.ReasonCode)
+}
+
+func TestBondToken_CanTransfer_Frozen(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		MaturityDate: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+	}
+	holder := TokenHolder{Address: "alice", BondID: "BOND_001", Quantity: 100, Frozen: true, FreezeReason: "court order"}
+	bondJSON, _ := json.Marshal(bond)
+	holderJSON, _ := json.Marshal(holder)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetState", compositeKey("HOLDER", "BOND_001", "alice")).Return(holderJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	check, err := bt.CanTransfer(ctx, "alice", "bob", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, check.Allowed)
+	assert.Equal(t, "HOLDING_FROZEN", check.ReasonCode)
+}
+
+func TestBondToken_CanTransfer_ComplianceHold(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		MaturityDate: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+	}
+	holder := TokenHolder{Address: "alice", BondID: "BOND_001", Quantity: 100, ComplianceHolds: []string{"HOLD_tx1"}}
+	bondJSON, _ := json.Marshal(bond)
+	holderJSON, _ := json.Marshal(holder)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetState", compositeKey("HOLDER", "BOND_001", "alice")).Return(holderJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	check, err := bt.CanTransfer(ctx, "alice", "bob", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, check.Allowed)
+	assert.Equal(t, "COMPLIANCE_HOLD", check.ReasonCode)
+}
+
+func TestBondToken_Transfer_NotCompliant(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		IssuerID:     "ISSUER_001",
+		MaturityDate: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+	}
+	issuer := TokenHolder{Address: "ISSUER_001", BondID: "BOND_001", Quantity: 100}
+	decision := ComplianceDecision{Reasons: []*TransferCheck{{ReasonCode: "JURISDICTION_BLOCKED", Reason: "jurisdiction US is blocked"}}}
+	bondJSON, _ := json.Marshal(bond)
+	issuerJSON, _ := json.Marshal(issuer)
+	decisionJSON, _ := json.Marshal(decision)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetState", compositeKey("HOLDER", "BOND_001", "ISSUER_001")).Return(issuerJSON, nil)
+	ctx.stub.On("GetState", compositeKey("ADDRESSHOLD", "ISSUER_001")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+	// The issuer is passed to compliance as an empty party
+	recordArgs := [][]byte{[]byte("RecordTransfer"), []byte(""), []byte("alice"), []byte("BOND_001"), []byte("10")}
+	ctx.stub.On("InvokeChaincode", "compliance", recordArgs, "").Return(peer.Response{Status: 200, Payload: decisionJSON})
+
+	err := bt.Transfer(ctx, "ISSUER_001", "alice", "BOND_001", 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "JURISDICTION_BLOCKED")
+	ctx.stub.AssertCalled(t, "InvokeChaincode", "compliance", recordArgs, "")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestBondToken_CanTransfer_ChecksCompliance(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		IssuerID:     "ISSUER_001",
+		MaturityDate: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+	}
+	holder := TokenHolder{Address: "alice", BondID: "BOND_001", Quantity: 100}
+	decision := ComplianceDecision{Allowed: true}
+	bondJSON, _ := json.Marshal(bond)
+	holderJSON, _ := json.Marshal(holder)
+	decisionJSON, _ := json.Marshal(decision)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetState", compositeKey("HOLDER", "BOND_001", "alice")).Return(holderJSON, nil)
+	ctx.stub.On("GetState", compositeKey("ADDRESSHOLD", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+	// CanTransfer uses the read-only check, so nothing is counted
+	checkArgs := [][]byte{[]byte("CheckTransfer"), []byte("alice"), []byte("bob"), []byte("BOND_001"), []byte("10")}
+	ctx.stub.On("InvokeChaincode", "compliance", checkArgs, "").Return(peer.Response{Status: 200, Payload: decisionJSON})
+
+	check, err := bt.CanTransfer(ctx, "alice", "bob", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.True(t, check.Allowed)
+	ctx.stub.AssertCalled(t, "InvokeChaincode", "compliance", checkArgs, "")
+}
+
+func TestBondToken_CanTransfer_AddressHold(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		MaturityDate: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+	}
+	// alice acquired the holding after the hold on all her holdings was placed
+	holder := TokenHolder{Address: "alice", BondID: "BOND_001", Quantity: 100}
+	bondJSON, _ := json.Marshal(bond)
+	holderJSON, _ := json.Marshal(holder)
+	holdsJSON, _ := json.Marshal([]string{"HOLD_tx1"})
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetState", compositeKey("HOLDER", "BOND_001", "alice")).Return(holderJSON, nil)
+	ctx.stub.On("GetState", compositeKey("ADDRESSHOLD", "alice")).Return(holdsJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	check, err := bt.CanTransfer(ctx, "alice", "bob", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, check.Allowed)
+	assert.Equal(t, "COMPLIANCE_HOLD", check.ReasonCode)
+	assert.Contains(t, check.Reason, "HOLD_tx1")
+}
+
+func TestBondToken_PlaceComplianceHold_AllHoldings(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	emptyIterator := &MockIterator{}
+	emptyIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "BOND", []string{}).Return(emptyIterator, nil)
+	ctx.stub.On("GetState", compositeKey("ADDRESSHOLD", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("ADDRESSHOLD", "alice"), mock.Anything).Return(nil)
+
+	// alice holds nothing yet, but the hold is kept against her address
+	changed, err := bt.PlaceComplianceHold(ctx, "HOLD_tx1", "alice", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	var holds []string
+	json.Unmarshal(ctx.stub.state[compositeKey("ADDRESSHOLD", "alice")], &holds)
+	assert.Equal(t, []string{"HOLD_tx1"}, holds)
+}
+
+func TestBondToken_PlaceComplianceHold_NotComplianceUser(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: registrar}
+
+	_, err := bt.PlaceComplianceHold(ctx, "HOLD_tx1", "alice", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "COMPLIANCE_OFFICER or COMPLIANCE_ADMIN role required")
+}
+
+func TestHoldingCap(t *testing.T) {
+	assert.Equal(t, int64(0), holdingCap(&Bond{TotalSupply: 1000}))
+	assert.Equal(t, int64(200), holdingCap(&Bond{TotalSupply: 1000, MaxHolding: 200}))
+	assert.Equal(t, int64(50), holdingCap(&Bond{TotalSupply: 1000, MaxHoldingPercent: 5}))
+	assert.Equal(t, int64(50), holdingCap(&Bond{TotalSupply: 1000, MaxHolding: 200, MaxHoldingPercent: 5}))
+}
+
+func TestBondToken_Transfer_HoldingCap(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := Bond{
+		ID:           "BOND_001",
+		IssuerID:     "ISSUER_001",
+		TotalSupply:  1000,
+		MaturityDate: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Status:       "ACTIVE",
+		MaxHolding:   100,
+	}
+	issuer := TokenHolder{Address: "ISSUER_001", BondID: "BOND_001", Quantity: 900}
+	investor := TokenHolder{Address: "alice", BondID: "BOND_001", Quantity: 80}
+	bondJSON, _ := json.Marshal(bond)
+	issuerJSON, _ := json.Marshal(issuer)
+	investorJSON, _ := json.Marshal(investor)
+	ctx.stub.On("GetState", compositeKey("BOND", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetState", compositeKey("HOLDER", "BOND_001", "ISSUER_001")).Return(issuerJSON, nil)
+	ctx.stub.On("GetState", compositeKey("ADDRESSHOLD", "ISSUER_001")).Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("HOLDER", "BOND_001", "alice")).Return(investorJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	err := bt.Transfer(ctx, "ISSUER_001", "alice", "BOND_001", 30)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "holding cap")
+}
+
+func TestBondToken_DeclareIssuerDefault_NotTrustee(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := bt.DeclareIssuerDefault(ctx, "ISSUER_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TRUSTEE role required")
+}
+
+func TestBondToken_DeclareIssuerDefault_NoActiveBonds(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: trustee}
+
+	matured := Bond{ID: "BOND_001", IssuerID: "ISSUER_001", Status: "MATURED"}
+	otherIssuer := Bond{ID: "BOND_002", IssuerID: "ISSUER_002", Status: "ACTIVE"}
+	maturedJSON, _ := json.Marshal(matured)
+	otherIssuerJSON, _ := json.Marshal(otherIssuer)
+
+	mockIterator := &MockIterator{results: [][]byte{maturedJSON, otherIssuerJSON}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "BOND", []string{}).Return(mockIterator, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	err := bt.DeclareIssuerDefault(ctx, "ISSUER_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no active bonds")
+}
+
+func TestMoveTapLots(t *testing.T) {
+	settlement := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	from := &TokenHolder{Quantity: 100, TapLots: []TapLot{{Tranche: 1, Quantity: 40, AccrualStart: settlement}}}
+	to := &TokenHolder{}
+
+	// Original-issue tokens leave first
+	moveTapLots(from, to, 60)
+	assert.Len(t, from.TapLots, 1)
+	assert.Empty(t, to.TapLots)
+
+	from.Quantity -= 60
+	moveTapLots(from, to, 25)
+	assert.Equal(t, int64(15), from.TapLots[0].Quantity)
+	assert.Equal(t, []TapLot{{Tranche: 1, Quantity: 25, AccrualStart: settlement}}, to.TapLots)
+
+	from.Quantity -= 25
+	moveTapLots(from, nil, 15)
+	assert.Empty(t, from.TapLots)
+}
+
+func TestBondToken_MigrateStateKeys(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: registrar}
+
+	var results [][]byte
+	for _, id := range []string{"BOND_001", "BOND_002", "BOND_003"} {
+		bondJSON, _ := json.Marshal(Bond{ID: id, IssuerID: "ISSUER_001"})
+		results = append(results, bondJSON)
+	}
+	mockIterator := &MockIterator{results: results, keys: []string{"BOND_001", "BOND_002", "BOND_003"}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByRange", "", "").Return(mockIterator, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+
+	result, err := bt.MigrateStateKeys(ctx, 2, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Bonds)
+	assert.Equal(t, "BOND_003", result.Bookmark)
+	assert.Contains(t, ctx.stub.state, compositeKey("BOND", "BOND_002"))
+	assert.NotContains(t, ctx.stub.state, compositeKey("BOND", "BOND_003"))
+}
+
+func TestBondToken_MigrateStateKeys_NotRegistrar(t *testing.T) {
+	bt := &BondToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	_, err := bt.MigrateStateKeys(ctx, 2, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "REGISTRAR role required")
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Cash accounts are stored under CASH~currency~owner keys
+const accountObjectType = "CASH"
+
+// cashIssuerRole is the client identity role attribute allowed to issue
+// cash against deposits and redeem it against withdrawals
+const cashIssuerRole = "CASH_ISSUER"
+
+// settlementAgentRole is the client identity role attribute allowed to
+// move cash between accounts for the Settlement contract's cash legs
+const settlementAgentRole = "SETTLEMENT_AGENT"
+
+// CashToken represents the tokenized cash contract the Settlement contract
+// pays the cash leg of a trade in
+type CashToken struct {
+	contractapi.Contract
+}
+
+// Account represents an owner's cash balance in one currency
+type Account struct {
+	Owner       string    `json:"owner"`
+	Currency    string    `json:"currency"`
+	Balance     float64   `json:"balance"`
+	LastUpdated time.Time `json:"lastUpdated"`
+
+	Version int64  `json:"version"` // incremented on every write
+	TxID    string `json:"txId"`    // transaction that last wrote the record
+}
+
+// CashEvent represents a cash movement event
+type CashEvent struct {
+	Type      string    `json:"type"` // "ISSUED", "REDEEMED", "TRANSFERRED"
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Currency  string    `json:"currency"`
+	Amount    float64   `json:"amount"`
+	Timestamp time.Time `json:"timestamp"`
+	TxID      string    `json:"txId"`
+}
+
+// Init initializes the contract
+func (c *CashToken) Init(ctx contractapi.TransactionContextInterface) error {
+	fmt.Println("CashToken contract initialized")
+	return nil
+}
+
+// Issue credits amount of currency to owner's account against cash the
+// issuer holds on deposit. Only cash issuers may issue cash.
+func (c *CashToken) Issue(ctx contractapi.TransactionContextInterface, owner, currency string, amount float64) error {
+	err := requireRole(ctx, cashIssuerRole)
+	if err != nil {
+		return err
+	}
+
+	amount, err = validateMovement(currency, amount)
+	if err != nil {
+		return err
+	}
+	if owner == "" {
+		return fmt.Errorf("owner is required")
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	account, err := getAccount(ctx, owner, currency)
+	if err != nil {
+		return err
+	}
+	account.Balance = roundAmount(account.Balance + amount)
+
+	err = putAccount(ctx, account, now)
+	if err != nil {
+		return err
+	}
+
+	return emitCashEvent(ctx, &CashEvent{Type: "ISSUED", To: owner, Currency: currency, Amount: amount, Timestamp: now})
+}
+
+// Redeem debits amount of currency from owner's account as the issuer pays
+// it out of deposit. Only cash issuers may redeem cash.
+func (c *CashToken) Redeem(ctx contractapi.TransactionContextInterface, owner, currency string, amount float64) error {
+	err := requireRole(ctx, cashIssuerRole)
+	if err != nil {
+		return err
+	}
+
+	amount, err = validateMovement(currency, amount)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	account, err := getAccount(ctx, owner, currency)
+	if err != nil {
+		return err
+	}
+	if account.Balance < amount {
+		return fmt.Errorf("%s holds %.2f %s, %.2f required", owner, account.Balance, currency, amount)
+	}
+	account.Balance = roundAmount(account.Balance - amount)
+
+	err = putAccount(ctx, account, now)
+	if err != nil {
+		return err
+	}
+
+	return emitCashEvent(ctx, &CashEvent{Type: "REDEEMED", From: owner, Currency: currency, Amount: amount, Timestamp: now})
+}
+
+// Transfer moves amount of currency from one account to another. Settlement
+// agents move cash for the Settlement contract's cash legs; any other
+// client may only pay out of its own account.
+func (c *CashToken) Transfer(ctx contractapi.TransactionContextInterface, from, to, currency string, amount float64) error {
+	if requireRole(ctx, settlementAgentRole) != nil {
+		caller, err := ctx.GetClientIdentity().GetID()
+		if err != nil {
+			return fmt.Errorf("failed to get client identity: %v", err)
+		}
+		if caller != from {
+			return fmt.Errorf("caller is not authorized: only %s or a %s may pay from the account", from, settlementAgentRole)
+		}
+	}
+
+	amount, err := validateMovement(currency, amount)
+	if err != nil {
+		return err
+	}
+	if to == "" {
+		return fmt.Errorf("recipient is required")
+	}
+	if from == to {
+		return fmt.Errorf("sender and recipient must differ")
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	sender, err := getAccount(ctx, from, currency)
+	if err != nil {
+		return err
+	}
+	if sender.Balance < amount {
+		return fmt.Errorf("%s holds %.2f %s, %.2f required", from, sender.Balance, currency, amount)
+	}
+	recipient, err := getAccount(ctx, to, currency)
+	if err != nil {
+		return err
+	}
+
+	sender.Balance = roundAmount(sender.Balance - amount)
+	recipient.Balance = roundAmount(recipient.Balance + amount)
+
+	err = putAccount(ctx, sender, now)
+	if err != nil {
+		return err
+	}
+	err = putAccount(ctx, recipient, now)
+	if err != nil {
+		return err
+	}
+
+	return emitCashEvent(ctx, &CashEvent{Type: "TRANSFERRED", From: from, To: to, Currency: currency, Amount: amount, Timestamp: now})
+}
+
+// BalanceOf returns owner's balance in currency, zero if the owner has no
+// account in it
+func (c *CashToken) BalanceOf(ctx contractapi.TransactionContextInterface, owner, currency string) (float64, error) {
+	account, err := getAccount(ctx, owner, currency)
+	if err != nil {
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+// GetAccount returns owner's account in currency
+func (c *CashToken) GetAccount(ctx contractapi.TransactionContextInterface, owner, currency string) (*Account, error) {
+	account, err := getAccount(ctx, owner, currency)
+	if err != nil {
+		return nil, err
+	}
+	if account.Version == 0 {
+		return nil, fmt.Errorf("%s has no %s account", owner, currency)
+	}
+	return account, nil
+}
+
+// validateMovement checks the currency and amount of a cash movement and
+// returns the amount rounded to cents
+func validateMovement(currency string, amount float64) (float64, error) {
+	if !isCurrencyCode(currency) {
+		return 0, fmt.Errorf("invalid currency code: %s", currency)
+	}
+	amount = roundAmount(amount)
+	if amount <= 0 {
+		return 0, fmt.Errorf("amount must be positive")
+	}
+	return amount, nil
+}
+
+// accountKey returns the state key of owner's account in currency
+func accountKey(ctx contractapi.TransactionContextInterface, owner, currency string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(accountObjectType, []string{currency, owner})
+	if err != nil {
+		return "", fmt.Errorf("failed to create account key: %v", err)
+	}
+	return key, nil
+}
+
+// getAccount reads owner's account in currency, or returns an empty one
+// if it has not been written yet
+func getAccount(ctx contractapi.TransactionContextInterface, owner, currency string) (*Account, error) {
+	key, err := accountKey(ctx, owner, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	accountJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account: %v", err)
+	}
+	if accountJSON == nil {
+		return &Account{Owner: owner, Currency: currency}, nil
+	}
+
+	var account Account
+	err = json.Unmarshal(accountJSON, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal account: %v", err)
+	}
+	return &account, nil
+}
+
+// putAccount stores an account, stamping it with the transaction
+func putAccount(ctx contractapi.TransactionContextInterface, account *Account, now time.Time) error {
+	account.LastUpdated = now
+	account.TxID = ctx.GetStub().GetTxID()
+	account.Version++
+
+	accountJSON, err := json.Marshal(account)
+	if err != nil {
+		return fmt.Errorf("failed to marshal account: %v", err)
+	}
+
+	key, err := accountKey(ctx, account.Owner, account.Currency)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, accountJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store account: %v", err)
+	}
+	return nil
+}
+
+// emitCashEvent emits a cash movement event
+func emitCashEvent(ctx contractapi.TransactionContextInterface, event *CashEvent) error {
+	event.TxID = ctx.GetStub().GetTxID()
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("CashEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+	return nil
+}
+
+// requireRole checks that the invoking identity carries one of the given
+// values in its "role" certificate attribute
+func requireRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	for _, role := range roles {
+		if ctx.GetClientIdentity().AssertAttributeValue("role", role) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("caller is not authorized: %s role required", strings.Join(roles, " or "))
+}
+
+// txTimestamp returns the timestamp the client set in the transaction
+// proposal, so every endorsing peer computes the same dates from it
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// isCurrencyCode reports whether code looks like an ISO 4217 currency code
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// roundAmount rounds a cash amount to two decimal places
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func main() {
+	chaincode, err := contractapi.NewChaincode(&CashToken{})
+	if err != nil {
+		fmt.Printf("Error creating CashToken chaincode: %s", err.Error())
+		return
+	}
+
+	if err := chaincode.Start(); err != nil {
+		fmt.Printf("Error starting CashToken chaincode: %s", err.Error())
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockStub is a mock implementation of the chaincode stub. Stub methods
+// the contract does not use are left to the embedded interface and panic
+// if called.
+type MockStub struct {
+	shim.ChaincodeStubInterface
+	mock.Mock
+	state map[string][]byte
+}
+
+func (m *MockStub) GetState(key string) ([]byte, error) {
+	args := m.Called(key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockStub) PutState(key string, value []byte) error {
+	args := m.Called(key, value)
+	m.state[key] = value
+	return args.Error(0)
+}
+
+func (m *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	args := m.Called()
+	return args.Get(0).(*timestamp.Timestamp), args.Error(1)
+}
+
+func (m *MockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return compositeKey(objectType, attributes...), nil
+}
+
+// compositeKey builds a composite key using the same encoding as the Fabric shim
+func compositeKey(objectType string, attributes ...string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
+}
+
+func (m *MockStub) GetTxID() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *MockStub) SetEvent(name string, payload []byte) error {
+	args := m.Called(name, payload)
+	return args.Error(0)
+}
+
+// MockContext is a mock implementation of the transaction context
+type MockContext struct {
+	mock.Mock
+	stub     *MockStub
+	identity *MockClientIdentity // defaults to a client of Org1MSP without attributes
+}
+
+func (m *MockContext) GetClientIdentity() cid.ClientIdentity {
+	if m.identity != nil {
+		return m.identity
+	}
+	return &MockClientIdentity{id: "client", mspID: "Org1MSP"}
+}
+
+func (m *MockContext) GetStub() shim.ChaincodeStubInterface {
+	return m.stub
+}
+
+// MockClientIdentity is a fixed client identity
+type MockClientIdentity struct {
+	id         string
+	mspID      string
+	attributes map[string]string
+}
+
+// Clients holding the CASH_ISSUER and SETTLEMENT_AGENT roles, and the
+// holder of the alice account
+var (
+	cashIssuer      = &MockClientIdentity{id: "bank", mspID: "CustodianMSP", attributes: map[string]string{"role": "CASH_ISSUER"}}
+	settlementAgent = &MockClientIdentity{id: "settler", mspID: "CustodianMSP", attributes: map[string]string{"role": "SETTLEMENT_AGENT"}}
+	alice           = &MockClientIdentity{id: "alice", mspID: "InvestorMSP"}
+)
+
+func (m *MockClientIdentity) GetID() (string, error) {
+	return m.id, nil
+}
+
+func (m *MockClientIdentity) GetMSPID() (string, error) {
+	return m.mspID, nil
+}
+
+func (m *MockClientIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := m.attributes[name]
+	return value, found, nil
+}
+
+func (m *MockClientIdentity) AssertAttributeValue(name, value string) error {
+	if m.attributes[name] != value {
+		return fmt.Errorf("attribute %s does not have value %s", name, value)
+	}
+	return nil
+}
+
+func (m *MockClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// onAccount mocks owner's stored USD account holding balance
+func onAccount(ctx *MockContext, owner string, balance float64) {
+	accountJSON, _ := json.Marshal(Account{Owner: owner, Currency: "USD", Balance: balance, Version: 1})
+	ctx.stub.On("GetState", compositeKey("CASH", "USD", owner)).Return(accountJSON, nil)
+}
+
+// onWrite mocks the timestamp, transaction ID, state writes and event of
+// a cash movement
+func onWrite(ctx *MockContext) {
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "CashEvent", mock.Anything).Return(nil)
+}
+
+func TestCashToken_Issue(t *testing.T) {
+	c := &CashToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: cashIssuer}
+
+	ctx.stub.On("GetState", compositeKey("CASH", "USD", "alice")).Return(nil, nil)
+	onWrite(ctx)
+
+	err := c.Issue(ctx, "alice", "usd", 100)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid currency code")
+
+	err = c.Issue(ctx, "alice", "USD", 25000.004)
+	assert.NoError(t, err)
+
+	var account Account
+	json.Unmarshal(ctx.stub.state[compositeKey("CASH", "USD", "alice")], &account)
+	assert.Equal(t, 25000.0, account.Balance)
+	assert.Equal(t, int64(1), account.Version)
+
+	// Only cash issuers may issue cash
+	ctx.identity = settlementAgent
+	err = c.Issue(ctx, "alice", "USD", 100)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "CASH_ISSUER role required")
+}
+
+func TestCashToken_Redeem_Overdrawn(t *testing.T) {
+	c := &CashToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: cashIssuer}
+
+	onAccount(ctx, "alice", 50)
+	onWrite(ctx)
+
+	err := c.Redeem(ctx, "alice", "USD", 75)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "alice holds 50.00 USD, 75.00 required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCashToken_Transfer(t *testing.T) {
+	c := &CashToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	onAccount(ctx, "alice", 25000)
+	ctx.stub.On("GetState", compositeKey("CASH", "USD", "bob")).Return(nil, nil)
+	onWrite(ctx)
+
+	err := c.Transfer(ctx, "alice", "bob", "USD", 10100)
+	assert.NoError(t, err)
+
+	var sender, recipient Account
+	json.Unmarshal(ctx.stub.state[compositeKey("CASH", "USD", "alice")], &sender)
+	json.Unmarshal(ctx.stub.state[compositeKey("CASH", "USD", "bob")], &recipient)
+	assert.Equal(t, 14900.0, sender.Balance)
+	assert.Equal(t, int64(2), sender.Version)
+	assert.Equal(t, 10100.0, recipient.Balance)
+	assert.Equal(t, int64(1), recipient.Version)
+}
+
+func TestCashToken_Transfer_Insufficient(t *testing.T) {
+	c := &CashToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	onAccount(ctx, "alice", 5000)
+	onWrite(ctx)
+
+	err := c.Transfer(ctx, "alice", "bob", "USD", 10100)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "alice holds 5000.00 USD, 10100.00 required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCashToken_Transfer_NotAuthorized(t *testing.T) {
+	c := &CashToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: alice}
+
+	onAccount(ctx, "alice", 25000)
+	onAccount(ctx, "bob", 0)
+	onWrite(ctx)
+
+	// A client may pay out of its own account
+	err := c.Transfer(ctx, "alice", "bob", "USD", 100)
+	assert.NoError(t, err)
+
+	// but not out of anyone else's
+	err = c.Transfer(ctx, "bob", "alice", "USD", 100)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only bob or a SETTLEMENT_AGENT may pay from the account")
+}
+
+func TestCashToken_BalanceOf(t *testing.T) {
+	c := &CashToken{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	onAccount(ctx, "alice", 25000)
+	ctx.stub.On("GetState", compositeKey("CASH", "USD", "bob")).Return(nil, nil)
+
+	balance, err := c.BalanceOf(ctx, "alice", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 25000.0, balance)
+
+	// An owner without an account holds nothing
+	balance, err = c.BalanceOf(ctx, "bob", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, balance)
+
+	_, err = c.GetAccount(ctx, "bob", "USD")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bob has no USD account")
+}
@@ -1,11 +1,181 @@
 package main
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Names the BondToken and Settlement contracts are deployed under
+const (
+	bondTokenChaincode  = "bondtoken"
+	settlementChaincode = "settlement"
+)
+
+// transferPaths are the transactions, by the chaincode the client invoked
+// and the function it called, that move tokens and so may record transfer
+// decisions with RecordTransfer
+var transferPaths = map[string]string{
+	bondTokenChaincode:  "Transfer",
+	settlementChaincode: "SettleTrade",
+}
+
+// Private data collection holding investors' personal data, shared only
+// between the compliance organisations
+const kycCollection = "kyc-private"
+
+// State object types. KYC records are stored under KYC~address keys, AML
+// checks under AML~address~checkType keys and transfer rules under
+// TRANSFERRULES~bondID~version keys, so no address or bond ID can collide
+// with another record's key.
+const (
+	kycObjectType           = "KYC"
+	amlObjectType           = "AML"
+	transferRulesObjectType = "TRANSFERRULES"
+)
+
+// Sanctions list entries are stored under SANCTION~source~entryID keys. The
+// SANCTIONHASH index, keyed hash~source~entryID, finds the entries listing
+// a name or identifier hash.
+const (
+	sanctionObjectType = "SANCTION"
+	sanctionHashIndex  = sanctionObjectType + "HASH"
+)
+
+// Blacklisted and watchlisted addresses are stored under BLACKLIST~address
+// and WATCHLIST~address keys. A blacklisted address fails every compliance
+// check; a watchlisted one passes but is flagged for review.
+const (
+	blacklistObjectType = "BLACKLIST"
+	watchlistObjectType = "WATCHLIST"
+)
+
+// Investor limits are stored under LIMIT~address~scope keys and the usage
+// RecordTransfer has counted against them under LIMITUSAGE~address~scope
+// keys, where scope is a bond ID or GLOBAL for limits across all bonds
+const (
+	limitObjectType      = "LIMIT"
+	limitUsageObjectType = limitObjectType + "USAGE"
+	globalLimitScope     = "GLOBAL"
+)
+
+// limitWindow is the rolling period daily volume limits are measured over,
+// and the longest window a velocity rule can have
+const limitWindow = 24 * time.Hour
+
+// Velocity rules are stored together under the VELOCITYRULES key
+const velocityRulesObjectType = "VELOCITYRULES"
+
+// KYC tier limits are stored under KYCTIER~tier keys
+const kycTierObjectType = "KYCTIER"
+
+// Country risk ratings are stored under COUNTRYRISK~countryCode keys
+const countryRiskObjectType = "COUNTRYRISK"
+
+// The compliance holds placed on an address are stored together under its
+// HOLD~address key, so CheckTransfer finds them with a single read
+const holdObjectType = "HOLD"
+
+// The exemptions granted to an address are stored together under its
+// EXEMPTION~address key
+const exemptionObjectType = "EXEMPTION"
+
+// Organisations' own transfer policies are stored under
+// ORGPOLICY~mspID~scope keys, where scope is a bond ID or GLOBAL for a
+// policy covering all bonds
+const orgPolicyObjectType = "ORGPOLICY"
+
+// Investors' acceptance of offering terms, privacy policies and risk
+// disclosures is stored under CONSENT~address~documentHash keys
+const consentObjectType = "CONSENT"
+
+// Investors' accredited investor verifications are stored under
+// ACCREDITATION~address keys
+const accreditationObjectType = "ACCREDITATION"
+
+// Transfers RecordTransfer denies are recorded under BLOCKEDTRANSFER~txID
+// keys for regulatory reporting
+const blockedTransferObjectType = "BLOCKEDTRANSFER"
+
+// Weights, in percent, of the factors making up an investor's aggregate
+// risk score
+const (
+	kycRiskWeight          = 30
+	amlRiskWeight          = 30
+	jurisdictionRiskWeight = 20
+	behaviorRiskWeight     = 20
+)
+
+// Client identity role attributes. Compliance officers maintain KYC records
+// and AML checks; the compliance admin can do the same and also maintains
+// policies, sanctions lists and investor classes. Regulators can read
+// suspicious activity reports. Screening providers submit signed AML
+// screening results for the provider registration matching their identity.
+const (
+	complianceOfficerRole = "COMPLIANCE_OFFICER"
+	complianceAdminRole   = "COMPLIANCE_ADMIN"
+	regulatorRole         = "REGULATOR"
+	screeningProviderRole = "SCREENING_PROVIDER"
+)
+
+// Attestations are stored under ATTESTATION~attestationID keys
+const attestationObjectType = "ATTESTATION"
+
+// Screening providers are registered under SCREENINGPROVIDER~providerID
+// keys, and the signed results they submit are kept under
+// SCREENINGSUBMISSION~providerID~referenceID keys so none can be replayed
+const (
+	screeningProviderObjectType   = "SCREENINGPROVIDER"
+	screeningSubmissionObjectType = "SCREENINGSUBMISSION"
+)
+
+// Suspicious activity reports are kept only in the sar-private collection,
+// under SAR~sarID keys, so the investors they concern cannot learn of them.
+// FileSAR reads the report from the "sar" transient key for the same reason.
+const (
+	sarCollection   = "sar-private"
+	sarObjectType   = "SAR"
+	sarTransientKey = "sar"
+)
+
+// Hashes of investors' identity documents are indexed in the kyc-private
+// collection under IDHASH~hash~address keys, so a second KYC record with
+// the same document is caught. Overrides allowing a legitimate duplicate,
+// such as a migrated account, are stored under
+// IDOVERRIDE~address~existingAddress keys.
+const (
+	idHashIndex          = "IDHASH"
+	idOverrideObjectType = "IDOVERRIDE"
+)
+
+// Transient data key CreateKYC reads an investor's personal data from, so
+// it never appears in the transaction proposal recorded on the channel
+const kycTransientKey = "kyc"
+
+// Beneficial owners' personal data is passed under the "ubo" transient key
+// and stored in the kyc-private collection under UBO~address~uboID keys.
+// An entity is not compliant while an owner of more than
+// uboScreeningThreshold percent has failed screening.
+const (
+	uboObjectType         = "UBO"
+	uboTransientKey       = "ubo"
+	uboScreeningThreshold = 25.0
 )
 
 // Compliance represents the compliance contract
@@ -13,21 +183,204 @@ type Compliance struct {
 	contractapi.Contract
 }
 
-// KYCRecord represents a KYC record
+// KYCRecord represents a KYC record. The investor's personal data is kept
+// in the kyc-private collection; the record only holds its hash, so every
+// peer can evaluate compliance without seeing it.
 type KYCRecord struct {
 	Address       string    `json:"address"`
-	FullName      string    `json:"fullName"`
-	DateOfBirth   string    `json:"dateOfBirth"`
-	Nationality   string    `json:"nationality"`
-	IDType        string    `json:"idType"`
-	IDNumber      string    `json:"idNumber"`
-	Status        string    `json:"status"` // "PENDING", "APPROVED", "REJECTED"
+	Nationality   string    `json:"nationality"` // needed for jurisdiction rules on every peer
+	PIIHash       string    `json:"piiHash"`     // hex SHA-256 of the private KYCPersonalData
+	Status        string    `json:"status"` // "PENDING", "APPROVED", "REJECTED", "SUSPENDED", "EXPIRED", "ERASED"
 	RiskLevel     string    `json:"riskLevel"` // "LOW", "MEDIUM", "HIGH"
 	ApprovedBy    string    `json:"approvedBy"`
 	ApprovedAt    time.Time `json:"approvedAt"`
 	CreatedAt     time.Time `json:"createdAt"`
 	UpdatedAt     time.Time `json:"updatedAt"`
 	Metadata      map[string]string `json:"metadata"`
+	Version       int64     `json:"version"` // incremented on every write
+
+	// "INDIVIDUAL" or "CORPORATE", defaulting to INDIVIDUAL. A corporate
+	// record's Nationality is its country of incorporation, and its LEI,
+	// if it has one, is public.
+	RecordType string `json:"recordType,omitempty"`
+	LEI        string `json:"lei,omitempty"`
+
+	// Used to look up coupon withholding tax; TaxResidence defaults to Nationality
+	TaxResidence      string `json:"taxResidence,omitempty"`
+	TaxClassification string `json:"taxClassification,omitempty"` // "INDIVIDUAL", "CORPORATE", "EXEMPT"
+
+	// Investor class for eligibility rules and holding limits: "RETAIL",
+	// "PROFESSIONAL", "QIB" or "INSTITUTIONAL". A requested class only takes
+	// effect once the compliance admin approves it; until then the investor
+	// is treated as RETAIL.
+	InvestorClass           string    `json:"investorClass,omitempty"`
+	RequestedInvestorClass  string    `json:"requestedInvestorClass,omitempty"`
+	InvestorClassApprovedBy string    `json:"investorClassApprovedBy,omitempty"`
+	InvestorClassApprovedAt time.Time `json:"investorClassApprovedAt,omitempty"`
+
+	// KYC tier: "BASIC", "STANDARD" or "ENHANCED", each with its own limits.
+	// An upgrade takes effect once the compliance admin approves it with
+	// the documents the tier requires attached; until then the investor
+	// stays on its current tier, BASIC if none was approved.
+	KYCTier           string    `json:"kycTier,omitempty"`
+	RequestedKYCTier  string    `json:"requestedKycTier,omitempty"`
+	KYCTierApprovedBy string    `json:"kycTierApprovedBy,omitempty"`
+	KYCTierApprovedAt time.Time `json:"kycTierApprovedAt,omitempty"`
+
+	// Right to be forgotten. ExecuteErasure purges the personal data from
+	// the kyc-private collection and drops its hash and the documents from
+	// the record, leaving the compliance decision trail.
+	ErasureRequestedBy string    `json:"erasureRequestedBy,omitempty"`
+	ErasureRequestedAt time.Time `json:"erasureRequestedAt,omitempty"`
+	ErasureReason      string    `json:"erasureReason,omitempty"`
+	ErasedBy           string    `json:"erasedBy,omitempty"`
+	ErasedAt           time.Time `json:"erasedAt,omitempty"`
+
+	// Evidence documents stored off-chain, in the order they were attached
+	Documents []*KYCDocument `json:"documents,omitempty"`
+
+	// Verification state of the identity documents in the investor's
+	// personal data, in the same order
+	IdentityDocuments []*IdentityDocumentStatus `json:"identityDocuments,omitempty"`
+
+	// Changes UpdateKYCDetails made to the investor's details, oldest first
+	ChangeLog []*KYCFieldChange `json:"changeLog,omitempty"`
+
+	// Other KYC records sharing an identity document with this one, allowed
+	// by an approved duplicate identity override
+	DuplicateOf []string `json:"duplicateOf,omitempty"`
+
+	// Ultimate beneficial owners of an entity investor
+	BeneficialOwners []*BeneficialOwner `json:"beneficialOwners,omitempty"`
+
+	// Aggregate risk score, recomputed by ComputeRiskScore and whenever the
+	// KYC risk level or one of the investor's AML checks changes
+	RiskScore *RiskScore `json:"riskScore,omitempty"`
+
+	// Object type, so QueryKYC selectors can tell KYC records apart
+	DocType string `json:"docType"`
+
+	// Enrollment ID and MSP of the client that last wrote the record, for
+	// GetComplianceHistory
+	UpdatedBy    string `json:"updatedBy,omitempty"`
+	UpdatedByMSP string `json:"updatedByMsp,omitempty"`
+}
+
+// KYCDocument anchors an off-chain KYC evidence document, such as a passport
+// scan or proof of address, to a KYC record by its SHA-256 hash
+type KYCDocument struct {
+	DocType    string    `json:"docType"` // e.g. "PASSPORT", "PROOF_OF_ADDRESS"
+	SHA256     string    `json:"sha256"`  // lower-case hex
+	URI        string    `json:"uri"`
+	UploadedAt time.Time `json:"uploadedAt"`
+	TxID       string    `json:"txId"`
+}
+
+// BeneficialOwner is an ultimate beneficial owner of an entity investor.
+// Like the KYC record, it only holds the hash of the owner's personal data.
+type BeneficialOwner struct {
+	UBOID            string    `json:"uboId"`
+	Nationality      string    `json:"nationality"`
+	OwnershipPercent float64   `json:"ownershipPercent"` // direct and indirect
+	PIIHash          string    `json:"piiHash"`          // hex SHA-256 of the private KYCPersonalData
+	ScreeningStatus  string    `json:"screeningStatus"`  // "PENDING", "PASSED", "FAILED"
+	ScreeningDetails string    `json:"screeningDetails,omitempty"`
+	ScreenedBy       string    `json:"screenedBy,omitempty"`
+	ScreenedAt       time.Time `json:"screenedAt,omitempty"`
+	AddedAt          time.Time `json:"addedAt"`
+	TxID             string    `json:"txId"`
+}
+
+// KYCPersonalData is the part of a KYC record stored in the kyc-private
+// collection
+type KYCPersonalData struct {
+	Address     string              `json:"address"`
+	FullName    string              `json:"fullName"`
+	DateOfBirth string              `json:"dateOfBirth"`
+	Documents   []*IdentityDocument `json:"documents"`
+
+	ResidentialAddress string `json:"residentialAddress,omitempty"`
+
+	// The single identity document of personal data stored before
+	// documents were listed. New personal data must use Documents.
+	IDType   string `json:"idType,omitempty"`
+	IDNumber string `json:"idNumber,omitempty"`
+}
+
+// DuplicateIdentityOverride allows a new KYC record to share identity
+// documents with an existing one, for the same person legitimately holding
+// both addresses
+type DuplicateIdentityOverride struct {
+	Address         string    `json:"address"`
+	ExistingAddress string    `json:"existingAddress"`
+	Reason          string    `json:"reason"`
+	ApprovedBy      string    `json:"approvedBy"`
+	ApprovedAt      time.Time `json:"approvedAt"`
+	TxID            string    `json:"txId"`
+}
+
+// KYCFieldChange records a change to one of an investor's details. The
+// old and new values of private fields stay in the kyc-private collection
+// and are not recorded.
+type KYCFieldChange struct {
+	Field     string    `json:"field"` // e.g. "fullName", "nationality"
+	Material  bool      `json:"material"`
+	OldValue  string    `json:"oldValue,omitempty"`
+	NewValue  string    `json:"newValue,omitempty"`
+	Reason    string    `json:"reason"`
+	ChangedBy string    `json:"changedBy"`
+	ChangedAt time.Time `json:"changedAt"`
+	TxID      string    `json:"txId"`
+}
+
+// IdentityDocument is an identity document in an investor's personal data.
+// An investor can give one document of each type per issuing country.
+type IdentityDocument struct {
+	Type           string `json:"type"` // "PASSPORT", "NATIONAL_ID", "TAX_ID", "DRIVING_LICENSE", "RESIDENCE_PERMIT"
+	Number         string `json:"number"`
+	IssuingCountry string `json:"issuingCountry"`
+	ExpiryDate     string `json:"expiryDate,omitempty"` // YYYY-MM-DD; empty for documents that do not expire
+}
+
+// IdentityDocumentStatus is the public part of an identity document, without
+// its number, and whether a compliance officer has verified it
+type IdentityDocumentStatus struct {
+	ID             string    `json:"id"` // type and issuing country, e.g. "PASSPORT-GB"
+	Type           string    `json:"type"`
+	IssuingCountry string    `json:"issuingCountry"`
+	ExpiryDate     time.Time `json:"expiryDate,omitempty"` // zero if the document does not expire
+	Status         string    `json:"status"`               // "PENDING", "VERIFIED", "REJECTED"
+	VerifiedBy     string    `json:"verifiedBy,omitempty"` // who verified or rejected it
+	VerifiedAt     time.Time `json:"verifiedAt,omitempty"`
+	Notes          string    `json:"notes,omitempty"`
+}
+
+// identityDocumentTypes are the identity document types KYC accepts
+var identityDocumentTypes = []string{"PASSPORT", "NATIONAL_ID", "TAX_ID", "DRIVING_LICENSE", "RESIDENCE_PERMIT"}
+
+// KYCEntityData is the part of a corporate KYC record stored in the
+// kyc-private collection
+type KYCEntityData struct {
+	Address              string      `json:"address"`
+	LegalName            string      `json:"legalName"`
+	RegistrationNumber   string      `json:"registrationNumber"`
+	IncorporationCountry string      `json:"incorporationCountry"`
+	Directors            []*Director `json:"directors"`
+}
+
+// Director is a director of a corporate investor
+type Director struct {
+	FullName    string `json:"fullName"`
+	DateOfBirth string `json:"dateOfBirth"`
+	Role        string `json:"role,omitempty"` // e.g. "CEO", "CHAIR"
+}
+
+// TaxProfile is the withholding-tax view of a KYC record shared with the
+// CorporateAction contract
+type TaxProfile struct {
+	Address        string `json:"address"`
+	Jurisdiction   string `json:"jurisdiction"`
+	Classification string `json:"classification"`
 }
 
 // AMLCheck represents an AML check
@@ -40,6 +393,21 @@ type AMLCheck struct {
 	ExpiryDate    time.Time `json:"expiryDate"`
 	Details       string    `json:"details"`
 	CheckedBy     string    `json:"checkedBy"`
+
+	CheckedByMSP string `json:"checkedByMsp,omitempty"` // MSP of the client that last wrote the check
+
+	// Set when the check was last written by SubmitScreeningResult: the
+	// provider's own reference for the result and the hex SHA-256 of the
+	// signed payload
+	ProviderReference string `json:"providerReference,omitempty"`
+	PayloadHash       string `json:"payloadHash,omitempty"`
+}
+
+// expired reports whether an AML check has lapsed at the given time. An
+// expired check counts as missing until the address is re-screened. Checks
+// without an expiry date never expire.
+func (a *AMLCheck) expired(at time.Time) bool {
+	return !a.ExpiryDate.IsZero() && !at.Before(a.ExpiryDate)
 }
 
 // ComplianceRule represents a compliance rule
@@ -54,6 +422,627 @@ type ComplianceRule struct {
 	UpdatedAt   time.Time `json:"updatedAt"`
 }
 
+// TransferRules are the compliance restrictions on transfers of one bond.
+// Each SetTransferRules call stores a new version; a transfer is checked
+// against the highest version in effect at its transaction time, so a
+// policy change can be staged ahead of the date it applies from.
+type TransferRules struct {
+	BondID               string    `json:"bondId"`
+	BlockedJurisdictions []string  `json:"blockedJurisdictions"` // ISO country codes
+	MaxRiskLevel         string    `json:"maxRiskLevel"`         // "LOW", "MEDIUM", "HIGH"; empty allows any
+	MaxTransferQuantity  int64     `json:"maxTransferQuantity"`  // 0 for no limit
+	UpdatedAt            time.Time `json:"updatedAt"`
+	TxID                 string    `json:"txId"`
+
+	Version       int64     `json:"version"`               // 0 for rules set before versioning
+	EffectiveFrom time.Time `json:"effectiveFrom"`         // defaults to the time the rules are set
+	EffectiveTo   time.Time `json:"effectiveTo,omitempty"` // zero for no end date
+
+	// Eligibility matrix. When AllowedJurisdictions is set, investors must
+	// be in one of them. InvestorClasses maps a jurisdiction to the investor
+	// classes that may hold the bond there, with "*" covering jurisdictions
+	// not listed; jurisdictions with no entry allow any class. A Reg-S bond
+	// sold to US QIBs only would map "US" to ["QIB"].
+	AllowedJurisdictions []string            `json:"allowedJurisdictions,omitempty"`
+	InvestorClasses      map[string][]string `json:"investorClasses,omitempty"`
+
+	// Most tokens one investor of a class may hold; classes not listed
+	// have no limit
+	MaxHoldingByClass map[string]int64 `json:"maxHoldingByClass,omitempty"`
+
+	// Value of one token in the reporting currency velocity rules measure
+	// transfer value in; 0 leaves the bond's transfers out of value limits
+	UnitValue float64 `json:"unitValue,omitempty"`
+
+	// Hex SHA-256 hashes of the documents, such as the offering terms and
+	// risk disclosures, an investor must have accepted to receive the bond
+	RequiredConsents []string `json:"requiredConsents,omitempty"`
+
+	// Whether only investors with a current accreditation may receive the
+	// bond
+	RequiresAccreditation bool `json:"requiresAccreditation,omitempty"`
+}
+
+// Consent records an investor's acceptance of a document, identified by
+// its hash, such as offering terms, a privacy policy or a risk disclosure
+type Consent struct {
+	Address      string    `json:"address"`
+	DocumentHash string    `json:"documentHash"` // lower-case hex SHA-256
+	Version      string    `json:"version"`      // the document's own version label
+	AcceptedAt   time.Time `json:"acceptedAt"`   // when the investor accepted it
+	RecordedBy   string    `json:"recordedBy"`
+	RecordedAt   time.Time `json:"recordedAt"`
+	TxID         string    `json:"txId"`
+}
+
+// Accreditation records the verification of an investor as accredited,
+// kept apart from their KYC record. It is valid until its expiry date and
+// is renewed by recording a new verification.
+type Accreditation struct {
+	Address    string    `json:"address"`
+	Basis      string    `json:"basis"`      // one of accreditationBases
+	Verifier   string    `json:"verifier"`   // who verified it, such as a CPA or broker-dealer
+	VerifiedAt time.Time `json:"verifiedAt"` // date of the verification
+	ExpiryDate time.Time `json:"expiryDate"`
+	RecordedBy string    `json:"recordedBy"`
+	RecordedAt time.Time `json:"recordedAt"`
+	TxID       string    `json:"txId"`
+}
+
+// accreditationBases are the grounds an investor can be accredited on
+var accreditationBases = []string{"INCOME", "NET_WORTH", "PROFESSIONAL_CERTIFICATION", "ENTITY_ASSETS", "KNOWLEDGEABLE_EMPLOYEE"}
+
+// OrgPolicy is an organisation's own transfer restrictions, layered on the
+// channel-wide transfer rules of the bonds it covers for transfers its
+// clients submit. The fields mean what they do in TransferRules, and an
+// organisation policy can only make the rules stricter.
+type OrgPolicy struct {
+	MSPID                string              `json:"mspId"`
+	Scope                string              `json:"scope"` // bond ID, or GLOBAL for all bonds
+	BlockedJurisdictions []string            `json:"blockedJurisdictions,omitempty"`
+	AllowedJurisdictions []string            `json:"allowedJurisdictions,omitempty"`
+	MaxRiskLevel         string              `json:"maxRiskLevel,omitempty"`
+	MaxTransferQuantity  int64               `json:"maxTransferQuantity,omitempty"`
+	InvestorClasses      map[string][]string `json:"investorClasses,omitempty"`
+	MaxHoldingByClass    map[string]int64    `json:"maxHoldingByClass,omitempty"`
+	UpdatedBy            string              `json:"updatedBy"`
+	UpdatedAt            time.Time           `json:"updatedAt"`
+	TxID                 string              `json:"txId"`
+}
+
+// TransferDecision is the outcome of CheckTransfer. A denied transfer lists
+// every rule it breaks, not just the first.
+type TransferDecision struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	BondID   string            `json:"bondId"`
+	Quantity int64             `json:"quantity"`
+	Allowed  bool              `json:"allowed"`
+	Reasons  []*TransferReason `json:"reasons"`
+
+	// Version of the bond's transfer rules the decision was made under, 0
+	// if the bond has none
+	PolicyVersion int64 `json:"policyVersion"`
+
+	// Most tokens the receiving party may hold under its investor class
+	// and KYC tier, 0 for no limit. The caller, which knows the balance,
+	// enforces it.
+	MaxHolding int64 `json:"maxHolding,omitempty"`
+
+	// Conditions that do not block the transfer but should be reviewed,
+	// such as a watchlisted party
+	Flags []*TransferReason `json:"flags,omitempty"`
+
+	// Rules checked in making the decision, whether or not they passed
+	RulesEvaluated []string `json:"rulesEvaluated"`
+
+	// Quantity times the bond's unit value, counted towards velocity rules'
+	// value limits
+	Value float64 `json:"value,omitempty"`
+
+	// Denials waived by an approved exemption of the party
+	Exempted []*TransferReason `json:"exempted,omitempty"`
+
+	// Organisation whose policies were layered on the bond's rules, if any
+	OrgPolicyMSP string `json:"orgPolicyMsp,omitempty"`
+}
+
+// Attestation certifies that an address passed a compliance scope when it
+// was issued, so other applications can rely on the KYC done here without
+// seeing the personal data. Hash anchors the attested fields: a copy held
+// off-chain can be checked against the ledger with VerifyAttestation.
+type Attestation struct {
+	ID        string    `json:"id"`
+	Address   string    `json:"address"`
+	Scope     string    `json:"scope"` // "KYC", "AML", "FULL"
+	RiskLevel string    `json:"riskLevel"`
+	IssuedBy  string    `json:"issuedBy"`
+	IssuerMSP string    `json:"issuerMsp"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Hash      string    `json:"hash"` // hex SHA-256 of the fields above
+
+	Revoked          bool      `json:"revoked"`
+	RevokedBy        string    `json:"revokedBy,omitempty"`
+	RevokedAt        time.Time `json:"revokedAt,omitempty"`
+	RevocationReason string    `json:"revocationReason,omitempty"`
+}
+
+// AttestationVerification is the outcome of VerifyAttestation
+type AttestationVerification struct {
+	AttestationID string       `json:"attestationId"`
+	Valid         bool         `json:"valid"`
+	Reason        string       `json:"reason,omitempty"` // why the attestation is not valid
+	Attestation   *Attestation `json:"attestation,omitempty"`
+}
+
+// SuspiciousActivityReport records surveillance findings about an address.
+// Reports start as DRAFT, are FILED with the regulator and end CLOSED.
+type SuspiciousActivityReport struct {
+	ID        string    `json:"id"`
+	Address   string    `json:"address"`
+	TxRefs    []string  `json:"txRefs"` // IDs of the transactions reported
+	Narrative string    `json:"narrative"`
+	Severity  string    `json:"severity"` // "LOW", "MEDIUM", "HIGH", "CRITICAL"
+	Status    string    `json:"status"`   // "DRAFT", "FILED", "CLOSED"
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	FiledBy   string    `json:"filedBy,omitempty"`
+	FiledAt   time.Time `json:"filedAt,omitempty"`
+	ClosedBy  string    `json:"closedBy,omitempty"`
+	ClosedAt  time.Time `json:"closedAt,omitempty"`
+}
+
+// ListEntry is an address's entry on the blacklist or watchlist. Removing an
+// address deactivates its entry rather than deleting it, and every change
+// is appended to History.
+type ListEntry struct {
+	Address       string        `json:"address"`
+	List          string        `json:"list"` // "BLACKLIST" or "WATCHLIST"
+	ReasonCode    string        `json:"reasonCode"`
+	Reason        string        `json:"reason"`
+	EffectiveFrom time.Time     `json:"effectiveFrom"`
+	EffectiveTo   time.Time     `json:"effectiveTo"` // zero for no end date
+	Active        bool          `json:"active"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+	TxID          string        `json:"txId"`
+	History       []*ListChange `json:"history"`
+}
+
+// ListChange is one addition to or removal from a list
+type ListChange struct {
+	Action        string    `json:"action"` // "ADDED" or "REMOVED"
+	ReasonCode    string    `json:"reasonCode,omitempty"`
+	Reason        string    `json:"reason"`
+	EffectiveFrom time.Time `json:"effectiveFrom,omitempty"`
+	EffectiveTo   time.Time `json:"effectiveTo,omitempty"`
+	ChangedBy     string    `json:"changedBy"` // enrollment ID
+	ChangedAt     time.Time `json:"changedAt"`
+	TxID          string    `json:"txId"`
+}
+
+// inEffect reports whether a list entry applies at the given time
+func (e *ListEntry) inEffect(at time.Time) bool {
+	if e == nil || !e.Active || e.EffectiveFrom.After(at) {
+		return false
+	}
+	return e.EffectiveTo.IsZero() || at.Before(e.EffectiveTo)
+}
+
+// KYCTierLimits are the limits of a KYC tier and the evidence documents an
+// investor needs to be upgraded to it
+type KYCTierLimits struct {
+	Tier                string    `json:"tier"`
+	MaxHolding          int64     `json:"maxHolding"`          // most tokens of one bond, 0 for no limit
+	MaxTransferQuantity int64     `json:"maxTransferQuantity"` // 0 for no limit
+	RequiredDocuments   []string  `json:"requiredDocuments"`   // KYCDocument types, e.g. "PROOF_OF_FUNDS"
+	UpdatedAt           time.Time `json:"updatedAt"`
+	TxID                string    `json:"txId"`
+}
+
+// InvestorLimit caps what one investor may hold and trade in a bond or, with
+// BondID GLOBAL, across all bonds
+type InvestorLimit struct {
+	Address        string    `json:"address"`
+	BondID         string    `json:"bondId"`         // bond ID or "GLOBAL"
+	MaxHolding     int64     `json:"maxHolding"`     // 0 for no limit
+	MaxDailyVolume int64     `json:"maxDailyVolume"` // tokens bought and sold in any 24 hours, 0 for no limit
+	UpdatedAt      time.Time `json:"updatedAt"`
+	TxID           string    `json:"txId"`
+}
+
+// LimitUtilization is what an investor has used of its limits in a bond or
+// across all bonds, as seen by the transfers RecordTransfer has allowed
+type LimitUtilization struct {
+	Address string        `json:"address"`
+	BondID  string        `json:"bondId"`
+	Holding int64         `json:"holding"` // net tokens received since tracking began
+	Trades  []*LimitTrade `json:"trades"`  // allowed transfers within the rolling window
+}
+
+// LimitTrade is one allowed transfer counted towards a daily volume limit
+type LimitTrade struct {
+	Quantity  int64     `json:"quantity"`
+	Timestamp time.Time `json:"timestamp"`
+	TxID      string    `json:"txId"`
+
+	Value float64 `json:"value,omitempty"` // counted towards velocity rules
+}
+
+// VelocityRule limits how many transfers each address may make, across
+// all bonds, and their total value in any rolling window of up to 24 hours
+type VelocityRule struct {
+	ID           string  `json:"id"`
+	WindowHours  int     `json:"windowHours"`  // 1 to 24
+	MaxTransfers int     `json:"maxTransfers"` // 0 for no limit
+	MaxValue     float64 `json:"maxValue"`     // in the reporting currency, 0 for no limit
+}
+
+// VelocityRules are the velocity rules every transfer is checked against
+type VelocityRules struct {
+	Rules     []*VelocityRule `json:"rules"`
+	UpdatedBy string          `json:"updatedBy"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	TxID      string          `json:"txId"`
+}
+
+// TransferReason is one rule a transfer breaks
+type TransferReason struct {
+	Address    string `json:"address,omitempty"` // party the rule applies to; empty for the transfer itself
+	ReasonCode string `json:"reasonCode"`
+	Reason     string `json:"reason"`
+
+	ExemptionID string `json:"exemptionId,omitempty"` // set on denials waived by an exemption
+}
+
+// SanctionsEntry is one entry of a sanctions list. Names and identifiers
+// are stored only as hex SHA-256 hashes of their normalised form (see
+// normaliseForScreening), so the list can be matched without publishing it.
+type SanctionsEntry struct {
+	ID               string    `json:"id"`     // entry ID within the list source
+	Source           string    `json:"source"` // e.g. "OFAC_SDN", "UN", "EU"
+	NameHash         string    `json:"nameHash"`
+	IdentifierHashes []string  `json:"identifierHashes"` // passport, national ID numbers
+	EffectiveDate    time.Time `json:"effectiveDate"`
+	Removed          bool      `json:"removed"` // delisted entries are kept for audit
+	UpdatedAt        time.Time `json:"updatedAt"`
+	TxID             string    `json:"txId"`
+}
+
+// SanctionsMatch is a sanctions list entry an investor matched
+type SanctionsMatch struct {
+	Source    string `json:"source"`
+	EntryID   string `json:"entryId"`
+	MatchedOn string `json:"matchedOn"` // "NAME", "IDENTIFIER"
+}
+
+// ScreeningResult is the outcome of screening an investor against the
+// active sanctions list entries
+type ScreeningResult struct {
+	Address    string            `json:"address"`
+	Hit        bool              `json:"hit"`
+	Matches    []*SanctionsMatch `json:"matches"`
+	ScreenedAt time.Time         `json:"screenedAt"`
+}
+
+// ScreeningProvider is an external screening service registered to write
+// AML check results directly. Only the client with the registered MSP and
+// enrollment ID may submit its results, and each result must be signed with
+// the private key matching PublicKey.
+type ScreeningProvider struct {
+	ProviderID   string    `json:"providerId"`
+	Name         string    `json:"name"`
+	PublicKey    string    `json:"publicKey"` // PEM-encoded PKIX ECDSA or RSA public key
+	MSPID        string    `json:"mspId"`
+	EnrollmentID string    `json:"enrollmentId"`
+	Active       bool      `json:"active"`
+	UpdatedBy    string    `json:"updatedBy"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	TxID         string    `json:"txId"`
+}
+
+// ProviderScreeningResult is the payload a screening provider signs and
+// submits with SubmitScreeningResult
+type ProviderScreeningResult struct {
+	ProviderID  string    `json:"providerId"`
+	ReferenceID string    `json:"referenceId"` // unique per provider
+	Address     string    `json:"address"`
+	CheckType   string    `json:"checkType"` // "SANCTIONS", "PEP", "ADVERSE_MEDIA"
+	Status      string    `json:"status"`    // "PASSED", "FAILED", "PENDING"
+	RiskScore   int       `json:"riskScore"`
+	Details     string    `json:"details"`
+	ScreenedAt  time.Time `json:"screenedAt"`
+	ExpiryDate  time.Time `json:"expiryDate,omitempty"` // defaults to 6 months after ScreenedAt
+}
+
+// ScreeningSubmission records a signed result a screening provider has
+// submitted, so anyone can re-verify the signature later
+type ScreeningSubmission struct {
+	ProviderID  string    `json:"providerId"`
+	ReferenceID string    `json:"referenceId"`
+	Payload     string    `json:"payload"`
+	Signature   string    `json:"signature"` // base64
+	SubmittedBy string    `json:"submittedBy"`
+	SubmittedAt time.Time `json:"submittedAt"`
+	TxID        string    `json:"txId"`
+}
+
+// RiskScore is an investor's aggregate risk score from 0 to 100, the
+// weighted sum of its factors
+type RiskScore struct {
+	Score    int           `json:"score"`
+	Factors  []*RiskFactor `json:"factors"`
+	ScoredAt time.Time     `json:"scoredAt"`
+}
+
+// RiskFactor is one input to an aggregate risk score
+type RiskFactor struct {
+	Name   string `json:"name"`   // "KYC_RISK_LEVEL", "AML_CHECKS", "JURISDICTION", "TRANSACTION_BEHAVIOR"
+	Score  int    `json:"score"`  // 0 to 100
+	Weight int    `json:"weight"` // percent of the aggregate score
+	Detail string `json:"detail"`
+}
+
+// CountryRisk is the compliance admin's rating of a country. It sets the
+// jurisdiction factor of investors' risk scores and which investors bonds
+// may be transferred to.
+type CountryRisk struct {
+	Country          string    `json:"country"`                    // ISO country code
+	RiskTier         string    `json:"riskTier"`                   // "LOW", "MEDIUM", "HIGH", "PROHIBITED"
+	FATFStatus       string    `json:"fatfStatus"`                 // "NONE", "INCREASED_MONITORING", "CALL_FOR_ACTION"
+	SanctionsRegimes []string  `json:"sanctionsRegimes,omitempty"` // e.g. "OFAC", "EU", "UN"
+	UpdatedBy        string    `json:"updatedBy"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+	TxID             string    `json:"txId"`
+}
+
+// ComplianceHold stops an address's holdings of a bond, or of every bond
+// when BondID is empty, from being transferred out until it is released
+type ComplianceHold struct {
+	ID       string    `json:"id"`
+	Address  string    `json:"address"`
+	BondID   string    `json:"bondId,omitempty"`
+	Reason   string    `json:"reason"`
+	Status   string    `json:"status"`   // "ACTIVE", "RELEASED"
+	Holdings int       `json:"holdings"` // holdings held on the BondToken ledger when placed
+	PlacedBy string    `json:"placedBy"`
+	PlacedAt time.Time `json:"placedAt"`
+	TxID     string    `json:"txId"`
+
+	ReleasedBy    string    `json:"releasedBy,omitempty"`
+	ReleasedAt    time.Time `json:"releasedAt,omitempty"`
+	ReleaseReason string    `json:"releaseReason,omitempty"`
+}
+
+// Exemption waives one CheckTransfer rule, identified by its denial reason
+// code, for an address's transfers of a bond, or of every bond when BondID
+// is empty, until it expires. It is created PENDING and only takes effect
+// once the designated approver approves it.
+type Exemption struct {
+	ID         string    `json:"id"`
+	Address    string    `json:"address"`
+	ReasonCode string    `json:"reasonCode"` // e.g. "JURISDICTION_BLOCKED", "HOLDING_LIMIT_EXCEEDED"
+	BondID     string    `json:"bondId,omitempty"`
+	Reason     string    `json:"reason"` // why the holder is exempted, e.g. held before a rule change
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Status     string    `json:"status"` // "PENDING", "APPROVED", "REVOKED"
+	CreatedBy  string    `json:"createdBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Approver   string    `json:"approver"` // enrollment ID of the compliance admin who must approve it
+	ApprovedAt time.Time `json:"approvedAt,omitempty"`
+	TxID       string    `json:"txId"`
+
+	RevokedBy        string    `json:"revokedBy,omitempty"`
+	RevokedAt        time.Time `json:"revokedAt,omitempty"`
+	RevocationReason string    `json:"revocationReason,omitempty"`
+}
+
+// TransferScenario is the hypothetical state SimulateCheckTransfer decides
+// a transfer in. It is applied over the ledger state and never stored.
+type TransferScenario struct {
+	// Changes to the parties' KYC records, by address. A change for an
+	// address without a record simulates onboarding it, as PENDING unless
+	// the change sets a status.
+	KYC map[string]*KYCChange `json:"kyc,omitempty"`
+
+	// Limits replacing the parties' current ones of the same address and
+	// bond ID, or GLOBAL
+	Limits []*InvestorLimit `json:"limits,omitempty"`
+
+	At time.Time `json:"at,omitempty"` // time to decide at instead of now
+}
+
+// KYCChange is a hypothetical change to a KYC record. Empty fields keep the
+// recorded values.
+type KYCChange struct {
+	Status        string `json:"status,omitempty"`
+	RiskLevel     string `json:"riskLevel,omitempty"`
+	Nationality   string `json:"nationality,omitempty"`
+	TaxResidence  string `json:"taxResidence,omitempty"`
+	InvestorClass string `json:"investorClass,omitempty"`
+	KYCTier       string `json:"kycTier,omitempty"`
+}
+
+// KYCPage is a page of QueryKYC results
+type KYCPage struct {
+	Records  []*KYCRecord `json:"records"`
+	Count    int32        `json:"count"`
+	Bookmark string       `json:"bookmark"`
+}
+
+// ComplianceHistoryEntry is one status change of an address's KYC record or
+// one of its AML checks
+type ComplianceHistoryEntry struct {
+	Record         string    `json:"record"` // "KYC" or the AML check type
+	Status         string    `json:"status"` // "DELETED" when the record was removed
+	PreviousStatus string    `json:"previousStatus,omitempty"`
+	Invoker        string    `json:"invoker,omitempty"` // enrollment ID of the client that made the change
+	InvokerMSP     string    `json:"invokerMsp,omitempty"`
+	TxID           string    `json:"txId"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// RescreeningDue lists what needs refreshing for one address under its
+// risk-based review frequency
+type RescreeningDue struct {
+	Address      string    `json:"address"`
+	RiskLevel    string    `json:"riskLevel"`
+	KYCReviewDue bool      `json:"kycReviewDue"`
+	LastReviewed time.Time `json:"lastReviewed"`
+	DueChecks    []string  `json:"dueChecks"` // AML check types due for re-screening
+}
+
+// ComplianceStats are the figures a compliance dashboard shows, computed
+// over every KYC record and AML check as of a time
+type ComplianceStats struct {
+	AsOf       time.Time `json:"asOf"`
+	WindowDays int       `json:"windowDays"` // look-ahead for expiring checks and look-back for rejections
+
+	TotalKYC       int            `json:"totalKyc"`
+	KYCByStatus    map[string]int `json:"kycByStatus"`
+	KYCByRiskLevel map[string]int `json:"kycByRiskLevel"` // approved records only; "NONE" if unrated
+
+	// Requests waiting on a compliance decision
+	PendingKYC           int `json:"pendingKyc"`
+	PendingInvestorClass int `json:"pendingInvestorClass"`
+	PendingKYCTier       int `json:"pendingKycTier"`
+	PendingErasures      int `json:"pendingErasures"`
+	PendingExemptions    int `json:"pendingExemptions"`
+
+	TotalChecks      int            `json:"totalChecks"`
+	ChecksByStatus   map[string]int `json:"checksByStatus"`
+	ExpiredChecks    int            `json:"expiredChecks"`
+	ExpiringChecks   int            `json:"expiringChecks"` // expiring within the window
+	RecentRejections int            `json:"recentRejections"`
+}
+
+// ComplianceException is a bond holder whose KYC or AML checks are not in
+// order
+type ComplianceException struct {
+	Address   string   `json:"address"`
+	BondIDs   []string `json:"bondIds"`   // bonds it holds tokens of
+	KYCStatus string   `json:"kycStatus"` // "NONE" without a KYC record
+	Issues    []string `json:"issues"`    // e.g. "KYC_NOT_APPROVED", "AML_SANCTIONS_MISSING", "AML_PEP_EXPIRED"
+}
+
+// ComplianceStatusSummary is an investor's own view of its compliance
+// status. It leaves out what could tip the investor off to an
+// investigation: failed checks, list entries and risk ratings.
+type ComplianceStatusSummary struct {
+	Address           string                    `json:"address"`
+	Compliant         bool                      `json:"compliant"`
+	KYCStatus         string                    `json:"kycStatus"` // "NONE" without a KYC record
+	InvestorClass     string                    `json:"investorClass,omitempty"`
+	KYCTier           string                    `json:"kycTier,omitempty"`
+	ApprovedAt        time.Time                 `json:"approvedAt,omitempty"`
+	IdentityDocuments []*IdentityDocumentStatus `json:"identityDocuments,omitempty"`
+	Checks            []*CheckSummary           `json:"checks"`
+
+	// What the investor can do something about, e.g. "KYC_NOT_APPROVED",
+	// "IDENTITY_DOCUMENT_EXPIRED" or "AML_SANCTIONS_EXPIRED"
+	ActionsRequired []string `json:"actionsRequired"`
+}
+
+// CheckSummary is the investor's view of one of its AML checks
+type CheckSummary struct {
+	CheckType  string    `json:"checkType"`
+	Status     string    `json:"status"` // "CURRENT", "EXPIRED", "MISSING", "UNDER_REVIEW"
+	ExpiryDate time.Time `json:"expiryDate,omitempty"`
+}
+
+// ComplianceExceptionReport lists the bond holders with compliance gaps
+type ComplianceExceptionReport struct {
+	AsOf           time.Time              `json:"asOf"`
+	HoldersChecked int                    `json:"holdersChecked"`
+	Exceptions     []*ComplianceException `json:"exceptions"`
+}
+
+// BlockedTransfer records a transfer RecordTransfer denied
+type BlockedTransfer struct {
+	TxID        string    `json:"txId"`
+	From        string    `json:"from"`
+	To          string    `json:"to"`
+	BondID      string    `json:"bondId"`
+	Quantity    int64     `json:"quantity"`
+	ReasonCodes []string  `json:"reasonCodes"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// RegulatoryExtract is the data behind a regulatory report for one period,
+// for the off-chain reporting service to render into the mandated formats.
+// Sections the report type does not cover are omitted.
+type RegulatoryExtract struct {
+	Period      string    `json:"period"`
+	ReportType  string    `json:"reportType"` // "FULL", "INVESTORS", "SAR", "BLOCKED_TRANSFERS"
+	PeriodStart time.Time `json:"periodStart"`
+	PeriodEnd   time.Time `json:"periodEnd"` // exclusive
+	GeneratedAt time.Time `json:"generatedAt"`
+
+	Investors        *InvestorExtract        `json:"investors,omitempty"`
+	SARs             *SARExtract             `json:"sars,omitempty"`
+	BlockedTransfers *BlockedTransferExtract `json:"blockedTransfers,omitempty"`
+}
+
+// InvestorExtract counts investors by jurisdiction, their nationality or
+// country of incorporation
+type InvestorExtract struct {
+	ApprovedInvestors      int            `json:"approvedInvestors"` // approved records created before the period ended
+	ByJurisdiction         map[string]int `json:"byJurisdiction"`
+	RejectedKYC            int            `json:"rejectedKyc"` // records rejected during the period
+	RejectedByJurisdiction map[string]int `json:"rejectedByJurisdiction"`
+}
+
+// SARExtract counts suspicious activity reports filed with the regulator
+type SARExtract struct {
+	Filed           int            `json:"filed"` // filed during the period
+	FiledBySeverity map[string]int `json:"filedBySeverity"`
+	Closed          int            `json:"closed"`          // closed during the period
+	OpenAtPeriodEnd int            `json:"openAtPeriodEnd"` // filed and not yet closed when the period ended
+}
+
+// BlockedTransferExtract counts the transfers RecordTransfer denied during
+// the period. A transfer denied for several reasons counts once under each.
+type BlockedTransferExtract struct {
+	Total        int            `json:"total"`
+	ByReasonCode map[string]int `json:"byReasonCode"`
+	ByBond       map[string]int `json:"byBond"`
+}
+
+// bondTokenBond and bondTokenHolder are the fields of the BondToken
+// contract's Bond and TokenHolder the compliance contract reads
+type bondTokenBond struct {
+	ID       string `json:"id"`
+	IssuerID string `json:"issuerId"`
+	Status   string `json:"status"`
+}
+
+type bondTokenHolder struct {
+	Address  string `json:"address"`
+	BondID   string `json:"bondId"`
+	Quantity int64  `json:"quantity"`
+}
+
+// kycStatusEventSchemaVersion is the version of the KYCStatusEvent payload.
+// It is bumped whenever a field is renamed, removed or changes meaning.
+const kycStatusEventSchemaVersion = 1
+
+// KYCStatusEvent is the payload of the KYCApproved, KYCRejected, KYCExpired
+// and KYCSuspended events, which carry the status changes of KYC records
+// for off-chain notification services
+type KYCStatusEvent struct {
+	SchemaVersion  int             `json:"schemaVersion"`
+	Address        string          `json:"address"`
+	Status         string          `json:"status"`
+	PreviousStatus string          `json:"previousStatus"`
+	EffectiveFrom  time.Time       `json:"effectiveFrom"`
+	EffectiveTo    time.Time       `json:"effectiveTo,omitempty"` // when an approval is due for review
+	Reason         string          `json:"reason,omitempty"`
+	ChangedBy      string          `json:"changedBy"`
+	RiskLevel      string          `json:"riskLevel"`
+	RiskScoreDelta *RiskScoreDelta `json:"riskScoreDelta,omitempty"`
+	TxID           string          `json:"txId"`
+}
+
 // ComplianceEvent represents a compliance event
 type ComplianceEvent struct {
 	Type      string    `json:"type"`
@@ -61,6 +1050,25 @@ type ComplianceEvent struct {
 	Details   string    `json:"details"`
 	Timestamp time.Time `json:"timestamp"`
 	TxID      string    `json:"txId"`
+
+	// Context of the decision the event records, so surveillance can
+	// reconstruct why an address was allowed or blocked
+	Outcome        string            `json:"outcome,omitempty"` // e.g. "ALLOWED", "DENIED", "APPROVED", "FAILED"
+	BondID         string            `json:"bondId,omitempty"`
+	PolicyVersion  int64             `json:"policyVersion,omitempty"`
+	RulesEvaluated []string          `json:"rulesEvaluated,omitempty"`
+	Reasons        []*TransferReason `json:"reasons,omitempty"`
+	Flags          []*TransferReason `json:"flags,omitempty"`
+	Exempted       []*TransferReason `json:"exempted,omitempty"`
+	RiskScoreDelta *RiskScoreDelta   `json:"riskScoreDelta,omitempty"`
+}
+
+// RiskScoreDelta is a change to an investor's risk score, reported on the
+// event of the transaction that made it
+type RiskScoreDelta struct {
+	Previous *int `json:"previous"` // nil if the investor had no score
+	Current  int  `json:"current"`
+	Delta    int  `json:"delta"`
 }
 
 // Init initializes the contract
@@ -69,8 +1077,20 @@ func (c *Compliance) Init(ctx contractapi.TransactionContextInterface) error {
 	return nil
 }
 
-// CreateKYC creates a new KYC record
-func (c *Compliance) CreateKYC(ctx contractapi.TransactionContextInterface, address, fullName, dateOfBirth, nationality, idType, idNumber string) error {
+// CreateKYC creates a new KYC record for an individual. The investor's full
+// name, date of birth and identity documents are passed as a
+// KYCPersonalData object under the "kyc" transient key and stored in the
+// kyc-private collection; the record lists the documents, without their
+// numbers, pending verification. A document already given for another
+// address is rejected unless the compliance admin has approved a duplicate
+// identity override, in which case the record is flagged with the other
+// address. Corporate investors are created with CreateCorporateKYC.
+func (c *Compliance) CreateKYC(ctx contractapi.TransactionContextInterface, address, nationality string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
 	// Check if KYC already exists
 	exists, err := c.KYCExists(ctx, address)
 	if err != nil {
@@ -80,386 +1100,7864 @@ func (c *Compliance) CreateKYC(ctx contractapi.TransactionContextInterface, addr
 		return fmt.Errorf("KYC for address %s already exists", address)
 	}
 
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient data: %v", err)
+	}
+	piiJSON, ok := transient[kycTransientKey]
+	if !ok {
+		return fmt.Errorf("personal data must be passed in the %q transient key", kycTransientKey)
+	}
+
+	var pii KYCPersonalData
+	err = json.Unmarshal(piiJSON, &pii)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal personal data: %v", err)
+	}
+	err = pii.validate()
+	if err != nil {
+		return err
+	}
+	pii.Address = address
+
+	duplicateOf, err := duplicateIdentities(ctx, address, &pii)
+	if err != nil {
+		return err
+	}
+
+	// Store personal data
+	piiJSON, err = json.Marshal(pii)
+	if err != nil {
+		return fmt.Errorf("failed to marshal personal data: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(kycCollection, address, piiJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store personal data: %v", err)
+	}
+
+	for _, document := range pii.Documents {
+		indexKey, err := ctx.GetStub().CreateCompositeKey(idHashIndex, []string{identityDocumentHash(document), address})
+		if err != nil {
+			return fmt.Errorf("failed to create identity index key: %v", err)
+		}
+		err = ctx.GetStub().PutPrivateData(kycCollection, indexKey, []byte{0})
+		if err != nil {
+			return fmt.Errorf("failed to store identity index: %v", err)
+		}
+	}
+
 	// Create new KYC record
+	hash := sha256.Sum256(piiJSON)
 	kyc := KYCRecord{
 		Address:     address,
-		FullName:    fullName,
-		DateOfBirth: dateOfBirth,
 		Nationality: nationality,
-		IDType:      idType,
-		IDNumber:    idNumber,
+		PIIHash:     hex.EncodeToString(hash[:]),
 		Status:      "PENDING",
 		RiskLevel:   "MEDIUM",
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 		Metadata:    make(map[string]string),
+
+		RecordType: "INDIVIDUAL",
+
+		IdentityDocuments: pii.documentStatuses(),
+		DuplicateOf:       duplicateOf,
 	}
 
 	// Store KYC record
-	kycJSON, err := json.Marshal(kyc)
+	err = putKYC(ctx, &kyc)
+	if err != nil {
+		return fmt.Errorf("failed to store KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "KYC_CREATED",
+		Address:   address,
+		Details:   fmt.Sprintf("KYC created for %s", address),
+		Timestamp: time.Now(),
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// ApproveDuplicateIdentity allows a KYC record about to be created for
+// address to share identity documents with the existing record of
+// existingAddress, for the same person legitimately holding both, such as
+// a migrated account. Only the compliance admin may approve overrides.
+func (c *Compliance) ApproveDuplicateIdentity(ctx contractapi.TransactionContextInterface, address, existingAddress, reason string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if address == existingAddress {
+		return fmt.Errorf("an address cannot duplicate itself")
+	}
+	if reason == "" {
+		return fmt.Errorf("a reason for the override is required")
+	}
+	exists, err := c.KYCExists(ctx, existingAddress)
+	if err != nil {
+		return fmt.Errorf("failed to check KYC existence: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("KYC for address %s does not exist", existingAddress)
+	}
+
+	approvedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	approvedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	override := DuplicateIdentityOverride{
+		Address:         address,
+		ExistingAddress: existingAddress,
+		Reason:          reason,
+		ApprovedBy:      approvedBy,
+		ApprovedAt:      approvedAt,
+		TxID:            ctx.GetStub().GetTxID(),
+	}
+
+	overrideJSON, err := json.Marshal(override)
+	if err != nil {
+		return fmt.Errorf("failed to marshal override: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(idOverrideObjectType, []string{address, existingAddress})
+	if err != nil {
+		return fmt.Errorf("failed to create override key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, overrideJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store override: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "DUPLICATE_IDENTITY_APPROVED",
+		Address:   address,
+		Details:   fmt.Sprintf("%s may share identity documents with %s: %s", address, existingAddress, reason),
+		Timestamp: approvedAt,
+		TxID:      override.TxID,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// CreateCorporateKYC creates a new KYC record for a corporate investor
+// incorporated in incorporationCountry, with its legal entity identifier if
+// it has one. The entity's legal name, registration number and directors
+// are passed as a KYCEntityData object under the "kyc" transient key and
+// stored in the kyc-private collection. Its beneficial owners are linked
+// with AddBeneficialOwner.
+func (c *Compliance) CreateCorporateKYC(ctx contractapi.TransactionContextInterface, address, incorporationCountry, lei string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if !isCountryCode(incorporationCountry) {
+		return fmt.Errorf("invalid incorporation country: %s", incorporationCountry)
+	}
+	if lei != "" && !isLEI(lei) {
+		return fmt.Errorf("invalid LEI: %s", lei)
+	}
+
+	exists, err := c.KYCExists(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to check KYC existence: %v", err)
+	}
+	if exists {
+		return fmt.Errorf("KYC for address %s already exists", address)
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient data: %v", err)
+	}
+	entityJSON, ok := transient[kycTransientKey]
+	if !ok {
+		return fmt.Errorf("entity data must be passed in the %q transient key", kycTransientKey)
+	}
+
+	var entity KYCEntityData
+	err = json.Unmarshal(entityJSON, &entity)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal entity data: %v", err)
+	}
+	err = entity.validate()
+	if err != nil {
+		return err
+	}
+	entity.Address = address
+	entity.IncorporationCountry = incorporationCountry
+
+	entityJSON, err = json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity data: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(kycCollection, address, entityJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store entity data: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(entityJSON)
+	kyc := KYCRecord{
+		Address:     address,
+		Nationality: incorporationCountry,
+		PIIHash:     hex.EncodeToString(hash[:]),
+		Status:      "PENDING",
+		RiskLevel:   "MEDIUM",
+		CreatedAt:   txTime,
+		UpdatedAt:   txTime,
+		Metadata:    make(map[string]string),
+
+		RecordType: "CORPORATE",
+		LEI:        lei,
+
+		TaxClassification: "CORPORATE",
+	}
+
+	err = putKYC(ctx, &kyc)
+	if err != nil {
+		return fmt.Errorf("failed to store KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "KYC_CREATED",
+		Address:   address,
+		Details:   fmt.Sprintf("Corporate KYC created for %s", address),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// ApproveKYC approves a KYC record on behalf of the calling compliance
+// officer, whose enrollment ID is recorded as the approver. expectedVersion
+// is the KYC version the caller last read, or 0 to skip the concurrency
+// check.
+func (c *Compliance) ApproveKYC(ctx contractapi.TransactionContextInterface, address, riskLevel string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	approvedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	approvedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	previousStatus := kyc.Status
+	kyc.Status = "APPROVED"
+	kyc.RiskLevel = riskLevel
+	kyc.ApprovedBy = approvedBy
+	kyc.ApprovedAt = time.Now()
+	kyc.UpdatedAt = time.Now()
+
+	scoreChange, err := refreshRiskScore(ctx, kyc, nil)
+	if err != nil {
+		return err
+	}
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	return emitKYCStatusEvent(ctx, "KYCApproved", &KYCStatusEvent{
+		Address:        address,
+		Status:         kyc.Status,
+		PreviousStatus: previousStatus,
+		EffectiveFrom:  approvedAt,
+		EffectiveTo:    approvedAt.AddDate(reviewYears(kyc), 0, 0),
+		ChangedBy:      approvedBy,
+		RiskLevel:      kyc.RiskLevel,
+		RiskScoreDelta: scoreChange,
+	})
+}
+
+// RejectKYC rejects a KYC record on behalf of the calling compliance
+// officer, whose enrollment ID is recorded. expectedVersion is the KYC
+// version the caller last read, or 0 to skip the concurrency check.
+func (c *Compliance) RejectKYC(ctx contractapi.TransactionContextInterface, address, reason string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	rejectedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	rejectedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	previousStatus := kyc.Status
+	kyc.Status = "REJECTED"
+	kyc.UpdatedAt = time.Now()
+	kyc.Metadata["rejection_reason"] = reason
+	kyc.Metadata["rejected_by"] = rejectedBy
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	return emitKYCStatusEvent(ctx, "KYCRejected", &KYCStatusEvent{
+		Address:        address,
+		Status:         kyc.Status,
+		PreviousStatus: previousStatus,
+		EffectiveFrom:  rejectedAt,
+		Reason:         reason,
+		ChangedBy:      rejectedBy,
+		RiskLevel:      kyc.RiskLevel,
+	})
+}
+
+// SuspendKYC suspends an approved KYC record, for instance while an alert
+// is investigated, so the investor fails compliance checks until
+// ReinstateKYC approves it again. Only compliance officers and the
+// compliance admin may suspend KYC records.
+func (c *Compliance) SuspendKYC(ctx contractapi.TransactionContextInterface, address, reason string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("suspension reason is required")
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	if kyc.Status != "APPROVED" {
+		return fmt.Errorf("only approved KYC records can be suspended, KYC for %s is %s", address, kyc.Status)
+	}
+
+	suspendedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	suspendedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.Status = "SUSPENDED"
+	kyc.UpdatedAt = suspendedAt
+	kyc.Metadata["suspension_reason"] = reason
+	kyc.Metadata["suspended_by"] = suspendedBy
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	return emitKYCStatusEvent(ctx, "KYCSuspended", &KYCStatusEvent{
+		Address:        address,
+		Status:         kyc.Status,
+		PreviousStatus: "APPROVED",
+		EffectiveFrom:  suspendedAt,
+		Reason:         reason,
+		ChangedBy:      suspendedBy,
+		RiskLevel:      kyc.RiskLevel,
+	})
+}
+
+// ReinstateKYC approves a suspended KYC record again, keeping its original
+// approval and review date. Only compliance officers and the compliance
+// admin may reinstate KYC records.
+func (c *Compliance) ReinstateKYC(ctx contractapi.TransactionContextInterface, address string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	if kyc.Status != "SUSPENDED" {
+		return fmt.Errorf("KYC for %s is not suspended", address)
+	}
+
+	reinstatedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	reinstatedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.Status = "APPROVED"
+	kyc.UpdatedAt = reinstatedAt
+	delete(kyc.Metadata, "suspension_reason")
+	delete(kyc.Metadata, "suspended_by")
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	return emitKYCStatusEvent(ctx, "KYCApproved", &KYCStatusEvent{
+		Address:        address,
+		Status:         kyc.Status,
+		PreviousStatus: "SUSPENDED",
+		EffectiveFrom:  reinstatedAt,
+		EffectiveTo:    kycReviewDate(kyc, reinstatedAt),
+		Reason:         "reinstated",
+		ChangedBy:      reinstatedBy,
+		RiskLevel:      kyc.RiskLevel,
+	})
+}
+
+// ExpireKYC marks an approved KYC record whose periodic review, due under
+// its risk level's review frequency, is overdue as EXPIRED, so the
+// investor fails compliance checks until the KYC is approved again. Only
+// compliance officers and the compliance admin may expire KYC records.
+func (c *Compliance) ExpireKYC(ctx contractapi.TransactionContextInterface, address string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	if kyc.Status != "APPROVED" {
+		return fmt.Errorf("only approved KYC records can expire, KYC for %s is %s", address, kyc.Status)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	reviewDate := kycReviewDate(kyc, now)
+	if now.Before(reviewDate) {
+		return fmt.Errorf("KYC for %s is not due for review until %s", address, reviewDate.Format("2006-01-02"))
+	}
+
+	expiredBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.Status = "EXPIRED"
+	kyc.UpdatedAt = now
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	return emitKYCStatusEvent(ctx, "KYCExpired", &KYCStatusEvent{
+		Address:        address,
+		Status:         kyc.Status,
+		PreviousStatus: "APPROVED",
+		EffectiveFrom:  reviewDate,
+		Reason:         "periodic review overdue",
+		ChangedBy:      expiredBy,
+		RiskLevel:      kyc.RiskLevel,
+	})
+}
+
+// CreateAMLCheck creates a new AML check, recording the calling compliance
+// officer's enrollment ID as the checker
+func (c *Compliance) CreateAMLCheck(ctx contractapi.TransactionContextInterface, address, checkType string, riskScore int, details string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	checkedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	checkedByMSP, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+
+	checkKey, err := amlKey(ctx, address, checkType)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Create new AML check
+	amlCheck := AMLCheck{
+		Address:      address,
+		CheckType:    checkType,
+		Status:       "PENDING",
+		RiskScore:    riskScore,
+		CheckDate:    txTime,
+		ExpiryDate:   txTime.AddDate(0, 6, 0), // 6 months validity
+		Details:      details,
+		CheckedBy:    checkedBy,
+		CheckedByMSP: checkedByMSP,
+	}
+
+	// Store AML check
+	checkJSON, err := json.Marshal(amlCheck)
+	if err != nil {
+		return fmt.Errorf("failed to marshal AML check: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(checkKey, checkJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store AML check: %v", err)
+	}
+
+	scoreChange, err := c.refreshStoredRiskScore(ctx, address, &amlCheck)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "AML_CHECK_CREATED",
+		Address:   address,
+		Details:   fmt.Sprintf("AML check created for %s: %s%s", address, checkType, scoreChange.describe()),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		Outcome:        amlCheck.Status,
+		RiskScoreDelta: scoreChange,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// UpdateAMLCheck updates an AML check, recording the calling compliance
+// officer's enrollment ID as the checker
+func (c *Compliance) UpdateAMLCheck(ctx contractapi.TransactionContextInterface, address, checkType, status string, riskScore int, details string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	checkedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	checkedByMSP, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+
+	checkKey, err := amlKey(ctx, address, checkType)
+	if err != nil {
+		return err
+	}
+
+	amlCheck, err := c.GetAMLCheck(ctx, address, checkType)
+	if err != nil {
+		return err
+	}
+
+	amlCheck.Status = status
+	amlCheck.RiskScore = riskScore
+	amlCheck.Details = details
+	amlCheck.CheckDate = time.Now()
+	amlCheck.ExpiryDate = amlCheck.CheckDate.AddDate(0, 6, 0) // re-screening renews the 6 months validity
+	amlCheck.CheckedBy = checkedBy
+	amlCheck.CheckedByMSP = checkedByMSP
+
+	// Store updated AML check
+	updatedCheckJSON, err := json.Marshal(amlCheck)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated AML check: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(checkKey, updatedCheckJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update AML check: %v", err)
+	}
+
+	scoreChange, err := c.refreshStoredRiskScore(ctx, address, amlCheck)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "AML_CHECK_UPDATED",
+		Address:   address,
+		Details:   fmt.Sprintf("AML check updated for %s: %s - %s%s", address, checkType, status, scoreChange.describe()),
+		Timestamp: time.Now(),
+		TxID:      ctx.GetStub().GetTxID(),
+
+		Outcome:        status,
+		RiskScoreDelta: scoreChange,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RegisterScreeningProvider registers a screening provider, or replaces the
+// registration of an existing one to rotate its key or identity. Only the
+// client with the given MSP ID and enrollment ID, holding the
+// SCREENING_PROVIDER role, may then submit the provider's results. Only the
+// compliance admin may register screening providers.
+func (c *Compliance) RegisterScreeningProvider(ctx contractapi.TransactionContextInterface, providerID, name, publicKeyPEM, mspID, clientEnrollmentID string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if providerID == "" || name == "" {
+		return fmt.Errorf("provider ID and name are required")
+	}
+	if mspID == "" || clientEnrollmentID == "" {
+		return fmt.Errorf("MSP ID and enrollment ID are required")
+	}
+	_, err = parsePublicKey(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	updatedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	provider := ScreeningProvider{
+		ProviderID:   providerID,
+		Name:         name,
+		PublicKey:    publicKeyPEM,
+		MSPID:        mspID,
+		EnrollmentID: clientEnrollmentID,
+		Active:       true,
+		UpdatedBy:    updatedBy,
+		UpdatedAt:    now,
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+	err = putScreeningProvider(ctx, &provider)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "SCREENING_PROVIDER_REGISTERED",
+		Details:   fmt.Sprintf("Screening provider %s (%s) registered for %s/%s", providerID, name, mspID, clientEnrollmentID),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// DeactivateScreeningProvider stops a screening provider from submitting
+// further results. The checks it has already written are kept. Only the
+// compliance admin may deactivate screening providers.
+func (c *Compliance) DeactivateScreeningProvider(ctx contractapi.TransactionContextInterface, providerID string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	provider, err := c.GetScreeningProvider(ctx, providerID)
+	if err != nil {
+		return err
+	}
+	if !provider.Active {
+		return fmt.Errorf("screening provider %s is already inactive", providerID)
+	}
+
+	updatedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	provider.Active = false
+	provider.UpdatedBy = updatedBy
+	provider.UpdatedAt = now
+	provider.TxID = ctx.GetStub().GetTxID()
+	err = putScreeningProvider(ctx, provider)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "SCREENING_PROVIDER_DEACTIVATED",
+		Details:   fmt.Sprintf("Screening provider %s deactivated", providerID),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetScreeningProvider returns a screening provider's registration
+func (c *Compliance) GetScreeningProvider(ctx contractapi.TransactionContextInterface, providerID string) (*ScreeningProvider, error) {
+	provider, err := getScreeningProvider(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("screening provider %s is not registered", providerID)
+	}
+	return provider, nil
+}
+
+// SubmitScreeningResult creates or updates an AML check from a screening
+// provider's result. payload is a ProviderScreeningResult JSON object and
+// signature the base64 signature of its SHA-256 digest made with the
+// provider's registered key: ASN.1 ECDSA or PKCS #1 v1.5 RSA. The caller
+// must hold the SCREENING_PROVIDER role and be the client registered for an
+// active provider. Each reference ID is accepted once, and results older
+// than the current check are rejected.
+func (c *Compliance) SubmitScreeningResult(ctx contractapi.TransactionContextInterface, providerID, payload, signature string) error {
+	err := requireRole(ctx, screeningProviderRole)
+	if err != nil {
+		return err
+	}
+
+	provider, err := c.GetScreeningProvider(ctx, providerID)
+	if err != nil {
+		return err
+	}
+	if !provider.Active {
+		return fmt.Errorf("screening provider %s is inactive", providerID)
+	}
+
+	submittedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	submittedByMSP, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if submittedBy != provider.EnrollmentID || submittedByMSP != provider.MSPID {
+		return fmt.Errorf("caller is not authorized: %s/%s is not registered for screening provider %s", submittedByMSP, submittedBy, providerID)
+	}
+
+	err = verifySignature(provider.PublicKey, []byte(payload), signature)
+	if err != nil {
+		return err
+	}
+
+	var result ProviderScreeningResult
+	err = json.Unmarshal([]byte(payload), &result)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal screening result: %v", err)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	if result.ProviderID != providerID {
+		return fmt.Errorf("screening result is from provider %s, not %s", result.ProviderID, providerID)
+	}
+	if result.ReferenceID == "" || result.Address == "" {
+		return fmt.Errorf("reference ID and address are required")
+	}
+	if !containsString([]string{"SANCTIONS", "PEP", "ADVERSE_MEDIA"}, result.CheckType) {
+		return fmt.Errorf("invalid check type: %s", result.CheckType)
+	}
+	if !containsString([]string{"PASSED", "FAILED", "PENDING"}, result.Status) {
+		return fmt.Errorf("invalid status: %s", result.Status)
+	}
+	if result.RiskScore < 0 || result.RiskScore > 100 {
+		return fmt.Errorf("risk score must be between 0 and 100")
+	}
+	if result.ScreenedAt.IsZero() || result.ScreenedAt.After(now) {
+		return fmt.Errorf("invalid screening time: %s", result.ScreenedAt.Format(time.RFC3339))
+	}
+	if result.ExpiryDate.IsZero() {
+		result.ExpiryDate = result.ScreenedAt.AddDate(0, 6, 0)
+	}
+	if !result.ExpiryDate.After(result.ScreenedAt) {
+		return fmt.Errorf("expiry date must be after the screening time")
+	}
+
+	submissionKey, err := ctx.GetStub().CreateCompositeKey(screeningSubmissionObjectType, []string{providerID, result.ReferenceID})
+	if err != nil {
+		return fmt.Errorf("failed to create screening submission key: %v", err)
+	}
+	existingJSON, err := ctx.GetStub().GetState(submissionKey)
+	if err != nil {
+		return fmt.Errorf("failed to read screening submission: %v", err)
+	}
+	if existingJSON != nil {
+		return fmt.Errorf("screening result %s from provider %s has already been submitted", result.ReferenceID, providerID)
+	}
+
+	amlCheck, err := getAMLCheck(ctx, result.Address, result.CheckType)
+	if err != nil {
+		return err
+	}
+	eventType := "AML_CHECK_UPDATED"
+	if amlCheck == nil {
+		eventType = "AML_CHECK_CREATED"
+		amlCheck = &AMLCheck{Address: result.Address, CheckType: result.CheckType}
+	} else if amlCheck.CheckDate.After(result.ScreenedAt) {
+		return fmt.Errorf("screening result %s is older than the current %s check of %s", result.ReferenceID, result.CheckType, result.Address)
+	}
+
+	payloadHash := sha256.Sum256([]byte(payload))
+	amlCheck.Status = result.Status
+	amlCheck.RiskScore = result.RiskScore
+	amlCheck.Details = result.Details
+	amlCheck.CheckDate = result.ScreenedAt
+	amlCheck.ExpiryDate = result.ExpiryDate
+	amlCheck.CheckedBy = providerID
+	amlCheck.CheckedByMSP = submittedByMSP
+	amlCheck.ProviderReference = result.ReferenceID
+	amlCheck.PayloadHash = hex.EncodeToString(payloadHash[:])
+
+	checkKey, err := amlKey(ctx, result.Address, result.CheckType)
+	if err != nil {
+		return err
+	}
+	checkJSON, err := json.Marshal(amlCheck)
+	if err != nil {
+		return fmt.Errorf("failed to marshal AML check: %v", err)
+	}
+	err = ctx.GetStub().PutState(checkKey, checkJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store AML check: %v", err)
+	}
+
+	submission := ScreeningSubmission{
+		ProviderID:  providerID,
+		ReferenceID: result.ReferenceID,
+		Payload:     payload,
+		Signature:   signature,
+		SubmittedBy: submittedBy,
+		SubmittedAt: now,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+	submissionJSON, err := json.Marshal(submission)
+	if err != nil {
+		return fmt.Errorf("failed to marshal screening submission: %v", err)
+	}
+	err = ctx.GetStub().PutState(submissionKey, submissionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store screening submission: %v", err)
+	}
+
+	scoreChange, err := c.refreshStoredRiskScore(ctx, result.Address, amlCheck)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      eventType,
+		Address:   result.Address,
+		Details:   fmt.Sprintf("AML check %s for %s by screening provider %s (ref %s)%s", result.CheckType, result.Address, providerID, result.ReferenceID, scoreChange.describe()),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		Outcome:        result.Status,
+		RiskScoreDelta: scoreChange,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// MigrationResult reports the progress of a state key migration
+type MigrationResult struct {
+	KYC           int    `json:"kyc"`
+	AMLChecks     int    `json:"amlChecks"`
+	TransferRules int    `json:"transferRules"`
+	Skipped       int    `json:"skipped"`
+	Bookmark      string `json:"bookmark"`
+}
+
+// MigrateStateKeys moves KYC records, AML checks and transfer rules stored
+// under the legacy flat keys ("address", "address_checkType" and
+// "TRANSFERRULES_bondID") to their composite keys. It processes up to
+// pageSize legacy records per call; keep calling with the returned
+// bookmark, the key to resume from, until it is empty.
+func (c *Compliance) MigrateStateKeys(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*MigrationResult, error) {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	// Paginated queries may not be used in transactions that write, so the
+	// page is cut from a plain range query. Composite keys are excluded from
+	// plain range queries, so this only sees records still stored under
+	// legacy keys.
+	resultsIterator, err := ctx.GetStub().GetStateByRange(bookmark, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state by range: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	result := &MigrationResult{}
+	var fetched int32
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+		if fetched == pageSize {
+			result.Bookmark = queryResult.Key
+			break
+		}
+		fetched++
+
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(queryResult.Value, &fields) != nil {
+			result.Skipped++
+			continue
+		}
+
+		// Records are told apart by their fields, not their keys, since an
+		// underscore in an address makes the legacy keys ambiguous
+		var newKey string
+		if _, isAMLCheck := fields["checkType"]; isAMLCheck {
+			var amlCheck AMLCheck
+			err = json.Unmarshal(queryResult.Value, &amlCheck)
+			if err != nil || queryResult.Key != amlCheck.Address+"_"+amlCheck.CheckType {
+				result.Skipped++
+				continue
+			}
+			newKey, err = amlKey(ctx, amlCheck.Address, amlCheck.CheckType)
+			result.AMLChecks++
+		} else if _, isRules := fields["bondId"]; isRules {
+			var rules TransferRules
+			err = json.Unmarshal(queryResult.Value, &rules)
+			if err != nil || queryResult.Key != "TRANSFERRULES_"+rules.BondID {
+				result.Skipped++
+				continue
+			}
+			newKey, err = transferRulesKey(ctx, rules.BondID, 0)
+			result.TransferRules++
+		} else if _, isKYC := fields["address"]; isKYC {
+			var kyc KYCRecord
+			err = json.Unmarshal(queryResult.Value, &kyc)
+			if err != nil || queryResult.Key != kyc.Address {
+				result.Skipped++
+				continue
+			}
+			newKey, err = kycKey(ctx, kyc.Address)
+			result.KYC++
+		} else {
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = ctx.GetStub().PutState(newKey, queryResult.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store migrated record: %v", err)
+		}
+		err = ctx.GetStub().DelState(queryResult.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete legacy record: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// ImportSanctionsEntries adds, updates or delists entries of the sanctions
+// list from source. entriesJSON is an array of SanctionsEntry objects; an
+// entry with removed set is delisted, and entries not in the array are left
+// as they are, so a full list or a delta can be imported. Returns the
+// number of entries written. Only the compliance admin may import entries.
+func (c *Compliance) ImportSanctionsEntries(ctx contractapi.TransactionContextInterface, source, entriesJSON string) (int, error) {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return 0, err
+	}
+
+	if source == "" {
+		return 0, fmt.Errorf("list source is required")
+	}
+
+	var entries []*SanctionsEntry
+	err = json.Unmarshal([]byte(entriesJSON), &entries)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshal sanctions entries: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if entry.ID == "" {
+			return 0, fmt.Errorf("sanctions entry without an ID")
+		}
+		hashes := append([]string{entry.NameHash}, entry.IdentifierHashes...)
+		for _, hash := range hashes {
+			if !isSHA256Hex(hash) {
+				return 0, fmt.Errorf("entry %s has an invalid hash: %s", entry.ID, hash)
+			}
+		}
+
+		entry.Source = source
+		entry.UpdatedAt = txTime
+		entry.TxID = ctx.GetStub().GetTxID()
+
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal sanctions entry: %v", err)
+		}
+
+		key, err := ctx.GetStub().CreateCompositeKey(sanctionObjectType, []string{source, entry.ID})
+		if err != nil {
+			return 0, fmt.Errorf("failed to create sanctions entry key: %v", err)
+		}
+		err = ctx.GetStub().PutState(key, entryJSON)
+		if err != nil {
+			return 0, fmt.Errorf("failed to store sanctions entry: %v", err)
+		}
+
+		// Index entries that a hash no longer belongs to are skipped at
+		// screening, when the entry itself is checked
+		for _, hash := range hashes {
+			indexKey, err := ctx.GetStub().CreateCompositeKey(sanctionHashIndex, []string{hash, source, entry.ID})
+			if err != nil {
+				return 0, fmt.Errorf("failed to create sanctions index key: %v", err)
+			}
+			err = ctx.GetStub().PutState(indexKey, []byte{0})
+			if err != nil {
+				return 0, fmt.Errorf("failed to store sanctions index: %v", err)
+			}
+		}
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "SANCTIONS_LIST_IMPORTED",
+		Details:   fmt.Sprintf("%d %s sanctions entries imported", len(entries), source),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return 0, fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return len(entries), nil
+}
+
+// GetSanctionsEntry returns an entry of the sanctions list from source
+func (c *Compliance) GetSanctionsEntry(ctx contractapi.TransactionContextInterface, source, entryID string) (*SanctionsEntry, error) {
+	entry, err := getSanctionsEntry(ctx, source, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%s sanctions entry %s does not exist", source, entryID)
+	}
+	return entry, nil
+}
+
+// ScreenAddress matches an investor's name and ID number from the
+// kyc-private collection against the sanctions list entries in effect. On a
+// hit it records a FAILED SANCTIONS AML check, which blocks the investor in
+// CheckCompliance and CheckTransfer. Only the compliance admin may screen,
+// on a peer of a kyc-private member organisation.
+func (c *Compliance) ScreenAddress(ctx contractapi.TransactionContextInterface, address string) (*ScreeningResult, error) {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return nil, err
+	}
+
+	piiJSON, err := ctx.GetStub().GetPrivateData(kycCollection, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read personal data: %v", err)
+	}
+	if piiJSON == nil {
+		return nil, fmt.Errorf("personal data for address %s does not exist", address)
+	}
+
+	var pii KYCPersonalData
+	err = json.Unmarshal(piiJSON, &pii)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal personal data: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScreeningResult{
+		Address:    address,
+		Matches:    []*SanctionsMatch{},
+		ScreenedAt: txTime,
+	}
+
+	candidates := map[string]string{screeningHash(pii.FullName): "NAME"}
+	if pii.IDNumber != "" {
+		candidates[screeningHash(pii.IDNumber)] = "IDENTIFIER"
+	}
+	for _, document := range pii.Documents {
+		candidates[screeningHash(document.Number)] = "IDENTIFIER"
+	}
+	for hash, matchedOn := range candidates {
+		matches, err := sanctionsMatches(ctx, hash, matchedOn, txTime)
+		if err != nil {
+			return nil, err
+		}
+		result.Matches = append(result.Matches, matches...)
+	}
+	sort.Slice(result.Matches, func(i, j int) bool {
+		if result.Matches[i].Source != result.Matches[j].Source {
+			return result.Matches[i].Source < result.Matches[j].Source
+		}
+		return result.Matches[i].EntryID < result.Matches[j].EntryID
+	})
+
+	result.Hit = len(result.Matches) > 0
+	if !result.Hit {
+		return result, nil
+	}
+
+	var entries []string
+	for _, match := range result.Matches {
+		entries = append(entries, fmt.Sprintf("%s %s (%s)", match.Source, match.EntryID, match.MatchedOn))
+	}
+
+	checkedByMSP, err := invokerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	amlCheck := AMLCheck{
+		Address:      address,
+		CheckType:    "SANCTIONS",
+		Status:       "FAILED",
+		RiskScore:    100,
+		CheckDate:    txTime,
+		ExpiryDate:   txTime.AddDate(0, 6, 0),
+		Details:      "Sanctions list match: " + strings.Join(entries, ", "),
+		CheckedBy:    "SANCTIONS_SCREENING",
+		CheckedByMSP: checkedByMSP,
+	}
+
+	checkJSON, err := json.Marshal(amlCheck)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal AML check: %v", err)
+	}
+
+	checkKey, err := amlKey(ctx, address, amlCheck.CheckType)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(checkKey, checkJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store AML check: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "SANCTIONS_HIT",
+		Address:   address,
+		Details:   amlCheck.Details,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		Outcome: amlCheck.Status,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return result, nil
+}
+
+// AddToBlacklist blocks an address from passing any compliance check
+// between effectiveFrom and effectiveTo (YYYY-MM-DD; an empty effectiveFrom
+// means now and an empty effectiveTo means indefinitely). Adding an address
+// already on the list replaces its reason and dates.
+func (c *Compliance) AddToBlacklist(ctx contractapi.TransactionContextInterface, address, reasonCode, reason, effectiveFromStr, effectiveToStr string) error {
+	return addToList(ctx, blacklistObjectType, address, reasonCode, reason, effectiveFromStr, effectiveToStr)
+}
+
+// RemoveFromBlacklist takes an address off the blacklist, keeping its entry
+// and history for audit
+func (c *Compliance) RemoveFromBlacklist(ctx contractapi.TransactionContextInterface, address, reason string) error {
+	return removeFromList(ctx, blacklistObjectType, address, reason)
+}
+
+// AddToWatchlist flags an address for review between effectiveFrom and
+// effectiveTo without blocking it. Dates are as for AddToBlacklist.
+func (c *Compliance) AddToWatchlist(ctx contractapi.TransactionContextInterface, address, reasonCode, reason, effectiveFromStr, effectiveToStr string) error {
+	return addToList(ctx, watchlistObjectType, address, reasonCode, reason, effectiveFromStr, effectiveToStr)
+}
+
+// RemoveFromWatchlist takes an address off the watchlist, keeping its entry
+// and history for audit
+func (c *Compliance) RemoveFromWatchlist(ctx contractapi.TransactionContextInterface, address, reason string) error {
+	return removeFromList(ctx, watchlistObjectType, address, reason)
+}
+
+// GetBlacklistEntry returns an address's blacklist entry and its history
+func (c *Compliance) GetBlacklistEntry(ctx contractapi.TransactionContextInterface, address string) (*ListEntry, error) {
+	return getListEntryOrFail(ctx, blacklistObjectType, address)
+}
+
+// GetWatchlistEntry returns an address's watchlist entry and its history
+func (c *Compliance) GetWatchlistEntry(ctx contractapi.TransactionContextInterface, address string) (*ListEntry, error) {
+	return getListEntryOrFail(ctx, watchlistObjectType, address)
+}
+
+// PlaceHold stops an address from transferring its tokens of a bond, or of
+// every bond when bondID is empty, and returns the hold's ID. Besides
+// recording the hold, it invokes the BondToken contract to hold the
+// address's current holdings there; CheckTransfer also denies transfers
+// from the address while the hold is active, covering holdings it acquires
+// later. Only compliance officers and the compliance admin may place holds.
+func (c *Compliance) PlaceHold(ctx contractapi.TransactionContextInterface, address, bondID, reason string) (string, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return "", err
+	}
+
+	if address == "" {
+		return "", fmt.Errorf("address is required")
+	}
+	if reason == "" {
+		return "", fmt.Errorf("hold reason is required")
+	}
+
+	holds, err := getHolds(ctx, address)
+	if err != nil {
+		return "", err
+	}
+	for _, hold := range holds {
+		if hold.Status == "ACTIVE" && hold.BondID == bondID {
+			return "", fmt.Errorf("%s is already under hold %s", address, hold.ID)
+		}
+	}
+
+	placedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return "", err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	hold := &ComplianceHold{
+		ID:       "HOLD_" + ctx.GetStub().GetTxID(),
+		Address:  address,
+		BondID:   bondID,
+		Reason:   reason,
+		Status:   "ACTIVE",
+		PlacedBy: placedBy,
+		PlacedAt: now,
+		TxID:     ctx.GetStub().GetTxID(),
+	}
+
+	hold.Holdings, err = invokeComplianceHold(ctx, "PlaceComplianceHold", hold)
+	if err != nil {
+		return "", err
+	}
+
+	err = putHolds(ctx, address, append(holds, hold))
+	if err != nil {
+		return "", err
+	}
+
+	scope := "all bonds"
+	if bondID != "" {
+		scope = "bond " + bondID
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "HOLD_PLACED",
+		Address:   address,
+		Details:   fmt.Sprintf("Hold %s placed on %s for %s (%d holdings): %s", hold.ID, address, scope, hold.Holdings, reason),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		BondID:  bondID,
+		Outcome: hold.Status,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return hold.ID, nil
+}
+
+// ReleaseHold releases an active hold placed by PlaceHold, removing it from
+// the address's holdings in the BondToken contract. Other holds on the
+// address, and registrar freezes, stay in force. Only compliance officers
+// and the compliance admin may release holds.
+func (c *Compliance) ReleaseHold(ctx contractapi.TransactionContextInterface, address, holdID, reason string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("release reason is required")
+	}
+
+	holds, err := getHolds(ctx, address)
+	if err != nil {
+		return err
+	}
+	var hold *ComplianceHold
+	for _, h := range holds {
+		if h.ID == holdID {
+			hold = h
+		}
+	}
+	if hold == nil {
+		return fmt.Errorf("hold %s on %s does not exist", holdID, address)
+	}
+	if hold.Status != "ACTIVE" {
+		return fmt.Errorf("hold %s is already %s", holdID, hold.Status)
+	}
+
+	releasedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	released, err := invokeComplianceHold(ctx, "ReleaseComplianceHold", hold)
+	if err != nil {
+		return err
+	}
+
+	hold.Status = "RELEASED"
+	hold.ReleasedBy = releasedBy
+	hold.ReleasedAt = now
+	hold.ReleaseReason = reason
+	err = putHolds(ctx, address, holds)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "HOLD_RELEASED",
+		Address:   address,
+		Details:   fmt.Sprintf("Hold %s on %s released (%d holdings): %s", holdID, address, released, reason),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		BondID:  hold.BondID,
+		Outcome: hold.Status,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetHolds returns the active and released holds placed on an address
+func (c *Compliance) GetHolds(ctx contractapi.TransactionContextInterface, address string) ([]*ComplianceHold, error) {
+	return getHolds(ctx, address)
+}
+
+// CreateExemption requests an exemption of an address from the
+// CheckTransfer rule denying transfers with reasonCode, for bondID or every
+// bond when it is empty, until expiryDate (YYYY-MM-DD), and returns its ID.
+// It takes effect once approver, a compliance admin other than the caller,
+// approves it with ApproveExemption. KYC, AML, blacklist and hold denials
+// cannot be exempted. Only compliance officers and the compliance admin may
+// request exemptions.
+func (c *Compliance) CreateExemption(ctx contractapi.TransactionContextInterface, address, reasonCode, bondID, expiryDate, approver, reason string) (string, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return "", err
+	}
+
+	if address == "" {
+		return "", fmt.Errorf("address is required")
+	}
+	if !containsString(exemptableReasonCodes, reasonCode) {
+		return "", fmt.Errorf("reason code %s cannot be exempted", reasonCode)
+	}
+	if reason == "" {
+		return "", fmt.Errorf("exemption reason is required")
+	}
+
+	createdBy, err := enrollmentID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if approver == "" || approver == createdBy {
+		return "", fmt.Errorf("exemption must be approved by someone other than %s", createdBy)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	expiresAt, err := time.Parse("2006-01-02", expiryDate)
+	if err != nil {
+		return "", fmt.Errorf("invalid expiry date: %v", err)
+	}
+	if !expiresAt.After(now) {
+		return "", fmt.Errorf("expiry date must be in the future")
+	}
+
+	exemptions, err := getExemptions(ctx, address)
+	if err != nil {
+		return "", err
+	}
+
+	exemption := &Exemption{
+		ID:         "EXM_" + ctx.GetStub().GetTxID(),
+		Address:    address,
+		ReasonCode: reasonCode,
+		BondID:     bondID,
+		Reason:     reason,
+		ExpiresAt:  expiresAt,
+		Status:     "PENDING",
+		CreatedBy:  createdBy,
+		CreatedAt:  now,
+		Approver:   approver,
+		TxID:       ctx.GetStub().GetTxID(),
+	}
+	err = putExemptions(ctx, address, append(exemptions, exemption))
+	if err != nil {
+		return "", err
+	}
+
+	err = emitExemptionEvent(ctx, "EXEMPTION_REQUESTED", exemption, fmt.Sprintf("pending approval by %s", approver), now)
+	if err != nil {
+		return "", err
+	}
+
+	return exemption.ID, nil
+}
+
+// ApproveExemption approves a pending exemption. Only the compliance admin
+// designated as its approver may approve it.
+func (c *Compliance) ApproveExemption(ctx contractapi.TransactionContextInterface, address, exemptionID string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	exemptions, err := getExemptions(ctx, address)
+	if err != nil {
+		return err
+	}
+	exemption, err := findExemption(exemptions, address, exemptionID)
+	if err != nil {
+		return err
+	}
+	if exemption.Status != "PENDING" {
+		return fmt.Errorf("exemption %s is %s", exemptionID, exemption.Status)
+	}
+
+	approvedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	if approvedBy != exemption.Approver {
+		return fmt.Errorf("caller is not authorized: exemption %s must be approved by %s", exemptionID, exemption.Approver)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if !exemption.ExpiresAt.After(now) {
+		return fmt.Errorf("exemption %s expired on %s", exemptionID, exemption.ExpiresAt.Format("2006-01-02"))
+	}
+
+	exemption.Status = "APPROVED"
+	exemption.ApprovedAt = now
+	err = putExemptions(ctx, address, exemptions)
+	if err != nil {
+		return err
+	}
+
+	return emitExemptionEvent(ctx, "EXEMPTION_APPROVED", exemption, "approved by "+approvedBy, now)
+}
+
+// RevokeExemption withdraws a pending or approved exemption, keeping it for
+// audit. Only compliance officers and the compliance admin may revoke
+// exemptions.
+func (c *Compliance) RevokeExemption(ctx contractapi.TransactionContextInterface, address, exemptionID, reason string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("revocation reason is required")
+	}
+
+	exemptions, err := getExemptions(ctx, address)
+	if err != nil {
+		return err
+	}
+	exemption, err := findExemption(exemptions, address, exemptionID)
+	if err != nil {
+		return err
+	}
+	if exemption.Status == "REVOKED" {
+		return fmt.Errorf("exemption %s is already revoked", exemptionID)
+	}
+
+	revokedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	exemption.Status = "REVOKED"
+	exemption.RevokedBy = revokedBy
+	exemption.RevokedAt = now
+	exemption.RevocationReason = reason
+	err = putExemptions(ctx, address, exemptions)
+	if err != nil {
+		return err
+	}
+
+	return emitExemptionEvent(ctx, "EXEMPTION_REVOKED", exemption, reason, now)
+}
+
+// GetExemptions returns every exemption requested for an address, whatever
+// its status
+func (c *Compliance) GetExemptions(ctx contractapi.TransactionContextInterface, address string) ([]*Exemption, error) {
+	return getExemptions(ctx, address)
+}
+
+// FileSAR records a suspicious activity report as a DRAFT and returns its
+// ID. The report's address, txRefs, narrative and severity are passed as a
+// JSON object under the "sar" transient key, and no event is emitted, so
+// nothing about it reaches the channel ledger. Restricted to compliance
+// officers on a peer of a sar-private member organisation.
+func (c *Compliance) FileSAR(ctx contractapi.TransactionContextInterface) (string, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return "", err
+	}
+	err = requireCollectionMember(ctx, sarCollection)
+	if err != nil {
+		return "", err
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transient data: %v", err)
+	}
+	sarJSON, ok := transient[sarTransientKey]
+	if !ok {
+		return "", fmt.Errorf("report must be passed in the %q transient key", sarTransientKey)
+	}
+
+	var report SuspiciousActivityReport
+	err = json.Unmarshal(sarJSON, &report)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal report: %v", err)
+	}
+	if report.Address == "" || report.Narrative == "" {
+		return "", fmt.Errorf("report must include an address and a narrative")
+	}
+	switch report.Severity {
+	case "LOW", "MEDIUM", "HIGH", "CRITICAL":
+	default:
+		return "", fmt.Errorf("invalid severity: %s", report.Severity)
+	}
+
+	createdBy, err := enrollmentID(ctx)
+	if err != nil {
+		return "", err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sar := SuspiciousActivityReport{
+		ID:        "SAR_" + ctx.GetStub().GetTxID(),
+		Address:   report.Address,
+		TxRefs:    report.TxRefs,
+		Narrative: report.Narrative,
+		Severity:  report.Severity,
+		Status:    "DRAFT",
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+	if sar.TxRefs == nil {
+		sar.TxRefs = []string{}
+	}
+
+	err = putSAR(ctx, &sar)
+	if err != nil {
+		return "", err
+	}
+
+	return sar.ID, nil
+}
+
+// SubmitSAR files a DRAFT suspicious activity report with the regulator.
+// Restricted to compliance officers.
+func (c *Compliance) SubmitSAR(ctx contractapi.TransactionContextInterface, sarID string) error {
+	return setSARStatus(ctx, sarID, "DRAFT", "FILED")
+}
+
+// CloseSAR closes a FILED suspicious activity report. Restricted to
+// compliance officers.
+func (c *Compliance) CloseSAR(ctx contractapi.TransactionContextInterface, sarID string) error {
+	return setSARStatus(ctx, sarID, "FILED", "CLOSED")
+}
+
+// GetSAR returns a suspicious activity report. Compliance officers and
+// regulators may read reports, on a peer of a sar-private member
+// organisation.
+func (c *Compliance) GetSAR(ctx contractapi.TransactionContextInterface, sarID string) (*SuspiciousActivityReport, error) {
+	err := requireSARReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return getSAR(ctx, sarID)
+}
+
+// QuerySARs returns the suspicious activity reports about an address with
+// the given status; an empty address or status matches any. Compliance
+// officers and regulators may query reports, on a peer of a sar-private
+// member organisation.
+func (c *Compliance) QuerySARs(ctx contractapi.TransactionContextInterface, address, status string) ([]*SuspiciousActivityReport, error) {
+	err := requireSARReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(sarCollection, sarObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reports: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	sars := []*SuspiciousActivityReport{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var sar SuspiciousActivityReport
+		err = json.Unmarshal(queryResult.Value, &sar)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal report: %v", err)
+		}
+		if (address == "" || sar.Address == address) && (status == "" || sar.Status == status) {
+			sars = append(sars, &sar)
+		}
+	}
+
+	return sars, nil
+}
+
+// ComputeRiskScore recomputes an investor's aggregate risk score from its
+// KYC risk level, AML check scores, jurisdiction risk and recent trading,
+// stores it with its factor breakdown on the KYC record and emits a
+// RiskScoreChanged event if the score changed. Only compliance officers
+// and the compliance admin may recompute scores.
+func (c *Compliance) ComputeRiskScore(ctx contractapi.TransactionContextInterface, address string) (*RiskScore, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return nil, err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	previous := kyc.RiskScore
+	scoreChange, err := refreshRiskScore(ctx, kyc, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	if scoreChange == nil {
+		return kyc.RiskScore, nil
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "RISK_SCORE_CHANGED",
+		Address:   address,
+		Details:   fmt.Sprintf("Risk score of %s changed from %s to %d", address, formatRiskScore(previous), kyc.RiskScore.Score),
+		Timestamp: kyc.RiskScore.ScoredAt,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		RiskScoreDelta: scoreChange,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("RiskScoreChanged", eventJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return kyc.RiskScore, nil
+}
+
+// SetCountryRisk creates or replaces the risk rating of a country from a
+// CountryRisk JSON object. Investors in PROHIBITED countries, or ones FATF
+// has called for action on, cannot receive bonds. Existing risk scores pick
+// the rating up the next time they are recomputed. Only the compliance
+// admin may rate countries.
+func (c *Compliance) SetCountryRisk(ctx contractapi.TransactionContextInterface, country string, riskJSON string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if !isCountryCode(country) {
+		return fmt.Errorf("invalid country: %s", country)
+	}
+
+	var risk CountryRisk
+	err = json.Unmarshal([]byte(riskJSON), &risk)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal country risk: %v", err)
+	}
+	if _, ok := countryRiskScores[risk.RiskTier]; !ok {
+		return fmt.Errorf("invalid risk tier: %s", risk.RiskTier)
+	}
+	if risk.FATFStatus == "" {
+		risk.FATFStatus = "NONE"
+	}
+	if _, ok := fatfRiskScores[risk.FATFStatus]; !ok {
+		return fmt.Errorf("invalid FATF status: %s", risk.FATFStatus)
+	}
+	for _, regime := range risk.SanctionsRegimes {
+		if regime == "" {
+			return fmt.Errorf("sanctions regime cannot be empty")
+		}
+	}
+
+	updatedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	risk.Country = country
+	risk.UpdatedBy = updatedBy
+	risk.UpdatedAt = now
+	risk.TxID = ctx.GetStub().GetTxID()
+
+	storedJSON, err := json.Marshal(risk)
+	if err != nil {
+		return fmt.Errorf("failed to marshal country risk: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(countryRiskObjectType, []string{country})
+	if err != nil {
+		return fmt.Errorf("failed to create country risk key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, storedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store country risk: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "COUNTRY_RISK_SET",
+		Details:   fmt.Sprintf("%s rated %s, FATF status %s", country, risk.RiskTier, risk.FATFStatus),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetCountryRisk returns the risk rating of a country
+func (c *Compliance) GetCountryRisk(ctx contractapi.TransactionContextInterface, country string) (*CountryRisk, error) {
+	risk, err := getCountryRisk(ctx, country)
+	if err != nil {
+		return nil, err
+	}
+	if risk == nil {
+		return nil, fmt.Errorf("country %s is not rated", country)
+	}
+	return risk, nil
+}
+
+// GetAllCountryRisks returns the risk ratings of all rated countries
+func (c *Compliance) GetAllCountryRisks(ctx contractapi.TransactionContextInterface) ([]*CountryRisk, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(countryRiskObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get country risks: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var risks []*CountryRisk
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var risk CountryRisk
+		err = json.Unmarshal(queryResult.Value, &risk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal country risk: %v", err)
+		}
+		risks = append(risks, &risk)
+	}
+
+	return risks, nil
+}
+
+// DeleteCountryRisk removes the risk rating of a country, which then counts
+// as no risk. Only the compliance admin may rate countries.
+func (c *Compliance) DeleteCountryRisk(ctx contractapi.TransactionContextInterface, country string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	risk, err := getCountryRisk(ctx, country)
+	if err != nil {
+		return err
+	}
+	if risk == nil {
+		return fmt.Errorf("country %s is not rated", country)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(countryRiskObjectType, []string{country})
+	if err != nil {
+		return fmt.Errorf("failed to create country risk key: %v", err)
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete country risk: %v", err)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "COUNTRY_RISK_DELETED",
+		Details:   fmt.Sprintf("Risk rating of %s removed", country),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// IssueAttestation attests that an address passes a compliance scope until
+// expiryDate (YYYY-MM-DD): KYC for an approved KYC record, AML for passed,
+// unexpired sanctions and PEP checks, or FULL for CheckCompliance.
+// The address must pass the scope now. Returns the attestation ID. Only
+// compliance officers and the compliance admin may issue attestations.
+func (c *Compliance) IssueAttestation(ctx contractapi.TransactionContextInterface, address, scope, expiryDate string) (string, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return "", err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	expiresAt, err := time.Parse("2006-01-02", expiryDate)
+	if err != nil {
+		return "", fmt.Errorf("invalid expiry date: %v", err)
+	}
+	if !expiresAt.After(now) {
+		return "", fmt.Errorf("expiry date must be in the future")
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return "", fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	switch scope {
+	case "KYC":
+		if kyc.Status != "APPROVED" {
+			return "", fmt.Errorf("cannot attest KYC of %s: KYC status is %s", address, kyc.Status)
+		}
+	case "AML":
+		for _, checkType := range requiredAMLChecks {
+			amlCheck, err := getAMLCheck(ctx, address, checkType)
+			if err != nil {
+				return "", err
+			}
+			if amlCheck == nil || amlCheck.expired(now) || amlCheck.Status != "PASSED" {
+				return "", fmt.Errorf("cannot attest AML of %s: no current passed %s check", address, checkType)
+			}
+		}
+	case "FULL":
+		compliant, reason, err := c.CheckCompliance(ctx, address)
+		if err != nil {
+			return "", err
+		}
+		if !compliant {
+			return "", fmt.Errorf("cannot attest compliance of %s: %s", address, reason)
+		}
+	default:
+		return "", fmt.Errorf("invalid attestation scope: %s", scope)
+	}
+
+	issuedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return "", err
+	}
+	issuerMSP, err := invokerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	attestation := &Attestation{
+		ID:        "ATT_" + ctx.GetStub().GetTxID(),
+		Address:   address,
+		Scope:     scope,
+		RiskLevel: kyc.RiskLevel,
+		IssuedBy:  issuedBy,
+		IssuerMSP: issuerMSP,
+		IssuedAt:  now,
+		ExpiresAt: expiresAt,
+	}
+	attestation.Hash, err = attestationHash(attestation)
+	if err != nil {
+		return "", err
+	}
+
+	err = putAttestation(ctx, attestation)
+	if err != nil {
+		return "", err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "ATTESTATION_ISSUED",
+		Address:   address,
+		Details:   fmt.Sprintf("%s attestation %s issued until %s", scope, attestation.ID, expiryDate),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return attestation.ID, nil
+}
+
+// RevokeAttestation withdraws an attestation before it expires. Only
+// compliance officers and the compliance admin may revoke attestations.
+func (c *Compliance) RevokeAttestation(ctx contractapi.TransactionContextInterface, attestationID, reason string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	attestation, err := getAttestation(ctx, attestationID)
+	if err != nil {
+		return err
+	}
+	if attestation == nil {
+		return fmt.Errorf("attestation %s does not exist", attestationID)
+	}
+	if attestation.Revoked {
+		return fmt.Errorf("attestation %s is already revoked", attestationID)
+	}
+
+	revokedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	attestation.Revoked = true
+	attestation.RevokedBy = revokedBy
+	attestation.RevokedAt = now
+	attestation.RevocationReason = reason
+
+	err = putAttestation(ctx, attestation)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "ATTESTATION_REVOKED",
+		Address:   attestation.Address,
+		Details:   fmt.Sprintf("Attestation %s revoked: %s", attestationID, reason),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// VerifyAttestation checks an attestation is on the ledger, unchanged,
+// unexpired and not revoked, and that the KYC record it is based on is
+// still approved. hash, if given, must match the attestation's hash, so a
+// relying party can check its own copy. Other chaincodes, including ones on
+// other channels, can call it with InvokeChaincode.
+func (c *Compliance) VerifyAttestation(ctx contractapi.TransactionContextInterface, attestationID, hash string) (*AttestationVerification, error) {
+	result := &AttestationVerification{AttestationID: attestationID}
+
+	attestation, err := getAttestation(ctx, attestationID)
+	if err != nil {
+		return nil, err
+	}
+	if attestation == nil {
+		result.Reason = "attestation does not exist"
+		return result, nil
+	}
+	result.Attestation = attestation
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := attestationHash(attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	kyc, err := c.GetKYC(ctx, attestation.Address)
+	if err != nil {
+		kyc = &KYCRecord{Status: "NOT_FOUND"}
+	}
+
+	switch {
+	case attestation.Hash != expected:
+		result.Reason = "attestation does not match its hash"
+	case hash != "" && !strings.EqualFold(hash, attestation.Hash):
+		result.Reason = "hash does not match the attestation"
+	case attestation.Revoked:
+		result.Reason = "attestation was revoked: " + attestation.RevocationReason
+	case !now.Before(attestation.ExpiresAt):
+		result.Reason = "attestation expired on " + attestation.ExpiresAt.Format("2006-01-02")
+	case kyc.Status != "APPROVED":
+		result.Reason = "KYC status is " + kyc.Status
+	default:
+		result.Valid = true
+	}
+
+	return result, nil
+}
+
+// CheckCompliance checks if an address is compliant. A watchlisted address
+// is compliant, with the watchlist reason in the message; one with an
+// expired sanctions or PEP check is not until it is re-screened.
+func (c *Compliance) CheckCompliance(ctx contractapi.TransactionContextInterface, address string) (bool, string, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return false, "", err
+	}
+
+	blacklisted, err := getListEntry(ctx, blacklistObjectType, address)
+	if err != nil {
+		return false, "", err
+	}
+	if blacklisted.inEffect(now) {
+		return false, fmt.Sprintf("Blacklisted: %s", blacklisted.ReasonCode), nil
+	}
+
+	// Check KYC status
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return false, "KYC record not found", nil
+	}
+
+	if kyc.Status != "APPROVED" {
+		return false, fmt.Sprintf("KYC status: %s", kyc.Status), nil
+	}
+
+	if owner := failedBeneficialOwner(kyc); owner != nil {
+		return false, fmt.Sprintf("Beneficial owner %s (%.2f%%) failed screening", owner.UBOID, owner.OwnershipPercent), nil
+	}
+
+	if identityDocumentsExpired(kyc, now) {
+		return false, "Identity documents expired, new document required", nil
+	}
+
+	// Check AML status. An expired check must be re-screened before the
+	// address is compliant again.
+	sanctionsCheck, err := c.GetAMLCheck(ctx, address, "SANCTIONS")
+	if err == nil && sanctionsCheck.expired(now) {
+		return false, "Sanctions check expired, re-screening required", nil
+	}
+	if err == nil && sanctionsCheck.Status == "FAILED" {
+		return false, "Sanctions check failed", nil
+	}
+
+	pepCheck, err := c.GetAMLCheck(ctx, address, "PEP")
+	if err == nil && pepCheck.expired(now) {
+		return false, "PEP check expired, re-screening required", nil
+	}
+	if err == nil && pepCheck.Status == "FAILED" {
+		return false, "PEP check failed", nil
+	}
+
+	watchlisted, err := getListEntry(ctx, watchlistObjectType, address)
+	if err != nil {
+		return false, "", err
+	}
+	if watchlisted.inEffect(now) {
+		return true, fmt.Sprintf("Compliant (watchlisted: %s)", watchlisted.ReasonCode), nil
+	}
+
+	return true, "Compliant", nil
+}
+
+// CheckTransfer decides whether quantity tokens of bondID may move from one
+// address to another. Both parties must have an approved KYC record, no
+// failed or expired sanctions, PEP or adverse media check, no beneficial
+// owner of more than 25 percent who failed screening, a jurisdiction the
+// bond does not block, an investor class the bond is offered to there and a
+// risk level within the bond's limit, the receiver must have accepted the
+// documents the bond requires consent to and hold a current accreditation
+// if the bond requires one, and the quantity must be within the bond's
+// transfer limit, each party's KYC tier limit, its holding and daily volume
+// limits and the velocity rules. The sender must not be under a compliance
+// hold covering the bond. A party's denials that one of its
+// approved exemptions covers are waived and reported as exempted. The
+// decision is only returned: nothing is recorded, so anyone may ask, and
+// the BondToken contract's CanTransfer does. It passes an empty address for
+// a party that is not checked, such as the issuer.
+func (c *Compliance) CheckTransfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64) (*TransferDecision, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	decision, _, err := c.decideTransfer(ctx, from, to, bondID, quantity, now, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decision, nil
+}
+
+// RecordTransfer makes CheckTransfer's decision on a transfer that is
+// taking place and records it. Allowed transfers are counted towards the
+// parties' limit utilization and denied ones are recorded for regulatory
+// reporting. Every decision is emitted with the rules evaluated, as a
+// LimitBreached event for a transfer denied for breaching a limit and a
+// TransferDecision event otherwise. It may only be reached from a
+// transaction that moves tokens, the BondToken contract's Transfer or the
+// Settlement contract's SettleTrade, so a client cannot run up another
+// investor's limits by calling it directly.
+func (c *Compliance) RecordTransfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64) (*TransferDecision, error) {
+	err := requireTransferPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	decision, usages, err := c.decideTransfer(ctx, from, to, bondID, quantity, now, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = emitTransferDecision(ctx, decision, now)
+	if err != nil {
+		return nil, err
+	}
+	if !decision.Allowed {
+		err = putBlockedTransfer(ctx, decision, now)
+		if err != nil {
+			return nil, err
+		}
+		return decision, nil
+	}
+
+	for _, usage := range usages {
+		err = putLimitUtilization(ctx, usage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return decision, nil
+}
+
+// SimulateCheckTransfer returns the decision CheckTransfer would make on a
+// transfer, with the rules it would evaluate, without emitting an event or
+// counting the transfer towards any limit. scenarioJSON, if not empty, is a
+// TransferScenario of hypothetical KYC and limit changes and a time to
+// decide at, which are applied to the ledger state for the simulation
+// only. Only compliance officers and the compliance admin may run
+// simulations.
+func (c *Compliance) SimulateCheckTransfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64, scenarioJSON string) (*TransferDecision, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var scenario TransferScenario
+	if scenarioJSON != "" {
+		err = json.Unmarshal([]byte(scenarioJSON), &scenario)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal scenario: %v", err)
+		}
+	}
+	err = scenario.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	now := scenario.At
+	if now.IsZero() {
+		now, err = txTimestamp(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decision, _, err := c.decideTransfer(ctx, from, to, bondID, quantity, now, &scenario)
+	if err != nil {
+		return nil, err
+	}
+
+	return decision, nil
+}
+
+// SetLimit sets the most an investor may hold and trade in any 24 hours in
+// a bond, or across all bonds when bondID is GLOBAL. 0 disables either
+// limit. Only the compliance admin may set limits.
+func (c *Compliance) SetLimit(ctx contractapi.TransactionContextInterface, address, bondID string, maxHolding, maxDailyVolume int64) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if address == "" || bondID == "" {
+		return fmt.Errorf("address and bond ID are required")
+	}
+	if maxHolding < 0 || maxDailyVolume < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	limit := InvestorLimit{
+		Address:        address,
+		BondID:         bondID,
+		MaxHolding:     maxHolding,
+		MaxDailyVolume: maxDailyVolume,
+		UpdatedAt:      txTime,
+		TxID:           ctx.GetStub().GetTxID(),
+	}
+
+	limitJSON, err := json.Marshal(limit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal limit: %v", err)
+	}
+
+	key, err := limitKey(ctx, limitObjectType, address, bondID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, limitJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store limit: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "LIMIT_SET",
+		Address:   address,
+		Details:   fmt.Sprintf("Limits for %s set to holding %d, daily volume %d", bondID, maxHolding, maxDailyVolume),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TransferRulesEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetLimit returns an investor's limits in a bond, or across all bonds when
+// bondID is GLOBAL. An investor without limits gets a record of zeroes.
+func (c *Compliance) GetLimit(ctx contractapi.TransactionContextInterface, address, bondID string) (*InvestorLimit, error) {
+	limit, err := getInvestorLimit(ctx, address, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if limit == nil {
+		return &InvestorLimit{Address: address, BondID: bondID}, nil
+	}
+	return limit, nil
+}
+
+// GetLimitUtilization returns what an investor has used of its limits in a
+// bond, or across all bonds when bondID is GLOBAL
+func (c *Compliance) GetLimitUtilization(ctx contractapi.TransactionContextInterface, address, bondID string) (*LimitUtilization, error) {
+	return getLimitUtilization(ctx, address, bondID)
+}
+
+// SetVelocityRules replaces the velocity rules from a JSON array of
+// VelocityRule objects; an empty array removes them. CheckTransfer denies a
+// transfer that would take either party past a rule's transfer count or
+// value within its window, counting the transfers RecordTransfer has
+// allowed, and RecordTransfer reports the breach as a LimitBreached event. Only the compliance admin
+// may set velocity rules.
+func (c *Compliance) SetVelocityRules(ctx contractapi.TransactionContextInterface, rulesJSON string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	var rules []*VelocityRule
+	err = json.Unmarshal([]byte(rulesJSON), &rules)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal velocity rules: %v", err)
+	}
+
+	ids := map[string]bool{}
+	for _, rule := range rules {
+		if rule == nil || rule.ID == "" {
+			return fmt.Errorf("velocity rule ID is required")
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("duplicate velocity rule: %s", rule.ID)
+		}
+		ids[rule.ID] = true
+
+		if rule.WindowHours < 1 || time.Duration(rule.WindowHours)*time.Hour > limitWindow {
+			return fmt.Errorf("window of velocity rule %s must be between 1 and 24 hours", rule.ID)
+		}
+		if rule.MaxTransfers < 0 || rule.MaxValue < 0 {
+			return fmt.Errorf("limits of velocity rule %s cannot be negative", rule.ID)
+		}
+		if rule.MaxTransfers == 0 && rule.MaxValue == 0 {
+			return fmt.Errorf("velocity rule %s sets no limit", rule.ID)
+		}
+	}
+
+	updatedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	velocity := VelocityRules{
+		Rules:     rules,
+		UpdatedBy: updatedBy,
+		UpdatedAt: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	velocityJSON, err := json.Marshal(velocity)
+	if err != nil {
+		return fmt.Errorf("failed to marshal velocity rules: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(velocityRulesObjectType, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to create velocity rules key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, velocityJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store velocity rules: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "VELOCITY_RULES_SET",
+		Details:   fmt.Sprintf("%d velocity rules set", len(rules)),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TransferRulesEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetVelocityRules returns the velocity rules transfers are checked against
+func (c *Compliance) GetVelocityRules(ctx contractapi.TransactionContextInterface) (*VelocityRules, error) {
+	velocity, err := getVelocityRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if velocity == nil {
+		return &VelocityRules{Rules: []*VelocityRule{}}, nil
+	}
+	return velocity, nil
+}
+
+// SetTransferRules stores a new version of the transfer restrictions of a
+// bond. rulesJSON is a TransferRules object; its BondID and Version are
+// ignored. effectiveFrom, if given, must not be in the past, and rules
+// without it take effect immediately. Only the compliance admin may set
+// them.
+func (c *Compliance) SetTransferRules(ctx contractapi.TransactionContextInterface, bondID, rulesJSON string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	var rules TransferRules
+	err = json.Unmarshal([]byte(rulesJSON), &rules)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal transfer rules: %v", err)
+	}
+
+	err = rules.validate()
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if rules.EffectiveFrom.IsZero() {
+		rules.EffectiveFrom = now
+	}
+	if rules.EffectiveFrom.Before(now) {
+		return fmt.Errorf("transfer rules cannot take effect in the past")
+	}
+	if !rules.EffectiveTo.IsZero() && !rules.EffectiveTo.After(rules.EffectiveFrom) {
+		return fmt.Errorf("effectiveTo must be after effectiveFrom")
+	}
+
+	versions, err := transferRulesVersions(ctx, bondID)
+	if err != nil {
+		return err
+	}
+
+	rules.BondID = bondID
+	rules.Version = 1
+	if len(versions) > 0 {
+		rules.Version = versions[len(versions)-1].Version + 1
+	}
+	rules.UpdatedAt = now
+	rules.TxID = ctx.GetStub().GetTxID()
+
+	rulesBytes, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transfer rules: %v", err)
+	}
+
+	key, err := transferRulesKey(ctx, bondID, rules.Version)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(key, rulesBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store transfer rules: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "TRANSFER_RULES_SET",
+		Details:   fmt.Sprintf("Transfer rules version %d set for bond %s, effective from %s", rules.Version, bondID, rules.EffectiveFrom.Format(time.RFC3339)),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TransferRulesEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// SetOrgPolicy stores the calling organisation's own transfer restrictions
+// for a bond, or for all bonds if bondID is empty, replacing any it had.
+// policyJSON is an OrgPolicy object; its MSPID and Scope are ignored. The
+// policy is layered on the bond's transfer rules in CheckTransfer for
+// transfers the organisation's clients submit, keeping the stricter of each
+// restriction. Only a compliance admin of the organisation may set it.
+func (c *Compliance) SetOrgPolicy(ctx contractapi.TransactionContextInterface, bondID, policyJSON string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	var policy OrgPolicy
+	err = json.Unmarshal([]byte(policyJSON), &policy)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal organisation policy: %v", err)
+	}
+
+	err = policy.transferRules().validate()
+	if err != nil {
+		return err
+	}
+
+	policy.MSPID, err = invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	policy.Scope = bondID
+	if policy.Scope == "" {
+		policy.Scope = globalLimitScope
+	}
+	policy.UpdatedBy, err = enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	policy.UpdatedAt, err = txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	policy.TxID = ctx.GetStub().GetTxID()
+
+	policyJSONBytes, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal organisation policy: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(orgPolicyObjectType, []string{policy.MSPID, policy.Scope})
+	if err != nil {
+		return fmt.Errorf("failed to create organisation policy key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, policyJSONBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store organisation policy: %v", err)
+	}
+
+	event := ComplianceEvent{
+		Type:      "ORG_POLICY_SET",
+		Details:   fmt.Sprintf("Organisation policy of %s set for %s", policy.MSPID, policy.Scope),
+		Timestamp: policy.UpdatedAt,
+		TxID:      policy.TxID,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TransferRulesEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetOrgPolicy returns an organisation's own transfer restrictions for a
+// bond, or for all bonds if bondID is empty. An organisation without a
+// policy has no restrictions beyond the bond's transfer rules.
+func (c *Compliance) GetOrgPolicy(ctx contractapi.TransactionContextInterface, mspID, bondID string) (*OrgPolicy, error) {
+	scope := bondID
+	if scope == "" {
+		scope = globalLimitScope
+	}
+
+	policy, err := getOrgPolicy(ctx, mspID, scope)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return &OrgPolicy{MSPID: mspID, Scope: scope}, nil
+	}
+	return policy, nil
+}
+
+// GetTransferRules returns the transfer restrictions of a bond in effect
+// now. A bond without rules has no jurisdiction, risk or quantity
+// restrictions.
+func (c *Compliance) GetTransferRules(ctx contractapi.TransactionContextInterface, bondID string) (*TransferRules, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return getTransferRules(ctx, bondID, now)
+}
+
+// GetTransferRulesVersions returns every version of a bond's transfer
+// restrictions, oldest first, including versions staged for the future
+func (c *Compliance) GetTransferRulesVersions(ctx contractapi.TransactionContextInterface, bondID string) ([]*TransferRules, error) {
+	return transferRulesVersions(ctx, bondID)
+}
+
+// SetTaxProfile records an investor's tax residence (ISO country code) and
+// classification for withholding tax. expectedVersion is the KYC version the
+// caller last read, or 0 to skip the concurrency check.
+func (c *Compliance) SetTaxProfile(ctx contractapi.TransactionContextInterface, address, taxResidence, classification string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	switch classification {
+	case "INDIVIDUAL", "CORPORATE", "EXEMPT":
+	default:
+		return fmt.Errorf("invalid tax classification: %s", classification)
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.TaxResidence = taxResidence
+	kyc.TaxClassification = classification
+	kyc.UpdatedAt = txTime
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	return nil
+}
+
+// GetTaxProfile returns the jurisdiction and classification withholding tax
+// is assessed on. Investors without a recorded profile are treated as
+// individuals resident in their country of nationality.
+func (c *Compliance) GetTaxProfile(ctx contractapi.TransactionContextInterface, address string) (*TaxProfile, error) {
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &TaxProfile{
+		Address:        address,
+		Jurisdiction:   kyc.TaxResidence,
+		Classification: kyc.TaxClassification,
+	}
+	if profile.Jurisdiction == "" {
+		profile.Jurisdiction = kyc.Nationality
+	}
+	if profile.Classification == "" {
+		profile.Classification = "INDIVIDUAL"
+	}
+
+	return profile, nil
+}
+
+// RequestInvestorClass records the investor class an investor claims, such
+// as PROFESSIONAL or QIB. It takes effect once ApproveInvestorClass is
+// called. expectedVersion is the KYC version the caller last read, or 0 to
+// skip the concurrency check.
+func (c *Compliance) RequestInvestorClass(ctx contractapi.TransactionContextInterface, address, class string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if !isInvestorClass(class) {
+		return fmt.Errorf("invalid investor class: %s", class)
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.RequestedInvestorClass = class
+	kyc.UpdatedAt = txTime
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "INVESTOR_CLASS_REQUESTED",
+		Address:   address,
+		Details:   fmt.Sprintf("Investor class %s requested", class),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// ApproveInvestorClass makes an investor's requested class effective. Only
+// the compliance admin may approve it. expectedVersion is the KYC version
+// the caller last read, or 0 to skip the concurrency check.
+func (c *Compliance) ApproveInvestorClass(ctx contractapi.TransactionContextInterface, address string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if kyc.RequestedInvestorClass == "" {
+		return fmt.Errorf("no investor class requested for %s", address)
+	}
+
+	approvedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	approvedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.InvestorClass = kyc.RequestedInvestorClass
+	kyc.RequestedInvestorClass = ""
+	kyc.InvestorClassApprovedBy = approvedBy
+	kyc.InvestorClassApprovedAt = approvedAt
+	kyc.UpdatedAt = approvedAt
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "INVESTOR_CLASS_APPROVED",
+		Address:   address,
+		Details:   fmt.Sprintf("Investor class %s approved", kyc.InvestorClass),
+		Timestamp: approvedAt,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RejectInvestorClass discards an investor's requested class, leaving any
+// previously approved class in place. Only the compliance admin may reject
+// it. expectedVersion is the KYC version the caller last read, or 0 to skip
+// the concurrency check.
+func (c *Compliance) RejectInvestorClass(ctx contractapi.TransactionContextInterface, address, reason string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if kyc.RequestedInvestorClass == "" {
+		return fmt.Errorf("no investor class requested for %s", address)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	requested := kyc.RequestedInvestorClass
+	kyc.RequestedInvestorClass = ""
+	kyc.UpdatedAt = txTime
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "INVESTOR_CLASS_REJECTED",
+		Address:   address,
+		Details:   fmt.Sprintf("Investor class %s rejected: %s", requested, reason),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// SetKYCTierLimits sets the limits of a KYC tier and the documents needed
+// to upgrade to it. limitsJSON is a KYCTierLimits object; its Tier is
+// ignored. Only the compliance admin may set them.
+func (c *Compliance) SetKYCTierLimits(ctx contractapi.TransactionContextInterface, tier, limitsJSON string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := kycTiers[tier]; !ok {
+		return fmt.Errorf("invalid KYC tier: %s", tier)
+	}
+
+	var limits KYCTierLimits
+	err = json.Unmarshal([]byte(limitsJSON), &limits)
+	if err != nil {
+		return fmt.Errorf("invalid KYC tier limits: %v", err)
+	}
+	if limits.MaxHolding < 0 || limits.MaxTransferQuantity < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+	if limits.RequiredDocuments == nil {
+		limits.RequiredDocuments = []string{}
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	limits.Tier = tier
+	limits.UpdatedAt = txTime
+	limits.TxID = ctx.GetStub().GetTxID()
+
+	storedJSON, err := json.Marshal(limits)
+	if err != nil {
+		return fmt.Errorf("failed to marshal KYC tier limits: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(kycTierObjectType, []string{tier})
+	if err != nil {
+		return fmt.Errorf("failed to create KYC tier key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, storedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store KYC tier limits: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "KYC_TIER_LIMITS_SET",
+		Details:   fmt.Sprintf("Limits for %s tier set to holding %d, transfer %d", tier, limits.MaxHolding, limits.MaxTransferQuantity),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TransferRulesEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetKYCTierLimits returns the limits of a KYC tier. A tier without limits
+// gets a record of zeroes.
+func (c *Compliance) GetKYCTierLimits(ctx contractapi.TransactionContextInterface, tier string) (*KYCTierLimits, error) {
+	limits, err := getKYCTierLimits(ctx, tier)
+	if err != nil {
+		return nil, err
+	}
+	if limits == nil {
+		return &KYCTierLimits{Tier: tier, RequiredDocuments: []string{}}, nil
+	}
+	return limits, nil
+}
+
+// RequestKYCTierUpgrade records a request to move an investor to a higher
+// KYC tier. It takes effect once ApproveKYCTierUpgrade is called.
+// expectedVersion is the KYC version the caller last read, or 0 to skip the
+// concurrency check.
+func (c *Compliance) RequestKYCTierUpgrade(ctx contractapi.TransactionContextInterface, address, tier string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := kycTiers[tier]; !ok {
+		return fmt.Errorf("invalid KYC tier: %s", tier)
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if kycTiers[tier] <= kycTiers[kycTier(kyc)] {
+		return fmt.Errorf("%s is already on the %s tier, which is not below %s", address, kycTier(kyc), tier)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.RequestedKYCTier = tier
+	kyc.UpdatedAt = txTime
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "KYC_TIER_UPGRADE_REQUESTED",
+		Address:   address,
+		Details:   fmt.Sprintf("Upgrade to %s tier requested", tier),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// ApproveKYCTierUpgrade moves an investor to its requested KYC tier. Every
+// document type the tier requires must be attached to the KYC record. Only
+// the compliance admin may approve it. expectedVersion is the KYC version
+// the caller last read, or 0 to skip the concurrency check.
+func (c *Compliance) ApproveKYCTierUpgrade(ctx contractapi.TransactionContextInterface, address string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if kyc.RequestedKYCTier == "" {
+		return fmt.Errorf("no KYC tier upgrade requested for %s", address)
+	}
+
+	limits, err := getKYCTierLimits(ctx, kyc.RequestedKYCTier)
+	if err != nil {
+		return err
+	}
+	if limits != nil {
+		var missing []string
+		for _, docType := range limits.RequiredDocuments {
+			attached := false
+			for _, doc := range kyc.Documents {
+				if doc.DocType == docType {
+					attached = true
+					break
+				}
+			}
+			if !attached {
+				missing = append(missing, docType)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%s tier requires documents not attached for %s: %s", kyc.RequestedKYCTier, address, strings.Join(missing, ", "))
+		}
+	}
+
+	approvedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	approvedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.KYCTier = kyc.RequestedKYCTier
+	kyc.RequestedKYCTier = ""
+	kyc.KYCTierApprovedBy = approvedBy
+	kyc.KYCTierApprovedAt = approvedAt
+	kyc.UpdatedAt = approvedAt
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "KYC_TIER_UPGRADE_APPROVED",
+		Address:   address,
+		Details:   fmt.Sprintf("Upgrade to %s tier approved", kyc.KYCTier),
+		Timestamp: approvedAt,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RejectKYCTierUpgrade discards an investor's requested KYC tier, leaving
+// it on its current tier. Only the compliance admin may reject it.
+// expectedVersion is the KYC version the caller last read, or 0 to skip the
+// concurrency check.
+func (c *Compliance) RejectKYCTierUpgrade(ctx contractapi.TransactionContextInterface, address, reason string, expectedVersion int64) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if kyc.RequestedKYCTier == "" {
+		return fmt.Errorf("no KYC tier upgrade requested for %s", address)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	requested := kyc.RequestedKYCTier
+	kyc.RequestedKYCTier = ""
+	kyc.UpdatedAt = txTime
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "KYC_TIER_UPGRADE_REJECTED",
+		Address:   address,
+		Details:   fmt.Sprintf("Upgrade to %s tier rejected: %s", requested, reason),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetKYC retrieves a KYC record
+func (c *Compliance) GetKYC(ctx contractapi.TransactionContextInterface, address string) (*KYCRecord, error) {
+	key, err := kycKey(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	kycJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KYC: %v", err)
+	}
+	if kycJSON == nil {
+		return nil, fmt.Errorf("KYC for address %s does not exist", address)
+	}
+
+	var kyc KYCRecord
+	err = json.Unmarshal(kycJSON, &kyc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal KYC: %v", err)
+	}
+
+	return &kyc, nil
+}
+
+// UpdateKYCDetails changes an individual investor's details: its
+// nationality, if not empty, and any of the full name, date of birth and
+// residential address passed as a KYCPersonalData object under the
+// optional "kyc" transient key. Each changed field is added to the record's
+// change log. A change to the name, date of birth or nationality is
+// material: an approved record goes back to PENDING for re-approval. If
+// rescreen is true the investor's current AML checks are expired so it
+// must be re-screened. Only compliance officers and the compliance admin
+// may update details. expectedVersion is the KYC version the caller last
+// read, or 0 to skip the concurrency check.
+func (c *Compliance) UpdateKYCDetails(ctx contractapi.TransactionContextInterface, address, nationality, reason string, rescreen bool, expectedVersion int64) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("a reason for the change is required")
+	}
+	if nationality != "" && !isCountryCode(nationality) {
+		return fmt.Errorf("invalid nationality: %s", nationality)
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	err = checkVersion("KYC for "+address, kyc.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+	if recordType(kyc) != "INDIVIDUAL" {
+		return fmt.Errorf("details can only be updated on individual KYC records")
+	}
+	if kyc.Status == "ERASED" {
+		return fmt.Errorf("personal data of %s has been erased", address)
+	}
+
+	changedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	txID := ctx.GetStub().GetTxID()
+
+	var changes []*KYCFieldChange
+	if nationality != "" && nationality != kyc.Nationality {
+		changes = append(changes, &KYCFieldChange{Field: "nationality", Material: true, OldValue: kyc.Nationality, NewValue: nationality})
+		kyc.Nationality = nationality
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient data: %v", err)
+	}
+	if updateJSON, ok := transient[kycTransientKey]; ok {
+		var update KYCPersonalData
+		err = json.Unmarshal(updateJSON, &update)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal personal data: %v", err)
+		}
+
+		piiJSON, err := ctx.GetStub().GetPrivateData(kycCollection, address)
+		if err != nil {
+			return fmt.Errorf("failed to read personal data: %v", err)
+		}
+		if piiJSON == nil {
+			return fmt.Errorf("personal data for address %s does not exist", address)
+		}
+		var pii KYCPersonalData
+		err = json.Unmarshal(piiJSON, &pii)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal personal data: %v", err)
+		}
+
+		piiChanged := false
+		for _, field := range []struct {
+			name     string
+			material bool
+			current  *string
+			updated  string
+		}{
+			{"fullName", true, &pii.FullName, update.FullName},
+			{"dateOfBirth", true, &pii.DateOfBirth, update.DateOfBirth},
+			{"residentialAddress", false, &pii.ResidentialAddress, update.ResidentialAddress},
+		} {
+			if field.updated == "" || field.updated == *field.current {
+				continue
+			}
+			*field.current = field.updated
+			piiChanged = true
+			changes = append(changes, &KYCFieldChange{Field: field.name, Material: field.material})
+		}
+
+		if piiChanged {
+			piiJSON, err = json.Marshal(pii)
+			if err != nil {
+				return fmt.Errorf("failed to marshal personal data: %v", err)
+			}
+			err = ctx.GetStub().PutPrivateData(kycCollection, address, piiJSON)
+			if err != nil {
+				return fmt.Errorf("failed to store personal data: %v", err)
+			}
+			hash := sha256.Sum256(piiJSON)
+			kyc.PIIHash = hex.EncodeToString(hash[:])
+		}
+	}
+
+	if len(changes) == 0 {
+		return fmt.Errorf("no details of %s changed", address)
+	}
+
+	material := false
+	for _, change := range changes {
+		change.Reason = reason
+		change.ChangedBy = changedBy
+		change.ChangedAt = now
+		change.TxID = txID
+		material = material || change.Material
+	}
+	kyc.ChangeLog = append(kyc.ChangeLog, changes...)
+
+	previousStatus := kyc.Status
+	if material && kyc.Status == "APPROVED" {
+		kyc.Status = "PENDING"
+	}
+	kyc.UpdatedAt = now
+
+	if rescreen {
+		amlChecks, err := c.GetAllAMLChecks(ctx, address)
+		if err != nil {
+			return err
+		}
+		for _, amlCheck := range amlChecks {
+			if amlCheck.expired(now) {
+				continue
+			}
+			amlCheck.ExpiryDate = now
+
+			checkJSON, err := json.Marshal(amlCheck)
+			if err != nil {
+				return fmt.Errorf("failed to marshal AML check: %v", err)
+			}
+			checkKey, err := amlKey(ctx, address, amlCheck.CheckType)
+			if err != nil {
+				return err
+			}
+			err = ctx.GetStub().PutState(checkKey, checkJSON)
+			if err != nil {
+				return fmt.Errorf("failed to store AML check: %v", err)
+			}
+		}
+	}
+
+	// Checks expired above still read as current until the transaction
+	// commits; the score catches up when the investor is re-screened
+	scoreChange, err := refreshRiskScore(ctx, kyc, nil)
+	if err != nil {
+		return err
+	}
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	return emitKYCStatusEvent(ctx, "KYCDetailsUpdated", &KYCStatusEvent{
+		Address:        address,
+		Status:         kyc.Status,
+		PreviousStatus: previousStatus,
+		EffectiveFrom:  now,
+		Reason:         reason,
+		ChangedBy:      changedBy,
+		RiskLevel:      kyc.RiskLevel,
+		RiskScoreDelta: scoreChange,
+	})
+}
+
+// AttachKYCDocument records the hash and location of an off-chain evidence
+// document against an investor's KYC record. Anyone holding the document can
+// check it is unchanged by hashing it and comparing with the record. A
+// document with the same hash cannot be attached twice.
+func (c *Compliance) AttachKYCDocument(ctx contractapi.TransactionContextInterface, address, docType, sha256Hash, uri string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if docType == "" || uri == "" {
+		return fmt.Errorf("document type and URI are required")
+	}
+	decoded, err := hex.DecodeString(sha256Hash)
+	if err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("invalid SHA-256 hash: %s", sha256Hash)
+	}
+	sha256Hash = hex.EncodeToString(decoded)
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	for _, document := range kyc.Documents {
+		if document.SHA256 == sha256Hash {
+			return fmt.Errorf("document %s is already attached to the KYC for %s", sha256Hash, address)
+		}
+	}
+
+	uploadedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.Documents = append(kyc.Documents, &KYCDocument{
+		DocType:    docType,
+		SHA256:     sha256Hash,
+		URI:        uri,
+		UploadedAt: uploadedAt,
+		TxID:       ctx.GetStub().GetTxID(),
+	})
+	kyc.UpdatedAt = uploadedAt
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "KYC_DOCUMENT_ATTACHED",
+		Address:   address,
+		Details:   fmt.Sprintf("%s document %s attached", docType, sha256Hash),
+		Timestamp: uploadedAt,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetKYCDocuments returns the evidence documents attached to an investor's
+// KYC record
+func (c *Compliance) GetKYCDocuments(ctx contractapi.TransactionContextInterface, address string) ([]*KYCDocument, error) {
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if kyc.Documents == nil {
+		return []*KYCDocument{}, nil
+	}
+	return kyc.Documents, nil
+}
+
+// VerifyIdentityDocument records the outcome of checking one of an
+// investor's identity documents, "VERIFIED" or "REJECTED", with the
+// checker's notes. An expired document cannot be verified, and an investor
+// whose verified documents have all expired is not compliant until a
+// current one is verified. Only compliance officers and the compliance
+// admin may verify documents.
+func (c *Compliance) VerifyIdentityDocument(ctx contractapi.TransactionContextInterface, address, documentID, status, notes string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if status != "VERIFIED" && status != "REJECTED" {
+		return fmt.Errorf("invalid document status: %s", status)
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	if kyc.Status == "ERASED" {
+		return fmt.Errorf("personal data of %s has been erased", address)
+	}
+
+	var document *IdentityDocumentStatus
+	for _, candidate := range kyc.IdentityDocuments {
+		if candidate.ID == documentID {
+			document = candidate
+		}
+	}
+	if document == nil {
+		return fmt.Errorf("identity document %s not found for %s", documentID, address)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if status == "VERIFIED" && document.expired(now) {
+		return fmt.Errorf("identity document %s expired on %s", documentID, document.ExpiryDate.Format("2006-01-02"))
+	}
+
+	document.Status = status
+	document.Notes = notes
+	document.VerifiedBy, err = enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	document.VerifiedAt = now
+	kyc.UpdatedAt = now
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "IDENTITY_DOCUMENT_" + status,
+		Address:   address,
+		Details:   fmt.Sprintf("Identity document %s %s", documentID, strings.ToLower(status)),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RecordConsent records that an investor accepted a document, identified by
+// its SHA-256 hash, at the given RFC 3339 time, so the acceptance can be
+// proven on-chain. Bonds whose transfer rules require consent to a
+// document cannot be transferred to an investor without it. A consent
+// cannot be recorded twice. Only compliance officers and the compliance
+// admin may record consents.
+func (c *Compliance) RecordConsent(ctx contractapi.TransactionContextInterface, address, documentHash, version, timestamp string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if address == "" || version == "" {
+		return fmt.Errorf("address and document version are required")
+	}
+	decoded, err := hex.DecodeString(documentHash)
+	if err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("invalid SHA-256 hash: %s", documentHash)
+	}
+	documentHash = hex.EncodeToString(decoded)
+
+	acceptedAt, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %s, expected RFC 3339", timestamp)
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if acceptedAt.After(now) {
+		return fmt.Errorf("consent cannot be accepted in the future")
+	}
+
+	existing, err := getConsent(ctx, address, documentHash)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("consent of %s to document %s is already recorded", address, documentHash)
+	}
+
+	recordedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+
+	consent := Consent{
+		Address:      address,
+		DocumentHash: documentHash,
+		Version:      version,
+		AcceptedAt:   acceptedAt,
+		RecordedBy:   recordedBy,
+		RecordedAt:   now,
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+
+	consentJSON, err := json.Marshal(consent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal consent: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(consentObjectType, []string{address, documentHash})
+	if err != nil {
+		return fmt.Errorf("failed to create consent key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, consentJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store consent: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "CONSENT_RECORDED",
+		Address:   address,
+		Details:   fmt.Sprintf("Consent to document %s version %s recorded", documentHash, version),
+		Timestamp: now,
+		TxID:      consent.TxID,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// HasConsented reports whether an investor's acceptance of a document,
+// identified by its SHA-256 hash, has been recorded
+func (c *Compliance) HasConsented(ctx contractapi.TransactionContextInterface, address, documentHash string) (bool, error) {
+	consent, err := getConsent(ctx, address, strings.ToLower(documentHash))
+	if err != nil {
+		return false, err
+	}
+	return consent != nil, nil
+}
+
+// RecordAccreditation records the verification of an investor as
+// accredited on the given basis, by verifier on verificationDate
+// (YYYY-MM-DD), valid until expiryDate (YYYY-MM-DD). Recording a new
+// verification renews the investor's accreditation. Only compliance
+// officers and the compliance admin may record accreditations.
+func (c *Compliance) RecordAccreditation(ctx contractapi.TransactionContextInterface, address, basis, verifier, verificationDate, expiryDate string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if !containsString(accreditationBases, basis) {
+		return fmt.Errorf("invalid accreditation basis: %s", basis)
+	}
+	if verifier == "" {
+		return fmt.Errorf("verifier is required")
+	}
+	exists, err := c.KYCExists(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to check KYC existence: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("KYC for address %s does not exist", address)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	verifiedAt, err := time.Parse("2006-01-02", verificationDate)
+	if err != nil {
+		return fmt.Errorf("invalid verification date: %v", err)
+	}
+	if verifiedAt.After(now) {
+		return fmt.Errorf("verification date cannot be in the future")
+	}
+	expiresAt, err := time.Parse("2006-01-02", expiryDate)
+	if err != nil {
+		return fmt.Errorf("invalid expiry date: %v", err)
+	}
+	if !expiresAt.After(now) {
+		return fmt.Errorf("expiry date must be in the future")
+	}
+
+	existing, err := getAccreditation(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	recordedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+
+	accreditation := Accreditation{
+		Address:    address,
+		Basis:      basis,
+		Verifier:   verifier,
+		VerifiedAt: verifiedAt,
+		ExpiryDate: expiresAt,
+		RecordedBy: recordedBy,
+		RecordedAt: now,
+		TxID:       ctx.GetStub().GetTxID(),
+	}
+
+	accreditationJSON, err := json.Marshal(accreditation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal accreditation: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(accreditationObjectType, []string{address})
+	if err != nil {
+		return fmt.Errorf("failed to create accreditation key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, accreditationJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store accreditation: %v", err)
+	}
+
+	// Emit event
+	eventType := "ACCREDITATION_RECORDED"
+	if existing != nil {
+		eventType = "ACCREDITATION_RENEWED"
+	}
+	event := ComplianceEvent{
+		Type:      eventType,
+		Address:   address,
+		Details:   fmt.Sprintf("Accredited on %s basis by %s until %s", basis, verifier, expiresAt.Format("2006-01-02")),
+		Timestamp: now,
+		TxID:      accreditation.TxID,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetAccreditation returns an investor's accreditation
+func (c *Compliance) GetAccreditation(ctx contractapi.TransactionContextInterface, address string) (*Accreditation, error) {
+	accreditation, err := getAccreditation(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if accreditation == nil {
+		return nil, fmt.Errorf("no accreditation recorded for %s", address)
+	}
+	return accreditation, nil
+}
+
+// GetAccreditationRenewals returns the accreditations that have expired or
+// expire within withinDays of the transaction time, soonest first, as the
+// queue of investors to re-verify
+func (c *Compliance) GetAccreditationRenewals(ctx contractapi.TransactionContextInterface, withinDays int) ([]*Accreditation, error) {
+	if withinDays < 0 {
+		return nil, fmt.Errorf("days cannot be negative")
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := now.AddDate(0, 0, withinDays)
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accreditationObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accreditations: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	renewals := []*Accreditation{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var accreditation Accreditation
+		err = json.Unmarshal(queryResult.Value, &accreditation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal accreditation: %v", err)
+		}
+		if accreditation.expired(cutoff) {
+			renewals = append(renewals, &accreditation)
+		}
+	}
+
+	sort.SliceStable(renewals, func(i, j int) bool {
+		return renewals[i].ExpiryDate.Before(renewals[j].ExpiryDate)
+	})
+
+	return renewals, nil
+}
+
+// AddBeneficialOwner links an ultimate beneficial owner to a corporate KYC
+// record, pending screening. The owner's full name, date of birth and
+// identity documents are passed as a KYCPersonalData object under the "ubo"
+// transient key and stored in the kyc-private collection. The ownership of
+// all an entity's owners cannot exceed 100 percent.
+func (c *Compliance) AddBeneficialOwner(ctx contractapi.TransactionContextInterface, address, uboID, nationality string, ownershipPercent float64) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if uboID == "" {
+		return fmt.Errorf("beneficial owner ID is required")
+	}
+	if !isCountryCode(nationality) {
+		return fmt.Errorf("invalid nationality: %s", nationality)
+	}
+	if ownershipPercent <= 0 || ownershipPercent > 100 {
+		return fmt.Errorf("ownership must be above 0 and at most 100 percent")
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	if recordType(kyc) != "CORPORATE" {
+		return fmt.Errorf("beneficial owners can only be linked to corporate KYC records")
+	}
+	if kyc.Status == "ERASED" {
+		return fmt.Errorf("personal data of %s has been erased", address)
+	}
+
+	total := ownershipPercent
+	for _, owner := range kyc.BeneficialOwners {
+		if owner.UBOID == uboID {
+			return fmt.Errorf("beneficial owner %s is already linked to %s", uboID, address)
+		}
+		total += owner.OwnershipPercent
+	}
+	if total > 100 {
+		return fmt.Errorf("beneficial owners of %s would own %.2f%%, above 100%%", address, total)
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient data: %v", err)
+	}
+	piiJSON, ok := transient[uboTransientKey]
+	if !ok {
+		return fmt.Errorf("personal data must be passed in the %q transient key", uboTransientKey)
+	}
+
+	var pii KYCPersonalData
+	err = json.Unmarshal(piiJSON, &pii)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal personal data: %v", err)
+	}
+	err = pii.validate()
+	if err != nil {
+		return err
+	}
+	pii.Address = address
+
+	piiJSON, err = json.Marshal(pii)
+	if err != nil {
+		return fmt.Errorf("failed to marshal personal data: %v", err)
+	}
+
+	key, err := uboKey(ctx, address, uboID)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutPrivateData(kycCollection, key, piiJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store personal data: %v", err)
+	}
+
+	addedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(piiJSON)
+	kyc.BeneficialOwners = append(kyc.BeneficialOwners, &BeneficialOwner{
+		UBOID:            uboID,
+		Nationality:      nationality,
+		OwnershipPercent: ownershipPercent,
+		PIIHash:          hex.EncodeToString(hash[:]),
+		ScreeningStatus:  "PENDING",
+		AddedAt:          addedAt,
+		TxID:             ctx.GetStub().GetTxID(),
+	})
+	kyc.UpdatedAt = addedAt
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "UBO_ADDED",
+		Address:   address,
+		Details:   fmt.Sprintf("Beneficial owner %s added with %.2f%% ownership", uboID, ownershipPercent),
+		Timestamp: addedAt,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// ScreenBeneficialOwner records the outcome of screening a beneficial owner:
+// "PASSED", "FAILED" or "PENDING" to screen again. An entity with a failed
+// owner of more than 25 percent is not compliant. Only compliance officers
+// and the compliance admin may screen owners.
+func (c *Compliance) ScreenBeneficialOwner(ctx contractapi.TransactionContextInterface, address, uboID, status, details string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if status != "PASSED" && status != "FAILED" && status != "PENDING" {
+		return fmt.Errorf("invalid screening status: %s", status)
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	owner := beneficialOwner(kyc, uboID)
+	if owner == nil {
+		return fmt.Errorf("beneficial owner %s is not linked to %s", uboID, address)
+	}
+
+	screenedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	screenedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	owner.ScreeningStatus = status
+	owner.ScreeningDetails = details
+	owner.ScreenedBy = screenedBy
+	owner.ScreenedAt = screenedAt
+	kyc.UpdatedAt = screenedAt
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "UBO_SCREENED",
+		Address:   address,
+		Details:   fmt.Sprintf("Beneficial owner %s (%.2f%%) screening %s: %s", uboID, owner.OwnershipPercent, status, details),
+		Timestamp: screenedAt,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		Outcome: status,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveBeneficialOwner unlinks a beneficial owner from an entity and
+// deletes its personal data. Only compliance officers and the compliance
+// admin may remove owners.
+func (c *Compliance) RemoveBeneficialOwner(ctx contractapi.TransactionContextInterface, address, uboID string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+
+	var owners []*BeneficialOwner
+	for _, owner := range kyc.BeneficialOwners {
+		if owner.UBOID != uboID {
+			owners = append(owners, owner)
+		}
+	}
+	if len(owners) == len(kyc.BeneficialOwners) {
+		return fmt.Errorf("beneficial owner %s is not linked to %s", uboID, address)
+	}
+
+	key, err := uboKey(ctx, address, uboID)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelPrivateData(kycCollection, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete personal data: %v", err)
+	}
+
+	removedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.BeneficialOwners = owners
+	kyc.UpdatedAt = removedAt
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "UBO_REMOVED",
+		Address:   address,
+		Details:   fmt.Sprintf("Beneficial owner %s removed", uboID),
+		Timestamp: removedAt,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetBeneficialOwners returns the beneficial owners linked to an entity's
+// KYC record
+func (c *Compliance) GetBeneficialOwners(ctx contractapi.TransactionContextInterface, address string) ([]*BeneficialOwner, error) {
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if kyc.BeneficialOwners == nil {
+		return []*BeneficialOwner{}, nil
+	}
+	return kyc.BeneficialOwners, nil
+}
+
+// GetKYCPersonalData returns an individual investor's personal data from
+// the kyc-private collection. Only clients of the collection's member
+// organisations may read it.
+func (c *Compliance) GetKYCPersonalData(ctx contractapi.TransactionContextInterface, address string) (*KYCPersonalData, error) {
+	err := requireCollectionMember(ctx, kycCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	piiJSON, err := ctx.GetStub().GetPrivateData(kycCollection, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read personal data: %v", err)
+	}
+	if piiJSON == nil {
+		return nil, fmt.Errorf("personal data for address %s does not exist", address)
+	}
+
+	var pii KYCPersonalData
+	err = json.Unmarshal(piiJSON, &pii)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal personal data: %v", err)
+	}
+
+	return &pii, nil
+}
+
+// GetKYCEntityData returns a corporate investor's entity data from the
+// kyc-private collection. Only clients of the collection's member
+// organisations may read it.
+func (c *Compliance) GetKYCEntityData(ctx contractapi.TransactionContextInterface, address string) (*KYCEntityData, error) {
+	err := requireCollectionMember(ctx, kycCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	entityJSON, err := ctx.GetStub().GetPrivateData(kycCollection, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entity data: %v", err)
+	}
+	if entityJSON == nil {
+		return nil, fmt.Errorf("entity data for address %s does not exist", address)
+	}
+
+	var entity KYCEntityData
+	err = json.Unmarshal(entityJSON, &entity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entity data: %v", err)
+	}
+
+	return &entity, nil
+}
+
+// VerifyKYCPersonalData reports whether the personal data held in the
+// kyc-private collection still matches the hash on an investor's KYC
+// record. It reads only the collection's on-chain hash, so any organisation
+// can run it.
+func (c *Compliance) VerifyKYCPersonalData(ctx contractapi.TransactionContextInterface, address string) (bool, error) {
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return false, err
+	}
+
+	hash, err := ctx.GetStub().GetPrivateDataHash(kycCollection, address)
+	if err != nil {
+		return false, fmt.Errorf("failed to read personal data hash: %v", err)
+	}
+
+	return hash != nil && hex.EncodeToString(hash) == kyc.PIIHash, nil
+}
+
+// GetComplianceHistory returns every status change of an address's KYC
+// record and AML checks from their ledger history, merged and oldest first,
+// with the transaction and the identity of the client that made it.
+// Changes written before invoker identities were recorded have no
+// InvokerMSP, and KYC changes from then no Invoker either.
+func (c *Compliance) GetComplianceHistory(ctx contractapi.TransactionContextInterface, address string) ([]*ComplianceHistoryEntry, error) {
+	key, err := kycKey(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{key}
+	records := []string{"KYC"}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(amlObjectType, []string{address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AML checks: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil || len(attributes) != 2 {
+			return nil, fmt.Errorf("invalid AML check key: %q", queryResult.Key)
+		}
+		keys = append(keys, queryResult.Key)
+		records = append(records, attributes[1])
+	}
+
+	history := []*ComplianceHistoryEntry{}
+	for i, key := range keys {
+		entries, err := statusHistory(ctx, key, records[i])
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, entries...)
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Timestamp.Before(history[j].Timestamp)
+	})
+
+	return history, nil
+}
+
+// RequestErasure records an investor's request to have its personal data
+// erased. It is carried out by ExecuteErasure.
+func (c *Compliance) RequestErasure(ctx contractapi.TransactionContextInterface, address, reason string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	if kyc.Status == "ERASED" {
+		return fmt.Errorf("personal data of %s has already been erased", address)
+	}
+
+	requestedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	requestedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.ErasureRequestedBy = requestedBy
+	kyc.ErasureRequestedAt = requestedAt
+	kyc.ErasureReason = reason
+	kyc.UpdatedAt = requestedAt
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "ERASURE_REQUESTED",
+		Address:   address,
+		Details:   fmt.Sprintf("Erasure requested by %s", requestedBy),
+		Timestamp: requestedAt,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// ExecuteErasure carries out a requested erasure. The personal data, and
+// that of any beneficial owners, is purged from the kyc-private collection,
+// including its history on every member peer, and the KYC record loses the
+// personal data hashes and the
+// evidence documents and becomes ERASED, so the investor can no longer
+// pass compliance checks. Status history, approvals, risk level and AML
+// checks stay on the channel as the decision trail. Only the compliance
+// admin may execute erasures. Purging private data needs Fabric v2.5 peers.
+func (c *Compliance) ExecuteErasure(ctx contractapi.TransactionContextInterface, address string) error {
+	err := requireRole(ctx, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return fmt.Errorf("failed to get KYC: %v", err)
+	}
+	if kyc.Status == "ERASED" {
+		return fmt.Errorf("personal data of %s has already been erased", address)
+	}
+	if kyc.ErasureRequestedAt.IsZero() {
+		return fmt.Errorf("no erasure requested for %s", address)
+	}
+
+	// The identity index holds hashes of the document numbers, so it goes
+	// with the personal data
+	if len(kyc.IdentityDocuments) > 0 {
+		piiJSON, err := ctx.GetStub().GetPrivateData(kycCollection, address)
+		if err != nil {
+			return fmt.Errorf("failed to read personal data: %v", err)
+		}
+		var pii KYCPersonalData
+		if piiJSON != nil {
+			err = json.Unmarshal(piiJSON, &pii)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal personal data: %v", err)
+			}
+		}
+		for _, document := range pii.Documents {
+			indexKey, err := ctx.GetStub().CreateCompositeKey(idHashIndex, []string{identityDocumentHash(document), address})
+			if err != nil {
+				return fmt.Errorf("failed to create identity index key: %v", err)
+			}
+			err = ctx.GetStub().PurgePrivateData(kycCollection, indexKey)
+			if err != nil {
+				return fmt.Errorf("failed to purge identity index: %v", err)
+			}
+		}
+	}
+
+	err = ctx.GetStub().PurgePrivateData(kycCollection, address)
+	if err != nil {
+		return fmt.Errorf("failed to purge personal data: %v", err)
+	}
+	for _, owner := range kyc.BeneficialOwners {
+		key, err := uboKey(ctx, address, owner.UBOID)
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().PurgePrivateData(kycCollection, key)
+		if err != nil {
+			return fmt.Errorf("failed to purge beneficial owner personal data: %v", err)
+		}
+		owner.PIIHash = ""
+	}
+
+	erasedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	erasedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	kyc.Status = "ERASED"
+	kyc.PIIHash = ""
+	kyc.Documents = nil
+	kyc.IdentityDocuments = nil
+	kyc.ErasedBy = erasedBy
+	kyc.ErasedAt = erasedAt
+	kyc.UpdatedAt = erasedAt
+
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return fmt.Errorf("failed to update KYC: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      "KYC_ERASED",
+		Address:   address,
+		Details:   fmt.Sprintf("Personal data erased by %s", erasedBy),
+		Timestamp: erasedAt,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// GetAMLCheck retrieves an address's AML check of the given type
+func (c *Compliance) GetAMLCheck(ctx contractapi.TransactionContextInterface, address, checkType string) (*AMLCheck, error) {
+	amlCheck, err := getAMLCheck(ctx, address, checkType)
+	if err != nil {
+		return nil, err
+	}
+	if amlCheck == nil {
+		return nil, fmt.Errorf("%s check for address %s does not exist", checkType, address)
+	}
+
+	return amlCheck, nil
+}
+
+// KYCExists checks if a KYC record exists
+func (c *Compliance) KYCExists(ctx contractapi.TransactionContextInterface, address string) (bool, error) {
+	key, err := kycKey(ctx, address)
+	if err != nil {
+		return false, err
+	}
+
+	kycJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to read KYC: %v", err)
+	}
+	return kycJSON != nil, nil
+}
+
+// GetAllKYC returns all KYC records
+func (c *Compliance) GetAllKYC(ctx contractapi.TransactionContextInterface) ([]*KYCRecord, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(kycObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get KYC records: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var kycRecords []*KYCRecord
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var kyc KYCRecord
+		err = json.Unmarshal(queryResult.Value, &kyc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal KYC: %v", err)
+		}
+		kycRecords = append(kycRecords, &kyc)
+	}
+
+	return kycRecords, nil
+}
+
+// QueryKYC returns one page of the KYC records matching a CouchDB selector
+// on status, risk level and nationality, using the index shipped under
+// META-INF/statedb/couchdb/indexes; empty filters match any value. Pass
+// the returned bookmark to fetch the next page; it is empty on the last
+// page. Records are matched on the docType putKYC tags them with, so ones
+// not written since it was added are found once they are next updated. It
+// requires a CouchDB state database.
+func (c *Compliance) QueryKYC(ctx contractapi.TransactionContextInterface, status, riskLevel, nationality string, pageSize int32, bookmark string) (*KYCPage, error) {
+	queryString, err := kycQueryString(status, riskLevel, nationality)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query KYC records: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	page := &KYCPage{Records: []*KYCRecord{}}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var kyc KYCRecord
+		err = json.Unmarshal(queryResult.Value, &kyc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal KYC: %v", err)
+		}
+		page.Records = append(page.Records, &kyc)
+	}
+
+	page.Count = metadata.FetchedRecordsCount
+	if metadata.FetchedRecordsCount == pageSize {
+		page.Bookmark = metadata.Bookmark
+	}
+
+	return page, nil
+}
+
+// GetAllAMLChecks returns all AML checks for an address
+func (c *Compliance) GetAllAMLChecks(ctx contractapi.TransactionContextInterface, address string) ([]*AMLCheck, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(amlObjectType, []string{address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AML checks: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var amlChecks []*AMLCheck
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var amlCheck AMLCheck
+		err = json.Unmarshal(queryResult.Value, &amlCheck)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal AML check: %v", err)
+		}
+		amlChecks = append(amlChecks, &amlCheck)
+	}
+
+	return amlChecks, nil
+}
+
+// GetExpiredChecks returns the AML checks of every address that have
+// expired and need re-screening
+func (c *Compliance) GetExpiredChecks(ctx contractapi.TransactionContextInterface) ([]*AMLCheck, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(amlObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AML checks: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	amlChecks := []*AMLCheck{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var amlCheck AMLCheck
+		err = json.Unmarshal(queryResult.Value, &amlCheck)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal AML check: %v", err)
+		}
+		if amlCheck.expired(now) {
+			amlChecks = append(amlChecks, &amlCheck)
+		}
+	}
+
+	return amlChecks, nil
+}
+
+// GetRescreeningDue returns the approved addresses whose KYC review or AML
+// checks are due on or before asOfDate (YYYY-MM-DD, defaulting to the
+// transaction time) under their risk level's review frequency. A KYC
+// review is due that long after approval and an AML check that long after
+// it was made, or when it expires if sooner. Addresses without a risk
+// level are reviewed as HIGH risk.
+func (c *Compliance) GetRescreeningDue(ctx contractapi.TransactionContextInterface, asOfDate string) ([]*RescreeningDue, error) {
+	cutoff, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if asOfDate != "" {
+		asOf, err := time.Parse("2006-01-02", asOfDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid as of date: %v", err)
+		}
+		cutoff = asOf.AddDate(0, 0, 1)
+	}
+
+	kycRecords, err := c.GetAllKYC(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dueList := []*RescreeningDue{}
+	for _, kyc := range kycRecords {
+		if kyc.Status != "APPROVED" {
+			continue
+		}
+
+		years := reviewYears(kyc)
+
+		due := &RescreeningDue{Address: kyc.Address, RiskLevel: kyc.RiskLevel, LastReviewed: kyc.ApprovedAt, DueChecks: []string{}}
+		if due.LastReviewed.IsZero() {
+			due.LastReviewed = kyc.CreatedAt
+		}
+		due.KYCReviewDue = due.LastReviewed.AddDate(years, 0, 0).Before(cutoff)
+
+		amlChecks, err := c.GetAllAMLChecks(ctx, kyc.Address)
+		if err != nil {
+			return nil, err
+		}
+		for _, amlCheck := range amlChecks {
+			if amlCheck.CheckDate.AddDate(years, 0, 0).Before(cutoff) || amlCheck.expired(cutoff) {
+				due.DueChecks = append(due.DueChecks, amlCheck.CheckType)
+			}
+		}
+
+		if due.KYCReviewDue || len(due.DueChecks) > 0 {
+			dueList = append(dueList, due)
+		}
+	}
+
+	return dueList, nil
+}
+
+// GetMyComplianceStatus returns the calling investor's own compliance
+// status, for investor portals. The address is taken from the caller's
+// client identity, so no role is needed and no other investor's status can
+// be read.
+func (c *Compliance) GetMyComplianceStatus(ctx contractapi.TransactionContextInterface) (*ComplianceStatusSummary, error) {
+	address, err := callerAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ComplianceStatusSummary{
+		Address:         address,
+		KYCStatus:       "NONE",
+		Checks:          []*CheckSummary{},
+		ActionsRequired: []string{},
+	}
+
+	exists, err := c.KYCExists(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		summary.ActionsRequired = append(summary.ActionsRequired, "KYC_MISSING")
+		return summary, nil
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	summary.KYCStatus = kyc.Status
+	summary.InvestorClass = investorClass(kyc)
+	summary.KYCTier = kycTier(kyc)
+	summary.ApprovedAt = kyc.ApprovedAt
+	summary.IdentityDocuments = kyc.IdentityDocuments
+	if kyc.Status != "APPROVED" {
+		summary.ActionsRequired = append(summary.ActionsRequired, "KYC_NOT_APPROVED")
+	}
+	if identityDocumentsExpired(kyc, now) {
+		summary.ActionsRequired = append(summary.ActionsRequired, "IDENTITY_DOCUMENT_EXPIRED")
+	}
+
+	for _, checkType := range requiredAMLChecks {
+		amlCheck, err := getAMLCheck(ctx, address, checkType)
+		if err != nil {
+			return nil, err
+		}
+
+		check := &CheckSummary{CheckType: checkType}
+		switch {
+		case amlCheck == nil:
+			check.Status = "MISSING"
+		case amlCheck.expired(now):
+			check.Status = "EXPIRED"
+			check.ExpiryDate = amlCheck.ExpiryDate
+			summary.ActionsRequired = append(summary.ActionsRequired, "AML_"+checkType+"_EXPIRED")
+		case amlCheck.Status == "PASSED":
+			check.Status = "CURRENT"
+			check.ExpiryDate = amlCheck.ExpiryDate
+		default:
+			check.Status = "UNDER_REVIEW"
+		}
+		summary.Checks = append(summary.Checks, check)
+	}
+
+	summary.Compliant, _, err = c.CheckCompliance(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// GetComplianceExceptions reports every address holding tokens of a bond
+// that is not void, read from the BondToken contract, that lacks an
+// approved KYC record or a current, passed sanctions and PEP check. Issuers'
+// holdings of their own bonds are not reported. Only compliance officers,
+// the compliance admin and regulators may run the report.
+func (c *Compliance) GetComplianceExceptions(ctx contractapi.TransactionContextInterface) (*ComplianceExceptionReport, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole, regulatorRole)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var bonds []*bondTokenBond
+	err = queryBondToken(ctx, &bonds, "GetAllBonds")
+	if err != nil {
+		return nil, err
+	}
+
+	holdings := map[string][]string{}
+	for _, bond := range bonds {
+		if bond.Status == "VOID" {
+			continue
+		}
+
+		var holders []*bondTokenHolder
+		err = queryBondToken(ctx, &holders, "GetBondHolders", bond.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, holder := range holders {
+			if holder.Quantity > 0 && holder.Address != bond.IssuerID {
+				holdings[holder.Address] = append(holdings[holder.Address], bond.ID)
+			}
+		}
+	}
+
+	addresses := make([]string, 0, len(holdings))
+	for address := range holdings {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	report := &ComplianceExceptionReport{
+		AsOf:           now,
+		HoldersChecked: len(addresses),
+		Exceptions:     []*ComplianceException{},
+	}
+	for _, address := range addresses {
+		exception := &ComplianceException{Address: address, BondIDs: holdings[address], KYCStatus: "NONE", Issues: []string{}}
+
+		key, err := kycKey(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		kycJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read KYC: %v", err)
+		}
+		if kycJSON == nil {
+			exception.Issues = append(exception.Issues, "KYC_MISSING")
+		} else {
+			var kyc KYCRecord
+			err = json.Unmarshal(kycJSON, &kyc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal KYC: %v", err)
+			}
+			exception.KYCStatus = kyc.Status
+			if kyc.Status != "APPROVED" {
+				exception.Issues = append(exception.Issues, "KYC_NOT_APPROVED")
+			}
+		}
+
+		for _, checkType := range requiredAMLChecks {
+			amlCheck, err := getAMLCheck(ctx, address, checkType)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case amlCheck == nil:
+				exception.Issues = append(exception.Issues, "AML_"+checkType+"_MISSING")
+			case amlCheck.expired(now):
+				exception.Issues = append(exception.Issues, "AML_"+checkType+"_EXPIRED")
+			case amlCheck.Status != "PASSED":
+				exception.Issues = append(exception.Issues, "AML_"+checkType+"_"+amlCheck.Status)
+			}
+		}
+
+		if len(exception.Issues) > 0 {
+			report.Exceptions = append(report.Exceptions, exception)
+		}
+	}
+
+	return report, nil
+}
+
+// GenerateRegulatoryExtract returns the data for a regulatory report on a
+// period, given as a year ("2024"), quarter ("2024-Q1") or month
+// ("2024-03"). reportType selects the sections: "INVESTORS" for approved
+// investors by jurisdiction and rejected KYC, "SAR" for suspicious activity
+// report counts, "BLOCKED_TRANSFERS" for denied transfers, or "FULL" for
+// all three. Only compliance officers, the compliance admin and regulators
+// may generate extracts, and those covering SARs only on a peer of a
+// sar-private member organisation.
+func (c *Compliance) GenerateRegulatoryExtract(ctx contractapi.TransactionContextInterface, period, reportType string) (*RegulatoryExtract, error) {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole, regulatorRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if reportType == "" {
+		reportType = "FULL"
+	}
+	if !containsString([]string{"FULL", "INVESTORS", "SAR", "BLOCKED_TRANSFERS"}, reportType) {
+		return nil, fmt.Errorf("invalid report type %s", reportType)
+	}
+	if reportType == "FULL" || reportType == "SAR" {
+		err = requireCollectionMember(ctx, sarCollection)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start, end, err := parseReportingPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	extract := &RegulatoryExtract{
+		Period:      period,
+		ReportType:  reportType,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		GeneratedAt: now,
+	}
+	inPeriod := func(t time.Time) bool {
+		return !t.IsZero() && !t.Before(start) && t.Before(end)
+	}
+
+	if reportType == "FULL" || reportType == "INVESTORS" {
+		extract.Investors = &InvestorExtract{ByJurisdiction: map[string]int{}, RejectedByJurisdiction: map[string]int{}}
+
+		kycRecords, err := c.GetAllKYC(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, kyc := range kycRecords {
+			if kyc.Status == "APPROVED" && kyc.CreatedAt.Before(end) {
+				extract.Investors.ApprovedInvestors++
+				extract.Investors.ByJurisdiction[kyc.Nationality]++
+			}
+			if kyc.Status == "REJECTED" && inPeriod(kyc.UpdatedAt) {
+				extract.Investors.RejectedKYC++
+				extract.Investors.RejectedByJurisdiction[kyc.Nationality]++
+			}
+		}
+	}
+
+	if reportType == "FULL" || reportType == "SAR" {
+		extract.SARs = &SARExtract{FiledBySeverity: map[string]int{}}
+
+		resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(sarCollection, sarObjectType, []string{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get reports: %v", err)
+		}
+		defer resultsIterator.Close()
+
+		for resultsIterator.HasNext() {
+			queryResult, err := resultsIterator.Next()
+			if err != nil {
+				return nil, fmt.Errorf("failed to iterate results: %v", err)
+			}
+
+			var sar SuspiciousActivityReport
+			err = json.Unmarshal(queryResult.Value, &sar)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal report: %v", err)
+			}
+
+			if inPeriod(sar.FiledAt) {
+				extract.SARs.Filed++
+				extract.SARs.FiledBySeverity[sar.Severity]++
+			}
+			if inPeriod(sar.ClosedAt) {
+				extract.SARs.Closed++
+			}
+			if !sar.FiledAt.IsZero() && sar.FiledAt.Before(end) && (sar.ClosedAt.IsZero() || !sar.ClosedAt.Before(end)) {
+				extract.SARs.OpenAtPeriodEnd++
+			}
+		}
+	}
+
+	if reportType == "FULL" || reportType == "BLOCKED_TRANSFERS" {
+		extract.BlockedTransfers = &BlockedTransferExtract{ByReasonCode: map[string]int{}, ByBond: map[string]int{}}
+
+		resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(blockedTransferObjectType, []string{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get blocked transfers: %v", err)
+		}
+		defer resultsIterator.Close()
+
+		for resultsIterator.HasNext() {
+			queryResult, err := resultsIterator.Next()
+			if err != nil {
+				return nil, fmt.Errorf("failed to iterate results: %v", err)
+			}
+
+			var blocked BlockedTransfer
+			err = json.Unmarshal(queryResult.Value, &blocked)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal blocked transfer: %v", err)
+			}
+			if !inPeriod(blocked.Timestamp) {
+				continue
+			}
+
+			extract.BlockedTransfers.Total++
+			extract.BlockedTransfers.ByBond[blocked.BondID]++
+			for _, reasonCode := range blocked.ReasonCodes {
+				extract.BlockedTransfers.ByReasonCode[reasonCode]++
+			}
+		}
+	}
+
+	return extract, nil
+}
+
+// GetComplianceStats returns dashboard figures for KYC records and AML
+// checks: counts by status and by risk level, requests awaiting approval,
+// checks expired or expiring within windowDays (defaulting to 30) and KYC
+// records rejected within the last windowDays. It reads every record, so
+// clients need not page through them all to build a dashboard.
+func (c *Compliance) GetComplianceStats(ctx contractapi.TransactionContextInterface, windowDays int) (*ComplianceStats, error) {
+	if windowDays < 0 {
+		return nil, fmt.Errorf("window cannot be negative")
+	}
+	if windowDays == 0 {
+		windowDays = 30
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	windowStart := now.AddDate(0, 0, -windowDays)
+	windowEnd := now.AddDate(0, 0, windowDays)
+
+	stats := &ComplianceStats{
+		AsOf:           now,
+		WindowDays:     windowDays,
+		KYCByStatus:    map[string]int{},
+		KYCByRiskLevel: map[string]int{},
+		ChecksByStatus: map[string]int{},
+	}
+
+	kycRecords, err := c.GetAllKYC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, kyc := range kycRecords {
+		stats.TotalKYC++
+		stats.KYCByStatus[kyc.Status]++
+		if kyc.Status == "APPROVED" {
+			riskLevel := kyc.RiskLevel
+			if riskLevel == "" {
+				riskLevel = "NONE"
+			}
+			stats.KYCByRiskLevel[riskLevel]++
+		}
+
+		if kyc.Status == "PENDING" {
+			stats.PendingKYC++
+		}
+		if kyc.RequestedInvestorClass != "" {
+			stats.PendingInvestorClass++
+		}
+		if kyc.RequestedKYCTier != "" {
+			stats.PendingKYCTier++
+		}
+		if kyc.ErasureRequestedBy != "" && kyc.Status != "ERASED" {
+			stats.PendingErasures++
+		}
+		if kyc.Status == "REJECTED" && !kyc.UpdatedAt.Before(windowStart) {
+			stats.RecentRejections++
+		}
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(amlObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AML checks: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var amlCheck AMLCheck
+		err = json.Unmarshal(queryResult.Value, &amlCheck)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal AML check: %v", err)
+		}
+
+		stats.TotalChecks++
+		stats.ChecksByStatus[amlCheck.Status]++
+		if amlCheck.expired(now) {
+			stats.ExpiredChecks++
+		} else if amlCheck.expired(windowEnd) {
+			stats.ExpiringChecks++
+		}
+	}
+
+	exemptionsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(exemptionObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exemptions: %v", err)
+	}
+	defer exemptionsIterator.Close()
+
+	for exemptionsIterator.HasNext() {
+		queryResult, err := exemptionsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var exemptions []*Exemption
+		err = json.Unmarshal(queryResult.Value, &exemptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal exemptions: %v", err)
+		}
+		for _, exemption := range exemptions {
+			if exemption.Status == "PENDING" {
+				stats.PendingExemptions++
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// decideTransfer makes CheckTransfer's decision on a transfer at the given
+// time, with a scenario's hypothetical changes applied if it is not nil,
+// and returns the limit utilization the transfer would leave each party
+// with
+func (c *Compliance) decideTransfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64, now time.Time, scenario *TransferScenario) (*TransferDecision, []*LimitUtilization, error) {
+	rules, err := getTransferRules(ctx, bondID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decision := &TransferDecision{
+		From:          from,
+		To:            to,
+		BondID:        bondID,
+		Quantity:      quantity,
+		Reasons:       []*TransferReason{},
+		PolicyVersion: rules.Version,
+
+		RulesEvaluated: []string{},
+		Value:          float64(quantity) * rules.UnitValue,
+	}
+
+	// The submitting organisation's policy for all bonds, then its policy
+	// for this bond, are layered on the channel-wide rules
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, scope := range []string{globalLimitScope, bondID} {
+		policy, err := getOrgPolicy(ctx, mspID, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		if policy != nil {
+			rules.tighten(policy)
+			decision.OrgPolicyMSP = mspID
+			decision.evaluated("ORG_POLICY")
+		}
+	}
+
+	decision.evaluated("QUANTITY")
+	if quantity <= 0 {
+		decision.deny("", "INVALID_QUANTITY", "quantity must be positive")
+	}
+	if rules.MaxTransferQuantity > 0 {
+		decision.evaluated("TRANSFER_LIMIT")
+	}
+	if rules.MaxTransferQuantity > 0 && quantity > rules.MaxTransferQuantity {
+		decision.deny("", "TRANSFER_LIMIT_EXCEEDED", "quantity %d exceeds the limit of %d for bond %s", quantity, rules.MaxTransferQuantity, bondID)
+	}
+
+	if from != "" {
+		decision.evaluated("COMPLIANCE_HOLD")
+		holds, err := getHolds(ctx, from)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hold := activeHold(holds, bondID); hold != nil {
+			decision.deny(from, "COMPLIANCE_HOLD", "%s is under compliance hold %s: %s", from, hold.ID, hold.Reason)
+		}
+	}
+
+	var usages []*LimitUtilization
+	for _, address := range []string{from, to} {
+		if address == "" {
+			continue
+		}
+		err = c.checkParty(ctx, decision, address, rules, now, scenario)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		partyUsages, err := checkLimits(ctx, decision, address, now, scenario)
+		if err != nil {
+			return nil, nil, err
+		}
+		usages = append(usages, partyUsages...)
+	}
+
+	err = applyExemptions(ctx, decision, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decision.Allowed = len(decision.Reasons) == 0
+	return decision, usages, nil
+}
+
+// checkParty adds to decision the reasons an address may not be a party to
+// a transfer of a bond with the given rules, with the scenario's KYC
+// change applied to its record
+func (c *Compliance) checkParty(ctx contractapi.TransactionContextInterface, decision *TransferDecision, address string, rules *TransferRules, now time.Time, scenario *TransferScenario) error {
+	for _, list := range []string{blacklistObjectType, watchlistObjectType} {
+		decision.evaluated(list)
+		entry, err := getListEntry(ctx, list, address)
+		if err != nil {
+			return err
+		}
+		if !entry.inEffect(now) {
+			continue
+		}
+		if list == blacklistObjectType {
+			decision.deny(address, "BLACKLISTED", "%s is blacklisted: %s", address, entry.ReasonCode)
+		} else {
+			decision.Flags = append(decision.Flags, &TransferReason{Address: address, ReasonCode: "WATCHLISTED", Reason: fmt.Sprintf("%s is watchlisted: %s", address, entry.ReasonCode)})
+		}
+	}
+
+	decision.evaluated("KYC_STATUS")
+	exists, err := c.KYCExists(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	var kyc *KYCRecord
+	if exists {
+		kyc, err = c.GetKYC(ctx, address)
+		if err != nil {
+			return err
+		}
+	}
+	kyc = scenario.applyKYC(address, kyc)
+	if kyc == nil {
+		decision.deny(address, "KYC_NOT_FOUND", "no KYC record for %s", address)
+		return nil
+	}
+	if kyc.Status != "APPROVED" {
+		decision.deny(address, "KYC_NOT_APPROVED", "KYC status of %s is %s", address, kyc.Status)
+	}
+
+	if len(kyc.BeneficialOwners) > 0 {
+		decision.evaluated("UBO_SCREENING")
+	}
+	if owner := failedBeneficialOwner(kyc); owner != nil {
+		decision.deny(address, "UBO_SCREENING_FAILED", "beneficial owner %s of %s, owning %.2f%%, failed screening", owner.UBOID, address, owner.OwnershipPercent)
+	}
+
+	for _, checkType := range []string{"SANCTIONS", "PEP", "ADVERSE_MEDIA"} {
+		decision.evaluated("AML_" + checkType)
+		amlCheck, err := getAMLCheck(ctx, address, checkType)
+		if err != nil {
+			return err
+		}
+		if amlCheck != nil && amlCheck.expired(now) {
+			decision.deny(address, "AML_"+checkType+"_EXPIRED", "%s check of %s expired on %s and must be re-screened", checkType, address, amlCheck.ExpiryDate.Format("2006-01-02"))
+		} else if amlCheck != nil && amlCheck.Status == "FAILED" {
+			decision.deny(address, "AML_"+checkType+"_FAILED", "%s check of %s failed", checkType, address)
+		}
+	}
+
+	class := investorClass(kyc)
+	for _, jurisdiction := range investorJurisdictions(kyc) {
+		if len(rules.BlockedJurisdictions) > 0 || len(rules.AllowedJurisdictions) > 0 {
+			decision.evaluated("JURISDICTION")
+		}
+		if containsString(rules.BlockedJurisdictions, jurisdiction) {
+			decision.deny(address, "JURISDICTION_BLOCKED", "bond %s cannot be held by investors in %s", decision.BondID, jurisdiction)
+			continue
+		}
+		if len(rules.AllowedJurisdictions) > 0 && !containsString(rules.AllowedJurisdictions, jurisdiction) {
+			decision.deny(address, "JURISDICTION_NOT_ALLOWED", "bond %s is not offered to investors in %s", decision.BondID, jurisdiction)
+			continue
+		}
+
+		decision.evaluated("COUNTRY_RISK")
+		countryRisk, err := getCountryRisk(ctx, jurisdiction)
+		if err != nil {
+			return err
+		}
+		if countryRisk != nil && countryRisk.prohibited() {
+			decision.deny(address, "JURISDICTION_PROHIBITED", "investors in %s are prohibited (risk tier %s, FATF status %s)", jurisdiction, countryRisk.RiskTier, countryRisk.FATFStatus)
+			continue
+		}
+		if countryRisk != nil && rules.MaxRiskLevel != "" && riskLevels[countryRisk.RiskTier] > riskLevels[rules.MaxRiskLevel] {
+			decision.deny(address, "JURISDICTION_RISK_EXCEEDED", "%s is rated %s, bond %s allows up to %s", jurisdiction, countryRisk.RiskTier, decision.BondID, rules.MaxRiskLevel)
+		}
+
+		allowed, ok := investorClassesIn(rules.InvestorClasses, jurisdiction)
+		if ok {
+			decision.evaluated("INVESTOR_CLASS")
+		}
+		if ok && !containsString(allowed, class) {
+			decision.deny(address, "INVESTOR_CLASS_NOT_ALLOWED", "bond %s cannot be held by %s investors in %s", decision.BondID, class, jurisdiction)
+		}
+	}
+
+	if address == decision.To {
+		decision.MaxHolding = rules.MaxHoldingByClass[class]
+	}
+
+	tier := kycTier(kyc)
+	tierLimits, err := getKYCTierLimits(ctx, tier)
+	if err != nil {
+		return err
+	}
+	if tierLimits != nil {
+		decision.evaluated("KYC_TIER")
+		if tierLimits.MaxTransferQuantity > 0 && decision.Quantity > tierLimits.MaxTransferQuantity {
+			decision.deny(address, "KYC_TIER_TRANSFER_LIMIT_EXCEEDED", "quantity %d exceeds the %s tier limit of %d for %s", decision.Quantity, tier, tierLimits.MaxTransferQuantity, address)
+		}
+		if address == decision.To && tierLimits.MaxHolding > 0 && (decision.MaxHolding == 0 || tierLimits.MaxHolding < decision.MaxHolding) {
+			decision.MaxHolding = tierLimits.MaxHolding
+		}
+	}
+
+	if rules.MaxRiskLevel != "" {
+		decision.evaluated("RISK_LEVEL")
+	}
+	if rules.MaxRiskLevel != "" && riskLevels[kyc.RiskLevel] > riskLevels[rules.MaxRiskLevel] {
+		decision.deny(address, "RISK_LEVEL_EXCEEDED", "risk level of %s is %s, bond %s allows up to %s", address, kyc.RiskLevel, decision.BondID, rules.MaxRiskLevel)
+	}
+
+	if address == decision.To && len(rules.RequiredConsents) > 0 {
+		decision.evaluated("CONSENT")
+		for _, documentHash := range rules.RequiredConsents {
+			consent, err := getConsent(ctx, address, documentHash)
+			if err != nil {
+				return err
+			}
+			if consent == nil {
+				decision.deny(address, "CONSENT_MISSING", "%s has not accepted document %s required for bond %s", address, documentHash, decision.BondID)
+			}
+		}
+	}
+
+	if address == decision.To && rules.RequiresAccreditation {
+		decision.evaluated("ACCREDITATION")
+		accreditation, err := getAccreditation(ctx, address)
+		if err != nil {
+			return err
+		}
+		if accreditation == nil {
+			decision.deny(address, "ACCREDITATION_MISSING", "%s is not accredited, as bond %s requires", address, decision.BondID)
+		} else if accreditation.expired(now) {
+			decision.deny(address, "ACCREDITATION_EXPIRED", "accreditation of %s expired on %s and must be renewed", address, accreditation.ExpiryDate.Format("2006-01-02"))
+		}
+	}
+
+	return nil
+}
+
+// investorJurisdictions returns the jurisdictions eligibility rules apply to
+// an investor in: their nationality and, if different, their tax residence
+func investorJurisdictions(kyc *KYCRecord) []string {
+	jurisdictions := []string{kyc.Nationality}
+	if kyc.TaxResidence != "" && kyc.TaxResidence != kyc.Nationality {
+		jurisdictions = append(jurisdictions, kyc.TaxResidence)
+	}
+	return jurisdictions
+}
+
+// investorClass returns the approved investor class of an investor,
+// defaulting to RETAIL, the most restricted class
+func investorClass(kyc *KYCRecord) string {
+	if kyc.InvestorClass == "" {
+		return "RETAIL"
+	}
+	return kyc.InvestorClass
+}
+
+// recordType returns the type of a KYC record, defaulting to INDIVIDUAL for
+// records created before corporate records were added
+func recordType(kyc *KYCRecord) string {
+	if kyc.RecordType == "" {
+		return "INDIVIDUAL"
+	}
+	return kyc.RecordType
+}
+
+// validate checks an individual's personal data has what KYC needs
+func (p *KYCPersonalData) validate() error {
+	if p.FullName == "" || len(p.Documents) == 0 {
+		return fmt.Errorf("personal data must include a full name and at least one identity document")
+	}
+	if p.IDType != "" || p.IDNumber != "" {
+		return fmt.Errorf("idType and idNumber are replaced by documents")
+	}
+
+	ids := []string{}
+	for _, document := range p.Documents {
+		if !containsString(identityDocumentTypes, document.Type) {
+			return fmt.Errorf("invalid identity document type: %s", document.Type)
+		}
+		if document.Number == "" {
+			return fmt.Errorf("%s identity document has no number", document.Type)
+		}
+		if !isCountryCode(document.IssuingCountry) {
+			return fmt.Errorf("invalid issuing country: %s", document.IssuingCountry)
+		}
+		if document.ExpiryDate != "" {
+			_, err := time.Parse("2006-01-02", document.ExpiryDate)
+			if err != nil {
+				return fmt.Errorf("invalid expiry date %s, expected YYYY-MM-DD", document.ExpiryDate)
+			}
+		}
+
+		id := document.id()
+		if containsString(ids, id) {
+			return fmt.Errorf("only one %s issued by %s can be given", document.Type, document.IssuingCountry)
+		}
+		ids = append(ids, id)
+	}
+	return nil
+}
+
+// documentStatuses returns the public part of the validated personal
+// data's identity documents, pending verification
+func (p *KYCPersonalData) documentStatuses() []*IdentityDocumentStatus {
+	statuses := []*IdentityDocumentStatus{}
+	for _, document := range p.Documents {
+		status := &IdentityDocumentStatus{
+			ID:             document.id(),
+			Type:           document.Type,
+			IssuingCountry: document.IssuingCountry,
+			Status:         "PENDING",
+		}
+		if document.ExpiryDate != "" {
+			status.ExpiryDate, _ = time.Parse("2006-01-02", document.ExpiryDate)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// identityDocumentHash returns the hash an identity document is indexed
+// under to find other records with the same document
+func identityDocumentHash(document *IdentityDocument) string {
+	return screeningHash(document.Type + " " + document.IssuingCountry + " " + document.Number)
+}
+
+// duplicateIdentities returns the other addresses whose KYC records share
+// an identity document with the personal data, in the order found. Each
+// must be allowed by a duplicate identity override for address.
+func duplicateIdentities(ctx contractapi.TransactionContextInterface, address string, pii *KYCPersonalData) ([]string, error) {
+	var duplicates []string
+	for _, document := range pii.Documents {
+		resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(kycCollection, idHashIndex, []string{identityDocumentHash(document)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get identity index: %v", err)
+		}
+
+		for resultsIterator.HasNext() {
+			queryResult, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return nil, fmt.Errorf("failed to iterate results: %v", err)
+			}
+			_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+			if err != nil {
+				resultsIterator.Close()
+				return nil, fmt.Errorf("failed to split identity index key: %v", err)
+			}
+
+			existing := attributes[1]
+			if existing == address || containsString(duplicates, existing) {
+				continue
+			}
+
+			key, err := ctx.GetStub().CreateCompositeKey(idOverrideObjectType, []string{address, existing})
+			if err != nil {
+				resultsIterator.Close()
+				return nil, fmt.Errorf("failed to create override key: %v", err)
+			}
+			overrideJSON, err := ctx.GetStub().GetState(key)
+			if err != nil {
+				resultsIterator.Close()
+				return nil, fmt.Errorf("failed to read override: %v", err)
+			}
+			if overrideJSON == nil {
+				resultsIterator.Close()
+				return nil, fmt.Errorf("identity document %s is already used by the KYC record of %s; a duplicate identity override is required", document.id(), existing)
+			}
+			duplicates = append(duplicates, existing)
+		}
+		resultsIterator.Close()
+	}
+	return duplicates, nil
+}
+
+// id identifies an identity document on its KYC record
+func (d *IdentityDocument) id() string {
+	return d.Type + "-" + d.IssuingCountry
+}
+
+// expired reports whether an identity document has expired by now
+func (d *IdentityDocumentStatus) expired(now time.Time) bool {
+	return !d.ExpiryDate.IsZero() && !now.Before(d.ExpiryDate)
+}
+
+// expired reports whether an accreditation has expired by a time
+func (a *Accreditation) expired(at time.Time) bool {
+	return !at.Before(a.ExpiryDate)
+}
+
+// identityDocumentsExpired reports whether a KYC record had identity
+// documents verified and all of them have since expired
+func identityDocumentsExpired(kyc *KYCRecord, now time.Time) bool {
+	verified := false
+	for _, document := range kyc.IdentityDocuments {
+		if document.Status != "VERIFIED" {
+			continue
+		}
+		if !document.expired(now) {
+			return false
+		}
+		verified = true
+	}
+	return verified
+}
+
+// validate checks a corporate investor's entity data has what KYC needs
+func (d *KYCEntityData) validate() error {
+	if d.LegalName == "" || d.RegistrationNumber == "" {
+		return fmt.Errorf("entity data must include a legal name and registration number")
+	}
+	if len(d.Directors) == 0 {
+		return fmt.Errorf("entity data must include at least one director")
+	}
+	for _, director := range d.Directors {
+		if director.FullName == "" {
+			return fmt.Errorf("every director must have a full name")
+		}
+	}
+	return nil
+}
+
+// isLEI reports whether a code is a valid ISO 17442 legal entity
+// identifier: 20 upper-case letters and digits whose ISO 7064 MOD 97-10
+// check digits are correct
+func isLEI(code string) bool {
+	if len(code) != 20 {
+		return false
+	}
+	remainder := 0
+	for _, r := range code {
+		var value int
+		switch {
+		case r >= '0' && r <= '9':
+			value = int(r - '0')
+			remainder = (remainder*10 + value) % 97
+		case r >= 'A' && r <= 'Z':
+			value = int(r-'A') + 10
+			remainder = (remainder*100 + value) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// validate checks the values a scenario changes KYC records and limits to
+func (s *TransferScenario) validate() error {
+	for address, change := range s.KYC {
+		if change == nil {
+			return fmt.Errorf("KYC change for %s is empty", address)
+		}
+		if change.Status != "" && !containsString([]string{"PENDING", "APPROVED", "REJECTED", "SUSPENDED", "EXPIRED", "ERASED"}, change.Status) {
+			return fmt.Errorf("invalid KYC status for %s: %s", address, change.Status)
+		}
+		if _, ok := riskLevels[change.RiskLevel]; change.RiskLevel != "" && !ok {
+			return fmt.Errorf("invalid risk level for %s: %s", address, change.RiskLevel)
+		}
+		for _, country := range []string{change.Nationality, change.TaxResidence} {
+			if country != "" && !isCountryCode(country) {
+				return fmt.Errorf("invalid country for %s: %s", address, country)
+			}
+		}
+		if change.InvestorClass != "" && !isInvestorClass(change.InvestorClass) {
+			return fmt.Errorf("invalid investor class for %s: %s", address, change.InvestorClass)
+		}
+		if _, ok := kycTiers[change.KYCTier]; change.KYCTier != "" && !ok {
+			return fmt.Errorf("invalid KYC tier for %s: %s", address, change.KYCTier)
+		}
+	}
+	for _, limit := range s.Limits {
+		if limit == nil || limit.Address == "" || limit.BondID == "" {
+			return fmt.Errorf("hypothetical limits need an address and bond ID")
+		}
+		if limit.MaxHolding < 0 || limit.MaxDailyVolume < 0 {
+			return fmt.Errorf("limits cannot be negative")
+		}
+	}
+	return nil
+}
+
+// applyKYC returns an address's KYC record with the scenario's change
+// applied, as a copy, or the record itself if there is no change. kyc is
+// nil for an address without a record.
+func (s *TransferScenario) applyKYC(address string, kyc *KYCRecord) *KYCRecord {
+	if s == nil || s.KYC[address] == nil {
+		return kyc
+	}
+	change := s.KYC[address]
+
+	changed := KYCRecord{Address: address, Status: "PENDING"}
+	if kyc != nil {
+		changed = *kyc
+	}
+	if change.Status != "" {
+		changed.Status = change.Status
+	}
+	if change.RiskLevel != "" {
+		changed.RiskLevel = change.RiskLevel
+	}
+	if change.Nationality != "" {
+		changed.Nationality = change.Nationality
+	}
+	if change.TaxResidence != "" {
+		changed.TaxResidence = change.TaxResidence
+	}
+	if change.InvestorClass != "" {
+		changed.InvestorClass = change.InvestorClass
+	}
+	if change.KYCTier != "" {
+		changed.KYCTier = change.KYCTier
+	}
+	return &changed
+}
+
+// limit returns the scenario's limit of an address in a scope, or nil if
+// it keeps the current one
+func (s *TransferScenario) limit(address, scope string) *InvestorLimit {
+	if s == nil {
+		return nil
+	}
+	for _, limit := range s.Limits {
+		if limit.Address == address && limit.BondID == scope {
+			return limit
+		}
+	}
+	return nil
+}
+
+// kycTier returns the approved KYC tier of an investor, defaulting to BASIC
+func kycTier(kyc *KYCRecord) string {
+	if kyc.KYCTier == "" {
+		return "BASIC"
+	}
+	return kyc.KYCTier
+}
+
+// isInvestorClass reports whether a class is one an investor can be given
+func isInvestorClass(class string) bool {
+	switch class {
+	case "RETAIL", "PROFESSIONAL", "QIB", "INSTITUTIONAL":
+		return true
+	}
+	return false
+}
+
+// isCountryCode reports whether a code looks like an ISO 3166-1 alpha-2
+// country code
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// deny records a rule the transfer breaks
+func (d *TransferDecision) deny(address, code, format string, args ...interface{}) {
+	d.Reasons = append(d.Reasons, &TransferReason{Address: address, ReasonCode: code, Reason: fmt.Sprintf(format, args...)})
+}
+
+// validate checks the jurisdictions, investor classes, risk level and
+// limits of transfer rules
+func (rules *TransferRules) validate() error {
+	jurisdictions := append(append([]string{}, rules.BlockedJurisdictions...), rules.AllowedJurisdictions...)
+	for jurisdiction, classes := range rules.InvestorClasses {
+		if jurisdiction != "*" {
+			jurisdictions = append(jurisdictions, jurisdiction)
+		}
+		for _, class := range classes {
+			if !isInvestorClass(class) {
+				return fmt.Errorf("invalid investor class: %s", class)
+			}
+		}
+	}
+	for _, jurisdiction := range jurisdictions {
+		if !isCountryCode(jurisdiction) {
+			return fmt.Errorf("invalid jurisdiction: %s", jurisdiction)
+		}
+	}
+
+	if rules.MaxRiskLevel != "" && riskLevels[rules.MaxRiskLevel] == 0 {
+		return fmt.Errorf("invalid risk level: %s", rules.MaxRiskLevel)
+	}
+	if rules.MaxTransferQuantity < 0 {
+		return fmt.Errorf("transfer limit cannot be negative")
+	}
+	if rules.UnitValue < 0 {
+		return fmt.Errorf("unit value cannot be negative")
+	}
+	for _, documentHash := range rules.RequiredConsents {
+		if !isSHA256Hex(documentHash) {
+			return fmt.Errorf("invalid consent document hash %s, expected lower-case hex SHA-256", documentHash)
+		}
+	}
+	for class, maxHolding := range rules.MaxHoldingByClass {
+		if !isInvestorClass(class) {
+			return fmt.Errorf("invalid investor class: %s", class)
+		}
+		if maxHolding < 0 {
+			return fmt.Errorf("holding limit for %s cannot be negative", class)
+		}
+	}
+
+	return nil
+}
+
+// tighten layers an organisation's policy on the rules, keeping the
+// stricter of each restriction: jurisdictions either blocks are blocked,
+// only jurisdictions and investor classes both allow are allowed, and the
+// lower risk level and limits apply
+func (rules *TransferRules) tighten(policy *OrgPolicy) {
+	for _, jurisdiction := range policy.BlockedJurisdictions {
+		if !containsString(rules.BlockedJurisdictions, jurisdiction) {
+			rules.BlockedJurisdictions = append(rules.BlockedJurisdictions, jurisdiction)
+		}
+	}
+
+	if len(rules.AllowedJurisdictions) == 0 {
+		rules.AllowedJurisdictions = policy.AllowedJurisdictions
+	} else if len(policy.AllowedJurisdictions) > 0 {
+		// Blocking the jurisdictions the policy does not allow leaves only
+		// those both allow, even when there are none
+		for _, jurisdiction := range rules.AllowedJurisdictions {
+			if !containsString(policy.AllowedJurisdictions, jurisdiction) && !containsString(rules.BlockedJurisdictions, jurisdiction) {
+				rules.BlockedJurisdictions = append(rules.BlockedJurisdictions, jurisdiction)
+			}
+		}
+	}
+
+	if policy.MaxRiskLevel != "" && (rules.MaxRiskLevel == "" || riskLevels[policy.MaxRiskLevel] < riskLevels[rules.MaxRiskLevel]) {
+		rules.MaxRiskLevel = policy.MaxRiskLevel
+	}
+	rules.MaxTransferQuantity = lowerLimit(rules.MaxTransferQuantity, policy.MaxTransferQuantity)
+
+	if len(policy.InvestorClasses) > 0 {
+		investorClasses := map[string][]string{}
+		for _, classes := range []map[string][]string{rules.InvestorClasses, policy.InvestorClasses} {
+			for jurisdiction := range classes {
+				ruleClasses, ruleOK := investorClassesIn(rules.InvestorClasses, jurisdiction)
+				policyClasses, policyOK := investorClassesIn(policy.InvestorClasses, jurisdiction)
+				switch {
+				case !policyOK:
+					investorClasses[jurisdiction] = ruleClasses
+				case !ruleOK:
+					investorClasses[jurisdiction] = policyClasses
+				default:
+					both := []string{}
+					for _, class := range ruleClasses {
+						if containsString(policyClasses, class) {
+							both = append(both, class)
+						}
+					}
+					investorClasses[jurisdiction] = both
+				}
+			}
+		}
+		rules.InvestorClasses = investorClasses
+	}
+
+	if len(policy.MaxHoldingByClass) > 0 {
+		maxHoldingByClass := map[string]int64{}
+		for class, maxHolding := range rules.MaxHoldingByClass {
+			maxHoldingByClass[class] = maxHolding
+		}
+		for class, maxHolding := range policy.MaxHoldingByClass {
+			maxHoldingByClass[class] = lowerLimit(maxHoldingByClass[class], maxHolding)
+		}
+		rules.MaxHoldingByClass = maxHoldingByClass
+	}
+}
+
+// transferRules returns the policy's restrictions as transfer rules
+func (p *OrgPolicy) transferRules() *TransferRules {
+	return &TransferRules{
+		BlockedJurisdictions: p.BlockedJurisdictions,
+		AllowedJurisdictions: p.AllowedJurisdictions,
+		MaxRiskLevel:         p.MaxRiskLevel,
+		MaxTransferQuantity:  p.MaxTransferQuantity,
+		InvestorClasses:      p.InvestorClasses,
+		MaxHoldingByClass:    p.MaxHoldingByClass,
+	}
+}
+
+// investorClassesIn returns the investor classes an eligibility matrix
+// allows in a jurisdiction, falling back to its "*" entry, and whether it
+// restricts them there at all
+func investorClassesIn(investorClasses map[string][]string, jurisdiction string) ([]string, bool) {
+	classes, ok := investorClasses[jurisdiction]
+	if !ok {
+		classes, ok = investorClasses["*"]
+	}
+	return classes, ok
+}
+
+// lowerLimit returns the stricter of two limits where 0 means no limit
+func lowerLimit(a, b int64) int64 {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// evaluated records a rule checked in making the decision
+func (d *TransferDecision) evaluated(rule string) {
+	if !containsString(d.RulesEvaluated, rule) {
+		d.RulesEvaluated = append(d.RulesEvaluated, rule)
+	}
+}
+
+// requiredAMLChecks are the AML checks an investor must have passed, and
+// kept current, to be in good standing
+var requiredAMLChecks = []string{"SANCTIONS", "PEP"}
+
+// riskLevels orders the KYC risk levels
+var riskLevels = map[string]int{"LOW": 1, "MEDIUM": 2, "HIGH": 3}
+
+// kycTiers orders the KYC tiers
+var kycTiers = map[string]int{"BASIC": 1, "STANDARD": 2, "ENHANCED": 3}
+
+// rescreeningYears is how often, in years, investors of each risk level
+// have their KYC reviewed and AML checks refreshed
+var rescreeningYears = map[string]int{"LOW": 3, "MEDIUM": 2, "HIGH": 1}
+
+// reviewYears returns how often, in years, an investor's KYC is reviewed.
+// Investors without a risk level are reviewed as HIGH risk.
+func reviewYears(kyc *KYCRecord) int {
+	years, ok := rescreeningYears[kyc.RiskLevel]
+	if !ok {
+		return rescreeningYears["HIGH"]
+	}
+	return years
+}
+
+// kycReviewDate returns when an approved KYC record is due for review:
+// reviewYears after it was approved, or after it was created if it has no
+// approval date. Records with neither are reviewed from now.
+func kycReviewDate(kyc *KYCRecord, now time.Time) time.Time {
+	lastReviewed := kyc.ApprovedAt
+	if lastReviewed.IsZero() {
+		lastReviewed = kyc.CreatedAt
+	}
+	if lastReviewed.IsZero() {
+		lastReviewed = now
+	}
+	return lastReviewed.AddDate(reviewYears(kyc), 0, 0)
+}
+
+// sanctionsMatches returns the sanctions list entries in effect at asOf
+// whose name or identifier hashes include hash
+func sanctionsMatches(ctx contractapi.TransactionContextInterface, hash, matchedOn string, asOf time.Time) ([]*SanctionsMatch, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(sanctionHashIndex, []string{hash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sanctions index: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var matches []*SanctionsMatch
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split sanctions index key: %v", err)
+		}
+
+		entry, err := getSanctionsEntry(ctx, attributes[1], attributes[2])
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil || entry.Removed || entry.EffectiveDate.After(asOf) {
+			continue
+		}
+		if entry.NameHash != hash && !containsString(entry.IdentifierHashes, hash) {
+			continue
+		}
+
+		matches = append(matches, &SanctionsMatch{Source: entry.Source, EntryID: entry.ID, MatchedOn: matchedOn})
+	}
+
+	return matches, nil
+}
+
+// getSanctionsEntry returns an entry of the sanctions list from source, or
+// nil if there is none
+func getSanctionsEntry(ctx contractapi.TransactionContextInterface, source, entryID string) (*SanctionsEntry, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(sanctionObjectType, []string{source, entryID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sanctions entry key: %v", err)
+	}
+
+	entryJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sanctions entry: %v", err)
+	}
+	if entryJSON == nil {
+		return nil, nil
+	}
+
+	var entry SanctionsEntry
+	err = json.Unmarshal(entryJSON, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sanctions entry: %v", err)
+	}
+
+	return &entry, nil
+}
+
+// normaliseForScreening upper-cases a name or identifier and collapses its
+// whitespace, so list entries and KYC data hash alike
+func normaliseForScreening(value string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(value)), " ")
+}
+
+// screeningHash returns the hex SHA-256 hash sanctions list entries store
+// for a name or identifier
+func screeningHash(value string) string {
+	hash := sha256.Sum256([]byte(normaliseForScreening(value)))
+	return hex.EncodeToString(hash[:])
+}
+
+// isSHA256Hex reports whether a string is a lower-case hex SHA-256 hash
+func isSHA256Hex(value string) bool {
+	decoded, err := hex.DecodeString(value)
+	return err == nil && len(decoded) == sha256.Size && value == strings.ToLower(value)
+}
+
+// containsString reports whether values includes value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// requireRole checks that the invoking identity carries one of the given
+// values in its "role" certificate attribute
+func requireRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	for _, role := range roles {
+		if ctx.GetClientIdentity().AssertAttributeValue("role", role) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("caller is not authorized: %s role required", strings.Join(roles, " or "))
+}
+
+// requireTransferPath checks that the client's proposal invoked one of the
+// transferPaths. A chaincode called with InvokeChaincode sees the proposal
+// the client signed, so this holds however many contracts the call passed
+// through, and fails when the client called compliance itself.
+func requireTransferPath(ctx contractapi.TransactionContextInterface) error {
+	signedProposal, err := ctx.GetStub().GetSignedProposal()
+	if err != nil {
+		return fmt.Errorf("failed to get signed proposal: %v", err)
+	}
+
+	var proposal peer.Proposal
+	err = proto.Unmarshal(signedProposal.GetProposalBytes(), &proposal)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal proposal: %v", err)
+	}
+	var payload peer.ChaincodeProposalPayload
+	err = proto.Unmarshal(proposal.GetPayload(), &payload)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal proposal payload: %v", err)
+	}
+	var invocation peer.ChaincodeInvocationSpec
+	err = proto.Unmarshal(payload.GetInput(), &invocation)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal chaincode invocation: %v", err)
+	}
+
+	chaincode := invocation.GetChaincodeSpec().GetChaincodeId().GetName()
+	function := ""
+	args := invocation.GetChaincodeSpec().GetInput().GetArgs()
+	if len(args) > 0 {
+		// The contract API accepts functions qualified by contract name
+		function = string(args[0])
+		if i := strings.LastIndex(function, ":"); i >= 0 {
+			function = function[i+1:]
+		}
+	}
+
+	if allowed, ok := transferPaths[chaincode]; !ok || allowed != function {
+		return fmt.Errorf("caller is not authorized: transfers may only be recorded by %s Transfer or %s SettleTrade", bondTokenChaincode, settlementChaincode)
+	}
+	return nil
+}
+
+// callerAddress returns the ledger address of the submitting client: its
+// "address" identity attribute, or its identity ID when it has none
+func callerAddress(ctx contractapi.TransactionContextInterface) (string, error) {
+	address, found, err := ctx.GetClientIdentity().GetAttributeValue("address")
+	if err != nil {
+		return "", fmt.Errorf("failed to read address attribute: %v", err)
+	}
+	if found && address != "" {
+		return address, nil
+	}
+
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+	return id, nil
+}
+
+// enrollmentID returns the enrollment ID of the invoking identity, from the
+// hf.EnrollmentID attribute the Fabric CA adds to certificates, falling back
+// to the certificate's common name, which the CA sets to the same value
+func enrollmentID(ctx contractapi.TransactionContextInterface) (string, error) {
+	id, found, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	if err != nil {
+		return "", fmt.Errorf("failed to get enrollment ID: %v", err)
+	}
+	if found && id != "" {
+		return id, nil
+	}
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client certificate: %v", err)
+	}
+	if cert == nil || cert.Subject.CommonName == "" {
+		return "", fmt.Errorf("client identity has no enrollment ID")
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// kycKey returns the KYC~address composite key
+func kycKey(ctx contractapi.TransactionContextInterface, address string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(kycObjectType, []string{address})
+	if err != nil {
+		return "", fmt.Errorf("failed to create KYC key: %v", err)
+	}
+	return key, nil
+}
+
+// amlKey returns the AML~address~checkType composite key
+func amlKey(ctx contractapi.TransactionContextInterface, address, checkType string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(amlObjectType, []string{address, checkType})
+	if err != nil {
+		return "", fmt.Errorf("failed to create AML check key: %v", err)
+	}
+	return key, nil
+}
+
+// transferRulesKey returns the TRANSFERRULES~bondID~version composite key
+func transferRulesKey(ctx contractapi.TransactionContextInterface, bondID string, version int64) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(transferRulesObjectType, []string{bondID, strconv.FormatInt(version, 10)})
+	if err != nil {
+		return "", fmt.Errorf("failed to create transfer rules key: %v", err)
+	}
+	return key, nil
+}
+
+// getAMLCheck returns an address's AML check of the given type, or nil if
+// there is none
+func getAMLCheck(ctx contractapi.TransactionContextInterface, address, checkType string) (*AMLCheck, error) {
+	key, err := amlKey(ctx, address, checkType)
+	if err != nil {
+		return nil, err
+	}
+
+	checkJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AML check: %v", err)
+	}
+	if checkJSON == nil {
+		return nil, nil
+	}
+
+	var amlCheck AMLCheck
+	err = json.Unmarshal(checkJSON, &amlCheck)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal AML check: %v", err)
+	}
+
+	return &amlCheck, nil
+}
+
+// getConsent returns an investor's consent to a document, or nil if none is
+// recorded
+func getConsent(ctx contractapi.TransactionContextInterface, address, documentHash string) (*Consent, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(consentObjectType, []string{address, documentHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consent key: %v", err)
+	}
+
+	consentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read consent: %v", err)
+	}
+	if consentJSON == nil {
+		return nil, nil
+	}
+
+	var consent Consent
+	err = json.Unmarshal(consentJSON, &consent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal consent: %v", err)
+	}
+	return &consent, nil
+}
+
+// getAccreditation returns an investor's accreditation, or nil if none is
+// recorded
+func getAccreditation(ctx contractapi.TransactionContextInterface, address string) (*Accreditation, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(accreditationObjectType, []string{address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create accreditation key: %v", err)
+	}
+
+	accreditationJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accreditation: %v", err)
+	}
+	if accreditationJSON == nil {
+		return nil, nil
+	}
+
+	var accreditation Accreditation
+	err = json.Unmarshal(accreditationJSON, &accreditation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal accreditation: %v", err)
+	}
+	return &accreditation, nil
+}
+
+// getOrgPolicy returns an organisation's policy for a scope, or nil if it
+// has none
+func getOrgPolicy(ctx contractapi.TransactionContextInterface, mspID, scope string) (*OrgPolicy, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(orgPolicyObjectType, []string{mspID, scope})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organisation policy key: %v", err)
+	}
+
+	policyJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read organisation policy: %v", err)
+	}
+	if policyJSON == nil {
+		return nil, nil
+	}
+
+	var policy OrgPolicy
+	err = json.Unmarshal(policyJSON, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal organisation policy: %v", err)
+	}
+	return &policy, nil
+}
+
+// getTransferRules returns the version of a bond's transfer rules in effect
+// at the given time, or empty rules if there is none
+func getTransferRules(ctx contractapi.TransactionContextInterface, bondID string, at time.Time) (*TransferRules, error) {
+	versions, err := transferRulesVersions(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Later versions take precedence over earlier ones they overlap
+	for i := len(versions) - 1; i >= 0; i-- {
+		rules := versions[i]
+		if rules.EffectiveFrom.After(at) {
+			continue
+		}
+		if !rules.EffectiveTo.IsZero() && !at.Before(rules.EffectiveTo) {
+			continue
+		}
+		return rules, nil
+	}
+
+	return &TransferRules{BondID: bondID}, nil
+}
+
+// transferRulesVersions returns every version of a bond's transfer rules,
+// oldest first. Rules stored before versioning come back as version 0.
+func transferRulesVersions(ctx contractapi.TransactionContextInterface, bondID string) ([]*TransferRules, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(transferRulesObjectType, []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer rules: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	versions := []*TransferRules{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var rules TransferRules
+		err = json.Unmarshal(queryResult.Value, &rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal transfer rules: %v", err)
+		}
+		versions = append(versions, &rules)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions, nil
+}
+
+// checkLimits denies a transfer that would take a party over its holding or
+// daily volume limits, in the bond or globally, and returns the party's
+// utilization records with the transfer counted in
+func checkLimits(ctx contractapi.TransactionContextInterface, decision *TransferDecision, address string, now time.Time, scenario *TransferScenario) ([]*LimitUtilization, error) {
+	var usages []*LimitUtilization
+	for _, scope := range []string{decision.BondID, globalLimitScope} {
+		limit, err := getInvestorLimit(ctx, address, scope)
+		if err != nil {
+			return nil, err
+		}
+		if hypothetical := scenario.limit(address, scope); hypothetical != nil {
+			limit = hypothetical
+		}
+		usage, err := getLimitUtilization(ctx, address, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only trades within the rolling window count towards the volume
+		var volume int64
+		trades := []*LimitTrade{}
+		for _, trade := range usage.Trades {
+			if now.Sub(trade.Timestamp) < limitWindow {
+				volume += trade.Quantity
+				trades = append(trades, trade)
+			}
+		}
+
+		if limit != nil && limit.MaxDailyVolume > 0 {
+			decision.evaluated("DAILY_VOLUME")
+		}
+		if limit != nil && limit.MaxHolding > 0 && address == decision.To {
+			decision.evaluated("HOLDING_LIMIT")
+		}
+		if limit != nil && limit.MaxDailyVolume > 0 && volume+decision.Quantity > limit.MaxDailyVolume {
+			decision.deny(address, "DAILY_VOLUME_EXCEEDED", "transfer would take the %s volume of %s to %d tokens in 24 hours, above the limit of %d", scope, address, volume+decision.Quantity, limit.MaxDailyVolume)
+		}
+		if limit != nil && limit.MaxHolding > 0 && address == decision.To && usage.Holding+decision.Quantity > limit.MaxHolding {
+			decision.deny(address, "HOLDING_LIMIT_EXCEEDED", "transfer would take the %s holding of %s to %d tokens, above the limit of %d", scope, address, usage.Holding+decision.Quantity, limit.MaxHolding)
+		}
+
+		// Velocity rules count transfers across all bonds
+		if scope == globalLimitScope {
+			err = checkVelocity(ctx, decision, address, trades, now)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		usage.Trades = append(trades, &LimitTrade{Quantity: decision.Quantity, Timestamp: now, TxID: ctx.GetStub().GetTxID(), Value: decision.Value})
+		if address == decision.To {
+			usage.Holding += decision.Quantity
+		} else {
+			usage.Holding -= decision.Quantity
+			if usage.Holding < 0 {
+				usage.Holding = 0
+			}
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// checkVelocity adds to decision the velocity rules a transfer would take
+// an address past, given its allowed transfers within the last 24 hours
+func checkVelocity(ctx contractapi.TransactionContextInterface, decision *TransferDecision, address string, trades []*LimitTrade, now time.Time) error {
+	velocity, err := getVelocityRules(ctx)
+	if err != nil {
+		return err
+	}
+	if velocity == nil {
+		return nil
+	}
+
+	for _, rule := range velocity.Rules {
+		decision.evaluated("VELOCITY")
+
+		window := time.Duration(rule.WindowHours) * time.Hour
+		count := 1
+		value := decision.Value
+		for _, trade := range trades {
+			if now.Sub(trade.Timestamp) < window {
+				count++
+				value += trade.Value
+			}
+		}
+
+		if rule.MaxTransfers > 0 && count > rule.MaxTransfers {
+			decision.deny(address, "VELOCITY_EXCEEDED", "transfer would be transfer %d of %s in %d hours, above the limit of %d (rule %s)", count, address, rule.WindowHours, rule.MaxTransfers, rule.ID)
+		} else if rule.MaxValue > 0 && value > rule.MaxValue {
+			decision.deny(address, "VELOCITY_EXCEEDED", "transfer would take the value moved by %s in %d hours to %.2f, above the limit of %.2f (rule %s)", address, rule.WindowHours, value, rule.MaxValue, rule.ID)
+		}
+	}
+	return nil
+}
+
+// getVelocityRules returns the velocity rules, or nil if none have been set
+func getVelocityRules(ctx contractapi.TransactionContextInterface) (*VelocityRules, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(velocityRulesObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create velocity rules key: %v", err)
+	}
+
+	velocityJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read velocity rules: %v", err)
+	}
+	if velocityJSON == nil {
+		return nil, nil
+	}
+
+	var velocity VelocityRules
+	err = json.Unmarshal(velocityJSON, &velocity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal velocity rules: %v", err)
+	}
+
+	return &velocity, nil
+}
+
+// emitKYCStatusEvent emits a KYC status change under its own event name,
+// stamped with the payload schema version and transaction ID
+func emitKYCStatusEvent(ctx contractapi.TransactionContextInterface, name string, event *KYCStatusEvent) error {
+	event.SchemaVersion = kycStatusEventSchemaVersion
+	event.TxID = ctx.GetStub().GetTxID()
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// emitTransferDecision emits the outcome of a transfer check with the
+// rules evaluated and broken, for surveillance. A denied transfer that
+// breaks an investor limit is emitted as a LimitBreached event, and any
+// other decision as a TransferDecision event.
+func emitTransferDecision(ctx contractapi.TransactionContextInterface, decision *TransferDecision, now time.Time) error {
+	event := ComplianceEvent{
+		Type:      "TRANSFER_ALLOWED",
+		Address:   decision.To,
+		Details:   fmt.Sprintf("Transfer of %d %s from %s to %s allowed", decision.Quantity, decision.BondID, decision.From, decision.To),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		Outcome:        "ALLOWED",
+		BondID:         decision.BondID,
+		PolicyVersion:  decision.PolicyVersion,
+		RulesEvaluated: decision.RulesEvaluated,
+		Reasons:        decision.Reasons,
+		Flags:          decision.Flags,
+		Exempted:       decision.Exempted,
+	}
+	eventName := "TransferDecision"
+
+	if !decision.Allowed {
+		event.Type = "TRANSFER_DENIED"
+		event.Outcome = "DENIED"
+		event.Details = fmt.Sprintf("Transfer of %d %s from %s to %s denied: %s", decision.Quantity, decision.BondID, decision.From, decision.To, decision.Reasons[0].Reason)
+		if decision.Reasons[0].Address != "" {
+			event.Address = decision.Reasons[0].Address
+		}
+	}
+
+	for _, reason := range decision.Reasons {
+		if !containsString([]string{"DAILY_VOLUME_EXCEEDED", "HOLDING_LIMIT_EXCEEDED", "VELOCITY_EXCEEDED"}, reason.ReasonCode) {
+			continue
+		}
+		event.Type = reason.ReasonCode
+		event.Address = reason.Address
+		event.Details = reason.Reason
+		eventName = "LimitBreached"
+		break
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent(eventName, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// addToList adds an address to the blacklist or watchlist, or replaces the
+// reason and dates of its entry, recording the change in its history. Only
+// compliance officers and the compliance admin may change the lists.
+func addToList(ctx contractapi.TransactionContextInterface, list, address, reasonCode, reason, effectiveFromStr, effectiveToStr string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if address == "" || reasonCode == "" {
+		return fmt.Errorf("address and reason code are required")
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	effectiveFrom := now
+	if effectiveFromStr != "" {
+		effectiveFrom, err = time.Parse("2006-01-02", effectiveFromStr)
+		if err != nil {
+			return fmt.Errorf("invalid effective from date: %v", err)
+		}
+	}
+	var effectiveTo time.Time
+	if effectiveToStr != "" {
+		effectiveTo, err = time.Parse("2006-01-02", effectiveToStr)
+		if err != nil {
+			return fmt.Errorf("invalid effective to date: %v", err)
+		}
+		if !effectiveTo.After(effectiveFrom) {
+			return fmt.Errorf("effective to date must be after effective from date")
+		}
+	}
+
+	changedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry, err := getListEntry(ctx, list, address)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		entry = &ListEntry{Address: address, List: list, History: []*ListChange{}}
+	}
+
+	entry.ReasonCode = reasonCode
+	entry.Reason = reason
+	entry.EffectiveFrom = effectiveFrom
+	entry.EffectiveTo = effectiveTo
+	entry.Active = true
+	entry.UpdatedAt = now
+	entry.TxID = ctx.GetStub().GetTxID()
+	entry.History = append(entry.History, &ListChange{
+		Action:        "ADDED",
+		ReasonCode:    reasonCode,
+		Reason:        reason,
+		EffectiveFrom: effectiveFrom,
+		EffectiveTo:   effectiveTo,
+		ChangedBy:     changedBy,
+		ChangedAt:     now,
+		TxID:          entry.TxID,
+	})
+
+	return putListEntry(ctx, entry, list+"_ADDED", fmt.Sprintf("%s added to %s: %s", address, strings.ToLower(list), reasonCode))
+}
+
+// removeFromList deactivates an address's blacklist or watchlist entry,
+// recording the change in its history
+func removeFromList(ctx contractapi.TransactionContextInterface, list, address, reason string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+
+	entry, err := getListEntry(ctx, list, address)
+	if err != nil {
+		return err
+	}
+	if entry == nil || !entry.Active {
+		return fmt.Errorf("%s is not on the %s", address, strings.ToLower(list))
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	changedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry.Active = false
+	entry.UpdatedAt = now
+	entry.TxID = ctx.GetStub().GetTxID()
+	entry.History = append(entry.History, &ListChange{
+		Action:    "REMOVED",
+		Reason:    reason,
+		ChangedBy: changedBy,
+		ChangedAt: now,
+		TxID:      entry.TxID,
+	})
+
+	return putListEntry(ctx, entry, list+"_REMOVED", fmt.Sprintf("%s removed from %s: %s", address, strings.ToLower(list), reason))
+}
+
+// putListEntry stores a list entry and emits the event for its change
+func putListEntry(ctx contractapi.TransactionContextInterface, entry *ListEntry, eventType, details string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(entry.List, []string{entry.Address})
+	if err != nil {
+		return fmt.Errorf("failed to create list key: %v", err)
+	}
+
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal list entry: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, entryJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store list entry: %v", err)
+	}
+
+	// Emit event
+	event := ComplianceEvent{
+		Type:      eventType,
+		Address:   entry.Address,
+		Details:   details,
+		Timestamp: entry.UpdatedAt,
+		TxID:      entry.TxID,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// getListEntry returns an address's entry on a list, or nil if it has never
+// been listed
+func getListEntry(ctx contractapi.TransactionContextInterface, list, address string) (*ListEntry, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(list, []string{address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create list key: %v", err)
+	}
+
+	entryJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read list entry: %v", err)
+	}
+	if entryJSON == nil {
+		return nil, nil
+	}
+
+	var entry ListEntry
+	err = json.Unmarshal(entryJSON, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal list entry: %v", err)
+	}
+
+	return &entry, nil
+}
+
+// getListEntryOrFail is getListEntry for callers that need the entry to
+// exist
+func getListEntryOrFail(ctx contractapi.TransactionContextInterface, list, address string) (*ListEntry, error) {
+	entry, err := getListEntry(ctx, list, address)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%s has never been on the %s", address, strings.ToLower(list))
+	}
+	return entry, nil
+}
+
+// getHolds returns the holds placed on an address
+func getHolds(ctx contractapi.TransactionContextInterface, address string) ([]*ComplianceHold, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(holdObjectType, []string{address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hold key: %v", err)
+	}
+
+	holdsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holds: %v", err)
+	}
+	holds := []*ComplianceHold{}
+	if holdsJSON == nil {
+		return holds, nil
+	}
+
+	err = json.Unmarshal(holdsJSON, &holds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal holds: %v", err)
+	}
+
+	return holds, nil
+}
+
+// putHolds stores the holds placed on an address
+func putHolds(ctx contractapi.TransactionContextInterface, address string, holds []*ComplianceHold) error {
+	key, err := ctx.GetStub().CreateCompositeKey(holdObjectType, []string{address})
+	if err != nil {
+		return fmt.Errorf("failed to create hold key: %v", err)
+	}
+
+	holdsJSON, err := json.Marshal(holds)
+	if err != nil {
+		return fmt.Errorf("failed to marshal holds: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, holdsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store holds: %v", err)
+	}
+
+	return nil
+}
+
+// activeHold returns an active hold covering a bond, or nil if there is none
+func activeHold(holds []*ComplianceHold, bondID string) *ComplianceHold {
+	for _, hold := range holds {
+		if hold.Status == "ACTIVE" && (hold.BondID == "" || hold.BondID == bondID) {
+			return hold
+		}
+	}
+	return nil
+}
+
+// queryBondToken calls a read-only function of the BondToken contract and
+// unmarshals its JSON result into result
+func queryBondToken(ctx contractapi.TransactionContextInterface, result interface{}, function string, args ...string) error {
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, invokeArgs, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to query BondToken %s: %s", function, response.Message)
+	}
+
+	err := json.Unmarshal(response.Payload, result)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal BondToken %s result: %v", function, err)
+	}
+	return nil
+}
+
+// invokeComplianceHold calls PlaceComplianceHold or ReleaseComplianceHold
+// on the BondToken contract for a hold and returns the number of holdings
+// it changed. The caller's identity is passed through, so the BondToken
+// contract checks the same compliance role.
+func invokeComplianceHold(ctx contractapi.TransactionContextInterface, function string, hold *ComplianceHold) (int, error) {
+	args := [][]byte{[]byte(function), []byte(hold.ID), []byte(hold.Address), []byte(hold.BondID)}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return 0, fmt.Errorf("failed to update holdings of %s: %s", hold.Address, response.Message)
+	}
+
+	holdings, err := strconv.Atoi(string(response.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse held holdings: %v", err)
+	}
+	return holdings, nil
+}
+
+// exemptableReasonCodes are the CheckTransfer denials an exemption can
+// waive. Denials for the holder's KYC, AML, sanctions, blacklist or holds
+// are never exempted.
+var exemptableReasonCodes = []string{
+	"JURISDICTION_BLOCKED",
+	"JURISDICTION_NOT_ALLOWED",
+	"JURISDICTION_RISK_EXCEEDED",
+	"INVESTOR_CLASS_NOT_ALLOWED",
+	"KYC_TIER_TRANSFER_LIMIT_EXCEEDED",
+	"RISK_LEVEL_EXCEEDED",
+	"DAILY_VOLUME_EXCEEDED",
+	"HOLDING_LIMIT_EXCEEDED",
+	"VELOCITY_EXCEEDED",
+}
+
+// getExemptions returns the exemptions requested for an address
+func getExemptions(ctx contractapi.TransactionContextInterface, address string) ([]*Exemption, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(exemptionObjectType, []string{address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exemption key: %v", err)
+	}
+
+	exemptionsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exemptions: %v", err)
+	}
+	exemptions := []*Exemption{}
+	if exemptionsJSON == nil {
+		return exemptions, nil
+	}
+
+	err = json.Unmarshal(exemptionsJSON, &exemptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal exemptions: %v", err)
+	}
+
+	return exemptions, nil
+}
+
+// putExemptions stores the exemptions requested for an address
+func putExemptions(ctx contractapi.TransactionContextInterface, address string, exemptions []*Exemption) error {
+	key, err := ctx.GetStub().CreateCompositeKey(exemptionObjectType, []string{address})
+	if err != nil {
+		return fmt.Errorf("failed to create exemption key: %v", err)
+	}
+
+	exemptionsJSON, err := json.Marshal(exemptions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal exemptions: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, exemptionsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store exemptions: %v", err)
+	}
+
+	return nil
+}
+
+// findExemption returns the exemption with the given ID
+func findExemption(exemptions []*Exemption, address, exemptionID string) (*Exemption, error) {
+	for _, exemption := range exemptions {
+		if exemption.ID == exemptionID {
+			return exemption, nil
+		}
+	}
+	return nil, fmt.Errorf("exemption %s of %s does not exist", exemptionID, address)
+}
+
+// applyExemptions moves the denials of each party that one of its approved,
+// unexpired exemptions covers from the decision's reasons to Exempted
+func applyExemptions(ctx contractapi.TransactionContextInterface, decision *TransferDecision, now time.Time) error {
+	for _, address := range []string{decision.From, decision.To} {
+		if address == "" {
+			continue
+		}
+
+		var exemptions []*Exemption
+		for _, reason := range decision.Reasons {
+			if reason.Address == address && containsString(exemptableReasonCodes, reason.ReasonCode) {
+				var err error
+				exemptions, err = getExemptions(ctx, address)
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+		if len(exemptions) == 0 {
+			continue
+		}
+
+		var reasons []*TransferReason
+		for _, reason := range decision.Reasons {
+			exemption := activeExemption(exemptions, reason, decision.BondID, now)
+			if reason.Address != address || exemption == nil {
+				reasons = append(reasons, reason)
+				continue
+			}
+			reason.ExemptionID = exemption.ID
+			decision.Exempted = append(decision.Exempted, reason)
+		}
+		decision.Reasons = reasons
+	}
+
+	if decision.Reasons == nil {
+		decision.Reasons = []*TransferReason{}
+	}
+	return nil
+}
+
+// activeExemption returns an approved, unexpired exemption covering a
+// denial for a bond, or nil if there is none
+func activeExemption(exemptions []*Exemption, reason *TransferReason, bondID string, now time.Time) *Exemption {
+	for _, exemption := range exemptions {
+		if exemption.Status == "APPROVED" && exemption.ReasonCode == reason.ReasonCode &&
+			(exemption.BondID == "" || exemption.BondID == bondID) && now.Before(exemption.ExpiresAt) {
+			return exemption
+		}
+	}
+	return nil
+}
+
+// emitExemptionEvent emits a TransferRulesEvent for a change to an
+// exemption
+func emitExemptionEvent(ctx contractapi.TransactionContextInterface, eventType string, exemption *Exemption, details string, now time.Time) error {
+	scope := "all bonds"
+	if exemption.BondID != "" {
+		scope = "bond " + exemption.BondID
+	}
+
+	event := ComplianceEvent{
+		Type:      eventType,
+		Address:   exemption.Address,
+		Details:   fmt.Sprintf("Exemption %s of %s from %s for %s until %s: %s", exemption.ID, exemption.Address, exemption.ReasonCode, scope, exemption.ExpiresAt.Format("2006-01-02"), details),
+		Timestamp: now,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		BondID:  exemption.BondID,
+		Outcome: exemption.Status,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("TransferRulesEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// limitKey returns the objectType~address~scope composite key of an
+// investor limit or its utilization
+func limitKey(ctx contractapi.TransactionContextInterface, objectType, address, scope string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{address, scope})
+	if err != nil {
+		return "", fmt.Errorf("failed to create limit key: %v", err)
+	}
+	return key, nil
+}
+
+// getInvestorLimit returns an investor's limit in a scope, or nil if none
+// is set
+func getInvestorLimit(ctx contractapi.TransactionContextInterface, address, scope string) (*InvestorLimit, error) {
+	key, err := limitKey(ctx, limitObjectType, address, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	limitJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limit: %v", err)
+	}
+	if limitJSON == nil {
+		return nil, nil
+	}
+
+	var limit InvestorLimit
+	err = json.Unmarshal(limitJSON, &limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal limit: %v", err)
+	}
+
+	return &limit, nil
+}
+
+// getLimitUtilization returns an investor's utilization in a scope, empty
+// if nothing has been counted yet
+func getLimitUtilization(ctx contractapi.TransactionContextInterface, address, scope string) (*LimitUtilization, error) {
+	key, err := limitKey(ctx, limitUsageObjectType, address, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	usageJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limit utilization: %v", err)
+	}
+
+	usage := &LimitUtilization{Address: address, BondID: scope, Trades: []*LimitTrade{}}
+	if usageJSON == nil {
+		return usage, nil
+	}
+
+	err = json.Unmarshal(usageJSON, usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal limit utilization: %v", err)
+	}
+
+	return usage, nil
+}
+
+// putLimitUtilization stores an investor's utilization in a scope
+func putLimitUtilization(ctx contractapi.TransactionContextInterface, usage *LimitUtilization) error {
+	key, err := limitKey(ctx, limitUsageObjectType, usage.Address, usage.BondID)
+	if err != nil {
+		return err
+	}
+
+	usageJSON, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal limit utilization: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, usageJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store limit utilization: %v", err)
+	}
+
+	return nil
+}
+
+// putBlockedTransfer records a denied transfer decision under the
+// transaction's ID
+func putBlockedTransfer(ctx contractapi.TransactionContextInterface, decision *TransferDecision, now time.Time) error {
+	txID := ctx.GetStub().GetTxID()
+	key, err := ctx.GetStub().CreateCompositeKey(blockedTransferObjectType, []string{txID})
+	if err != nil {
+		return fmt.Errorf("failed to create blocked transfer key: %v", err)
+	}
+
+	blocked := BlockedTransfer{
+		TxID:        txID,
+		From:        decision.From,
+		To:          decision.To,
+		BondID:      decision.BondID,
+		Quantity:    decision.Quantity,
+		ReasonCodes: []string{},
+		Timestamp:   now,
+	}
+	for _, reason := range decision.Reasons {
+		if !containsString(blocked.ReasonCodes, reason.ReasonCode) {
+			blocked.ReasonCodes = append(blocked.ReasonCodes, reason.ReasonCode)
+		}
+	}
+
+	blockedJSON, err := json.Marshal(blocked)
+	if err != nil {
+		return fmt.Errorf("failed to marshal blocked transfer: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, blockedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store blocked transfer: %v", err)
+	}
+
+	return nil
+}
+
+// parseReportingPeriod returns the start and exclusive end of a reporting
+// period given as a year ("2024"), quarter ("2024-Q1") or month ("2024-03")
+func parseReportingPeriod(period string) (time.Time, time.Time, error) {
+	if year, quarter, found := strings.Cut(period, "-Q"); found {
+		start, err := time.Parse("2006", year)
+		if err != nil || len(quarter) != 1 || quarter < "1" || quarter > "4" {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid reporting period %s", period)
+		}
+		start = start.AddDate(0, 3*int(quarter[0]-'1'), 0)
+		return start, start.AddDate(0, 3, 0), nil
+	}
+
+	start, err := time.Parse("2006-01", period)
+	if err == nil {
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	start, err = time.Parse("2006", period)
+	if err == nil {
+		return start, start.AddDate(1, 0, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid reporting period %s", period)
+}
+
+// setSARStatus moves a suspicious activity report from one status to the
+// next, recording who made the change
+func setSARStatus(ctx contractapi.TransactionContextInterface, sarID, from, to string) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole)
+	if err != nil {
+		return err
+	}
+	err = requireCollectionMember(ctx, sarCollection)
+	if err != nil {
+		return err
+	}
+
+	sar, err := getSAR(ctx, sarID)
+	if err != nil {
+		return err
+	}
+	if sar.Status != from {
+		return fmt.Errorf("report %s is %s, only %s reports can be %s", sarID, sar.Status, from, strings.ToLower(to))
+	}
+
+	changedBy, err := enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	sar.Status = to
+	if to == "FILED" {
+		sar.FiledBy = changedBy
+		sar.FiledAt = now
+	} else {
+		sar.ClosedBy = changedBy
+		sar.ClosedAt = now
+	}
+
+	return putSAR(ctx, sar)
+}
+
+// requireSARReader checks that the caller may read suspicious activity
+// reports
+func requireSARReader(ctx contractapi.TransactionContextInterface) error {
+	err := requireRole(ctx, complianceOfficerRole, complianceAdminRole, regulatorRole)
+	if err != nil {
+		return err
+	}
+	return requireCollectionMember(ctx, sarCollection)
+}
+
+// getSAR returns a suspicious activity report from the sar-private
+// collection
+func getSAR(ctx contractapi.TransactionContextInterface, sarID string) (*SuspiciousActivityReport, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(sarObjectType, []string{sarID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report key: %v", err)
+	}
+
+	sarJSON, err := ctx.GetStub().GetPrivateData(sarCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %v", err)
+	}
+	if sarJSON == nil {
+		return nil, fmt.Errorf("report %s does not exist", sarID)
+	}
+
+	var sar SuspiciousActivityReport
+	err = json.Unmarshal(sarJSON, &sar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal report: %v", err)
+	}
+
+	return &sar, nil
+}
+
+// putSAR stores a suspicious activity report in the sar-private collection
+func putSAR(ctx contractapi.TransactionContextInterface, sar *SuspiciousActivityReport) error {
+	key, err := ctx.GetStub().CreateCompositeKey(sarObjectType, []string{sar.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create report key: %v", err)
+	}
+
+	sarJSON, err := json.Marshal(sar)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(sarCollection, key, sarJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store report: %v", err)
+	}
+
+	return nil
+}
+
+// kycQueryString builds the CouchDB query of QueryKYC
+func kycQueryString(status, riskLevel, nationality string) (string, error) {
+	selector := map[string]interface{}{"docType": kycObjectType}
+
+	switch status {
+	case "":
+	case "PENDING", "APPROVED", "REJECTED", "SUSPENDED", "EXPIRED", "ERASED":
+		selector["status"] = status
+	default:
+		return "", fmt.Errorf("invalid KYC status: %s", status)
+	}
+	if riskLevel != "" {
+		if _, ok := riskLevels[riskLevel]; !ok {
+			return "", fmt.Errorf("invalid risk level: %s", riskLevel)
+		}
+		selector["riskLevel"] = riskLevel
+	}
+	if nationality != "" {
+		selector["nationality"] = nationality
+	}
+
+	queryString, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal KYC query: %v", err)
+	}
+
+	return string(queryString), nil
+}
+
+// kycRiskScores are the risk factor scores of the KYC risk levels
+var kycRiskScores = map[string]int{"LOW": 10, "MEDIUM": 50, "HIGH": 90}
+
+// countryRiskScores and fatfRiskScores map country risk tiers and FATF
+// statuses to jurisdiction risk factor scores
+var (
+	countryRiskScores = map[string]int{"LOW": 10, "MEDIUM": 50, "HIGH": 90, "PROHIBITED": 100}
+	fatfRiskScores    = map[string]int{"NONE": 0, "INCREASED_MONITORING": 70, "CALL_FOR_ACTION": 100}
+)
+
+// sanctionedCountryRiskScore is the lowest jurisdiction risk factor score of
+// a country under a sanctions regime
+const sanctionedCountryRiskScore = 90
+
+// score returns the jurisdiction risk factor score of a country: the highest
+// of its risk tier's, its FATF status's and, if it is under sanctions,
+// sanctionedCountryRiskScore
+func (r *CountryRisk) score() int {
+	score := countryRiskScores[r.RiskTier]
+	if fatfRiskScores[r.FATFStatus] > score {
+		score = fatfRiskScores[r.FATFStatus]
+	}
+	if len(r.SanctionsRegimes) > 0 && sanctionedCountryRiskScore > score {
+		score = sanctionedCountryRiskScore
+	}
+	return score
+}
+
+// prohibited reports whether investors in a country are barred from
+// receiving bonds
+func (r *CountryRisk) prohibited() bool {
+	return r.RiskTier == "PROHIBITED" || r.FATFStatus == "CALL_FOR_ACTION"
+}
+
+// refreshRiskScore recomputes the risk score on a KYC record without storing
+// it. pending is an AML check written earlier in the same transaction,
+// which state queries do not return yet; it replaces the stored check of
+// its type. A transaction carries a single event, so callers report a
+// change through their own event using the returned delta, which is nil if
+// the score did not change.
+func refreshRiskScore(ctx contractapi.TransactionContextInterface, kyc *KYCRecord, pending *AMLCheck) (*RiskScoreDelta, error) {
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	factors := []*RiskFactor{}
+
+	kycScore, ok := kycRiskScores[kyc.RiskLevel]
+	kycDetail := "risk level " + kyc.RiskLevel
+	if !ok {
+		kycScore = kycRiskScores["MEDIUM"]
+		kycDetail = "risk level not assessed"
+	}
+	factors = append(factors, &RiskFactor{Name: "KYC_RISK_LEVEL", Score: kycScore, Weight: kycRiskWeight, Detail: kycDetail})
+
+	amlFactor, err := amlRiskFactor(ctx, kyc.Address, pending, now)
+	if err != nil {
+		return nil, err
+	}
+	factors = append(factors, amlFactor)
+
+	jurisdictionFactor := &RiskFactor{Name: "JURISDICTION", Weight: jurisdictionRiskWeight, Detail: "no country risk rating"}
+	for _, jurisdiction := range investorJurisdictions(kyc) {
+		risk, err := getCountryRisk(ctx, jurisdiction)
+		if err != nil {
+			return nil, err
+		}
+		if risk != nil && risk.score() >= jurisdictionFactor.Score {
+			jurisdictionFactor.Score = risk.score()
+			jurisdictionFactor.Detail = fmt.Sprintf("%s rated %s, FATF status %s", jurisdiction, risk.RiskTier, risk.FATFStatus)
+			if len(risk.SanctionsRegimes) > 0 {
+				jurisdictionFactor.Detail += ", sanctioned by " + strings.Join(risk.SanctionsRegimes, ", ")
+			}
+		}
+	}
+	factors = append(factors, jurisdictionFactor)
+
+	behaviorFactor, err := behaviorRiskFactor(ctx, kyc.Address, now)
+	if err != nil {
+		return nil, err
+	}
+	factors = append(factors, behaviorFactor)
+
+	score := 0
+	for _, factor := range factors {
+		score += factor.Score * factor.Weight
+	}
+	score /= 100
+
+	previous := kyc.RiskScore
+	kyc.RiskScore = &RiskScore{Score: score, Factors: factors, ScoredAt: now}
+	if previous == nil {
+		return &RiskScoreDelta{Current: score, Delta: score}, nil
+	}
+	if previous.Score == score {
+		return nil, nil
+	}
+	return &RiskScoreDelta{Previous: &previous.Score, Current: score, Delta: score - previous.Score}, nil
+}
+
+// refreshStoredRiskScore recomputes and stores the risk score of an
+// investor after one of its AML checks changed. Addresses without a KYC
+// record have no score to update.
+func (c *Compliance) refreshStoredRiskScore(ctx contractapi.TransactionContextInterface, address string, pending *AMLCheck) (*RiskScoreDelta, error) {
+	exists, err := c.KYCExists(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	kyc, err := c.GetKYC(ctx, address)
 	if err != nil {
-		return fmt.Errorf("failed to marshal KYC: %v", err)
+		return nil, err
 	}
 
-	err = ctx.GetStub().PutState(address, kycJSON)
+	scoreChange, err := refreshRiskScore(ctx, kyc, pending)
 	if err != nil {
-		return fmt.Errorf("failed to store KYC: %v", err)
+		return nil, err
 	}
 
-	// Emit event
-	event := ComplianceEvent{
-		Type:      "KYC_CREATED",
-		Address:   address,
-		Details:   fmt.Sprintf("KYC created for %s", fullName),
-		Timestamp: time.Now(),
-		TxID:      ctx.GetStub().GetTxID(),
+	err = putKYC(ctx, kyc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update KYC: %v", err)
 	}
 
-	eventJSON, err := json.Marshal(event)
+	return scoreChange, nil
+}
+
+// amlRiskFactor scores an investor's AML checks by the highest risk score
+// among them, with a failed check scoring 100. Expired checks are ignored,
+// and an investor without a current check scores as medium risk.
+func amlRiskFactor(ctx contractapi.TransactionContextInterface, address string, pending *AMLCheck, now time.Time) (*RiskFactor, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(amlObjectType, []string{address})
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		return nil, fmt.Errorf("failed to get AML checks: %v", err)
 	}
+	defer resultsIterator.Close()
 
-	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
-	if err != nil {
-		return fmt.Errorf("failed to emit event: %v", err)
+	var amlChecks []*AMLCheck
+	if pending != nil {
+		amlChecks = append(amlChecks, pending)
 	}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
 
-	return nil
-}
+		var amlCheck AMLCheck
+		err = json.Unmarshal(queryResult.Value, &amlCheck)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal AML check: %v", err)
+		}
+		if (pending != nil && amlCheck.CheckType == pending.CheckType) || amlCheck.expired(now) {
+			continue
+		}
+		amlChecks = append(amlChecks, &amlCheck)
+	}
 
-// ApproveKYC approves a KYC record
-func (c *Compliance) ApproveKYC(ctx contractapi.TransactionContextInterface, address, approvedBy, riskLevel string) error {
-	kyc, err := c.GetKYC(ctx, address)
-	if err != nil {
-		return fmt.Errorf("failed to get KYC: %v", err)
+	factor := &RiskFactor{Name: "AML_CHECKS", Score: 50, Weight: amlRiskWeight, Detail: "no AML checks"}
+	for i, amlCheck := range amlChecks {
+		score := amlCheck.RiskScore
+		if amlCheck.Status == "FAILED" {
+			score = 100
+		}
+		if score < 0 {
+			score = 0
+		} else if score > 100 {
+			score = 100
+		}
+		if i == 0 || score > factor.Score {
+			factor.Score = score
+			factor.Detail = fmt.Sprintf("%s check %s with score %d", amlCheck.CheckType, amlCheck.Status, amlCheck.RiskScore)
+		}
 	}
+	return factor, nil
+}
 
-	kyc.Status = "APPROVED"
-	kyc.RiskLevel = riskLevel
-	kyc.ApprovedBy = approvedBy
-	kyc.ApprovedAt = time.Now()
-	kyc.UpdatedAt = time.Now()
+// behaviorRiskFactor scores an investor's trading over the last 24 hours:
+// 10 per transfer, or the share of its global daily volume limit used if
+// higher. A watchlisted investor scores 100.
+func behaviorRiskFactor(ctx contractapi.TransactionContextInterface, address string, now time.Time) (*RiskFactor, error) {
+	factor := &RiskFactor{Name: "TRANSACTION_BEHAVIOR", Weight: behaviorRiskWeight}
 
-	kycJSON, err := json.Marshal(kyc)
+	watchlisted, err := getListEntry(ctx, watchlistObjectType, address)
 	if err != nil {
-		return fmt.Errorf("failed to marshal KYC: %v", err)
+		return nil, err
+	}
+	if watchlisted.inEffect(now) {
+		factor.Score = 100
+		factor.Detail = "watchlisted: " + watchlisted.ReasonCode
+		return factor, nil
 	}
 
-	err = ctx.GetStub().PutState(address, kycJSON)
+	usage, err := getLimitUtilization(ctx, address, globalLimitScope)
 	if err != nil {
-		return fmt.Errorf("failed to update KYC: %v", err)
+		return nil, err
 	}
-
-	// Emit event
-	event := ComplianceEvent{
-		Type:      "KYC_APPROVED",
-		Address:   address,
-		Details:   fmt.Sprintf("KYC approved by %s", approvedBy),
-		Timestamp: time.Now(),
-		TxID:      ctx.GetStub().GetTxID(),
+	var trades, volume int64
+	for _, trade := range usage.Trades {
+		if now.Sub(trade.Timestamp) < limitWindow {
+			trades++
+			volume += trade.Quantity
+		}
 	}
 
-	eventJSON, err := json.Marshal(event)
+	score := trades * 10
+	limit, err := getInvestorLimit(ctx, address, globalLimitScope)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		return nil, err
+	}
+	if limit != nil && limit.MaxDailyVolume > 0 && volume*100/limit.MaxDailyVolume > score {
+		score = volume * 100 / limit.MaxDailyVolume
+	}
+	if score > 100 {
+		score = 100
 	}
 
-	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
-	if err != nil {
-		return fmt.Errorf("failed to emit event: %v", err)
+	factor.Score = int(score)
+	factor.Detail = fmt.Sprintf("%d transfers of %d tokens in 24 hours", trades, volume)
+	return factor, nil
+}
+
+// formatRiskScore formats a risk score for event details, "none" if the
+// investor has not been scored
+func formatRiskScore(score *RiskScore) string {
+	if score == nil {
+		return "none"
 	}
+	return strconv.Itoa(score.Score)
+}
 
-	return nil
+// describe returns a risk score change for appending to event details, or
+// an empty string if the score did not change
+func (d *RiskScoreDelta) describe() string {
+	if d == nil {
+		return ""
+	}
+	previous := "none"
+	if d.Previous != nil {
+		previous = strconv.Itoa(*d.Previous)
+	}
+	return fmt.Sprintf("; risk score %s -> %d", previous, d.Current)
 }
 
-// RejectKYC rejects a KYC record
-func (c *Compliance) RejectKYC(ctx contractapi.TransactionContextInterface, address, rejectedBy, reason string) error {
-	kyc, err := c.GetKYC(ctx, address)
+// getKYCTierLimits returns the limits of a KYC tier, or nil if none are set
+func getKYCTierLimits(ctx contractapi.TransactionContextInterface, tier string) (*KYCTierLimits, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(kycTierObjectType, []string{tier})
 	if err != nil {
-		return fmt.Errorf("failed to get KYC: %v", err)
+		return nil, fmt.Errorf("failed to create KYC tier key: %v", err)
 	}
 
-	kyc.Status = "REJECTED"
-	kyc.UpdatedAt = time.Now()
-	kyc.Metadata["rejection_reason"] = reason
-	kyc.Metadata["rejected_by"] = rejectedBy
-
-	kycJSON, err := json.Marshal(kyc)
+	limitsJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
-		return fmt.Errorf("failed to marshal KYC: %v", err)
+		return nil, fmt.Errorf("failed to read KYC tier limits: %v", err)
+	}
+	if limitsJSON == nil {
+		return nil, nil
 	}
 
-	err = ctx.GetStub().PutState(address, kycJSON)
+	var limits KYCTierLimits
+	err = json.Unmarshal(limitsJSON, &limits)
 	if err != nil {
-		return fmt.Errorf("failed to update KYC: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal KYC tier limits: %v", err)
 	}
 
-	// Emit event
-	event := ComplianceEvent{
-		Type:      "KYC_REJECTED",
-		Address:   address,
-		Details:   fmt.Sprintf("KYC rejected by %s: %s", rejectedBy, reason),
-		Timestamp: time.Now(),
-		TxID:      ctx.GetStub().GetTxID(),
+	return &limits, nil
+}
+
+// getCountryRisk returns the risk rating of a country, or nil if it is not
+// rated
+func getCountryRisk(ctx contractapi.TransactionContextInterface, country string) (*CountryRisk, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(countryRiskObjectType, []string{country})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create country risk key: %v", err)
 	}
 
-	eventJSON, err := json.Marshal(event)
+	riskJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		return nil, fmt.Errorf("failed to read country risk: %v", err)
+	}
+	if riskJSON == nil {
+		return nil, nil
 	}
 
-	err = ctx.GetStub().SetEvent("KYCEvent", eventJSON)
+	var risk CountryRisk
+	err = json.Unmarshal(riskJSON, &risk)
 	if err != nil {
-		return fmt.Errorf("failed to emit event: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal country risk: %v", err)
 	}
 
-	return nil
+	return &risk, nil
 }
 
-// CreateAMLCheck creates a new AML check
-func (c *Compliance) CreateAMLCheck(ctx contractapi.TransactionContextInterface, address, checkType string, riskScore int, details string) error {
-	checkKey := fmt.Sprintf("%s_%s", address, checkType)
-	
-	// Create new AML check
-	amlCheck := AMLCheck{
-		Address:    address,
-		CheckType:  checkType,
-		Status:     "PENDING",
-		RiskScore:  riskScore,
-		CheckDate:  time.Now(),
-		ExpiryDate: time.Now().AddDate(0, 6, 0), // 6 months validity
-		Details:    details,
-		CheckedBy:  "SYSTEM",
+// requireCollectionMember rejects callers from organisations other than the
+// endorsing peer's. A peer only holds a private data collection if its
+// organisation is a member, so this limits reads to member organisations.
+func requireCollectionMember(ctx contractapi.TransactionContextInterface, collection string) error {
+	clientMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
 	}
-
-	// Store AML check
-	checkJSON, err := json.Marshal(amlCheck)
+	peerMSP, err := shim.GetMSPID()
 	if err != nil {
-		return fmt.Errorf("failed to marshal AML check: %v", err)
+		return fmt.Errorf("failed to get peer MSP ID: %v", err)
 	}
+	if clientMSP != peerMSP {
+		return fmt.Errorf("caller is not authorized: %s is not a member of the %s collection", clientMSP, collection)
+	}
+	return nil
+}
 
-	err = ctx.GetStub().PutState(checkKey, checkJSON)
+// statusHistory returns the status changes of one KYC record or AML check
+// from the ledger history of its key, oldest first
+func statusHistory(ctx contractapi.TransactionContextInterface, key, record string) ([]*ComplianceHistoryEntry, error) {
+	historyIterator, err := ctx.GetStub().GetHistoryForKey(key)
 	if err != nil {
-		return fmt.Errorf("failed to store AML check: %v", err)
+		return nil, fmt.Errorf("failed to get %s history: %v", record, err)
 	}
+	defer historyIterator.Close()
 
-	// Emit event
-	event := ComplianceEvent{
-		Type:      "AML_CHECK_CREATED",
-		Address:   address,
-		Details:   fmt.Sprintf("AML check created for %s: %s", address, checkType),
-		Timestamp: time.Now(),
-		TxID:      ctx.GetStub().GetTxID(),
+	var modifications []*ComplianceHistoryEntry
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate history: %v", err)
+		}
+
+		entry := &ComplianceHistoryEntry{
+			Record:    record,
+			Status:    "DELETED",
+			TxID:      modification.TxId,
+			Timestamp: time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC(),
+		}
+		if !modification.IsDelete {
+			var value struct {
+				Status       string `json:"status"`
+				UpdatedBy    string `json:"updatedBy"`
+				UpdatedByMSP string `json:"updatedByMsp"`
+				CheckedBy    string `json:"checkedBy"`
+				CheckedByMSP string `json:"checkedByMsp"`
+			}
+			err = json.Unmarshal(modification.Value, &value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal history record: %v", err)
+			}
+			entry.Status = value.Status
+			entry.Invoker = value.UpdatedBy
+			entry.InvokerMSP = value.UpdatedByMSP
+			if record != "KYC" {
+				entry.Invoker = value.CheckedBy
+				entry.InvokerMSP = value.CheckedByMSP
+			}
+		}
+		modifications = append(modifications, entry)
 	}
 
-	eventJSON, err := json.Marshal(event)
+	sort.SliceStable(modifications, func(i, j int) bool {
+		return modifications[i].Timestamp.Before(modifications[j].Timestamp)
+	})
+
+	var history []*ComplianceHistoryEntry
+	previous := ""
+	for _, entry := range modifications {
+		if entry.Status == previous {
+			continue
+		}
+		entry.PreviousStatus = previous
+		previous = entry.Status
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// attestationHash returns the hex SHA-256 of an attestation's attested
+// fields
+func attestationHash(attestation *Attestation) (string, error) {
+	attested := *attestation
+	attested.Hash = ""
+	attested.Revoked = false
+	attested.RevokedBy = ""
+	attested.RevokedAt = time.Time{}
+	attested.RevocationReason = ""
+
+	attestedJSON, err := json.Marshal(attested)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		return "", fmt.Errorf("failed to marshal attestation: %v", err)
 	}
+	hash := sha256.Sum256(attestedJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
 
-	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+// uboKey returns the kyc-private collection key of a beneficial owner's
+// personal data
+func uboKey(ctx contractapi.TransactionContextInterface, address, uboID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(uboObjectType, []string{address, uboID})
 	if err != nil {
-		return fmt.Errorf("failed to emit event: %v", err)
+		return "", fmt.Errorf("failed to create beneficial owner key: %v", err)
 	}
+	return key, nil
+}
 
+// beneficialOwner returns a beneficial owner linked to a KYC record, or nil
+// if there is none with the ID
+func beneficialOwner(kyc *KYCRecord, uboID string) *BeneficialOwner {
+	for _, owner := range kyc.BeneficialOwners {
+		if owner.UBOID == uboID {
+			return owner
+		}
+	}
 	return nil
 }
 
-// UpdateAMLCheck updates an AML check
-func (c *Compliance) UpdateAMLCheck(ctx contractapi.TransactionContextInterface, address, checkType, status string, riskScore int, details string) error {
-	checkKey := fmt.Sprintf("%s_%s", address, checkType)
-	
-	checkJSON, err := ctx.GetStub().GetState(checkKey)
-	if err != nil {
-		return fmt.Errorf("failed to read AML check: %v", err)
-	}
-	if checkJSON == nil {
-		return fmt.Errorf("AML check %s does not exist", checkKey)
+// failedBeneficialOwner returns a beneficial owner of more than
+// uboScreeningThreshold percent that failed screening, or nil if there is
+// none
+func failedBeneficialOwner(kyc *KYCRecord) *BeneficialOwner {
+	for _, owner := range kyc.BeneficialOwners {
+		if owner.OwnershipPercent > uboScreeningThreshold && owner.ScreeningStatus == "FAILED" {
+			return owner
+		}
 	}
+	return nil
+}
 
-	var amlCheck AMLCheck
-	err = json.Unmarshal(checkJSON, &amlCheck)
+// getAttestation returns an attestation, or nil if it does not exist
+func getAttestation(ctx contractapi.TransactionContextInterface, attestationID string) (*Attestation, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(attestationObjectType, []string{attestationID})
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal AML check: %v", err)
+		return nil, fmt.Errorf("failed to create attestation key: %v", err)
 	}
 
-	amlCheck.Status = status
-	amlCheck.RiskScore = riskScore
-	amlCheck.Details = details
-	amlCheck.CheckDate = time.Now()
-
-	// Store updated AML check
-	updatedCheckJSON, err := json.Marshal(amlCheck)
+	attestationJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated AML check: %v", err)
+		return nil, fmt.Errorf("failed to read attestation: %v", err)
+	}
+	if attestationJSON == nil {
+		return nil, nil
 	}
 
-	err = ctx.GetStub().PutState(checkKey, updatedCheckJSON)
+	var attestation Attestation
+	err = json.Unmarshal(attestationJSON, &attestation)
 	if err != nil {
-		return fmt.Errorf("failed to update AML check: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal attestation: %v", err)
 	}
 
-	// Emit event
-	event := ComplianceEvent{
-		Type:      "AML_CHECK_UPDATED",
-		Address:   address,
-		Details:   fmt.Sprintf("AML check updated for %s: %s - %s", address, checkType, status),
-		Timestamp: time.Now(),
-		TxID:      ctx.GetStub().GetTxID(),
+	return &attestation, nil
+}
+
+// putAttestation stores an attestation
+func putAttestation(ctx contractapi.TransactionContextInterface, attestation *Attestation) error {
+	key, err := ctx.GetStub().CreateCompositeKey(attestationObjectType, []string{attestation.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create attestation key: %v", err)
 	}
 
-	eventJSON, err := json.Marshal(event)
+	attestationJSON, err := json.Marshal(attestation)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		return fmt.Errorf("failed to marshal attestation: %v", err)
 	}
 
-	err = ctx.GetStub().SetEvent("AMLEvent", eventJSON)
+	err = ctx.GetStub().PutState(key, attestationJSON)
 	if err != nil {
-		return fmt.Errorf("failed to emit event: %v", err)
+		return fmt.Errorf("failed to store attestation: %v", err)
 	}
 
 	return nil
 }
 
-// CheckCompliance checks if an address is compliant
-func (c *Compliance) CheckCompliance(ctx contractapi.TransactionContextInterface, address string) (bool, string, error) {
-	// Check KYC status
-	kyc, err := c.GetKYC(ctx, address)
+// getScreeningProvider returns a screening provider's registration, or nil
+// if it is not registered
+func getScreeningProvider(ctx contractapi.TransactionContextInterface, providerID string) (*ScreeningProvider, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(screeningProviderObjectType, []string{providerID})
 	if err != nil {
-		return false, "KYC record not found", nil
+		return nil, fmt.Errorf("failed to create screening provider key: %v", err)
 	}
 
-	if kyc.Status != "APPROVED" {
-		return false, fmt.Sprintf("KYC status: %s", kyc.Status), nil
+	providerJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read screening provider: %v", err)
 	}
-
-	// Check AML status
-	sanctionsKey := fmt.Sprintf("%s_SANCTIONS", address)
-	pepKey := fmt.Sprintf("%s_PEP", address)
-	
-	sanctionsCheck, err := c.GetAMLCheck(ctx, sanctionsKey)
-	if err == nil && sanctionsCheck.Status == "FAILED" {
-		return false, "Sanctions check failed", nil
+	if providerJSON == nil {
+		return nil, nil
 	}
 
-	pepCheck, err := c.GetAMLCheck(ctx, pepKey)
-	if err == nil && pepCheck.Status == "FAILED" {
-		return false, "PEP check failed", nil
+	var provider ScreeningProvider
+	err = json.Unmarshal(providerJSON, &provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal screening provider: %v", err)
 	}
 
-	return true, "Compliant", nil
+	return &provider, nil
 }
 
-// GetKYC retrieves a KYC record
-func (c *Compliance) GetKYC(ctx contractapi.TransactionContextInterface, address string) (*KYCRecord, error) {
-	kycJSON, err := ctx.GetStub().GetState(address)
+// putScreeningProvider stores a screening provider's registration
+func putScreeningProvider(ctx contractapi.TransactionContextInterface, provider *ScreeningProvider) error {
+	key, err := ctx.GetStub().CreateCompositeKey(screeningProviderObjectType, []string{provider.ProviderID})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read KYC: %v", err)
+		return fmt.Errorf("failed to create screening provider key: %v", err)
 	}
-	if kycJSON == nil {
-		return nil, fmt.Errorf("KYC for address %s does not exist", address)
+
+	providerJSON, err := json.Marshal(provider)
+	if err != nil {
+		return fmt.Errorf("failed to marshal screening provider: %v", err)
 	}
 
-	var kyc KYCRecord
-	err = json.Unmarshal(kycJSON, &kyc)
+	err = ctx.GetStub().PutState(key, providerJSON)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal KYC: %v", err)
+		return fmt.Errorf("failed to store screening provider: %v", err)
 	}
 
-	return &kyc, nil
+	return nil
 }
 
-// GetAMLCheck retrieves an AML check
-func (c *Compliance) GetAMLCheck(ctx contractapi.TransactionContextInterface, checkKey string) (*AMLCheck, error) {
-	checkJSON, err := ctx.GetStub().GetState(checkKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read AML check: %v", err)
-	}
-	if checkJSON == nil {
-		return nil, fmt.Errorf("AML check %s does not exist", checkKey)
+// parsePublicKey parses a PEM-encoded PKIX ECDSA or RSA public key
+func parsePublicKey(publicKeyPEM string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
 	}
 
-	var amlCheck AMLCheck
-	err = json.Unmarshal(checkJSON, &amlCheck)
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal AML check: %v", err)
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
 	}
 
-	return &amlCheck, nil
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
 }
 
-// KYCExists checks if a KYC record exists
-func (c *Compliance) KYCExists(ctx contractapi.TransactionContextInterface, address string) (bool, error) {
-	kycJSON, err := ctx.GetStub().GetState(address)
+// verifySignature checks a base64 signature of the SHA-256 digest of
+// payload against a PEM-encoded public key
+func verifySignature(publicKeyPEM string, payload []byte, signature string) error {
+	publicKey, err := parsePublicKey(publicKeyPEM)
 	if err != nil {
-		return false, fmt.Errorf("failed to read KYC: %v", err)
+		return err
 	}
-	return kycJSON != nil, nil
-}
-
-// GetAllKYC returns all KYC records
-func (c *Compliance) GetAllKYC(ctx contractapi.TransactionContextInterface) ([]*KYCRecord, error) {
-	startKey := ""
-	endKey := ""
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	sig, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get state by range: %v", err)
+		return fmt.Errorf("failed to decode signature: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var kycRecords []*KYCRecord
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate results: %v", err)
+	digest := sha256.Sum256(payload)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return fmt.Errorf("invalid signature")
 		}
-
-		// Check if this is a KYC record (not an AML check)
-		if !contains(queryResult.Key, "_") {
-			var kyc KYCRecord
-			err = json.Unmarshal(queryResult.Value, &kyc)
-			if err == nil && kyc.Address != "" {
-				kycRecords = append(kycRecords, &kyc)
-			}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return fmt.Errorf("invalid signature")
 		}
 	}
-
-	return kycRecords, nil
+	return nil
 }
 
-// GetAllAMLChecks returns all AML checks for an address
-func (c *Compliance) GetAllAMLChecks(ctx contractapi.TransactionContextInterface, address string) ([]*AMLCheck, error) {
-	startKey := fmt.Sprintf("%s_", address)
-	endKey := fmt.Sprintf("%s_%c", address, 0)
+// invokerMSP returns the MSP ID of the submitting client
+func invokerMSP(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	return mspID, nil
+}
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+// txTimestamp returns the timestamp the client set in the transaction
+// proposal, so every endorsing peer computes the same dates from it
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get state by range: %v", err)
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
 	}
-	defer resultsIterator.Close()
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
 
-	var amlChecks []*AMLCheck
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate results: %v", err)
-		}
+// putKYC bumps the KYC record's version and stores it, tagged with its
+// object type for QueryKYC and the identity of the client writing it
+func putKYC(ctx contractapi.TransactionContextInterface, kyc *KYCRecord) error {
+	key, err := kycKey(ctx, kyc.Address)
+	if err != nil {
+		return err
+	}
 
-		var amlCheck AMLCheck
-		err = json.Unmarshal(queryResult.Value, &amlCheck)
-		if err == nil && amlCheck.Address == address {
-			amlChecks = append(amlChecks, &amlCheck)
-		}
+	kyc.UpdatedBy, err = enrollmentID(ctx)
+	if err != nil {
+		return err
+	}
+	kyc.UpdatedByMSP, err = invokerMSP(ctx)
+	if err != nil {
+		return err
 	}
 
-	return amlChecks, nil
+	kyc.DocType = kycObjectType
+	kyc.Version++
+	kycJSON, err := json.Marshal(kyc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal KYC: %v", err)
+	}
+	return ctx.GetStub().PutState(key, kycJSON)
 }
 
-// Helper function to check if string contains substring
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || (len(s) > len(substr) && s[:len(substr)] == substr))
+// checkVersion rejects a write made against a stale view of a record. An
+// expected version of 0 skips the check.
+func checkVersion(record string, current, expected int64) error {
+	if expected != 0 && current != expected {
+		return fmt.Errorf("version conflict: %s is at version %d, expected %d", record, current, expected)
+	}
+	return nil
 }
 
 func main() {
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -36,6 +50,42 @@ func (m *MockStub) GetStateByRange(startKey, endKey string) (contractapi.StateQu
 	return args.Get(0).(contractapi.StateQueryIteratorInterface), args.Error(1)
 }
 
+func (m *MockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return compositeKey(objectType, attributes...), nil
+}
+
+func (m *MockStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	parts := strings.Split(strings.Trim(compositeKey, "\x00"), "\x00")
+	return parts[0], parts[1:], nil
+}
+
+func (m *MockStub) GetPrivateData(collection, key string) ([]byte, error) {
+	args := m.Called(collection, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockStub) GetStateByPartialCompositeKey(objectType string, keys []string) (contractapi.StateQueryIteratorInterface, error) {
+	args := m.Called(objectType, keys)
+	return args.Get(0).(contractapi.StateQueryIteratorInterface), args.Error(1)
+}
+
+func (m *MockStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (contractapi.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	args := m.Called(query, pageSize, bookmark)
+	return args.Get(0).(contractapi.StateQueryIteratorInterface), args.Get(1).(*peer.QueryResponseMetadata), args.Error(2)
+}
+
+// compositeKey builds a composite key using the same encoding as the Fabric shim
+func compositeKey(objectType string, attributes ...string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
+}
+
 func (m *MockStub) GetTxID() string {
 	args := m.Called()
 	return args.String(0)
@@ -46,10 +96,110 @@ func (m *MockStub) SetEvent(name string, payload []byte) error {
 	return args.Error(0)
 }
 
+func (m *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	args := m.Called()
+	return args.Get(0).(*timestamp.Timestamp), args.Error(1)
+}
+
+func (m *MockStub) GetSignedProposal() (*peer.SignedProposal, error) {
+	args := m.Called()
+	return args.Get(0).(*peer.SignedProposal), args.Error(1)
+}
+
+func (m *MockStub) GetTransient() (map[string][]byte, error) {
+	args := m.Called()
+	return args.Get(0).(map[string][]byte), args.Error(1)
+}
+
+func (m *MockStub) PutPrivateData(collection, key string, value []byte) error {
+	args := m.Called(collection, key, value)
+	return args.Error(0)
+}
+
+func (m *MockStub) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (contractapi.StateQueryIteratorInterface, error) {
+	args := m.Called(collection, objectType, keys)
+	return args.Get(0).(contractapi.StateQueryIteratorInterface), args.Error(1)
+}
+
+func (m *MockStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	called := m.Called(chaincodeName, args, channel)
+	return called.Get(0).(peer.Response)
+}
+
+func (m *MockStub) GetHistoryForKey(key string) (contractapi.HistoryQueryIteratorInterface, error) {
+	args := m.Called(key)
+	return args.Get(0).(contractapi.HistoryQueryIteratorInterface), args.Error(1)
+}
+
+func (m *MockStub) PurgePrivateData(collection, key string) error {
+	args := m.Called(collection, key)
+	return args.Error(0)
+}
+
+func (m *MockStub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	args := m.Called(collection, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 // MockContext is a mock implementation of the transaction context
 type MockContext struct {
 	mock.Mock
-	stub *MockStub
+	stub     *MockStub
+	identity *MockClientIdentity // defaults to a client of Org1MSP without attributes
+}
+
+func (m *MockContext) GetClientIdentity() cid.ClientIdentity {
+	if m.identity != nil {
+		return m.identity
+	}
+	return &MockClientIdentity{id: "client", mspID: "Org1MSP"}
+}
+
+// MockClientIdentity is a fixed client identity
+type MockClientIdentity struct {
+	id         string
+	mspID      string
+	attributes map[string]string
+}
+
+// complianceAdmin is a client holding the COMPLIANCE_ADMIN role
+var complianceAdmin = &MockClientIdentity{id: "admin", mspID: "RegulatorMSP", attributes: map[string]string{"role": "COMPLIANCE_ADMIN", "hf.EnrollmentID": "admin"}}
+
+// complianceOfficer is a client holding the COMPLIANCE_OFFICER role
+var complianceOfficer = &MockClientIdentity{id: "officer1", mspID: "RegulatorMSP", attributes: map[string]string{"role": "COMPLIANCE_OFFICER", "hf.EnrollmentID": "officer1"}}
+
+// regulator is a client holding the REGULATOR role
+var regulator = &MockClientIdentity{id: "regulator1", mspID: "RegulatorMSP", attributes: map[string]string{"role": "REGULATOR", "hf.EnrollmentID": "regulator1"}}
+
+// screeningProvider is a screening provider's client holding the
+// SCREENING_PROVIDER role
+var screeningProvider = &MockClientIdentity{id: "worldcheck", mspID: "RegulatorMSP", attributes: map[string]string{"role": "SCREENING_PROVIDER", "hf.EnrollmentID": "worldcheck"}}
+
+func (m *MockClientIdentity) GetID() (string, error) {
+	return m.id, nil
+}
+
+func (m *MockClientIdentity) GetMSPID() (string, error) {
+	return m.mspID, nil
+}
+
+func (m *MockClientIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := m.attributes[name]
+	return value, found, nil
+}
+
+func (m *MockClientIdentity) AssertAttributeValue(name, value string) error {
+	if m.attributes[name] != value {
+		return fmt.Errorf("attribute %s does not have value %s", name, value)
+	}
+	return nil
+}
+
+func (m *MockClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
 }
 
 func (m *MockContext) GetStub() contractapi.TransactionContextInterface {
@@ -68,6 +218,22 @@ func (m *MockContext) GetStateByRange(startKey, endKey string) (contractapi.Stat
 	return m.stub.GetStateByRange(startKey, endKey)
 }
 
+func (m *MockContext) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return m.stub.CreateCompositeKey(objectType, attributes)
+}
+
+func (m *MockContext) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	return m.stub.SplitCompositeKey(compositeKey)
+}
+
+func (m *MockContext) GetPrivateData(collection, key string) ([]byte, error) {
+	return m.stub.GetPrivateData(collection, key)
+}
+
+func (m *MockContext) GetStateByPartialCompositeKey(objectType string, keys []string) (contractapi.StateQueryIteratorInterface, error) {
+	return m.stub.GetStateByPartialCompositeKey(objectType, keys)
+}
+
 func (m *MockContext) GetTxID() string {
 	return m.stub.GetTxID()
 }
@@ -76,10 +242,106 @@ func (m *MockContext) SetEvent(name string, payload []byte) error {
 	return m.stub.SetEvent(name, payload)
 }
 
+func (m *MockContext) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return m.stub.GetTxTimestamp()
+}
+
+func (m *MockContext) GetSignedProposal() (*peer.SignedProposal, error) {
+	return m.stub.GetSignedProposal()
+}
+
+func (m *MockContext) GetTransient() (map[string][]byte, error) {
+	return m.stub.GetTransient()
+}
+
+func (m *MockContext) PutPrivateData(collection, key string, value []byte) error {
+	return m.stub.PutPrivateData(collection, key, value)
+}
+
+func (m *MockContext) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (contractapi.StateQueryIteratorInterface, error) {
+	return m.stub.GetPrivateDataByPartialCompositeKey(collection, objectType, keys)
+}
+
+func (m *MockContext) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (contractapi.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	return m.stub.GetQueryResultWithPagination(query, pageSize, bookmark)
+}
+
+func (m *MockContext) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	return m.stub.InvokeChaincode(chaincodeName, args, channel)
+}
+
+func (m *MockContext) GetHistoryForKey(key string) (contractapi.HistoryQueryIteratorInterface, error) {
+	return m.stub.GetHistoryForKey(key)
+}
+
+func (m *MockContext) PurgePrivateData(collection, key string) error {
+	return m.stub.PurgePrivateData(collection, key)
+}
+
+func (m *MockContext) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	return m.stub.GetPrivateDataHash(collection, key)
+}
+
+// onTransferRules mocks the given number of transfer rule lookups for a
+// bond, each returning the given rule versions
+func onTransferRules(stub *MockStub, bondID string, calls int, versions ...[]byte) {
+	for i := 0; i < calls; i++ {
+		iterator := &MockIterator{results: versions}
+		iterator.On("Close").Return(nil)
+		stub.On("GetStateByPartialCompositeKey", "TRANSFERRULES", []string{bondID}).Return(iterator, nil).Once()
+	}
+}
+
+// onTransferPath mocks the signed proposal of a client invoking function on
+// chaincode
+func onTransferPath(stub *MockStub, chaincode, function string) {
+	invocation, _ := proto.Marshal(&peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		ChaincodeId: &peer.ChaincodeID{Name: chaincode},
+		Input:       &peer.ChaincodeInput{Args: [][]byte{[]byte(function)}},
+	}})
+	payload, _ := proto.Marshal(&peer.ChaincodeProposalPayload{Input: invocation})
+	proposal, _ := proto.Marshal(&peer.Proposal{Payload: payload})
+	stub.On("GetSignedProposal").Return(&peer.SignedProposal{ProposalBytes: proposal}, nil)
+}
+
+// onRiskScoreInputs mocks the AML check, watchlist, limit utilization and
+// limit lookups of a risk score computation for an address
+func onRiskScoreInputs(stub *MockStub, address string, amlChecks ...[]byte) {
+	iterator := &MockIterator{results: amlChecks}
+	iterator.On("Close").Return(nil)
+	stub.On("GetStateByPartialCompositeKey", "AML", []string{address}).Return(iterator, nil)
+	stub.On("GetState", compositeKey("WATCHLIST", address)).Return(nil, nil)
+	stub.On("GetState", compositeKey("LIMITUSAGE", address, "GLOBAL")).Return(nil, nil)
+	stub.On("GetState", compositeKey("LIMIT", address, "GLOBAL")).Return(nil, nil)
+}
+
+// MockHistoryIterator is a mock implementation of the key history iterator
+type MockHistoryIterator struct {
+	mock.Mock
+	modifications []*queryresult.KeyModification
+	index         int
+}
+
+func (m *MockHistoryIterator) HasNext() bool {
+	return m.index < len(m.modifications)
+}
+
+func (m *MockHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	modification := m.modifications[m.index]
+	m.index++
+	return modification, nil
+}
+
+func (m *MockHistoryIterator) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 // MockIterator is a mock implementation of the state query iterator
 type MockIterator struct {
 	mock.Mock
 	results [][]byte
+	keys    []string // optional; defaults to key_<n>
 	index   int
 }
 
@@ -96,6 +358,9 @@ func (m *MockIterator) Next() (*contractapi.QueryResult, error) {
 		Key:   fmt.Sprintf("key_%d", m.index),
 		Value: m.results[m.index],
 	}
+	if m.keys != nil {
+		result.Key = m.keys[m.index]
+	}
 	m.index++
 	return result, nil
 }
@@ -115,104 +380,233 @@ func TestCompliance_Init(t *testing.T) {
 
 func TestCompliance_CreateKYC(t *testing.T) {
 	c := &Compliance{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
 	
+	pii := []byte(`{"fullName":"Alice Johnson","dateOfBirth":"1990-01-01","documents":[{"type":"PASSPORT","number":"US123456","issuingCountry":"US","expiryDate":"2030-01-01"},{"type":"TAX_ID","number":"123-45-6789","issuingCountry":"US"}]}`)
+
 	// Mock the stub methods
-	ctx.stub.On("GetState", "alice").Return(nil, nil)
-	ctx.stub.On("PutState", "alice", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTransient").Return(map[string][]byte{"kyc": pii}, nil)
+	for _, hash := range []string{screeningHash("PASSPORT US US123456"), screeningHash("TAX_ID US 123-45-6789")} {
+		iterator := &MockIterator{}
+		iterator.On("Close").Return(nil)
+		ctx.stub.On("GetPrivateDataByPartialCompositeKey", "kyc-private", "IDHASH", []string{hash}).Return(iterator, nil)
+		ctx.stub.On("PutPrivateData", "kyc-private", compositeKey("IDHASH", hash, "alice"), []byte{0}).Return(nil)
+	}
+	ctx.stub.On("PutPrivateData", "kyc-private", "alice", mock.Anything).Return(nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
 	ctx.stub.On("GetTxID").Return("tx123")
 	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
 	
-	err := c.CreateKYC(ctx, "alice", "Alice Johnson", "1990-01-01", "US", "PASSPORT", "US123456")
+	err := c.CreateKYC(ctx, "alice", "US")
 	assert.NoError(t, err)
 	
 	ctx.stub.AssertExpectations(t)
+
+	// Only the hash of the personal data reaches channel state
+	var kyc KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &kyc)
+	assert.Len(t, kyc.PIIHash, 64)
+	assert.NotContains(t, string(ctx.stub.state[compositeKey("KYC", "alice")]), "Alice Johnson")
+	assert.NotContains(t, string(ctx.stub.state[compositeKey("KYC", "alice")]), "US123456")
+	assert.Len(t, kyc.IdentityDocuments, 2)
+	assert.Equal(t, "PASSPORT-US", kyc.IdentityDocuments[0].ID)
+	assert.Equal(t, "PENDING", kyc.IdentityDocuments[0].Status)
+	assert.True(t, kyc.IdentityDocuments[1].ExpiryDate.IsZero())
+}
+
+func TestCompliance_CreateKYC_DuplicateIdentity(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	pii := []byte(`{"fullName":"Alice Johnson","dateOfBirth":"1990-01-01","documents":[{"type":"PASSPORT","number":"US123456","issuingCountry":"US","expiryDate":"2030-01-01"}]}`)
+	hash := screeningHash("PASSPORT US US123456")
+	iterator := &MockIterator{results: [][]byte{{0}}, keys: []string{compositeKey("IDHASH", hash, "bob")}}
+	iterator.On("Close").Return(nil)
+
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTransient").Return(map[string][]byte{"kyc": pii}, nil)
+	ctx.stub.On("GetPrivateDataByPartialCompositeKey", "kyc-private", "IDHASH", []string{hash}).Return(iterator, nil)
+	ctx.stub.On("GetState", compositeKey("IDOVERRIDE", "alice", "bob")).Return(nil, nil)
+
+	// The same passport is already held by bob
+	err := c.CreateKYC(ctx, "alice", "US")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already used by the KYC record of bob")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+
+	// Allowed once the compliance admin has approved an override
+	iterator = &MockIterator{results: [][]byte{{0}}, keys: []string{compositeKey("IDHASH", hash, "bob")}}
+	iterator.On("Close").Return(nil)
+	ctx = &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+	override, _ := json.Marshal(DuplicateIdentityOverride{Address: "alice", ExistingAddress: "bob", Reason: "Migrated account"})
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTransient").Return(map[string][]byte{"kyc": pii}, nil)
+	ctx.stub.On("GetPrivateDataByPartialCompositeKey", "kyc-private", "IDHASH", []string{hash}).Return(iterator, nil)
+	ctx.stub.On("GetState", compositeKey("IDOVERRIDE", "alice", "bob")).Return(override, nil)
+	ctx.stub.On("PutPrivateData", "kyc-private", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx124")
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err = c.CreateKYC(ctx, "alice", "US")
+	assert.NoError(t, err)
+
+	var kyc KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &kyc)
+	assert.Equal(t, []string{"bob"}, kyc.DuplicateOf)
+}
+
+func TestCompliance_ApproveDuplicateIdentity(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	ctx.stub.On("GetState", compositeKey("KYC", "bob")).Return([]byte(`{"address":"bob"}`), nil)
+	ctx.stub.On("GetTxID").Return("tx125")
+	ctx.stub.On("PutState", compositeKey("IDOVERRIDE", "alice", "bob"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err := c.ApproveDuplicateIdentity(ctx, "alice", "bob", "Migrated account")
+	assert.NoError(t, err)
+
+	var override DuplicateIdentityOverride
+	json.Unmarshal(ctx.stub.state[compositeKey("IDOVERRIDE", "alice", "bob")], &override)
+	assert.Equal(t, "Migrated account", override.Reason)
+
+	// Compliance officers cannot approve overrides
+	ctx.identity = complianceOfficer
+	err = c.ApproveDuplicateIdentity(ctx, "alice", "bob", "Migrated account")
+	assert.Error(t, err)
+}
+
+func TestCompliance_CreateKYC_NoTransientData(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTransient").Return(map[string][]byte{}, nil)
+
+	err := c.CreateKYC(ctx, "alice", "US")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "transient key")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_VerifyKYCPersonalData(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	hash := sha256.Sum256([]byte("pii"))
+	kyc := KYCRecord{Address: "alice", PIIHash: hex.EncodeToString(hash[:]), Status: "APPROVED"}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetPrivateDataHash", "kyc-private", "alice").Return(hash[:], nil)
+
+	verified, err := c.VerifyKYCPersonalData(ctx, "alice")
+	assert.NoError(t, err)
+	assert.True(t, verified)
 }
 
 func TestCompliance_CreateKYC_AlreadyExists(t *testing.T) {
 	c := &Compliance{}
-	ctx := &MockContext{stub: &MockContext{stub: &MockStub{state: make(map[string][]byte)}}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
 	
 	// Mock existing KYC
 	existingKYC := KYCRecord{
 		Address:     "alice",
-		FullName:    "Alice Johnson",
-		DateOfBirth: time.Now(),
 		Nationality: "US",
-		IDType:      "PASSPORT",
-		IDNumber:    "US123456",
 		Status:      "APPROVED",
 	}
 	
 	existingKYCJSON, _ := json.Marshal(existingKYC)
-	ctx.stub.On("GetState", "alice").Return(existingKYCJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(existingKYCJSON, nil)
 	
-	err := c.CreateKYC(ctx, "alice", "Alice Johnson", "1990-01-01", "US", "PASSPORT", "US123456")
+	err := c.CreateKYC(ctx, "alice", "US")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "already exists")
 }
 
 func TestCompliance_ApproveKYC(t *testing.T) {
 	c := &Compliance{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
 	
 	// Create a KYC record first
 	kyc := KYCRecord{
 		Address:     "alice",
-		FullName:    "Alice Johnson",
-		DateOfBirth: time.Now(),
 		Nationality: "US",
-		IDType:      "PASSPORT",
-		IDNumber:    "US123456",
 		Status:      "PENDING",
 	}
 	
 	kycJSON, _ := json.Marshal(kyc)
-	ctx.stub.On("GetState", "alice").Return(kycJSON, nil)
-	ctx.stub.On("PutState", "alice", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
 	ctx.stub.On("GetTxID").Return("tx123")
-	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "KYCApproved", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("COUNTRYRISK", "US")).Return(nil, nil)
+	onRiskScoreInputs(ctx.stub, "alice")
 	
-	err := c.ApproveKYC(ctx, "alice", "admin", "LOW")
+	err := c.ApproveKYC(ctx, "alice", "LOW", 0)
 	assert.NoError(t, err)
 	
+	var stored KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &stored)
+	assert.Equal(t, "officer1", stored.ApprovedBy)
+	// LOW risk level and no AML checks yet: 10*30% + 50*30%
+	assert.Equal(t, 18, stored.RiskScore.Score)
 	ctx.stub.AssertExpectations(t)
 }
 
-func TestCompliance_RejectKYC(t *testing.T) {
+func TestCompliance_ApproveKYC_RoleRequired(t *testing.T) {
 	c := &Compliance{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := c.ApproveKYC(ctx, "alice", "LOW", 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "COMPLIANCE_OFFICER or COMPLIANCE_ADMIN role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_RejectKYC(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
 	
 	// Create a KYC record first
 	kyc := KYCRecord{
 		Address:     "alice",
-		FullName:    "Alice Johnson",
-		DateOfBirth: time.Now(),
 		Nationality: "US",
-		IDType:      "PASSPORT",
-		IDNumber:    "US123456",
 		Status:      "PENDING",
 	}
 	
 	kycJSON, _ := json.Marshal(kyc)
-	ctx.stub.On("GetState", "alice").Return(kycJSON, nil)
-	ctx.stub.On("PutState", "alice", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
 	ctx.stub.On("GetTxID").Return("tx123")
-	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "KYCRejected", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
 	
-	err := c.RejectKYC(ctx, "alice", "admin", "Incomplete documentation")
+	err := c.RejectKYC(ctx, "alice", "Incomplete documentation", 0)
 	assert.NoError(t, err)
 	
 	ctx.stub.AssertExpectations(t)
+
+	var event KYCStatusEvent
+	json.Unmarshal(ctx.stub.Calls[len(ctx.stub.Calls)-1].Arguments.Get(1).([]byte), &event)
+	assert.Equal(t, 1, event.SchemaVersion)
+	assert.Equal(t, "REJECTED", event.Status)
+	assert.Equal(t, "PENDING", event.PreviousStatus)
+	assert.Equal(t, "Incomplete documentation", event.Reason)
 }
 
 func TestCompliance_CreateAMLCheck(t *testing.T) {
 	c := &Compliance{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
 	
 	// Mock the stub methods
-	ctx.stub.On("PutState", "alice_SANCTIONS", mock.Anything).Return(nil)
+	ctx.stub.On("PutState", compositeKey("AML", "alice", "SANCTIONS"), mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(nil, nil)
 	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC).Unix()}, nil)
 	ctx.stub.On("SetEvent", "AMLEvent", mock.Anything).Return(nil)
 	
 	err := c.CreateAMLCheck(ctx, "alice", "SANCTIONS", 75, "Sanctions check completed")
@@ -223,7 +617,7 @@ func TestCompliance_CreateAMLCheck(t *testing.T) {
 
 func TestCompliance_UpdateAMLCheck(t *testing.T) {
 	c := &Compliance{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
 	
 	// Create an AML check first
 	amlCheck := AMLCheck{
@@ -238,8 +632,9 @@ func TestCompliance_UpdateAMLCheck(t *testing.T) {
 	}
 	
 	amlCheckJSON, _ := json.Marshal(amlCheck)
-	ctx.stub.On("GetState", "alice_SANCTIONS").Return(amlCheckJSON, nil)
-	ctx.stub.On("PutState", "alice_SANCTIONS", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "SANCTIONS")).Return(amlCheckJSON, nil)
+	ctx.stub.On("PutState", compositeKey("AML", "alice", "SANCTIONS"), mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(nil, nil)
 	ctx.stub.On("GetTxID").Return("tx123")
 	ctx.stub.On("SetEvent", "AMLEvent", mock.Anything).Return(nil)
 	
@@ -256,20 +651,19 @@ func TestCompliance_CheckCompliance(t *testing.T) {
 	// Mock KYC record
 	kyc := KYCRecord{
 		Address:     "alice",
-		FullName:    "Alice Johnson",
-		DateOfBirth: time.Now(),
 		Nationality: "US",
-		IDType:      "PASSPORT",
-		IDNumber:    "US123456",
 		Status:      "APPROVED",
 	}
 	
 	kycJSON, _ := json.Marshal(kyc)
-	ctx.stub.On("GetState", "alice").Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
 	
 	// Mock AML checks - no sanctions or PEP failures
-	ctx.stub.On("GetState", "alice_SANCTIONS").Return(nil, nil)
-	ctx.stub.On("GetState", "alice_PEP").Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "SANCTIONS")).Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "PEP")).Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("BLACKLIST", "alice")).Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("WATCHLIST", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
 	
 	compliant, reason, err := c.CheckCompliance(ctx, "alice")
 	assert.NoError(t, err)
@@ -284,16 +678,14 @@ func TestCompliance_CheckCompliance_KYCNotApproved(t *testing.T) {
 	// Mock KYC record with pending status
 	kyc := KYCRecord{
 		Address:     "alice",
-		FullName:    "Alice Johnson",
-		DateOfBirth: time.Now(),
 		Nationality: "US",
-		IDType:      "PASSPORT",
-		IDNumber:    "US123456",
 		Status:      "PENDING",
 	}
 	
 	kycJSON, _ := json.Marshal(kyc)
-	ctx.stub.On("GetState", "alice").Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("BLACKLIST", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
 	
 	compliant, reason, err := c.CheckCompliance(ctx, "alice")
 	assert.NoError(t, err)
@@ -301,6 +693,154 @@ func TestCompliance_CheckCompliance_KYCNotApproved(t *testing.T) {
 	assert.Contains(t, reason, "KYC status: PENDING")
 }
 
+func TestCompliance_CheckCompliance_ExpiredCheck(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kyc := KYCRecord{Address: "alice", Nationality: "US", Status: "APPROVED"}
+	sanctions := AMLCheck{Address: "alice", CheckType: "SANCTIONS", Status: "PASSED", ExpiryDate: now.AddDate(0, 0, -1)}
+	kycJSON, _ := json.Marshal(kyc)
+	sanctionsJSON, _ := json.Marshal(sanctions)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "SANCTIONS")).Return(sanctionsJSON, nil)
+	ctx.stub.On("GetState", compositeKey("BLACKLIST", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+
+	compliant, reason, err := c.CheckCompliance(ctx, "alice")
+	assert.NoError(t, err)
+	assert.False(t, compliant)
+	assert.Equal(t, "Sanctions check expired, re-screening required", reason)
+}
+
+func TestCompliance_GetExpiredChecks(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expired, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "SANCTIONS", ExpiryDate: now.AddDate(0, 0, -1)})
+	current, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "PEP", ExpiryDate: now.AddDate(0, 1, 0)})
+	legacy, _ := json.Marshal(AMLCheck{Address: "bob", CheckType: "SANCTIONS"})
+	iterator := &MockIterator{results: [][]byte{expired, current, legacy}}
+	iterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "AML", []string{}).Return(iterator, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+
+	checks, err := c.GetExpiredChecks(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, checks, 1)
+	assert.Equal(t, "SANCTIONS", checks[0].CheckType)
+	assert.Equal(t, "alice", checks[0].Address)
+}
+
+func TestCompliance_GetRescreeningDue(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	approved := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	alice, _ := json.Marshal(KYCRecord{Address: "alice", Status: "APPROVED", RiskLevel: "HIGH", ApprovedAt: approved})
+	bob, _ := json.Marshal(KYCRecord{Address: "bob", Status: "APPROVED", RiskLevel: "LOW", ApprovedAt: approved})
+	carol, _ := json.Marshal(KYCRecord{Address: "carol", Status: "PENDING", CreatedAt: approved})
+	kycIterator := &MockIterator{results: [][]byte{alice, bob, carol}}
+	kycIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "KYC", []string{}).Return(kycIterator, nil)
+
+	bobPEP, _ := json.Marshal(AMLCheck{Address: "bob", CheckType: "PEP", CheckDate: approved, ExpiryDate: approved.AddDate(0, 6, 0)})
+	bobSanctions, _ := json.Marshal(AMLCheck{Address: "bob", CheckType: "SANCTIONS", CheckDate: approved.AddDate(1, 0, 0), ExpiryDate: approved.AddDate(1, 6, 0)})
+	aliceIterator := &MockIterator{}
+	aliceIterator.On("Close").Return(nil)
+	bobIterator := &MockIterator{results: [][]byte{bobPEP, bobSanctions}}
+	bobIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "AML", []string{"alice"}).Return(aliceIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "AML", []string{"bob"}).Return(bobIterator, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	due, err := c.GetRescreeningDue(ctx, "2024-01-10")
+	assert.NoError(t, err)
+	assert.Len(t, due, 2)
+	assert.Equal(t, "alice", due[0].Address)
+	assert.True(t, due[0].KYCReviewDue)
+	assert.Equal(t, "bob", due[1].Address)
+	assert.False(t, due[1].KYCReviewDue)
+	assert.Equal(t, []string{"PEP"}, due[1].DueChecks)
+}
+
+func TestCompliance_CheckCompliance_Blacklisted(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := ListEntry{Address: "alice", List: "BLACKLIST", ReasonCode: "FRAUD", EffectiveFrom: now.AddDate(0, 0, -1), Active: true}
+	entryJSON, _ := json.Marshal(entry)
+	ctx.stub.On("GetState", compositeKey("BLACKLIST", "alice")).Return(entryJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+
+	compliant, reason, err := c.CheckCompliance(ctx, "alice")
+	assert.NoError(t, err)
+	assert.False(t, compliant)
+	assert.Equal(t, "Blacklisted: FRAUD", reason)
+	ctx.stub.AssertNotCalled(t, "GetState", compositeKey("KYC", "alice"))
+}
+
+func TestListEntry_InEffect(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := &ListEntry{Active: true, EffectiveFrom: now.AddDate(0, 0, 1)}
+	assert.False(t, entry.inEffect(now))
+
+	entry.EffectiveFrom = now.AddDate(0, 0, -1)
+	assert.True(t, entry.inEffect(now))
+
+	entry.EffectiveTo = now
+	assert.False(t, entry.inEffect(now))
+
+	entry.EffectiveTo = time.Time{}
+	entry.Active = false
+	assert.False(t, entry.inEffect(now))
+
+	var missing *ListEntry
+	assert.False(t, missing.inEffect(now))
+}
+
+func TestCompliance_AddToBlacklist(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	ctx.stub.On("GetState", compositeKey("BLACKLIST", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", compositeKey("BLACKLIST", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "AMLEvent", mock.Anything).Return(nil)
+
+	err := c.AddToBlacklist(ctx, "alice", "FRAUD", "Court order 42", "", "2024-12-31")
+	assert.NoError(t, err)
+
+	var stored ListEntry
+	json.Unmarshal(ctx.stub.state[compositeKey("BLACKLIST", "alice")], &stored)
+	assert.True(t, stored.Active)
+	assert.Equal(t, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), stored.EffectiveTo)
+	assert.Len(t, stored.History, 1)
+	assert.Equal(t, "ADDED", stored.History[0].Action)
+	assert.Equal(t, "officer1", stored.History[0].ChangedBy)
+
+	err = c.AddToBlacklist(ctx, "alice", "FRAUD", "Court order 42", "2025-01-01", "2024-12-31")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must be after")
+}
+
+func TestCompliance_RemoveFromWatchlist_NotListed(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	entry := ListEntry{Address: "alice", List: "WATCHLIST", ReasonCode: "PEP_RELATIVE", Active: false}
+	entryJSON, _ := json.Marshal(entry)
+	ctx.stub.On("GetState", compositeKey("WATCHLIST", "alice")).Return(entryJSON, nil)
+
+	err := c.RemoveFromWatchlist(ctx, "alice", "Review closed")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not on the watchlist")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
 func TestCompliance_GetKYC(t *testing.T) {
 	c := &Compliance{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
@@ -308,21 +848,17 @@ func TestCompliance_GetKYC(t *testing.T) {
 	// Create a KYC record
 	kyc := KYCRecord{
 		Address:     "alice",
-		FullName:    "Alice Johnson",
-		DateOfBirth: time.Now(),
 		Nationality: "US",
-		IDType:      "PASSPORT",
-		IDNumber:    "US123456",
 		Status:      "APPROVED",
 	}
 	
 	kycJSON, _ := json.Marshal(kyc)
-	ctx.stub.On("GetState", "alice").Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
 	
 	retrievedKYC, err := c.GetKYC(ctx, "alice")
 	assert.NoError(t, err)
 	assert.Equal(t, kyc.Address, retrievedKYC.Address)
-	assert.Equal(t, kyc.FullName, retrievedKYC.FullName)
+	assert.Equal(t, kyc.PIIHash, retrievedKYC.PIIHash)
 	assert.Equal(t, kyc.Status, retrievedKYC.Status)
 }
 
@@ -330,7 +866,7 @@ func TestCompliance_GetKYC_NotFound(t *testing.T) {
 	c := &Compliance{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
 	
-	ctx.stub.On("GetState", "alice").Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(nil, nil)
 	
 	_, err := c.GetKYC(ctx, "alice")
 	assert.Error(t, err)
@@ -354,9 +890,9 @@ func TestCompliance_GetAMLCheck(t *testing.T) {
 	}
 	
 	amlCheckJSON, _ := json.Marshal(amlCheck)
-	ctx.stub.On("GetState", "alice_SANCTIONS").Return(amlCheckJSON, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "SANCTIONS")).Return(amlCheckJSON, nil)
 	
-	retrievedCheck, err := c.GetAMLCheck(ctx, "alice_SANCTIONS")
+	retrievedCheck, err := c.GetAMLCheck(ctx, "alice", "SANCTIONS")
 	assert.NoError(t, err)
 	assert.Equal(t, amlCheck.Address, retrievedCheck.Address)
 	assert.Equal(t, amlCheck.CheckType, retrievedCheck.CheckType)
@@ -367,9 +903,9 @@ func TestCompliance_GetAMLCheck_NotFound(t *testing.T) {
 	c := &Compliance{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
 	
-	ctx.stub.On("GetState", "alice_SANCTIONS").Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "SANCTIONS")).Return(nil, nil)
 	
-	_, err := c.GetAMLCheck(ctx, "alice_SANCTIONS")
+	_, err := c.GetAMLCheck(ctx, "alice", "SANCTIONS")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "does not exist")
 }
@@ -381,14 +917,14 @@ func TestCompliance_KYCExists(t *testing.T) {
 	// Test existing KYC
 	kyc := KYCRecord{Address: "alice"}
 	kycJSON, _ := json.Marshal(kyc)
-	ctx.stub.On("GetState", "alice").Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
 	
 	exists, err := c.KYCExists(ctx, "alice")
 	assert.NoError(t, err)
 	assert.True(t, exists)
 	
 	// Test non-existing KYC
-	ctx.stub.On("GetState", "bob").Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "bob")).Return(nil, nil)
 	
 	exists, err = c.KYCExists(ctx, "bob")
 	assert.NoError(t, err)
@@ -400,15 +936,16 @@ func TestCompliance_GetAllKYC(t *testing.T) {
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
 	
 	// Create mock iterator with KYC results
-	kyc1 := KYCRecord{Address: "alice", FullName: "Alice Johnson"}
-	kyc2 := KYCRecord{Address: "bob", FullName: "Bob Smith"}
+	kyc1 := KYCRecord{Address: "alice", Nationality: "US"}
+	kyc2 := KYCRecord{Address: "bob", Nationality: "GB"}
 	
 	kyc1JSON, _ := json.Marshal(kyc1)
 	kyc2JSON, _ := json.Marshal(kyc2)
 	
 	mockIterator := &MockIterator{results: [][]byte{kyc1JSON, kyc2JSON}}
+	mockIterator.On("Close").Return(nil)
 	
-	ctx.stub.On("GetStateByRange", "", "").Return(mockIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "KYC", []string{}).Return(mockIterator, nil)
 	
 	kycRecords, err := c.GetAllKYC(ctx)
 	assert.NoError(t, err)
@@ -429,8 +966,9 @@ func TestCompliance_GetAllAMLChecks(t *testing.T) {
 	aml2JSON, _ := json.Marshal(aml2)
 	
 	mockIterator := &MockIterator{results: [][]byte{aml1JSON, aml2JSON}}
+	mockIterator.On("Close").Return(nil)
 	
-	ctx.stub.On("GetStateByRange", "alice_", "alice_\x00").Return(mockIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "AML", []string{"alice"}).Return(mockIterator, nil)
 	
 	amlChecks, err := c.GetAllAMLChecks(ctx, "alice")
 	assert.NoError(t, err)
@@ -439,3 +977,1856 @@ func TestCompliance_GetAllAMLChecks(t *testing.T) {
 	assert.Equal(t, "alice", amlChecks[1].Address)
 }
 
+func TestCompliance_ApproveKYC_VersionConflict(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	kyc := KYCRecord{
+		Address: "alice",
+		Status:  "PENDING",
+		Version: 2,
+	}
+
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+
+	err := c.ApproveKYC(ctx, "alice", "LOW", 1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "version conflict")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_GetTaxProfile_Defaults(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	kyc := KYCRecord{
+		Address:     "alice",
+		Nationality: "IN",
+		Status:      "APPROVED",
+	}
+
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+
+	profile, err := c.GetTaxProfile(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "IN", profile.Jurisdiction)
+	assert.Equal(t, "INDIVIDUAL", profile.Classification)
+}
+
+func TestCompliance_CheckTransfer(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	rules := TransferRules{BondID: "BOND_001", BlockedJurisdictions: []string{"US"}, MaxTransferQuantity: 100}
+	alice := KYCRecord{Address: "alice", Nationality: "IN", Status: "APPROVED", RiskLevel: "LOW"}
+	bob := KYCRecord{Address: "bob", Nationality: "US", Status: "PENDING", RiskLevel: "MEDIUM"}
+	sanctions := AMLCheck{Address: "bob", CheckType: "SANCTIONS", Status: "FAILED"}
+
+	rulesJSON, _ := json.Marshal(rules)
+	aliceJSON, _ := json.Marshal(alice)
+	bobJSON, _ := json.Marshal(bob)
+	sanctionsJSON, _ := json.Marshal(sanctions)
+	onTransferRules(ctx.stub, "BOND_001", 3, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "bob")).Return(bobJSON, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "bob", "SANCTIONS")).Return(sanctionsJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	decision, err := c.CheckTransfer(ctx, "alice", "bob", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+
+	var codes []string
+	for _, reason := range decision.Reasons {
+		assert.Equal(t, "bob", reason.Address)
+		codes = append(codes, reason.ReasonCode)
+	}
+	assert.Equal(t, []string{"KYC_NOT_APPROVED", "AML_SANCTIONS_FAILED", "JURISDICTION_BLOCKED"}, codes)
+
+	// The issuer side is not checked, only the transfer limit applies
+	decision, err = c.CheckTransfer(ctx, "", "alice", "BOND_001", 150)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "TRANSFER_LIMIT_EXCEEDED", decision.Reasons[0].ReasonCode)
+
+	decision, err = c.CheckTransfer(ctx, "", "alice", "BOND_001", 50)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	// Checking a transfer records nothing
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+	ctx.stub.AssertNotCalled(t, "SetEvent", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_CheckTransfer_PolicyVersions(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	current := TransferRules{BondID: "BOND_001", Version: 1, EffectiveFrom: now.AddDate(0, -1, 0), MaxTransferQuantity: 100}
+	staged := TransferRules{BondID: "BOND_001", Version: 2, EffectiveFrom: now.AddDate(0, 1, 0), MaxTransferQuantity: 10}
+	expired := TransferRules{BondID: "BOND_001", Version: 3, EffectiveFrom: now.AddDate(0, -2, 0), EffectiveTo: now, MaxTransferQuantity: 1}
+
+	currentJSON, _ := json.Marshal(current)
+	stagedJSON, _ := json.Marshal(staged)
+	expiredJSON, _ := json.Marshal(expired)
+	onTransferRules(ctx.stub, "BOND_001", 1, stagedJSON, expiredJSON, currentJSON)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "", "", "BOND_001", 50)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, int64(1), decision.PolicyVersion)
+}
+
+func TestCompliance_SetTransferRules_Backdated(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	err := c.SetTransferRules(ctx, "BOND_001", `{"effectiveFrom":"2024-01-01T00:00:00Z"}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "in the past")
+
+	err = c.SetTransferRules(ctx, "BOND_001", `{"effectiveFrom":"2024-06-01T00:00:00Z","effectiveTo":"2024-05-01T00:00:00Z"}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "effectiveTo")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_CheckTransfer_Watchlisted(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice := KYCRecord{Address: "alice", Nationality: "IN", Status: "APPROVED"}
+	entry := ListEntry{Address: "alice", List: "WATCHLIST", ReasonCode: "UNUSUAL_ACTIVITY", EffectiveFrom: now.AddDate(0, 0, -1), Active: true}
+	aliceJSON, _ := json.Marshal(alice)
+	entryJSON, _ := json.Marshal(entry)
+	onTransferRules(ctx.stub, "BOND_001", 1)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("WATCHLIST", "alice")).Return(entryJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Len(t, decision.Flags, 1)
+	assert.Equal(t, "WATCHLISTED", decision.Flags[0].ReasonCode)
+}
+
+func TestCompliance_CheckTransfer_NoKYC(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	onTransferRules(ctx.stub, "BOND_001", 1)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "alice", "bob", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Len(t, decision.Reasons, 2)
+	assert.Equal(t, "KYC_NOT_FOUND", decision.Reasons[0].ReasonCode)
+}
+
+func TestCompliance_CheckTransfer_EligibilityMatrix(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	// Reg-S style bond: offered in India and Singapore, and in the US only
+	// to QIBs, with retail holdings capped
+	rules := TransferRules{
+		BondID:               "BOND_001",
+		AllowedJurisdictions: []string{"IN", "SG", "US"},
+		InvestorClasses:      map[string][]string{"US": {"QIB"}},
+		MaxHoldingByClass:    map[string]int64{"RETAIL": 50},
+	}
+	retail := KYCRecord{Address: "alice", Nationality: "US", Status: "APPROVED", RequestedInvestorClass: "QIB"}
+	qib := KYCRecord{Address: "bob", Nationality: "US", Status: "APPROVED", InvestorClass: "QIB"}
+	foreign := KYCRecord{Address: "carol", Nationality: "SG", TaxResidence: "GB", Status: "APPROVED"}
+
+	rulesJSON, _ := json.Marshal(rules)
+	retailJSON, _ := json.Marshal(retail)
+	qibJSON, _ := json.Marshal(qib)
+	foreignJSON, _ := json.Marshal(foreign)
+	onTransferRules(ctx.stub, "BOND_001", 3, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(retailJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "bob")).Return(qibJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "carol")).Return(foreignJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "INVESTOR_CLASS_NOT_ALLOWED", decision.Reasons[0].ReasonCode)
+
+	decision, err = c.CheckTransfer(ctx, "", "bob", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, int64(0), decision.MaxHolding)
+
+	decision, err = c.CheckTransfer(ctx, "", "carol", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Len(t, decision.Reasons, 1)
+	assert.Equal(t, "JURISDICTION_NOT_ALLOWED", decision.Reasons[0].ReasonCode)
+	assert.Equal(t, int64(50), decision.MaxHolding)
+}
+
+func TestCompliance_SetTransferRules(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := c.SetTransferRules(ctx, "BOND_001", `{"blockedJurisdictions":["US"]}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "COMPLIANCE_ADMIN")
+
+	ctx.identity = complianceAdmin
+	err = c.SetTransferRules(ctx, "BOND_001", `{"investorClasses":{"us":["QIB"]}}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid jurisdiction")
+
+	err = c.SetTransferRules(ctx, "BOND_001", `{"investorClasses":{"*":["CORPORATE"]}}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid investor class")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_RecordTransfer_Limits(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice := KYCRecord{Address: "alice", Nationality: "IN", Status: "APPROVED"}
+	limit := InvestorLimit{Address: "alice", BondID: "GLOBAL", MaxHolding: 100, MaxDailyVolume: 30}
+	usage := LimitUtilization{
+		Address: "alice",
+		BondID:  "GLOBAL",
+		Holding: 80,
+		Trades: []*LimitTrade{
+			{Quantity: 20, Timestamp: now.Add(-2 * time.Hour)},
+			{Quantity: 50, Timestamp: now.Add(-25 * time.Hour)}, // outside the window
+		},
+	}
+
+	aliceJSON, _ := json.Marshal(alice)
+	limitJSON, _ := json.Marshal(limit)
+	usageJSON, _ := json.Marshal(usage)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("LIMIT", "alice", "GLOBAL")).Return(limitJSON, nil)
+	ctx.stub.On("GetState", compositeKey("LIMITUSAGE", "alice", "GLOBAL")).Return(usageJSON, nil)
+	onTransferRules(ctx.stub, "BOND_001", 2)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	onTransferPath(ctx.stub, "bondtoken", "Transfer")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "LimitBreached", mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+
+	decision, err := c.RecordTransfer(ctx, "", "alice", "BOND_001", 25)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Len(t, decision.Reasons, 2)
+	assert.Equal(t, "DAILY_VOLUME_EXCEEDED", decision.Reasons[0].ReasonCode)
+	assert.Equal(t, "HOLDING_LIMIT_EXCEEDED", decision.Reasons[1].ReasonCode)
+	ctx.stub.AssertCalled(t, "SetEvent", "LimitBreached", mock.Anything)
+	ctx.stub.AssertNotCalled(t, "PutState", compositeKey("LIMITUSAGE", "alice", "GLOBAL"), mock.Anything)
+
+	decision, err = c.RecordTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	var stored LimitUtilization
+	json.Unmarshal(ctx.stub.state[compositeKey("LIMITUSAGE", "alice", "GLOBAL")], &stored)
+	assert.Equal(t, int64(90), stored.Holding)
+	assert.Len(t, stored.Trades, 2)
+}
+
+func TestCompliance_SetLimit(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := c.SetLimit(ctx, "alice", "GLOBAL", 100, 30)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "COMPLIANCE_ADMIN")
+
+	ctx.identity = complianceAdmin
+	err = c.SetLimit(ctx, "alice", "GLOBAL", -1, 30)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be negative")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_ApproveInvestorClass(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	kyc := KYCRecord{Address: "alice", Status: "APPROVED", RequestedInvestorClass: "PROFESSIONAL", Version: 3}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err := c.ApproveInvestorClass(ctx, "alice", 3)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "COMPLIANCE_ADMIN")
+
+	ctx.identity = complianceAdmin
+	err = c.ApproveInvestorClass(ctx, "alice", 3)
+	assert.NoError(t, err)
+
+	var stored KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &stored)
+	assert.Equal(t, "PROFESSIONAL", stored.InvestorClass)
+	assert.Empty(t, stored.RequestedInvestorClass)
+	assert.Equal(t, "admin", stored.InvestorClassApprovedBy)
+}
+
+func TestCompliance_RequestInvestorClass_Invalid(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	err := c.RequestInvestorClass(ctx, "alice", "ACCREDITED", 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid investor class")
+	ctx.stub.AssertNotCalled(t, "GetState", mock.Anything)
+}
+
+func TestCompliance_AttachKYCDocument(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	hash := sha256.Sum256([]byte("passport scan"))
+	kyc := KYCRecord{Address: "alice", Status: "PENDING", Metadata: map[string]string{}}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err := c.AttachKYCDocument(ctx, "alice", "PASSPORT", strings.ToUpper(hex.EncodeToString(hash[:])), "s3://kyc/alice/passport.pdf")
+	assert.NoError(t, err)
+
+	var updated KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &updated)
+	assert.Len(t, updated.Documents, 1)
+	assert.Equal(t, hex.EncodeToString(hash[:]), updated.Documents[0].SHA256)
+	assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), updated.Documents[0].UploadedAt)
+
+	err = c.AttachKYCDocument(ctx, "alice", "PASSPORT", "not-a-hash", "s3://kyc/alice/passport.pdf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid SHA-256 hash")
+}
+
+func TestCompliance_AttachKYCDocument_Duplicate(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	hash := hex.EncodeToString(make([]byte, 32))
+	kyc := KYCRecord{Address: "alice", Documents: []*KYCDocument{{DocType: "PASSPORT", SHA256: hash}}}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+
+	err := c.AttachKYCDocument(ctx, "alice", "PROOF_OF_ADDRESS", hash, "s3://kyc/alice/bill.pdf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already attached")
+
+	documents, err := c.GetKYCDocuments(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Len(t, documents, 1)
+}
+
+func TestCompliance_UnderscoreAddress(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	// Under flat keys the KYC record of "alice_PEP" and alice's PEP check
+	// were both stored at "alice_PEP"
+	kyc := KYCRecord{Address: "alice_PEP", Status: "APPROVED"}
+	amlCheck := AMLCheck{Address: "alice", CheckType: "PEP", Status: "PASSED"}
+	kycJSON, _ := json.Marshal(kyc)
+	amlCheckJSON, _ := json.Marshal(amlCheck)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice_PEP")).Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "PEP")).Return(amlCheckJSON, nil)
+
+	retrievedKYC, err := c.GetKYC(ctx, "alice_PEP")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice_PEP", retrievedKYC.Address)
+
+	retrievedCheck, err := c.GetAMLCheck(ctx, "alice", "PEP")
+	assert.NoError(t, err)
+	assert.Equal(t, "PASSED", retrievedCheck.Status)
+}
+
+func TestCompliance_ImportSanctionsEntries_RoleRequired(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	_, err := c.ImportSanctionsEntries(ctx, "OFAC_SDN", `[]`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "COMPLIANCE_ADMIN role required")
+}
+
+func TestCompliance_ImportSanctionsEntries(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	nameHash := screeningHash("Ivan Petrov")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "AMLEvent", mock.Anything).Return(nil)
+
+	count, err := c.ImportSanctionsEntries(ctx, "OFAC_SDN", `[{"id":"12345","nameHash":"`+nameHash+`","effectiveDate":"2024-02-01T00:00:00Z"}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Contains(t, ctx.stub.state, compositeKey("SANCTION", "OFAC_SDN", "12345"))
+	assert.Contains(t, ctx.stub.state, compositeKey("SANCTIONHASH", nameHash, "OFAC_SDN", "12345"))
+
+	_, err = c.ImportSanctionsEntries(ctx, "OFAC_SDN", `[{"id":"12346","nameHash":"IVAN PETROV"}]`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid hash")
+}
+
+func TestCompliance_ScreenAddress_Hit(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	pii := KYCPersonalData{Address: "alice", FullName: "ivan  petrov", IDNumber: "X123"}
+	piiJSON, _ := json.Marshal(pii)
+	ctx.stub.On("GetPrivateData", "kyc-private", "alice").Return(piiJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	nameHash := screeningHash("Ivan Petrov")
+	entry := SanctionsEntry{ID: "12345", Source: "OFAC_SDN", NameHash: nameHash, EffectiveDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}
+	entryJSON, _ := json.Marshal(entry)
+	ctx.stub.On("GetState", compositeKey("SANCTION", "OFAC_SDN", "12345")).Return(entryJSON, nil)
+
+	nameIterator := &MockIterator{results: [][]byte{{0}}, keys: []string{compositeKey("SANCTIONHASH", nameHash, "OFAC_SDN", "12345")}}
+	nameIterator.On("Close").Return(nil)
+	idIterator := &MockIterator{}
+	idIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "SANCTIONHASH", []string{nameHash}).Return(nameIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "SANCTIONHASH", []string{screeningHash("X123")}).Return(idIterator, nil)
+
+	ctx.stub.On("PutState", compositeKey("AML", "alice", "SANCTIONS"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "AMLEvent", mock.Anything).Return(nil)
+
+	result, err := c.ScreenAddress(ctx, "alice")
+	assert.NoError(t, err)
+	assert.True(t, result.Hit)
+	assert.Len(t, result.Matches, 1)
+	assert.Equal(t, "NAME", result.Matches[0].MatchedOn)
+
+	var amlCheck AMLCheck
+	json.Unmarshal(ctx.stub.state[compositeKey("AML", "alice", "SANCTIONS")], &amlCheck)
+	assert.Equal(t, "FAILED", amlCheck.Status)
+	assert.Contains(t, amlCheck.Details, "OFAC_SDN 12345")
+}
+
+func TestNormaliseForScreening(t *testing.T) {
+	assert.Equal(t, "IVAN PETROV", normaliseForScreening("  ivan\tPetrov "))
+	assert.Equal(t, screeningHash("Ivan Petrov"), screeningHash("IVAN  PETROV"))
+}
+
+func TestCompliance_FileSAR(t *testing.T) {
+	t.Setenv("CORE_PEER_LOCALMSPID", "RegulatorMSP")
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	report := `{"address":"alice","txRefs":["tx1","tx2"],"narrative":"Structuring below the daily limit","severity":"HIGH"}`
+	ctx.stub.On("GetTransient").Return(map[string][]byte{"sar": []byte(report)}, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutPrivateData", "sar-private", compositeKey("SAR", "SAR_tx123"), mock.Anything).Return(nil)
+
+	sarID, err := c.FileSAR(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "SAR_tx123", sarID)
+
+	stored := ctx.stub.Calls[len(ctx.stub.Calls)-1].Arguments.Get(2).([]byte)
+	var sar SuspiciousActivityReport
+	json.Unmarshal(stored, &sar)
+	assert.Equal(t, "DRAFT", sar.Status)
+	assert.Equal(t, "officer1", sar.CreatedBy)
+	assert.Equal(t, []string{"tx1", "tx2"}, sar.TxRefs)
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+	ctx.stub.AssertNotCalled(t, "SetEvent", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_FileSAR_NotCollectionMember(t *testing.T) {
+	t.Setenv("CORE_PEER_LOCALMSPID", "CustodianMSP")
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	_, err := c.FileSAR(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not a member of the sar-private collection")
+}
+
+func TestCompliance_SubmitSAR_Closed(t *testing.T) {
+	t.Setenv("CORE_PEER_LOCALMSPID", "RegulatorMSP")
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	sar := SuspiciousActivityReport{ID: "SAR_tx1", Address: "alice", Status: "CLOSED"}
+	sarJSON, _ := json.Marshal(sar)
+	ctx.stub.On("GetPrivateData", "sar-private", compositeKey("SAR", "SAR_tx1")).Return(sarJSON, nil)
+
+	err := c.SubmitSAR(ctx, "SAR_tx1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only DRAFT reports can be filed")
+}
+
+func TestCompliance_QuerySARs(t *testing.T) {
+	t.Setenv("CORE_PEER_LOCALMSPID", "RegulatorMSP")
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	sar1 := SuspiciousActivityReport{ID: "SAR_tx1", Address: "alice", Status: "FILED"}
+	sar2 := SuspiciousActivityReport{ID: "SAR_tx2", Address: "alice", Status: "DRAFT"}
+	sar3 := SuspiciousActivityReport{ID: "SAR_tx3", Address: "bob", Status: "FILED"}
+	sar1JSON, _ := json.Marshal(sar1)
+	sar2JSON, _ := json.Marshal(sar2)
+	sar3JSON, _ := json.Marshal(sar3)
+	iterator := &MockIterator{results: [][]byte{sar1JSON, sar2JSON, sar3JSON}}
+	iterator.On("Close").Return(nil)
+	ctx.stub.On("GetPrivateDataByPartialCompositeKey", "sar-private", "SAR", []string{}).Return(iterator, nil)
+
+	_, err := c.QuerySARs(ctx, "alice", "FILED")
+	assert.Error(t, err)
+
+	ctx.identity = regulator
+	sars, err := c.QuerySARs(ctx, "alice", "FILED")
+	assert.NoError(t, err)
+	assert.Len(t, sars, 1)
+	assert.Equal(t, "SAR_tx1", sars[0].ID)
+}
+
+func TestCompliance_ComputeRiskScore(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	kyc := KYCRecord{Address: "alice", Nationality: "RU", Status: "APPROVED", RiskLevel: "HIGH", RiskScore: &RiskScore{Score: 40}}
+	kycJSON, _ := json.Marshal(kyc)
+	pepCheck, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "PEP", Status: "FAILED", RiskScore: 40})
+	sanctionsCheck, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "SANCTIONS", Status: "PASSED", RiskScore: 20})
+	countryRisk, _ := json.Marshal(CountryRisk{Country: "RU", RiskTier: "HIGH", FATFStatus: "NONE", SanctionsRegimes: []string{"EU", "OFAC"}})
+	usage, _ := json.Marshal(LimitUtilization{Address: "alice", BondID: "GLOBAL", Trades: []*LimitTrade{
+		{Quantity: 100, Timestamp: now.Add(-time.Hour)},
+		{Quantity: 100, Timestamp: now.Add(-2 * time.Hour)},
+		{Quantity: 100, Timestamp: now.Add(-3 * time.Hour)},
+		{Quantity: 100, Timestamp: now.Add(-48 * time.Hour)},
+	}})
+
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("COUNTRYRISK", "RU")).Return(countryRisk, nil)
+	ctx.stub.On("GetState", compositeKey("LIMITUSAGE", "alice", "GLOBAL")).Return(usage, nil)
+	onRiskScoreInputs(ctx.stub, "alice", pepCheck, sanctionsCheck)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "RiskScoreChanged", mock.Anything).Return(nil)
+
+	score, err := c.ComputeRiskScore(ctx, "alice")
+	assert.NoError(t, err)
+	// 90*30% + 100*30% + 90*20% + 30*20%
+	assert.Equal(t, 81, score.Score)
+	assert.Len(t, score.Factors, 4)
+	assert.Equal(t, 100, score.Factors[1].Score)
+	assert.Equal(t, "PEP check FAILED with score 40", score.Factors[1].Detail)
+	assert.Equal(t, 30, score.Factors[3].Score)
+
+	var stored KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &stored)
+	assert.Equal(t, 81, stored.RiskScore.Score)
+	ctx.stub.AssertExpectations(t)
+}
+
+func TestCompliance_ComputeRiskScore_Unchanged(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	kyc := KYCRecord{Address: "alice", Nationality: "US", Status: "APPROVED", RiskLevel: "LOW", RiskScore: &RiskScore{Score: 18}}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("COUNTRYRISK", "US")).Return(nil, nil)
+	onRiskScoreInputs(ctx.stub, "alice")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+
+	score, err := c.ComputeRiskScore(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, 18, score.Score)
+	ctx.stub.AssertNotCalled(t, "SetEvent", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_QueryKYC(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	kyc1, _ := json.Marshal(KYCRecord{Address: "alice", Nationality: "GB", Status: "PENDING", DocType: "KYC"})
+	kyc2, _ := json.Marshal(KYCRecord{Address: "bob", Nationality: "GB", Status: "PENDING", DocType: "KYC"})
+	iterator := &MockIterator{results: [][]byte{kyc1, kyc2}}
+	iterator.On("Close").Return(nil)
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: 2, Bookmark: "next"}
+	query := `{"selector":{"docType":"KYC","nationality":"GB","status":"PENDING"}}`
+	ctx.stub.On("GetQueryResultWithPagination", query, int32(2), "").Return(iterator, metadata, nil)
+
+	page, err := c.QueryKYC(ctx, "PENDING", "", "GB", 2, "")
+	assert.NoError(t, err)
+	assert.Len(t, page.Records, 2)
+	assert.Equal(t, "bob", page.Records[1].Address)
+	assert.Equal(t, int32(2), page.Count)
+	assert.Equal(t, "next", page.Bookmark)
+}
+
+func TestCompliance_QueryKYC_InvalidStatus(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	_, err := c.QueryKYC(ctx, "EXPIRED", "", "", 10, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid KYC status")
+}
+
+func TestCompliance_CheckTransfer_KYCTier(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	rules := TransferRules{BondID: "BOND_001", MaxHoldingByClass: map[string]int64{"RETAIL": 50}}
+	alice := KYCRecord{Address: "alice", Nationality: "IN", Status: "APPROVED", KYCTier: "STANDARD"}
+	limits := KYCTierLimits{Tier: "STANDARD", MaxHolding: 40, MaxTransferQuantity: 20}
+
+	rulesJSON, _ := json.Marshal(rules)
+	aliceJSON, _ := json.Marshal(alice)
+	limitsJSON, _ := json.Marshal(limits)
+	onTransferRules(ctx.stub, "BOND_001", 2, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYCTIER", "STANDARD")).Return(limitsJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "", "alice", "BOND_001", 30)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "KYC_TIER_TRANSFER_LIMIT_EXCEEDED", decision.Reasons[0].ReasonCode)
+
+	// The tier's holding limit is tighter than the investor class limit
+	decision, err = c.CheckTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, int64(40), decision.MaxHolding)
+}
+
+func TestCompliance_ApproveKYCTierUpgrade_MissingDocuments(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	kyc := KYCRecord{
+		Address:          "alice",
+		Status:           "APPROVED",
+		RequestedKYCTier: "ENHANCED",
+		Documents:        []*KYCDocument{{DocType: "PASSPORT"}},
+	}
+	limits := KYCTierLimits{Tier: "ENHANCED", RequiredDocuments: []string{"PASSPORT", "PROOF_OF_FUNDS"}}
+	kycJSON, _ := json.Marshal(kyc)
+	limitsJSON, _ := json.Marshal(limits)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYCTIER", "ENHANCED")).Return(limitsJSON, nil)
+
+	err := c.ApproveKYCTierUpgrade(ctx, "alice", 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PROOF_OF_FUNDS")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_RequestKYCTierUpgrade_NotHigher(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	kyc := KYCRecord{Address: "alice", Status: "APPROVED", KYCTier: "STANDARD"}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+
+	err := c.RequestKYCTierUpgrade(ctx, "alice", "BASIC", 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already on the STANDARD tier")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_ExecuteErasure(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kyc := KYCRecord{
+		Address:            "alice",
+		Status:             "APPROVED",
+		RiskLevel:          "LOW",
+		PIIHash:            "abc123",
+		ApprovedBy:         "officer1",
+		Documents:          []*KYCDocument{{DocType: "PASSPORT", SHA256: "def456"}},
+		ErasureRequestedAt: now.AddDate(0, 0, -1),
+	}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("PurgePrivateData", "kyc-private", "alice").Return(nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err := c.ExecuteErasure(ctx, "alice")
+	assert.NoError(t, err)
+
+	var stored KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &stored)
+	assert.Equal(t, "ERASED", stored.Status)
+	assert.Empty(t, stored.PIIHash)
+	assert.Empty(t, stored.Documents)
+	assert.Equal(t, "admin", stored.ErasedBy)
+	// The decision trail stays
+	assert.Equal(t, "LOW", stored.RiskLevel)
+	assert.Equal(t, "officer1", stored.ApprovedBy)
+	ctx.stub.AssertExpectations(t)
+}
+
+func TestCompliance_ExecuteErasure_NotRequested(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	kyc := KYCRecord{Address: "alice", Status: "APPROVED"}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+
+	err := c.ExecuteErasure(ctx, "alice")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no erasure requested")
+	ctx.stub.AssertNotCalled(t, "PurgePrivateData", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_GetComplianceHistory(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	day := func(d int) *timestamp.Timestamp {
+		return &timestamp.Timestamp{Seconds: time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC).Unix()}
+	}
+	pending, _ := json.Marshal(KYCRecord{Address: "alice", Status: "PENDING", UpdatedBy: "officer1", UpdatedByMSP: "RegulatorMSP"})
+	rescored, _ := json.Marshal(KYCRecord{Address: "alice", Status: "PENDING", RiskLevel: "LOW", UpdatedBy: "officer1", UpdatedByMSP: "RegulatorMSP"})
+	approved, _ := json.Marshal(KYCRecord{Address: "alice", Status: "APPROVED", UpdatedBy: "officer2", UpdatedByMSP: "RegulatorMSP"})
+	checkPending, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "SANCTIONS", Status: "PENDING", CheckedBy: "officer1"})
+	checkPassed, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "SANCTIONS", Status: "PASSED", CheckedBy: "officer2", CheckedByMSP: "RegulatorMSP"})
+
+	// Ledger history comes back newest first
+	kycHistory := &MockHistoryIterator{modifications: []*queryresult.KeyModification{
+		{TxId: "tx5", Value: approved, Timestamp: day(5)},
+		{TxId: "tx2", Value: rescored, Timestamp: day(2)},
+		{TxId: "tx1", Value: pending, Timestamp: day(1)},
+	}}
+	kycHistory.On("Close").Return(nil)
+	amlHistory := &MockHistoryIterator{modifications: []*queryresult.KeyModification{
+		{TxId: "tx4", Value: checkPassed, Timestamp: day(4)},
+		{TxId: "tx3", Value: checkPending, Timestamp: day(3)},
+	}}
+	amlHistory.On("Close").Return(nil)
+	amlIterator := &MockIterator{results: [][]byte{checkPassed}, keys: []string{compositeKey("AML", "alice", "SANCTIONS")}}
+	amlIterator.On("Close").Return(nil)
+
+	ctx.stub.On("GetStateByPartialCompositeKey", "AML", []string{"alice"}).Return(amlIterator, nil)
+	ctx.stub.On("GetHistoryForKey", compositeKey("KYC", "alice")).Return(kycHistory, nil)
+	ctx.stub.On("GetHistoryForKey", compositeKey("AML", "alice", "SANCTIONS")).Return(amlHistory, nil)
+
+	history, err := c.GetComplianceHistory(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Len(t, history, 4)
+
+	var txIDs []string
+	for _, entry := range history {
+		txIDs = append(txIDs, entry.TxID)
+	}
+	assert.Equal(t, []string{"tx1", "tx3", "tx4", "tx5"}, txIDs)
+	assert.Equal(t, "SANCTIONS", history[2].Record)
+	assert.Equal(t, "PENDING", history[2].PreviousStatus)
+	assert.Equal(t, "officer2", history[2].Invoker)
+	assert.Equal(t, "KYC", history[3].Record)
+	assert.Equal(t, "APPROVED", history[3].Status)
+	assert.Equal(t, "RegulatorMSP", history[3].InvokerMSP)
+}
+
+func TestCompliance_IssueAttestation(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kyc := KYCRecord{Address: "alice", Status: "APPROVED", RiskLevel: "LOW"}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", compositeKey("ATTESTATION", "ATT_tx123"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	attestationID, err := c.IssueAttestation(ctx, "alice", "KYC", "2025-03-01")
+	assert.NoError(t, err)
+	assert.Equal(t, "ATT_tx123", attestationID)
+
+	var stored Attestation
+	json.Unmarshal(ctx.stub.state[compositeKey("ATTESTATION", "ATT_tx123")], &stored)
+	assert.Equal(t, "KYC", stored.Scope)
+	assert.Equal(t, "LOW", stored.RiskLevel)
+	assert.Equal(t, "officer1", stored.IssuedBy)
+	assert.Len(t, stored.Hash, 64)
+
+	// The stored attestation verifies against its own hash
+	ctx.stub.On("GetState", compositeKey("ATTESTATION", "ATT_tx123")).Return(ctx.stub.state[compositeKey("ATTESTATION", "ATT_tx123")], nil)
+	verification, err := c.VerifyAttestation(ctx, "ATT_tx123", stored.Hash)
+	assert.NoError(t, err)
+	assert.True(t, verification.Valid)
+}
+
+func TestCompliance_IssueAttestation_KYCNotApproved(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	kyc := KYCRecord{Address: "alice", Status: "PENDING"}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	_, err := c.IssueAttestation(ctx, "alice", "KYC", "2025-03-01")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "KYC status is PENDING")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_VerifyAttestation_Invalid(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	attestation := &Attestation{
+		ID:        "ATT_tx1",
+		Address:   "alice",
+		Scope:     "KYC",
+		IssuedAt:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	attestation.Hash, _ = attestationHash(attestation)
+	attestationJSON, _ := json.Marshal(attestation)
+	kycJSON, _ := json.Marshal(KYCRecord{Address: "alice", Status: "APPROVED"})
+	ctx.stub.On("GetState", compositeKey("ATTESTATION", "ATT_tx1")).Return(attestationJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	verification, err := c.VerifyAttestation(ctx, "ATT_tx1", "")
+	assert.NoError(t, err)
+	assert.False(t, verification.Valid)
+	assert.Equal(t, "attestation expired on 2024-06-01", verification.Reason)
+
+	verification, err = c.VerifyAttestation(ctx, "ATT_tx1", "deadbeef")
+	assert.NoError(t, err)
+	assert.False(t, verification.Valid)
+	assert.Equal(t, "hash does not match the attestation", verification.Reason)
+}
+
+func TestCompliance_SetCountryRisk(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", compositeKey("COUNTRYRISK", "IR"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "AMLEvent", mock.Anything).Return(nil)
+
+	err := c.SetCountryRisk(ctx, "IR", `{"riskTier":"HIGH","fatfStatus":"CALL_FOR_ACTION","sanctionsRegimes":["OFAC","EU","UN"]}`)
+	assert.NoError(t, err)
+
+	var stored CountryRisk
+	json.Unmarshal(ctx.stub.state[compositeKey("COUNTRYRISK", "IR")], &stored)
+	assert.Equal(t, "IR", stored.Country)
+	assert.Equal(t, "admin", stored.UpdatedBy)
+	assert.True(t, stored.prohibited())
+	assert.Equal(t, 100, stored.score())
+
+	err = c.SetCountryRisk(ctx, "IR", `{"riskTier":"SEVERE"}`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid risk tier")
+}
+
+func TestCompliance_CheckTransfer_CountryRisk(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	rules := TransferRules{BondID: "BOND_001", MaxRiskLevel: "MEDIUM"}
+	alice := KYCRecord{Address: "alice", Nationality: "KP", Status: "APPROVED", RiskLevel: "LOW"}
+	bob := KYCRecord{Address: "bob", Nationality: "PA", Status: "APPROVED", RiskLevel: "LOW"}
+	prohibited := CountryRisk{Country: "KP", RiskTier: "PROHIBITED", FATFStatus: "CALL_FOR_ACTION"}
+	highRisk := CountryRisk{Country: "PA", RiskTier: "HIGH", FATFStatus: "INCREASED_MONITORING"}
+
+	rulesJSON, _ := json.Marshal(rules)
+	aliceJSON, _ := json.Marshal(alice)
+	bobJSON, _ := json.Marshal(bob)
+	prohibitedJSON, _ := json.Marshal(prohibited)
+	highRiskJSON, _ := json.Marshal(highRisk)
+	onTransferRules(ctx.stub, "BOND_001", 1, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "bob")).Return(bobJSON, nil)
+	ctx.stub.On("GetState", compositeKey("COUNTRYRISK", "KP")).Return(prohibitedJSON, nil)
+	ctx.stub.On("GetState", compositeKey("COUNTRYRISK", "PA")).Return(highRiskJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "alice", "bob", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Len(t, decision.Reasons, 2)
+	assert.Equal(t, "JURISDICTION_PROHIBITED", decision.Reasons[0].ReasonCode)
+	assert.Equal(t, "JURISDICTION_RISK_EXCEEDED", decision.Reasons[1].ReasonCode)
+}
+
+func TestCompliance_RecordTransfer_DecisionEvent(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	rules := TransferRules{BondID: "BOND_001", Version: 3, BlockedJurisdictions: []string{"US"}, MaxTransferQuantity: 100}
+	alice := KYCRecord{Address: "alice", Nationality: "US", Status: "APPROVED", RiskLevel: "LOW"}
+
+	rulesJSON, _ := json.Marshal(rules)
+	aliceJSON, _ := json.Marshal(alice)
+	onTransferRules(ctx.stub, "BOND_001", 1, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	onTransferPath(ctx.stub, "bondtoken", "Transfer")
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+	ctx.stub.On("PutState", compositeKey("BLOCKEDTRANSFER", "tx123"), mock.Anything).Return(nil)
+
+	decision, err := c.RecordTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Contains(t, decision.RulesEvaluated, "TRANSFER_LIMIT")
+	assert.Contains(t, decision.RulesEvaluated, "JURISDICTION")
+	assert.NotContains(t, decision.RulesEvaluated, "INVESTOR_CLASS")
+
+	var event ComplianceEvent
+	for _, call := range ctx.stub.Calls {
+		if call.Method == "SetEvent" {
+			json.Unmarshal(call.Arguments.Get(1).([]byte), &event)
+		}
+	}
+	assert.Equal(t, "TRANSFER_DENIED", event.Type)
+	assert.Equal(t, "DENIED", event.Outcome)
+	assert.Equal(t, "alice", event.Address)
+	assert.Equal(t, int64(3), event.PolicyVersion)
+	assert.Equal(t, decision.RulesEvaluated, event.RulesEvaluated)
+	assert.Equal(t, "JURISDICTION_BLOCKED", event.Reasons[0].ReasonCode)
+}
+
+func TestCompliance_RecordTransfer_NotTransferPath(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	// A client calling compliance directly cannot count a transfer
+	onTransferPath(ctx.stub, "compliance", "RecordTransfer")
+
+	_, err := c.RecordTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "transfers may only be recorded by bondtoken Transfer or settlement SettleTrade")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+	ctx.stub.AssertNotCalled(t, "SetEvent", mock.Anything, mock.Anything)
+
+	// Nor can one calling a BondToken function that moves no tokens
+	ctx = &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	onTransferPath(ctx.stub, "bondtoken", "CanTransfer")
+
+	_, err = c.RecordTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.Error(t, err)
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_AddBeneficialOwner(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	pii := []byte(`{"fullName":"Carol Smith","dateOfBirth":"1970-05-01","documents":[{"type":"PASSPORT","number":"GB654321","issuingCountry":"GB","expiryDate":"2030-05-01"}]}`)
+	kyc := KYCRecord{Address: "acme", Nationality: "GB", Status: "APPROVED", RecordType: "CORPORATE", BeneficialOwners: []*BeneficialOwner{
+		{UBOID: "ubo1", Nationality: "GB", OwnershipPercent: 60, ScreeningStatus: "PASSED"},
+	}}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "acme")).Return(kycJSON, nil)
+	ctx.stub.On("GetTransient").Return(map[string][]byte{"ubo": pii}, nil)
+	ctx.stub.On("PutPrivateData", "kyc-private", compositeKey("UBO", "acme", "ubo2"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "acme"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err := c.AddBeneficialOwner(ctx, "acme", "ubo2", "FR", 30)
+	assert.NoError(t, err)
+
+	var stored KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "acme")], &stored)
+	assert.Len(t, stored.BeneficialOwners, 2)
+	assert.Equal(t, "PENDING", stored.BeneficialOwners[1].ScreeningStatus)
+	assert.Len(t, stored.BeneficialOwners[1].PIIHash, 64)
+	assert.NotContains(t, string(ctx.stub.state[compositeKey("KYC", "acme")]), "Carol Smith")
+
+	// Owners cannot add up to more than 100 percent
+	err = c.AddBeneficialOwner(ctx, "acme", "ubo3", "FR", 50)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "above 100%")
+}
+
+func TestCompliance_CheckCompliance_FailedBeneficialOwner(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	kyc := KYCRecord{Address: "acme", Nationality: "GB", Status: "APPROVED", BeneficialOwners: []*BeneficialOwner{
+		{UBOID: "ubo1", OwnershipPercent: 20, ScreeningStatus: "FAILED"},
+		{UBOID: "ubo2", OwnershipPercent: 30, ScreeningStatus: "FAILED"},
+	}}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "acme")).Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("BLACKLIST", "acme")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	compliant, reason, err := c.CheckCompliance(ctx, "acme")
+	assert.NoError(t, err)
+	assert.False(t, compliant)
+	// Owners of 25% or less do not make the entity non-compliant
+	assert.Equal(t, "Beneficial owner ubo2 (30.00%) failed screening", reason)
+}
+
+func TestCompliance_CreateCorporateKYC(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	entity := []byte(`{"legalName":"Acme Holdings Ltd","registrationNumber":"01234567","directors":[{"fullName":"Carol Smith","role":"CEO"}]}`)
+	ctx.stub.On("GetState", compositeKey("KYC", "acme")).Return(nil, nil)
+	ctx.stub.On("GetTransient").Return(map[string][]byte{"kyc": entity}, nil)
+	ctx.stub.On("PutPrivateData", "kyc-private", "acme", mock.Anything).Return(nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "acme"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err := c.CreateCorporateKYC(ctx, "acme", "GB", "5493001KJTIIGC8Y1R12")
+	assert.NoError(t, err)
+
+	var kyc KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "acme")], &kyc)
+	assert.Equal(t, "CORPORATE", kyc.RecordType)
+	assert.Equal(t, "GB", kyc.Nationality)
+	assert.Equal(t, "5493001KJTIIGC8Y1R12", kyc.LEI)
+	assert.NotContains(t, string(ctx.stub.state[compositeKey("KYC", "acme")]), "01234567")
+
+	err = c.CreateCorporateKYC(ctx, "acme", "GB", "5493001KJTIIGC8Y1R13")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid LEI")
+}
+
+func TestCompliance_CreateCorporateKYC_NoDirectors(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	entity := []byte(`{"legalName":"Acme Holdings Ltd","registrationNumber":"01234567"}`)
+	ctx.stub.On("GetState", compositeKey("KYC", "acme")).Return(nil, nil)
+	ctx.stub.On("GetTransient").Return(map[string][]byte{"kyc": entity}, nil)
+
+	err := c.CreateCorporateKYC(ctx, "acme", "GB", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "at least one director")
+	ctx.stub.AssertNotCalled(t, "PutPrivateData", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCompliance_SuspendKYC(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kyc := KYCRecord{Address: "alice", Status: "APPROVED", RiskLevel: "LOW", Metadata: map[string]string{}}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "KYCSuspended", mock.Anything).Return(nil)
+
+	err := c.SuspendKYC(ctx, "alice", "Unusual trading under investigation")
+	assert.NoError(t, err)
+
+	var stored KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &stored)
+	assert.Equal(t, "SUSPENDED", stored.Status)
+
+	var event KYCStatusEvent
+	json.Unmarshal(ctx.stub.Calls[len(ctx.stub.Calls)-1].Arguments.Get(1).([]byte), &event)
+	assert.Equal(t, "APPROVED", event.PreviousStatus)
+	assert.Equal(t, now, event.EffectiveFrom.UTC())
+	assert.Equal(t, "tx123", event.TxID)
+}
+
+func TestCompliance_ExpireKYC(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	approvedAt := now.AddDate(-2, 0, -1)
+	kyc := KYCRecord{Address: "alice", Status: "APPROVED", RiskLevel: "MEDIUM", ApprovedAt: approvedAt}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "KYCExpired", mock.Anything).Return(nil)
+
+	err := c.ExpireKYC(ctx, "alice")
+	assert.NoError(t, err)
+
+	var event KYCStatusEvent
+	json.Unmarshal(ctx.stub.Calls[len(ctx.stub.Calls)-1].Arguments.Get(1).([]byte), &event)
+	assert.Equal(t, "EXPIRED", event.Status)
+	// MEDIUM risk investors are reviewed every 2 years
+	assert.Equal(t, approvedAt.AddDate(2, 0, 0), event.EffectiveFrom.UTC())
+}
+
+func TestCompliance_ExpireKYC_NotDue(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kyc := KYCRecord{Address: "alice", Status: "APPROVED", RiskLevel: "LOW", ApprovedAt: now.AddDate(-1, 0, 0)}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+
+	err := c.ExpireKYC(ctx, "alice")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not due for review until 2026-03-01")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+// registerScreeningProvider returns a new provider signing key and mocks the
+// registration of its public key for the screeningProvider client
+func registerScreeningProvider(t *testing.T, stub *MockStub, providerID string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+
+	provider, _ := json.Marshal(ScreeningProvider{
+		ProviderID:   providerID,
+		Name:         "World-Check",
+		PublicKey:    string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})),
+		MSPID:        "RegulatorMSP",
+		EnrollmentID: "worldcheck",
+		Active:       true,
+	})
+	stub.On("GetState", compositeKey("SCREENINGPROVIDER", providerID)).Return(provider, nil)
+	return key
+}
+
+// signScreeningResult returns the base64 ASN.1 ECDSA signature of a payload
+func signScreeningResult(t *testing.T, key *ecdsa.PrivateKey, payload string) string {
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestCompliance_SubmitScreeningResult(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: screeningProvider}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := registerScreeningProvider(t, ctx.stub, "WC")
+	payload := `{"providerId":"WC","referenceId":"REF-1","address":"alice","checkType":"SANCTIONS","status":"PASSED","riskScore":15,"screenedAt":"2024-03-01T11:00:00Z"}`
+
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("SCREENINGSUBMISSION", "WC", "REF-1")).Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "SANCTIONS")).Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "AMLEvent", mock.Anything).Return(nil)
+
+	err := c.SubmitScreeningResult(ctx, "WC", payload, signScreeningResult(t, key, payload))
+	assert.NoError(t, err)
+
+	var check AMLCheck
+	json.Unmarshal(ctx.stub.state[compositeKey("AML", "alice", "SANCTIONS")], &check)
+	assert.Equal(t, "PASSED", check.Status)
+	assert.Equal(t, "WC", check.CheckedBy)
+	assert.Equal(t, "REF-1", check.ProviderReference)
+	// 6 months validity from the screening time
+	assert.Equal(t, time.Date(2024, 9, 1, 11, 0, 0, 0, time.UTC), check.ExpiryDate.UTC())
+	assert.Contains(t, ctx.stub.state, compositeKey("SCREENINGSUBMISSION", "WC", "REF-1"))
+
+	var event ComplianceEvent
+	json.Unmarshal(ctx.stub.Calls[len(ctx.stub.Calls)-1].Arguments.Get(1).([]byte), &event)
+	assert.Equal(t, "AML_CHECK_CREATED", event.Type)
+	assert.Equal(t, "PASSED", event.Outcome)
+}
+
+func TestCompliance_SubmitScreeningResult_InvalidSignature(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: screeningProvider}
+
+	key := registerScreeningProvider(t, ctx.stub, "WC")
+	payload := `{"providerId":"WC","referenceId":"REF-1","address":"alice","checkType":"SANCTIONS","status":"FAILED","riskScore":95,"screenedAt":"2024-03-01T11:00:00Z"}`
+	signature := signScreeningResult(t, key, payload)
+
+	err := c.SubmitScreeningResult(ctx, "WC", strings.Replace(payload, "FAILED", "PASSED", 1), signature)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid signature")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_PlaceHold(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	ctx.stub.On("GetState", compositeKey("HOLD", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: []byte("2")})
+	ctx.stub.On("PutState", compositeKey("HOLD", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "AMLEvent", mock.Anything).Return(nil)
+
+	holdID, err := c.PlaceHold(ctx, "alice", "", "Sanctions investigation")
+	assert.NoError(t, err)
+	assert.Equal(t, "HOLD_tx123", holdID)
+	ctx.stub.AssertCalled(t, "InvokeChaincode", "bondtoken", [][]byte{[]byte("PlaceComplianceHold"), []byte("HOLD_tx123"), []byte("alice"), []byte("")}, "")
+
+	var holds []*ComplianceHold
+	json.Unmarshal(ctx.stub.state[compositeKey("HOLD", "alice")], &holds)
+	assert.Len(t, holds, 1)
+	assert.Equal(t, "ACTIVE", holds[0].Status)
+	assert.Equal(t, 2, holds[0].Holdings)
+}
+
+func TestCompliance_RecordTransfer_ComplianceHold(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	rules := TransferRules{BondID: "BOND_001"}
+	kyc := KYCRecord{Address: "alice", Nationality: "US", Status: "APPROVED", RiskLevel: "LOW"}
+	holds := []*ComplianceHold{
+		{ID: "HOLD_tx1", Address: "alice", BondID: "BOND_002", Reason: "court order", Status: "ACTIVE"},
+		{ID: "HOLD_tx2", Address: "alice", Reason: "fraud review", Status: "RELEASED"},
+		{ID: "HOLD_tx3", Address: "alice", Reason: "sanctions investigation", Status: "ACTIVE"},
+	}
+
+	rulesJSON, _ := json.Marshal(rules)
+	kycJSON, _ := json.Marshal(kyc)
+	holdsJSON, _ := json.Marshal(holds)
+	onTransferRules(ctx.stub, "BOND_001", 1, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("GetState", compositeKey("HOLD", "alice")).Return(holdsJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	onTransferPath(ctx.stub, "settlement", "SettlementContract:SettleTrade")
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+	ctx.stub.On("PutState", compositeKey("BLOCKEDTRANSFER", "tx123"), mock.Anything).Return(nil)
+
+	decision, err := c.RecordTransfer(ctx, "alice", "", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Len(t, decision.Reasons, 1)
+	assert.Equal(t, "COMPLIANCE_HOLD", decision.Reasons[0].ReasonCode)
+	assert.Contains(t, decision.Reasons[0].Reason, "HOLD_tx3")
+
+	var blocked BlockedTransfer
+	json.Unmarshal(ctx.stub.state[compositeKey("BLOCKEDTRANSFER", "tx123")], &blocked)
+	assert.Equal(t, "alice", blocked.From)
+	assert.Equal(t, []string{"COMPLIANCE_HOLD"}, blocked.ReasonCodes)
+}
+
+func TestCompliance_CreateExemption(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("EXEMPTION", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", compositeKey("EXEMPTION", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "TransferRulesEvent", mock.Anything).Return(nil)
+
+	_, err := c.CreateExemption(ctx, "alice", "JURISDICTION_BLOCKED", "BOND_001", "2025-03-01", "officer1", "Held before the US block")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "someone other than officer1")
+
+	_, err = c.CreateExemption(ctx, "alice", "BLACKLISTED", "BOND_001", "2025-03-01", "admin", "Held before the US block")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be exempted")
+
+	exemptionID, err := c.CreateExemption(ctx, "alice", "JURISDICTION_BLOCKED", "BOND_001", "2025-03-01", "admin", "Held before the US block")
+	assert.NoError(t, err)
+	assert.Equal(t, "EXM_tx123", exemptionID)
+
+	var exemptions []*Exemption
+	json.Unmarshal(ctx.stub.state[compositeKey("EXEMPTION", "alice")], &exemptions)
+	assert.Len(t, exemptions, 1)
+	assert.Equal(t, "PENDING", exemptions[0].Status)
+	assert.Equal(t, "officer1", exemptions[0].CreatedBy)
+}
+
+func TestCompliance_CheckTransfer_Exemption(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	rules := TransferRules{BondID: "BOND_001", BlockedJurisdictions: []string{"US"}}
+	alice := KYCRecord{Address: "alice", Nationality: "US", Status: "APPROVED", RiskLevel: "LOW"}
+	exemptions := []*Exemption{
+		{ID: "EXM_tx1", Address: "alice", ReasonCode: "JURISDICTION_BLOCKED", BondID: "BOND_002", Status: "APPROVED", ExpiresAt: now.AddDate(1, 0, 0)},
+		{ID: "EXM_tx2", Address: "alice", ReasonCode: "JURISDICTION_BLOCKED", Status: "PENDING", ExpiresAt: now.AddDate(1, 0, 0)},
+		{ID: "EXM_tx3", Address: "alice", ReasonCode: "JURISDICTION_BLOCKED", BondID: "BOND_001", Status: "APPROVED", ExpiresAt: now.AddDate(1, 0, 0)},
+	}
+
+	rulesJSON, _ := json.Marshal(rules)
+	aliceJSON, _ := json.Marshal(alice)
+	exemptionsJSON, _ := json.Marshal(exemptions)
+	onTransferRules(ctx.stub, "BOND_001", 1, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("EXEMPTION", "alice")).Return(exemptionsJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "TransferDecision", mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Len(t, decision.Exempted, 1)
+	assert.Equal(t, "EXM_tx3", decision.Exempted[0].ExemptionID)
+}
+
+func TestCompliance_SimulateCheckTransfer(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	rules := TransferRules{BondID: "BOND_001", BlockedJurisdictions: []string{"US"}}
+	rulesJSON, _ := json.Marshal(rules)
+	onTransferRules(ctx.stub, "BOND_001", 2, rulesJSON)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+
+	decision, err := c.SimulateCheckTransfer(ctx, "", "alice", "BOND_001", 50, `{"kyc":{"alice":{"status":"APPROVED","nationality":"US","riskLevel":"LOW"}},"limits":[{"address":"alice","bondId":"GLOBAL","maxHolding":40}]}`)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Len(t, decision.Reasons, 2)
+	assert.Equal(t, "JURISDICTION_BLOCKED", decision.Reasons[0].ReasonCode)
+	assert.Equal(t, "HOLDING_LIMIT_EXCEEDED", decision.Reasons[1].ReasonCode)
+	assert.Contains(t, decision.RulesEvaluated, "HOLDING_LIMIT")
+
+	decision, err = c.SimulateCheckTransfer(ctx, "", "alice", "BOND_001", 50, `{"kyc":{"alice":{"status":"APPROVED","nationality":"GB","riskLevel":"LOW"}}}`)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+	ctx.stub.AssertNotCalled(t, "SetEvent", mock.Anything, mock.Anything)
+}
+
+func TestCompliance_GetComplianceStats(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice, _ := json.Marshal(KYCRecord{Address: "alice", Status: "APPROVED", RiskLevel: "LOW", RequestedKYCTier: "ENHANCED"})
+	bob, _ := json.Marshal(KYCRecord{Address: "bob", Status: "PENDING"})
+	carol, _ := json.Marshal(KYCRecord{Address: "carol", Status: "REJECTED", UpdatedAt: now.AddDate(0, 0, -3)})
+	dave, _ := json.Marshal(KYCRecord{Address: "dave", Status: "REJECTED", UpdatedAt: now.AddDate(0, -6, 0)})
+	expired, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "PEP", Status: "PASSED", ExpiryDate: now.AddDate(0, 0, -1)})
+	expiring, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "SANCTIONS", Status: "PASSED", ExpiryDate: now.AddDate(0, 0, 10)})
+	current, _ := json.Marshal(AMLCheck{Address: "bob", CheckType: "SANCTIONS", Status: "FAILED", ExpiryDate: now.AddDate(0, 3, 0)})
+	exemptions, _ := json.Marshal([]*Exemption{{ID: "EXM_tx1", Status: "PENDING"}, {ID: "EXM_tx2", Status: "APPROVED"}})
+
+	kycIterator := &MockIterator{results: [][]byte{alice, bob, carol, dave}}
+	kycIterator.On("Close").Return(nil)
+	amlIterator := &MockIterator{results: [][]byte{expired, expiring, current}}
+	amlIterator.On("Close").Return(nil)
+	exemptionIterator := &MockIterator{results: [][]byte{exemptions}}
+	exemptionIterator.On("Close").Return(nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "KYC", []string{}).Return(kycIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "AML", []string{}).Return(amlIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "EXEMPTION", []string{}).Return(exemptionIterator, nil)
+
+	stats, err := c.GetComplianceStats(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, stats.WindowDays)
+	assert.Equal(t, 4, stats.TotalKYC)
+	assert.Equal(t, 2, stats.KYCByStatus["REJECTED"])
+	assert.Equal(t, map[string]int{"LOW": 1}, stats.KYCByRiskLevel)
+	assert.Equal(t, 1, stats.PendingKYC)
+	assert.Equal(t, 1, stats.PendingKYCTier)
+	assert.Equal(t, 1, stats.PendingExemptions)
+	assert.Equal(t, 1, stats.RecentRejections)
+	assert.Equal(t, 1, stats.ExpiredChecks)
+	assert.Equal(t, 1, stats.ExpiringChecks)
+	assert.Equal(t, 1, stats.ChecksByStatus["FAILED"])
+}
+
+func TestCompliance_RecordTransfer_Velocity(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	rules := TransferRules{BondID: "BOND_001", UnitValue: 1000}
+	alice := KYCRecord{Address: "alice", Nationality: "GB", Status: "APPROVED", RiskLevel: "LOW"}
+	velocity := VelocityRules{Rules: []*VelocityRule{
+		{ID: "COUNT_1H", WindowHours: 1, MaxTransfers: 2},
+		{ID: "VALUE_24H", WindowHours: 24, MaxValue: 100000},
+	}}
+	usage := LimitUtilization{Address: "alice", BondID: "GLOBAL", Trades: []*LimitTrade{
+		{Quantity: 10, Value: 10000, Timestamp: now.Add(-30 * time.Minute)},
+		{Quantity: 70, Value: 70000, Timestamp: now.Add(-5 * time.Hour)},
+	}}
+
+	rulesJSON, _ := json.Marshal(rules)
+	aliceJSON, _ := json.Marshal(alice)
+	velocityJSON, _ := json.Marshal(velocity)
+	usageJSON, _ := json.Marshal(usage)
+	onTransferRules(ctx.stub, "BOND_001", 2, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("VELOCITYRULES")).Return(velocityJSON, nil)
+	ctx.stub.On("GetState", compositeKey("LIMITUSAGE", "alice", "GLOBAL")).Return(usageJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	onTransferPath(ctx.stub, "bondtoken", "Transfer")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", mock.Anything, mock.Anything).Return(nil)
+
+	// 20 tokens are worth 20000, taking the 24 hour value to exactly the limit
+	decision, err := c.RecordTransfer(ctx, "", "alice", "BOND_001", 20)
+	assert.NoError(t, err)
+	assert.True(t, decision.Allowed)
+	assert.Contains(t, decision.RulesEvaluated, "VELOCITY")
+
+	decision, err = c.RecordTransfer(ctx, "", "alice", "BOND_001", 21)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Len(t, decision.Reasons, 1)
+	assert.Equal(t, "VELOCITY_EXCEEDED", decision.Reasons[0].ReasonCode)
+	assert.Contains(t, decision.Reasons[0].Reason, "rule VALUE_24H")
+	ctx.stub.AssertCalled(t, "SetEvent", "LimitBreached", mock.Anything)
+}
+
+func TestCompliance_GetComplianceExceptions(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: regulator}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	bonds := `[{"id":"BOND_001","issuerId":"issuer1","status":"ACTIVE"},{"id":"BOND_002","issuerId":"issuer1","status":"VOID"}]`
+	holders := `[{"address":"issuer1","bondId":"BOND_001","quantity":500},{"address":"bob","bondId":"BOND_001","quantity":100},{"address":"alice","bondId":"BOND_001","quantity":50},{"address":"carol","bondId":"BOND_001","quantity":0}]`
+	alice, _ := json.Marshal(KYCRecord{Address: "alice", Status: "APPROVED"})
+	sanctions, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "SANCTIONS", Status: "PASSED", ExpiryDate: now.AddDate(0, 0, -1)})
+	pep, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "PEP", Status: "PASSED", ExpiryDate: now.AddDate(0, 6, 0)})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("GetAllBonds")}, "").Return(peer.Response{Status: 200, Payload: []byte(bonds)})
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("GetBondHolders"), []byte("BOND_001")}, "").Return(peer.Response{Status: 200, Payload: []byte(holders)})
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(alice, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "SANCTIONS")).Return(sanctions, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "PEP")).Return(pep, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+
+	report, err := c.GetComplianceExceptions(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.HoldersChecked)
+	assert.Len(t, report.Exceptions, 2)
+	assert.Equal(t, "alice", report.Exceptions[0].Address)
+	assert.Equal(t, []string{"AML_SANCTIONS_EXPIRED"}, report.Exceptions[0].Issues)
+	assert.Equal(t, "bob", report.Exceptions[1].Address)
+	assert.Equal(t, "NONE", report.Exceptions[1].KYCStatus)
+	assert.Equal(t, []string{"KYC_MISSING", "AML_SANCTIONS_MISSING", "AML_PEP_MISSING"}, report.Exceptions[1].Issues)
+	ctx.stub.AssertNotCalled(t, "InvokeChaincode", "bondtoken", [][]byte{[]byte("GetBondHolders"), []byte("BOND_002")}, "")
+}
+
+func TestCompliance_GenerateRegulatoryExtract(t *testing.T) {
+	t.Setenv("CORE_PEER_LOCALMSPID", "RegulatorMSP")
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: regulator}
+
+	q1 := time.Date(2024, 2, 10, 12, 0, 0, 0, time.UTC)
+	q2 := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	alice, _ := json.Marshal(KYCRecord{Address: "alice", Nationality: "GB", Status: "APPROVED", CreatedAt: q1})
+	bob, _ := json.Marshal(KYCRecord{Address: "bob", Nationality: "US", Status: "REJECTED", CreatedAt: q1, UpdatedAt: q1})
+	carol, _ := json.Marshal(KYCRecord{Address: "carol", Nationality: "GB", Status: "APPROVED", CreatedAt: q2})
+	kycIterator := &MockIterator{results: [][]byte{alice, bob, carol}}
+	kycIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "KYC", []string{}).Return(kycIterator, nil)
+
+	filed, _ := json.Marshal(SuspiciousActivityReport{ID: "SAR_tx1", Severity: "HIGH", Status: "CLOSED", FiledAt: q1, ClosedAt: q2})
+	draft, _ := json.Marshal(SuspiciousActivityReport{ID: "SAR_tx2", Severity: "LOW", Status: "DRAFT"})
+	sarIterator := &MockIterator{results: [][]byte{filed, draft}}
+	sarIterator.On("Close").Return(nil)
+	ctx.stub.On("GetPrivateDataByPartialCompositeKey", "sar-private", "SAR", []string{}).Return(sarIterator, nil)
+
+	blocked1, _ := json.Marshal(BlockedTransfer{BondID: "BOND_001", ReasonCodes: []string{"JURISDICTION_BLOCKED", "KYC_NOT_APPROVED"}, Timestamp: q1})
+	blocked2, _ := json.Marshal(BlockedTransfer{BondID: "BOND_002", ReasonCodes: []string{"KYC_NOT_APPROVED"}, Timestamp: q2})
+	blockedIterator := &MockIterator{results: [][]byte{blocked1, blocked2}}
+	blockedIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "BLOCKEDTRANSFER", []string{}).Return(blockedIterator, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: q2.Unix()}, nil)
+
+	_, err := c.GenerateRegulatoryExtract(ctx, "2024-Q5", "FULL")
+	assert.Error(t, err)
+
+	extract, err := c.GenerateRegulatoryExtract(ctx, "2024-Q1", "FULL")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), extract.PeriodEnd)
+	assert.Equal(t, 1, extract.Investors.ApprovedInvestors)
+	assert.Equal(t, map[string]int{"GB": 1}, extract.Investors.ByJurisdiction)
+	assert.Equal(t, 1, extract.Investors.RejectedKYC)
+	assert.Equal(t, 1, extract.SARs.Filed)
+	assert.Equal(t, 0, extract.SARs.Closed)
+	assert.Equal(t, 1, extract.SARs.OpenAtPeriodEnd)
+	assert.Equal(t, 1, extract.BlockedTransfers.Total)
+	assert.Equal(t, map[string]int{"JURISDICTION_BLOCKED": 1, "KYC_NOT_APPROVED": 1}, extract.BlockedTransfers.ByReasonCode)
+}
+
+func TestCompliance_CheckTransfer_OrgPolicy(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "custodian1", mspID: "CustodianMSP"}}
+
+	rules := TransferRules{BondID: "BOND_001", AllowedJurisdictions: []string{"GB", "DE", "US"}, MaxTransferQuantity: 100, InvestorClasses: map[string][]string{"*": {"RETAIL", "PROFESSIONAL"}}}
+	global := OrgPolicy{MSPID: "CustodianMSP", Scope: "GLOBAL", AllowedJurisdictions: []string{"GB", "US"}, MaxTransferQuantity: 500}
+	bond := OrgPolicy{MSPID: "CustodianMSP", Scope: "BOND_001", MaxTransferQuantity: 50, InvestorClasses: map[string][]string{"GB": {"PROFESSIONAL"}}}
+	alice := KYCRecord{Address: "alice", Nationality: "GB", Status: "APPROVED", RiskLevel: "LOW", InvestorClass: "RETAIL"}
+	bob := KYCRecord{Address: "bob", Nationality: "DE", Status: "APPROVED", RiskLevel: "LOW", InvestorClass: "PROFESSIONAL"}
+
+	rulesJSON, _ := json.Marshal(rules)
+	globalJSON, _ := json.Marshal(global)
+	bondJSON, _ := json.Marshal(bond)
+	aliceJSON, _ := json.Marshal(alice)
+	bobJSON, _ := json.Marshal(bob)
+	onTransferRules(ctx.stub, "BOND_001", 1, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("ORGPOLICY", "CustodianMSP", "GLOBAL")).Return(globalJSON, nil)
+	ctx.stub.On("GetState", compositeKey("ORGPOLICY", "CustodianMSP", "BOND_001")).Return(bondJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "bob")).Return(bobJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", mock.Anything, mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "alice", "bob", "BOND_001", 60)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "CustodianMSP", decision.OrgPolicyMSP)
+	assert.Contains(t, decision.RulesEvaluated, "ORG_POLICY")
+
+	var reasonCodes []string
+	for _, reason := range decision.Reasons {
+		reasonCodes = append(reasonCodes, reason.ReasonCode)
+	}
+	assert.Equal(t, []string{"TRANSFER_LIMIT_EXCEEDED", "INVESTOR_CLASS_NOT_ALLOWED", "JURISDICTION_BLOCKED"}, reasonCodes)
+	assert.Equal(t, "alice", decision.Reasons[1].Address)
+	assert.Equal(t, "bob", decision.Reasons[2].Address)
+}
+
+func TestCompliance_VerifyIdentityDocument(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kyc := KYCRecord{Address: "alice", Nationality: "GB", Status: "APPROVED", IdentityDocuments: []*IdentityDocumentStatus{
+		{ID: "PASSPORT-GB", Type: "PASSPORT", IssuingCountry: "GB", ExpiryDate: now.AddDate(0, 0, -1), Status: "VERIFIED"},
+		{ID: "NATIONAL_ID-FR", Type: "NATIONAL_ID", IssuingCountry: "FR", ExpiryDate: now.AddDate(2, 0, 0), Status: "PENDING"},
+	}}
+	kycJSON, _ := json.Marshal(kyc)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil).Once()
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("BLACKLIST", "alice")).Return(nil, nil)
+
+	// The only verified document has expired
+	compliant, reason, err := c.CheckCompliance(ctx, "alice")
+	assert.NoError(t, err)
+	assert.False(t, compliant)
+	assert.Equal(t, "Identity documents expired, new document required", reason)
+
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kycJSON, nil)
+	ctx.stub.On("PutState", compositeKey("KYC", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err = c.VerifyIdentityDocument(ctx, "alice", "PASSPORT-GB", "VERIFIED", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expired on 2024-02-29")
+
+	err = c.VerifyIdentityDocument(ctx, "alice", "NATIONAL_ID-FR", "VERIFIED", "Checked against original")
+	assert.NoError(t, err)
+
+	var updated KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &updated)
+	assert.Equal(t, "VERIFIED", updated.IdentityDocuments[1].Status)
+	assert.Equal(t, "officer1", updated.IdentityDocuments[1].VerifiedBy)
+	assert.False(t, identityDocumentsExpired(&updated, now))
+}
+
+func TestCompliance_RecordConsent(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	terms := strings.Repeat("ab", 32)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("CONSENT", "alice", terms)).Return(nil, nil).Once()
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", compositeKey("CONSENT", "alice", terms), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err := c.RecordConsent(ctx, "alice", terms, "v3", "2024-03-02T09:00:00Z")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "in the future")
+
+	err = c.RecordConsent(ctx, "alice", strings.ToUpper(terms), "v3", "2024-03-01T09:00:00Z")
+	assert.NoError(t, err)
+
+	var consent Consent
+	json.Unmarshal(ctx.stub.state[compositeKey("CONSENT", "alice", terms)], &consent)
+	assert.Equal(t, "v3", consent.Version)
+	assert.Equal(t, "officer1", consent.RecordedBy)
+
+	consentJSON := ctx.stub.state[compositeKey("CONSENT", "alice", terms)]
+	ctx.stub.On("GetState", compositeKey("CONSENT", "alice", terms)).Return(consentJSON, nil)
+	consented, err := c.HasConsented(ctx, "alice", terms)
+	assert.NoError(t, err)
+	assert.True(t, consented)
+}
+
+func TestCompliance_CheckTransfer_Consent(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	terms := strings.Repeat("ab", 32)
+	disclosure := strings.Repeat("cd", 32)
+	rules := TransferRules{BondID: "BOND_001", RequiredConsents: []string{terms, disclosure}}
+	alice := KYCRecord{Address: "alice", Nationality: "GB", Status: "APPROVED", RiskLevel: "LOW"}
+	consent := Consent{Address: "alice", DocumentHash: terms, Version: "v3"}
+
+	rulesJSON, _ := json.Marshal(rules)
+	aliceJSON, _ := json.Marshal(alice)
+	consentJSON, _ := json.Marshal(consent)
+	onTransferRules(ctx.stub, "BOND_001", 1, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("CONSENT", "alice", terms)).Return(consentJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", mock.Anything, mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Contains(t, decision.RulesEvaluated, "CONSENT")
+	assert.Len(t, decision.Reasons, 1)
+	assert.Equal(t, "CONSENT_MISSING", decision.Reasons[0].ReasonCode)
+	assert.Contains(t, decision.Reasons[0].Reason, disclosure)
+}
+
+func TestCompliance_RecordAccreditation(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return([]byte(`{"address":"alice"}`), nil)
+	ctx.stub.On("GetState", compositeKey("ACCREDITATION", "alice")).Return(nil, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", compositeKey("ACCREDITATION", "alice"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "KYCEvent", mock.Anything).Return(nil)
+
+	err := c.RecordAccreditation(ctx, "alice", "NET_WORTH", "Smith CPA", "2024-02-20", "2024-02-28")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "in the future")
+
+	err = c.RecordAccreditation(ctx, "alice", "NET_WORTH", "Smith CPA", "2024-02-20", "2025-02-20")
+	assert.NoError(t, err)
+
+	var accreditation Accreditation
+	json.Unmarshal(ctx.stub.state[compositeKey("ACCREDITATION", "alice")], &accreditation)
+	assert.Equal(t, "Smith CPA", accreditation.Verifier)
+	assert.Equal(t, "officer1", accreditation.RecordedBy)
+	assert.Equal(t, time.Date(2025, 2, 20, 0, 0, 0, 0, time.UTC), accreditation.ExpiryDate)
+}
+
+func TestCompliance_GetAccreditationRenewals(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice, _ := json.Marshal(Accreditation{Address: "alice", ExpiryDate: now.AddDate(0, 0, 20)})
+	bob, _ := json.Marshal(Accreditation{Address: "bob", ExpiryDate: now.AddDate(0, 0, -5)})
+	carol, _ := json.Marshal(Accreditation{Address: "carol", ExpiryDate: now.AddDate(1, 0, 0)})
+	iterator := &MockIterator{results: [][]byte{alice, bob, carol}}
+	iterator.On("Close").Return(nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "ACCREDITATION", []string{}).Return(iterator, nil)
+
+	renewals, err := c.GetAccreditationRenewals(ctx, 30)
+	assert.NoError(t, err)
+	assert.Len(t, renewals, 2)
+	assert.Equal(t, "bob", renewals[0].Address)
+	assert.Equal(t, "alice", renewals[1].Address)
+}
+
+func TestCompliance_CheckTransfer_Accreditation(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	rules := TransferRules{BondID: "BOND_001", RequiresAccreditation: true}
+	alice := KYCRecord{Address: "alice", Nationality: "US", Status: "APPROVED", RiskLevel: "LOW"}
+	accreditation := Accreditation{Address: "alice", Basis: "INCOME", ExpiryDate: now.AddDate(0, 0, -1)}
+
+	rulesJSON, _ := json.Marshal(rules)
+	aliceJSON, _ := json.Marshal(alice)
+	accreditationJSON, _ := json.Marshal(accreditation)
+	onTransferRules(ctx.stub, "BOND_001", 1, rulesJSON)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(aliceJSON, nil)
+	ctx.stub.On("GetState", compositeKey("ACCREDITATION", "alice")).Return(accreditationJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", mock.Anything, mock.Anything).Return(nil)
+
+	decision, err := c.CheckTransfer(ctx, "", "alice", "BOND_001", 10)
+	assert.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Contains(t, decision.RulesEvaluated, "ACCREDITATION")
+	assert.Len(t, decision.Reasons, 1)
+	assert.Equal(t, "ACCREDITATION_EXPIRED", decision.Reasons[0].ReasonCode)
+}
+
+func TestCompliance_GetMyComplianceStatus(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "alice-cert", mspID: "InvestorMSP", attributes: map[string]string{"address": "alice"}}}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kyc, _ := json.Marshal(KYCRecord{Address: "alice", Nationality: "GB", Status: "APPROVED", RiskLevel: "HIGH"})
+	sanctions, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "SANCTIONS", Status: "FAILED", ExpiryDate: now.AddDate(1, 0, 0)})
+	pep, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "PEP", Status: "PASSED", ExpiryDate: now.AddDate(0, 0, -1)})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kyc, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "SANCTIONS")).Return(sanctions, nil)
+	ctx.stub.On("GetState", compositeKey("AML", "alice", "PEP")).Return(pep, nil)
+	ctx.stub.On("GetState", compositeKey("BLACKLIST", "alice")).Return(nil, nil)
+
+	summary, err := c.GetMyComplianceStatus(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", summary.Address)
+	assert.False(t, summary.Compliant)
+	assert.Equal(t, "UNDER_REVIEW", summary.Checks[0].Status)
+	assert.Equal(t, "EXPIRED", summary.Checks[1].Status)
+	assert.Equal(t, []string{"AML_PEP_EXPIRED"}, summary.ActionsRequired)
+
+	// Neither the failed check nor the risk level reaches the investor
+	summaryJSON, _ := json.Marshal(summary)
+	assert.NotContains(t, string(summaryJSON), "FAILED")
+	assert.NotContains(t, string(summaryJSON), "HIGH")
+}
+
+func TestCompliance_UpdateKYCDetails(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceOfficer}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	kyc, _ := json.Marshal(KYCRecord{Address: "alice", Nationality: "GB", Status: "APPROVED", RiskLevel: "LOW", RecordType: "INDIVIDUAL", Version: 4})
+	pii, _ := json.Marshal(KYCPersonalData{Address: "alice", FullName: "Alice Johnson", DateOfBirth: "1990-01-01", ResidentialAddress: "1 High Street, London"})
+	sanctions, _ := json.Marshal(AMLCheck{Address: "alice", CheckType: "SANCTIONS", Status: "PASSED", ExpiryDate: now.AddDate(0, 6, 0)})
+	amlIterator := &MockIterator{results: [][]byte{sanctions}}
+	amlIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "AML", []string{"alice"}).Return(amlIterator, nil).Once()
+	onRiskScoreInputs(ctx.stub, "alice")
+	ctx.stub.On("GetState", compositeKey("KYC", "alice")).Return(kyc, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("GetTransient").Return(map[string][]byte{"kyc": []byte(`{"fullName":"Alice Smith","residentialAddress":"1 High Street, London"}`)}, nil)
+	ctx.stub.On("GetPrivateData", "kyc-private", "alice").Return(pii, nil)
+	ctx.stub.On("PutPrivateData", "kyc-private", "alice", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: now.Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "KYCDetailsUpdated", mock.Anything).Return(nil)
+
+	err := c.UpdateKYCDetails(ctx, "alice", "FR", "Married and moved to France", true, 3)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "version conflict")
+
+	err = c.UpdateKYCDetails(ctx, "alice", "FR", "Married and moved to France", true, 4)
+	assert.NoError(t, err)
+
+	var updated KYCRecord
+	json.Unmarshal(ctx.stub.state[compositeKey("KYC", "alice")], &updated)
+	assert.Equal(t, "PENDING", updated.Status)
+	assert.Equal(t, "FR", updated.Nationality)
+	assert.Len(t, updated.ChangeLog, 2)
+	assert.Equal(t, "nationality", updated.ChangeLog[0].Field)
+	assert.Equal(t, "GB", updated.ChangeLog[0].OldValue)
+	assert.Equal(t, "fullName", updated.ChangeLog[1].Field)
+	assert.Empty(t, updated.ChangeLog[1].NewValue)
+	assert.NotContains(t, string(ctx.stub.state[compositeKey("KYC", "alice")]), "Alice Smith")
+
+	var expired AMLCheck
+	json.Unmarshal(ctx.stub.state[compositeKey("AML", "alice", "SANCTIONS")], &expired)
+	assert.True(t, expired.expired(now))
+}
+
+func TestCompliance_MigrateStateKeys(t *testing.T) {
+	c := &Compliance{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: complianceAdmin}
+
+	alice, _ := json.Marshal(KYCRecord{Address: "alice", Status: "APPROVED"})
+	bob, _ := json.Marshal(KYCRecord{Address: "bob", Status: "APPROVED"})
+	iterator := &MockIterator{results: [][]byte{alice, bob}, keys: []string{"alice", "bob"}}
+	iterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByRange", "", "").Return(iterator, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+
+	result, err := c.MigrateStateKeys(ctx, 1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.KYC)
+	assert.Equal(t, "bob", result.Bookmark)
+	assert.Contains(t, ctx.stub.state, compositeKey("KYC", "alice"))
+	ctx.stub.AssertNotCalled(t, "DelState", "bob")
+}
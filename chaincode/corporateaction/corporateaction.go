@@ -3,12 +3,100 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+// Names the other bond contracts are deployed under
+const (
+	bondTokenChaincode  = "bondtoken"
+	complianceChaincode = "compliance"
+	rateOracleChaincode = "rateoracle"
+	cashTokenChaincode  = "cashtoken"
+)
+
+// State object types. Coupon payments, redemptions and amortization
+// payments are stored under TYPE~bondID~date~id composite keys. The TYPEID
+// index maps an ID to that key and the TYPESTATUS index, keyed
+// status~date~id, lists them by status in date order.
+const (
+	couponObjectType        = "COUPON"
+	couponStatusIndex       = couponObjectType + "STATUS"
+	redemptionObjectType    = "REDEMPTION"
+	redemptionStatusIndex   = redemptionObjectType + "STATUS"
+	amortizationObjectType  = "AMORTIZATION"
+	amortizationStatusIndex = amortizationObjectType + "STATUS"
+)
+
+// Largest relative difference allowed between a coupon amount and the amount
+// computed from the bond terms
+const couponAmountTolerance = 0.001
+
+// Tax vouchers are stored under TAXVOUCHER~holder~year~couponID keys
+const taxVoucherObjectType = "TAXVOUCHER"
+
+// Agency fee accruals are stored under AGENCYFEE~bondID~date~actionID keys
+const agencyFeeObjectType = "AGENCYFEE"
+
+// Holiday calendars are stored under HOLIDAYCALENDAR~name keys
+const holidayCalendarObjectType = "HOLIDAYCALENDAR"
+
+// Emitted corporate action events are stored under EVENT~bondID~sequence
+// keys, with the sequence zero-padded so keys sort in emission order. The
+// EVENTSEQ~bondID key holds the last sequence number used for the bond.
+const (
+	eventObjectType   = "EVENT"
+	eventSequenceType = eventObjectType + "SEQ"
+)
+
+// A transaction cannot read back its own writes, so the sequence numbers it
+// has assigned are kept in txEventSequences, keyed by TxID and then bond ID,
+// while it executes. Entries are dropped once older than eventSequenceTTL,
+// well past the peer's chaincode execution timeout.
+var (
+	txEventSequencesMu sync.Mutex
+	txEventSequences   = make(map[string]*eventSequences)
+)
+
+const eventSequenceTTL = 10 * time.Minute
+
+// eventSequences is the last event sequence number a transaction assigned
+// to each bond
+type eventSequences struct {
+	started time.Time
+	last    map[string]int64
+}
+
+// Per-holder coupon payments are stored under HOLDERPAYMENT~couponID~holder
+// keys, with indexes by holder (holder~couponID) and by payment ID
+const (
+	holderPaymentObjectType  = "HOLDERPAYMENT"
+	holderPaymentHolderIndex = holderPaymentObjectType + "HOLDER"
+	holderPaymentIDIndex     = holderPaymentObjectType + "ID"
+)
+
+// Client identity role attributes: the trustee declares credit events, the
+// paying agent processes payments, the calculation agent fixes floating
+// rates, the registrar acts for holders, the paying bank confirms cash
+// settlement of holder payments, the issuer's tax team reads holders' tax
+// vouchers and the tax administrator sets withholding rates
+const (
+	trusteeRole          = "TRUSTEE"
+	payingAgentRole      = "PAYING_AGENT"
+	calculationAgentRole = "CALCULATION_AGENT"
+	registrarRole        = "REGISTRAR"
+	payingBankRole       = "PAYING_BANK"
+	taxTeamRole          = "TAX_TEAM"
+	taxAdminRole         = "TAX_ADMIN"
+)
+
 // CorporateAction represents the corporate action contract
 type CorporateAction struct {
 	contractapi.Contract
@@ -20,10 +108,47 @@ type CouponPayment struct {
 	BondID      string    `json:"bondId"`
 	PaymentDate time.Time `json:"paymentDate"`
 	Amount      float64   `json:"amount"`
-	Status      string    `json:"status"` // "PENDING", "PAID", "FAILED"
+	Status      string    `json:"status"` // "PENDING", "PAID", "FAILED", "SUSPENDED", "CANCELLED", "REVERSED"
 	PaidAt      time.Time `json:"paidAt"`
 	TxID        string    `json:"txId"`
 	Metadata    map[string]string `json:"metadata"`
+	Settlement  *SettlementFX `json:"settlement,omitempty"`
+	Version     int64     `json:"version"` // incremented on every write
+
+	// Accrual period, set on scheduled coupons
+	PeriodStart   time.Time `json:"periodStart,omitempty"`
+	PeriodEnd     time.Time `json:"periodEnd,omitempty"`
+	DayCount      string    `json:"dayCount,omitempty"`
+	AccrualFactor float64   `json:"accrualFactor,omitempty"` // year fraction of the period
+	CouponRate    float64   `json:"couponRate,omitempty"`    // annual rate in percent the amount was computed at
+
+	Entitlement EntitlementInfo `json:"entitlement"`
+
+	// Cash-leg failures and retries, oldest first
+	FailureReason string           `json:"failureReason,omitempty"`
+	Attempts      []PaymentAttempt `json:"attempts,omitempty"`
+
+	// Penalty interest on a coupon left unpaid past its grace period,
+	// accrued up to PenaltyAccruedTo
+	PenaltyInterest  float64   `json:"penaltyInterest,omitempty"`
+	PenaltyAccruedTo time.Time `json:"penaltyAccruedTo,omitempty"`
+
+	// Client identity that processed the payment, and the MSP of the
+	// client that last wrote the record
+	ProcessedBy  string `json:"processedBy,omitempty"`
+	UpdatedByMSP string `json:"updatedByMsp,omitempty"`
+
+	// Object type, so QueryActions selectors can tell records apart
+	DocType string `json:"docType"`
+}
+
+// PaymentAttempt is one entry in a coupon payment's attempt history
+type PaymentAttempt struct {
+	Attempt    int       `json:"attempt"`
+	Outcome    string    `json:"outcome"` // "FAILED", "RETRIED", "PAID"
+	ReasonCode string    `json:"reasonCode,omitempty"`
+	At         time.Time `json:"at"`
+	TxID       string    `json:"txId"`
 }
 
 // Redemption represents a bond redemption
@@ -31,11 +156,772 @@ type Redemption struct {
 	ID          string    `json:"id"`
 	BondID      string    `json:"bondId"`
 	RedemptionDate time.Time `json:"redemptionDate"`
+	Type        string    `json:"type,omitempty"` // "CALL", "PUT"; empty for ordinary redemptions
 	Amount      float64   `json:"amount"`
-	Status      string    `json:"status"` // "PENDING", "COMPLETED", "FAILED"
+	Status      string    `json:"status"` // "PENDING", "PARTIALLY_REDEEMED", "COMPLETED", "FAILED", "CANCELLED"
 	CompletedAt time.Time `json:"completedAt"`
 	TxID        string    `json:"txId"`
 	Metadata    map[string]string `json:"metadata"`
+	Settlement  *SettlementFX `json:"settlement,omitempty"`
+	Version     int64     `json:"version"` // incremented on every write
+
+	Entitlement EntitlementInfo `json:"entitlement"`
+
+	// Principal repaid in instalments, the last one on RedemptionDate.
+	// OutstandingAmount is the part of Amount not yet paid.
+	Instalments       []RedemptionInstalment `json:"instalments,omitempty"`
+	OutstandingAmount float64                `json:"outstandingAmount,omitempty"`
+
+	// Client identity that processed the payment, and the MSP of the
+	// client that last wrote the record
+	ProcessedBy  string `json:"processedBy,omitempty"`
+	UpdatedByMSP string `json:"updatedByMsp,omitempty"`
+
+	// Object type, so QueryActions selectors can tell records apart
+	DocType string `json:"docType"`
+}
+
+// RedemptionInstalment is one tranche of a redemption paid in instalments
+type RedemptionInstalment struct {
+	Number      int       `json:"number"` // from 1, paid in order
+	DueDate     time.Time `json:"dueDate"`
+	Amount      float64   `json:"amount"`
+	Status      string    `json:"status"` // "PENDING", "PAID"
+	PaidAt      time.Time `json:"paidAt,omitempty"`
+	TxID        string    `json:"txId,omitempty"`
+	ProcessedBy string    `json:"processedBy,omitempty"`
+}
+
+// AmortizationPayment is a scheduled repayment of part of a bond's principal.
+// It is paid together with the coupon falling on the same date, if any.
+type AmortizationPayment struct {
+	ID             string    `json:"id"`
+	BondID         string    `json:"bondId"`
+	PaymentDate    time.Time `json:"paymentDate"`
+	AmountPerToken float64   `json:"amountPerToken"`     // principal repaid per token
+	Amount         float64   `json:"amount"`             // principal repaid on the whole issue
+	CouponID       string    `json:"couponId,omitempty"` // coupon paid alongside
+	Status         string    `json:"status"`             // "PENDING", "PAID", "CANCELLED"
+	PaidAt         time.Time `json:"paidAt"`
+	TxID           string    `json:"txId"`
+	Version        int64     `json:"version"` // incremented on every write
+	ProcessedBy    string    `json:"processedBy,omitempty"`
+	UpdatedByMSP   string    `json:"updatedByMsp,omitempty"`
+	DocType        string    `json:"docType"`
+}
+
+// ActionHistoryEntry is one status change of a coupon payment, redemption or
+// amortization payment
+type ActionHistoryEntry struct {
+	ActionID       string    `json:"actionId"`
+	Status         string    `json:"status"` // "DELETED" when the record was removed
+	PreviousStatus string    `json:"previousStatus,omitempty"`
+	Version        int64     `json:"version"`
+	TxID           string    `json:"txId"`
+	InvokerMSP     string    `json:"invokerMsp,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// CouponReversal is the compensating record that unwinds a paid coupon
+// payment. A maker requests it and a different identity must approve it.
+type CouponReversal struct {
+	ID          string    `json:"id"`
+	CouponID    string    `json:"couponId"`
+	BondID      string    `json:"bondId"`
+	Amount      float64   `json:"amount"` // negative of the reversed payment
+	Reason      string    `json:"reason"`
+	Status      string    `json:"status"` // "PENDING_APPROVAL", "COMPLETED"
+	RequestedBy string    `json:"requestedBy"`
+	RequestedAt time.Time `json:"requestedAt"`
+	ApprovedBy  string    `json:"approvedBy,omitempty"`
+	ApprovedAt  time.Time `json:"approvedAt,omitempty"`
+	TxID        string    `json:"txId"`
+}
+
+// EntitlementInfo holds the record and ex dates of a coupon payment or
+// redemption and the outcome of its entitlement snapshot
+type EntitlementInfo struct {
+	RecordDate     time.Time `json:"recordDate,omitempty"` // holders at close of this day are entitled
+	ExDate         time.Time `json:"exDate,omitempty"`     // trades from this day settle without the entitlement
+	SnapshotTxID   string    `json:"snapshotTxId,omitempty"`
+	HolderCount    int       `json:"holderCount,omitempty"`
+	EntitledAmount float64   `json:"entitledAmount,omitempty"`
+
+	// Transaction in which BondToken snapshotted the holder register the
+	// entitlements were taken from
+	HolderSnapshotTxID string `json:"holderSnapshotTxId,omitempty"`
+
+	// Set when an elective announcement is linked to the action, which
+	// cannot be processed until the elections are closed
+	ElectionID        string    `json:"electionId,omitempty"` // announcement ID
+	ElectionDeadline  time.Time `json:"electionDeadline,omitempty"`
+	ElectionsClosedAt time.Time `json:"electionsClosedAt,omitempty"`
+}
+
+// Entitlement is one holder's share of a coupon payment or redemption,
+// fixed by the holdings at the record date
+type Entitlement struct {
+	ActionID   string    `json:"actionId"`
+	BondID     string    `json:"bondId"`
+	Address    string    `json:"address"`
+	Quantity   int64     `json:"quantity"`
+	Amount     float64   `json:"amount"` // gross
+	RecordDate time.Time `json:"recordDate"`
+	TxID       string    `json:"txId"`
+
+	// Token-equivalent quantity that accrued over the coupon period, set
+	// when part of the holding came from a tap settled mid-period
+	AccrualQuantity float64 `json:"accrualQuantity,omitempty"`
+
+	// Set when the holder claims the entitlement on a claim-basis bond
+	ClaimedAt time.Time `json:"claimedAt,omitempty"`
+	ClaimTxID string    `json:"claimTxId,omitempty"`
+
+	// Withholding tax, assessed on coupon entitlements only
+	TaxJurisdiction   string  `json:"taxJurisdiction,omitempty"`
+	TaxClassification string  `json:"taxClassification,omitempty"`
+	WithholdingRate   float64 `json:"withholdingRate"` // percent
+	WithholdingTax    float64 `json:"withholdingTax"`
+	NetAmount         float64 `json:"netAmount"`
+
+	// Option the holder elected on an elective announcement, or its default
+	// option when they did not respond by the deadline. Only cash options
+	// are paid, in OptionCurrency when the option has one.
+	Option         string    `json:"option,omitempty"`     // 13A::CAON
+	OptionCode     string    `json:"optionCode,omitempty"` // 22F::CAOP
+	OptionCurrency string    `json:"optionCurrency,omitempty"`
+	ElectedAt      time.Time `json:"electedAt,omitempty"`
+	ElectionTxID   string    `json:"electionTxId,omitempty"`
+	DefaultApplied bool      `json:"defaultApplied,omitempty"`
+}
+
+// AccrualPosting is a bond's interest accrual for one day of a coupon
+// period, for booking income daily
+type AccrualPosting struct {
+	BondID        string           `json:"bondId"`
+	Date          time.Time        `json:"date"`
+	CouponID      string           `json:"couponId"`
+	PeriodStart   time.Time        `json:"periodStart"`
+	PeriodEnd     time.Time        `json:"periodEnd"`
+	DayCount      string           `json:"dayCount"`
+	CouponAmount  float64          `json:"couponAmount"`
+	AccruedAmount float64          `json:"accruedAmount"` // from the period start to the end of Date
+	DailyAmount   float64          `json:"dailyAmount"`   // accrued on Date
+	Holders       []*HolderAccrual `json:"holders,omitempty"`
+	TxID          string           `json:"txId"`
+}
+
+// HolderAccrual is one holder's share of an accrual posting
+type HolderAccrual struct {
+	Address       string  `json:"address"`
+	Quantity      int64   `json:"quantity"`
+	AccruedAmount float64 `json:"accruedAmount"`
+	DailyAmount   float64 `json:"dailyAmount"`
+}
+
+// HolderPayment is one holder's part of a processed coupon payment, created
+// from their entitlement when the coupon is distributed
+type HolderPayment struct {
+	ID             string    `json:"id"`
+	CouponID       string    `json:"couponId"`
+	BondID         string    `json:"bondId"`
+	Holder         string    `json:"holder"`
+	PaymentDate    time.Time `json:"paymentDate"`
+	GrossAmount    float64   `json:"grossAmount"`
+	WithholdingTax float64   `json:"withholdingTax"`
+	NetAmount      float64   `json:"netAmount"`
+	Currency       string    `json:"currency"`      // settlement currency
+	CashAmount     float64   `json:"cashAmount"`    // net amount in Currency
+	Status         string    `json:"status"`        // "INSTRUCTED", "SETTLED"
+	CashReference  string    `json:"cashReference"` // EndToEndId of the payment instruction
+	CreatedAt      time.Time `json:"createdAt"`
+	TxID           string    `json:"txId"`
+
+	// Cash-leg confirmation from the paying bank. AmountMismatch is set when
+	// the settled amount differs from CashAmount and needs reconciling.
+	BankReference  string    `json:"bankReference,omitempty"`
+	SettledAmount  float64   `json:"settledAmount,omitempty"`
+	ValueDate      time.Time `json:"valueDate,omitempty"`
+	SettledAt      time.Time `json:"settledAt,omitempty"`
+	AmountMismatch bool      `json:"amountMismatch,omitempty"`
+
+	// Set when the payment is made as part of a net payment to the holder
+	// rather than on its own
+	NetPaymentID string `json:"netPaymentId,omitempty"`
+}
+
+// NetPayment is a single payment to a holder of their instructed holder
+// payments on several bonds due on the same day in the same currency
+type NetPayment struct {
+	ID         string                 `json:"id"` // NET_holder_date_currency
+	Holder     string                 `json:"holder"`
+	Currency   string                 `json:"currency"`
+	ValueDate  time.Time              `json:"valueDate"`
+	Amount     float64                `json:"amount"`
+	Components []*NetPaymentComponent `json:"components"`
+	Status     string                 `json:"status"` // "INSTRUCTED"
+	CreatedAt  time.Time              `json:"createdAt"`
+	TxID       string                 `json:"txId"`
+}
+
+// NetPaymentComponent is one holder payment netted into a net payment. The
+// holder's entitlement to CouponID is the one the payment was created from.
+type NetPaymentComponent struct {
+	PaymentID     string  `json:"paymentId"`
+	CouponID      string  `json:"couponId"`
+	BondID        string  `json:"bondId"`
+	CashReference string  `json:"cashReference"`
+	Amount        float64 `json:"amount"`
+}
+
+// TaxVoucher is a holder's tax certificate for one coupon payment, stating
+// the gross coupon and the tax withheld from it
+type TaxVoucher struct {
+	ID                string    `json:"id"` // couponID_holder
+	Holder            string    `json:"holder"`
+	BondID            string    `json:"bondId"`
+	ISIN              string    `json:"isin"`
+	CouponID          string    `json:"couponId"`
+	PaymentDate       time.Time `json:"paymentDate"`
+	Year              int       `json:"year"` // tax year of the payment date
+	Currency          string    `json:"currency"`
+	GrossAmount       float64   `json:"grossAmount"`
+	WithholdingRate   float64   `json:"withholdingRate"` // percent
+	TaxAmount         float64   `json:"taxAmount"`
+	NetAmount         float64   `json:"netAmount"`
+	TaxJurisdiction   string    `json:"taxJurisdiction"`
+	TaxClassification string    `json:"taxClassification,omitempty"`
+	PaymentReference  string    `json:"paymentReference"` // EndToEndId of the holder's payment
+	IssuedAt          time.Time `json:"issuedAt"`
+	TxID              string    `json:"txId"`
+}
+
+// TokenBurn is a quantity of tokens the BondToken contract burns from one
+// holding
+type TokenBurn struct {
+	Address  string `json:"address"`
+	Quantity int64  `json:"quantity"`
+}
+
+// PaymentAccount is the cash-token account the issuer pre-funds a bond's
+// coupon payments into
+type PaymentAccount struct {
+	BondID    string    `json:"bondId"`
+	Account   string    `json:"account"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	TxID      string    `json:"txId"`
+}
+
+// AgencyFeeRate is the paying agent's fee for processing one action: a flat
+// amount plus basis points of the amount paid
+type AgencyFeeRate struct {
+	Flat        float64 `json:"flat"`
+	BasisPoints float64 `json:"basisPoints"`
+}
+
+// AgencyFeeSchedule is the fee a bond's paying agent charges for each type
+// of action it processes
+type AgencyFeeSchedule struct {
+	BondID    string                   `json:"bondId"`
+	Currency  string                   `json:"currency"`
+	Fees      map[string]AgencyFeeRate `json:"fees"` // by action type: "COUPON", "REDEMPTION", "AMORTIZATION"
+	UpdatedAt time.Time                `json:"updatedAt"`
+	TxID      string                   `json:"txId"`
+}
+
+// AgencyFeeAccrual is the fee accrued to the paying agent for one processed
+// action
+type AgencyFeeAccrual struct {
+	BondID       string    `json:"bondId"`
+	ActionType   string    `json:"actionType"` // "COUPON", "REDEMPTION", "AMORTIZATION"
+	ActionID     string    `json:"actionId"`
+	ActionAmount float64   `json:"actionAmount"`
+	Currency     string    `json:"currency"`
+	FlatFee      float64   `json:"flatFee"`
+	AdValoremFee float64   `json:"adValoremFee"`
+	Amount       float64   `json:"amount"`
+	Agent        string    `json:"agent"`
+	AccruedAt    time.Time `json:"accruedAt"`
+	TxID         string    `json:"txId"`
+}
+
+// AgencyFeeStatement totals the agency fees accrued on a bond for a period
+type AgencyFeeStatement struct {
+	BondID   string              `json:"bondId"`
+	Period   string              `json:"period"`
+	From     time.Time           `json:"from"`
+	To       time.Time           `json:"to"`
+	Currency string              `json:"currency"`
+	Accruals []*AgencyFeeAccrual `json:"accruals"`
+	Total    float64             `json:"total"`
+}
+
+// HolidayCalendar is a named set of dates, e.g. USNY, GBLO or INMU, on which
+// payments are not made
+type HolidayCalendar struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Holidays    []string  `json:"holidays"` // YYYY-MM-DD, sorted
+	Version     int64     `json:"version"`  // incremented on every write
+	UpdatedAt   time.Time `json:"updatedAt"`
+	TxID        string    `json:"txId"`
+}
+
+// GracePeriod is how long a bond's coupon may stay unpaid past its payment
+// date before penalty interest starts to accrue on it
+type GracePeriod struct {
+	BondID      string    `json:"bondId"`
+	Days        int       `json:"days"`
+	PenaltyRate float64   `json:"penaltyRate"` // annual rate in percent, ACT/365
+	UpdatedAt   time.Time `json:"updatedAt"`
+	TxID        string    `json:"txId"`
+}
+
+// OverdueAction is a coupon payment or redemption still unpaid after its due
+// date
+type OverdueAction struct {
+	Type            string    `json:"type"` // "COUPON", "REDEMPTION"
+	ID              string    `json:"id"`
+	BondID          string    `json:"bondId"`
+	Status          string    `json:"status"`
+	DueDate         time.Time `json:"dueDate"`
+	Amount          float64   `json:"amount"`
+	DaysOverdue     int       `json:"daysOverdue"`
+	GraceEnd        time.Time `json:"graceEnd"`
+	InGrace         bool      `json:"inGrace"`
+	PenaltyInterest float64   `json:"penaltyInterest,omitempty"`
+}
+
+// WithholdingRate is the percentage of a coupon withheld for holders of a
+// tax jurisdiction and classification. "DEFAULT" in either field matches
+// anything without a more specific rate.
+type WithholdingRate struct {
+	Jurisdiction   string    `json:"jurisdiction"`
+	Classification string    `json:"classification"`
+	Rate           float64   `json:"rate"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	TxID           string    `json:"txId"`
+}
+
+// TaxProfile is the Compliance contract's withholding-tax view of an investor
+type TaxProfile struct {
+	Jurisdiction   string `json:"jurisdiction"`
+	Classification string `json:"classification"`
+}
+
+// TaxReportLine totals withholding for one jurisdiction and classification
+type TaxReportLine struct {
+	Jurisdiction   string  `json:"jurisdiction"`
+	Classification string  `json:"classification"`
+	Holders        int     `json:"holders"`
+	GrossAmount    float64 `json:"grossAmount"`
+	WithholdingTax float64 `json:"withholdingTax"`
+	NetAmount      float64 `json:"netAmount"`
+}
+
+// TaxReport summarises coupon withholding on a bond for a period
+type TaxReport struct {
+	BondID         string           `json:"bondId"`
+	Period         string           `json:"period"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	Lines          []*TaxReportLine `json:"lines"`
+	GrossAmount    float64          `json:"grossAmount"`
+	WithholdingTax float64          `json:"withholdingTax"`
+	NetAmount      float64          `json:"netAmount"`
+	Entitlements   []*Entitlement   `json:"entitlements"`
+}
+
+// HolderSnapshot is the BondToken contract's holder register snapshot taken
+// at the close of a record date
+type HolderSnapshot struct {
+	BondID     string        `json:"bondId"`
+	RecordDate time.Time     `json:"recordDate"`
+	Holders    []*HolderInfo `json:"holders"`
+	TxID       string        `json:"txId"`
+}
+
+// HolderInfo is the subset of the BondToken holder record used for entitlements
+type HolderInfo struct {
+	Address  string   `json:"address"`
+	BondID   string   `json:"bondId"`
+	Quantity int64    `json:"quantity"`
+	TapLots  []TapLot `json:"tapLots,omitempty"`
+}
+
+// TapLot is the part of a holding that came from a tap and accrues only
+// from the tranche's settlement date
+type TapLot struct {
+	Tranche      int       `json:"tranche"`
+	Quantity     int64     `json:"quantity"`
+	AccrualStart time.Time `json:"accrualStart"`
+}
+
+// FXRate is a reference exchange rate: 1 unit of Base = Rate units of Quote
+type FXRate struct {
+	Base     string    `json:"base"`
+	Quote    string    `json:"quote"`
+	Rate     float64   `json:"rate"`
+	Source   string    `json:"source"`
+	AsOfDate time.Time `json:"asOfDate"`
+	TxID     string    `json:"txId"`
+}
+
+// SettlementFX records the currency a payment is settled in and the FX
+// reference used to convert it from the denomination currency
+type SettlementFX struct {
+	Currency         string    `json:"currency"`
+	Rate             float64   `json:"rate"`
+	RateSource       string    `json:"rateSource"`
+	RateDate         time.Time `json:"rateDate"`
+	RateTxID         string    `json:"rateTxId"`
+	SettlementAmount float64   `json:"settlementAmount"`
+}
+
+// BondInfo is the subset of the BondToken bond record used by corporate actions
+type BondInfo struct {
+	ID           string    `json:"id"`
+	IssuerID     string    `json:"issuerId"`
+	ISIN         string    `json:"isin"`
+	FaceValue    float64   `json:"faceValue"`
+	CouponRate   float64   `json:"couponRate"`
+	MaturityDate time.Time `json:"maturityDate"`
+	IssueDate    time.Time `json:"issueDate"`
+	TotalSupply  int64     `json:"totalSupply"`
+	Status       string    `json:"status"`
+	Currency     string    `json:"currency"`
+	BondType     string    `json:"bondType"` // "FIXED", "ZERO_COUPON", "FRN"
+
+	SettlementCurrencies []string `json:"settlementCurrencies"`
+
+	OutstandingFaceValue float64             `json:"outstandingFaceValue"`
+	Amortization         []AmortizationEntry `json:"amortization"`
+
+	Terms CouponTerms `json:"terms"`
+}
+
+// AmortizationEntry is one step of a bond's principal repayment schedule,
+// with Amount repaid per token
+type AmortizationEntry struct {
+	Date    time.Time `json:"date"`
+	Amount  float64   `json:"amount"`
+	Applied bool      `json:"applied"`
+}
+
+// CouponTerms is the subset of the BondToken bond terms that governs coupons
+type CouponTerms struct {
+	CouponFrequency       int    `json:"couponFrequency"`
+	DayCount              string `json:"dayCount"`
+	BusinessDayConvention string `json:"businessDayConvention"`
+
+	// Names of the holiday calendars whose holidays, besides weekends, are
+	// not business days for the bond's payments
+	HolidayCalendars []string `json:"holidayCalendars"`
+
+	// Floating-rate notes
+	Spread         float64 `json:"spread"` // basis points over the benchmark
+	BenchmarkIndex string  `json:"benchmarkIndex"`
+	ResetFrequency int     `json:"resetFrequency"` // months
+	RateCap        float64 `json:"rateCap"`
+	RateFloor      float64 `json:"rateFloor"`
+
+	// Callable bonds
+	CallSchedule   []CallPeriod `json:"callSchedule"`
+	CallNoticeDays int          `json:"callNoticeDays"`
+
+	// Puttable bonds
+	PutSchedule []PutWindow `json:"putSchedule"`
+
+	// Convertible bonds
+	ConversionRatio float64 `json:"conversionRatio"`
+	ConversionStart string  `json:"conversionStart"`
+	ConversionEnd   string  `json:"conversionEnd"`
+	Underlying      string  `json:"underlying"`
+
+	// Holders claim their entitlements with ClaimEntitlement
+	ClaimBasis bool `json:"claimBasis"`
+}
+
+// Conversion records a holder's conversion of bond tokens into the
+// underlying
+type Conversion struct {
+	ID              string    `json:"id"`
+	BondID          string    `json:"bondId"`
+	Holder          string    `json:"holder"`
+	Quantity        int64     `json:"quantity"` // bond tokens burned
+	ConversionRatio float64   `json:"conversionRatio"`
+	Underlying      string    `json:"underlying"`
+	UnitsDue        int64     `json:"unitsDue"`        // whole units of the underlying to deliver
+	FractionalUnits float64   `json:"fractionalUnits"` // remainder settled outside the ledger
+	Status          string    `json:"status"`          // "CONVERTED"
+	ConvertedAt     time.Time `json:"convertedAt"`
+	TxID            string    `json:"txId"`
+}
+
+// PutWindow is one holder put opportunity: notices are accepted from
+// WindowStart to WindowEnd and tendered tokens are redeemed on PutDate at
+// Price, in percent of outstanding face value
+type PutWindow struct {
+	WindowStart string  `json:"windowStart"`
+	WindowEnd   string  `json:"windowEnd"`
+	PutDate     string  `json:"putDate"`
+	Price       float64 `json:"price"`
+}
+
+// PutNotice is a holder's election to tender tokens for redemption on a
+// put date
+type PutNotice struct {
+	BondID       string    `json:"bondId"`
+	Holder       string    `json:"holder"`
+	Quantity     int64     `json:"quantity"`
+	PutDate      string    `json:"putDate"`
+	Status       string    `json:"status"` // "SUBMITTED", "PROCESSED", "REJECTED"
+	Redeemed     int64     `json:"redeemed"`
+	RedemptionID string    `json:"redemptionId,omitempty"`
+	SubmittedAt  time.Time `json:"submittedAt"`
+	TxID         string    `json:"txId"`
+}
+
+// CallPeriod is one step of a call schedule: from StartDate the bond may be
+// called at Price, in percent of outstanding face value
+type CallPeriod struct {
+	StartDate string  `json:"startDate"`
+	Price     float64 `json:"price"`
+}
+
+// BenchmarkFixing is a benchmark rate published by the rate oracle contract
+type BenchmarkFixing struct {
+	Index string  `json:"index"`
+	Date  string  `json:"date"`
+	Rate  float64 `json:"rate"` // percent
+}
+
+// RateFixing records the all-in coupon rate fixed for one FRN reset period
+type RateFixing struct {
+	BondID         string    `json:"bondId"`
+	Period         string    `json:"period"` // reset date, YYYY-MM-DD
+	BenchmarkIndex string    `json:"benchmarkIndex"`
+	BenchmarkRate  float64   `json:"benchmarkRate"`
+	Spread         float64   `json:"spread"`
+	Rate           float64   `json:"rate"` // benchmark + spread after cap and floor
+	Capped         bool      `json:"capped"`
+	Floored        bool      `json:"floored"`
+	FixedAt        time.Time `json:"fixedAt"`
+	TxID           string    `json:"txId"`
+	CouponsUpdated []string  `json:"couponsUpdated"`
+}
+
+// DefaultDeclaration records a credit event declared by the bond trustee.
+// Once a bond is in default only restructuring actions are accepted.
+type DefaultDeclaration struct {
+	BondID           string    `json:"bondId"`
+	EventType        string    `json:"eventType"` // "FAILURE_TO_PAY", "BANKRUPTCY", "COVENANT_BREACH", "CROSS_DEFAULT", "REPUDIATION"
+	Details          string    `json:"details"`
+	DeclaredBy       string    `json:"declaredBy"`
+	DeclaredAt       time.Time `json:"declaredAt"`
+	SuspendedCoupons int       `json:"suspendedCoupons"`
+	TxID             string    `json:"txId"`
+
+	// Set when a restructuring cures the default
+	RestructuringID string    `json:"restructuringId,omitempty"`
+	ResolvedAt      time.Time `json:"resolvedAt,omitempty"`
+}
+
+// RestructuringTerms are the changes a restructuring makes to a bond. Zero
+// values leave the corresponding term unchanged.
+type RestructuringTerms struct {
+	HaircutPercent float64 `json:"haircutPercent"` // principal written down, in percent of outstanding face
+	CouponRate     float64 `json:"couponRate"`     // new annual coupon rate in percent
+	MaturityDate   string  `json:"maturityDate"`   // extended maturity, YYYY-MM-DD
+}
+
+// PreviousTerms records the bond terms a restructuring replaced
+type PreviousTerms struct {
+	OutstandingFaceValue float64   `json:"outstandingFaceValue"`
+	CouponRate           float64   `json:"couponRate"`
+	MaturityDate         time.Time `json:"maturityDate"`
+}
+
+// Restructuring is a proposal to change a bond's terms. Holders on the
+// record date vote with their holdings, and the terms are applied only if
+// the votes in favour reach Threshold percent of the eligible tokens.
+type Restructuring struct {
+	ID               string             `json:"id"`
+	BondID           string             `json:"bondId"`
+	Terms            RestructuringTerms `json:"terms"`
+	RecordDate       time.Time          `json:"recordDate"`
+	VotingDeadline   time.Time          `json:"votingDeadline"`
+	Threshold        float64            `json:"threshold"`        // percent of eligible tokens
+	EligibleQuantity int64              `json:"eligibleQuantity"` // non-issuer tokens held on the record date
+	VotesFor         int64              `json:"votesFor"`
+	VotesAgainst     int64              `json:"votesAgainst"`
+	Status           string             `json:"status"` // "VOTING", "APPLIED"
+	ProposedBy       string             `json:"proposedBy"`
+	ProposedAt       time.Time          `json:"proposedAt"`
+	PreviousTerms    *PreviousTerms     `json:"previousTerms,omitempty"`
+	CouponsUpdated   []string           `json:"couponsUpdated,omitempty"`
+	AppliedAt        time.Time          `json:"appliedAt,omitempty"`
+	TxID             string             `json:"txId"`
+	Version          int64              `json:"version"` // incremented on every write
+}
+
+// RestructuringVote is one holder's vote on a restructuring
+type RestructuringVote struct {
+	RestructuringID string    `json:"restructuringId"`
+	Holder          string    `json:"holder"`
+	Quantity        int64     `json:"quantity"`
+	InFavor         bool      `json:"inFavor"`
+	CastAt          time.Time `json:"castAt"`
+	TxID            string    `json:"txId"`
+}
+
+// Announcement is a corporate action notification structured after the
+// ISO 15022 MT564, so custodians can map it field by field. Field comments
+// give the MT564 tags.
+type Announcement struct {
+	ID                 string               `json:"id"`                 // 20C::CORP
+	Function           string               `json:"function"`           // 23G: "NEWM", "REPL"
+	Sequence           int                  `json:"sequence"`           // 1 for NEWM, incremented by every REPL
+	EventType          string               `json:"eventType"`          // 22F::CAEV
+	MandatoryVoluntary string               `json:"mandatoryVoluntary"` // 22F::CAMV: "MAND", "CHOS", "VOLU"
+	BondID             string               `json:"bondId"`
+	ISIN               string               `json:"isin"`               // 35B
+	ActionID           string               `json:"actionId,omitempty"` // linked coupon payment, redemption or amortization payment
+	Dates              AnnouncementDates    `json:"dates"`
+	Rate               float64              `json:"rate,omitempty"` // 92A::INTP, percent
+	Currency           string               `json:"currency"`
+	Options            []AnnouncementOption `json:"options"`             // sequence E
+	Narrative          string               `json:"narrative,omitempty"` // 70E::ADTX
+	AnnouncedAt        time.Time            `json:"announcedAt"`
+	TxID               string               `json:"txId"`
+}
+
+// AnnouncementDates are the key dates of an announcement
+type AnnouncementDates struct {
+	Announcement     time.Time `json:"announcement"`               // 98A::ANOU
+	ExDate           time.Time `json:"exDate,omitempty"`           // 98A::XDTE
+	RecordDate       time.Time `json:"recordDate,omitempty"`       // 98A::RDTE
+	PaymentDate      time.Time `json:"paymentDate,omitempty"`      // 98A::PAYD
+	ResponseDeadline time.Time `json:"responseDeadline,omitempty"` // 98A::RDDT
+}
+
+// AnnouncementOption is one option holders may elect
+type AnnouncementOption struct {
+	Number   string  `json:"number"`             // 13A::CAON, e.g. "001"
+	Code     string  `json:"code"`               // 22F::CAOP: "CASH", "SECU", "CASE", "NOAC", "CONY", "CONN"
+	Default  bool    `json:"default"`            // 17B::DFLT
+	Currency string  `json:"currency,omitempty"` // 11A::OPTN
+	Price    float64 `json:"price,omitempty"`    // 90A, percent of face value
+}
+
+// CouponPaymentPage is a page of coupon payments
+type CouponPaymentPage struct {
+	CouponPayments []*CouponPayment `json:"couponPayments"`
+	Count          int32            `json:"count"`
+	Bookmark       string           `json:"bookmark"`
+}
+
+// RedemptionPage is a page of redemptions
+type RedemptionPage struct {
+	Redemptions []*Redemption `json:"redemptions"`
+	Count       int32         `json:"count"`
+	Bookmark    string        `json:"bookmark"`
+}
+
+// DueAction is a pending coupon payment, redemption or amortization payment
+// the paying agent has to fund
+type DueAction struct {
+	Type    string    `json:"type"` // "COUPON", "REDEMPTION", "AMORTIZATION"
+	ID      string    `json:"id"`
+	BondID  string    `json:"bondId"`
+	DueDate time.Time `json:"dueDate"`
+	Amount  float64   `json:"amount"`
+	Overdue bool      `json:"overdue"` // due date has already passed
+}
+
+// DistributionSimulation is the per-holder breakdown a coupon payment or
+// redemption would distribute against the current register.
+// RoundingDifference is the part of Amount left over after rounding each
+// holder's share to the cent.
+type DistributionSimulation struct {
+	ActionID           string         `json:"actionId"`
+	Type               string         `json:"type"` // "COUPON", "REDEMPTION"
+	BondID             string         `json:"bondId"`
+	RecordDate         time.Time      `json:"recordDate"`
+	Amount             float64        `json:"amount"`
+	HolderCount        int            `json:"holderCount"`
+	GrossAmount        float64        `json:"grossAmount"`
+	WithholdingTax     float64        `json:"withholdingTax"`
+	NetAmount          float64        `json:"netAmount"`
+	RoundingDifference float64        `json:"roundingDifference"`
+	Entitlements       []*Entitlement `json:"entitlements"`
+}
+
+// DueActionBatch summarises one ProcessDueActions run
+type DueActionBatch struct {
+	AsOfDate  time.Time           `json:"asOfDate"`
+	Processed []*DueActionOutcome `json:"processed"`
+	Failed    []*DueActionOutcome `json:"failed"`
+	Skipped   []*DueActionOutcome `json:"skipped"`
+	More      bool                `json:"more"` // maxItems was reached with further items due
+}
+
+// DueActionOutcome is the result of processing one due action in a batch
+type DueActionOutcome struct {
+	Type   string `json:"type"` // "AMORTIZATION", "COUPON", "REDEMPTION"
+	ID     string `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PaymentInstruction is an ISO 20022 pain.001 customer credit transfer
+// initiation for a processed coupon payment or redemption. Fields carry the
+// schema's element names so the bank payment gateway can forward it as
+// pain.001 or map it to pacs.008 directly. Parties are identified by their
+// ledger IDs, which the gateway resolves to accounts.
+type PaymentInstruction struct {
+	MessageDefinition string             `json:"MsgDefIdr"` // "pain.001.001.09"
+	GroupHeader       PaymentGroupHeader `json:"GrpHdr"`
+	PaymentInfo       PaymentInfo        `json:"PmtInf"`
+}
+
+// PaymentGroupHeader is the pain.001 group header
+type PaymentGroupHeader struct {
+	MessageID       string       `json:"MsgId"`
+	CreationTime    time.Time    `json:"CreDtTm"`
+	NumberOfTxs     int          `json:"NbOfTxs"`
+	ControlSum      float64      `json:"CtrlSum"`
+	InitiatingParty PaymentParty `json:"InitgPty"`
+}
+
+// PaymentInfo is the pain.001 payment information block: one debtor paying
+// one or more creditors on an execution date
+type PaymentInfo struct {
+	PaymentInfoID   string            `json:"PmtInfId"`
+	PaymentMethod   string            `json:"PmtMtd"`      // "TRF"
+	ExecutionDate   string            `json:"ReqdExctnDt"` // YYYY-MM-DD
+	Debtor          PaymentParty      `json:"Dbtr"`
+	CreditTransfers []*CreditTransfer `json:"CdtTrfTxInf"`
+}
+
+// CreditTransfer is one pain.001 credit transfer transaction
+type CreditTransfer struct {
+	InstructionID string           `json:"InstrId"`
+	EndToEndID    string           `json:"EndToEndId"`
+	Amount        InstructedAmount `json:"InstdAmt"`
+	Creditor      PaymentParty     `json:"Cdtr"`
+	Remittance    string           `json:"RmtInf"` // unstructured remittance information
+}
+
+// InstructedAmount is an amount in an ISO 4217 currency
+type InstructedAmount struct {
+	Currency string  `json:"Ccy"`
+	Value    float64 `json:"Value"`
+}
+
+// PaymentParty is a debtor or creditor reference
+type PaymentParty struct {
+	Name string `json:"Nm,omitempty"`
+	ID   string `json:"Id"`
 }
 
 // CorporateActionEvent represents a corporate action event
@@ -46,6 +932,13 @@ type CorporateActionEvent struct {
 	Amount    float64   `json:"amount"`
 	Timestamp time.Time `json:"timestamp"`
 	TxID      string    `json:"txId"`
+
+	// Set when a coupon payment or redemption is processed
+	PaymentInstruction *PaymentInstruction `json:"paymentInstruction,omitempty"`
+
+	// Position of the event in its bond's event stream, starting at 1;
+	// unset on events not tied to a bond
+	Sequence int64 `json:"sequence,omitempty"`
 }
 
 // Init initializes the contract
@@ -54,34 +947,81 @@ func (ca *CorporateAction) Init(ctx contractapi.TransactionContextInterface) err
 	return nil
 }
 
-// CreateCouponPayment creates a new coupon payment
+// CreateCouponPayment creates a new coupon payment. The payment date must be
+// a business day under the bond's business-day convention and one of the
+// bond's coupon dates. The amount must match the coupon the bond terms give
+// for that period, FaceValue x CouponRate x the period's accrual fraction,
+// within couponAmountTolerance; an amount of 0 uses the computed coupon.
+// Floating-rate coupons are not checked, as their rate is only fixed later.
+// Only the paying agent may create coupon payments.
 func (ca *CorporateAction) CreateCouponPayment(ctx contractapi.TransactionContextInterface, bondID, paymentDateStr string, amount float64) error {
-	// Generate unique ID for coupon payment
-	couponID := fmt.Sprintf("COUPON_%s_%s", bondID, time.Now().Format("20060102"))
-	
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
 	// Parse payment date
 	paymentDate, err := time.Parse("2006-01-02", paymentDateStr)
 	if err != nil {
 		return fmt.Errorf("invalid payment date format: %v", err)
 	}
 
-	// Create new coupon payment
-	couponPayment := CouponPayment{
-		ID:          couponID,
-		BondID:      bondID,
-		PaymentDate: paymentDate,
-		Amount:      amount,
-		Status:      "PENDING",
-		Metadata:    make(map[string]string),
+	couponID := couponIDFor(bondID, paymentDate)
+	existing, err := getIndexed(ctx, couponObjectType, couponID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("coupon payment %s already exists", couponID)
 	}
 
-	// Store coupon payment
-	couponJSON, err := json.Marshal(couponPayment)
+	err = requireNotInDefault(ctx, bondID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal coupon payment: %v", err)
+		return err
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if bond.Status == "VOID" {
+		return fmt.Errorf("bond %s has been voided", bondID)
+	}
+	if bond.Status == "DEFAULTED" {
+		return fmt.Errorf("bond %s is in default and coupon payments are suspended", bondID)
+	}
+	if bond.BondType == "ZERO_COUPON" {
+		return fmt.Errorf("bond %s is a zero-coupon bond and pays no coupons", bondID)
+	}
+	holidays, err := bondHolidays(ctx, bond)
+	if err != nil {
+		return err
+	}
+	adjusted := adjustBusinessDay(paymentDate, bond.Terms.BusinessDayConvention, holidays)
+	if !adjusted.Equal(paymentDate) {
+		return fmt.Errorf("payment date %s is not a business day, bond %s pays on %s", paymentDateStr, bondID, adjusted.Format("2006-01-02"))
+	}
+
+	var couponPayment *CouponPayment
+	for _, scheduled := range couponSchedule(bond, holidays) {
+		if scheduled.PaymentDate.Equal(paymentDate) {
+			couponPayment = scheduled
+			break
+		}
+	}
+	if couponPayment == nil {
+		return fmt.Errorf("%s is not a coupon date of bond %s", paymentDateStr, bondID)
 	}
 
-	err = ctx.GetStub().PutState(couponID, couponJSON)
+	if amount == 0 {
+		amount = couponPayment.Amount
+	} else if bond.BondType != "FRN" && !withinCouponTolerance(amount, couponPayment.Amount) {
+		return fmt.Errorf("coupon amount %.2f does not match the %.2f due under the terms of bond %s", amount, couponPayment.Amount, bondID)
+	}
+	couponPayment.Amount = amount
+
+	// Store coupon payment
+	err = putCouponPayment(ctx, couponPayment)
 	if err != nil {
 		return fmt.Errorf("failed to store coupon payment: %v", err)
 	}
@@ -96,21 +1036,28 @@ func (ca *CorporateAction) CreateCouponPayment(ctx contractapi.TransactionContex
 		TxID:      ctx.GetStub().GetTxID(),
 	}
 
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
-	}
-
-	err = ctx.GetStub().SetEvent("CorporateActionEvent", eventJSON)
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
 	if err != nil {
-		return fmt.Errorf("failed to emit event: %v", err)
+		return err
 	}
 
 	return nil
 }
 
-// ProcessCouponPayment processes a coupon payment
+// ProcessCouponPayment processes a coupon payment once the issuer has
+// pre-funded the bond's payment account. Only the paying agent may process
+// payments.
 func (ca *CorporateAction) ProcessCouponPayment(ctx contractapi.TransactionContextInterface, couponID string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	processedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+
 	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
 	if err != nil {
 		return fmt.Errorf("failed to get coupon payment: %v", err)
@@ -120,20 +1067,44 @@ func (ca *CorporateAction) ProcessCouponPayment(ctx contractapi.TransactionConte
 		return fmt.Errorf("coupon payment %s is not pending", couponID)
 	}
 
+	err = verifyFunding(ctx, couponPayment)
+	if err != nil {
+		return err
+	}
+
+	instruction, err := ca.paymentInstruction(ctx, couponID, couponPayment.BondID, "Coupon", couponPayment.Amount, couponPayment.PaymentDate, couponPayment.Settlement, couponPayment.Entitlement)
+	if err != nil {
+		return err
+	}
+
+	if couponPayment.Entitlement.SnapshotTxID != "" {
+		err = ca.createHolderPayments(ctx, couponPayment, instruction)
+		if err != nil {
+			return err
+		}
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Update status to paid
 	couponPayment.Status = "PAID"
-	couponPayment.PaidAt = time.Now()
+	couponPayment.PaidAt = txTime
 	couponPayment.TxID = ctx.GetStub().GetTxID()
+	couponPayment.ProcessedBy = processedBy
+	recordAttempt(couponPayment, "PAID", "", ctx.GetStub().GetTxID(), txTime)
 
 	// Store updated coupon payment
-	couponJSON, err := json.Marshal(couponPayment)
+	err = putCouponPayment(ctx, couponPayment)
 	if err != nil {
-		return fmt.Errorf("failed to marshal coupon payment: %v", err)
+		return fmt.Errorf("failed to update coupon payment: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(couponID, couponJSON)
+	err = accrueAgencyFee(ctx, couponPayment.BondID, couponObjectType, couponID, couponPayment.Amount, processedBy)
 	if err != nil {
-		return fmt.Errorf("failed to update coupon payment: %v", err)
+		return err
 	}
 
 	// Emit event
@@ -144,119 +1115,302 @@ func (ca *CorporateAction) ProcessCouponPayment(ctx contractapi.TransactionConte
 		Amount:    couponPayment.Amount,
 		Timestamp: time.Now(),
 		TxID:      ctx.GetStub().GetTxID(),
-	}
 
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		PaymentInstruction: instruction,
 	}
 
-	err = ctx.GetStub().SetEvent("CorporateActionEvent", eventJSON)
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
 	if err != nil {
-		return fmt.Errorf("failed to emit event: %v", err)
+		return err
 	}
 
 	return nil
 }
 
-// CreateRedemption creates a new bond redemption
-func (ca *CorporateAction) CreateRedemption(ctx contractapi.TransactionContextInterface, bondID, redemptionDateStr string, amount float64) error {
-	// Generate unique ID for redemption
-	redemptionID := fmt.Sprintf("REDEMPTION_%s_%s", bondID, time.Now().Format("20060102"))
-	
-	// Parse redemption date
-	redemptionDate, err := time.Parse("2006-01-02", redemptionDateStr)
+// GenerateCouponSchedule creates a PENDING coupon payment for every period
+// from the bond's issue date to maturity, using the coupon frequency, day
+// count and business-day conventions in its terms. Periods are rolled back
+// from maturity so any odd period is the first one. Coupons that already
+// exist are left untouched, so the call can be repeated safely. Only the
+// paying agent may generate the schedule.
+func (ca *CorporateAction) GenerateCouponSchedule(ctx contractapi.TransactionContextInterface, bondID string) ([]*CouponPayment, error) {
+	err := requireRole(ctx, payingAgentRole)
 	if err != nil {
-		return fmt.Errorf("invalid redemption date format: %v", err)
+		return nil, err
 	}
 
-	// Create new redemption
-	redemption := Redemption{
-		ID:             redemptionID,
-		BondID:         bondID,
-		RedemptionDate: redemptionDate,
-		Amount:         amount,
-		Status:         "PENDING",
-		Metadata:       make(map[string]string),
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if bond.Status != "ACTIVE" {
+		return nil, fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+	if bond.BondType == "ZERO_COUPON" {
+		return nil, fmt.Errorf("bond %s is a zero-coupon bond and pays no coupons", bondID)
 	}
 
-	// Store redemption
-	redemptionJSON, err := json.Marshal(redemption)
+	holidays, err := bondHolidays(ctx, bond)
 	if err != nil {
-		return fmt.Errorf("failed to marshal redemption: %v", err)
+		return nil, err
 	}
 
-	err = ctx.GetStub().PutState(redemptionID, redemptionJSON)
+	var created []*CouponPayment
+	for _, couponPayment := range couponSchedule(bond, holidays) {
+		existing, err := getIndexed(ctx, couponObjectType, couponPayment.ID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			continue
+		}
+
+		err = putCouponPayment(ctx, couponPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store coupon payment: %v", err)
+		}
+		created = append(created, couponPayment)
+	}
+
+	txTime, err := txTimestamp(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to store redemption: %v", err)
+		return nil, err
 	}
 
 	// Emit event
 	event := CorporateActionEvent{
-		Type:      "REDEMPTION_CREATED",
+		Type:      "COUPON_SCHEDULE_GENERATED",
 		BondID:    bondID,
-		Details:   fmt.Sprintf("Redemption created for bond %s", bondID),
-		Amount:    amount,
-		Timestamp: time.Now(),
+		Details:   fmt.Sprintf("%d coupon payments scheduled for bond %s", len(created), bondID),
+		Timestamp: txTime,
 		TxID:      ctx.GetStub().GetTxID(),
 	}
 
-	eventJSON, err := json.Marshal(event)
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		return nil, err
 	}
 
-	err = ctx.GetStub().SetEvent("CorporateActionEvent", eventJSON)
+	return created, nil
+}
+
+// ResetCouponRate fixes the coupon rate of a floating-rate note for the reset
+// period starting on period (YYYY-MM-DD): it reads the benchmark fixing from
+// the rate oracle contract, adds the spread, applies any cap and floor, and
+// recomputes the pending scheduled coupons accruing in that period. Only the
+// calculation agent or the paying agent may reset a rate.
+func (ca *CorporateAction) ResetCouponRate(ctx contractapi.TransactionContextInterface, bondID, period string) (*RateFixing, error) {
+	err := requireRole(ctx, calculationAgentRole, payingAgentRole)
 	if err != nil {
-		return fmt.Errorf("failed to emit event: %v", err)
+		return nil, err
 	}
 
-	return nil
-}
+	periodStart, err := time.Parse("2006-01-02", period)
+	if err != nil {
+		return nil, fmt.Errorf("invalid period format: %v", err)
+	}
 
-// ProcessRedemption processes a bond redemption
-func (ca *CorporateAction) ProcessRedemption(ctx contractapi.TransactionContextInterface, redemptionID string) error {
-	redemption, err := ca.GetRedemption(ctx, redemptionID)
+	bond, err := getBond(ctx, bondID)
 	if err != nil {
-		return fmt.Errorf("failed to get redemption: %v", err)
+		return nil, err
+	}
+	if bond.BondType != "FRN" {
+		return nil, fmt.Errorf("bond %s is not a floating-rate note", bondID)
+	}
+	if bond.Status != "ACTIVE" {
+		return nil, fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
 	}
 
-	if redemption.Status != "PENDING" {
-		return fmt.Errorf("redemption %s is not pending", redemptionID)
+	fixingKey, err := ctx.GetStub().CreateCompositeKey("RATEFIXING", []string{bondID, period})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate fixing key: %v", err)
+	}
+	existing, err := ctx.GetStub().GetState(fixingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate fixing: %v", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("rate for bond %s is already fixed for %s", bondID, period)
 	}
 
-	// Update status to completed
-	redemption.Status = "COMPLETED"
-	redemption.CompletedAt = time.Now()
-	redemption.TxID = ctx.GetStub().GetTxID()
+	args := [][]byte{[]byte("GetFixing"), []byte(bond.Terms.BenchmarkIndex), []byte(period)}
+	response := ctx.GetStub().InvokeChaincode(rateOracleChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get %s fixing for %s: %s", bond.Terms.BenchmarkIndex, period, response.Message)
+	}
 
-	// Store updated redemption
-	redemptionJSON, err := json.Marshal(redemption)
+	var benchmark BenchmarkFixing
+	err = json.Unmarshal(response.Payload, &benchmark)
 	if err != nil {
-		return fmt.Errorf("failed to marshal redemption: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal benchmark fixing: %v", err)
 	}
 
-	err = ctx.GetStub().PutState(redemptionID, redemptionJSON)
+	txTime, err := txTimestamp(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update redemption: %v", err)
+		return nil, err
+	}
+
+	fixing := floatingRate(bond.Terms, benchmark.Rate)
+	fixing.BondID = bondID
+	fixing.Period = period
+	fixing.FixedAt = txTime
+	fixing.TxID = ctx.GetStub().GetTxID()
+	fixing.CouponsUpdated = []string{}
+
+	// Re-price pending scheduled coupons whose accrual starts in this reset period
+	periodEnd := addMonths(periodStart, bond.Terms.ResetFrequency)
+	couponPayments, err := ca.GetCouponPaymentsByBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	for _, couponPayment := range couponPayments {
+		if couponPayment.Status != "PENDING" || couponPayment.AccrualFactor == 0 {
+			continue
+		}
+		if couponPayment.PeriodStart.Before(periodStart) || !couponPayment.PeriodStart.Before(periodEnd) {
+			continue
+		}
+
+		couponPayment.CouponRate = fixing.Rate
+		couponPayment.Amount = scheduledCouponAmount(bond, fixing.Rate, couponPayment.AccrualFactor)
+		err = putCouponPayment(ctx, couponPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update coupon payment: %v", err)
+		}
+		fixing.CouponsUpdated = append(fixing.CouponsUpdated, couponPayment.ID)
+	}
+
+	fixingJSON, err := json.Marshal(fixing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rate fixing: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(fixingKey, fixingJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store rate fixing: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("CouponRateReset", fixingJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return fixing, nil
+}
+
+// SuspendCouponPayments moves every pending coupon payment of a bond to
+// SUSPENDED so it can no longer be processed, and returns how many were
+// suspended. BondToken invokes it when the bond's issuer defaults, on behalf
+// of the trustee declaring the default; only the trustee may call it.
+func (ca *CorporateAction) SuspendCouponPayments(ctx contractapi.TransactionContextInterface, bondID, reason string) (int, error) {
+	err := requireRole(ctx, trusteeRole)
+	if err != nil {
+		return 0, err
+	}
+
+	suspended, err := ca.suspendPendingCoupons(ctx, bondID, reason)
+	if err != nil {
+		return 0, err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return 0, err
 	}
 
 	// Emit event
 	event := CorporateActionEvent{
-		Type:      "REDEMPTION_PROCESSED",
-		BondID:    redemption.BondID,
-		Details:   fmt.Sprintf("Redemption %s processed", redemptionID),
-		Amount:    redemption.Amount,
-		Timestamp: time.Now(),
+		Type:      "COUPON_PAYMENTS_SUSPENDED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("%d pending coupon payments suspended: %s", suspended, reason),
+		Timestamp: txTime,
 		TxID:      ctx.GetStub().GetTxID(),
 	}
 
-	eventJSON, err := json.Marshal(event)
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %v", err)
+		return 0, err
+	}
+
+	return suspended, nil
+}
+
+// DeclareDefault records a credit event against a bond. It moves the bond
+// to DEFAULTED in the BondToken contract, suspends its pending coupon
+// payments and blocks further corporate actions other than restructuring.
+// Only trustee identities may declare a default.
+func (ca *CorporateAction) DeclareDefault(ctx contractapi.TransactionContextInterface, bondID, eventType, details string) error {
+	err := requireRole(ctx, trusteeRole)
+	if err != nil {
+		return err
+	}
+
+	switch eventType {
+	case "FAILURE_TO_PAY", "BANKRUPTCY", "COVENANT_BREACH", "CROSS_DEFAULT", "REPUDIATION":
+	default:
+		return fmt.Errorf("invalid credit event type: %s", eventType)
+	}
+
+	current, err := getDefaultDeclaration(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.ResolvedAt.IsZero() {
+		return fmt.Errorf("bond %s is already in default", bondID)
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if bond.Status == "VOID" || bond.Status == "MATURED" {
+		return fmt.Errorf("bond %s is %s", bondID, bond.Status)
+	}
+
+	// The bond is already DEFAULTED when its issuer defaulted on another issue
+	if bond.Status != "DEFAULTED" {
+		args := [][]byte{[]byte("UpdateBondStatus"), []byte(bondID), []byte("DEFAULTED"), []byte("0")}
+		response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+		if response.Status != shim.OK {
+			return fmt.Errorf("failed to update bond status: %s", response.Message)
+		}
+	}
+
+	declaredBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	suspended, err := ca.suspendPendingCoupons(ctx, bondID, eventType+": "+details)
+	if err != nil {
+		return err
+	}
+
+	declaration := DefaultDeclaration{
+		BondID:           bondID,
+		EventType:        eventType,
+		Details:          details,
+		DeclaredBy:       declaredBy,
+		DeclaredAt:       txTime,
+		SuspendedCoupons: suspended,
+		TxID:             ctx.GetStub().GetTxID(),
+	}
+
+	declarationJSON, err := json.Marshal(declaration)
+	if err != nil {
+		return fmt.Errorf("failed to marshal default declaration: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(defaultKey(bondID), declarationJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store default declaration: %v", err)
 	}
 
-	err = ctx.GetStub().SetEvent("CorporateActionEvent", eventJSON)
+	err = ctx.GetStub().SetEvent("DefaultDeclared", declarationJSON)
 	if err != nil {
 		return fmt.Errorf("failed to emit event: %v", err)
 	}
@@ -264,178 +1418,6876 @@ func (ca *CorporateAction) ProcessRedemption(ctx contractapi.TransactionContextI
 	return nil
 }
 
-// GetCouponPayment retrieves a coupon payment
-func (ca *CorporateAction) GetCouponPayment(ctx contractapi.TransactionContextInterface, couponID string) (*CouponPayment, error) {
-	couponJSON, err := ctx.GetStub().GetState(couponID)
+// GetDefaultDeclaration returns the credit event declared against a bond
+func (ca *CorporateAction) GetDefaultDeclaration(ctx contractapi.TransactionContextInterface, bondID string) (*DefaultDeclaration, error) {
+	declaration, err := getDefaultDeclaration(ctx, bondID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read coupon payment: %v", err)
+		return nil, err
 	}
-	if couponJSON == nil {
-		return nil, fmt.Errorf("coupon payment %s does not exist", couponID)
+	if declaration == nil {
+		return nil, fmt.Errorf("bond %s has no default declaration", bondID)
 	}
 
-	var couponPayment CouponPayment
-	err = json.Unmarshal(couponJSON, &couponPayment)
+	return declaration, nil
+}
+
+// ProposeRestructuring opens a bondholder vote on new terms for a bond.
+// termsJSON is a RestructuringTerms object. Holders on recordDateStr, which
+// must have closed, may vote until votingDeadlineStr; threshold is the
+// percent of their tokens that must vote in favour. Only trustee identities
+// may propose a restructuring, and it is accepted for defaulted bonds.
+func (ca *CorporateAction) ProposeRestructuring(ctx contractapi.TransactionContextInterface, bondID, termsJSON, recordDateStr, votingDeadlineStr string, threshold float64) (*Restructuring, error) {
+	err := requireRole(ctx, trusteeRole)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal coupon payment: %v", err)
+		return nil, err
 	}
 
-	return &couponPayment, nil
-}
+	var terms RestructuringTerms
+	err = json.Unmarshal([]byte(termsJSON), &terms)
+	if err != nil {
+		return nil, fmt.Errorf("invalid restructuring terms: %v", err)
+	}
 
-// GetRedemption retrieves a redemption
-func (ca *CorporateAction) GetRedemption(ctx contractapi.TransactionContextInterface, redemptionID string) (*Redemption, error) {
-	redemptionJSON, err := ctx.GetStub().GetState(redemptionID)
+	bond, err := getBond(ctx, bondID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read redemption: %v", err)
+		return nil, err
 	}
-	if redemptionJSON == nil {
-		return nil, fmt.Errorf("redemption %s does not exist", redemptionID)
+	if bond.Status != "ACTIVE" && bond.Status != "DEFAULTED" {
+		return nil, fmt.Errorf("bond %s cannot be restructured: %s", bondID, bond.Status)
 	}
-
-	var redemption Redemption
-	err = json.Unmarshal(redemptionJSON, &redemption)
+	err = validateRestructuringTerms(bond, terms)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal redemption: %v", err)
+		return nil, err
+	}
+	if threshold <= 0 || threshold > 100 {
+		return nil, fmt.Errorf("threshold must be between 0 and 100 percent")
 	}
 
-	return &redemption, nil
-}
+	recordDate, err := time.Parse("2006-01-02", recordDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record date format: %v", err)
+	}
+	votingDeadline, err := time.Parse("2006-01-02", votingDeadlineStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid voting deadline format: %v", err)
+	}
 
-// GetCouponPaymentsByBond returns all coupon payments for a specific bond
-func (ca *CorporateAction) GetCouponPaymentsByBond(ctx contractapi.TransactionContextInterface, bondID string) ([]*CouponPayment, error) {
-	startKey := ""
-	endKey := ""
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if txTime.Before(recordDate.AddDate(0, 0, 1)) {
+		return nil, fmt.Errorf("record date %s has not closed yet", recordDateStr)
+	}
+	if !votingDeadline.After(txTime) {
+		return nil, fmt.Errorf("voting deadline must be in the future")
+	}
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	restructuringID := fmt.Sprintf("RESTRUCTURING_%s_%s", bondID, txTime.Format("20060102"))
+	existing, err := ctx.GetStub().GetState(restructuringID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get state by range: %v", err)
+		return nil, fmt.Errorf("failed to read restructuring: %v", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("restructuring %s already exists", restructuringID)
 	}
-	defer resultsIterator.Close()
 
-	var couponPayments []*CouponPayment
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate results: %v", err)
+	holders, err := holdersAsOf(ctx, bondID, recordDate)
+	if err != nil {
+		return nil, err
+	}
+	var eligible int64
+	for _, holder := range holders {
+		if holder.Address != bond.IssuerID {
+			eligible += holder.Quantity
 		}
+	}
+	if eligible == 0 {
+		return nil, fmt.Errorf("bond %s had no holders on %s", bondID, recordDateStr)
+	}
 
-		// Check if this is a coupon payment for the specific bond
-		if len(queryResult.Key) > 8 && queryResult.Key[:8] == "COUPON_" && contains(queryResult.Key, bondID) {
-			var couponPayment CouponPayment
-			err = json.Unmarshal(queryResult.Value, &couponPayment)
-			if err == nil && couponPayment.BondID == bondID {
-				couponPayments = append(couponPayments, &couponPayment)
-			}
-		}
+	proposedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
 	}
 
-	return couponPayments, nil
+	restructuring := Restructuring{
+		ID:               restructuringID,
+		BondID:           bondID,
+		Terms:            terms,
+		RecordDate:       recordDate,
+		VotingDeadline:   votingDeadline,
+		Threshold:        threshold,
+		EligibleQuantity: eligible,
+		Status:           "VOTING",
+		ProposedBy:       proposedBy,
+		ProposedAt:       txTime,
+		TxID:             ctx.GetStub().GetTxID(),
+	}
+
+	err = putRestructuring(ctx, &restructuring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store restructuring: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "RESTRUCTURING_PROPOSED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("Restructuring %s open for voting until %s", restructuringID, votingDeadlineStr),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &restructuring, nil
 }
 
-// GetRedemptionsByBond returns all redemptions for a specific bond
-func (ca *CorporateAction) GetRedemptionsByBond(ctx contractapi.TransactionContextInterface, bondID string) ([]*Redemption, error) {
-	startKey := ""
-	endKey := ""
+// VoteOnRestructuring records the calling holder's vote, weighted by their
+// holding on the restructuring's record date. Each holder votes once.
+func (ca *CorporateAction) VoteOnRestructuring(ctx contractapi.TransactionContextInterface, restructuringID string, inFavor bool) error {
+	holder, err := callerAddress(ctx)
+	if err != nil {
+		return err
+	}
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	restructuring, err := ca.GetRestructuring(ctx, restructuringID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get state by range: %v", err)
+		return err
+	}
+	if restructuring.Status != "VOTING" {
+		return fmt.Errorf("restructuring %s is not open for voting", restructuringID)
 	}
-	defer resultsIterator.Close()
 
-	var redemptions []*Redemption
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate results: %v", err)
-		}
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if txTime.After(restructuring.VotingDeadline) {
+		return fmt.Errorf("voting on restructuring %s closed on %s", restructuringID, restructuring.VotingDeadline.Format("2006-01-02"))
+	}
 
-		// Check if this is a redemption for the specific bond
-		if len(queryResult.Key) > 11 && queryResult.Key[:11] == "REDEMPTION_" && contains(queryResult.Key, bondID) {
-			var redemption Redemption
-			err = json.Unmarshal(queryResult.Value, &redemption)
-			if err == nil && redemption.BondID == bondID {
-				redemptions = append(redemptions, &redemption)
-			}
+	voteKey, err := ctx.GetStub().CreateCompositeKey("RESTRUCTURINGVOTE", []string{restructuringID, holder})
+	if err != nil {
+		return fmt.Errorf("failed to create vote key: %v", err)
+	}
+	existing, err := ctx.GetStub().GetState(voteKey)
+	if err != nil {
+		return fmt.Errorf("failed to read vote: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("%s has already voted on restructuring %s", holder, restructuringID)
+	}
+
+	bond, err := getBond(ctx, restructuring.BondID)
+	if err != nil {
+		return err
+	}
+	if holder == bond.IssuerID {
+		return fmt.Errorf("the issuer cannot vote on a restructuring")
+	}
+
+	holders, err := holdersAsOf(ctx, restructuring.BondID, restructuring.RecordDate)
+	if err != nil {
+		return err
+	}
+	var quantity int64
+	for _, h := range holders {
+		if h.Address == holder {
+			quantity = h.Quantity
 		}
 	}
+	if quantity == 0 {
+		return fmt.Errorf("%s held no tokens on the record date", holder)
+	}
 
-	return redemptions, nil
-}
+	vote := RestructuringVote{
+		RestructuringID: restructuringID,
+		Holder:          holder,
+		Quantity:        quantity,
+		InFavor:         inFavor,
+		CastAt:          txTime,
+		TxID:            ctx.GetStub().GetTxID(),
+	}
 
-// GetPendingCouponPayments returns all pending coupon payments
-func (ca *CorporateAction) GetPendingCouponPayments(ctx contractapi.TransactionContextInterface) ([]*CouponPayment, error) {
-	startKey := ""
-	endKey := ""
+	voteJSON, err := json.Marshal(vote)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vote: %v", err)
+	}
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	err = ctx.GetStub().PutState(voteKey, voteJSON)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get state by range: %v", err)
+		return fmt.Errorf("failed to store vote: %v", err)
 	}
-	defer resultsIterator.Close()
 
-	var pendingPayments []*CouponPayment
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate results: %v", err)
-		}
+	if inFavor {
+		restructuring.VotesFor += quantity
+	} else {
+		restructuring.VotesAgainst += quantity
+	}
 
-		// Check if this is a pending coupon payment
-		if len(queryResult.Key) > 8 && queryResult.Key[:8] == "COUPON_" {
-			var couponPayment CouponPayment
-			err = json.Unmarshal(queryResult.Value, &couponPayment)
-			if err == nil && couponPayment.Status == "PENDING" {
-				pendingPayments = append(pendingPayments, &couponPayment)
-			}
-		}
+	err = putRestructuring(ctx, restructuring)
+	if err != nil {
+		return fmt.Errorf("failed to update restructuring: %v", err)
 	}
 
-	return pendingPayments, nil
+	return nil
 }
 
-// GetPendingRedemptions returns all pending redemptions
-func (ca *CorporateAction) GetPendingRedemptions(ctx contractapi.TransactionContextInterface) ([]*Redemption, error) {
-	startKey := ""
-	endKey := ""
+// RestructureBond applies a restructuring whose vote has passed. It updates
+// the bond's terms in the BondToken contract, regenerates the coupon
+// payments falling due after today from the new terms, records the
+// replaced terms for audit and cures any declared default. The new coupon
+// rate applies from the current coupon period. Only trustee identities may
+// apply a restructuring.
+func (ca *CorporateAction) RestructureBond(ctx contractapi.TransactionContextInterface, restructuringID string) (*Restructuring, error) {
+	err := requireRole(ctx, trusteeRole)
+	if err != nil {
+		return nil, err
+	}
 
-	resultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	restructuring, err := ca.GetRestructuring(ctx, restructuringID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get state by range: %v", err)
+		return nil, err
+	}
+	if restructuring.Status != "VOTING" {
+		return nil, fmt.Errorf("restructuring %s is %s", restructuringID, restructuring.Status)
+	}
+	if !restructuringPassed(restructuring) {
+		return nil, fmt.Errorf("restructuring %s has not passed: %d of %d tokens in favour, %v%% required",
+			restructuringID, restructuring.VotesFor, restructuring.EligibleQuantity, restructuring.Threshold)
 	}
-	defer resultsIterator.Close()
 
-	var pendingRedemptions []*Redemption
-	for resultsIterator.HasNext() {
-		queryResult, err := resultsIterator.Next()
-		if err != nil {
-			return nil, fmt.Errorf("failed to iterate results: %v", err)
-		}
+	bond, err := getBond(ctx, restructuring.BondID)
+	if err != nil {
+		return nil, err
+	}
+	err = validateRestructuringTerms(bond, restructuring.Terms)
+	if err != nil {
+		return nil, err
+	}
 
-		// Check if this is a pending redemption
-		if len(queryResult.Key) > 11 && queryResult.Key[:11] == "REDEMPTION_" {
-			var redemption Redemption
-			err = json.Unmarshal(queryResult.Value, &redemption)
-			if err == nil && redemption.Status == "PENDING" {
-				pendingRedemptions = append(pendingRedemptions, &redemption)
-			}
-		}
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return pendingRedemptions, nil
-}
+	args := [][]byte{
+		[]byte("RestructureTerms"),
+		[]byte(bond.ID),
+		[]byte(strconv.FormatFloat(restructuring.Terms.HaircutPercent, 'f', -1, 64)),
+		[]byte(strconv.FormatFloat(restructuring.Terms.CouponRate, 'f', -1, 64)),
+		[]byte(restructuring.Terms.MaturityDate),
+	}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to restructure bond terms: %s", response.Message)
+	}
 
-// CalculateCouponAmount calculates the coupon amount for a bond
-func (ca *CorporateAction) CalculateCouponAmount(ctx contractapi.TransactionContextInterface, bondID string, faceValue float64, couponRate float64) (float64, error) {
-	// Simple calculation: (Face Value * Coupon Rate) / 100
-	couponAmount := (faceValue * couponRate) / 100
-	return couponAmount, nil
-}
+	restructuring.PreviousTerms = &PreviousTerms{
+		OutstandingFaceValue: outstandingPrincipal(bond),
+		CouponRate:           bond.CouponRate,
+		MaturityDate:         bond.MaturityDate,
+	}
+
+	// The BondToken update is not visible to reads in this transaction, so
+	// the new schedule is built from a locally restructured copy
+	restructured := *bond
+	restructured.OutstandingFaceValue = outstandingPrincipal(bond) * (1 - restructuring.Terms.HaircutPercent/100)
+	if restructuring.Terms.CouponRate > 0 {
+		restructured.CouponRate = restructuring.Terms.CouponRate
+	}
+	if restructuring.Terms.MaturityDate != "" {
+		restructured.MaturityDate, _ = time.Parse("2006-01-02", restructuring.Terms.MaturityDate)
+	}
+
+	if restructured.BondType != "ZERO_COUPON" {
+		restructuring.CouponsUpdated, err = ca.rescheduleCoupons(ctx, &restructured, txTime, restructuringID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	declaration, err := getDefaultDeclaration(ctx, bond.ID)
+	if err != nil {
+		return nil, err
+	}
+	if declaration != nil && declaration.ResolvedAt.IsZero() {
+		declaration.RestructuringID = restructuringID
+		declaration.ResolvedAt = txTime
+
+		declarationJSON, err := json.Marshal(declaration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal default declaration: %v", err)
+		}
+		err = ctx.GetStub().PutState(defaultKey(bond.ID), declarationJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update default declaration: %v", err)
+		}
+	}
+
+	restructuring.Status = "APPLIED"
+	restructuring.AppliedAt = txTime
+	restructuring.TxID = ctx.GetStub().GetTxID()
+	err = putRestructuring(ctx, restructuring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update restructuring: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "RESTRUCTURING_APPLIED",
+		BondID:    bond.ID,
+		Details:   fmt.Sprintf("Restructuring %s applied, %d coupon payments rescheduled", restructuringID, len(restructuring.CouponsUpdated)),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return restructuring, nil
+}
+
+// GetRestructuring returns a restructuring by ID
+func (ca *CorporateAction) GetRestructuring(ctx contractapi.TransactionContextInterface, restructuringID string) (*Restructuring, error) {
+	restructuringJSON, err := ctx.GetStub().GetState(restructuringID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read restructuring: %v", err)
+	}
+	if restructuringJSON == nil {
+		return nil, fmt.Errorf("restructuring %s does not exist", restructuringID)
+	}
+
+	var restructuring Restructuring
+	err = json.Unmarshal(restructuringJSON, &restructuring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal restructuring: %v", err)
+	}
+
+	return &restructuring, nil
+}
+
+// FailCouponPayment marks a pending coupon payment FAILED when its cash leg
+// does not settle, recording reasonCode (e.g. "INSUFFICIENT_FUNDS",
+// "ACCOUNT_CLOSED") in the attempt history. Only the paying agent may fail
+// a payment.
+func (ca *CorporateAction) FailCouponPayment(ctx contractapi.TransactionContextInterface, couponID, reasonCode string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	if reasonCode == "" {
+		return fmt.Errorf("reason code is required")
+	}
+
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+
+	if couponPayment.Status != "PENDING" {
+		return fmt.Errorf("coupon payment %s is not pending", couponID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	couponPayment.Status = "FAILED"
+	couponPayment.FailureReason = reasonCode
+	recordAttempt(couponPayment, "FAILED", reasonCode, ctx.GetStub().GetTxID(), txTime)
+
+	err = putCouponPayment(ctx, couponPayment)
+	if err != nil {
+		return fmt.Errorf("failed to update coupon payment: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "COUPON_PAYMENT_FAILED",
+		BondID:    couponPayment.BondID,
+		Details:   fmt.Sprintf("Coupon payment %s failed: %s", couponID, reasonCode),
+		Amount:    couponPayment.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RetryCouponPayment returns a failed coupon payment to PENDING so it can be
+// processed again; the failure stays in its attempt history. Only the paying
+// agent may retry a payment.
+func (ca *CorporateAction) RetryCouponPayment(ctx contractapi.TransactionContextInterface, couponID string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+
+	if couponPayment.Status != "FAILED" {
+		return fmt.Errorf("coupon payment %s has not failed", couponID)
+	}
+
+	err = requireNotInDefault(ctx, couponPayment.BondID)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	couponPayment.Status = "PENDING"
+	couponPayment.FailureReason = ""
+	recordAttempt(couponPayment, "RETRIED", "", ctx.GetStub().GetTxID(), txTime)
+
+	err = putCouponPayment(ctx, couponPayment)
+	if err != nil {
+		return fmt.Errorf("failed to update coupon payment: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "COUPON_PAYMENT_RETRIED",
+		BondID:    couponPayment.BondID,
+		Details:   fmt.Sprintf("Coupon payment %s queued for retry", couponID),
+		Amount:    couponPayment.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CancelCouponPayment cancels a coupon payment that has not been paid. Only
+// the paying agent may cancel a payment.
+func (ca *CorporateAction) CancelCouponPayment(ctx contractapi.TransactionContextInterface, couponID, reason string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("cancellation reason is required")
+	}
+
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+
+	switch couponPayment.Status {
+	case "PENDING", "FAILED", "SUSPENDED":
+	default:
+		return fmt.Errorf("coupon payment %s cannot be cancelled: %s", couponID, couponPayment.Status)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	couponPayment.Status = "CANCELLED"
+	if couponPayment.Metadata == nil {
+		couponPayment.Metadata = make(map[string]string)
+	}
+	couponPayment.Metadata["cancelReason"] = reason
+
+	err = putCouponPayment(ctx, couponPayment)
+	if err != nil {
+		return fmt.Errorf("failed to update coupon payment: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "COUPON_PAYMENT_CANCELLED",
+		BondID:    couponPayment.BondID,
+		Details:   fmt.Sprintf("Coupon payment %s cancelled: %s", couponID, reason),
+		Amount:    couponPayment.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReverseCouponPayment requests the reversal of a paid coupon payment. The
+// reversal only takes effect once the trustee approves it with
+// ApproveCouponReversal. Only the paying agent may request a reversal.
+func (ca *CorporateAction) ReverseCouponPayment(ctx contractapi.TransactionContextInterface, couponID, reason string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("reversal reason is required")
+	}
+
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+
+	if couponPayment.Status != "PAID" {
+		return fmt.Errorf("coupon payment %s has not been paid", couponID)
+	}
+
+	reversalID := "REVERSAL_" + couponID
+	existing, err := ctx.GetStub().GetState(reversalID)
+	if err != nil {
+		return fmt.Errorf("failed to read reversal: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("reversal of coupon payment %s has already been requested", couponID)
+	}
+
+	requestedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	reversal := CouponReversal{
+		ID:          reversalID,
+		CouponID:    couponID,
+		BondID:      couponPayment.BondID,
+		Amount:      -couponPayment.Amount,
+		Reason:      reason,
+		Status:      "PENDING_APPROVAL",
+		RequestedBy: requestedBy,
+		RequestedAt: txTime,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+
+	err = putCouponReversal(ctx, &reversal)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "COUPON_REVERSAL_REQUESTED",
+		BondID:    couponPayment.BondID,
+		Details:   fmt.Sprintf("Reversal of coupon payment %s requested: %s", couponID, reason),
+		Amount:    reversal.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApproveCouponReversal approves a requested coupon reversal, completing the
+// compensating record and marking the original payment REVERSED. Only the
+// trustee may approve a reversal, and never one it requested itself.
+func (ca *CorporateAction) ApproveCouponReversal(ctx contractapi.TransactionContextInterface, couponID string) error {
+	err := requireRole(ctx, trusteeRole)
+	if err != nil {
+		return err
+	}
+
+	reversal, err := ca.GetCouponReversal(ctx, couponID)
+	if err != nil {
+		return err
+	}
+
+	if reversal.Status != "PENDING_APPROVAL" {
+		return fmt.Errorf("reversal of coupon payment %s is not awaiting approval", couponID)
+	}
+
+	approvedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if approvedBy == reversal.RequestedBy {
+		return fmt.Errorf("reversal must be approved by a different identity than the one that requested it")
+	}
+
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+	if couponPayment.Status != "PAID" {
+		return fmt.Errorf("coupon payment %s has not been paid", couponID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	reversal.Status = "COMPLETED"
+	reversal.ApprovedBy = approvedBy
+	reversal.ApprovedAt = txTime
+	reversal.TxID = ctx.GetStub().GetTxID()
+
+	err = putCouponReversal(ctx, reversal)
+	if err != nil {
+		return err
+	}
+
+	couponPayment.Status = "REVERSED"
+	if couponPayment.Metadata == nil {
+		couponPayment.Metadata = make(map[string]string)
+	}
+	couponPayment.Metadata["reversalId"] = reversal.ID
+
+	err = putCouponPayment(ctx, couponPayment)
+	if err != nil {
+		return fmt.Errorf("failed to update coupon payment: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "COUPON_PAYMENT_REVERSED",
+		BondID:    couponPayment.BondID,
+		Details:   fmt.Sprintf("Coupon payment %s reversed: %s", couponID, reversal.Reason),
+		Amount:    reversal.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetCouponReversal retrieves the reversal record of a coupon payment
+func (ca *CorporateAction) GetCouponReversal(ctx contractapi.TransactionContextInterface, couponID string) (*CouponReversal, error) {
+	reversalJSON, err := ctx.GetStub().GetState("REVERSAL_" + couponID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reversal: %v", err)
+	}
+	if reversalJSON == nil {
+		return nil, fmt.Errorf("no reversal has been requested for coupon payment %s", couponID)
+	}
+
+	var reversal CouponReversal
+	err = json.Unmarshal(reversalJSON, &reversal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reversal: %v", err)
+	}
+
+	return &reversal, nil
+}
+
+// CreateRedemption creates a new bond redemption
+func (ca *CorporateAction) CreateRedemption(ctx contractapi.TransactionContextInterface, bondID, redemptionDateStr string, amount float64) error {
+	// Parse redemption date
+	redemptionDate, err := time.Parse("2006-01-02", redemptionDateStr)
+	if err != nil {
+		return fmt.Errorf("invalid redemption date format: %v", err)
+	}
+
+	redemptionID := redemptionIDFor(bondID, redemptionDate)
+	existing, err := getIndexed(ctx, redemptionObjectType, redemptionID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("redemption %s already exists", redemptionID)
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if bond.Status == "VOID" || bond.Status == "MATURED" {
+		return fmt.Errorf("bond %s is %s", bondID, bond.Status)
+	}
+
+	err = requireNotInDefault(ctx, bondID)
+	if err != nil {
+		return err
+	}
+
+	// Create new redemption
+	redemption := Redemption{
+		ID:             redemptionID,
+		BondID:         bondID,
+		RedemptionDate: redemptionDate,
+		Amount:         amount,
+		Status:         "PENDING",
+		Metadata:       make(map[string]string),
+	}
+
+	// Store redemption
+	err = putRedemption(ctx, &redemption)
+	if err != nil {
+		return fmt.Errorf("failed to store redemption: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "REDEMPTION_CREATED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("Redemption created for bond %s", bondID),
+		Amount:    amount,
+		Timestamp: time.Now(),
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ExerciseCall exercises the issuer's call option: it checks callDateStr
+// (YYYY-MM-DD) against the bond's call schedule and notice period, creates
+// an early redemption of the whole issue at callPrice (percent of
+// outstanding face) plus accrued interest, and cancels pending coupons
+// falling after the call date. Only the issuer or the trustee may exercise
+// the call.
+func (ca *CorporateAction) ExerciseCall(ctx contractapi.TransactionContextInterface, bondID, callDateStr string, callPrice float64) error {
+	callDate, err := time.Parse("2006-01-02", callDateStr)
+	if err != nil {
+		return fmt.Errorf("invalid call date format: %v", err)
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+
+	if requireRole(ctx, trusteeRole) != nil {
+		caller, err := callerAddress(ctx)
+		if err != nil {
+			return err
+		}
+		if caller != bond.IssuerID {
+			return fmt.Errorf("caller is not authorized: only the issuer or the trustee may call bond %s", bondID)
+		}
+	}
+	if bond.Status != "ACTIVE" {
+		return fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+	if !callDate.Before(bond.MaturityDate) {
+		return fmt.Errorf("call date must be before maturity on %s", bond.MaturityDate.Format("2006-01-02"))
+	}
+
+	scheduledPrice, err := scheduledCallPrice(bond.Terms.CallSchedule, callDate)
+	if err != nil {
+		return err
+	}
+	if scheduledPrice == 0 {
+		return fmt.Errorf("bond %s is not callable on %s", bondID, callDateStr)
+	}
+	if callPrice < scheduledPrice {
+		return fmt.Errorf("call price %v is below the scheduled call price %v", callPrice, scheduledPrice)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if txTime.AddDate(0, 0, bond.Terms.CallNoticeDays).After(callDate) {
+		return fmt.Errorf("call on %s does not give the required %d days notice", callDateStr, bond.Terms.CallNoticeDays)
+	}
+
+	redemptionID := redemptionIDFor(bondID, callDate)
+	existing, err := getIndexed(ctx, redemptionObjectType, redemptionID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("redemption %s already exists", redemptionID)
+	}
+
+	accrued := accruedInterest(bond, callDate)
+	redemption := Redemption{
+		ID:             redemptionID,
+		BondID:         bondID,
+		RedemptionDate: callDate,
+		Type:           "CALL",
+		Amount:         roundAmount((outstandingPrincipal(bond)*callPrice/100 + accrued) * float64(bond.TotalSupply)),
+		Status:         "PENDING",
+		Metadata: map[string]string{
+			"callPrice":       strconv.FormatFloat(callPrice, 'f', -1, 64),
+			"accruedInterest": strconv.FormatFloat(accrued, 'f', -1, 64),
+		},
+	}
+
+	err = putRedemption(ctx, &redemption)
+	if err != nil {
+		return fmt.Errorf("failed to store redemption: %v", err)
+	}
+
+	// Coupons after the call date will never be paid
+	couponPayments, err := ca.GetCouponPaymentsByBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	for _, couponPayment := range couponPayments {
+		if couponPayment.Status != "PENDING" || !couponPayment.PaymentDate.After(callDate) {
+			continue
+		}
+		couponPayment.Status = "CANCELLED"
+		if couponPayment.Metadata == nil {
+			couponPayment.Metadata = make(map[string]string)
+		}
+		couponPayment.Metadata["cancelReason"] = "bond called on " + callDateStr
+		err = putCouponPayment(ctx, couponPayment)
+		if err != nil {
+			return fmt.Errorf("failed to update coupon payment: %v", err)
+		}
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "CALL_EXERCISED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("Bond %s called for redemption on %s at %v plus accrued interest of %v per token", bondID, callDateStr, callPrice, roundAmount(accrued)),
+		Amount:    redemption.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SubmitPutNotice tenders quantity of a holder's tokens for redemption
+// under the bond's put option. It must be submitted while a put window is
+// open, and the holder must hold the tokens. Holders tender their own
+// tokens; the registrar may tender on a holder's behalf.
+func (ca *CorporateAction) SubmitPutNotice(ctx contractapi.TransactionContextInterface, bondID, holder string, quantity int64) error {
+	caller, err := callerAddress(ctx)
+	if err != nil {
+		return err
+	}
+	if caller != holder {
+		err = requireRole(ctx, registrarRole)
+		if err != nil {
+			return err
+		}
+	}
+
+	if quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if bond.Status != "ACTIVE" {
+		return fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	window, err := openPutWindow(bond.Terms.PutSchedule, txTime)
+	if err != nil {
+		return err
+	}
+	if window == nil {
+		return fmt.Errorf("no put window is open for bond %s", bondID)
+	}
+
+	balance, err := getBalance(ctx, bondID, holder)
+	if err != nil {
+		return err
+	}
+	if balance < quantity {
+		return fmt.Errorf("insufficient balance: %d < %d", balance, quantity)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey("PUTNOTICE", []string{bondID, window.PutDate, holder})
+	if err != nil {
+		return fmt.Errorf("failed to create put notice key: %v", err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read put notice: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("%s has already submitted a put notice for %s", holder, window.PutDate)
+	}
+
+	notice := PutNotice{
+		BondID:      bondID,
+		Holder:      holder,
+		Quantity:    quantity,
+		PutDate:     window.PutDate,
+		Status:      "SUBMITTED",
+		SubmittedAt: txTime,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+
+	noticeJSON, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("failed to marshal put notice: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, noticeJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store put notice: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "PUT_NOTICE_SUBMITTED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("%s tendered %d tokens for the %s put", holder, quantity, window.PutDate),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ProcessPutRedemptions creates the redemption for every put notice of a put
+// date, on or after that date. Each holder is redeemed for the tokens they
+// tendered, capped at what they still hold; the per-holder amounts are
+// stored as entitlements of the redemption. Only the paying agent may
+// process put redemptions.
+func (ca *CorporateAction) ProcessPutRedemptions(ctx contractapi.TransactionContextInterface, bondID, putDateStr string) (*Redemption, error) {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return nil, err
+	}
+
+	putDate, err := time.Parse("2006-01-02", putDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid put date format: %v", err)
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if bond.Status != "ACTIVE" {
+		return nil, fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+
+	var window *PutWindow
+	for i := range bond.Terms.PutSchedule {
+		if bond.Terms.PutSchedule[i].PutDate == putDateStr {
+			window = &bond.Terms.PutSchedule[i]
+		}
+	}
+	if window == nil {
+		return nil, fmt.Errorf("bond %s has no put on %s", bondID, putDateStr)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if txTime.Before(putDate) {
+		return nil, fmt.Errorf("put date %s has not been reached", putDateStr)
+	}
+
+	redemptionID := redemptionIDFor(bondID, putDate) + "_PUT"
+	existing, err := getIndexed(ctx, redemptionObjectType, redemptionID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("put redemptions for %s have already been processed", putDateStr)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("PUTNOTICE", []string{bondID, putDateStr})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get put notices: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	accrued := accruedInterest(bond, putDate)
+	perToken := outstandingPrincipal(bond)*window.Price/100 + accrued
+
+	redemption := Redemption{
+		ID:             redemptionID,
+		BondID:         bondID,
+		RedemptionDate: putDate,
+		Type:           "PUT",
+		Status:         "PENDING",
+		Metadata: map[string]string{
+			"putPrice":        strconv.FormatFloat(window.Price, 'f', -1, 64),
+			"accruedInterest": strconv.FormatFloat(accrued, 'f', -1, 64),
+		},
+	}
+
+	var redeemed int64
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var notice PutNotice
+		err = json.Unmarshal(queryResult.Value, &notice)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal put notice: %v", err)
+		}
+		if notice.Status != "SUBMITTED" {
+			continue
+		}
+
+		balance, err := getBalance(ctx, bondID, notice.Holder)
+		if err != nil {
+			return nil, err
+		}
+		notice.Redeemed = notice.Quantity
+		if balance < notice.Redeemed {
+			notice.Redeemed = balance
+		}
+
+		if notice.Redeemed == 0 {
+			notice.Status = "REJECTED"
+		} else {
+			notice.Status = "PROCESSED"
+			notice.RedemptionID = redemptionID
+
+			entitlement := Entitlement{
+				ActionID:   redemptionID,
+				BondID:     bondID,
+				Address:    notice.Holder,
+				Quantity:   notice.Redeemed,
+				Amount:     roundAmount(perToken * float64(notice.Redeemed)),
+				RecordDate: putDate,
+				TxID:       ctx.GetStub().GetTxID(),
+			}
+			entitlement.NetAmount = entitlement.Amount
+
+			entitlementJSON, err := json.Marshal(entitlement)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal entitlement: %v", err)
+			}
+			entitlementKey, err := ctx.GetStub().CreateCompositeKey("ENTITLEMENT", []string{redemptionID, notice.Holder})
+			if err != nil {
+				return nil, fmt.Errorf("failed to create entitlement key: %v", err)
+			}
+			err = ctx.GetStub().PutState(entitlementKey, entitlementJSON)
+			if err != nil {
+				return nil, fmt.Errorf("failed to store entitlement: %v", err)
+			}
+
+			redeemed += notice.Redeemed
+			redemption.Amount += entitlement.Amount
+			redemption.Entitlement.HolderCount++
+		}
+
+		noticeJSON, err := json.Marshal(notice)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal put notice: %v", err)
+		}
+		err = ctx.GetStub().PutState(queryResult.Key, noticeJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update put notice: %v", err)
+		}
+	}
+
+	if redeemed == 0 {
+		return nil, fmt.Errorf("no tokens were tendered for the %s put", putDateStr)
+	}
+
+	redemption.Amount = roundAmount(redemption.Amount)
+	redemption.Entitlement.RecordDate = putDate
+	redemption.Entitlement.EntitledAmount = redemption.Amount
+	redemption.Entitlement.SnapshotTxID = ctx.GetStub().GetTxID()
+	redemption.Metadata["quantity"] = strconv.FormatInt(redeemed, 10)
+
+	err = putRedemption(ctx, &redemption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store redemption: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "PUT_REDEMPTIONS_PROCESSED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("%d tokens redeemed for the %s put", redeemed, putDateStr),
+		Amount:    redemption.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redemption, nil
+}
+
+// ElectConversion converts quantity of a holder's tokens into the underlying
+// at the bond's conversion ratio while the conversion window is open. The
+// tokens are burned in the BondToken contract, so the election must be
+// submitted by the registrar on the holder's behalf.
+func (ca *CorporateAction) ElectConversion(ctx contractapi.TransactionContextInterface, bondID, holder string, quantity int64) (*Conversion, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("quantity must be positive")
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if bond.Status != "ACTIVE" {
+		return nil, fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+	if bond.Terms.ConversionRatio <= 0 {
+		return nil, fmt.Errorf("bond %s is not convertible", bondID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	open, err := conversionOpen(bond.Terms, txTime)
+	if err != nil {
+		return nil, err
+	}
+	if !open {
+		return nil, fmt.Errorf("conversion window for bond %s is not open", bondID)
+	}
+
+	units := float64(quantity) * bond.Terms.ConversionRatio
+	conversion := Conversion{
+		ID:              fmt.Sprintf("CONVERSION_%s_%s", bondID, ctx.GetStub().GetTxID()),
+		BondID:          bondID,
+		Holder:          holder,
+		Quantity:        quantity,
+		ConversionRatio: bond.Terms.ConversionRatio,
+		Underlying:      bond.Terms.Underlying,
+		UnitsDue:        int64(math.Floor(units)),
+		FractionalUnits: units - math.Floor(units),
+		Status:          "CONVERTED",
+		ConvertedAt:     txTime,
+		TxID:            ctx.GetStub().GetTxID(),
+	}
+
+	args := [][]byte{
+		[]byte("BurnTokens"),
+		[]byte(bondID),
+		[]byte(holder),
+		[]byte(strconv.FormatInt(quantity, 10)),
+		[]byte("conversion " + conversion.ID),
+	}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to burn converted tokens: %s", response.Message)
+	}
+
+	conversionJSON, err := json.Marshal(conversion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal conversion: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(conversion.ID, conversionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store conversion: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "CONVERSION",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("%s converted %d tokens into %d units of %s", holder, quantity, conversion.UnitsDue, conversion.Underlying),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conversion, nil
+}
+
+// GetConversions returns all conversions of a bond
+func (ca *CorporateAction) GetConversions(ctx contractapi.TransactionContextInterface, bondID string) ([]*Conversion, error) {
+	prefix := "CONVERSION_" + bondID + "_"
+	resultsIterator, err := ctx.GetStub().GetStateByRange(prefix, prefix+"~")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversions: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var conversions []*Conversion
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var conversion Conversion
+		err = json.Unmarshal(queryResult.Value, &conversion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal conversion: %v", err)
+		}
+
+		conversions = append(conversions, &conversion)
+	}
+
+	return conversions, nil
+}
+
+// AnnounceCorporateAction publishes an MT564-style announcement for a bond.
+// announcementJSON holds eventType, mandatoryVoluntary, an optional actionId
+// of the coupon payment, redemption or amortization payment it announces,
+// exDate, recordDate, paymentDate and responseDeadline (YYYY-MM-DD), rate,
+// narrative and the options. The reference is derived from the bond, event
+// type and key date; announcing the same event again replaces the earlier
+// announcement (REPL) with the next sequence number. The announcement is
+// emitted whole as a CorporateActionAnnouncement event.
+func (ca *CorporateAction) AnnounceCorporateAction(ctx contractapi.TransactionContextInterface, bondID, announcementJSON string) (*Announcement, error) {
+	var input struct {
+		EventType          string               `json:"eventType"`
+		MandatoryVoluntary string               `json:"mandatoryVoluntary"`
+		ActionID           string               `json:"actionId"`
+		ExDate             string               `json:"exDate"`
+		RecordDate         string               `json:"recordDate"`
+		PaymentDate        string               `json:"paymentDate"`
+		ResponseDeadline   string               `json:"responseDeadline"`
+		Rate               float64              `json:"rate"`
+		Narrative          string               `json:"narrative"`
+		Options            []AnnouncementOption `json:"options"`
+	}
+	err := json.Unmarshal([]byte(announcementJSON), &input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid announcement: %v", err)
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	announcement := &Announcement{
+		Function:           "NEWM",
+		Sequence:           1,
+		EventType:          input.EventType,
+		MandatoryVoluntary: input.MandatoryVoluntary,
+		BondID:             bondID,
+		ISIN:               bond.ISIN,
+		ActionID:           input.ActionID,
+		Rate:               input.Rate,
+		Currency:           bond.Currency,
+		Options:            input.Options,
+		Narrative:          input.Narrative,
+		AnnouncedAt:        txTime,
+		TxID:               ctx.GetStub().GetTxID(),
+	}
+	announcement.Dates.Announcement = time.Date(txTime.Year(), txTime.Month(), txTime.Day(), 0, 0, 0, 0, time.UTC)
+
+	dates := []struct {
+		value string
+		date  *time.Time
+		name  string
+	}{
+		{input.ExDate, &announcement.Dates.ExDate, "ex date"},
+		{input.RecordDate, &announcement.Dates.RecordDate, "record date"},
+		{input.PaymentDate, &announcement.Dates.PaymentDate, "payment date"},
+		{input.ResponseDeadline, &announcement.Dates.ResponseDeadline, "response deadline"},
+	}
+	for _, d := range dates {
+		if d.value == "" {
+			continue
+		}
+		*d.date, err = time.Parse("2006-01-02", d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s format: %v", d.name, err)
+		}
+	}
+
+	err = validateAnnouncement(announcement)
+	if err != nil {
+		return nil, err
+	}
+
+	if announcement.ActionID != "" {
+		found := false
+		for _, objectType := range []string{couponObjectType, redemptionObjectType, amortizationObjectType} {
+			actionJSON, err := getIndexed(ctx, objectType, announcement.ActionID)
+			if err != nil {
+				return nil, err
+			}
+			if actionJSON == nil {
+				continue
+			}
+			var action struct {
+				BondID string `json:"bondId"`
+			}
+			err = json.Unmarshal(actionJSON, &action)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal corporate action: %v", err)
+			}
+			if action.BondID != bondID {
+				return nil, fmt.Errorf("corporate action %s is not on bond %s", announcement.ActionID, bondID)
+			}
+			found = true
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("corporate action %s does not exist", announcement.ActionID)
+		}
+	}
+
+	keyDate := announcement.Dates.PaymentDate
+	if keyDate.IsZero() {
+		keyDate = announcement.Dates.RecordDate
+	}
+	if keyDate.IsZero() {
+		keyDate = announcement.Dates.ResponseDeadline
+	}
+	announcement.ID = fmt.Sprintf("CA_%s_%s_%s", bondID, announcement.EventType, keyDate.Format("20060102"))
+
+	existing, err := getAnnouncement(ctx, announcement.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		announcement.Function = "REPL"
+		announcement.Sequence = existing.Sequence + 1
+	}
+
+	// Holders elect on the linked action until the response deadline
+	if announcement.ActionID != "" && announcement.MandatoryVoluntary != "MAND" {
+		err = updateEntitlementInfo(ctx, announcement.ActionID, func(info *EntitlementInfo) error {
+			if !info.ElectionsClosedAt.IsZero() {
+				return fmt.Errorf("elections on %s are closed", announcement.ActionID)
+			}
+			info.ElectionID = announcement.ID
+			info.ElectionDeadline = announcement.Dates.ResponseDeadline
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	announcementBytes, err := json.Marshal(announcement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal announcement: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(announcement.ID, announcementBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store announcement: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("CorporateActionAnnouncement", announcementBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return announcement, nil
+}
+
+// GetAnnouncement returns the latest version of a corporate action
+// announcement
+func (ca *CorporateAction) GetAnnouncement(ctx contractapi.TransactionContextInterface, announcementID string) (*Announcement, error) {
+	announcement, err := getAnnouncement(ctx, announcementID)
+	if err != nil {
+		return nil, err
+	}
+	if announcement == nil {
+		return nil, fmt.Errorf("announcement %s does not exist", announcementID)
+	}
+	return announcement, nil
+}
+
+// SubmitElection records a holder's choice of option on an elective
+// announcement against their entitlement to the linked coupon payment or
+// redemption, e.g. cash or payment in kind, or a settlement currency. The
+// holder is the caller's "address" identity attribute, or their identity ID
+// without one. Holders may change their election until the end of the
+// response deadline.
+func (ca *CorporateAction) SubmitElection(ctx contractapi.TransactionContextInterface, announcementID, optionNumber string) (*Entitlement, error) {
+	holder, err := callerAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	announcement, err := ca.GetAnnouncement(ctx, announcementID)
+	if err != nil {
+		return nil, err
+	}
+	if announcement.MandatoryVoluntary == "MAND" {
+		return nil, fmt.Errorf("announcement %s is mandatory and takes no elections", announcementID)
+	}
+	if announcement.ActionID == "" {
+		return nil, fmt.Errorf("announcement %s is not linked to a corporate action", announcementID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !txTime.Before(announcement.Dates.ResponseDeadline.AddDate(0, 0, 1)) {
+		return nil, fmt.Errorf("response deadline %s of announcement %s has passed", announcement.Dates.ResponseDeadline.Format("2006-01-02"), announcementID)
+	}
+
+	var option *AnnouncementOption
+	for i := range announcement.Options {
+		if announcement.Options[i].Number == optionNumber {
+			option = &announcement.Options[i]
+			break
+		}
+	}
+	if option == nil {
+		return nil, fmt.Errorf("announcement %s has no option %s", announcementID, optionNumber)
+	}
+
+	entitlement, err := ca.GetEntitlement(ctx, announcement.ActionID, holder)
+	if err != nil {
+		return nil, err
+	}
+
+	if option.Currency != "" && option.Currency != announcement.Currency {
+		bond, err := getBond(ctx, announcement.BondID)
+		if err != nil {
+			return nil, err
+		}
+		permitted := false
+		for _, c := range bond.SettlementCurrencies {
+			if c == option.Currency {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return nil, fmt.Errorf("bond %s cannot be settled in %s", announcement.BondID, option.Currency)
+		}
+	}
+
+	setElectedOption(entitlement, option, false)
+	entitlement.ElectedAt = txTime
+	entitlement.ElectionTxID = ctx.GetStub().GetTxID()
+
+	err = putEntitlement(ctx, entitlement)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "ELECTION_SUBMITTED",
+		BondID:    announcement.BondID,
+		Details:   fmt.Sprintf("%s elected option %s (%s) on %s", holder, option.Number, option.Code, announcement.ActionID),
+		Amount:    entitlement.NetAmount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return entitlement, nil
+}
+
+// CloseElections closes the elections on an announcement once its response
+// deadline has passed, applying the default option to every entitlement the
+// holder did not elect on, or no action when the announcement has no
+// default, so the linked action can be processed. It returns the number of
+// entitlements defaulted. Only the paying agent may close elections.
+func (ca *CorporateAction) CloseElections(ctx contractapi.TransactionContextInterface, announcementID string) (int, error) {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return 0, err
+	}
+
+	announcement, err := ca.GetAnnouncement(ctx, announcementID)
+	if err != nil {
+		return 0, err
+	}
+	if announcement.MandatoryVoluntary == "MAND" || announcement.ActionID == "" {
+		return 0, fmt.Errorf("announcement %s takes no elections", announcementID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if txTime.Before(announcement.Dates.ResponseDeadline.AddDate(0, 0, 1)) {
+		return 0, fmt.Errorf("response deadline %s of announcement %s has not passed", announcement.Dates.ResponseDeadline.Format("2006-01-02"), announcementID)
+	}
+
+	defaultOption := &AnnouncementOption{Code: "NOAC"}
+	for i := range announcement.Options {
+		if announcement.Options[i].Default {
+			defaultOption = &announcement.Options[i]
+			break
+		}
+	}
+
+	defaulted := 0
+	err = updateEntitlementInfo(ctx, announcement.ActionID, func(info *EntitlementInfo) error {
+		if info.ElectionID != announcementID {
+			return fmt.Errorf("%s is not subject to elections on announcement %s", announcement.ActionID, announcementID)
+		}
+		if !info.ElectionsClosedAt.IsZero() {
+			return fmt.Errorf("elections on %s are already closed", announcement.ActionID)
+		}
+		if info.SnapshotTxID == "" {
+			return fmt.Errorf("entitlements for %s have not been taken", announcement.ActionID)
+		}
+
+		entitlements, err := ca.GetEntitlements(ctx, announcement.ActionID)
+		if err != nil {
+			return err
+		}
+		for _, entitlement := range entitlements {
+			if entitlement.Option != "" || entitlement.OptionCode != "" {
+				continue
+			}
+			setElectedOption(entitlement, defaultOption, true)
+			err = putEntitlement(ctx, entitlement)
+			if err != nil {
+				return err
+			}
+			defaulted++
+		}
+
+		info.ElectionsClosedAt = txTime
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "ELECTIONS_CLOSED",
+		BondID:    announcement.BondID,
+		Details:   fmt.Sprintf("Elections on %s closed, default option applied to %d holders", announcement.ActionID, defaulted),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return 0, err
+	}
+
+	return defaulted, nil
+}
+
+// ProcessRedemption processes a bond redemption and has the BondToken
+// contract burn the redeemed tokens. Only the paying agent may process
+// payments.
+func (ca *CorporateAction) ProcessRedemption(ctx contractapi.TransactionContextInterface, redemptionID string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	redemption, err := ca.GetRedemption(ctx, redemptionID)
+	if err != nil {
+		return fmt.Errorf("failed to get redemption: %v", err)
+	}
+
+	if redemption.Status != "PENDING" {
+		return fmt.Errorf("redemption %s is not pending", redemptionID)
+	}
+
+	err = requireNotInDefault(ctx, redemption.BondID)
+	if err != nil {
+		return err
+	}
+
+	instruction, err := ca.completeRedemption(ctx, redemption)
+	if err != nil {
+		return err
+	}
+
+	err = ca.burnRedeemedTokens(ctx, redemption)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "REDEMPTION_PROCESSED",
+		BondID:    redemption.BondID,
+		Details:   fmt.Sprintf("Redemption %s processed", redemptionID),
+		Amount:    redemption.Amount,
+		Timestamp: time.Now(),
+		TxID:      ctx.GetStub().GetTxID(),
+
+		PaymentInstruction: instruction,
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ProcessMaturity settles a bond at maturity in one transaction: it pays
+// every coupon still pending, the last one included, pays the final
+// principal redemption, creating it unless CreateRedemption already has,
+// and has the BondToken contract burn all holdings and mark the bond MATURED.
+// The bond may still be ACTIVE or already marked MATURED by MatureBond.
+// Amortizing bonds must have their amortization payments processed first.
+// Only the paying agent may process payments.
+func (ca *CorporateAction) ProcessMaturity(ctx contractapi.TransactionContextInterface, bondID string) (*Redemption, error) {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireNotInDefault(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	// A retired bond has no supply left to redeem
+	if bond.Status == "MATURED" && bond.TotalSupply == 0 {
+		return nil, fmt.Errorf("bond %s has already been retired", bondID)
+	}
+	if bond.Status != "ACTIVE" && bond.Status != "MATURED" {
+		return nil, fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if txTime.Before(bond.MaturityDate) {
+		return nil, fmt.Errorf("bond %s does not mature until %s", bondID, bond.MaturityDate.Format("2006-01-02"))
+	}
+
+	amortizations, err := ca.GetAmortizationPaymentsByBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	for _, amortization := range amortizations {
+		if amortization.Status == "PENDING" {
+			return nil, fmt.Errorf("amortization payment %s of bond %s is still pending", amortization.ID, bondID)
+		}
+	}
+
+	// Coupons are paid before the principal they accrued on is redeemed
+	couponPayments, err := ca.GetCouponPaymentsByBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	var couponIDs []string
+	var couponTotal float64
+	for _, couponPayment := range couponPayments {
+		if couponPayment.Status != "PENDING" {
+			continue
+		}
+		err = ca.ProcessCouponPayment(ctx, couponPayment.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pay coupon %s: %v", couponPayment.ID, err)
+		}
+		couponIDs = append(couponIDs, couponPayment.ID)
+		couponTotal += couponPayment.Amount
+	}
+
+	// The final redemption is created here for the outstanding principal
+	// of the issue unless one was already raised for the maturity date
+	redemptionID := redemptionIDFor(bondID, bond.MaturityDate)
+	redemptionJSON, err := getIndexed(ctx, redemptionObjectType, redemptionID)
+	if err != nil {
+		return nil, err
+	}
+	redemption := &Redemption{
+		ID:             redemptionID,
+		BondID:         bondID,
+		RedemptionDate: bond.MaturityDate,
+		Amount:         roundAmount(outstandingPrincipal(bond) * float64(bond.TotalSupply)),
+		Status:         "PENDING",
+		Metadata:       make(map[string]string),
+	}
+	if redemptionJSON != nil {
+		err = json.Unmarshal(redemptionJSON, redemption)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal redemption: %v", err)
+		}
+		if redemption.Status != "PENDING" {
+			return nil, fmt.Errorf("redemption %s is not pending", redemptionID)
+		}
+	}
+
+	instruction, err := ca.completeRedemption(ctx, redemption)
+	if err != nil {
+		return nil, err
+	}
+
+	args := [][]byte{[]byte("RetireBond"), []byte(bondID)}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to retire bond %s: %s", bondID, response.Message)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "MATURITY_PROCESSED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("Bond %s matured: redemption %s processed", bondID, redemptionID),
+		Amount:    roundAmount(redemption.Amount + couponTotal),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		PaymentInstruction: instruction,
+	}
+	if len(couponIDs) > 0 {
+		event.Details = fmt.Sprintf("Bond %s matured: redemption %s processed with coupons %s", bondID, redemptionID, strings.Join(couponIDs, ", "))
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return redemption, nil
+}
+
+// GetEventsSince returns the stored events of a bond with a sequence number
+// greater than seq, in sequence order, so consumers can fill gaps and replay
+// missed events
+func (ca *CorporateAction) GetEventsSince(ctx contractapi.TransactionContextInterface, bondID string, seq int64) ([]*CorporateActionEvent, error) {
+	if seq < 0 {
+		return nil, fmt.Errorf("sequence cannot be negative")
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(eventObjectType, []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	events := []*CorporateActionEvent{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var event CorporateActionEvent
+		err = json.Unmarshal(queryResult.Value, &event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal event: %v", err)
+		}
+		if event.Sequence > seq {
+			events = append(events, &event)
+		}
+	}
+
+	return events, nil
+}
+
+// SetRedemptionInstalments splits a pending redemption into instalments.
+// scheduleJSON is a JSON array of {"dueDate": "2006-01-02", "amount": n}
+// entries in date order; the amounts must add up to the redemption amount
+// and the last instalment must fall on the redemption date. expectedVersion
+// is the redemption version the caller last read, or 0 to skip the
+// concurrency check.
+func (ca *CorporateAction) SetRedemptionInstalments(ctx contractapi.TransactionContextInterface, redemptionID, scheduleJSON string, expectedVersion int64) error {
+	redemption, err := ca.GetRedemption(ctx, redemptionID)
+	if err != nil {
+		return fmt.Errorf("failed to get redemption: %v", err)
+	}
+
+	err = checkVersion("redemption "+redemptionID, redemption.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if redemption.Status != "PENDING" {
+		return fmt.Errorf("redemption %s is not pending", redemptionID)
+	}
+
+	var input []struct {
+		DueDate string  `json:"dueDate"`
+		Amount  float64 `json:"amount"`
+	}
+	err = json.Unmarshal([]byte(scheduleJSON), &input)
+	if err != nil {
+		return fmt.Errorf("invalid instalment schedule: %v", err)
+	}
+	if len(input) == 0 {
+		return fmt.Errorf("instalment schedule is empty")
+	}
+
+	var instalments []RedemptionInstalment
+	var total float64
+	for i, in := range input {
+		dueDate, err := time.Parse("2006-01-02", in.DueDate)
+		if err != nil {
+			return fmt.Errorf("invalid instalment date format: %v", err)
+		}
+		if in.Amount <= 0 {
+			return fmt.Errorf("instalment amount must be positive")
+		}
+		if i > 0 && !dueDate.After(instalments[i-1].DueDate) {
+			return fmt.Errorf("instalment dates must be strictly increasing")
+		}
+		total += in.Amount
+		instalments = append(instalments, RedemptionInstalment{Number: i + 1, DueDate: dueDate, Amount: in.Amount, Status: "PENDING"})
+	}
+
+	if !instalments[len(instalments)-1].DueDate.Equal(redemption.RedemptionDate) {
+		return fmt.Errorf("last instalment must fall on the redemption date %s", redemption.RedemptionDate.Format("2006-01-02"))
+	}
+	if roundAmount(total) != roundAmount(redemption.Amount) {
+		return fmt.Errorf("instalments total %.2f does not match redemption amount %.2f", total, redemption.Amount)
+	}
+
+	redemption.Instalments = instalments
+	redemption.OutstandingAmount = redemption.Amount
+
+	err = putRedemption(ctx, redemption)
+	if err != nil {
+		return fmt.Errorf("failed to update redemption: %v", err)
+	}
+
+	return nil
+}
+
+// ProcessRedemptionInstalment pays the next instalment of a redemption once
+// it is due. The instalment is paid through the paying agent and reduces the
+// outstanding amount; the redemption is PARTIALLY_REDEEMED until the last
+// instalment completes it. Only the paying agent may process payments.
+func (ca *CorporateAction) ProcessRedemptionInstalment(ctx contractapi.TransactionContextInterface, redemptionID string, number int) (*Redemption, error) {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return nil, err
+	}
+
+	processedBy, err := invokerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	redemption, err := ca.GetRedemption(ctx, redemptionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get redemption: %v", err)
+	}
+
+	if redemption.Status != "PENDING" && redemption.Status != "PARTIALLY_REDEEMED" {
+		return nil, fmt.Errorf("redemption %s is not outstanding: %s", redemptionID, redemption.Status)
+	}
+	if number < 1 || number > len(redemption.Instalments) {
+		return nil, fmt.Errorf("redemption %s has no instalment %d", redemptionID, number)
+	}
+
+	instalment := &redemption.Instalments[number-1]
+	if instalment.Status != "PENDING" {
+		return nil, fmt.Errorf("instalment %d of redemption %s is not pending", number, redemptionID)
+	}
+	if number > 1 && redemption.Instalments[number-2].Status != "PAID" {
+		return nil, fmt.Errorf("instalment %d of redemption %s must be paid first", number-1, redemptionID)
+	}
+
+	err = requireNotInDefault(ctx, redemption.BondID)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if txTime.Before(instalment.DueDate) {
+		return nil, fmt.Errorf("instalment %d of redemption %s is not due until %s", number, redemptionID, instalment.DueDate.Format("2006-01-02"))
+	}
+
+	instalmentID := fmt.Sprintf("%s_%d", redemptionID, number)
+	instruction, err := ca.paymentInstruction(ctx, instalmentID, redemption.BondID, "Redemption instalment", instalment.Amount, instalment.DueDate, redemption.Settlement, EntitlementInfo{})
+	if err != nil {
+		return nil, err
+	}
+
+	instalment.Status = "PAID"
+	instalment.PaidAt = txTime
+	instalment.TxID = ctx.GetStub().GetTxID()
+	instalment.ProcessedBy = processedBy
+	redemption.OutstandingAmount = roundAmount(redemption.OutstandingAmount - instalment.Amount)
+
+	redemption.Status = "PARTIALLY_REDEEMED"
+	if number == len(redemption.Instalments) {
+		redemption.Status = "COMPLETED"
+		redemption.CompletedAt = txTime
+		redemption.TxID = ctx.GetStub().GetTxID()
+		redemption.ProcessedBy = processedBy
+		redemption.OutstandingAmount = 0
+	}
+
+	err = putRedemption(ctx, redemption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update redemption: %v", err)
+	}
+
+	err = accrueAgencyFee(ctx, redemption.BondID, redemptionObjectType, instalmentID, instalment.Amount, processedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "REDEMPTION_INSTALMENT_PROCESSED",
+		BondID:    redemption.BondID,
+		Details:   fmt.Sprintf("Instalment %d of %d of redemption %s processed, %.2f outstanding", number, len(redemption.Instalments), redemptionID, redemption.OutstandingAmount),
+		Amount:    instalment.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		PaymentInstruction: instruction,
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return redemption, nil
+}
+
+// GetPaymentInstruction returns the ISO 20022 payment instruction generated
+// when a coupon payment or redemption was processed, or when a holder's
+// payments were netted
+func (ca *CorporateAction) GetPaymentInstruction(ctx contractapi.TransactionContextInterface, actionID string) (*PaymentInstruction, error) {
+	instructionJSON, err := ctx.GetStub().GetState(paymentInstructionKey(actionID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payment instruction: %v", err)
+	}
+	if instructionJSON == nil {
+		return nil, fmt.Errorf("no payment instruction for %s", actionID)
+	}
+
+	var instruction PaymentInstruction
+	err = json.Unmarshal(instructionJSON, &instruction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payment instruction: %v", err)
+	}
+
+	return &instruction, nil
+}
+
+// GetHolderPayments returns the per-holder payments of a coupon payment
+func (ca *CorporateAction) GetHolderPayments(ctx contractapi.TransactionContextInterface, couponID string) ([]*HolderPayment, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holderPaymentObjectType, []string{couponID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holder payments: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var holderPayments []*HolderPayment
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var holderPayment HolderPayment
+		err = json.Unmarshal(queryResult.Value, &holderPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal holder payment: %v", err)
+		}
+		holderPayments = append(holderPayments, &holderPayment)
+	}
+
+	return holderPayments, nil
+}
+
+// GetHolderPaymentsByHolder returns a holder's coupon payments across all
+// bonds, in coupon ID order
+func (ca *CorporateAction) GetHolderPaymentsByHolder(ctx contractapi.TransactionContextInterface, holder string) ([]*HolderPayment, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holderPaymentHolderIndex, []string{holder})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holder payments: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var holderPayments []*HolderPayment
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		holderPaymentJSON, err := ctx.GetStub().GetState(string(queryResult.Value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read holder payment: %v", err)
+		}
+		if holderPaymentJSON == nil {
+			continue
+		}
+
+		var holderPayment HolderPayment
+		err = json.Unmarshal(holderPaymentJSON, &holderPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal holder payment: %v", err)
+		}
+		holderPayments = append(holderPayments, &holderPayment)
+	}
+
+	return holderPayments, nil
+}
+
+// ConfirmCashSettlement records the paying bank's confirmation that a
+// holder payment has settled on the fiat rails, moving it from INSTRUCTED to
+// SETTLED. A settled amount different from the instructed one is recorded
+// and flagged for reconciliation rather than rejected, since the cash has
+// already moved. Only the paying bank may call it.
+func (ca *CorporateAction) ConfirmCashSettlement(ctx contractapi.TransactionContextInterface, paymentID, bankReference string, amount float64, valueDateStr string) (*HolderPayment, error) {
+	err := requireRole(ctx, payingBankRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if bankReference == "" {
+		return nil, fmt.Errorf("bank reference is required")
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	valueDate, err := time.Parse("2006-01-02", valueDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value date format: %v", err)
+	}
+
+	holderPayment, err := ca.GetHolderPayment(ctx, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if holderPayment.Status != "INSTRUCTED" {
+		return nil, fmt.Errorf("holder payment %s is not instructed: %s", paymentID, holderPayment.Status)
+	}
+	if holderPayment.NetPaymentID != "" {
+		return nil, fmt.Errorf("holder payment %s is paid as part of net payment %s", paymentID, holderPayment.NetPaymentID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	holderPayment.Status = "SETTLED"
+	holderPayment.BankReference = bankReference
+	holderPayment.SettledAmount = roundAmount(amount)
+	holderPayment.ValueDate = valueDate
+	holderPayment.SettledAt = txTime
+	holderPayment.AmountMismatch = holderPayment.SettledAmount != holderPayment.CashAmount
+	holderPayment.TxID = ctx.GetStub().GetTxID()
+
+	err = putHolderPayment(ctx, holderPayment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "CASH_SETTLED",
+		BondID:    holderPayment.BondID,
+		Details:   fmt.Sprintf("Holder payment %s settled with bank reference %s", paymentID, bankReference),
+		Amount:    holderPayment.SettledAmount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	if holderPayment.AmountMismatch {
+		event.Type = "CASH_SETTLEMENT_MISMATCH"
+		event.Details = fmt.Sprintf("Holder payment %s settled %.2f %s against %.2f instructed", paymentID, holderPayment.SettledAmount, holderPayment.Currency, holderPayment.CashAmount)
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return holderPayment, nil
+}
+
+// NetHolderPayments nets a holder's instructed coupon payments across bonds
+// due on valueDateStr (YYYY-MM-DD) in a currency into a single net payment
+// and builds one pain.001 credit transfer for it from the paying agent, so
+// large custodians receive one fiat payment instead of one per bond. The
+// netted holder payments record the net payment and can no longer be
+// settled on their own. Only the paying agent may net payments.
+func (ca *CorporateAction) NetHolderPayments(ctx contractapi.TransactionContextInterface, holder, valueDateStr, currency string) (*NetPayment, error) {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return nil, err
+	}
+
+	valueDate, err := time.Parse("2006-01-02", valueDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value date format: %v", err)
+	}
+
+	netPaymentID := fmt.Sprintf("NET_%s_%s_%s", holder, valueDate.Format("20060102"), currency)
+	existing, err := ctx.GetStub().GetState(netPaymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read net payment: %v", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("net payment %s already exists", netPaymentID)
+	}
+
+	holderPayments, err := ca.GetHolderPaymentsByHolder(ctx, holder)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	netPayment := &NetPayment{
+		ID:         netPaymentID,
+		Holder:     holder,
+		Currency:   currency,
+		ValueDate:  valueDate,
+		Components: []*NetPaymentComponent{},
+		Status:     "INSTRUCTED",
+		CreatedAt:  txTime,
+		TxID:       ctx.GetStub().GetTxID(),
+	}
+	var netted []*HolderPayment
+	for _, holderPayment := range holderPayments {
+		if holderPayment.Status != "INSTRUCTED" || holderPayment.NetPaymentID != "" {
+			continue
+		}
+		if holderPayment.Currency != currency || !holderPayment.PaymentDate.Equal(valueDate) {
+			continue
+		}
+		netPayment.Components = append(netPayment.Components, &NetPaymentComponent{
+			PaymentID:     holderPayment.ID,
+			CouponID:      holderPayment.CouponID,
+			BondID:        holderPayment.BondID,
+			CashReference: holderPayment.CashReference,
+			Amount:        holderPayment.CashAmount,
+		})
+		netPayment.Amount += holderPayment.CashAmount
+		netted = append(netted, holderPayment)
+	}
+	if len(netted) < 2 {
+		return nil, fmt.Errorf("%s has %d instructed %s payments due on %s, at least 2 are needed to net", holder, len(netted), currency, valueDateStr)
+	}
+	netPayment.Amount = roundAmount(netPayment.Amount)
+
+	for _, holderPayment := range netted {
+		holderPayment.NetPaymentID = netPaymentID
+		holderPayment.TxID = ctx.GetStub().GetTxID()
+		err = putHolderPayment(ctx, holderPayment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	payingAgent := PaymentParty{Name: "Paying agent", ID: "PAYING_AGENT"}
+	instruction := &PaymentInstruction{
+		MessageDefinition: "pain.001.001.09",
+		GroupHeader: PaymentGroupHeader{
+			MessageID:       ctx.GetStub().GetTxID(),
+			CreationTime:    txTime,
+			NumberOfTxs:     1,
+			ControlSum:      netPayment.Amount,
+			InitiatingParty: payingAgent,
+		},
+		PaymentInfo: PaymentInfo{
+			PaymentInfoID: netPaymentID,
+			PaymentMethod: "TRF",
+			ExecutionDate: valueDateStr,
+			Debtor:        payingAgent,
+			CreditTransfers: []*CreditTransfer{{
+				InstructionID: netPaymentID + "-1",
+				EndToEndID:    netPaymentID,
+				Amount:        InstructedAmount{Currency: currency, Value: netPayment.Amount},
+				Creditor:      PaymentParty{ID: holder},
+				Remittance:    fmt.Sprintf("Net coupon payment of %d holder payments due %s", len(netted), valueDateStr),
+			}},
+		},
+	}
+
+	instructionJSON, err := json.Marshal(instruction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payment instruction: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(paymentInstructionKey(netPaymentID), instructionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store payment instruction: %v", err)
+	}
+
+	netPaymentJSON, err := json.Marshal(netPayment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal net payment: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(netPaymentID, netPaymentJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store net payment: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "HOLDER_PAYMENTS_NETTED",
+		Details:   fmt.Sprintf("%d payments to %s due %s netted into %s", len(netted), holder, valueDateStr, netPaymentID),
+		Amount:    netPayment.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		PaymentInstruction: instruction,
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return netPayment, nil
+}
+
+// GetNetPayment returns a net payment with its component holder payments
+func (ca *CorporateAction) GetNetPayment(ctx contractapi.TransactionContextInterface, netPaymentID string) (*NetPayment, error) {
+	netPaymentJSON, err := ctx.GetStub().GetState(netPaymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read net payment: %v", err)
+	}
+	if netPaymentJSON == nil {
+		return nil, fmt.Errorf("net payment %s does not exist", netPaymentID)
+	}
+
+	var netPayment NetPayment
+	err = json.Unmarshal(netPaymentJSON, &netPayment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal net payment: %v", err)
+	}
+
+	return &netPayment, nil
+}
+
+// GetTaxVouchers returns the tax vouchers issued to a holder for coupons
+// paid in the given year, in coupon ID order. Holders may only read their
+// own vouchers; the issuer's tax team may read any holder's.
+func (ca *CorporateAction) GetTaxVouchers(ctx contractapi.TransactionContextInterface, holder string, year int) ([]*TaxVoucher, error) {
+	caller, err := callerAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if caller != holder {
+		err = requireRole(ctx, taxTeamRole)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(taxVoucherObjectType, []string{holder, strconv.Itoa(year)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tax vouchers: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	taxVouchers := []*TaxVoucher{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var taxVoucher TaxVoucher
+		err = json.Unmarshal(queryResult.Value, &taxVoucher)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal tax voucher: %v", err)
+		}
+		taxVouchers = append(taxVouchers, &taxVoucher)
+	}
+
+	return taxVouchers, nil
+}
+
+// GetHolderPayment returns a per-holder coupon payment by ID
+func (ca *CorporateAction) GetHolderPayment(ctx contractapi.TransactionContextInterface, paymentID string) (*HolderPayment, error) {
+	idKey, err := ctx.GetStub().CreateCompositeKey(holderPaymentIDIndex, []string{paymentID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create holder payment ID index key: %v", err)
+	}
+
+	key, err := ctx.GetStub().GetState(idKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holder payment ID index: %v", err)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("holder payment %s does not exist", paymentID)
+	}
+
+	holderPaymentJSON, err := ctx.GetStub().GetState(string(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holder payment: %v", err)
+	}
+	if holderPaymentJSON == nil {
+		return nil, fmt.Errorf("holder payment %s does not exist", paymentID)
+	}
+
+	var holderPayment HolderPayment
+	err = json.Unmarshal(holderPaymentJSON, &holderPayment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal holder payment: %v", err)
+	}
+
+	return &holderPayment, nil
+}
+
+// CancelRedemption cancels a redemption that has not been completed. Only the
+// paying agent may cancel a redemption.
+func (ca *CorporateAction) CancelRedemption(ctx contractapi.TransactionContextInterface, redemptionID, reason string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("cancellation reason is required")
+	}
+
+	redemption, err := ca.GetRedemption(ctx, redemptionID)
+	if err != nil {
+		return fmt.Errorf("failed to get redemption: %v", err)
+	}
+
+	switch redemption.Status {
+	case "PENDING", "FAILED":
+	default:
+		return fmt.Errorf("redemption %s cannot be cancelled: %s", redemptionID, redemption.Status)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	redemption.Status = "CANCELLED"
+	if redemption.Metadata == nil {
+		redemption.Metadata = make(map[string]string)
+	}
+	redemption.Metadata["cancelReason"] = reason
+
+	err = putRedemption(ctx, redemption)
+	if err != nil {
+		return fmt.Errorf("failed to update redemption: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "REDEMPTION_CANCELLED",
+		BondID:    redemption.BondID,
+		Details:   fmt.Sprintf("Redemption %s cancelled: %s", redemptionID, reason),
+		Amount:    redemption.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GenerateAmortizationSchedule creates a PENDING amortization payment for
+// every step of the bond's principal repayment schedule that has not been
+// applied, linked to the scheduled coupon on the same date. Payments that
+// already exist are left untouched, so the call can be repeated safely.
+func (ca *CorporateAction) GenerateAmortizationSchedule(ctx contractapi.TransactionContextInterface, bondID string) ([]*AmortizationPayment, error) {
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if bond.Status != "ACTIVE" {
+		return nil, fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+	if len(bond.Amortization) == 0 {
+		return nil, fmt.Errorf("bond %s has no amortization schedule", bondID)
+	}
+
+	couponPayments, err := ca.GetCouponPaymentsByBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []*AmortizationPayment
+	for _, entry := range bond.Amortization {
+		if entry.Applied {
+			continue
+		}
+
+		amortizationID := amortizationIDFor(bondID, entry.Date)
+		existing, err := getIndexed(ctx, amortizationObjectType, amortizationID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			continue
+		}
+
+		amortization := &AmortizationPayment{
+			ID:             amortizationID,
+			BondID:         bondID,
+			PaymentDate:    entry.Date,
+			AmountPerToken: entry.Amount,
+			Amount:         roundAmount(entry.Amount * float64(bond.TotalSupply)),
+			Status:         "PENDING",
+			TxID:           ctx.GetStub().GetTxID(),
+		}
+		for _, couponPayment := range couponPayments {
+			if couponPayment.PaymentDate.Equal(entry.Date) || couponPayment.PeriodEnd.Equal(entry.Date) {
+				amortization.CouponID = couponPayment.ID
+				break
+			}
+		}
+
+		err = putAmortizationPayment(ctx, amortization)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store amortization payment: %v", err)
+		}
+		created = append(created, amortization)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "AMORTIZATION_SCHEDULE_GENERATED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("%d amortization payments scheduled for bond %s", len(created), bondID),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// ProcessAmortization pays a due amortization payment: it applies the
+// principal reduction in the BondToken contract, pays the linked coupon if
+// it is still pending, and scales the pending coupons of later periods down
+// to the reduced outstanding principal. Only the paying agent may process
+// payments.
+func (ca *CorporateAction) ProcessAmortization(ctx contractapi.TransactionContextInterface, amortizationID string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	processedBy, err := invokerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	amortization, err := ca.GetAmortizationPayment(ctx, amortizationID)
+	if err != nil {
+		return err
+	}
+
+	if amortization.Status != "PENDING" {
+		return fmt.Errorf("amortization payment %s is not pending", amortizationID)
+	}
+
+	err = requireNotInDefault(ctx, amortization.BondID)
+	if err != nil {
+		return err
+	}
+
+	bond, err := getBond(ctx, amortization.BondID)
+	if err != nil {
+		return err
+	}
+	principalBefore := outstandingPrincipal(bond)
+
+	// The coupon accrued on the principal before this repayment, so it is
+	// paid before the bond is amortized
+	if amortization.CouponID != "" {
+		couponPayment, err := ca.GetCouponPayment(ctx, amortization.CouponID)
+		if err != nil {
+			return fmt.Errorf("failed to get coupon payment: %v", err)
+		}
+		if couponPayment.Status == "PENDING" {
+			err = ca.ProcessCouponPayment(ctx, amortization.CouponID)
+			if err != nil {
+				return fmt.Errorf("failed to pay coupon %s: %v", amortization.CouponID, err)
+			}
+		}
+	}
+
+	args := [][]byte{[]byte("ApplyAmortization"), []byte(amortization.BondID), []byte(amortization.PaymentDate.Format("2006-01-02"))}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to apply amortization to bond %s: %s", amortization.BondID, response.Message)
+	}
+
+	if principalBefore > 0 {
+		err = ca.rescalePendingCoupons(ctx, amortization.BondID, amortization.PaymentDate, (principalBefore-amortization.AmountPerToken)/principalBefore)
+		if err != nil {
+			return err
+		}
+	}
+
+	instruction, err := ca.paymentInstruction(ctx, amortizationID, amortization.BondID, "Amortization", amortization.Amount, amortization.PaymentDate, nil, EntitlementInfo{})
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	amortization.Status = "PAID"
+	amortization.PaidAt = txTime
+	amortization.TxID = ctx.GetStub().GetTxID()
+	amortization.ProcessedBy = processedBy
+
+	err = putAmortizationPayment(ctx, amortization)
+	if err != nil {
+		return fmt.Errorf("failed to update amortization payment: %v", err)
+	}
+
+	err = accrueAgencyFee(ctx, amortization.BondID, amortizationObjectType, amortizationID, amortization.Amount, processedBy)
+	if err != nil {
+		return err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "AMORTIZATION_PROCESSED",
+		BondID:    amortization.BondID,
+		Details:   fmt.Sprintf("Amortization payment %s processed", amortizationID),
+		Amount:    amortization.Amount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+
+		PaymentInstruction: instruction,
+	}
+	if amortization.CouponID != "" {
+		event.Details = fmt.Sprintf("Amortization payment %s processed with coupon %s", amortizationID, amortization.CouponID)
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAmortizationPayment retrieves an amortization payment
+func (ca *CorporateAction) GetAmortizationPayment(ctx contractapi.TransactionContextInterface, amortizationID string) (*AmortizationPayment, error) {
+	amortizationJSON, err := getIndexed(ctx, amortizationObjectType, amortizationID)
+	if err != nil {
+		return nil, err
+	}
+	if amortizationJSON == nil {
+		return nil, fmt.Errorf("amortization payment %s does not exist", amortizationID)
+	}
+
+	var amortization AmortizationPayment
+	err = json.Unmarshal(amortizationJSON, &amortization)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal amortization payment: %v", err)
+	}
+
+	return &amortization, nil
+}
+
+// GetAmortizationPaymentsByBond returns all amortization payments for a
+// bond, in payment date order
+func (ca *CorporateAction) GetAmortizationPaymentsByBond(ctx contractapi.TransactionContextInterface, bondID string) ([]*AmortizationPayment, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(amortizationObjectType, []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get amortization payments: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var amortizations []*AmortizationPayment
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var amortization AmortizationPayment
+		err = json.Unmarshal(queryResult.Value, &amortization)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal amortization payment: %v", err)
+		}
+		amortizations = append(amortizations, &amortization)
+	}
+
+	return amortizations, nil
+}
+
+// AccrueInterest posts a bond's interest accrual for the day asOfDateStr
+// (YYYY-MM-DD): the interest accrued since the start of the current coupon
+// period up to the end of that day and the part accrued on the day itself.
+// With perHolder the posting is also split across the holders at the close
+// of the day, with tap lots accruing from their settlement date. Each day can
+// be posted once.
+func (ca *CorporateAction) AccrueInterest(ctx contractapi.TransactionContextInterface, bondID, asOfDateStr string, perHolder bool) (*AccrualPosting, error) {
+	asOfDate, err := time.Parse("2006-01-02", asOfDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid as-of date format: %v", err)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if asOfDate.After(txTime) {
+		return nil, fmt.Errorf("as-of date %s is in the future", asOfDateStr)
+	}
+	if perHolder && txTime.Before(asOfDate.AddDate(0, 0, 1)) {
+		return nil, fmt.Errorf("holdings on %s have not closed yet", asOfDateStr)
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if bond.Status != "ACTIVE" {
+		return nil, fmt.Errorf("bond %s is not active: %s", bondID, bond.Status)
+	}
+	if bond.BondType == "ZERO_COUPON" {
+		return nil, fmt.Errorf("bond %s is a zero-coupon bond and pays no coupons", bondID)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey("ACCRUAL", []string{bondID, asOfDate.Format("20060102")})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create accrual key: %v", err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accrual posting: %v", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("interest on bond %s has already been accrued for %s", bondID, asOfDateStr)
+	}
+
+	holidays, err := bondHolidays(ctx, bond)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the stored coupon when there is one, as rate resets and
+	// restructurings change its amount
+	var coupon *CouponPayment
+	for _, scheduled := range couponSchedule(bond, holidays) {
+		if !asOfDate.Before(scheduled.PeriodStart) && asOfDate.Before(scheduled.PeriodEnd) {
+			coupon = scheduled
+			break
+		}
+	}
+	if coupon == nil {
+		return nil, fmt.Errorf("no coupon period of bond %s covers %s", bondID, asOfDateStr)
+	}
+	storedJSON, err := getIndexed(ctx, couponObjectType, coupon.ID)
+	if err != nil {
+		return nil, err
+	}
+	if storedJSON != nil {
+		var stored CouponPayment
+		err = json.Unmarshal(storedJSON, &stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal coupon payment: %v", err)
+		}
+		if !stored.PeriodStart.IsZero() {
+			coupon = &stored
+		}
+	}
+
+	// A single token accrues the fraction of the coupon accrued so far
+	dayEnd := asOfDate.AddDate(0, 0, 1)
+	whole := &HolderInfo{Quantity: 1}
+	posting := &AccrualPosting{
+		BondID:        bondID,
+		Date:          asOfDate,
+		CouponID:      coupon.ID,
+		PeriodStart:   coupon.PeriodStart,
+		PeriodEnd:     coupon.PeriodEnd,
+		DayCount:      coupon.DayCount,
+		CouponAmount:  coupon.Amount,
+		AccruedAmount: roundAmount(coupon.Amount * accruedQuantity(whole, coupon, dayEnd)),
+		TxID:          ctx.GetStub().GetTxID(),
+	}
+	posting.DailyAmount = roundAmount(posting.AccruedAmount - roundAmount(coupon.Amount*accruedQuantity(whole, coupon, asOfDate)))
+
+	if perHolder {
+		holders, err := holdersAsOf(ctx, bondID, asOfDate)
+		if err != nil {
+			return nil, err
+		}
+		var totalQuantity int64
+		for _, holder := range holders {
+			totalQuantity += holder.Quantity
+		}
+		if totalQuantity == 0 {
+			return nil, fmt.Errorf("bond %s had no holders on %s", bondID, asOfDateStr)
+		}
+		for _, holder := range holders {
+			if holder.Quantity <= 0 {
+				continue
+			}
+			accrued := roundAmount(coupon.Amount * accruedQuantity(holder, coupon, dayEnd) / float64(totalQuantity))
+			previous := roundAmount(coupon.Amount * accruedQuantity(holder, coupon, asOfDate) / float64(totalQuantity))
+			posting.Holders = append(posting.Holders, &HolderAccrual{
+				Address:       holder.Address,
+				Quantity:      holder.Quantity,
+				AccruedAmount: accrued,
+				DailyAmount:   roundAmount(accrued - previous),
+			})
+		}
+	}
+
+	postingJSON, err := json.Marshal(posting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal accrual posting: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, postingJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store accrual posting: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "INTEREST_ACCRUED",
+		BondID:    bondID,
+		Details:   fmt.Sprintf("Interest on bond %s accrued for %s", bondID, asOfDateStr),
+		Amount:    posting.DailyAmount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return posting, nil
+}
+
+// GetAccrualPostings returns a bond's accrual postings dated from
+// fromDateStr to toDateStr inclusive (YYYY-MM-DD), in date order
+func (ca *CorporateAction) GetAccrualPostings(ctx contractapi.TransactionContextInterface, bondID, fromDateStr, toDateStr string) ([]*AccrualPosting, error) {
+	fromDate, err := time.Parse("2006-01-02", fromDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date format: %v", err)
+	}
+	toDate, err := time.Parse("2006-01-02", toDateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date format: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("ACCRUAL", []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accrual postings: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	postings := []*AccrualPosting{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var posting AccrualPosting
+		err = json.Unmarshal(queryResult.Value, &posting)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal accrual posting: %v", err)
+		}
+		if posting.Date.Before(fromDate) || posting.Date.After(toDate) {
+			continue
+		}
+		postings = append(postings, &posting)
+	}
+
+	return postings, nil
+}
+
+// GetActionHistory returns every status change of a coupon payment,
+// redemption or amortization payment from the ledger history of its record,
+// oldest first, with the transaction and the MSP of the client that made it.
+// Records written before the invoker MSP was tracked have no InvokerMSP.
+func (ca *CorporateAction) GetActionHistory(ctx contractapi.TransactionContextInterface, actionID string) ([]*ActionHistoryEntry, error) {
+	var key []byte
+	for _, objectType := range []string{couponObjectType, redemptionObjectType, amortizationObjectType} {
+		idKey, err := ctx.GetStub().CreateCompositeKey(objectType+"ID", []string{actionID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s ID index key: %v", strings.ToLower(objectType), err)
+		}
+		key, err = ctx.GetStub().GetState(idKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s ID index: %v", strings.ToLower(objectType), err)
+		}
+		if key != nil {
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("corporate action %s does not exist", actionID)
+	}
+
+	historyIterator, err := ctx.GetStub().GetHistoryForKey(string(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get action history: %v", err)
+	}
+	defer historyIterator.Close()
+
+	var modifications []*ActionHistoryEntry
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate history: %v", err)
+		}
+
+		entry := &ActionHistoryEntry{
+			ActionID:  actionID,
+			Status:    "DELETED",
+			TxID:      modification.TxId,
+			Timestamp: time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC(),
+		}
+		if !modification.IsDelete {
+			var record struct {
+				Status       string `json:"status"`
+				Version      int64  `json:"version"`
+				UpdatedByMSP string `json:"updatedByMsp"`
+			}
+			err = json.Unmarshal(modification.Value, &record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal history record: %v", err)
+			}
+			entry.Status = record.Status
+			entry.Version = record.Version
+			entry.InvokerMSP = record.UpdatedByMSP
+		}
+		modifications = append(modifications, entry)
+	}
+
+	sort.SliceStable(modifications, func(i, j int) bool {
+		return modifications[i].Timestamp.Before(modifications[j].Timestamp)
+	})
+
+	history := []*ActionHistoryEntry{}
+	for _, entry := range modifications {
+		previous := ""
+		if len(history) > 0 {
+			previous = history[len(history)-1].Status
+		}
+		if entry.Status == previous {
+			continue
+		}
+		entry.PreviousStatus = previous
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
+
+// GetCouponPayment retrieves a coupon payment
+func (ca *CorporateAction) GetCouponPayment(ctx contractapi.TransactionContextInterface, couponID string) (*CouponPayment, error) {
+	couponJSON, err := getIndexed(ctx, couponObjectType, couponID)
+	if err != nil {
+		return nil, err
+	}
+	if couponJSON == nil {
+		return nil, fmt.Errorf("coupon payment %s does not exist", couponID)
+	}
+
+	var couponPayment CouponPayment
+	err = json.Unmarshal(couponJSON, &couponPayment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal coupon payment: %v", err)
+	}
+
+	return &couponPayment, nil
+}
+
+// GetRedemption retrieves a redemption
+func (ca *CorporateAction) GetRedemption(ctx contractapi.TransactionContextInterface, redemptionID string) (*Redemption, error) {
+	redemptionJSON, err := getIndexed(ctx, redemptionObjectType, redemptionID)
+	if err != nil {
+		return nil, err
+	}
+	if redemptionJSON == nil {
+		return nil, fmt.Errorf("redemption %s does not exist", redemptionID)
+	}
+
+	var redemption Redemption
+	err = json.Unmarshal(redemptionJSON, &redemption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal redemption: %v", err)
+	}
+
+	return &redemption, nil
+}
+
+// GetCouponPaymentsByBond returns all coupon payments for a specific bond,
+// in payment date order
+func (ca *CorporateAction) GetCouponPaymentsByBond(ctx contractapi.TransactionContextInterface, bondID string) ([]*CouponPayment, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(couponObjectType, []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon payments: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var couponPayments []*CouponPayment
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var couponPayment CouponPayment
+		err = json.Unmarshal(queryResult.Value, &couponPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal coupon payment: %v", err)
+		}
+		couponPayments = append(couponPayments, &couponPayment)
+	}
+
+	return couponPayments, nil
+}
+
+// GetRedemptionsByBond returns all redemptions for a specific bond, in
+// redemption date order
+func (ca *CorporateAction) GetRedemptionsByBond(ctx contractapi.TransactionContextInterface, bondID string) ([]*Redemption, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(redemptionObjectType, []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get redemptions: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var redemptions []*Redemption
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var redemption Redemption
+		err = json.Unmarshal(queryResult.Value, &redemption)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal redemption: %v", err)
+		}
+		redemptions = append(redemptions, &redemption)
+	}
+
+	return redemptions, nil
+}
+
+// GetPendingCouponPayments returns all pending coupon payments, in payment
+// date order
+func (ca *CorporateAction) GetPendingCouponPayments(ctx contractapi.TransactionContextInterface) ([]*CouponPayment, error) {
+	return getCouponPaymentsByStatus(ctx, "PENDING")
+}
+
+// GetFailedPayments returns all coupon payments whose cash leg has failed
+// and not yet been retried
+func (ca *CorporateAction) GetFailedPayments(ctx contractapi.TransactionContextInterface) ([]*CouponPayment, error) {
+	return getCouponPaymentsByStatus(ctx, "FAILED")
+}
+
+// GetPendingRedemptions returns all pending redemptions, in redemption date
+// order
+func (ca *CorporateAction) GetPendingRedemptions(ctx contractapi.TransactionContextInterface) ([]*Redemption, error) {
+	records, err := getIndexedByStatus(ctx, redemptionStatusIndex, "PENDING")
+	if err != nil {
+		return nil, err
+	}
+
+	var redemptions []*Redemption
+	for _, redemptionJSON := range records {
+		var redemption Redemption
+		err = json.Unmarshal(redemptionJSON, &redemption)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal redemption: %v", err)
+		}
+		redemptions = append(redemptions, &redemption)
+	}
+
+	return redemptions, nil
+}
+
+// GetCouponPaymentsWithPagination returns one page of the coupon payments
+// with a status, in payment date order. An empty status means PENDING. Pass
+// the returned bookmark to fetch the next page; it is empty on the last page.
+func (ca *CorporateAction) GetCouponPaymentsWithPagination(ctx contractapi.TransactionContextInterface, status string, pageSize int32, bookmark string) (*CouponPaymentPage, error) {
+	if status == "" {
+		status = "PENDING"
+	}
+
+	records, count, nextBookmark, err := getIndexedPage(ctx, couponStatusIndex, status, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &CouponPaymentPage{CouponPayments: []*CouponPayment{}, Count: count, Bookmark: nextBookmark}
+	for _, couponJSON := range records {
+		var couponPayment CouponPayment
+		err = json.Unmarshal(couponJSON, &couponPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal coupon payment: %v", err)
+		}
+		page.CouponPayments = append(page.CouponPayments, &couponPayment)
+	}
+
+	return page, nil
+}
+
+// GetRedemptionsWithPagination returns one page of the redemptions with a
+// status, in redemption date order. An empty status means PENDING. Pass the
+// returned bookmark to fetch the next page; it is empty on the last page.
+func (ca *CorporateAction) GetRedemptionsWithPagination(ctx contractapi.TransactionContextInterface, status string, pageSize int32, bookmark string) (*RedemptionPage, error) {
+	if status == "" {
+		status = "PENDING"
+	}
+
+	records, count, nextBookmark, err := getIndexedPage(ctx, redemptionStatusIndex, status, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &RedemptionPage{Redemptions: []*Redemption{}, Count: count, Bookmark: nextBookmark}
+	for _, redemptionJSON := range records {
+		var redemption Redemption
+		err = json.Unmarshal(redemptionJSON, &redemption)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal redemption: %v", err)
+		}
+		page.Redemptions = append(page.Redemptions, &redemption)
+	}
+
+	return page, nil
+}
+
+// ActionQuery holds the filters of QueryActions; empty fields match any
+// value
+type ActionQuery struct {
+	Type      string  `json:"type"` // "COUPON", "REDEMPTION", "AMORTIZATION"
+	Status    string  `json:"status"`
+	BondID    string  `json:"bondId"`
+	FromDate  string  `json:"fromDate"` // "2006-01-02", inclusive
+	ToDate    string  `json:"toDate"`   // "2006-01-02", inclusive
+	MinAmount float64 `json:"minAmount"`
+	MaxAmount float64 `json:"maxAmount"`
+}
+
+// QueriedAction is a coupon payment, redemption or amortization payment
+// matched by QueryActions, with the full record in Record
+type QueriedAction struct {
+	Type   string          `json:"type"`
+	ID     string          `json:"id"`
+	BondID string          `json:"bondId"`
+	Date   time.Time       `json:"date"`
+	Amount float64         `json:"amount"`
+	Status string          `json:"status"`
+	Record json.RawMessage `json:"record"`
+}
+
+// ActionQueryResult is a page of QueryActions results
+type ActionQueryResult struct {
+	Actions  []*QueriedAction `json:"actions"`
+	Count    int32            `json:"count"`
+	Bookmark string           `json:"bookmark"`
+}
+
+// MigrationResult reports the progress of a state key migration
+type MigrationResult struct {
+	CouponPayments int    `json:"couponPayments"`
+	Redemptions    int    `json:"redemptions"`
+	Skipped        int    `json:"skipped"`
+	Bookmark       string `json:"bookmark"`
+}
+
+// QueryActions finds coupon payments, redemptions and amortization payments
+// with a CouchDB selector built from queryJSON, a JSON-encoded ActionQuery,
+// using the indexes shipped under META-INF/statedb/couchdb/indexes. The date
+// range applies to the payment or redemption date. It requires a CouchDB
+// state database.
+func (ca *CorporateAction) QueryActions(ctx contractapi.TransactionContextInterface, queryJSON string, pageSize int32, bookmark string) (*ActionQueryResult, error) {
+	var query ActionQuery
+	if queryJSON != "" {
+		err := json.Unmarshal([]byte(queryJSON), &query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid action query: %v", err)
+		}
+	}
+
+	queryString, err := actionQueryString(query)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query actions: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	result := &ActionQueryResult{Actions: []*QueriedAction{}}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var record struct {
+			DocType        string    `json:"docType"`
+			ID             string    `json:"id"`
+			BondID         string    `json:"bondId"`
+			PaymentDate    time.Time `json:"paymentDate"`
+			RedemptionDate time.Time `json:"redemptionDate"`
+			Amount         float64   `json:"amount"`
+			Status         string    `json:"status"`
+		}
+		err = json.Unmarshal(queryResult.Value, &record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal action: %v", err)
+		}
+
+		action := &QueriedAction{
+			Type:   record.DocType,
+			ID:     record.ID,
+			BondID: record.BondID,
+			Date:   record.PaymentDate,
+			Amount: record.Amount,
+			Status: record.Status,
+			Record: json.RawMessage(queryResult.Value),
+		}
+		if record.DocType == redemptionObjectType {
+			action.Date = record.RedemptionDate
+		}
+		result.Actions = append(result.Actions, action)
+	}
+
+	result.Count = metadata.FetchedRecordsCount
+	if metadata.FetchedRecordsCount == pageSize {
+		result.Bookmark = metadata.Bookmark
+	}
+
+	return result, nil
+}
+
+// MigrateStateKeys moves coupon payments and redemptions stored under their
+// legacy flat ID keys to the composite keys and indexes used by the queries
+// above. It processes up to pageSize legacy records per call; keep calling
+// with the returned bookmark, the key to resume from, until it is empty.
+// Only the paying agent may migrate state.
+func (ca *CorporateAction) MigrateStateKeys(ctx contractapi.TransactionContextInterface, pageSize int32, bookmark string) (*MigrationResult, error) {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	// Paginated queries are read-only, so the page is cut from a plain range
+	// query, which also leaves out composite keys and so only sees records
+	// still stored under flat keys
+	resultsIterator, err := ctx.GetStub().GetStateByRange(bookmark, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get state by range: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	result := &MigrationResult{}
+	var fetched int32
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+		if fetched == pageSize {
+			result.Bookmark = queryResult.Key
+			break
+		}
+		fetched++
+
+		if strings.HasPrefix(queryResult.Key, "COUPON_") {
+			var couponPayment CouponPayment
+			err = json.Unmarshal(queryResult.Value, &couponPayment)
+			if err != nil || couponPayment.ID != queryResult.Key {
+				result.Skipped++
+				continue
+			}
+			err = putCouponPayment(ctx, &couponPayment)
+			result.CouponPayments++
+		} else if strings.HasPrefix(queryResult.Key, "REDEMPTION_") {
+			var redemption Redemption
+			err = json.Unmarshal(queryResult.Value, &redemption)
+			if err != nil || redemption.ID != queryResult.Key {
+				result.Skipped++
+				continue
+			}
+			err = putRedemption(ctx, &redemption)
+			result.Redemptions++
+		} else {
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = ctx.GetStub().DelState(queryResult.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete legacy record: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// GetDueActions returns the pending coupon payments, redemptions and
+// amortization payments due within withinDays of the transaction timestamp,
+// including any overdue ones, sorted by due date
+func (ca *CorporateAction) GetDueActions(ctx contractapi.TransactionContextInterface, withinDays int) ([]*DueAction, error) {
+	if withinDays < 0 {
+		return nil, fmt.Errorf("withinDays cannot be negative")
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	horizon := txTime.AddDate(0, 0, withinDays)
+
+	couponPayments, err := ca.GetPendingCouponPayments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	redemptions, err := ca.GetPendingRedemptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dueActions := []*DueAction{}
+	for _, couponPayment := range couponPayments {
+		if couponPayment.PaymentDate.After(horizon) {
+			continue
+		}
+		dueActions = append(dueActions, &DueAction{
+			Type:    "COUPON",
+			ID:      couponPayment.ID,
+			BondID:  couponPayment.BondID,
+			DueDate: couponPayment.PaymentDate,
+			Amount:  couponPayment.Amount,
+			Overdue: couponPayment.PaymentDate.Before(txTime),
+		})
+	}
+	for _, redemption := range redemptions {
+		if redemption.RedemptionDate.After(horizon) {
+			continue
+		}
+		dueActions = append(dueActions, &DueAction{
+			Type:    "REDEMPTION",
+			ID:      redemption.ID,
+			BondID:  redemption.BondID,
+			DueDate: redemption.RedemptionDate,
+			Amount:  redemption.Amount,
+			Overdue: redemption.RedemptionDate.Before(txTime),
+		})
+	}
+
+	amortizations, err := getIndexedByStatus(ctx, amortizationStatusIndex, "PENDING")
+	if err != nil {
+		return nil, err
+	}
+	for _, amortizationJSON := range amortizations {
+		var amortization AmortizationPayment
+		err = json.Unmarshal(amortizationJSON, &amortization)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal amortization payment: %v", err)
+		}
+		if amortization.PaymentDate.After(horizon) {
+			continue
+		}
+		dueActions = append(dueActions, &DueAction{
+			Type:    "AMORTIZATION",
+			ID:      amortization.ID,
+			BondID:  amortization.BondID,
+			DueDate: amortization.PaymentDate,
+			Amount:  amortization.Amount,
+			Overdue: amortization.PaymentDate.Before(txTime),
+		})
+	}
+
+	sortDueActions(dueActions)
+	return dueActions, nil
+}
+
+// SetPaymentAccount designates the cash-token account the issuer funds a
+// bond's coupon payments into. Only the paying agent may set it.
+func (ca *CorporateAction) SetPaymentAccount(ctx contractapi.TransactionContextInterface, bondID, account string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	if account == "" {
+		return fmt.Errorf("payment account is required")
+	}
+
+	_, err = getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	paymentAccount := PaymentAccount{
+		BondID:    bondID,
+		Account:   account,
+		UpdatedAt: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	paymentAccountJSON, err := json.Marshal(paymentAccount)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payment account: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(paymentAccountKey(bondID), paymentAccountJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store payment account: %v", err)
+	}
+
+	return nil
+}
+
+// GetPaymentAccount returns the payment account designated for a bond
+func (ca *CorporateAction) GetPaymentAccount(ctx contractapi.TransactionContextInterface, bondID string) (*PaymentAccount, error) {
+	paymentAccount, err := getPaymentAccount(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if paymentAccount == nil {
+		return nil, fmt.Errorf("bond %s has no payment account", bondID)
+	}
+
+	return paymentAccount, nil
+}
+
+// SetAgencyFeeSchedule sets the fees the paying agent accrues for each
+// coupon payment, redemption or redemption instalment and amortization
+// payment it processes on a bond, given as JSON with a currency and a flat
+// amount and basis points per action type. Actions processed before the
+// schedule was set accrue no fee. Only the trustee may set it.
+func (ca *CorporateAction) SetAgencyFeeSchedule(ctx contractapi.TransactionContextInterface, bondID, scheduleJSON string) (*AgencyFeeSchedule, error) {
+	err := requireRole(ctx, trusteeRole)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule AgencyFeeSchedule
+	err = json.Unmarshal([]byte(scheduleJSON), &schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fee schedule: %v", err)
+	}
+
+	if schedule.Currency == "" {
+		return nil, fmt.Errorf("fee currency is required")
+	}
+	if len(schedule.Fees) == 0 {
+		return nil, fmt.Errorf("fee schedule has no fees")
+	}
+	for actionType, rate := range schedule.Fees {
+		if actionType != couponObjectType && actionType != redemptionObjectType && actionType != amortizationObjectType {
+			return nil, fmt.Errorf("invalid action type: %s", actionType)
+		}
+		if rate.Flat < 0 || rate.BasisPoints < 0 {
+			return nil, fmt.Errorf("%s fee cannot be negative", actionType)
+		}
+	}
+
+	_, err = getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.BondID = bondID
+	schedule.UpdatedAt = txTime
+	schedule.TxID = ctx.GetStub().GetTxID()
+
+	scheduleBytes, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fee schedule: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(agencyFeeScheduleKey(bondID), scheduleBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store fee schedule: %v", err)
+	}
+
+	return &schedule, nil
+}
+
+// GetAgencyFeeSchedule returns the agency fee schedule of a bond
+func (ca *CorporateAction) GetAgencyFeeSchedule(ctx contractapi.TransactionContextInterface, bondID string) (*AgencyFeeSchedule, error) {
+	schedule, err := getAgencyFeeSchedule(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		return nil, fmt.Errorf("bond %s has no agency fee schedule", bondID)
+	}
+
+	return schedule, nil
+}
+
+// GetAgencyFees returns the agency fees accrued on a bond in a period, given
+// as "YYYY", "YYYY-Qn" or "YYYY-MM", in the order the actions were processed,
+// so the paying agent's invoice can be reconciled to the ledger
+func (ca *CorporateAction) GetAgencyFees(ctx contractapi.TransactionContextInterface, bondID, period string) (*AgencyFeeStatement, error) {
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(agencyFeeObjectType, []string{bondID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agency fees: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	statement := &AgencyFeeStatement{
+		BondID:   bondID,
+		Period:   period,
+		From:     from,
+		To:       to,
+		Accruals: []*AgencyFeeAccrual{},
+	}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var accrual AgencyFeeAccrual
+		err = json.Unmarshal(queryResponse.Value, &accrual)
+		if err != nil {
+			return nil, err
+		}
+		if accrual.AccruedAt.Before(from) || !accrual.AccruedAt.Before(to) {
+			continue
+		}
+
+		if statement.Currency == "" {
+			statement.Currency = accrual.Currency
+		} else if accrual.Currency != statement.Currency {
+			return nil, fmt.Errorf("agency fees of bond %s are accrued in both %s and %s", bondID, statement.Currency, accrual.Currency)
+		}
+		statement.Accruals = append(statement.Accruals, &accrual)
+		statement.Total = roundAmount(statement.Total + accrual.Amount)
+	}
+
+	return statement, nil
+}
+
+// SetHolidayCalendar creates or replaces a named holiday calendar, given
+// its description and holidays as a JSON array of YYYY-MM-DD dates. Bonds
+// refer to calendars by name in their terms. expectedVersion is the version
+// the caller last read, or 0 to skip the check. Only the paying agent may
+// maintain calendars.
+func (ca *CorporateAction) SetHolidayCalendar(ctx contractapi.TransactionContextInterface, name, description, holidaysJSON string, expectedVersion int64) (*HolidayCalendar, error) {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" || strings.ToUpper(name) != name || strings.ContainsAny(name, " _") {
+		return nil, fmt.Errorf("invalid calendar name %q: use an upper-case code such as USNY", name)
+	}
+
+	var dates []string
+	err = json.Unmarshal([]byte(holidaysJSON), &dates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid holidays: %v", err)
+	}
+	holidays := make(map[string]bool)
+	for _, date := range dates {
+		_, err = time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday %q: %v", date, err)
+		}
+		holidays[date] = true
+	}
+
+	calendar, err := getHolidayCalendar(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if calendar == nil {
+		calendar = &HolidayCalendar{Name: name}
+	}
+	err = checkVersion("holiday calendar "+name, calendar.Version, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar.Description = description
+	calendar.Holidays = make([]string, 0, len(holidays))
+	for date := range holidays {
+		calendar.Holidays = append(calendar.Holidays, date)
+	}
+	sort.Strings(calendar.Holidays)
+	calendar.Version++
+	calendar.UpdatedAt = txTime
+	calendar.TxID = ctx.GetStub().GetTxID()
+
+	err = putHolidayCalendar(ctx, calendar)
+	if err != nil {
+		return nil, err
+	}
+
+	return calendar, nil
+}
+
+// GetHolidayCalendar returns a holiday calendar
+func (ca *CorporateAction) GetHolidayCalendar(ctx contractapi.TransactionContextInterface, name string) (*HolidayCalendar, error) {
+	calendar, err := getHolidayCalendar(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if calendar == nil {
+		return nil, fmt.Errorf("holiday calendar %s does not exist", name)
+	}
+
+	return calendar, nil
+}
+
+// GetHolidayCalendars returns all holiday calendars in name order
+func (ca *CorporateAction) GetHolidayCalendars(ctx contractapi.TransactionContextInterface) ([]*HolidayCalendar, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holidayCalendarObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holiday calendars: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	calendars := []*HolidayCalendar{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var calendar HolidayCalendar
+		err = json.Unmarshal(queryResult.Value, &calendar)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal holiday calendar: %v", err)
+		}
+		calendars = append(calendars, &calendar)
+	}
+
+	return calendars, nil
+}
+
+// DeleteHolidayCalendar deletes a holiday calendar. Payment dates of bonds
+// that still refer to it can no longer be generated or validated until it
+// is recreated or removed from their terms. Only the paying agent may
+// maintain calendars.
+func (ca *CorporateAction) DeleteHolidayCalendar(ctx contractapi.TransactionContextInterface, name string) error {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return err
+	}
+
+	calendar, err := getHolidayCalendar(ctx, name)
+	if err != nil {
+		return err
+	}
+	if calendar == nil {
+		return fmt.Errorf("holiday calendar %s does not exist", name)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(holidayCalendarObjectType, []string{name})
+	if err != nil {
+		return fmt.Errorf("failed to create holiday calendar key: %v", err)
+	}
+
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete holiday calendar: %v", err)
+	}
+
+	return nil
+}
+
+// SetGracePeriod sets how many days a bond's coupons may stay unpaid past
+// their payment date and the annual penalty rate, in percent, accrued on
+// them afterwards. Only the trustee may set it.
+func (ca *CorporateAction) SetGracePeriod(ctx contractapi.TransactionContextInterface, bondID string, days int, penaltyRate float64) error {
+	err := requireRole(ctx, trusteeRole)
+	if err != nil {
+		return err
+	}
+
+	if days < 0 {
+		return fmt.Errorf("grace period cannot be negative")
+	}
+	if penaltyRate < 0 || penaltyRate > 100 {
+		return fmt.Errorf("penalty rate must be between 0 and 100 percent")
+	}
+
+	_, err = getBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	gracePeriod := GracePeriod{
+		BondID:      bondID,
+		Days:        days,
+		PenaltyRate: penaltyRate,
+		UpdatedAt:   txTime,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+
+	gracePeriodJSON, err := json.Marshal(gracePeriod)
+	if err != nil {
+		return fmt.Errorf("failed to marshal grace period: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(gracePeriodKey(bondID), gracePeriodJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store grace period: %v", err)
+	}
+
+	return nil
+}
+
+// GetOverdueActions returns the pending or failed coupon payments and the
+// pending redemptions whose due date has passed, with how long they are
+// overdue and whether they are still within their bond's grace period,
+// sorted by due date
+func (ca *CorporateAction) GetOverdueActions(ctx contractapi.TransactionContextInterface) ([]*OverdueAction, error) {
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := ca.GetPendingCouponPayments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	failed, err := ca.GetFailedPayments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	redemptions, err := ca.GetPendingRedemptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gracePeriods := make(map[string]*GracePeriod)
+	overdue := func(actionType, id, bondID, status string, dueDate time.Time, amount, penalty float64) (*OverdueAction, error) {
+		gracePeriod, ok := gracePeriods[bondID]
+		if !ok {
+			gracePeriod, err = getGracePeriod(ctx, bondID)
+			if err != nil {
+				return nil, err
+			}
+			gracePeriods[bondID] = gracePeriod
+		}
+
+		graceEnd := dueDate.AddDate(0, 0, gracePeriod.Days)
+		return &OverdueAction{
+			Type:            actionType,
+			ID:              id,
+			BondID:          bondID,
+			Status:          status,
+			DueDate:         dueDate,
+			Amount:          amount,
+			DaysOverdue:     int(txTime.Sub(dueDate).Hours() / 24),
+			GraceEnd:        graceEnd,
+			InGrace:         txTime.Before(graceEnd),
+			PenaltyInterest: penalty,
+		}, nil
+	}
+
+	overdueActions := []*OverdueAction{}
+	for _, couponPayment := range append(pending, failed...) {
+		if !couponPayment.PaymentDate.Before(txTime) {
+			continue
+		}
+		action, err := overdue("COUPON", couponPayment.ID, couponPayment.BondID, couponPayment.Status, couponPayment.PaymentDate, couponPayment.Amount, couponPayment.PenaltyInterest)
+		if err != nil {
+			return nil, err
+		}
+		overdueActions = append(overdueActions, action)
+	}
+	for _, redemption := range redemptions {
+		if !redemption.RedemptionDate.Before(txTime) {
+			continue
+		}
+		action, err := overdue("REDEMPTION", redemption.ID, redemption.BondID, redemption.Status, redemption.RedemptionDate, redemption.Amount, 0)
+		if err != nil {
+			return nil, err
+		}
+		overdueActions = append(overdueActions, action)
+	}
+
+	sort.SliceStable(overdueActions, func(i, j int) bool {
+		if !overdueActions[i].DueDate.Equal(overdueActions[j].DueDate) {
+			return overdueActions[i].DueDate.Before(overdueActions[j].DueDate)
+		}
+		return overdueActions[i].ID < overdueActions[j].ID
+	})
+	return overdueActions, nil
+}
+
+// AccruePenaltyInterest brings the penalty interest on an unpaid coupon up
+// to the transaction date. Penalty interest accrues on the coupon amount at
+// the bond's penalty rate, ACT/365, from the end of its grace period, and a
+// PenaltyAccrued event is emitted with the newly accrued amount so the
+// trustee can escalate.
+func (ca *CorporateAction) AccruePenaltyInterest(ctx contractapi.TransactionContextInterface, couponID string) (*CouponPayment, error) {
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+	if couponPayment.Status != "PENDING" && couponPayment.Status != "FAILED" {
+		return nil, fmt.Errorf("coupon payment %s is not unpaid: %s", couponID, couponPayment.Status)
+	}
+
+	gracePeriod, err := getGracePeriod(ctx, couponPayment.BondID)
+	if err != nil {
+		return nil, err
+	}
+	if gracePeriod.PenaltyRate == 0 {
+		return nil, fmt.Errorf("bond %s has no penalty rate", couponPayment.BondID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	accruedTo := time.Date(txTime.Year(), txTime.Month(), txTime.Day(), 0, 0, 0, 0, time.UTC)
+	graceEnd := couponPayment.PaymentDate.AddDate(0, 0, gracePeriod.Days)
+	if !accruedTo.After(graceEnd) {
+		return nil, fmt.Errorf("coupon payment %s is within its grace period until %s", couponID, graceEnd.Format("2006-01-02"))
+	}
+
+	penalty := roundAmount(couponPayment.Amount * gracePeriod.PenaltyRate / 100 * yearFraction(graceEnd, accruedTo, "ACT/365"))
+	accrued := roundAmount(penalty - couponPayment.PenaltyInterest)
+	if accrued <= 0 {
+		return couponPayment, nil
+	}
+
+	couponPayment.PenaltyInterest = penalty
+	couponPayment.PenaltyAccruedTo = accruedTo
+
+	err = putCouponPayment(ctx, couponPayment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update coupon payment: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "PENALTY_ACCRUED",
+		BondID:    couponPayment.BondID,
+		Details:   fmt.Sprintf("Penalty interest on coupon payment %s accrued to %s, %.2f in total", couponID, accruedTo.Format("2006-01-02"), penalty),
+		Amount:    accrued,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "PenaltyAccrued", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return couponPayment, nil
+}
+
+// ProcessDueActions processes, in due date order, the pending amortization
+// payments, coupon payments and then redemptions due on or before asOfDateStr
+// (YYYY-MM-DD, empty for the transaction date), stopping after maxItems have
+// been processed. Actions on bonds in default are skipped and actions that
+// fail are reported without aborting the batch; neither counts towards
+// maxItems, so calling again while More is set always makes progress. A
+// second amortization or redemption of the same bond is left for the next
+// batch, with More set, as BondToken would not see the first one's update.
+// Fabric keeps one event per transaction, so a single summary event replaces
+// the per-action ones. Only the paying agent may process payments.
+func (ca *CorporateAction) ProcessDueActions(ctx contractapi.TransactionContextInterface, asOfDateStr string, maxItems int) (*DueActionBatch, error) {
+	err := requireRole(ctx, payingAgentRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxItems <= 0 {
+		maxItems = 100
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	asOfDate := time.Date(txTime.Year(), txTime.Month(), txTime.Day(), 0, 0, 0, 0, time.UTC)
+	if asOfDateStr != "" {
+		asOfDate, err = time.Parse("2006-01-02", asOfDateStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid as-of date format: %v", err)
+		}
+		if asOfDate.After(txTime) {
+			return nil, fmt.Errorf("as-of date %s is in the future", asOfDateStr)
+		}
+	}
+
+	amortizationIDs, err := dueIndexedIDs(ctx, amortizationStatusIndex, asOfDate)
+	if err != nil {
+		return nil, err
+	}
+	couponIDs, err := dueIndexedIDs(ctx, couponStatusIndex, asOfDate)
+	if err != nil {
+		return nil, err
+	}
+	redemptionIDs, err := dueIndexedIDs(ctx, redemptionStatusIndex, asOfDate)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &DueActionBatch{
+		AsOfDate:  asOfDate,
+		Processed: []*DueActionOutcome{},
+		Failed:    []*DueActionOutcome{},
+		Skipped:   []*DueActionOutcome{},
+	}
+	paidWithAmortization := make(map[string]bool)
+	// Amortizations and redemptions update the bond in the BondToken
+	// contract, which would not see an earlier update in the same batch
+	bondUpdated := make(map[string]bool)
+	process := func(actionType string, ids []string) error {
+		for _, id := range ids {
+			if len(batch.Processed) == maxItems {
+				batch.More = true
+				return nil
+			}
+
+			var bondID, couponID string
+			switch actionType {
+			case "AMORTIZATION":
+				amortization, err := ca.GetAmortizationPayment(ctx, id)
+				if err != nil {
+					return err
+				}
+				bondID, couponID = amortization.BondID, amortization.CouponID
+			case "COUPON":
+				if paidWithAmortization[id] {
+					continue
+				}
+				couponPayment, err := ca.GetCouponPayment(ctx, id)
+				if err != nil {
+					return fmt.Errorf("failed to get coupon payment: %v", err)
+				}
+				bondID = couponPayment.BondID
+			default:
+				redemption, err := ca.GetRedemption(ctx, id)
+				if err != nil {
+					return fmt.Errorf("failed to get redemption: %v", err)
+				}
+				bondID = redemption.BondID
+				if len(redemption.Instalments) > 0 {
+					batch.Skipped = append(batch.Skipped, &DueActionOutcome{Type: actionType, ID: id, Reason: "redemption is paid in instalments"})
+					continue
+				}
+			}
+
+			outcome := &DueActionOutcome{Type: actionType, ID: id}
+			err := requireNotInDefault(ctx, bondID)
+			if err != nil {
+				outcome.Reason = err.Error()
+				batch.Skipped = append(batch.Skipped, outcome)
+				continue
+			}
+			updatesBond := actionType != "COUPON"
+			if updatesBond && bondUpdated[bondID] {
+				outcome.Reason = fmt.Sprintf("bond %s was already updated in this batch", bondID)
+				batch.Skipped = append(batch.Skipped, outcome)
+				batch.More = true
+				continue
+			}
+
+			switch actionType {
+			case "AMORTIZATION":
+				err = ca.ProcessAmortization(ctx, id)
+			case "COUPON":
+				err = ca.ProcessCouponPayment(ctx, id)
+			default:
+				err = ca.ProcessRedemption(ctx, id)
+			}
+			if err != nil {
+				outcome.Reason = err.Error()
+				batch.Failed = append(batch.Failed, outcome)
+				continue
+			}
+			batch.Processed = append(batch.Processed, outcome)
+			if couponID != "" {
+				paidWithAmortization[couponID] = true
+			}
+			if updatesBond {
+				bondUpdated[bondID] = true
+			}
+		}
+		return nil
+	}
+
+	// Amortizations go first as they pay their coupon alongside
+	err = process("AMORTIZATION", amortizationIDs)
+	if err != nil {
+		return nil, err
+	}
+	err = process("COUPON", couponIDs)
+	if err != nil {
+		return nil, err
+	}
+	err = process("REDEMPTION", redemptionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "DUE_ACTIONS_PROCESSED",
+		Details:   fmt.Sprintf("Processed %d, failed %d, skipped %d actions due by %s", len(batch.Processed), len(batch.Failed), len(batch.Skipped), asOfDate.Format("2006-01-02")),
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// CalculateCouponAmount calculates the coupon due on faceValue for one
+// period. With empty period dates it returns a regular coupon at the bond's
+// stated frequency; otherwise the coupon accrues from periodStartStr to
+// periodEndStr (YYYY-MM-DD) under dayCount, which defaults to the bond's
+// convention, so short and long first coupons come out right.
+func (ca *CorporateAction) CalculateCouponAmount(ctx contractapi.TransactionContextInterface, bondID string, faceValue float64, couponRate float64, periodStartStr, periodEndStr, dayCount string) (float64, error) {
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Amortizing bonds only accrue coupons on the principal still
+	// outstanding, and none once it has all been repaid
+	if bond.FaceValue > 0 {
+		faceValue = faceValue * outstandingPrincipal(bond) / bond.FaceValue
+	}
+	if faceValue == 0 {
+		return 0, nil
+	}
+
+	if dayCount == "" {
+		dayCount = bond.Terms.DayCount
+	}
+	switch dayCount {
+	case "":
+		dayCount = "30/360"
+	case "30/360", "ACT/360", "ACT/365", "ACT/ACT":
+	default:
+		return 0, fmt.Errorf("invalid day count convention: %s", dayCount)
+	}
+
+	var accrual float64
+	if periodStartStr == "" && periodEndStr == "" {
+		frequency := bond.Terms.CouponFrequency
+		if frequency == 0 {
+			frequency = 2
+		}
+		accrual = 1 / float64(frequency)
+	} else {
+		periodStart, err := time.Parse("2006-01-02", periodStartStr)
+		if err != nil {
+			return 0, fmt.Errorf("invalid period start date format: %v", err)
+		}
+		periodEnd, err := time.Parse("2006-01-02", periodEndStr)
+		if err != nil {
+			return 0, fmt.Errorf("invalid period end date format: %v", err)
+		}
+		if !periodEnd.After(periodStart) {
+			return 0, fmt.Errorf("period end must be after period start")
+		}
+		accrual = yearFraction(periodStart, periodEnd, dayCount)
+	}
+
+	couponAmount := faceValue * couponRate / 100 * accrual
+	return couponAmount, nil
+}
+
+// RecordFXRate records a reference exchange rate for a date
+func (ca *CorporateAction) RecordFXRate(ctx contractapi.TransactionContextInterface, base, quote string, rate float64, source, asOfDateStr string) error {
+	if rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if base == quote {
+		return fmt.Errorf("base and quote currencies must differ")
+	}
+
+	asOfDate, err := time.Parse("2006-01-02", asOfDateStr)
+	if err != nil {
+		return fmt.Errorf("invalid rate date format: %v", err)
+	}
+
+	rateKey, err := ctx.GetStub().CreateCompositeKey("FXRATE", []string{base, quote, asOfDateStr})
+	if err != nil {
+		return fmt.Errorf("failed to create rate key: %v", err)
+	}
+
+	fxRate := FXRate{
+		Base:     base,
+		Quote:    quote,
+		Rate:     rate,
+		Source:   source,
+		AsOfDate: asOfDate,
+		TxID:     ctx.GetStub().GetTxID(),
+	}
+
+	rateJSON, err := json.Marshal(fxRate)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rate: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(rateKey, rateJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store rate: %v", err)
+	}
+
+	return nil
+}
+
+// GetFXRate returns the rate converting base into quote on a date, deriving
+// it from the inverse pair if only that was recorded
+func (ca *CorporateAction) GetFXRate(ctx contractapi.TransactionContextInterface, base, quote, asOfDateStr string) (*FXRate, error) {
+	for _, pair := range [][]string{{base, quote}, {quote, base}} {
+		rateKey, err := ctx.GetStub().CreateCompositeKey("FXRATE", []string{pair[0], pair[1], asOfDateStr})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rate key: %v", err)
+		}
+
+		rateJSON, err := ctx.GetStub().GetState(rateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rate: %v", err)
+		}
+		if rateJSON == nil {
+			continue
+		}
+
+		var fxRate FXRate
+		err = json.Unmarshal(rateJSON, &fxRate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rate: %v", err)
+		}
+
+		if pair[0] != base {
+			fxRate.Base, fxRate.Quote = base, quote
+			fxRate.Rate = 1 / fxRate.Rate
+		}
+		return &fxRate, nil
+	}
+
+	return nil, fmt.Errorf("no %s/%s rate recorded for %s", base, quote, asOfDateStr)
+}
+
+// ConvertAmount converts an amount between currencies at the recorded rate
+func (ca *CorporateAction) ConvertAmount(ctx contractapi.TransactionContextInterface, amount float64, from, to, asOfDateStr string) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	fxRate, err := ca.GetFXRate(ctx, from, to, asOfDateStr)
+	if err != nil {
+		return 0, err
+	}
+
+	return roundAmount(amount * fxRate.Rate), nil
+}
+
+// SetCouponSettlementCurrency settles a pending coupon payment in one of the
+// bond's permitted settlement currencies at the rate recorded for fxDateStr.
+// expectedVersion is the version the caller last read, or 0 to skip the check.
+func (ca *CorporateAction) SetCouponSettlementCurrency(ctx contractapi.TransactionContextInterface, couponID, currency, fxDateStr string, expectedVersion int64) error {
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+
+	err = checkVersion("coupon payment "+couponID, couponPayment.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if couponPayment.Status != "PENDING" {
+		return fmt.Errorf("coupon payment %s is not pending", couponID)
+	}
+
+	settlement, err := ca.settlementFX(ctx, couponPayment.BondID, couponPayment.Amount, currency, fxDateStr)
+	if err != nil {
+		return err
+	}
+	couponPayment.Settlement = settlement
+
+	err = putCouponPayment(ctx, couponPayment)
+	if err != nil {
+		return fmt.Errorf("failed to update coupon payment: %v", err)
+	}
+
+	return nil
+}
+
+// SetRedemptionSettlementCurrency settles a pending redemption in one of the
+// bond's permitted settlement currencies at the rate recorded for fxDateStr.
+// expectedVersion is the version the caller last read, or 0 to skip the check.
+func (ca *CorporateAction) SetRedemptionSettlementCurrency(ctx contractapi.TransactionContextInterface, redemptionID, currency, fxDateStr string, expectedVersion int64) error {
+	redemption, err := ca.GetRedemption(ctx, redemptionID)
+	if err != nil {
+		return fmt.Errorf("failed to get redemption: %v", err)
+	}
+
+	err = checkVersion("redemption "+redemptionID, redemption.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if redemption.Status != "PENDING" {
+		return fmt.Errorf("redemption %s is not pending", redemptionID)
+	}
+
+	settlement, err := ca.settlementFX(ctx, redemption.BondID, redemption.Amount, currency, fxDateStr)
+	if err != nil {
+		return err
+	}
+	redemption.Settlement = settlement
+
+	err = putRedemption(ctx, redemption)
+	if err != nil {
+		return fmt.Errorf("failed to update redemption: %v", err)
+	}
+
+	return nil
+}
+
+// SetCouponEntitlementDates sets the record and ex dates (YYYY-MM-DD) of a
+// pending coupon payment. They cannot change once entitlements are taken.
+// expectedVersion is the version the caller last read, or 0 to skip the check.
+func (ca *CorporateAction) SetCouponEntitlementDates(ctx contractapi.TransactionContextInterface, couponID, recordDateStr, exDateStr string, expectedVersion int64) error {
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+
+	err = checkVersion("coupon payment "+couponID, couponPayment.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if couponPayment.Status != "PENDING" {
+		return fmt.Errorf("coupon payment %s is not pending", couponID)
+	}
+
+	err = setEntitlementDates(&couponPayment.Entitlement, recordDateStr, exDateStr, couponPayment.PaymentDate)
+	if err != nil {
+		return err
+	}
+
+	err = putCouponPayment(ctx, couponPayment)
+	if err != nil {
+		return fmt.Errorf("failed to update coupon payment: %v", err)
+	}
+
+	return nil
+}
+
+// SetRedemptionEntitlementDates sets the record and ex dates (YYYY-MM-DD) of
+// a pending redemption. They cannot change once entitlements are taken.
+// expectedVersion is the version the caller last read, or 0 to skip the check.
+func (ca *CorporateAction) SetRedemptionEntitlementDates(ctx contractapi.TransactionContextInterface, redemptionID, recordDateStr, exDateStr string, expectedVersion int64) error {
+	redemption, err := ca.GetRedemption(ctx, redemptionID)
+	if err != nil {
+		return fmt.Errorf("failed to get redemption: %v", err)
+	}
+
+	err = checkVersion("redemption "+redemptionID, redemption.Version, expectedVersion)
+	if err != nil {
+		return err
+	}
+
+	if redemption.Status != "PENDING" {
+		return fmt.Errorf("redemption %s is not pending", redemptionID)
+	}
+
+	err = setEntitlementDates(&redemption.Entitlement, recordDateStr, exDateStr, redemption.RedemptionDate)
+	if err != nil {
+		return err
+	}
+
+	err = putRedemption(ctx, redemption)
+	if err != nil {
+		return fmt.Errorf("failed to update redemption: %v", err)
+	}
+
+	return nil
+}
+
+// SnapshotCouponEntitlements fixes each holder's share of a coupon payment
+// from the BondToken holder snapshot taken for its record date, failing if
+// the registrar has not taken one. It can only run once the record date has
+// passed, and only once per coupon.
+func (ca *CorporateAction) SnapshotCouponEntitlements(ctx contractapi.TransactionContextInterface, couponID string) error {
+	couponPayment, err := ca.GetCouponPayment(ctx, couponID)
+	if err != nil {
+		return fmt.Errorf("failed to get coupon payment: %v", err)
+	}
+
+	if couponPayment.Status != "PENDING" {
+		return fmt.Errorf("coupon payment %s is not pending", couponID)
+	}
+
+	err = snapshotEntitlements(ctx, couponID, couponPayment.BondID, couponPayment.Amount, couponPayment, &couponPayment.Entitlement)
+	if err != nil {
+		return err
+	}
+
+	err = putCouponPayment(ctx, couponPayment)
+	if err != nil {
+		return fmt.Errorf("failed to update coupon payment: %v", err)
+	}
+
+	return nil
+}
+
+// SnapshotRedemptionEntitlements fixes each holder's share of a redemption
+// from the BondToken holder snapshot taken for its record date, failing if
+// the registrar has not taken one. It can only run once the record date has
+// passed, and only once per redemption.
+func (ca *CorporateAction) SnapshotRedemptionEntitlements(ctx contractapi.TransactionContextInterface, redemptionID string) error {
+	redemption, err := ca.GetRedemption(ctx, redemptionID)
+	if err != nil {
+		return fmt.Errorf("failed to get redemption: %v", err)
+	}
+
+	if redemption.Status != "PENDING" {
+		return fmt.Errorf("redemption %s is not pending", redemptionID)
+	}
+
+	err = snapshotEntitlements(ctx, redemptionID, redemption.BondID, redemption.Amount, nil, &redemption.Entitlement)
+	if err != nil {
+		return err
+	}
+
+	err = putRedemption(ctx, redemption)
+	if err != nil {
+		return fmt.Errorf("failed to update redemption: %v", err)
+	}
+
+	return nil
+}
+
+// SimulateDistribution computes, without writing state, the entitlements a
+// coupon payment or redemption would distribute: each holder's gross share,
+// withholding tax and net amount, and the rounding difference against the
+// action amount. Holders are taken at the close of the action's record date,
+// or of the transaction date when no record date is set.
+func (ca *CorporateAction) SimulateDistribution(ctx contractapi.TransactionContextInterface, actionID string) (*DistributionSimulation, error) {
+	simulation := &DistributionSimulation{ActionID: actionID}
+
+	var coupon *CouponPayment
+	var info EntitlementInfo
+	couponJSON, err := getIndexed(ctx, couponObjectType, actionID)
+	if err != nil {
+		return nil, err
+	}
+	if couponJSON != nil {
+		coupon = &CouponPayment{}
+		err = json.Unmarshal(couponJSON, coupon)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal coupon payment: %v", err)
+		}
+		simulation.Type = couponObjectType
+		simulation.BondID = coupon.BondID
+		simulation.Amount = coupon.Amount
+		info = coupon.Entitlement
+	} else {
+		redemptionJSON, err := getIndexed(ctx, redemptionObjectType, actionID)
+		if err != nil {
+			return nil, err
+		}
+		if redemptionJSON == nil {
+			return nil, fmt.Errorf("corporate action %s does not exist", actionID)
+		}
+		var redemption Redemption
+		err = json.Unmarshal(redemptionJSON, &redemption)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal redemption: %v", err)
+		}
+		simulation.Type = redemptionObjectType
+		simulation.BondID = redemption.BondID
+		simulation.Amount = redemption.Amount
+		info = redemption.Entitlement
+	}
+
+	simulation.RecordDate = info.RecordDate
+	if simulation.RecordDate.IsZero() {
+		txTime, err := txTimestamp(ctx)
+		if err != nil {
+			return nil, err
+		}
+		simulation.RecordDate = time.Date(txTime.Year(), txTime.Month(), txTime.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	holders, err := holdersAsOf(ctx, simulation.BondID, simulation.RecordDate)
+	if err != nil {
+		return nil, err
+	}
+
+	entitlements, err := computeEntitlements(ctx, actionID, simulation.BondID, simulation.Amount, coupon, simulation.RecordDate, holders)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entitlement := range entitlements {
+		simulation.GrossAmount += entitlement.Amount
+		simulation.WithholdingTax += entitlement.WithholdingTax
+		simulation.NetAmount += entitlement.NetAmount
+	}
+	simulation.Entitlements = entitlements
+	simulation.HolderCount = len(entitlements)
+	simulation.GrossAmount = roundAmount(simulation.GrossAmount)
+	simulation.WithholdingTax = roundAmount(simulation.WithholdingTax)
+	simulation.NetAmount = roundAmount(simulation.NetAmount)
+	simulation.RoundingDifference = roundAmount(simulation.Amount - simulation.GrossAmount)
+
+	return simulation, nil
+}
+
+// GetEntitlements returns every holder entitlement of a coupon payment or
+// redemption
+func (ca *CorporateAction) GetEntitlements(ctx contractapi.TransactionContextInterface, actionID string) ([]*Entitlement, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("ENTITLEMENT", []string{actionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entitlements: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var entitlements []*Entitlement
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var entitlement Entitlement
+		err = json.Unmarshal(queryResult.Value, &entitlement)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal entitlement: %v", err)
+		}
+		entitlements = append(entitlements, &entitlement)
+	}
+
+	return entitlements, nil
+}
+
+// GetEntitlement returns one holder's entitlement to a coupon payment or
+// redemption
+func (ca *CorporateAction) GetEntitlement(ctx contractapi.TransactionContextInterface, actionID, address string) (*Entitlement, error) {
+	key, err := ctx.GetStub().CreateCompositeKey("ENTITLEMENT", []string{actionID, address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entitlement key: %v", err)
+	}
+
+	entitlementJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read entitlement: %v", err)
+	}
+	if entitlementJSON == nil {
+		return nil, fmt.Errorf("%s has no entitlement to %s", address, actionID)
+	}
+
+	var entitlement Entitlement
+	err = json.Unmarshal(entitlementJSON, &entitlement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entitlement: %v", err)
+	}
+
+	return &entitlement, nil
+}
+
+// ClaimEntitlement lets a holder of a claim-basis bond claim their
+// entitlement to a processed coupon payment or redemption. The holder is the
+// caller's "address" identity attribute, or their identity ID without one.
+// Each entitlement can be claimed once.
+func (ca *CorporateAction) ClaimEntitlement(ctx contractapi.TransactionContextInterface, actionID string) (*Entitlement, error) {
+	address, err := callerAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var action struct {
+		BondID      string          `json:"bondId"`
+		Status      string          `json:"status"`
+		Entitlement EntitlementInfo `json:"entitlement"`
+	}
+	actionJSON, err := getIndexed(ctx, couponObjectType, actionID)
+	if err != nil {
+		return nil, err
+	}
+	processedStatus := "PAID"
+	if actionJSON == nil {
+		actionJSON, err = getIndexed(ctx, redemptionObjectType, actionID)
+		if err != nil {
+			return nil, err
+		}
+		processedStatus = "COMPLETED"
+	}
+	if actionJSON == nil {
+		return nil, fmt.Errorf("corporate action %s does not exist", actionID)
+	}
+	err = json.Unmarshal(actionJSON, &action)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal corporate action: %v", err)
+	}
+
+	bond, err := getBond(ctx, action.BondID)
+	if err != nil {
+		return nil, err
+	}
+	if !bond.Terms.ClaimBasis {
+		return nil, fmt.Errorf("bond %s is not operated on a claim basis", action.BondID)
+	}
+	if action.Status != processedStatus {
+		return nil, fmt.Errorf("%s cannot be claimed while %s", actionID, action.Status)
+	}
+	if action.Entitlement.SnapshotTxID == "" {
+		return nil, fmt.Errorf("entitlements for %s have not been taken", actionID)
+	}
+
+	entitlement, err := ca.GetEntitlement(ctx, actionID, address)
+	if err != nil {
+		return nil, err
+	}
+	if entitlement.TxID != action.Entitlement.SnapshotTxID {
+		return nil, fmt.Errorf("entitlement of %s to %s is not from the record-date snapshot", address, actionID)
+	}
+	if !entitlement.ClaimedAt.IsZero() {
+		return nil, fmt.Errorf("entitlement of %s to %s has already been claimed", address, actionID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entitlement.ClaimedAt = txTime
+	entitlement.ClaimTxID = ctx.GetStub().GetTxID()
+
+	entitlementJSON, err := json.Marshal(entitlement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entitlement: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey("ENTITLEMENT", []string{actionID, address})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entitlement key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, entitlementJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store entitlement: %v", err)
+	}
+
+	// Emit event
+	event := CorporateActionEvent{
+		Type:      "ENTITLEMENT_CLAIMED",
+		BondID:    action.BondID,
+		Details:   fmt.Sprintf("%s claimed %s", address, actionID),
+		Amount:    entitlement.NetAmount,
+		Timestamp: txTime,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	err = emitEvent(ctx, "CorporateActionEvent", &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return entitlement, nil
+}
+
+// SetWithholdingRate sets the coupon withholding tax rate, in percent, for
+// holders of a tax jurisdiction and classification. Use "DEFAULT" for either
+// to set a fallback rate. Only the tax administrator may set rates.
+func (ca *CorporateAction) SetWithholdingRate(ctx contractapi.TransactionContextInterface, jurisdiction, classification string, rate float64) error {
+	err := requireRole(ctx, taxAdminRole)
+	if err != nil {
+		return err
+	}
+
+	if jurisdiction == "" || classification == "" {
+		return fmt.Errorf("jurisdiction and classification are required")
+	}
+	if rate < 0 || rate > 100 {
+		return fmt.Errorf("withholding rate must be between 0 and 100")
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	withholdingRate := WithholdingRate{
+		Jurisdiction:   jurisdiction,
+		Classification: classification,
+		Rate:           rate,
+		UpdatedAt:      txTime,
+		TxID:           ctx.GetStub().GetTxID(),
+	}
+
+	rateJSON, err := json.Marshal(withholdingRate)
+	if err != nil {
+		return fmt.Errorf("failed to marshal withholding rate: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey("TAXRATE", []string{jurisdiction, classification})
+	if err != nil {
+		return fmt.Errorf("failed to create withholding rate key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, rateJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store withholding rate: %v", err)
+	}
+
+	return nil
+}
+
+// GetWithholdingRate returns the rate applied to a jurisdiction and
+// classification, falling back to the jurisdiction's DEFAULT rate and then
+// the DEFAULT/DEFAULT rate. Nil means no tax is withheld.
+func (ca *CorporateAction) GetWithholdingRate(ctx contractapi.TransactionContextInterface, jurisdiction, classification string) (*WithholdingRate, error) {
+	return lookupWithholdingRate(ctx, jurisdiction, classification)
+}
+
+// lookupWithholdingRate resolves a withholding rate with the fallbacks
+// described on GetWithholdingRate
+func lookupWithholdingRate(ctx contractapi.TransactionContextInterface, jurisdiction, classification string) (*WithholdingRate, error) {
+	lookups := [][]string{
+		{jurisdiction, classification},
+		{jurisdiction, "DEFAULT"},
+		{"DEFAULT", "DEFAULT"},
+	}
+	for _, attributes := range lookups {
+		key, err := ctx.GetStub().CreateCompositeKey("TAXRATE", attributes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create withholding rate key: %v", err)
+		}
+
+		rateJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read withholding rate: %v", err)
+		}
+		if rateJSON == nil {
+			continue
+		}
+
+		var withholdingRate WithholdingRate
+		err = json.Unmarshal(rateJSON, &withholdingRate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal withholding rate: %v", err)
+		}
+		return &withholdingRate, nil
+	}
+
+	return nil, nil
+}
+
+// GetTaxReport totals the withholding on a bond's coupons paid in a period,
+// given as "YYYY", "YYYY-Qn" or "YYYY-MM", by jurisdiction and
+// classification, with the per-holder entitlements behind the totals
+func (ca *CorporateAction) GetTaxReport(ctx contractapi.TransactionContextInterface, bondID, period string) (*TaxReport, error) {
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	couponPayments, err := ca.GetCouponPaymentsByBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TaxReport{
+		BondID:       bondID,
+		Period:       period,
+		From:         from,
+		To:           to,
+		Lines:        []*TaxReportLine{},
+		Entitlements: []*Entitlement{},
+	}
+	lines := make(map[string]*TaxReportLine)
+	for _, couponPayment := range couponPayments {
+		if couponPayment.PaymentDate.Before(from) || !couponPayment.PaymentDate.Before(to) {
+			continue
+		}
+		if couponPayment.Entitlement.SnapshotTxID == "" {
+			continue
+		}
+
+		entitlements, err := ca.GetEntitlements(ctx, couponPayment.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entitlement := range entitlements {
+			lineKey := entitlement.TaxJurisdiction + "|" + entitlement.TaxClassification
+			line, ok := lines[lineKey]
+			if !ok {
+				line = &TaxReportLine{
+					Jurisdiction:   entitlement.TaxJurisdiction,
+					Classification: entitlement.TaxClassification,
+				}
+				lines[lineKey] = line
+				report.Lines = append(report.Lines, line)
+			}
+			line.Holders++
+			line.GrossAmount = roundAmount(line.GrossAmount + entitlement.Amount)
+			line.WithholdingTax = roundAmount(line.WithholdingTax + entitlement.WithholdingTax)
+			line.NetAmount = roundAmount(line.NetAmount + entitlement.NetAmount)
+
+			report.GrossAmount = roundAmount(report.GrossAmount + entitlement.Amount)
+			report.WithholdingTax = roundAmount(report.WithholdingTax + entitlement.WithholdingTax)
+			report.NetAmount = roundAmount(report.NetAmount + entitlement.NetAmount)
+			report.Entitlements = append(report.Entitlements, entitlement)
+		}
+	}
+
+	return report, nil
+}
+
+// settlementFX builds the FX reference for settling amount, denominated in
+// the bond's currency, in a permitted settlement currency
+func (ca *CorporateAction) settlementFX(ctx contractapi.TransactionContextInterface, bondID string, amount float64, currency, fxDateStr string) (*SettlementFX, error) {
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	if currency == bond.Currency {
+		return &SettlementFX{Currency: currency, Rate: 1, SettlementAmount: amount}, nil
+	}
+
+	permitted := false
+	for _, c := range bond.SettlementCurrencies {
+		if c == currency {
+			permitted = true
+			break
+		}
+	}
+	if !permitted {
+		return nil, fmt.Errorf("bond %s cannot be settled in %s", bondID, currency)
+	}
+
+	fxRate, err := ca.GetFXRate(ctx, bond.Currency, currency, fxDateStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SettlementFX{
+		Currency:         currency,
+		Rate:             fxRate.Rate,
+		RateSource:       fxRate.Source,
+		RateDate:         fxRate.AsOfDate,
+		RateTxID:         fxRate.TxID,
+		SettlementAmount: roundAmount(amount * fxRate.Rate),
+	}, nil
+}
+
+// paymentInstruction builds and stores the pain.001 instruction for paying
+// a processed coupon or redemption from the issuer. Once entitlements have
+// been snapshotted there is one credit transfer per holder for the net
+// amount; before that the whole amount goes to the paying agent. Amounts are
+// in the settlement currency when one has been set.
+func (ca *CorporateAction) paymentInstruction(ctx contractapi.TransactionContextInterface, actionID, bondID, purpose string, amount float64, executionDate time.Time, settlement *SettlementFX, info EntitlementInfo) (*PaymentInstruction, error) {
+	if info.ElectionID != "" && info.ElectionsClosedAt.IsZero() {
+		return nil, fmt.Errorf("elections on %s are still open", actionID)
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := bond.Currency
+	rate := 1.0
+	if settlement != nil {
+		currency = settlement.Currency
+		rate = settlement.Rate
+	}
+	remittance := fmt.Sprintf("%s %s on bond %s", purpose, actionID, bondID)
+
+	var transfers []*CreditTransfer
+	if info.SnapshotTxID != "" {
+		entitlements, err := ca.GetEntitlements(ctx, actionID)
+		if err != nil {
+			return nil, err
+		}
+		for _, entitlement := range entitlements {
+			if !paidInCash(entitlement) {
+				continue
+			}
+			instructed := InstructedAmount{Currency: currency, Value: roundAmount(entitlement.NetAmount * rate)}
+			if entitlement.OptionCurrency != "" && entitlement.OptionCurrency != currency {
+				fx, err := ca.settlementFX(ctx, bondID, entitlement.NetAmount, entitlement.OptionCurrency, executionDate.Format("2006-01-02"))
+				if err != nil {
+					return nil, err
+				}
+				instructed = InstructedAmount{Currency: fx.Currency, Value: fx.SettlementAmount}
+			}
+			transfers = append(transfers, &CreditTransfer{
+				InstructionID: fmt.Sprintf("%s-%d", actionID, len(transfers)+1),
+				EndToEndID:    endToEndID(actionID, entitlement.Address),
+				Amount:        instructed,
+				Creditor:      PaymentParty{ID: entitlement.Address},
+				Remittance:    remittance,
+			})
+		}
+	} else {
+		transfers = append(transfers, &CreditTransfer{
+			InstructionID: actionID + "-1",
+			EndToEndID:    actionID,
+			Amount:        InstructedAmount{Currency: currency, Value: roundAmount(amount * rate)},
+			Creditor:      PaymentParty{Name: "Paying agent", ID: "PAYING_AGENT"},
+			Remittance:    remittance,
+		})
+	}
+
+	controlSum := 0.0
+	for _, transfer := range transfers {
+		controlSum += transfer.Amount.Value
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := PaymentParty{ID: bond.IssuerID}
+	instruction := &PaymentInstruction{
+		MessageDefinition: "pain.001.001.09",
+		GroupHeader: PaymentGroupHeader{
+			MessageID:       ctx.GetStub().GetTxID(),
+			CreationTime:    txTime,
+			NumberOfTxs:     len(transfers),
+			ControlSum:      roundAmount(controlSum),
+			InitiatingParty: issuer,
+		},
+		PaymentInfo: PaymentInfo{
+			PaymentInfoID:   actionID,
+			PaymentMethod:   "TRF",
+			ExecutionDate:   executionDate.Format("2006-01-02"),
+			Debtor:          issuer,
+			CreditTransfers: transfers,
+		},
+	}
+
+	instructionJSON, err := json.Marshal(instruction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payment instruction: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(paymentInstructionKey(actionID), instructionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store payment instruction: %v", err)
+	}
+
+	return instruction, nil
+}
+
+// completeRedemption builds the payment instruction for a pending
+// redemption and stores it as COMPLETED, processed by the invoking client
+func (ca *CorporateAction) completeRedemption(ctx contractapi.TransactionContextInterface, redemption *Redemption) (*PaymentInstruction, error) {
+	if len(redemption.Instalments) > 0 {
+		return nil, fmt.Errorf("redemption %s is paid in instalments", redemption.ID)
+	}
+
+	processedBy, err := invokerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instruction, err := ca.paymentInstruction(ctx, redemption.ID, redemption.BondID, "Redemption", redemption.Amount, redemption.RedemptionDate, redemption.Settlement, redemption.Entitlement)
+	if err != nil {
+		return nil, err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update status to completed
+	redemption.Status = "COMPLETED"
+	redemption.CompletedAt = txTime
+	redemption.TxID = ctx.GetStub().GetTxID()
+	redemption.ProcessedBy = processedBy
+
+	// Store updated redemption
+	err = putRedemption(ctx, redemption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update redemption: %v", err)
+	}
+
+	err = accrueAgencyFee(ctx, redemption.BondID, redemptionObjectType, redemption.ID, redemption.Amount, processedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return instruction, nil
+}
+
+// burnRedeemedTokens invokes the BondToken contract to burn the tokens a
+// redemption paid off: each entitled holder's quantity once entitlements have
+// been taken. Without a snapshot every holding is burned, which is only
+// allowed when the whole issue is redeemed, at maturity or on a call, and the
+// redemption pays for every outstanding token.
+func (ca *CorporateAction) burnRedeemedTokens(ctx contractapi.TransactionContextInterface, redemption *Redemption) error {
+	burnsJSON := ""
+	if redemption.Entitlement.SnapshotTxID == "" {
+		bond, err := getBond(ctx, redemption.BondID)
+		if err != nil {
+			return err
+		}
+		if redemption.Type != "CALL" && redemption.RedemptionDate.Before(bond.MaturityDate) {
+			return fmt.Errorf("redemption %s does not redeem the whole issue: snapshot its entitlements first", redemption.ID)
+		}
+		wholeIssue, err := wholeIssueAmount(bond, redemption)
+		if err != nil {
+			return err
+		}
+		if math.Abs(redemption.Amount-wholeIssue) >= 0.005 {
+			return fmt.Errorf("redemption %s pays %.2f, not the %.2f due on the whole issue: snapshot its entitlements first", redemption.ID, redemption.Amount, wholeIssue)
+		}
+	} else {
+		entitlements, err := ca.GetEntitlements(ctx, redemption.ID)
+		if err != nil {
+			return err
+		}
+
+		burns := []TokenBurn{}
+		for _, entitlement := range entitlements {
+			if entitlement.Quantity > 0 {
+				burns = append(burns, TokenBurn{Address: entitlement.Address, Quantity: entitlement.Quantity})
+			}
+		}
+		if len(burns) == 0 {
+			return nil
+		}
+
+		burnsBytes, err := json.Marshal(burns)
+		if err != nil {
+			return fmt.Errorf("failed to marshal burns: %v", err)
+		}
+		burnsJSON = string(burnsBytes)
+	}
+
+	args := [][]byte{[]byte("BurnRedeemedTokens"), []byte(redemption.BondID), []byte(burnsJSON), []byte(redemption.ID)}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to burn tokens redeemed by %s: %s", redemption.ID, response.Message)
+	}
+
+	return nil
+}
+
+// wholeIssueAmount returns what a redemption of every outstanding token of
+// the bond pays: the outstanding principal, or for a call the call price
+// plus accrued interest ExerciseCall recorded on it
+func wholeIssueAmount(bond *BondInfo, redemption *Redemption) (float64, error) {
+	perToken := outstandingPrincipal(bond)
+	if redemption.Type == "CALL" {
+		callPrice, err := strconv.ParseFloat(redemption.Metadata["callPrice"], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid call price on redemption %s: %v", redemption.ID, err)
+		}
+		accrued, err := strconv.ParseFloat(redemption.Metadata["accruedInterest"], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid accrued interest on redemption %s: %v", redemption.ID, err)
+		}
+		perToken = perToken*callPrice/100 + accrued
+	}
+	return roundAmount(perToken * float64(bond.TotalSupply)), nil
+}
+
+// createHolderPayments creates an INSTRUCTED payment record for each holder
+// entitled to a coupon, referencing their credit transfer in the payment
+// instruction. Reprocessing a retried coupon replaces the earlier records.
+func (ca *CorporateAction) createHolderPayments(ctx contractapi.TransactionContextInterface, couponPayment *CouponPayment, instruction *PaymentInstruction) error {
+	entitlements, err := ca.GetEntitlements(ctx, couponPayment.ID)
+	if err != nil {
+		return err
+	}
+
+	cashAmounts := make(map[string]InstructedAmount)
+	for _, transfer := range instruction.PaymentInfo.CreditTransfers {
+		cashAmounts[transfer.EndToEndID] = transfer.Amount
+	}
+
+	bond, err := getBond(ctx, couponPayment.BondID)
+	if err != nil {
+		return err
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, entitlement := range entitlements {
+		cashReference := endToEndID(couponPayment.ID, entitlement.Address)
+		if _, ok := cashAmounts[cashReference]; !ok {
+			// Elected a non-cash option, e.g. payment in kind
+			continue
+		}
+		holderPayment := &HolderPayment{
+			ID:             couponPayment.ID + "_" + entitlement.Address,
+			CouponID:       couponPayment.ID,
+			BondID:         couponPayment.BondID,
+			Holder:         entitlement.Address,
+			PaymentDate:    couponPayment.PaymentDate,
+			GrossAmount:    entitlement.Amount,
+			WithholdingTax: entitlement.WithholdingTax,
+			NetAmount:      entitlement.NetAmount,
+			Currency:       cashAmounts[cashReference].Currency,
+			CashAmount:     cashAmounts[cashReference].Value,
+			Status:         "INSTRUCTED",
+			CashReference:  cashReference,
+			CreatedAt:      txTime,
+			TxID:           ctx.GetStub().GetTxID(),
+		}
+
+		err = putHolderPayment(ctx, holderPayment)
+		if err != nil {
+			return err
+		}
+
+		taxVoucher := &TaxVoucher{
+			ID:                holderPayment.ID,
+			Holder:            entitlement.Address,
+			BondID:            couponPayment.BondID,
+			ISIN:              bond.ISIN,
+			CouponID:          couponPayment.ID,
+			PaymentDate:       couponPayment.PaymentDate,
+			Year:              couponPayment.PaymentDate.Year(),
+			Currency:          bond.Currency,
+			GrossAmount:       entitlement.Amount,
+			WithholdingRate:   entitlement.WithholdingRate,
+			TaxAmount:         entitlement.WithholdingTax,
+			NetAmount:         entitlement.NetAmount,
+			TaxJurisdiction:   entitlement.TaxJurisdiction,
+			TaxClassification: entitlement.TaxClassification,
+			PaymentReference:  cashReference,
+			IssuedAt:          txTime,
+			TxID:              ctx.GetStub().GetTxID(),
+		}
+
+		err = putTaxVoucher(ctx, taxVoucher)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// putTaxVoucher stores a tax voucher under its holder and tax year
+func putTaxVoucher(ctx contractapi.TransactionContextInterface, taxVoucher *TaxVoucher) error {
+	key, err := ctx.GetStub().CreateCompositeKey(taxVoucherObjectType, []string{taxVoucher.Holder, strconv.Itoa(taxVoucher.Year), taxVoucher.CouponID})
+	if err != nil {
+		return fmt.Errorf("failed to create tax voucher key: %v", err)
+	}
+
+	taxVoucherJSON, err := json.Marshal(taxVoucher)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tax voucher: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, taxVoucherJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store tax voucher: %v", err)
+	}
+
+	return nil
+}
+
+// putHolderPayment stores a per-holder coupon payment with its holder and
+// ID index entries
+func putHolderPayment(ctx contractapi.TransactionContextInterface, holderPayment *HolderPayment) error {
+	key, err := ctx.GetStub().CreateCompositeKey(holderPaymentObjectType, []string{holderPayment.CouponID, holderPayment.Holder})
+	if err != nil {
+		return fmt.Errorf("failed to create holder payment key: %v", err)
+	}
+	holderKey, err := ctx.GetStub().CreateCompositeKey(holderPaymentHolderIndex, []string{holderPayment.Holder, holderPayment.CouponID})
+	if err != nil {
+		return fmt.Errorf("failed to create holder payment holder index key: %v", err)
+	}
+	idKey, err := ctx.GetStub().CreateCompositeKey(holderPaymentIDIndex, []string{holderPayment.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create holder payment ID index key: %v", err)
+	}
+
+	holderPaymentJSON, err := json.Marshal(holderPayment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal holder payment: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, holderPaymentJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store holder payment: %v", err)
+	}
+	err = ctx.GetStub().PutState(holderKey, []byte(key))
+	if err != nil {
+		return fmt.Errorf("failed to store holder payment holder index: %v", err)
+	}
+	err = ctx.GetStub().PutState(idKey, []byte(key))
+	if err != nil {
+		return fmt.Errorf("failed to store holder payment ID index: %v", err)
+	}
+
+	return nil
+}
+
+// endToEndID is the pain.001 end-to-end reference of the credit transfer to
+// one holder
+func endToEndID(actionID, address string) string {
+	return actionID + "-" + address
+}
+
+// paidInCash reports whether an entitlement is paid in cash: it has no
+// election, or the elected option is cash or cash and securities
+func paidInCash(entitlement *Entitlement) bool {
+	switch entitlement.OptionCode {
+	case "", "CASH", "CASE":
+		return true
+	}
+	return false
+}
+
+// setElectedOption records an announcement option on an entitlement
+func setElectedOption(entitlement *Entitlement, option *AnnouncementOption, defaultApplied bool) {
+	entitlement.Option = option.Number
+	entitlement.OptionCode = option.Code
+	entitlement.OptionCurrency = option.Currency
+	entitlement.DefaultApplied = defaultApplied
+}
+
+// putEntitlement stores a holder's entitlement
+func putEntitlement(ctx contractapi.TransactionContextInterface, entitlement *Entitlement) error {
+	key, err := ctx.GetStub().CreateCompositeKey("ENTITLEMENT", []string{entitlement.ActionID, entitlement.Address})
+	if err != nil {
+		return fmt.Errorf("failed to create entitlement key: %v", err)
+	}
+
+	entitlementJSON, err := json.Marshal(entitlement)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entitlement: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, entitlementJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store entitlement: %v", err)
+	}
+
+	return nil
+}
+
+// updateEntitlementInfo applies update to the entitlement info of a pending
+// coupon payment or redemption and stores the action
+func updateEntitlementInfo(ctx contractapi.TransactionContextInterface, actionID string, update func(info *EntitlementInfo) error) error {
+	couponJSON, err := getIndexed(ctx, couponObjectType, actionID)
+	if err != nil {
+		return err
+	}
+	if couponJSON != nil {
+		var couponPayment CouponPayment
+		err = json.Unmarshal(couponJSON, &couponPayment)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal coupon payment: %v", err)
+		}
+		if couponPayment.Status != "PENDING" {
+			return fmt.Errorf("coupon payment %s is not pending", actionID)
+		}
+		err = update(&couponPayment.Entitlement)
+		if err != nil {
+			return err
+		}
+		return putCouponPayment(ctx, &couponPayment)
+	}
+
+	redemptionJSON, err := getIndexed(ctx, redemptionObjectType, actionID)
+	if err != nil {
+		return err
+	}
+	if redemptionJSON != nil {
+		var redemption Redemption
+		err = json.Unmarshal(redemptionJSON, &redemption)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal redemption: %v", err)
+		}
+		if redemption.Status != "PENDING" {
+			return fmt.Errorf("redemption %s is not pending", actionID)
+		}
+		err = update(&redemption.Entitlement)
+		if err != nil {
+			return err
+		}
+		return putRedemption(ctx, &redemption)
+	}
+
+	return fmt.Errorf("%s is not a coupon payment or redemption", actionID)
+}
+
+// paymentInstructionKey is the state key of a coupon payment's or
+// redemption's payment instruction
+func paymentInstructionKey(actionID string) string {
+	return "PAYMENTINSTRUCTION_" + actionID
+}
+
+// rescalePendingCoupons multiplies the amount of every pending scheduled
+// coupon of a bond accruing from date onwards by factor
+func (ca *CorporateAction) rescalePendingCoupons(ctx contractapi.TransactionContextInterface, bondID string, date time.Time, factor float64) error {
+	couponPayments, err := ca.GetCouponPaymentsByBond(ctx, bondID)
+	if err != nil {
+		return err
+	}
+
+	for _, couponPayment := range couponPayments {
+		if couponPayment.Status != "PENDING" || couponPayment.PeriodStart.IsZero() || couponPayment.PeriodStart.Before(date) {
+			continue
+		}
+		couponPayment.Amount = roundAmount(couponPayment.Amount * factor)
+		err = putCouponPayment(ctx, couponPayment)
+		if err != nil {
+			return fmt.Errorf("failed to update coupon payment: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// suspendPendingCoupons moves every PENDING coupon payment of a bond to
+// SUSPENDED and returns how many were suspended
+func (ca *CorporateAction) suspendPendingCoupons(ctx contractapi.TransactionContextInterface, bondID, reason string) (int, error) {
+	couponPayments, err := ca.GetCouponPaymentsByBond(ctx, bondID)
+	if err != nil {
+		return 0, err
+	}
+
+	suspended := 0
+	for _, couponPayment := range couponPayments {
+		if couponPayment.Status != "PENDING" {
+			continue
+		}
+
+		couponPayment.Status = "SUSPENDED"
+		if couponPayment.Metadata == nil {
+			couponPayment.Metadata = make(map[string]string)
+		}
+		couponPayment.Metadata["suspendReason"] = reason
+
+		err = putCouponPayment(ctx, couponPayment)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update coupon payment: %v", err)
+		}
+		suspended++
+	}
+
+	return suspended, nil
+}
+
+// rescheduleCoupons replaces the unpaid coupon payments of a bond falling
+// due after a date with the schedule of its restructured terms. Payments
+// the new schedule keeps are updated in place, the rest are cancelled, and
+// new payment dates are added. It returns the IDs of the payments changed.
+func (ca *CorporateAction) rescheduleCoupons(ctx contractapi.TransactionContextInterface, bond *BondInfo, after time.Time, restructuringID string) ([]string, error) {
+	holidays, err := bondHolidays(ctx, bond)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := make(map[string]*CouponPayment)
+	for _, couponPayment := range couponSchedule(bond, holidays) {
+		if couponPayment.PaymentDate.After(after) {
+			schedule[couponPayment.ID] = couponPayment
+		}
+	}
+
+	couponPayments, err := ca.GetCouponPaymentsByBond(ctx, bond.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []string
+	for _, couponPayment := range couponPayments {
+		if couponPayment.Status != "PENDING" && couponPayment.Status != "SUSPENDED" {
+			continue
+		}
+		if !couponPayment.PaymentDate.After(after) {
+			continue
+		}
+		if couponPayment.Metadata == nil {
+			couponPayment.Metadata = make(map[string]string)
+		}
+		couponPayment.Metadata["restructuringId"] = restructuringID
+
+		replacement, ok := schedule[couponPayment.ID]
+		if ok {
+			couponPayment.Amount = replacement.Amount
+			couponPayment.Status = "PENDING"
+			couponPayment.PeriodStart = replacement.PeriodStart
+			couponPayment.PeriodEnd = replacement.PeriodEnd
+			couponPayment.AccrualFactor = replacement.AccrualFactor
+			couponPayment.CouponRate = replacement.CouponRate
+			delete(schedule, couponPayment.ID)
+		} else {
+			couponPayment.Status = "CANCELLED"
+		}
+
+		err = putCouponPayment(ctx, couponPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update coupon payment: %v", err)
+		}
+		updated = append(updated, couponPayment.ID)
+	}
+
+	for _, couponPayment := range couponSchedule(bond, holidays) {
+		if _, ok := schedule[couponPayment.ID]; !ok {
+			continue
+		}
+
+		existing, err := getIndexed(ctx, couponObjectType, couponPayment.ID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			continue
+		}
+
+		couponPayment.Metadata["restructuringId"] = restructuringID
+		err = putCouponPayment(ctx, couponPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store coupon payment: %v", err)
+		}
+		updated = append(updated, couponPayment.ID)
+	}
+
+	return updated, nil
+}
+
+// validateRestructuringTerms checks restructuring terms against the bond
+// they would apply to
+func validateRestructuringTerms(bond *BondInfo, terms RestructuringTerms) error {
+	if terms.HaircutPercent < 0 || terms.HaircutPercent >= 100 {
+		return fmt.Errorf("haircut must be between 0 and 100 percent")
+	}
+	if terms.CouponRate < 0 {
+		return fmt.Errorf("coupon rate cannot be negative")
+	}
+	if terms.CouponRate > 0 && bond.BondType != "" && bond.BondType != "FIXED" {
+		return fmt.Errorf("coupon rate of a %s bond cannot be changed", bond.BondType)
+	}
+	if terms.MaturityDate != "" {
+		maturityDate, err := time.Parse("2006-01-02", terms.MaturityDate)
+		if err != nil {
+			return fmt.Errorf("invalid maturity date format: %v", err)
+		}
+		if !maturityDate.After(bond.MaturityDate) {
+			return fmt.Errorf("maturity can only be extended")
+		}
+	}
+	if terms.HaircutPercent == 0 && terms.CouponRate == 0 && terms.MaturityDate == "" {
+		return fmt.Errorf("restructuring does not change any terms")
+	}
+	return nil
+}
+
+// restructuringPassed reports whether the votes in favour of a
+// restructuring have reached its threshold
+func restructuringPassed(restructuring *Restructuring) bool {
+	return float64(restructuring.VotesFor)*100 >= restructuring.Threshold*float64(restructuring.EligibleQuantity)
+}
+
+// validateAnnouncement checks an announcement's event type, indicator,
+// dates and options
+func validateAnnouncement(announcement *Announcement) error {
+	switch announcement.EventType {
+	case "INTR", "REDM", "MCAL", "PCAL", "PRED", "BPUT", "CONV", "DFLT", "MEET", "OTHR":
+	default:
+		return fmt.Errorf("unsupported event type %q", announcement.EventType)
+	}
+
+	dates := announcement.Dates
+	if dates.PaymentDate.IsZero() && dates.RecordDate.IsZero() && dates.ResponseDeadline.IsZero() {
+		return fmt.Errorf("payment date, record date or response deadline is required")
+	}
+	if !dates.RecordDate.IsZero() && !dates.PaymentDate.IsZero() && dates.RecordDate.After(dates.PaymentDate) {
+		return fmt.Errorf("record date cannot be after payment date")
+	}
+	if !dates.ExDate.IsZero() && !dates.PaymentDate.IsZero() && dates.ExDate.After(dates.PaymentDate) {
+		return fmt.Errorf("ex date cannot be after payment date")
+	}
+	if !dates.ResponseDeadline.IsZero() && !dates.PaymentDate.IsZero() && dates.ResponseDeadline.After(dates.PaymentDate) {
+		return fmt.Errorf("response deadline cannot be after payment date")
+	}
+
+	if len(announcement.Options) == 0 {
+		return fmt.Errorf("at least one option is required")
+	}
+	numbers := make(map[string]bool)
+	defaults := 0
+	for _, option := range announcement.Options {
+		if option.Number == "" {
+			return fmt.Errorf("option number is required")
+		}
+		if numbers[option.Number] {
+			return fmt.Errorf("duplicate option number %s", option.Number)
+		}
+		numbers[option.Number] = true
+
+		switch option.Code {
+		case "CASH", "SECU", "CASE", "NOAC", "CONY", "CONN":
+		default:
+			return fmt.Errorf("unsupported option code %q", option.Code)
+		}
+		if option.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("only one option can be the default")
+	}
+
+	switch announcement.MandatoryVoluntary {
+	case "MAND":
+		if len(announcement.Options) != 1 {
+			return fmt.Errorf("a mandatory event has exactly one option")
+		}
+	case "CHOS", "VOLU":
+		if dates.ResponseDeadline.IsZero() {
+			return fmt.Errorf("an elective event needs a response deadline")
+		}
+		if announcement.MandatoryVoluntary == "CHOS" && defaults == 0 {
+			return fmt.Errorf("a mandatory event with options needs a default option")
+		}
+	default:
+		return fmt.Errorf("mandatory/voluntary indicator must be MAND, CHOS or VOLU")
+	}
+
+	return nil
+}
+
+// actionQueryString builds the CouchDB query for an ActionQuery. Dates are
+// stored as RFC 3339 UTC timestamps, so they compare correctly as strings.
+func actionQueryString(query ActionQuery) (string, error) {
+	selector := map[string]interface{}{}
+
+	switch query.Type {
+	case "":
+		selector["docType"] = map[string]interface{}{"$in": []string{couponObjectType, redemptionObjectType, amortizationObjectType}}
+	case couponObjectType, redemptionObjectType, amortizationObjectType:
+		selector["docType"] = query.Type
+	default:
+		return "", fmt.Errorf("invalid action type: %s", query.Type)
+	}
+	if query.BondID != "" {
+		selector["bondId"] = query.BondID
+	}
+	if query.Status != "" {
+		selector["status"] = query.Status
+	}
+
+	if query.MinAmount < 0 || query.MaxAmount < 0 {
+		return "", fmt.Errorf("amount bounds cannot be negative")
+	}
+	if query.MaxAmount > 0 && query.MinAmount > query.MaxAmount {
+		return "", fmt.Errorf("minAmount is greater than maxAmount")
+	}
+	amount := map[string]interface{}{}
+	if query.MinAmount > 0 {
+		amount["$gte"] = query.MinAmount
+	}
+	if query.MaxAmount > 0 {
+		amount["$lte"] = query.MaxAmount
+	}
+	if len(amount) > 0 {
+		selector["amount"] = amount
+	}
+
+	date := map[string]interface{}{}
+	if query.FromDate != "" {
+		fromDate, err := time.Parse("2006-01-02", query.FromDate)
+		if err != nil {
+			return "", fmt.Errorf("invalid fromDate format: %v", err)
+		}
+		date["$gte"] = fromDate.Format(time.RFC3339)
+	}
+	if query.ToDate != "" {
+		toDate, err := time.Parse("2006-01-02", query.ToDate)
+		if err != nil {
+			return "", fmt.Errorf("invalid toDate format: %v", err)
+		}
+		date["$lt"] = toDate.AddDate(0, 0, 1).Format(time.RFC3339)
+	}
+	if len(date) > 0 {
+		switch query.Type {
+		case "":
+			selector["$or"] = []map[string]interface{}{{"paymentDate": date}, {"redemptionDate": date}}
+		case redemptionObjectType:
+			selector["redemptionDate"] = date
+		default:
+			selector["paymentDate"] = date
+		}
+	}
+
+	queryString, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal action query: %v", err)
+	}
+
+	return string(queryString), nil
+}
+
+// paymentAccountKey is the state key of a bond's payment account
+func paymentAccountKey(bondID string) string {
+	return "PAYMENTACCOUNT_" + bondID
+}
+
+// getPaymentAccount returns a bond's payment account, or nil if none has
+// been designated
+func getPaymentAccount(ctx contractapi.TransactionContextInterface, bondID string) (*PaymentAccount, error) {
+	paymentAccountJSON, err := ctx.GetStub().GetState(paymentAccountKey(bondID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payment account: %v", err)
+	}
+	if paymentAccountJSON == nil {
+		return nil, nil
+	}
+
+	var paymentAccount PaymentAccount
+	err = json.Unmarshal(paymentAccountJSON, &paymentAccount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payment account: %v", err)
+	}
+
+	return &paymentAccount, nil
+}
+
+// verifyFunding checks with the cash-token contract that the issuer has
+// pre-funded the bond's payment account with the gross coupon, in the
+// settlement currency when one has been set, and fails with
+// FUNDING_SHORTFALL otherwise
+func verifyFunding(ctx contractapi.TransactionContextInterface, couponPayment *CouponPayment) error {
+	paymentAccount, err := getPaymentAccount(ctx, couponPayment.BondID)
+	if err != nil {
+		return err
+	}
+	if paymentAccount == nil {
+		return fmt.Errorf("FUNDING_SHORTFALL: bond %s has no payment account", couponPayment.BondID)
+	}
+
+	required := couponPayment.Amount
+	var currency string
+	if couponPayment.Settlement != nil {
+		required = couponPayment.Settlement.SettlementAmount
+		currency = couponPayment.Settlement.Currency
+	} else {
+		bond, err := getBond(ctx, couponPayment.BondID)
+		if err != nil {
+			return err
+		}
+		currency = bond.Currency
+	}
+
+	args := [][]byte{[]byte("BalanceOf"), []byte(paymentAccount.Account), []byte(currency)}
+	response := ctx.GetStub().InvokeChaincode(cashTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to get balance of payment account %s: %s", paymentAccount.Account, response.Message)
+	}
+	balance, err := strconv.ParseFloat(strings.TrimSpace(string(response.Payload)), 64)
+	if err != nil {
+		return fmt.Errorf("invalid balance of payment account %s: %v", paymentAccount.Account, err)
+	}
+
+	if balance < required {
+		return fmt.Errorf("FUNDING_SHORTFALL: payment account %s holds %.2f %s, %.2f required for coupon payment %s", paymentAccount.Account, balance, currency, required, couponPayment.ID)
+	}
+
+	return nil
+}
+
+// agencyFeeScheduleKey is the state key of a bond's agency fee schedule
+func agencyFeeScheduleKey(bondID string) string {
+	return "AGENCYFEES_" + bondID
+}
+
+// getAgencyFeeSchedule returns a bond's agency fee schedule, or nil if none
+// has been set
+func getAgencyFeeSchedule(ctx contractapi.TransactionContextInterface, bondID string) (*AgencyFeeSchedule, error) {
+	scheduleJSON, err := ctx.GetStub().GetState(agencyFeeScheduleKey(bondID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fee schedule: %v", err)
+	}
+	if scheduleJSON == nil {
+		return nil, nil
+	}
+
+	var schedule AgencyFeeSchedule
+	err = json.Unmarshal(scheduleJSON, &schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fee schedule: %v", err)
+	}
+
+	return &schedule, nil
+}
+
+// accrueAgencyFee records the fee the paying agent earned processing an
+// action under the bond's fee schedule, if it has one with a fee for the
+// action type
+func accrueAgencyFee(ctx contractapi.TransactionContextInterface, bondID, actionType, actionID string, amount float64, agent string) error {
+	schedule, err := getAgencyFeeSchedule(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if schedule == nil {
+		return nil
+	}
+	rate, ok := schedule.Fees[actionType]
+	if !ok {
+		return nil
+	}
+
+	accruedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	accrual := AgencyFeeAccrual{
+		BondID:       bondID,
+		ActionType:   actionType,
+		ActionID:     actionID,
+		ActionAmount: amount,
+		Currency:     schedule.Currency,
+		FlatFee:      rate.Flat,
+		AdValoremFee: roundAmount(amount * rate.BasisPoints / 10000),
+		Agent:        agent,
+		AccruedAt:    accruedAt,
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+	accrual.Amount = roundAmount(accrual.FlatFee + accrual.AdValoremFee)
+
+	key, err := ctx.GetStub().CreateCompositeKey(agencyFeeObjectType, []string{bondID, accruedAt.Format("20060102"), actionID})
+	if err != nil {
+		return fmt.Errorf("failed to create agency fee key: %v", err)
+	}
+
+	accrualJSON, err := json.Marshal(accrual)
+	if err != nil {
+		return fmt.Errorf("failed to marshal agency fee: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, accrualJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store agency fee: %v", err)
+	}
+
+	return nil
+}
+
+// getHolidayCalendar returns a holiday calendar, or nil if it does not exist
+func getHolidayCalendar(ctx contractapi.TransactionContextInterface, name string) (*HolidayCalendar, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(holidayCalendarObjectType, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create holiday calendar key: %v", err)
+	}
+
+	calendarJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holiday calendar: %v", err)
+	}
+	if calendarJSON == nil {
+		return nil, nil
+	}
+
+	var calendar HolidayCalendar
+	err = json.Unmarshal(calendarJSON, &calendar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal holiday calendar: %v", err)
+	}
+
+	return &calendar, nil
+}
+
+// putHolidayCalendar stores a holiday calendar under its name
+func putHolidayCalendar(ctx contractapi.TransactionContextInterface, calendar *HolidayCalendar) error {
+	key, err := ctx.GetStub().CreateCompositeKey(holidayCalendarObjectType, []string{calendar.Name})
+	if err != nil {
+		return fmt.Errorf("failed to create holiday calendar key: %v", err)
+	}
+
+	calendarJSON, err := json.Marshal(calendar)
+	if err != nil {
+		return fmt.Errorf("failed to marshal holiday calendar: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, calendarJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store holiday calendar: %v", err)
+	}
+
+	return nil
+}
+
+// bondHolidays returns the holidays of all the calendars a bond refers to,
+// keyed YYYY-MM-DD
+func bondHolidays(ctx contractapi.TransactionContextInterface, bond *BondInfo) (map[string]bool, error) {
+	holidays := make(map[string]bool)
+	for _, name := range bond.Terms.HolidayCalendars {
+		calendar, err := getHolidayCalendar(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if calendar == nil {
+			return nil, fmt.Errorf("holiday calendar %s of bond %s does not exist", name, bond.ID)
+		}
+		for _, date := range calendar.Holidays {
+			holidays[date] = true
+		}
+	}
+	return holidays, nil
+}
+
+// gracePeriodKey is the state key of a bond's grace period
+func gracePeriodKey(bondID string) string {
+	return "GRACE_" + bondID
+}
+
+// getGracePeriod returns a bond's grace period, or a zero-day period without
+// penalty interest if none has been set
+func getGracePeriod(ctx contractapi.TransactionContextInterface, bondID string) (*GracePeriod, error) {
+	gracePeriodJSON, err := ctx.GetStub().GetState(gracePeriodKey(bondID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grace period: %v", err)
+	}
+	if gracePeriodJSON == nil {
+		return &GracePeriod{BondID: bondID}, nil
+	}
+
+	var gracePeriod GracePeriod
+	err = json.Unmarshal(gracePeriodJSON, &gracePeriod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal grace period: %v", err)
+	}
+
+	return &gracePeriod, nil
+}
+
+// getAnnouncement returns an announcement, or nil if it does not exist
+func getAnnouncement(ctx contractapi.TransactionContextInterface, announcementID string) (*Announcement, error) {
+	announcementJSON, err := ctx.GetStub().GetState(announcementID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read announcement: %v", err)
+	}
+	if announcementJSON == nil {
+		return nil, nil
+	}
+
+	var announcement Announcement
+	err = json.Unmarshal(announcementJSON, &announcement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal announcement: %v", err)
+	}
+
+	return &announcement, nil
+}
+
+// holdersAsOf reads a bond's holders at the close of a date from BondToken
+func holdersAsOf(ctx contractapi.TransactionContextInterface, bondID string, date time.Time) ([]*HolderInfo, error) {
+	args := [][]byte{[]byte("GetBondHoldersAsOf"), []byte(bondID), []byte(date.Format("2006-01-02"))}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get holders of bond %s: %s", bondID, response.Message)
+	}
+
+	var holders []*HolderInfo
+	err := json.Unmarshal(response.Payload, &holders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal holders: %v", err)
+	}
+
+	return holders, nil
+}
+
+// holderSnapshot returns the BondToken holder register snapshot of a bond
+// for a record date, failing if none has been taken
+func holderSnapshot(ctx contractapi.TransactionContextInterface, bondID string, recordDate time.Time) (*HolderSnapshot, error) {
+	args := [][]byte{[]byte("GetHolderSnapshot"), []byte(bondID), []byte(recordDate.Format("2006-01-02"))}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get holder snapshot of bond %s for record date %s: %s", bondID, recordDate.Format("2006-01-02"), response.Message)
+	}
+
+	var snapshot HolderSnapshot
+	err := json.Unmarshal(response.Payload, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal holder snapshot: %v", err)
+	}
+
+	return &snapshot, nil
+}
+
+// emitEvent assigns a corporate action event the next sequence number of
+// its bond, stores it for GetEventsSince and sets it as the transaction
+// event. Every event of a transaction gets its own number and stored record;
+// Fabric only delivers the last one set, so consumers replay the rest with
+// GetEventsSince.
+func emitEvent(ctx contractapi.TransactionContextInterface, name string, event *CorporateActionEvent) error {
+	var eventKey string
+	if event.BondID != "" {
+		seq, err := nextEventSequence(ctx, event.BondID)
+		if err != nil {
+			return err
+		}
+		event.Sequence = seq
+
+		eventKey, err = ctx.GetStub().CreateCompositeKey(eventObjectType, []string{event.BondID, fmt.Sprintf("%020d", event.Sequence)})
+		if err != nil {
+			return fmt.Errorf("failed to create event key: %v", err)
+		}
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	if eventKey != "" {
+		err = ctx.GetStub().PutState(eventKey, eventJSON)
+		if err != nil {
+			return fmt.Errorf("failed to store event: %v", err)
+		}
+	}
+
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return nil
+}
+
+// nextEventSequence assigns and stores the next event sequence number of a
+// bond. The first event of a transaction continues from the committed
+// sequence; later ones continue from the number the transaction last used.
+func nextEventSequence(ctx contractapi.TransactionContextInterface, bondID string) (int64, error) {
+	seqKey, err := ctx.GetStub().CreateCompositeKey(eventSequenceType, []string{bondID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create event sequence key: %v", err)
+	}
+
+	txEventSequencesMu.Lock()
+	defer txEventSequencesMu.Unlock()
+
+	txID := ctx.GetStub().GetTxID()
+	sequences, ok := txEventSequences[txID]
+	if !ok {
+		// Wall-clock time only ages out this cache, it never reaches state
+		now := time.Now()
+		for id, other := range txEventSequences {
+			if now.Sub(other.started) > eventSequenceTTL {
+				delete(txEventSequences, id)
+			}
+		}
+		sequences = &eventSequences{started: now, last: make(map[string]int64)}
+		txEventSequences[txID] = sequences
+	}
+
+	seq, ok := sequences.last[bondID]
+	if !ok {
+		seqBytes, err := ctx.GetStub().GetState(seqKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read event sequence: %v", err)
+		}
+		if seqBytes != nil {
+			seq, err = strconv.ParseInt(string(seqBytes), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid event sequence for bond %s: %v", bondID, err)
+			}
+		}
+	}
+	seq++
+
+	err = ctx.GetStub().PutState(seqKey, []byte(strconv.FormatInt(seq, 10)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to store event sequence: %v", err)
+	}
+	sequences.last[bondID] = seq
+
+	return seq, nil
+}
+
+// defaultKey is the state key of a bond's default declaration
+func defaultKey(bondID string) string {
+	return "DEFAULT_" + bondID
+}
+
+// requireNotInDefault rejects corporate actions on a bond with a declared
+// credit event
+func requireNotInDefault(ctx contractapi.TransactionContextInterface, bondID string) error {
+	declaration, err := getDefaultDeclaration(ctx, bondID)
+	if err != nil {
+		return err
+	}
+	if declaration != nil && declaration.ResolvedAt.IsZero() {
+		return fmt.Errorf("bond %s is in default; only restructuring actions are permitted", bondID)
+	}
+	return nil
+}
+
+// getDefaultDeclaration returns a bond's latest default declaration, or nil
+// if it has never been in default
+func getDefaultDeclaration(ctx contractapi.TransactionContextInterface, bondID string) (*DefaultDeclaration, error) {
+	declarationJSON, err := ctx.GetStub().GetState(defaultKey(bondID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read default declaration: %v", err)
+	}
+	if declarationJSON == nil {
+		return nil, nil
+	}
+
+	var declaration DefaultDeclaration
+	err = json.Unmarshal(declarationJSON, &declaration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal default declaration: %v", err)
+	}
+
+	return &declaration, nil
+}
+
+// callerAddress returns the ledger address of the submitting client: its
+// "address" identity attribute, or its identity ID when it has none
+func callerAddress(ctx contractapi.TransactionContextInterface) (string, error) {
+	address, found, err := ctx.GetClientIdentity().GetAttributeValue("address")
+	if err != nil {
+		return "", fmt.Errorf("failed to read address attribute: %v", err)
+	}
+	if found && address != "" {
+		return address, nil
+	}
+
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+	return id, nil
+}
+
+// invokerID returns the unique ID of the submitting client's identity
+func invokerID(ctx contractapi.TransactionContextInterface) (string, error) {
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+	return id, nil
+}
+
+// invokerMSP returns the MSP ID of the submitting client
+func invokerMSP(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	return mspID, nil
+}
+
+// requireRole checks that the invoking identity carries one of the given
+// values in its "role" certificate attribute
+func requireRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	for _, role := range roles {
+		if ctx.GetClientIdentity().AssertAttributeValue("role", role) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("caller is not authorized: %s role required", strings.Join(roles, " or "))
+}
+
+// putCouponPayment bumps the coupon payment's version, records the invoker
+// MSP and stores it
+func putCouponPayment(ctx contractapi.TransactionContextInterface, couponPayment *CouponPayment) error {
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	couponPayment.UpdatedByMSP = mspID
+	couponPayment.DocType = couponObjectType
+	couponPayment.Version++
+	couponJSON, err := json.Marshal(couponPayment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal coupon payment: %v", err)
+	}
+	return putIndexed(ctx, couponObjectType, couponPayment.ID, couponPayment.BondID, couponPayment.PaymentDate, couponPayment.Status, couponJSON)
+}
+
+// putRedemption bumps the redemption's version, records the invoker MSP
+// and stores it
+func putRedemption(ctx contractapi.TransactionContextInterface, redemption *Redemption) error {
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	redemption.UpdatedByMSP = mspID
+	redemption.DocType = redemptionObjectType
+	redemption.Version++
+	redemptionJSON, err := json.Marshal(redemption)
+	if err != nil {
+		return fmt.Errorf("failed to marshal redemption: %v", err)
+	}
+	return putIndexed(ctx, redemptionObjectType, redemption.ID, redemption.BondID, redemption.RedemptionDate, redemption.Status, redemptionJSON)
+}
+
+// putAmortizationPayment bumps the amortization payment's version,
+// records the invoker MSP and stores it
+func putAmortizationPayment(ctx contractapi.TransactionContextInterface, amortization *AmortizationPayment) error {
+	mspID, err := invokerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	amortization.UpdatedByMSP = mspID
+	amortization.DocType = amortizationObjectType
+	amortization.Version++
+	amortizationJSON, err := json.Marshal(amortization)
+	if err != nil {
+		return fmt.Errorf("failed to marshal amortization payment: %v", err)
+	}
+	return putIndexed(ctx, amortizationObjectType, amortization.ID, amortization.BondID, amortization.PaymentDate, amortization.Status, amortizationJSON)
+}
+
+// putIndexed stores a coupon payment or redemption under its
+// TYPE~bondID~date~id key and keeps its ID and status index entries in step
+func putIndexed(ctx contractapi.TransactionContextInterface, objectType, id, bondID string, date time.Time, status string, value []byte) error {
+	dateKey := date.Format("20060102")
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{bondID, dateKey, id})
+	if err != nil {
+		return fmt.Errorf("failed to create %s key: %v", strings.ToLower(objectType), err)
+	}
+	idKey, err := ctx.GetStub().CreateCompositeKey(objectType+"ID", []string{id})
+	if err != nil {
+		return fmt.Errorf("failed to create %s ID index key: %v", strings.ToLower(objectType), err)
+	}
+
+	currentKey, err := ctx.GetStub().GetState(idKey)
+	if err != nil {
+		return fmt.Errorf("failed to read %s ID index: %v", strings.ToLower(objectType), err)
+	}
+	if currentKey == nil {
+		err = ctx.GetStub().PutState(idKey, []byte(key))
+		if err != nil {
+			return fmt.Errorf("failed to store %s ID index: %v", strings.ToLower(objectType), err)
+		}
+	} else if string(currentKey) != key {
+		return fmt.Errorf("%s %s is stored under a different bond or date", strings.ToLower(objectType), id)
+	} else {
+		currentJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", strings.ToLower(objectType), err)
+		}
+		var current struct {
+			Status string `json:"status"`
+		}
+		if currentJSON != nil && json.Unmarshal(currentJSON, &current) == nil && current.Status != status {
+			staleKey, err := ctx.GetStub().CreateCompositeKey(objectType+"STATUS", []string{current.Status, dateKey, id})
+			if err != nil {
+				return fmt.Errorf("failed to create %s status index key: %v", strings.ToLower(objectType), err)
+			}
+			err = ctx.GetStub().DelState(staleKey)
+			if err != nil {
+				return fmt.Errorf("failed to delete %s status index: %v", strings.ToLower(objectType), err)
+			}
+		}
+	}
+
+	statusKey, err := ctx.GetStub().CreateCompositeKey(objectType+"STATUS", []string{status, dateKey, id})
+	if err != nil {
+		return fmt.Errorf("failed to create %s status index key: %v", strings.ToLower(objectType), err)
+	}
+	err = ctx.GetStub().PutState(statusKey, []byte(key))
+	if err != nil {
+		return fmt.Errorf("failed to store %s status index: %v", strings.ToLower(objectType), err)
+	}
+
+	return ctx.GetStub().PutState(key, value)
+}
+
+// getIndexed reads a coupon payment or redemption through its ID index,
+// returning nil if it does not exist
+func getIndexed(ctx contractapi.TransactionContextInterface, objectType, id string) ([]byte, error) {
+	idKey, err := ctx.GetStub().CreateCompositeKey(objectType+"ID", []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s ID index key: %v", strings.ToLower(objectType), err)
+	}
+
+	key, err := ctx.GetStub().GetState(idKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s ID index: %v", strings.ToLower(objectType), err)
+	}
+	if key == nil {
+		return nil, nil
+	}
+
+	value, err := ctx.GetStub().GetState(string(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", strings.ToLower(objectType), err)
+	}
+	return value, nil
+}
+
+// getIndexedByStatus reads the records listed under a status in a status
+// index, in date order
+func getIndexedByStatus(ctx contractapi.TransactionContextInterface, statusIndex, status string) ([][]byte, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statusIndex, []string{status})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status index: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var records [][]byte
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		value, err := ctx.GetStub().GetState(string(queryResult.Value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read indexed record: %v", err)
+		}
+		if value != nil {
+			records = append(records, value)
+		}
+	}
+
+	return records, nil
+}
+
+// dueIndexedIDs returns the IDs of the PENDING records in a status index
+// dated on or before asOf, in date order
+func dueIndexedIDs(ctx contractapi.TransactionContextInterface, statusIndex string, asOf time.Time) ([]string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statusIndex, []string{"PENDING"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status index: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	asOfKey := asOf.Format("20060102")
+	var ids []string
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split index key: %v", err)
+		}
+		if len(attributes) != 3 {
+			return nil, fmt.Errorf("malformed status index key %q", queryResult.Key)
+		}
+		if attributes[1] > asOfKey {
+			break
+		}
+		ids = append(ids, attributes[2])
+	}
+
+	return ids, nil
+}
+
+// getIndexedPage reads one page of the records listed under a status in a
+// status index, returning the records, the number of index entries fetched
+// and the bookmark of the next page, empty on the last page
+func getIndexedPage(ctx contractapi.TransactionContextInterface, statusIndex, status string, pageSize int32, bookmark string) ([][]byte, int32, string, error) {
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(statusIndex, []string{status}, pageSize, bookmark)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("failed to query status index: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var records [][]byte
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		value, err := ctx.GetStub().GetState(string(queryResult.Value))
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("failed to read indexed record: %v", err)
+		}
+		if value != nil {
+			records = append(records, value)
+		}
+	}
+
+	nextBookmark := ""
+	if metadata.FetchedRecordsCount == pageSize {
+		nextBookmark = metadata.Bookmark
+	}
+
+	return records, metadata.FetchedRecordsCount, nextBookmark, nil
+}
+
+// getCouponPaymentsByStatus returns the coupon payments with a status, in
+// payment date order
+func getCouponPaymentsByStatus(ctx contractapi.TransactionContextInterface, status string) ([]*CouponPayment, error) {
+	records, err := getIndexedByStatus(ctx, couponStatusIndex, status)
+	if err != nil {
+		return nil, err
+	}
+
+	var couponPayments []*CouponPayment
+	for _, couponJSON := range records {
+		var couponPayment CouponPayment
+		err = json.Unmarshal(couponJSON, &couponPayment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal coupon payment: %v", err)
+		}
+		couponPayments = append(couponPayments, &couponPayment)
+	}
+
+	return couponPayments, nil
+}
+
+// putRestructuring bumps the restructuring's version and stores it
+func putRestructuring(ctx contractapi.TransactionContextInterface, restructuring *Restructuring) error {
+	restructuring.Version++
+	restructuringJSON, err := json.Marshal(restructuring)
+	if err != nil {
+		return fmt.Errorf("failed to marshal restructuring: %v", err)
+	}
+	return ctx.GetStub().PutState(restructuring.ID, restructuringJSON)
+}
+
+// putCouponReversal stores a coupon reversal record
+func putCouponReversal(ctx contractapi.TransactionContextInterface, reversal *CouponReversal) error {
+	reversalJSON, err := json.Marshal(reversal)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reversal: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(reversal.ID, reversalJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store reversal: %v", err)
+	}
+	return nil
+}
+
+// checkVersion rejects a write made against a stale view of a record. An
+// expected version of 0 skips the check.
+func checkVersion(record string, current, expected int64) error {
+	if expected != 0 && current != expected {
+		return fmt.Errorf("version conflict: %s is at version %d, expected %d", record, current, expected)
+	}
+	return nil
+}
+
+// setEntitlementDates validates and applies record and ex dates. The ex date
+// may be empty; otherwise it must not fall after the record date.
+func setEntitlementDates(info *EntitlementInfo, recordDateStr, exDateStr string, paymentDate time.Time) error {
+	if info.SnapshotTxID != "" {
+		return fmt.Errorf("entitlements have already been taken")
+	}
+
+	recordDate, err := time.Parse("2006-01-02", recordDateStr)
+	if err != nil {
+		return fmt.Errorf("invalid record date format: %v", err)
+	}
+	if recordDate.After(paymentDate) {
+		return fmt.Errorf("record date cannot be after the payment date")
+	}
+
+	var exDate time.Time
+	if exDateStr != "" {
+		exDate, err = time.Parse("2006-01-02", exDateStr)
+		if err != nil {
+			return fmt.Errorf("invalid ex date format: %v", err)
+		}
+		if exDate.After(recordDate) {
+			return fmt.Errorf("ex date cannot be after the record date")
+		}
+	}
+
+	info.RecordDate = recordDate
+	info.ExDate = exDate
+	return nil
+}
+
+// snapshotEntitlements reads the bond's holders at the close of the record
+// date from BondToken and stores each holder's pro-rata share of amount.
+// For a coupon, tokens tapped mid-period earn only the part of the period
+// after their settlement date, and entitlements are net of withholding tax.
+func snapshotEntitlements(ctx contractapi.TransactionContextInterface, actionID, bondID string, amount float64, coupon *CouponPayment, info *EntitlementInfo) error {
+	if info.RecordDate.IsZero() {
+		return fmt.Errorf("%s has no record date", actionID)
+	}
+	if info.SnapshotTxID != "" {
+		return fmt.Errorf("entitlements for %s have already been taken", actionID)
+	}
+
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	if txTime.Before(info.RecordDate.AddDate(0, 0, 1)) {
+		return fmt.Errorf("record date %s has not closed yet", info.RecordDate.Format("2006-01-02"))
+	}
+
+	// Holdings come only from the record-date snapshot, never the live
+	// register, so later transfers cannot change who is paid
+	snapshot, err := holderSnapshot(ctx, bondID, info.RecordDate)
+	if err != nil {
+		return err
+	}
+
+	entitlements, err := computeEntitlements(ctx, actionID, bondID, amount, coupon, info.RecordDate, snapshot.Holders)
+	if err != nil {
+		return err
+	}
+
+	info.EntitledAmount = 0
+	for _, entitlement := range entitlements {
+		entitlement.TxID = ctx.GetStub().GetTxID()
+		entitlementJSON, err := json.Marshal(entitlement)
+		if err != nil {
+			return fmt.Errorf("failed to marshal entitlement: %v", err)
+		}
+
+		key, err := ctx.GetStub().CreateCompositeKey("ENTITLEMENT", []string{actionID, entitlement.Address})
+		if err != nil {
+			return fmt.Errorf("failed to create entitlement key: %v", err)
+		}
+
+		err = ctx.GetStub().PutState(key, entitlementJSON)
+		if err != nil {
+			return fmt.Errorf("failed to store entitlement: %v", err)
+		}
+		info.EntitledAmount += entitlement.Amount
+	}
+
+	info.HolderCount = len(entitlements)
+	info.EntitledAmount = roundAmount(info.EntitledAmount)
+	info.SnapshotTxID = ctx.GetStub().GetTxID()
+	info.HolderSnapshotTxID = snapshot.TxID
+	return nil
+}
+
+// computeEntitlements works out each holder's pro-rata share of amount
+// from the bond's holders at the close of recordDate, without storing it
+func computeEntitlements(ctx contractapi.TransactionContextInterface, actionID, bondID string, amount float64, coupon *CouponPayment, recordDate time.Time, holders []*HolderInfo) ([]*Entitlement, error) {
+	var totalQuantity int64
+	for _, holder := range holders {
+		totalQuantity += holder.Quantity
+	}
+	if totalQuantity == 0 {
+		return nil, fmt.Errorf("bond %s had no holders on %s", bondID, recordDate.Format("2006-01-02"))
+	}
+
+	entitlements := make([]*Entitlement, 0, len(holders))
+	for _, holder := range holders {
+		accrualQuantity := float64(holder.Quantity)
+		if coupon != nil {
+			accrualQuantity = accruingQuantity(holder, coupon)
+		}
+
+		entitlement := &Entitlement{
+			ActionID:   actionID,
+			BondID:     bondID,
+			Address:    holder.Address,
+			Quantity:   holder.Quantity,
+			Amount:     roundAmount(amount * accrualQuantity / float64(totalQuantity)),
+			RecordDate: recordDate,
+		}
+		if accrualQuantity < float64(holder.Quantity) {
+			entitlement.AccrualQuantity = accrualQuantity
+		}
+		entitlement.NetAmount = entitlement.Amount
+
+		if coupon != nil {
+			err := applyWithholding(ctx, entitlement)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		entitlements = append(entitlements, entitlement)
+	}
+
+	return entitlements, nil
+}
+
+// accruingQuantity is the number of tokens a holder earns a full coupon on:
+// tap lots settled after the start of the coupon's accrual period count only
+// for the fraction of the period since their settlement date
+func accruingQuantity(holder *HolderInfo, coupon *CouponPayment) float64 {
+	return accruedQuantity(holder, coupon, coupon.PeriodEnd)
+}
+
+// accruedQuantity is the number of tokens whose full coupon a holder has
+// accrued by through, counting each token for the fraction of the coupon
+// period it has accrued: from the period start, or from the settlement date
+// of a tap lot settled during the period
+func accruedQuantity(holder *HolderInfo, coupon *CouponPayment, through time.Time) float64 {
+	quantity := float64(holder.Quantity)
+	if coupon.PeriodStart.IsZero() || !coupon.PeriodEnd.After(coupon.PeriodStart) {
+		return quantity
+	}
+	if through.After(coupon.PeriodEnd) {
+		through = coupon.PeriodEnd
+	}
+
+	period := yearFraction(coupon.PeriodStart, coupon.PeriodEnd, coupon.DayCount)
+	fraction := func(from time.Time) float64 {
+		if !through.After(from) {
+			return 0
+		}
+		return yearFraction(from, through, coupon.DayCount) / period
+	}
+
+	accrued := quantity * fraction(coupon.PeriodStart)
+	for _, lot := range holder.TapLots {
+		if !lot.AccrualStart.After(coupon.PeriodStart) {
+			continue
+		}
+		accrued -= float64(lot.Quantity) * (fraction(coupon.PeriodStart) - fraction(lot.AccrualStart))
+	}
+	return accrued
+}
+
+// applyWithholding looks up the holder's tax profile in the Compliance
+// contract and deducts the matching withholding rate from the entitlement.
+// Holders without a KYC record are assessed under the UNKNOWN jurisdiction,
+// which falls through to the DEFAULT rate.
+func applyWithholding(ctx contractapi.TransactionContextInterface, entitlement *Entitlement) error {
+	profile := TaxProfile{Jurisdiction: "UNKNOWN", Classification: "INDIVIDUAL"}
+
+	args := [][]byte{[]byte("GetTaxProfile"), []byte(entitlement.Address)}
+	response := ctx.GetStub().InvokeChaincode(complianceChaincode, args, "")
+	if response.Status == shim.OK {
+		err := json.Unmarshal(response.Payload, &profile)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal tax profile: %v", err)
+		}
+	}
+
+	entitlement.TaxJurisdiction = profile.Jurisdiction
+	entitlement.TaxClassification = profile.Classification
+
+	withholdingRate, err := lookupWithholdingRate(ctx, profile.Jurisdiction, profile.Classification)
+	if err != nil {
+		return err
+	}
+	if withholdingRate == nil || profile.Classification == "EXEMPT" {
+		return nil
+	}
+
+	entitlement.WithholdingRate = withholdingRate.Rate
+	entitlement.WithholdingTax = roundAmount(entitlement.Amount * withholdingRate.Rate / 100)
+	entitlement.NetAmount = roundAmount(entitlement.Amount - entitlement.WithholdingTax)
+	return nil
+}
+
+// parsePeriod returns the [from, to) date range of a "YYYY", "YYYY-Qn" or
+// "YYYY-MM" period
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	if year, err := time.Parse("2006", period); err == nil {
+		return year, year.AddDate(1, 0, 0), nil
+	}
+	if month, err := time.Parse("2006-01", period); err == nil {
+		return month, month.AddDate(0, 1, 0), nil
+	}
+	var year, quarter int
+	_, err := fmt.Sscanf(period, "%d-Q%d", &year, &quarter)
+	if err == nil && quarter >= 1 && quarter <= 4 {
+		from := time.Date(year, time.Month(3*quarter-2), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 3, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid period: %s", period)
+}
+
+// txTimestamp returns the timestamp the client set in the transaction
+// proposal, so every endorsing peer computes the same dates from it
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// scheduledCouponAmount returns the coupon due on the whole issue for a
+// period with the given accrual factor, at an annual rate in percent
+func scheduledCouponAmount(bond *BondInfo, rate, accrual float64) float64 {
+	return roundAmount(outstandingPrincipal(bond) * rate / 100 * accrual * float64(bond.TotalSupply))
+}
+
+// withinCouponTolerance reports whether a coupon amount matches the amount
+// computed from the bond terms, allowing for rounding by the issuer
+func withinCouponTolerance(amount, expected float64) bool {
+	return math.Abs(amount-expected) <= math.Max(0.01, expected*couponAmountTolerance)
+}
+
+// outstandingPrincipal returns the principal still owed per token, treating
+// bonds issued before amortization was introduced as unamortized
+func outstandingPrincipal(bond *BondInfo) float64 {
+	if bond.OutstandingFaceValue == 0 && len(bond.Amortization) == 0 {
+		return bond.FaceValue
+	}
+	return bond.OutstandingFaceValue
+}
+
+// couponConventions returns the bond's coupon frequency and day count,
+// defaulting to semi-annual 30/360
+func couponConventions(bond *BondInfo) (int, string) {
+	frequency := bond.Terms.CouponFrequency
+	if frequency == 0 {
+		frequency = 2
+	}
+	dayCount := bond.Terms.DayCount
+	if dayCount == "" {
+		dayCount = "30/360"
+	}
+	return frequency, dayCount
+}
+
+// accruedInterest returns the coupon accrued per token from the last coupon
+// date up to asOf
+func accruedInterest(bond *BondInfo, asOf time.Time) float64 {
+	if bond.BondType == "ZERO_COUPON" {
+		return 0
+	}
+
+	frequency, dayCount := couponConventions(bond)
+	issueDate := bond.IssueDate.Truncate(24 * time.Hour)
+	lastCoupon := issueDate
+	for _, periodEnd := range couponPeriodEnds(issueDate, bond.MaturityDate, 12/frequency) {
+		if periodEnd.After(asOf) {
+			break
+		}
+		lastCoupon = periodEnd
+	}
+
+	return outstandingPrincipal(bond) * bond.CouponRate / 100 * yearFraction(lastCoupon, asOf, dayCount)
+}
+
+// openPutWindow returns the put window open at a time, or nil if none is
+func openPutWindow(schedule []PutWindow, at time.Time) (*PutWindow, error) {
+	for i, window := range schedule {
+		windowStart, err := time.Parse("2006-01-02", window.WindowStart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid put window start: %v", err)
+		}
+		windowEnd, err := time.Parse("2006-01-02", window.WindowEnd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid put window end: %v", err)
+		}
+		// The window stays open for the whole of its last day
+		if !at.Before(windowStart) && at.Before(windowEnd.AddDate(0, 0, 1)) {
+			return &schedule[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// conversionOpen reports whether a bond's conversion window is open at a
+// time. The window stays open for the whole of its last day.
+func conversionOpen(terms CouponTerms, at time.Time) (bool, error) {
+	conversionStart, err := time.Parse("2006-01-02", terms.ConversionStart)
+	if err != nil {
+		return false, fmt.Errorf("invalid conversion start: %v", err)
+	}
+	conversionEnd, err := time.Parse("2006-01-02", terms.ConversionEnd)
+	if err != nil {
+		return false, fmt.Errorf("invalid conversion end: %v", err)
+	}
+	return !at.Before(conversionStart) && at.Before(conversionEnd.AddDate(0, 0, 1)), nil
+}
+
+// getBalance reads a holder's token balance from the BondToken contract
+func getBalance(ctx contractapi.TransactionContextInterface, bondID, address string) (int64, error) {
+	args := [][]byte{[]byte("GetBalance"), []byte(address), []byte(bondID)}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return 0, fmt.Errorf("failed to get balance of %s: %s", address, response.Message)
+	}
+
+	balance, err := strconv.ParseInt(string(response.Payload), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse balance: %v", err)
+	}
+
+	return balance, nil
+}
+
+// scheduledCallPrice returns the call price in effect on a date, or 0 if the
+// bond cannot be called then
+func scheduledCallPrice(schedule []CallPeriod, date time.Time) (float64, error) {
+	price := 0.0
+	for _, period := range schedule {
+		startDate, err := time.Parse("2006-01-02", period.StartDate)
+		if err != nil {
+			return 0, fmt.Errorf("invalid call schedule date: %v", err)
+		}
+		if startDate.After(date) {
+			break
+		}
+		price = period.Price
+	}
+	return price, nil
+}
+
+// floatingRate adds the FRN spread to a benchmark rate and applies the
+// bond's cap and floor
+func floatingRate(terms CouponTerms, benchmarkRate float64) *RateFixing {
+	fixing := &RateFixing{
+		BenchmarkIndex: terms.BenchmarkIndex,
+		BenchmarkRate:  benchmarkRate,
+		Spread:         terms.Spread,
+		Rate:           benchmarkRate + terms.Spread/100,
+	}
+	if terms.RateCap > 0 && fixing.Rate > terms.RateCap {
+		fixing.Rate = terms.RateCap
+		fixing.Capped = true
+	}
+	if fixing.Rate < terms.RateFloor {
+		fixing.Rate = terms.RateFloor
+		fixing.Floored = true
+	}
+	return fixing
+}
+
+// couponSchedule returns the PENDING coupon payments for every coupon period
+// of a bond from issue to maturity, paid on business days given the bond's
+// holidays
+func couponSchedule(bond *BondInfo, holidays map[string]bool) []*CouponPayment {
+	frequency, dayCount := couponConventions(bond)
+
+	// Accrual runs from the start of the issue day
+	issueDate := bond.IssueDate.Truncate(24 * time.Hour)
+	periodEnds := couponPeriodEnds(issueDate, bond.MaturityDate, 12/frequency)
+
+	var schedule []*CouponPayment
+	periodStart := issueDate
+	for _, periodEnd := range periodEnds {
+		paymentDate := adjustBusinessDay(periodEnd, bond.Terms.BusinessDayConvention, holidays)
+		accrual := yearFraction(periodStart, periodEnd, dayCount)
+
+		schedule = append(schedule, &CouponPayment{
+			ID:            couponIDFor(bond.ID, paymentDate),
+			BondID:        bond.ID,
+			PaymentDate:   paymentDate,
+			Amount:        scheduledCouponAmount(bond, bond.CouponRate, accrual),
+			Status:        "PENDING",
+			Metadata:      make(map[string]string),
+			PeriodStart:   periodStart,
+			PeriodEnd:     periodEnd,
+			DayCount:      dayCount,
+			AccrualFactor: accrual,
+			CouponRate:    bond.CouponRate,
+		})
+		periodStart = periodEnd
+	}
+
+	return schedule
+}
+
+// couponIDFor returns the ID of a bond's coupon payment due on a date.
+// IDs are derived from the payment date, never the clock, so every endorser
+// computes the same ID and a second payment for the same period is
+// rejected instead of overwriting the first.
+func couponIDFor(bondID string, paymentDate time.Time) string {
+	return fmt.Sprintf("COUPON_%s_%s", bondID, paymentDate.Format("20060102"))
+}
+
+// redemptionIDFor returns the ID of a bond's redemption on a date
+func redemptionIDFor(bondID string, redemptionDate time.Time) string {
+	return fmt.Sprintf("REDEMPTION_%s_%s", bondID, redemptionDate.Format("20060102"))
+}
+
+// amortizationIDFor returns the ID of a bond's amortization payment on a date
+func amortizationIDFor(bondID string, paymentDate time.Time) string {
+	return fmt.Sprintf("AMORTIZATION_%s_%s", bondID, paymentDate.Format("20060102"))
+}
+
+// couponPeriodEnds returns the unadjusted end date of every coupon period
+// between issue and maturity, stepping back from maturity in whole months
+func couponPeriodEnds(issueDate, maturityDate time.Time, months int) []time.Time {
+	var ends []time.Time
+	for i := 0; ; i++ {
+		end := addMonths(maturityDate, -months*i)
+		if !end.After(issueDate) {
+			break
+		}
+		ends = append([]time.Time{end}, ends...)
+	}
+	return ends
+}
+
+// addMonths moves a date by whole months, clamping the day to the last day
+// of the target month: a month before 31 March is 28 or 29 February, where
+// time.AddDate would normalise it to early March
+func addMonths(date time.Time, months int) time.Time {
+	first := time.Date(date.Year(), date.Month(), 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location())
+	first = first.AddDate(0, months, 0)
+	day := date.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// adjustBusinessDay moves a date that is not a business day according to
+// the business-day convention: FOLLOWING rolls it to the next business day,
+// PRECEDING to the previous one, and MODIFIED_FOLLOWING to the next one
+// unless that is in the following month, when it rolls back instead.
+// UNADJUSTED leaves it as it is. An empty convention means FOLLOWING.
+func adjustBusinessDay(date time.Time, convention string, holidays map[string]bool) time.Time {
+	roll := func(d time.Time, days int) time.Time {
+		for !isBusinessDay(d, holidays) {
+			d = d.AddDate(0, 0, days)
+		}
+		return d
+	}
+
+	switch convention {
+	case "UNADJUSTED":
+		return date
+	case "PRECEDING":
+		return roll(date, -1)
+	case "MODIFIED_FOLLOWING":
+		adjusted := roll(date, 1)
+		if adjusted.Month() != date.Month() {
+			adjusted = roll(date, -1)
+		}
+		return adjusted
+	default:
+		return roll(date, 1)
+	}
+}
+
+// isBusinessDay reports whether payments can be made on a date, i.e. it is
+// not a Saturday, Sunday or one of the holidays, keyed YYYY-MM-DD
+func isBusinessDay(date time.Time, holidays map[string]bool) bool {
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return false
+	}
+	return !holidays[date.Format("2006-01-02")]
+}
+
+// yearFraction returns the fraction of a year between two dates under a
+// day-count convention. ACT/ACT follows the ISDA method, splitting the
+// period at year ends.
+func yearFraction(start, end time.Time, dayCount string) float64 {
+	days := end.Sub(start).Hours() / 24
+	switch dayCount {
+	case "ACT/360":
+		return days / 360
+	case "ACT/365":
+		return days / 365
+	case "ACT/ACT":
+		fraction := 0.0
+		for from := start; from.Before(end); {
+			yearEnd := time.Date(from.Year()+1, 1, 1, 0, 0, 0, 0, from.Location())
+			to := end
+			if yearEnd.Before(end) {
+				to = yearEnd
+			}
+			daysInYear := 365.0
+			if isLeapYear(from.Year()) {
+				daysInYear = 366
+			}
+			fraction += to.Sub(from).Hours() / 24 / daysInYear
+			from = to
+		}
+		return fraction
+	default:
+		d1, d2 := start.Day(), end.Day()
+		if d1 == 31 {
+			d1 = 30
+		}
+		if d2 == 31 && d1 == 30 {
+			d2 = 30
+		}
+		return float64(360*(end.Year()-start.Year())+30*(int(end.Month())-int(start.Month()))+d2-d1) / 360
+	}
+}
+
+// isLeapYear reports whether a year has 366 days
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// recordAttempt appends an outcome to a coupon payment's attempt history.
+// Each failure closes an attempt, so entries after it belong to the next one.
+func recordAttempt(couponPayment *CouponPayment, outcome, reasonCode, txID string, at time.Time) {
+	attempt := 1
+	for _, previous := range couponPayment.Attempts {
+		if previous.Outcome == "FAILED" {
+			attempt++
+		}
+	}
+	couponPayment.Attempts = append(couponPayment.Attempts, PaymentAttempt{
+		Attempt:    attempt,
+		Outcome:    outcome,
+		ReasonCode: reasonCode,
+		At:         at,
+		TxID:       txID,
+	})
+}
+
+// roundAmount rounds a cash amount to two decimal places
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// sortDueActions orders due actions by due date, then by ID
+func sortDueActions(dueActions []*DueAction) {
+	sort.SliceStable(dueActions, func(i, j int) bool {
+		if !dueActions[i].DueDate.Equal(dueActions[j].DueDate) {
+			return dueActions[i].DueDate.Before(dueActions[j].DueDate)
+		}
+		return dueActions[i].ID < dueActions[j].ID
+	})
+}
+
+// getBond reads a bond from the BondToken contract
+func getBond(ctx contractapi.TransactionContextInterface, bondID string) (*BondInfo, error) {
+	args := [][]byte{[]byte("GetBond"), []byte(bondID)}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get bond %s: %s", bondID, response.Message)
+	}
+
+	var bond BondInfo
+	err := json.Unmarshal(response.Payload, &bond)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bond: %v", err)
+	}
 
-// Helper function to check if string contains substring
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || (len(s) > len(substr) && s[:len(substr)] == substr))
+	return &bond, nil
 }
 
 func main() {
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -31,11 +37,70 @@ func (m *MockStub) PutState(key string, value []byte) error {
 	return args.Error(0)
 }
 
+func (m *MockStub) DelState(key string) error {
+	args := m.Called(key)
+	delete(m.state, key)
+	return args.Error(0)
+}
+
 func (m *MockStub) GetStateByRange(startKey, endKey string) (contractapi.StateQueryIteratorInterface, error) {
 	args := m.Called(startKey, endKey)
 	return args.Get(0).(contractapi.StateQueryIteratorInterface), args.Error(1)
 }
 
+func (m *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	args := m.Called()
+	return args.Get(0).(*timestamp.Timestamp), args.Error(1)
+}
+
+func (m *MockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return compositeKey(objectType, attributes...), nil
+}
+
+func (m *MockStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	parts := strings.Split(strings.Trim(compositeKey, "\x00"), "\x00")
+	return parts[0], parts[1:], nil
+}
+
+func (m *MockStub) GetStateByPartialCompositeKey(objectType string, keys []string) (contractapi.StateQueryIteratorInterface, error) {
+	args := m.Called(objectType, keys)
+	return args.Get(0).(contractapi.StateQueryIteratorInterface), args.Error(1)
+}
+
+func (m *MockStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (contractapi.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	args := m.Called(objectType, keys, pageSize, bookmark)
+	return args.Get(0).(contractapi.StateQueryIteratorInterface), args.Get(1).(*peer.QueryResponseMetadata), args.Error(2)
+}
+
+// compositeKey builds a composite key using the same encoding as the Fabric shim
+func compositeKey(objectType string, attributes ...string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
+}
+
+// mockIndexed mocks the ID index lookup and composite key read of a stored
+// coupon payment or redemption
+func mockIndexed(ctx *MockContext, objectType string, value []byte) {
+	var record struct {
+		ID             string    `json:"id"`
+		BondID         string    `json:"bondId"`
+		PaymentDate    time.Time `json:"paymentDate"`
+		RedemptionDate time.Time `json:"redemptionDate"`
+	}
+	json.Unmarshal(value, &record)
+
+	date := record.PaymentDate
+	if objectType == "REDEMPTION" {
+		date = record.RedemptionDate
+	}
+	key := compositeKey(objectType, record.BondID, date.Format("20060102"), record.ID)
+	ctx.stub.On("GetState", compositeKey(objectType+"ID", record.ID)).Return([]byte(key), nil)
+	ctx.stub.On("GetState", key).Return(value, nil)
+}
+
 func (m *MockStub) GetTxID() string {
 	args := m.Called()
 	return args.String(0)
@@ -46,10 +111,65 @@ func (m *MockStub) SetEvent(name string, payload []byte) error {
 	return args.Error(0)
 }
 
+func (m *MockStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	called := m.Called(chaincodeName, args, channel)
+	return called.Get(0).(peer.Response)
+}
+
+func (m *MockStub) GetHistoryForKey(key string) (contractapi.HistoryQueryIteratorInterface, error) {
+	args := m.Called(key)
+	return args.Get(0).(contractapi.HistoryQueryIteratorInterface), args.Error(1)
+}
+
 // MockContext is a mock implementation of the transaction context
 type MockContext struct {
 	mock.Mock
-	stub *MockStub
+	stub     *MockStub
+	identity *MockClientIdentity // defaults to a client of Org1MSP without attributes
+}
+
+func (m *MockContext) GetClientIdentity() cid.ClientIdentity {
+	if m.identity != nil {
+		return m.identity
+	}
+	return &MockClientIdentity{id: "client", mspID: "Org1MSP"}
+}
+
+// MockClientIdentity is a fixed client identity
+type MockClientIdentity struct {
+	id         string
+	mspID      string
+	attributes map[string]string
+}
+
+// payingAgent is a client holding the PAYING_AGENT role
+var payingAgent = &MockClientIdentity{id: "agent", mspID: "AgentMSP", attributes: map[string]string{"role": "PAYING_AGENT"}}
+
+// trustee is a client holding the TRUSTEE role
+var trustee = &MockClientIdentity{id: "trustee", mspID: "TrusteeMSP", attributes: map[string]string{"role": "TRUSTEE"}}
+
+func (m *MockClientIdentity) GetID() (string, error) {
+	return m.id, nil
+}
+
+func (m *MockClientIdentity) GetMSPID() (string, error) {
+	return m.mspID, nil
+}
+
+func (m *MockClientIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := m.attributes[name]
+	return value, found, nil
+}
+
+func (m *MockClientIdentity) AssertAttributeValue(name, value string) error {
+	if m.attributes[name] != value {
+		return fmt.Errorf("attribute %s does not have value %s", name, value)
+	}
+	return nil
+}
+
+func (m *MockClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
 }
 
 func (m *MockContext) GetStub() contractapi.TransactionContextInterface {
@@ -64,22 +184,55 @@ func (m *MockContext) PutState(key string, value []byte) error {
 	return m.stub.PutState(key, value)
 }
 
+func (m *MockContext) DelState(key string) error {
+	return m.stub.DelState(key)
+}
+
 func (m *MockContext) GetStateByRange(startKey, endKey string) (contractapi.StateQueryIteratorInterface, error) {
 	return m.stub.GetStateByRange(startKey, endKey)
 }
 
+func (m *MockContext) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return m.stub.CreateCompositeKey(objectType, attributes)
+}
+
+func (m *MockContext) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	return m.stub.SplitCompositeKey(compositeKey)
+}
+
+func (m *MockContext) GetStateByPartialCompositeKey(objectType string, keys []string) (contractapi.StateQueryIteratorInterface, error) {
+	return m.stub.GetStateByPartialCompositeKey(objectType, keys)
+}
+
+func (m *MockContext) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (contractapi.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	return m.stub.GetStateByPartialCompositeKeyWithPagination(objectType, keys, pageSize, bookmark)
+}
+
 func (m *MockContext) GetTxID() string {
 	return m.stub.GetTxID()
 }
 
+func (m *MockContext) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return m.stub.GetTxTimestamp()
+}
+
+func (m *MockContext) GetHistoryForKey(key string) (contractapi.HistoryQueryIteratorInterface, error) {
+	return m.stub.GetHistoryForKey(key)
+}
+
 func (m *MockContext) SetEvent(name string, payload []byte) error {
 	return m.stub.SetEvent(name, payload)
 }
 
+func (m *MockContext) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	return m.stub.InvokeChaincode(chaincodeName, args, channel)
+}
+
 // MockIterator is a mock implementation of the state query iterator
 type MockIterator struct {
 	mock.Mock
 	results [][]byte
+	keys    []string // optional; defaults to key_<n>
 	index   int
 }
 
@@ -96,6 +249,9 @@ func (m *MockIterator) Next() (*contractapi.QueryResult, error) {
 		Key:   fmt.Sprintf("key_%d", m.index),
 		Value: m.results[m.index],
 	}
+	if m.keys != nil {
+		result.Key = m.keys[m.index]
+	}
 	m.index++
 	return result, nil
 }
@@ -105,6 +261,28 @@ func (m *MockIterator) Close() error {
 	return args.Error(0)
 }
 
+// MockHistoryIterator is a mock implementation of the key history iterator
+type MockHistoryIterator struct {
+	mock.Mock
+	modifications []*queryresult.KeyModification
+	index         int
+}
+
+func (m *MockHistoryIterator) HasNext() bool {
+	return m.index < len(m.modifications)
+}
+
+func (m *MockHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	modification := m.modifications[m.index]
+	m.index++
+	return modification, nil
+}
+
+func (m *MockHistoryIterator) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func TestCorporateAction_Init(t *testing.T) {
 	ca := &CorporateAction{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
@@ -115,31 +293,113 @@ func TestCorporateAction_Init(t *testing.T) {
 
 func TestCorporateAction_CreateCouponPayment(t *testing.T) {
 	ca := &CorporateAction{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
 	
+	bond := BondInfo{
+		ID:           "BOND_001",
+		FaceValue:    1000.0,
+		CouponRate:   5.0,
+		IssueDate:    time.Date(2023, 12, 3, 0, 0, 0, 0, time.UTC),
+		MaturityDate: time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC),
+		TotalSupply:  2,
+		BondType:     "FIXED",
+		Status:       "ACTIVE",
+	}
+	bondJSON, _ := json.Marshal(bond)
+
 	// Mock the stub methods
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
 	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
 	ctx.stub.On("GetTxID").Return("tx123")
 	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
 	
-	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-06-01", 50.0)
+	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-06-03", 50.0)
 	assert.NoError(t, err)
 	
 	ctx.stub.AssertExpectations(t)
 }
 
+func TestCorporateAction_CreateCouponPayment_Mispriced(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	bond := BondInfo{
+		ID:           "BOND_001",
+		FaceValue:    1000.0,
+		CouponRate:   5.0,
+		IssueDate:    time.Date(2023, 12, 3, 0, 0, 0, 0, time.UTC),
+		MaturityDate: time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC),
+		TotalSupply:  2,
+		BondType:     "FIXED",
+		Status:       "ACTIVE",
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+
+	// A full year's coupon for a semi-annual period
+	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-06-03", 100.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match the 50.00 due")
+
+	// Not a coupon date
+	err = ca.CreateCouponPayment(ctx, "BOND_001", "2024-07-01", 50.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not a coupon date")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestWithinCouponTolerance(t *testing.T) {
+	assert.True(t, withinCouponTolerance(50.0, 50.0))
+	assert.True(t, withinCouponTolerance(50.04, 50.0))
+	assert.False(t, withinCouponTolerance(50.06, 50.0))
+	assert.True(t, withinCouponTolerance(5.01, 5.0))
+	assert.True(t, withinCouponTolerance(250050.0, 250000.0))
+	assert.False(t, withinCouponTolerance(250300.0, 250000.0))
+}
+
 func TestCorporateAction_CreateCouponPayment_InvalidDate(t *testing.T) {
 	ca := &CorporateAction{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
 	
 	err := ca.CreateCouponPayment(ctx, "BOND_001", "invalid-date", 50.0)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid payment date format")
 }
 
-func TestCorporateAction_ProcessCouponPayment(t *testing.T) {
+func TestCorporateAction_CreateCouponPayment_NotPayingAgent(t *testing.T) {
 	ca := &CorporateAction{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-06-03", 50.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_CreateCouponPayment_InDefault(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	// The declaration stands even if the bond's status was moved back
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000.0, CouponRate: 5.0, BondType: "FIXED", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	declaration := DefaultDeclaration{BondID: "BOND_001", EventType: "FAILURE_TO_PAY"}
+	declarationJSON, _ := json.Marshal(declaration)
+	ctx.stub.On("GetState", "DEFAULT_BOND_001").Return(declarationJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+
+	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-06-03", 50.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only restructuring actions are permitted")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_ProcessCouponPayment(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
 	
 	// Create a coupon payment first
 	couponPayment := CouponPayment{
@@ -151,20 +411,41 @@ func TestCorporateAction_ProcessCouponPayment(t *testing.T) {
 	}
 	
 	couponJSON, _ := json.Marshal(couponPayment)
-	ctx.stub.On("GetState", "COUPON_BOND_001_20240601").Return(couponJSON, nil)
-	ctx.stub.On("PutState", "COUPON_BOND_001_20240601", mock.Anything).Return(nil)
+	mockIndexed(ctx, "COUPON", couponJSON)
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", Currency: "USD", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	paymentAccountJSON, _ := json.Marshal(PaymentAccount{BondID: "BOND_001", Account: "ISSUER_001_PAYMENTS"})
+	ctx.stub.On("GetState", "PAYMENTACCOUNT_BOND_001").Return(paymentAccountJSON, nil)
+	ctx.stub.On("InvokeChaincode", "cashtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: []byte("1000.00")})
+	ctx.stub.On("GetState", "AGENCYFEES_BOND_001").Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
 	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC).Unix()}, nil)
 	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return(nil, nil)
 	
 	err := ca.ProcessCouponPayment(ctx, "COUPON_BOND_001_20240601")
 	assert.NoError(t, err)
+
+	var instruction PaymentInstruction
+	json.Unmarshal(ctx.stub.state["PAYMENTINSTRUCTION_COUPON_BOND_001_20240601"], &instruction)
+	assert.Equal(t, "ISSUER_001", instruction.PaymentInfo.Debtor.ID)
+	assert.Len(t, instruction.PaymentInfo.CreditTransfers, 1)
+	assert.Equal(t, InstructedAmount{Currency: "USD", Value: 50.0}, instruction.PaymentInfo.CreditTransfers[0].Amount)
+
+	var stored CouponPayment
+	json.Unmarshal(ctx.stub.state[compositeKey("COUPON", "BOND_001", couponPayment.PaymentDate.Format("20060102"), "COUPON_BOND_001_20240601")], &stored)
+	assert.Equal(t, "PAID", stored.Status)
+	assert.Equal(t, "agent", stored.ProcessedBy)
 	
 	ctx.stub.AssertExpectations(t)
 }
 
 func TestCorporateAction_ProcessCouponPayment_NotPending(t *testing.T) {
 	ca := &CorporateAction{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
 	
 	// Create a coupon payment with non-pending status
 	couponPayment := CouponPayment{
@@ -176,7 +457,7 @@ func TestCorporateAction_ProcessCouponPayment_NotPending(t *testing.T) {
 	}
 	
 	couponJSON, _ := json.Marshal(couponPayment)
-	ctx.stub.On("GetState", "COUPON_BOND_001_20240601").Return(couponJSON, nil)
+	mockIndexed(ctx, "COUPON", couponJSON)
 	
 	err := ca.ProcessCouponPayment(ctx, "COUPON_BOND_001_20240601")
 	assert.Error(t, err)
@@ -191,6 +472,11 @@ func TestCorporateAction_CreateRedemption(t *testing.T) {
 	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
 	ctx.stub.On("GetTxID").Return("tx123")
 	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", "DEFAULT_BOND_001").Return(nil, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	bond := BondInfo{ID: "BOND_001", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
 	
 	err := ca.CreateRedemption(ctx, "BOND_001", "2029-01-01", 1000.0)
 	assert.NoError(t, err)
@@ -198,6 +484,21 @@ func TestCorporateAction_CreateRedemption(t *testing.T) {
 	ctx.stub.AssertExpectations(t)
 }
 
+func TestCorporateAction_CreateRedemption_Matured(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	bond := BondInfo{ID: "BOND_001", Status: "MATURED"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	err := ca.CreateRedemption(ctx, "BOND_001", "2029-01-01", 1000.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bond BOND_001 is MATURED")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
 func TestCorporateAction_CreateRedemption_InvalidDate(t *testing.T) {
 	ca := &CorporateAction{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
@@ -209,7 +510,7 @@ func TestCorporateAction_CreateRedemption_InvalidDate(t *testing.T) {
 
 func TestCorporateAction_ProcessRedemption(t *testing.T) {
 	ca := &CorporateAction{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
 	
 	// Create a redemption first
 	redemption := Redemption{
@@ -221,20 +522,101 @@ func TestCorporateAction_ProcessRedemption(t *testing.T) {
 	}
 	
 	redemptionJSON, _ := json.Marshal(redemption)
-	ctx.stub.On("GetState", "REDEMPTION_BOND_001_20290101").Return(redemptionJSON, nil)
-	ctx.stub.On("PutState", "REDEMPTION_BOND_001_20290101", mock.Anything).Return(nil)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", Currency: "USD", FaceValue: 10.0, TotalSupply: 100, Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
 	ctx.stub.On("GetTxID").Return("tx123")
 	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return(nil, nil)
+	ctx.stub.On("GetState", "DEFAULT_BOND_001").Return(nil, nil)
+	ctx.stub.On("GetState", "AGENCYFEES_BOND_001").Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2029, 1, 1, 9, 0, 0, 0, time.UTC).Unix()}, nil)
 	
 	err := ca.ProcessRedemption(ctx, "REDEMPTION_BOND_001_20290101")
 	assert.NoError(t, err)
+
+	// The whole issue is redeemed, so every holding is burned
+	ctx.stub.AssertCalled(t, "InvokeChaincode", "bondtoken", [][]byte{[]byte("BurnRedeemedTokens"), []byte("BOND_001"), []byte(""), []byte("REDEMPTION_BOND_001_20290101")}, "")
 	
 	ctx.stub.AssertExpectations(t)
 }
 
+func TestCorporateAction_ProcessRedemption_PartialWithoutSnapshot(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	redemption := Redemption{ID: "REDEMPTION_BOND_001_20270101", BondID: "BOND_001", RedemptionDate: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), Amount: 400.0, Status: "PENDING"}
+	redemptionJSON, _ := json.Marshal(redemption)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
+
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", Currency: "USD", Status: "ACTIVE", MaturityDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetState", "DEFAULT_BOND_001").Return(nil, nil)
+	ctx.stub.On("GetState", "AGENCYFEES_BOND_001").Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2027, 1, 1, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	// Burning every holding would redeem the whole issue
+	err := ca.ProcessRedemption(ctx, "REDEMPTION_BOND_001_20270101")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not redeem the whole issue")
+	ctx.stub.AssertNotCalled(t, "InvokeChaincode", "bondtoken", [][]byte{[]byte("BurnRedeemedTokens"), []byte("BOND_001"), []byte(""), []byte("REDEMPTION_BOND_001_20270101")}, "")
+}
+
+func TestCorporateAction_ProcessRedemption_PartialCallWithoutSnapshot(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	// Paying for 40 of the 100 tokens at par
+	redemption := Redemption{
+		ID:             "REDEMPTION_BOND_001_20270101",
+		BondID:         "BOND_001",
+		RedemptionDate: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		Type:           "CALL",
+		Amount:         400.0,
+		Status:         "PENDING",
+		Metadata:       map[string]string{"callPrice": "100", "accruedInterest": "0"},
+	}
+	redemptionJSON, _ := json.Marshal(redemption)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
+
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", Currency: "USD", FaceValue: 10.0, TotalSupply: 100, Status: "ACTIVE", MaturityDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetState", "DEFAULT_BOND_001").Return(nil, nil)
+	ctx.stub.On("GetState", "AGENCYFEES_BOND_001").Return(nil, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2027, 1, 1, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	err := ca.ProcessRedemption(ctx, "REDEMPTION_BOND_001_20270101")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not the 1000.00 due on the whole issue")
+	ctx.stub.AssertNotCalled(t, "InvokeChaincode", "bondtoken", [][]byte{[]byte("BurnRedeemedTokens"), []byte("BOND_001"), []byte(""), []byte("REDEMPTION_BOND_001_20270101")}, "")
+}
+
+func TestWholeIssueAmount(t *testing.T) {
+	bond := &BondInfo{FaceValue: 1000.0, TotalSupply: 100}
+	amount, err := wholeIssueAmount(bond, &Redemption{})
+	assert.NoError(t, err)
+	assert.Equal(t, 100000.0, amount)
+
+	// A call pays its price and the accrued interest on every token
+	amount, err = wholeIssueAmount(bond, &Redemption{Type: "CALL", Metadata: map[string]string{"callPrice": "102", "accruedInterest": "12.5"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 103250.0, amount)
+}
+
 func TestCorporateAction_ProcessRedemption_NotPending(t *testing.T) {
 	ca := &CorporateAction{}
-	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
 	
 	// Create a redemption with non-pending status
 	redemption := Redemption{
@@ -246,7 +628,7 @@ func TestCorporateAction_ProcessRedemption_NotPending(t *testing.T) {
 	}
 	
 	redemptionJSON, _ := json.Marshal(redemption)
-	ctx.stub.On("GetState", "REDEMPTION_BOND_001_20290101").Return(redemptionJSON, nil)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
 	
 	err := ca.ProcessRedemption(ctx, "REDEMPTION_BOND_001_20290101")
 	assert.Error(t, err)
@@ -267,7 +649,7 @@ func TestCorporateAction_GetCouponPayment(t *testing.T) {
 	}
 	
 	couponJSON, _ := json.Marshal(couponPayment)
-	ctx.stub.On("GetState", "COUPON_BOND_001_20240601").Return(couponJSON, nil)
+	mockIndexed(ctx, "COUPON", couponJSON)
 	
 	retrievedCoupon, err := ca.GetCouponPayment(ctx, "COUPON_BOND_001_20240601")
 	assert.NoError(t, err)
@@ -280,7 +662,7 @@ func TestCorporateAction_GetCouponPayment_NotFound(t *testing.T) {
 	ca := &CorporateAction{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
 	
-	ctx.stub.On("GetState", "COUPON_BOND_001_20240601").Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("COUPONID", "COUPON_BOND_001_20240601")).Return(nil, nil)
 	
 	_, err := ca.GetCouponPayment(ctx, "COUPON_BOND_001_20240601")
 	assert.Error(t, err)
@@ -301,7 +683,7 @@ func TestCorporateAction_GetRedemption(t *testing.T) {
 	}
 	
 	redemptionJSON, _ := json.Marshal(redemption)
-	ctx.stub.On("GetState", "REDEMPTION_BOND_001_20290101").Return(redemptionJSON, nil)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
 	
 	retrievedRedemption, err := ca.GetRedemption(ctx, "REDEMPTION_BOND_001_20290101")
 	assert.NoError(t, err)
@@ -314,7 +696,7 @@ func TestCorporateAction_GetRedemption_NotFound(t *testing.T) {
 	ca := &CorporateAction{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
 	
-	ctx.stub.On("GetState", "REDEMPTION_BOND_001_20290101").Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("REDEMPTIONID", "REDEMPTION_BOND_001_20290101")).Return(nil, nil)
 	
 	_, err := ca.GetRedemption(ctx, "REDEMPTION_BOND_001_20290101")
 	assert.Error(t, err)
@@ -333,8 +715,9 @@ func TestCorporateAction_GetCouponPaymentsByBond(t *testing.T) {
 	coupon2JSON, _ := json.Marshal(coupon2)
 	
 	mockIterator := &MockIterator{results: [][]byte{coupon1JSON, coupon2JSON}}
+	mockIterator.On("Close").Return(nil)
 	
-	ctx.stub.On("GetStateByRange", "", "").Return(mockIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "COUPON", []string{"BOND_001"}).Return(mockIterator, nil)
 	
 	coupons, err := ca.GetCouponPaymentsByBond(ctx, "BOND_001")
 	assert.NoError(t, err)
@@ -355,8 +738,9 @@ func TestCorporateAction_GetRedemptionsByBond(t *testing.T) {
 	redemption2JSON, _ := json.Marshal(redemption2)
 	
 	mockIterator := &MockIterator{results: [][]byte{redemption1JSON, redemption2JSON}}
+	mockIterator.On("Close").Return(nil)
 	
-	ctx.stub.On("GetStateByRange", "", "").Return(mockIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "REDEMPTION", []string{"BOND_001"}).Return(mockIterator, nil)
 	
 	redemptions, err := ca.GetRedemptionsByBond(ctx, "BOND_001")
 	assert.NoError(t, err)
@@ -376,9 +760,16 @@ func TestCorporateAction_GetPendingCouponPayments(t *testing.T) {
 	coupon1JSON, _ := json.Marshal(coupon1)
 	coupon2JSON, _ := json.Marshal(coupon2)
 	
-	mockIterator := &MockIterator{results: [][]byte{coupon1JSON, coupon2JSON}}
+	// The status index entries point at the records' composite keys
+	coupon1Key := compositeKey("COUPON", "BOND_001", "00010101", coupon1.ID)
+	coupon2Key := compositeKey("COUPON", "BOND_002", "00010101", coupon2.ID)
+	ctx.stub.On("GetState", coupon1Key).Return(coupon1JSON, nil)
+	ctx.stub.On("GetState", coupon2Key).Return(coupon2JSON, nil)
+
+	mockIterator := &MockIterator{results: [][]byte{[]byte(coupon1Key), []byte(coupon2Key)}}
+	mockIterator.On("Close").Return(nil)
 	
-	ctx.stub.On("GetStateByRange", "", "").Return(mockIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "COUPONSTATUS", []string{"PENDING"}).Return(mockIterator, nil)
 	
 	pendingPayments, err := ca.GetPendingCouponPayments(ctx)
 	assert.NoError(t, err)
@@ -398,9 +789,16 @@ func TestCorporateAction_GetPendingRedemptions(t *testing.T) {
 	redemption1JSON, _ := json.Marshal(redemption1)
 	redemption2JSON, _ := json.Marshal(redemption2)
 	
-	mockIterator := &MockIterator{results: [][]byte{redemption1JSON, redemption2JSON}}
+	// The status index entries point at the records' composite keys
+	redemption1Key := compositeKey("REDEMPTION", "BOND_001", "00010101", redemption1.ID)
+	redemption2Key := compositeKey("REDEMPTION", "BOND_002", "00010101", redemption2.ID)
+	ctx.stub.On("GetState", redemption1Key).Return(redemption1JSON, nil)
+	ctx.stub.On("GetState", redemption2Key).Return(redemption2JSON, nil)
+
+	mockIterator := &MockIterator{results: [][]byte{[]byte(redemption1Key), []byte(redemption2Key)}}
+	mockIterator.On("Close").Return(nil)
 	
-	ctx.stub.On("GetStateByRange", "", "").Return(mockIterator, nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "REDEMPTIONSTATUS", []string{"PENDING"}).Return(mockIterator, nil)
 	
 	pendingRedemptions, err := ca.GetPendingRedemptions(ctx)
 	assert.NoError(t, err)
@@ -409,17 +807,1454 @@ func TestCorporateAction_GetPendingRedemptions(t *testing.T) {
 	assert.Equal(t, "PENDING", pendingRedemptions[1].Status)
 }
 
+func TestCorporateAction_SetCouponSettlementCurrency_NotPermitted(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	coupon := CouponPayment{ID: "COUPON_001", BondID: "BOND_001", Amount: 50.0, Status: "PENDING"}
+	couponJSON, _ := json.Marshal(coupon)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	bond := BondInfo{ID: "BOND_001", Currency: "USD", SettlementCurrencies: []string{"EUR"}}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	err := ca.SetCouponSettlementCurrency(ctx, "COUPON_001", "INR", "2024-06-01", 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be settled in INR")
+}
+
+func TestCorporateAction_ConvertAmount_SameCurrency(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	amount, err := ca.ConvertAmount(ctx, 125.5, "USD", "USD", "2024-06-01")
+	assert.NoError(t, err)
+	assert.Equal(t, 125.5, amount)
+}
+
+func TestRoundAmount(t *testing.T) {
+	assert.Equal(t, 4166.67, roundAmount(4166.666666))
+	assert.Equal(t, 0.01, roundAmount(0.005))
+}
+
 func TestCorporateAction_CalculateCouponAmount(t *testing.T) {
 	ca := &CorporateAction{}
 	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000.0, OutstandingFaceValue: 1000.0, Terms: CouponTerms{CouponFrequency: 1}}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
 	
-	amount, err := ca.CalculateCouponAmount(ctx, "BOND_001", 1000.0, 5.0)
+	amount, err := ca.CalculateCouponAmount(ctx, "BOND_001", 1000.0, 5.0, "", "", "")
 	assert.NoError(t, err)
 	assert.Equal(t, 50.0, amount)
 	
 	// Test with different values
-	amount, err = ca.CalculateCouponAmount(ctx, "BOND_002", 5000.0, 3.5)
+	amount, err = ca.CalculateCouponAmount(ctx, "BOND_002", 5000.0, 3.5, "", "", "")
 	assert.NoError(t, err)
 	assert.Equal(t, 175.0, amount)
 }
 
+func TestCorporateAction_CreateCouponPayment_ZeroCoupon(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000.0, BondType: "ZERO_COUPON", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+
+	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-06-01", 50.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "zero-coupon")
+}
+
+func TestCorporateAction_CalculateCouponAmount_Amortizing(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	// 40% of principal has already been repaid
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000.0, OutstandingFaceValue: 600.0, Terms: CouponTerms{CouponFrequency: 1}}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	amount, err := ca.CalculateCouponAmount(ctx, "BOND_001", 1000.0, 5.0, "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 30.0, amount)
+}
+
+func TestCorporateAction_CalculateCouponAmount_FullyAmortized(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	// The whole principal has been repaid
+	bond := BondInfo{
+		ID:                   "BOND_001",
+		FaceValue:            1000.0,
+		OutstandingFaceValue: 0,
+		Amortization:         []AmortizationEntry{{Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Amount: 1000.0, Applied: true}},
+		Terms:                CouponTerms{CouponFrequency: 1},
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	amount, err := ca.CalculateCouponAmount(ctx, "BOND_001", 1000.0, 5.0, "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, amount)
+}
+
+func TestCheckVersion(t *testing.T) {
+	assert.NoError(t, checkVersion("coupon payment COUPON_001", 3, 0))
+	assert.NoError(t, checkVersion("coupon payment COUPON_001", 3, 3))
+
+	err := checkVersion("coupon payment COUPON_001", 4, 3)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "version conflict")
+}
+
+func TestCouponPeriodEnds(t *testing.T) {
+	issue := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	maturity := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	ends := couponPeriodEnds(issue, maturity, 6)
+	assert.Len(t, ends, 4)
+	assert.Equal(t, time.Date(2024, 7, 15, 0, 0, 0, 0, time.UTC), ends[0])
+	assert.Equal(t, maturity, ends[3])
+}
+
+func TestCouponPeriodEnds_EndOfMonth(t *testing.T) {
+	issue := time.Date(2025, 8, 31, 0, 0, 0, 0, time.UTC)
+	maturity := time.Date(2026, 8, 31, 0, 0, 0, 0, time.UTC)
+
+	ends := couponPeriodEnds(issue, maturity, 3)
+	assert.Equal(t, []time.Time{
+		time.Date(2025, 11, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 31, 0, 0, 0, 0, time.UTC),
+		maturity,
+	}, ends)
+}
+
+func TestCorporateAction_GenerateCouponSchedule_NotPayingAgent(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	_, err := ca.GenerateCouponSchedule(ctx, "BOND_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+}
+
+func TestAdjustBusinessDay(t *testing.T) {
+	saturday := time.Date(2025, 5, 31, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), adjustBusinessDay(saturday, "FOLLOWING", nil))
+	assert.Equal(t, time.Date(2025, 5, 30, 0, 0, 0, 0, time.UTC), adjustBusinessDay(saturday, "MODIFIED_FOLLOWING", nil))
+	assert.Equal(t, time.Date(2025, 5, 30, 0, 0, 0, 0, time.UTC), adjustBusinessDay(saturday, "PRECEDING", nil))
+	assert.Equal(t, saturday, adjustBusinessDay(saturday, "UNADJUSTED", nil))
+
+	// Modified following only rolls back when following would change month
+	sunday := time.Date(2025, 5, 4, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 5, 5, 0, 0, 0, 0, time.UTC), adjustBusinessDay(sunday, "MODIFIED_FOLLOWING", nil))
+	assert.Equal(t, time.Date(2025, 5, 5, 0, 0, 0, 0, time.UTC), adjustBusinessDay(sunday, "", nil))
+
+	// Holidays roll like weekends
+	christmas := time.Date(2025, 12, 25, 0, 0, 0, 0, time.UTC)
+	holidays := map[string]bool{"2025-12-25": true, "2025-12-26": true}
+	assert.Equal(t, time.Date(2025, 12, 29, 0, 0, 0, 0, time.UTC), adjustBusinessDay(christmas, "FOLLOWING", holidays))
+	assert.Equal(t, time.Date(2025, 12, 24, 0, 0, 0, 0, time.UTC), adjustBusinessDay(christmas, "PRECEDING", holidays))
+}
+
+func TestCorporateAction_CreateCouponPayment_NotBusinessDay(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000.0, CouponRate: 5.0, BondType: "FIXED", Status: "ACTIVE", Terms: CouponTerms{BusinessDayConvention: "PRECEDING"}}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+
+	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-06-01", 50.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bond BOND_001 pays on 2024-05-31")
+}
+
+func TestYearFraction(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 7, 15, 0, 0, 0, 0, time.UTC)
+
+	assert.InDelta(t, 0.5, yearFraction(start, end, "30/360"), 1e-9)
+	assert.InDelta(t, 182.0/360, yearFraction(start, end, "ACT/360"), 1e-9)
+	assert.InDelta(t, 182.0/365, yearFraction(start, end, "ACT/365"), 1e-9)
+	assert.InDelta(t, 182.0/366, yearFraction(start, end, "ACT/ACT"), 1e-9)
+}
+
+func TestCorporateAction_CalculateCouponAmount_ShortFirstPeriod(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000.0, OutstandingFaceValue: 1000.0, Terms: CouponTerms{CouponFrequency: 2}}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	// Regular semi-annual coupon
+	amount, err := ca.CalculateCouponAmount(ctx, "BOND_001", 1000.0, 6.0, "", "", "")
+	assert.NoError(t, err)
+	assert.InDelta(t, 30.0, amount, 1e-9)
+
+	// Three-month short first coupon under 30/360
+	amount, err = ca.CalculateCouponAmount(ctx, "BOND_001", 1000.0, 6.0, "2024-04-15", "2024-07-15", "30/360")
+	assert.NoError(t, err)
+	assert.InDelta(t, 15.0, amount, 1e-9)
+
+	_, err = ca.CalculateCouponAmount(ctx, "BOND_001", 1000.0, 6.0, "2024-04-15", "2024-07-15", "BUS/252")
+	assert.Error(t, err)
+}
+
+func TestSetEntitlementDates(t *testing.T) {
+	paymentDate := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	var info EntitlementInfo
+	assert.NoError(t, setEntitlementDates(&info, "2024-06-01", "2024-05-31", paymentDate))
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), info.RecordDate)
+
+	assert.Error(t, setEntitlementDates(&info, "2024-06-20", "", paymentDate))
+	assert.Error(t, setEntitlementDates(&info, "2024-06-01", "2024-06-02", paymentDate))
+
+	// Dates are fixed once the snapshot is taken
+	info.SnapshotTxID = "tx123"
+	err := setEntitlementDates(&info, "2024-06-03", "", paymentDate)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already been taken")
+}
+
+func TestParsePeriod(t *testing.T) {
+	from, to, err := parsePeriod("2024")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = parsePeriod("2024-Q3")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), to)
+
+	from, to, err = parsePeriod("2024-06")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), to)
+
+	_, _, err = parsePeriod("2024-Q5")
+	assert.Error(t, err)
+}
+
+func TestFloatingRate(t *testing.T) {
+	terms := CouponTerms{BenchmarkIndex: "SOFR", Spread: 150, RateCap: 7.0, RateFloor: 2.0}
+
+	fixing := floatingRate(terms, 5.25)
+	assert.InDelta(t, 6.75, fixing.Rate, 1e-9)
+	assert.False(t, fixing.Capped)
+
+	fixing = floatingRate(terms, 6.0)
+	assert.Equal(t, 7.0, fixing.Rate)
+	assert.True(t, fixing.Capped)
+
+	fixing = floatingRate(terms, 0.25)
+	assert.Equal(t, 2.0, fixing.Rate)
+	assert.True(t, fixing.Floored)
+}
+
+func TestCorporateAction_ResetCouponRate_NotFRN(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000.0, BondType: "FIXED", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	_, err := ca.ResetCouponRate(ctx, "BOND_001", "2024-07-01")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not a floating-rate note")
+}
+
+func TestCorporateAction_ResetCouponRate_NotAuthorized(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	_, err := ca.ResetCouponRate(ctx, "BOND_001", "2024-07-01")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "CALCULATION_AGENT or PAYING_AGENT role required")
+}
+
+func TestRecordAttempt(t *testing.T) {
+	couponPayment := &CouponPayment{ID: "COUPON_BOND_001_20240601", Status: "PENDING"}
+
+	at := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	recordAttempt(couponPayment, "FAILED", "INSUFFICIENT_FUNDS", "tx1", at)
+	recordAttempt(couponPayment, "RETRIED", "", "tx2", at.Add(time.Hour))
+	recordAttempt(couponPayment, "PAID", "", "tx3", at.Add(2*time.Hour))
+
+	assert.Len(t, couponPayment.Attempts, 3)
+	assert.Equal(t, 1, couponPayment.Attempts[0].Attempt)
+	assert.Equal(t, "INSUFFICIENT_FUNDS", couponPayment.Attempts[0].ReasonCode)
+	assert.Equal(t, 2, couponPayment.Attempts[1].Attempt)
+	assert.Equal(t, 2, couponPayment.Attempts[2].Attempt)
+	assert.Equal(t, at.Add(2*time.Hour), couponPayment.Attempts[2].At)
+}
+
+func TestCorporateAction_FailCouponPayment_NotPayingAgent(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := ca.FailCouponPayment(ctx, "COUPON_BOND_001_20240601", "INSUFFICIENT_FUNDS")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+
+	err = ca.RetryCouponPayment(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_RetryCouponPayment_NotFailed(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	couponPayment := CouponPayment{ID: "COUPON_BOND_001_20240601", BondID: "BOND_001", Status: "PENDING"}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	err := ca.RetryCouponPayment(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "has not failed")
+}
+
+func TestCorporateAction_CancelCouponPayment_AlreadyPaid(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	couponPayment := CouponPayment{ID: "COUPON_BOND_001_20240601", BondID: "BOND_001", Status: "PAID"}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	err := ca.CancelCouponPayment(ctx, "COUPON_BOND_001_20240601", "duplicate")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be cancelled")
+}
+
+func TestCorporateAction_ReverseCouponPayment_NotPaid(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	couponPayment := CouponPayment{ID: "COUPON_BOND_001_20240601", BondID: "BOND_001", Status: "PENDING"}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	err := ca.ReverseCouponPayment(ctx, "COUPON_BOND_001_20240601", "paid to wrong account")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "has not been paid")
+}
+
+func TestCorporateAction_ApproveCouponReversal_NotTrustee(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	err := ca.ApproveCouponReversal(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TRUSTEE role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_ApproveCouponReversal_SameIdentity(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: trustee}
+
+	reversal := CouponReversal{ID: "REVERSAL_COUPON_BOND_001_20240601", CouponID: "COUPON_BOND_001_20240601", Status: "PENDING_APPROVAL", RequestedBy: "trustee"}
+	reversalJSON, _ := json.Marshal(reversal)
+	ctx.stub.On("GetState", "REVERSAL_COUPON_BOND_001_20240601").Return(reversalJSON, nil)
+
+	err := ca.ApproveCouponReversal(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "different identity")
+}
+
+func TestCorporateAction_CancelRedemption_NotPayingAgent(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: trustee}
+
+	err := ca.CancelRedemption(ctx, "REDEMPTION_BOND_001_20290101", "issuer withdrew notice")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestScheduledCallPrice(t *testing.T) {
+	schedule := []CallPeriod{{StartDate: "2027-01-01", Price: 102.0}, {StartDate: "2028-01-01", Price: 101.0}}
+
+	price, err := scheduledCallPrice(schedule, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, price)
+
+	price, _ = scheduledCallPrice(schedule, time.Date(2027, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 102.0, price)
+
+	price, _ = scheduledCallPrice(schedule, time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 101.0, price)
+}
+
+func TestCorporateAction_ExerciseCall_NotIssuer(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "alice", attributes: map[string]string{"address": "alice"}}}
+
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", FaceValue: 1000.0, Status: "ACTIVE", MaturityDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	err := ca.ExerciseCall(ctx, "BOND_001", "2027-06-01", 102.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only the issuer or the trustee")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_SubmitPutNotice_OtherHolder(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "alice", attributes: map[string]string{"address": "alice"}}}
+
+	err := ca.SubmitPutNotice(ctx, "BOND_001", "bob", 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "REGISTRAR role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_ProcessPutRedemptions_NotPayingAgent(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "alice", attributes: map[string]string{"address": "alice"}}}
+
+	_, err := ca.ProcessPutRedemptions(ctx, "BOND_001", "2027-06-01")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestAccruedInterest(t *testing.T) {
+	bond := &BondInfo{
+		FaceValue:    1000.0,
+		CouponRate:   6.0,
+		IssueDate:    time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		MaturityDate: time.Date(2029, 1, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	// Three months after the July 2025 coupon under semi-annual 30/360
+	assert.InDelta(t, 15.0, accruedInterest(bond, time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC)), 1e-9)
+
+	bond.BondType = "ZERO_COUPON"
+	assert.Equal(t, 0.0, accruedInterest(bond, time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestOpenPutWindow(t *testing.T) {
+	schedule := []PutWindow{{WindowStart: "2027-01-01", WindowEnd: "2027-01-31", PutDate: "2027-03-01", Price: 100.0}}
+
+	window, err := openPutWindow(schedule, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Nil(t, window)
+
+	// The window is open through the end of its last day
+	window, _ = openPutWindow(schedule, time.Date(2027, 1, 31, 18, 0, 0, 0, time.UTC))
+	assert.NotNil(t, window)
+	assert.Equal(t, "2027-03-01", window.PutDate)
+
+	window, _ = openPutWindow(schedule, time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, window)
+}
+
+func TestConversionOpen(t *testing.T) {
+	terms := CouponTerms{ConversionRatio: 12.5, ConversionStart: "2026-01-01", ConversionEnd: "2026-06-30"}
+
+	open, err := conversionOpen(terms, time.Date(2026, 6, 30, 12, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.True(t, open)
+
+	open, _ = conversionOpen(terms, time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC))
+	assert.False(t, open)
+}
+
+func TestCorporateAction_ElectConversion_NotConvertible(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := BondInfo{ID: "BOND_001", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	_, err := ca.ElectConversion(ctx, "BOND_001", "INVESTOR_001", 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not convertible")
+}
+
+func TestCorporateAction_ProcessRedemption_InDefault(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	redemption := Redemption{ID: "REDEMPTION_BOND_001_20290101", BondID: "BOND_001", Amount: 1000.0, Status: "PENDING"}
+	redemptionJSON, _ := json.Marshal(redemption)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
+
+	declaration := DefaultDeclaration{BondID: "BOND_001", EventType: "FAILURE_TO_PAY"}
+	declarationJSON, _ := json.Marshal(declaration)
+	ctx.stub.On("GetState", "DEFAULT_BOND_001").Return(declarationJSON, nil)
+
+	err := ca.ProcessRedemption(ctx, "REDEMPTION_BOND_001_20290101")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "only restructuring actions are permitted")
+}
+
+func TestValidateRestructuringTerms(t *testing.T) {
+	bond := &BondInfo{ID: "BOND_001", BondType: "FIXED", CouponRate: 8.0, MaturityDate: time.Date(2029, 1, 15, 0, 0, 0, 0, time.UTC)}
+
+	assert.NoError(t, validateRestructuringTerms(bond, RestructuringTerms{HaircutPercent: 30, CouponRate: 4.5, MaturityDate: "2032-01-15"}))
+	assert.Error(t, validateRestructuringTerms(bond, RestructuringTerms{}))
+	assert.Error(t, validateRestructuringTerms(bond, RestructuringTerms{HaircutPercent: 100}))
+	assert.Error(t, validateRestructuringTerms(bond, RestructuringTerms{MaturityDate: "2028-01-15"}))
+
+	bond.BondType = "FRN"
+	assert.Error(t, validateRestructuringTerms(bond, RestructuringTerms{CouponRate: 4.5}))
+}
+
+func TestRestructuringPassed(t *testing.T) {
+	restructuring := &Restructuring{Threshold: 66.67, EligibleQuantity: 900, VotesFor: 600}
+	assert.False(t, restructuringPassed(restructuring))
+
+	restructuring.VotesFor = 601
+	assert.True(t, restructuringPassed(restructuring))
+}
+
+func TestCorporateAction_VoteOnRestructuring_Closed(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "investor", attributes: map[string]string{"address": "INVESTOR_001"}}}
+
+	restructuring := Restructuring{ID: "RESTRUCTURING_BOND_001_20260301", BondID: "BOND_001", Status: "APPLIED"}
+	restructuringJSON, _ := json.Marshal(restructuring)
+	ctx.stub.On("GetState", "RESTRUCTURING_BOND_001_20260301").Return(restructuringJSON, nil)
+
+	err := ca.VoteOnRestructuring(ctx, "RESTRUCTURING_BOND_001_20260301", true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not open for voting")
+}
+
+func TestSortDueActions(t *testing.T) {
+	dueActions := []*DueAction{
+		{Type: "REDEMPTION", ID: "REDEMPTION_BOND_002_20260610", DueDate: time.Date(2026, 6, 10, 0, 0, 0, 0, time.UTC)},
+		{Type: "COUPON", ID: "COUPON_BOND_002_20260603", DueDate: time.Date(2026, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{Type: "COUPON", ID: "COUPON_BOND_001_20260603", DueDate: time.Date(2026, 6, 3, 0, 0, 0, 0, time.UTC)},
+	}
+
+	sortDueActions(dueActions)
+	assert.Equal(t, "COUPON_BOND_001_20260603", dueActions[0].ID)
+	assert.Equal(t, "COUPON_BOND_002_20260603", dueActions[1].ID)
+	assert.Equal(t, "REDEMPTION_BOND_002_20260610", dueActions[2].ID)
+}
+
+func TestCorporateAction_GetCouponPaymentsWithPagination(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	coupon1 := CouponPayment{ID: "COUPON_BOND_001_20240601", BondID: "BOND_001", Status: "FAILED"}
+	coupon2 := CouponPayment{ID: "COUPON_BOND_002_20240601", BondID: "BOND_002", Status: "FAILED"}
+	coupon1JSON, _ := json.Marshal(coupon1)
+	coupon2JSON, _ := json.Marshal(coupon2)
+
+	coupon1Key := compositeKey("COUPON", "BOND_001", "20240601", coupon1.ID)
+	coupon2Key := compositeKey("COUPON", "BOND_002", "20240601", coupon2.ID)
+	ctx.stub.On("GetState", coupon1Key).Return(coupon1JSON, nil)
+	ctx.stub.On("GetState", coupon2Key).Return(coupon2JSON, nil)
+
+	mockIterator := &MockIterator{results: [][]byte{[]byte(coupon1Key), []byte(coupon2Key)}}
+	mockIterator.On("Close").Return(nil)
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: 2, Bookmark: "next"}
+	ctx.stub.On("GetStateByPartialCompositeKeyWithPagination", "COUPONSTATUS", []string{"FAILED"}, int32(2), "").Return(mockIterator, metadata, nil)
+
+	page, err := ca.GetCouponPaymentsWithPagination(ctx, "FAILED", 2, "")
+	assert.NoError(t, err)
+	assert.Len(t, page.CouponPayments, 2)
+	assert.Equal(t, int32(2), page.Count)
+	assert.Equal(t, "next", page.Bookmark)
+}
+
+func TestCorporateAction_CreateCouponPayment_Duplicate(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	couponPayment := CouponPayment{
+		ID:          "COUPON_BOND_001_20240601",
+		BondID:      "BOND_001",
+		PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Status:      "PENDING",
+	}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-06-01", 50.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+}
+
+func TestCouponIDFor(t *testing.T) {
+	paymentDate := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "COUPON_BOND_001_20240601", couponIDFor("BOND_001", paymentDate))
+	assert.Equal(t, "REDEMPTION_BOND_001_20240601", redemptionIDFor("BOND_001", paymentDate))
+}
+
+func TestAccruingQuantity(t *testing.T) {
+	coupon := &CouponPayment{
+		PeriodStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+		DayCount:    "30/360",
+	}
+	holder := &HolderInfo{
+		Quantity: 100,
+		TapLots: []TapLot{
+			{Tranche: 1, Quantity: 30, AccrualStart: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)},
+			{Tranche: 2, Quantity: 60, AccrualStart: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	// Tranche 1 settled before the period and accrues in full; tranche 2
+	// accrues for half of it
+	assert.InDelta(t, 70.0, accruingQuantity(holder, coupon), 1e-9)
+	assert.Equal(t, 100.0, accruingQuantity(holder, &CouponPayment{}))
+}
+
+func TestDueIndexedIDs(t *testing.T) {
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	mockIterator := &MockIterator{
+		results: [][]byte{[]byte("a"), []byte("b"), []byte("c")},
+		keys: []string{
+			compositeKey("COUPONSTATUS", "PENDING", "20240301", "COUPON_BOND_001_20240301"),
+			compositeKey("COUPONSTATUS", "PENDING", "20240601", "COUPON_BOND_002_20240601"),
+			compositeKey("COUPONSTATUS", "PENDING", "20240901", "COUPON_BOND_001_20240901"),
+		},
+	}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "COUPONSTATUS", []string{"PENDING"}).Return(mockIterator, nil)
+
+	ids, err := dueIndexedIDs(ctx, "COUPONSTATUS", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"COUPON_BOND_001_20240301", "COUPON_BOND_002_20240601"}, ids)
+}
+
+func TestCorporateAction_ProcessCouponPayment_PaymentInstructionPerHolder(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	couponPayment := CouponPayment{
+		ID:          "COUPON_BOND_001_20240601",
+		BondID:      "BOND_001",
+		PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Amount:      100.0,
+		Status:      "PENDING",
+		Entitlement: EntitlementInfo{SnapshotTxID: "tx_snapshot"},
+	}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", Currency: "USD", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	paymentAccountJSON, _ := json.Marshal(PaymentAccount{BondID: "BOND_001", Account: "ISSUER_001_PAYMENTS"})
+	ctx.stub.On("GetState", "PAYMENTACCOUNT_BOND_001").Return(paymentAccountJSON, nil)
+	ctx.stub.On("InvokeChaincode", "cashtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: []byte("1000.00")})
+	ctx.stub.On("GetState", "AGENCYFEES_BOND_001").Return(nil, nil)
+
+	alice, _ := json.Marshal(Entitlement{Address: "alice", Amount: 60.0, WithholdingTax: 6.0, NetAmount: 54.0})
+	bob, _ := json.Marshal(Entitlement{Address: "bob", Amount: 40.0, NetAmount: 40.0})
+	// Entitlements are read for the instruction and for the holder payments
+	for i := 0; i < 2; i++ {
+		mockIterator := &MockIterator{results: [][]byte{alice, bob}}
+		mockIterator.On("Close").Return(nil)
+		ctx.stub.On("GetStateByPartialCompositeKey", "ENTITLEMENT", []string{"COUPON_BOND_001_20240601"}).Return(mockIterator, nil).Once()
+	}
+
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return(nil, nil)
+
+	err := ca.ProcessCouponPayment(ctx, "COUPON_BOND_001_20240601")
+	assert.NoError(t, err)
+
+	var instruction PaymentInstruction
+	json.Unmarshal(ctx.stub.state["PAYMENTINSTRUCTION_COUPON_BOND_001_20240601"], &instruction)
+	assert.Equal(t, 2, instruction.GroupHeader.NumberOfTxs)
+	assert.Equal(t, 94.0, instruction.GroupHeader.ControlSum)
+	assert.Equal(t, "alice", instruction.PaymentInfo.CreditTransfers[0].Creditor.ID)
+	assert.Equal(t, "2024-06-01", instruction.PaymentInfo.ExecutionDate)
+
+	var holderPayment HolderPayment
+	json.Unmarshal(ctx.stub.state[compositeKey("HOLDERPAYMENT", "COUPON_BOND_001_20240601", "alice")], &holderPayment)
+	assert.Equal(t, "INSTRUCTED", holderPayment.Status)
+	assert.Equal(t, 6.0, holderPayment.WithholdingTax)
+	assert.Equal(t, 54.0, holderPayment.CashAmount)
+	assert.Equal(t, "COUPON_BOND_001_20240601-alice", holderPayment.CashReference)
+	assert.Equal(t, []byte(compositeKey("HOLDERPAYMENT", "COUPON_BOND_001_20240601", "alice")), ctx.stub.state[compositeKey("HOLDERPAYMENTHOLDER", "alice", "COUPON_BOND_001_20240601")])
+
+	var taxVoucher TaxVoucher
+	json.Unmarshal(ctx.stub.state[compositeKey("TAXVOUCHER", "alice", "2024", "COUPON_BOND_001_20240601")], &taxVoucher)
+	assert.Equal(t, 60.0, taxVoucher.GrossAmount)
+	assert.Equal(t, 6.0, taxVoucher.TaxAmount)
+	assert.Equal(t, "USD", taxVoucher.Currency)
+	assert.Equal(t, "COUPON_BOND_001_20240601-alice", taxVoucher.PaymentReference)
+}
+
+func TestCorporateAction_GetHolderPaymentsByHolder(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	key := compositeKey("HOLDERPAYMENT", "COUPON_BOND_001_20240601", "alice")
+	holderPayment := HolderPayment{ID: "COUPON_BOND_001_20240601_alice", CouponID: "COUPON_BOND_001_20240601", Holder: "alice", NetAmount: 54.0, Status: "INSTRUCTED"}
+	holderPaymentJSON, _ := json.Marshal(holderPayment)
+
+	mockIterator := &MockIterator{results: [][]byte{[]byte(key)}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "HOLDERPAYMENTHOLDER", []string{"alice"}).Return(mockIterator, nil)
+	ctx.stub.On("GetState", key).Return(holderPaymentJSON, nil)
+
+	holderPayments, err := ca.GetHolderPaymentsByHolder(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Len(t, holderPayments, 1)
+	assert.Equal(t, 54.0, holderPayments[0].NetAmount)
+}
+
+func TestCorporateAction_GenerateAmortizationSchedule(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bond := BondInfo{
+		ID:          "BOND_001",
+		FaceValue:   1000.0,
+		TotalSupply: 100,
+		Status:      "ACTIVE",
+		Amortization: []AmortizationEntry{
+			{Date: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Amount: 250.0, Applied: true},
+			{Date: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), Amount: 250.0},
+		},
+	}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	couponPayment := CouponPayment{ID: "COUPON_BOND_001_20241202", BondID: "BOND_001", PaymentDate: time.Date(2024, 12, 2, 0, 0, 0, 0, time.UTC), PeriodEnd: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), Status: "PENDING"}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIterator := &MockIterator{results: [][]byte{couponJSON}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "COUPON", []string{"BOND_001"}).Return(mockIterator, nil)
+
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 6, 2, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+
+	created, err := ca.GenerateAmortizationSchedule(ctx, "BOND_001")
+	assert.NoError(t, err)
+	assert.Len(t, created, 1)
+	assert.Equal(t, "AMORTIZATION_BOND_001_20241201", created[0].ID)
+	assert.Equal(t, 25000.0, created[0].Amount)
+	assert.Equal(t, "COUPON_BOND_001_20241202", created[0].CouponID)
+}
+
+func TestValidateAnnouncement(t *testing.T) {
+	coupon := &Announcement{
+		EventType:          "INTR",
+		MandatoryVoluntary: "MAND",
+		Dates: AnnouncementDates{
+			RecordDate:  time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC),
+			PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Options: []AnnouncementOption{{Number: "001", Code: "CASH", Default: true}},
+	}
+	assert.NoError(t, validateAnnouncement(coupon))
+
+	coupon.Options = append(coupon.Options, AnnouncementOption{Number: "002", Code: "NOAC"})
+	assert.Error(t, validateAnnouncement(coupon))
+
+	put := &Announcement{
+		EventType:          "BPUT",
+		MandatoryVoluntary: "VOLU",
+		Dates:              AnnouncementDates{PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		Options:            []AnnouncementOption{{Number: "001", Code: "CASH"}, {Number: "002", Code: "NOAC", Default: true}},
+	}
+	assert.Error(t, validateAnnouncement(put))
+
+	put.Dates.ResponseDeadline = time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, validateAnnouncement(put))
+
+	put.Options[0].Number = "002"
+	assert.Error(t, validateAnnouncement(put))
+
+	put.EventType = "XXXX"
+	assert.Error(t, validateAnnouncement(put))
+}
+
+func TestCorporateAction_GetActionHistory(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	key := compositeKey("COUPON", "BOND_001", "20240601", "COUPON_BOND_001_20240601")
+	ctx.stub.On("GetState", compositeKey("COUPONID", "COUPON_BOND_001_20240601")).Return([]byte(key), nil)
+
+	record := func(status string, version int64, mspID string) []byte {
+		value, _ := json.Marshal(CouponPayment{ID: "COUPON_BOND_001_20240601", Status: status, Version: version, UpdatedByMSP: mspID})
+		return value
+	}
+	at := func(day int) *timestamp.Timestamp {
+		return &timestamp.Timestamp{Seconds: time.Date(2024, 6, day, 0, 0, 0, 0, time.UTC).Unix()}
+	}
+	historyIterator := &MockHistoryIterator{modifications: []*queryresult.KeyModification{
+		{TxId: "tx1", Value: record("PENDING", 1, "IssuerMSP"), Timestamp: at(1)},
+		{TxId: "tx2", Value: record("PENDING", 2, "IssuerMSP"), Timestamp: at(2)},
+		{TxId: "tx3", Value: record("FAILED", 3, "AgentMSP"), Timestamp: at(3)},
+		{TxId: "tx4", Value: record("PENDING", 4, "AgentMSP"), Timestamp: at(4)},
+		{TxId: "tx5", Value: record("PAID", 5, "AgentMSP"), Timestamp: at(5)},
+	}}
+	historyIterator.On("Close").Return(nil)
+	ctx.stub.On("GetHistoryForKey", key).Return(historyIterator, nil)
+
+	history, err := ca.GetActionHistory(ctx, "COUPON_BOND_001_20240601")
+	assert.NoError(t, err)
+	assert.Len(t, history, 4)
+	assert.Equal(t, "tx1", history[0].TxID)
+	assert.Equal(t, "", history[0].PreviousStatus)
+	assert.Equal(t, "FAILED", history[1].Status)
+	assert.Equal(t, "AgentMSP", history[1].InvokerMSP)
+	assert.Equal(t, "PAID", history[3].Status)
+	assert.Equal(t, "PENDING", history[3].PreviousStatus)
+}
+
+func TestAccruedQuantity(t *testing.T) {
+	coupon := &CouponPayment{
+		PeriodStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+		DayCount:    "30/360",
+	}
+	holder := &HolderInfo{
+		Quantity: 100,
+		TapLots:  []TapLot{{Tranche: 1, Quantity: 60, AccrualStart: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+
+	// Before the tap settles only the original 40 tokens accrue
+	assert.InDelta(t, 20.0, accruedQuantity(holder, coupon, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)), 1e-9)
+	assert.InDelta(t, 70.0, accruedQuantity(holder, coupon, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)), 1e-9)
+	assert.InDelta(t, accruingQuantity(holder, coupon), accruedQuantity(holder, coupon, time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)), 1e-9)
+}
+
+func TestCorporateAction_AccruePenaltyInterest(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	couponJSON, _ := json.Marshal(CouponPayment{
+		ID:          "COUPON_BOND_001_20240601",
+		BondID:      "BOND_001",
+		PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Amount:      10000,
+		Status:      "PENDING",
+	})
+	mockIndexed(ctx, "COUPON", couponJSON)
+	gracePeriodJSON, _ := json.Marshal(GracePeriod{BondID: "BOND_001", Days: 5, PenaltyRate: 7.3})
+	ctx.stub.On("GetState", "GRACE_BOND_001").Return(gracePeriodJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 6, 4, 12, 0, 0, 0, time.UTC).Unix()}, nil).Once()
+
+	// Still within the grace period
+	_, err := ca.AccruePenaltyInterest(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+
+	// Ten days past the end of the grace period
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 6, 16, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "PenaltyAccrued", mock.Anything).Return(nil)
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return(nil, nil)
+
+	couponPayment, err := ca.AccruePenaltyInterest(ctx, "COUPON_BOND_001_20240601")
+	assert.NoError(t, err)
+	assert.InDelta(t, 20.0, couponPayment.PenaltyInterest, 1e-9)
+	assert.Equal(t, time.Date(2024, 6, 16, 0, 0, 0, 0, time.UTC), couponPayment.PenaltyAccruedTo)
+	ctx.stub.AssertCalled(t, "SetEvent", "PenaltyAccrued", mock.Anything)
+}
+
+func TestCorporateAction_ProcessMaturity_NotMatured(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000, TotalSupply: 100, Status: "ACTIVE", MaturityDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2028, 12, 31, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	_, err := ca.ProcessMaturity(ctx, "BOND_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not mature until 2029-01-01")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_ProcessMaturity_AlreadyRetired(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000, Status: "MATURED", MaturityDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+
+	_, err := ca.ProcessMaturity(ctx, "BOND_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already been retired")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestActionQueryString(t *testing.T) {
+	queryString, err := actionQueryString(ActionQuery{Type: "REDEMPTION", BondID: "BOND_001", FromDate: "2024-01-01", ToDate: "2024-12-31", MinAmount: 100})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"selector":{"docType":"REDEMPTION","bondId":"BOND_001","amount":{"$gte":100},"redemptionDate":{"$gte":"2024-01-01T00:00:00Z","$lt":"2025-01-01T00:00:00Z"}}}`, queryString)
+
+	queryString, err = actionQueryString(ActionQuery{Status: "PENDING", ToDate: "2024-06-30"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"selector":{"docType":{"$in":["COUPON","REDEMPTION","AMORTIZATION"]},"status":"PENDING","$or":[{"paymentDate":{"$lt":"2024-07-01T00:00:00Z"}},{"redemptionDate":{"$lt":"2024-07-01T00:00:00Z"}}]}}`, queryString)
+
+	_, err = actionQueryString(ActionQuery{Type: "DIVIDEND"})
+	assert.Error(t, err)
+	_, err = actionQueryString(ActionQuery{MinAmount: 200, MaxAmount: 100})
+	assert.Error(t, err)
+}
+
+func TestCorporateAction_ProcessCouponPayment_NotPayingAgent(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := ca.ProcessCouponPayment(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_GetEventsSince(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	event := func(seq int64) []byte {
+		value, _ := json.Marshal(CorporateActionEvent{Type: "COUPON_PAYMENT_PROCESSED", BondID: "BOND_001", Sequence: seq})
+		return value
+	}
+	mockIterator := &MockIterator{results: [][]byte{event(1), event(2), event(3)}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "EVENT", []string{"BOND_001"}).Return(mockIterator, nil)
+
+	events, err := ca.GetEventsSince(ctx, "BOND_001", 1)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, int64(2), events[0].Sequence)
+	assert.Equal(t, int64(3), events[1].Sequence)
+}
+
+func TestEmitEvent(t *testing.T) {
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	ctx.stub.On("GetTxID").Return("tx-emit")
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return([]byte("41"), nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+
+	event := &CorporateActionEvent{Type: "COUPON_CREATED", BondID: "BOND_001"}
+	err := emitEvent(ctx, "CorporateActionEvent", event)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), event.Sequence)
+	assert.Equal(t, "42", string(ctx.stub.state[compositeKey("EVENTSEQ", "BOND_001")]))
+
+	var stored CorporateActionEvent
+	json.Unmarshal(ctx.stub.state[compositeKey("EVENT", "BOND_001", "00000000000000000042")], &stored)
+	assert.Equal(t, "COUPON_CREATED", stored.Type)
+	assert.Equal(t, int64(42), stored.Sequence)
+}
+
+func TestEmitEvent_SameTransaction(t *testing.T) {
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	// The stub keeps returning the committed sequence, as Fabric does
+	ctx.stub.On("GetTxID").Return("tx-emit-many")
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return([]byte("41"), nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+
+	coupon := &CorporateActionEvent{Type: "COUPON_PAYMENT_PROCESSED", BondID: "BOND_001"}
+	maturity := &CorporateActionEvent{Type: "MATURITY_PROCESSED", BondID: "BOND_001"}
+	assert.NoError(t, emitEvent(ctx, "CorporateActionEvent", coupon))
+	assert.NoError(t, emitEvent(ctx, "CorporateActionEvent", maturity))
+	assert.Equal(t, int64(42), coupon.Sequence)
+	assert.Equal(t, int64(43), maturity.Sequence)
+	assert.Equal(t, "43", string(ctx.stub.state[compositeKey("EVENTSEQ", "BOND_001")]))
+
+	var first, second CorporateActionEvent
+	json.Unmarshal(ctx.stub.state[compositeKey("EVENT", "BOND_001", "00000000000000000042")], &first)
+	json.Unmarshal(ctx.stub.state[compositeKey("EVENT", "BOND_001", "00000000000000000043")], &second)
+	assert.Equal(t, "COUPON_PAYMENT_PROCESSED", first.Type)
+	assert.Equal(t, "MATURITY_PROCESSED", second.Type)
+}
+
+func TestCorporateAction_GetTaxVouchers(t *testing.T) {
+	ca := &CorporateAction{}
+
+	// Other holders' vouchers are only visible to the tax team
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "bob", attributes: map[string]string{"address": "bob"}}}
+	_, err := ca.GetTaxVouchers(ctx, "alice", 2024)
+	assert.Error(t, err)
+
+	ctx = &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "alice", attributes: map[string]string{"address": "alice"}}}
+	voucher, _ := json.Marshal(TaxVoucher{Holder: "alice", CouponID: "COUPON_BOND_001_20240601", Year: 2024, GrossAmount: 60.0, TaxAmount: 6.0})
+	mockIterator := &MockIterator{results: [][]byte{voucher}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "TAXVOUCHER", []string{"alice", "2024"}).Return(mockIterator, nil)
+
+	taxVouchers, err := ca.GetTaxVouchers(ctx, "alice", 2024)
+	assert.NoError(t, err)
+	assert.Len(t, taxVouchers, 1)
+	assert.Equal(t, 6.0, taxVouchers[0].TaxAmount)
+}
+
+func TestCorporateAction_SimulateDistribution(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	couponPayment := CouponPayment{
+		ID:          "COUPON_BOND_001_20240601",
+		BondID:      "BOND_001",
+		PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Amount:      100.0,
+		Status:      "PENDING",
+		Entitlement: EntitlementInfo{RecordDate: time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC)},
+	}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	holdersJSON, _ := json.Marshal([]*HolderInfo{{Address: "alice", Quantity: 10}, {Address: "bob", Quantity: 10}, {Address: "carol", Quantity: 10}})
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: holdersJSON})
+	ctx.stub.On("InvokeChaincode", "compliance", mock.Anything, "").Return(peer.Response{Status: 404, Message: "no tax profile"})
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+
+	simulation, err := ca.SimulateDistribution(ctx, "COUPON_BOND_001_20240601")
+	assert.NoError(t, err)
+	assert.Equal(t, "COUPON", simulation.Type)
+	assert.Equal(t, 3, simulation.HolderCount)
+	assert.Equal(t, 33.33, simulation.Entitlements[0].Amount)
+	assert.Equal(t, 99.99, simulation.GrossAmount)
+	assert.Equal(t, 0.01, simulation.RoundingDifference)
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_SnapshotCouponEntitlements_NoHolderSnapshot(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	couponPayment := CouponPayment{
+		ID:          "COUPON_BOND_001_20240601",
+		BondID:      "BOND_001",
+		PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Amount:      100.0,
+		Status:      "PENDING",
+		Entitlement: EntitlementInfo{RecordDate: time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC)},
+	}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 5, 31, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("GetHolderSnapshot"), []byte("BOND_001"), []byte("2024-05-30")}, "").Return(peer.Response{Status: 500, Message: "no holder snapshot of bond BOND_001 for 2024-05-30"})
+
+	// Live balances are never used in place of the record-date snapshot
+	err := ca.SnapshotCouponEntitlements(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no holder snapshot")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_SetRedemptionInstalments(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	redemption := Redemption{
+		ID:             "REDEMPTION_BOND_001_20290101",
+		BondID:         "BOND_001",
+		RedemptionDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+		Amount:         1000.0,
+		Status:         "PENDING",
+	}
+	redemptionJSON, _ := json.Marshal(redemption)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+
+	err := ca.SetRedemptionInstalments(ctx, "REDEMPTION_BOND_001_20290101", `[{"dueDate": "2028-01-01", "amount": 400}, {"dueDate": "2029-01-01", "amount": 500}]`, 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match redemption amount")
+
+	err = ca.SetRedemptionInstalments(ctx, "REDEMPTION_BOND_001_20290101", `[{"dueDate": "2028-01-01", "amount": 400}, {"dueDate": "2028-07-01", "amount": 600}]`, 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must fall on the redemption date")
+
+	err = ca.SetRedemptionInstalments(ctx, "REDEMPTION_BOND_001_20290101", `[{"dueDate": "2028-01-01", "amount": 400}, {"dueDate": "2029-01-01", "amount": 600}]`, 0)
+	assert.NoError(t, err)
+
+	var stored Redemption
+	json.Unmarshal(ctx.stub.state[compositeKey("REDEMPTION", "BOND_001", "20290101", "REDEMPTION_BOND_001_20290101")], &stored)
+	assert.Len(t, stored.Instalments, 2)
+	assert.Equal(t, 2, stored.Instalments[1].Number)
+	assert.Equal(t, "PENDING", stored.Instalments[0].Status)
+	assert.Equal(t, 1000.0, stored.OutstandingAmount)
+}
+
+func TestCorporateAction_ProcessRedemptionInstalment_OutOfOrder(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	redemption := Redemption{
+		ID:             "REDEMPTION_BOND_001_20290101",
+		BondID:         "BOND_001",
+		RedemptionDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+		Amount:         1000.0,
+		Status:         "PENDING",
+		Instalments: []RedemptionInstalment{
+			{Number: 1, DueDate: time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC), Amount: 400, Status: "PENDING"},
+			{Number: 2, DueDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC), Amount: 600, Status: "PENDING"},
+		},
+		OutstandingAmount: 1000.0,
+	}
+	redemptionJSON, _ := json.Marshal(redemption)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
+
+	_, err := ca.ProcessRedemptionInstalment(ctx, "REDEMPTION_BOND_001_20290101", 2)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "instalment 1 of redemption REDEMPTION_BOND_001_20290101 must be paid first")
+
+	ctx.stub.On("GetState", "DEFAULT_BOND_001").Return(nil, nil)
+	err = ca.ProcessRedemption(ctx, "REDEMPTION_BOND_001_20290101")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is paid in instalments")
+}
+
+func TestCorporateAction_ProcessCouponPayment_FundingShortfall(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	couponPayment := CouponPayment{ID: "COUPON_BOND_001_20240601", BondID: "BOND_001", PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Amount: 5000.0, Status: "PENDING"}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", Currency: "USD", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	paymentAccountJSON, _ := json.Marshal(PaymentAccount{BondID: "BOND_001", Account: "ISSUER_001_PAYMENTS"})
+	ctx.stub.On("GetState", "PAYMENTACCOUNT_BOND_001").Return(paymentAccountJSON, nil)
+	ctx.stub.On("InvokeChaincode", "cashtoken", [][]byte{[]byte("BalanceOf"), []byte("ISSUER_001_PAYMENTS"), []byte("USD")}, "").Return(peer.Response{Status: 200, Payload: []byte("4999.99")})
+
+	err := ca.ProcessCouponPayment(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "FUNDING_SHORTFALL")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestCorporateAction_ProcessRedemption_AccruesAgencyFee(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	redemption := Redemption{ID: "REDEMPTION_BOND_001_20290101", BondID: "BOND_001", RedemptionDate: time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC), Amount: 100000.0, Status: "PENDING"}
+	redemptionJSON, _ := json.Marshal(redemption)
+	mockIndexed(ctx, "REDEMPTION", redemptionJSON)
+
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", Currency: "USD", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	schedule := AgencyFeeSchedule{BondID: "BOND_001", Currency: "USD", Fees: map[string]AgencyFeeRate{"REDEMPTION": {Flat: 250.0, BasisPoints: 1.5}}}
+	scheduleJSON, _ := json.Marshal(schedule)
+	ctx.stub.On("GetState", "AGENCYFEES_BOND_001").Return(scheduleJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2029, 1, 2, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", "DEFAULT_BOND_001").Return(nil, nil)
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+
+	err := ca.ProcessRedemption(ctx, "REDEMPTION_BOND_001_20290101")
+	assert.NoError(t, err)
+
+	var accrual AgencyFeeAccrual
+	json.Unmarshal(ctx.stub.state[compositeKey("AGENCYFEE", "BOND_001", "20290102", "REDEMPTION_BOND_001_20290101")], &accrual)
+	assert.Equal(t, "REDEMPTION", accrual.ActionType)
+	assert.Equal(t, 15.0, accrual.AdValoremFee)
+	assert.Equal(t, 265.0, accrual.Amount)
+	assert.Equal(t, "agent", accrual.Agent)
+}
+
+func TestCorporateAction_GetAgencyFees(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	january, _ := json.Marshal(AgencyFeeAccrual{BondID: "BOND_001", ActionID: "COUPON_BOND_001_20290101", Currency: "USD", Amount: 100.0, AccruedAt: time.Date(2029, 1, 2, 9, 0, 0, 0, time.UTC)})
+	february, _ := json.Marshal(AgencyFeeAccrual{BondID: "BOND_001", ActionID: "REDEMPTION_BOND_001_20290201", Currency: "USD", Amount: 265.0, AccruedAt: time.Date(2029, 2, 1, 9, 0, 0, 0, time.UTC)})
+	mockIterator := &MockIterator{results: [][]byte{january, february}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "AGENCYFEE", []string{"BOND_001"}).Return(mockIterator, nil)
+
+	statement, err := ca.GetAgencyFees(ctx, "BOND_001", "2029-02")
+	assert.NoError(t, err)
+	assert.Len(t, statement.Accruals, 1)
+	assert.Equal(t, "REDEMPTION_BOND_001_20290201", statement.Accruals[0].ActionID)
+	assert.Equal(t, "USD", statement.Currency)
+	assert.Equal(t, 265.0, statement.Total)
+}
+
+func TestCorporateAction_SubmitElection(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "alice", attributes: map[string]string{"address": "alice"}}}
+
+	announcement := Announcement{
+		ID:                 "CA_BOND_001_INTR_20240601",
+		EventType:          "INTR",
+		MandatoryVoluntary: "CHOS",
+		BondID:             "BOND_001",
+		ActionID:           "COUPON_BOND_001_20240601",
+		Dates:              AnnouncementDates{ResponseDeadline: time.Date(2024, 5, 25, 0, 0, 0, 0, time.UTC)},
+		Options:            []AnnouncementOption{{Number: "001", Code: "CASH", Default: true}, {Number: "002", Code: "SECU"}},
+	}
+	announcementJSON, _ := json.Marshal(announcement)
+	ctx.stub.On("GetState", "CA_BOND_001_INTR_20240601").Return(announcementJSON, nil)
+	entitlementJSON, _ := json.Marshal(Entitlement{ActionID: "COUPON_BOND_001_20240601", BondID: "BOND_001", Address: "alice", Amount: 60.0, NetAmount: 60.0, TxID: "tx_snapshot"})
+	ctx.stub.On("GetState", compositeKey("ENTITLEMENT", "COUPON_BOND_001_20240601", "alice")).Return(entitlementJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 5, 25, 18, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+
+	entitlement, err := ca.SubmitElection(ctx, "CA_BOND_001_INTR_20240601", "002")
+	assert.NoError(t, err)
+	assert.Equal(t, "SECU", entitlement.OptionCode)
+	assert.Equal(t, "tx_snapshot", entitlement.TxID)
+
+	_, err = ca.SubmitElection(ctx, "CA_BOND_001_INTR_20240601", "003")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "has no option 003")
+}
+
+func TestCorporateAction_CloseElections(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	announcement := Announcement{
+		ID:                 "CA_BOND_001_INTR_20240601",
+		EventType:          "INTR",
+		MandatoryVoluntary: "CHOS",
+		BondID:             "BOND_001",
+		ActionID:           "COUPON_BOND_001_20240601",
+		Dates:              AnnouncementDates{ResponseDeadline: time.Date(2024, 5, 25, 0, 0, 0, 0, time.UTC)},
+		Options:            []AnnouncementOption{{Number: "001", Code: "CASH", Default: true}, {Number: "002", Code: "SECU"}},
+	}
+	announcementJSON, _ := json.Marshal(announcement)
+	ctx.stub.On("GetState", "CA_BOND_001_INTR_20240601").Return(announcementJSON, nil)
+
+	couponPayment := CouponPayment{
+		ID:          "COUPON_BOND_001_20240601",
+		BondID:      "BOND_001",
+		PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Amount:      100.0,
+		Status:      "PENDING",
+		Entitlement: EntitlementInfo{SnapshotTxID: "tx_snapshot", ElectionID: "CA_BOND_001_INTR_20240601"},
+	}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	alice, _ := json.Marshal(Entitlement{ActionID: "COUPON_BOND_001_20240601", Address: "alice", NetAmount: 60.0, Option: "002", OptionCode: "SECU"})
+	bob, _ := json.Marshal(Entitlement{ActionID: "COUPON_BOND_001_20240601", Address: "bob", NetAmount: 40.0})
+	mockIterator := &MockIterator{results: [][]byte{alice, bob}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "ENTITLEMENT", []string{"COUPON_BOND_001_20240601"}).Return(mockIterator, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 5, 26, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("EVENTSEQ", "BOND_001")).Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+
+	defaulted, err := ca.CloseElections(ctx, "CA_BOND_001_INTR_20240601")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, defaulted)
+
+	var entitlement Entitlement
+	json.Unmarshal(ctx.stub.state[compositeKey("ENTITLEMENT", "COUPON_BOND_001_20240601", "bob")], &entitlement)
+	assert.Equal(t, "CASH", entitlement.OptionCode)
+	assert.True(t, entitlement.DefaultApplied)
+	assert.NotContains(t, ctx.stub.state, compositeKey("ENTITLEMENT", "COUPON_BOND_001_20240601", "alice"))
+
+	var stored CouponPayment
+	json.Unmarshal(ctx.stub.state[compositeKey("COUPON", "BOND_001", "20240601", "COUPON_BOND_001_20240601")], &stored)
+	assert.False(t, stored.Entitlement.ElectionsClosedAt.IsZero())
+}
+
+func TestCorporateAction_ProcessCouponPayment_ElectionsOpen(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	couponPayment := CouponPayment{
+		ID:          "COUPON_BOND_001_20240601",
+		BondID:      "BOND_001",
+		PaymentDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Amount:      100.0,
+		Status:      "PENDING",
+		Entitlement: EntitlementInfo{SnapshotTxID: "tx_snapshot", ElectionID: "CA_BOND_001_INTR_20240601"},
+	}
+	couponJSON, _ := json.Marshal(couponPayment)
+	mockIndexed(ctx, "COUPON", couponJSON)
+
+	bond := BondInfo{ID: "BOND_001", IssuerID: "ISSUER_001", Currency: "USD", Status: "ACTIVE"}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	paymentAccountJSON, _ := json.Marshal(PaymentAccount{BondID: "BOND_001", Account: "ISSUER_001_PAYMENTS"})
+	ctx.stub.On("GetState", "PAYMENTACCOUNT_BOND_001").Return(paymentAccountJSON, nil)
+	ctx.stub.On("InvokeChaincode", "cashtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: []byte("1000.00")})
+
+	err := ca.ProcessCouponPayment(ctx, "COUPON_BOND_001_20240601")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "elections on COUPON_BOND_001_20240601 are still open")
+}
+
+func TestCorporateAction_NetHolderPayments(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	paymentDate := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	holderPayments := []HolderPayment{
+		{ID: "COUPON_BOND_001_20240601_custodian", CouponID: "COUPON_BOND_001_20240601", BondID: "BOND_001", Holder: "custodian", PaymentDate: paymentDate, Currency: "USD", CashAmount: 540.0, Status: "INSTRUCTED"},
+		{ID: "COUPON_BOND_002_20240601_custodian", CouponID: "COUPON_BOND_002_20240601", BondID: "BOND_002", Holder: "custodian", PaymentDate: paymentDate, Currency: "USD", CashAmount: 260.5, Status: "INSTRUCTED"},
+		{ID: "COUPON_BOND_003_20240601_custodian", CouponID: "COUPON_BOND_003_20240601", BondID: "BOND_003", Holder: "custodian", PaymentDate: paymentDate, Currency: "EUR", CashAmount: 100.0, Status: "INSTRUCTED"},
+	}
+	var keys [][]byte
+	for _, holderPayment := range holderPayments {
+		key := compositeKey("HOLDERPAYMENT", holderPayment.CouponID, "custodian")
+		holderPaymentJSON, _ := json.Marshal(holderPayment)
+		ctx.stub.On("GetState", key).Return(holderPaymentJSON, nil)
+		keys = append(keys, []byte(key))
+	}
+	mockIterator := &MockIterator{results: keys}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "HOLDERPAYMENTHOLDER", []string{"custodian"}).Return(mockIterator, nil)
+	ctx.stub.On("GetState", "NET_custodian_20240601_USD").Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 5, 31, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("SetEvent", "CorporateActionEvent", mock.Anything).Return(nil)
+
+	netPayment, err := ca.NetHolderPayments(ctx, "custodian", "2024-06-01", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 800.5, netPayment.Amount)
+	assert.Len(t, netPayment.Components, 2)
+	assert.Equal(t, "COUPON_BOND_002_20240601", netPayment.Components[1].CouponID)
+
+	var instruction PaymentInstruction
+	json.Unmarshal(ctx.stub.state["PAYMENTINSTRUCTION_NET_custodian_20240601_USD"], &instruction)
+	assert.Len(t, instruction.PaymentInfo.CreditTransfers, 1)
+	assert.Equal(t, InstructedAmount{Currency: "USD", Value: 800.5}, instruction.PaymentInfo.CreditTransfers[0].Amount)
+
+	var netted HolderPayment
+	json.Unmarshal(ctx.stub.state[compositeKey("HOLDERPAYMENT", "COUPON_BOND_001_20240601", "custodian")], &netted)
+	assert.Equal(t, "NET_custodian_20240601_USD", netted.NetPaymentID)
+	assert.NotContains(t, ctx.stub.state, compositeKey("HOLDERPAYMENT", "COUPON_BOND_003_20240601", "custodian"))
+}
+
+func TestCorporateAction_SetHolidayCalendar(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	ctx.stub.On("GetState", compositeKey("HOLIDAYCALENDAR", "USNY")).Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 12, 1, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	calendar, err := ca.SetHolidayCalendar(ctx, "USNY", "New York", `["2025-12-25", "2025-07-04", "2025-12-25"]`, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2025-07-04", "2025-12-25"}, calendar.Holidays)
+	assert.Equal(t, int64(1), calendar.Version)
+	assert.Contains(t, ctx.stub.state, compositeKey("HOLIDAYCALENDAR", "USNY"))
+
+	_, err = ca.SetHolidayCalendar(ctx, "usny", "New York", `[]`, 0)
+	assert.Error(t, err)
+	_, err = ca.SetHolidayCalendar(ctx, "GBLO", "London", `["25/12/2025"]`, 0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid holiday")
+}
+
+func TestCorporateAction_CreateCouponPayment_Holiday(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	bond := BondInfo{ID: "BOND_001", FaceValue: 1000.0, CouponRate: 5.0, BondType: "FIXED", Status: "ACTIVE", Terms: CouponTerms{HolidayCalendars: []string{"USNY"}}}
+	bondJSON, _ := json.Marshal(bond)
+	ctx.stub.On("InvokeChaincode", "bondtoken", mock.Anything, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	calendarJSON, _ := json.Marshal(HolidayCalendar{Name: "USNY", Holidays: []string{"2024-07-04"}})
+	ctx.stub.On("GetState", compositeKey("HOLIDAYCALENDAR", "USNY")).Return(calendarJSON, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+
+	err := ca.CreateCouponPayment(ctx, "BOND_001", "2024-07-04", 50.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bond BOND_001 pays on 2024-07-05")
+}
+
+func TestCorporateAction_MigrateStateKeys(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	paymentDate := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	first, _ := json.Marshal(CouponPayment{ID: "COUPON_BOND_001_20240601", BondID: "BOND_001", PaymentDate: paymentDate, Status: "PENDING"})
+	second, _ := json.Marshal(CouponPayment{ID: "COUPON_BOND_002_20240601", BondID: "BOND_002", PaymentDate: paymentDate, Status: "PENDING"})
+	mockIterator := &MockIterator{results: [][]byte{first, second}, keys: []string{"COUPON_BOND_001_20240601", "COUPON_BOND_002_20240601"}}
+	mockIterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByRange", "", "").Return(mockIterator, nil)
+	ctx.stub.On("GetState", mock.Anything).Return(nil, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+
+	result, err := ca.MigrateStateKeys(ctx, 1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.CouponPayments)
+	assert.Equal(t, "COUPON_BOND_002_20240601", result.Bookmark)
+	ctx.stub.AssertCalled(t, "DelState", "COUPON_BOND_001_20240601")
+	ctx.stub.AssertNotCalled(t, "DelState", "COUPON_BOND_002_20240601")
+}
+
+func TestCorporateAction_MigrateStateKeys_NotPayingAgent(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	_, err := ca.MigrateStateKeys(ctx, 1, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "PAYING_AGENT role required")
+}
+
+func TestCorporateAction_SetWithholdingRate(t *testing.T) {
+	ca := &CorporateAction{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: payingAgent}
+
+	err := ca.SetWithholdingRate(ctx, "IN", "INDIVIDUAL", 10)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TAX_ADMIN role required")
+
+	ctx.identity = &MockClientIdentity{id: "taxadmin", mspID: "AgentMSP", attributes: map[string]string{"role": "TAX_ADMIN"}}
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+
+	err = ca.SetWithholdingRate(ctx, "IN", "INDIVIDUAL", 10)
+	assert.NoError(t, err)
+
+	var stored WithholdingRate
+	json.Unmarshal(ctx.stub.state[compositeKey("TAXRATE", "IN", "INDIVIDUAL")], &stored)
+	assert.Equal(t, 10.0, stored.Rate)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), stored.UpdatedAt)
+}
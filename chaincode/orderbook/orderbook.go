@@ -0,0 +1,748 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Names the other bond contracts are deployed under
+const (
+	bondTokenChaincode = "bondtoken"
+	cashTokenChaincode = "cashtoken"
+)
+
+// State object types. Orders are stored under ORDER~orderID keys and fills
+// under FILL~tradeID keys. The ORDERBOOK index lists the resting orders of
+// a bond, keyed bondID~side~price~sequence~orderID so a range scan returns
+// each side in price-time priority. The ORDERSEQ~bondID key holds the last
+// sequence number given to an order in the bond.
+const (
+	orderObjectType   = "ORDER"
+	orderBookIndex    = orderObjectType + "BOOK"
+	orderSequenceType = orderObjectType + "SEQ"
+	fillObjectType    = "FILL"
+)
+
+// brokerRole is the client identity role attribute allowed to submit and
+// cancel orders on behalf of traders
+const brokerRole = "BROKER"
+
+// Days between a trade and its settlement
+const settlementCycleDays = 2
+
+// Largest price, in cents, a book key can hold. Bids are keyed by the
+// difference from it so the highest bid sorts first.
+const maxPriceCents = 999999999999
+
+// Order sides and statuses
+const (
+	sideBuy  = "BUY"
+	sideSell = "SELL"
+
+	orderOpen            = "OPEN"
+	orderPartiallyFilled = "PARTIALLY_FILLED"
+	orderFilled          = "FILLED"
+	orderCancelled       = "CANCELLED"
+)
+
+// OrderBook represents the order book contract
+type OrderBook struct {
+	contractapi.Contract
+}
+
+// Order represents a limit order to buy or sell a bond
+type Order struct {
+	ID        string  `json:"id"`
+	BondID    string  `json:"bondId"`
+	Trader    string  `json:"trader"`
+	Side      string  `json:"side"`  // "BUY", "SELL"
+	Price     float64 `json:"price"` // limit price per token, in the bond's currency
+	Quantity  int64   `json:"quantity"`
+	Remaining int64   `json:"remaining"` // quantity not yet filled
+	Status    string  `json:"status"`    // "OPEN", "PARTIALLY_FILLED", "FILLED", "CANCELLED"
+
+	// Position of the order in its bond's time priority, starting at 1
+	Sequence int64 `json:"sequence"`
+
+	// Fills of the order, oldest first
+	Fills []*Fill `json:"fills,omitempty"`
+
+	// Broker that submitted the order and its MSP
+	SubmittedBy    string    `json:"submittedBy"`
+	SubmittedByMSP string    `json:"submittedByMsp"`
+	SubmittedAt    time.Time `json:"submittedAt"`
+	CancelledAt    time.Time `json:"cancelledAt,omitempty"`
+
+	Version int64  `json:"version"` // incremented on every write
+	TxID    string `json:"txId"`    // transaction that last wrote the record
+}
+
+// Fill is a match between a buy and a sell order, which the Settlement
+// contract records as a trade
+type Fill struct {
+	TradeID        string    `json:"tradeId"`
+	BuyOrderID     string    `json:"buyOrderId"`
+	SellOrderID    string    `json:"sellOrderId"`
+	Quantity       int64     `json:"quantity"`
+	Price          float64   `json:"price"` // the resting order's price
+	MatchedAt      time.Time `json:"matchedAt"`
+	SettlementDate time.Time `json:"settlementDate"`
+}
+
+// Book is the resting orders of a bond, each side in price-time priority
+type Book struct {
+	BondID string   `json:"bondId"`
+	Bids   []*Order `json:"bids"`
+	Asks   []*Order `json:"asks"`
+}
+
+// BondInfo is the subset of the BondToken contract's bond used here
+type BondInfo struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Currency string `json:"currency"`
+}
+
+// TransferCheck is the BondToken contract's verdict on a transfer
+type TransferCheck struct {
+	Allowed    bool   `json:"allowed"`
+	ReasonCode string `json:"reasonCode"`
+	Reason     string `json:"reason"`
+}
+
+// OrderBookEvent represents an order book event
+type OrderBookEvent struct {
+	Type      string    `json:"type"`
+	OrderID   string    `json:"orderId"`
+	BondID    string    `json:"bondId"`
+	Status    string    `json:"status"`
+	TradeIDs  []string  `json:"tradeIds,omitempty"` // fills the transaction made
+	Details   string    `json:"details"`
+	Timestamp time.Time `json:"timestamp"`
+	TxID      string    `json:"txId"`
+}
+
+// Init initializes the contract
+func (ob *OrderBook) Init(ctx contractapi.TransactionContextInterface) error {
+	fmt.Println("OrderBook contract initialized")
+	return nil
+}
+
+// SubmitOrder submits a limit order for trader to buy or sell quantity
+// tokens of bondID at price or better, and matches it against the resting
+// orders on the other side in price-time priority: best price first, then
+// the earliest order. Each match fills at the resting order's price, to
+// settle settlementCycleDays later, and is stored so the Settlement
+// contract's RecordOrderBookTrade can read the fill and both orders back
+// once the transaction commits. Orders are not matched against the trader's
+// own orders. Before each match the seller's delivery is checked with
+// BondToken's CanTransfer and the buyer's cash against its CashToken
+// balance, counting what each already matched in the transaction; the
+// order is rejected if its own trader falls short, and a resting order
+// whose trader falls short is passed over. Whatever is left of the order
+// rests on the book. The book is
+// read with a range query, which Fabric re-checks when the transaction
+// commits, so a match against a book that changed in the meantime is
+// rejected rather than committed. Only brokers may submit orders.
+func (ob *OrderBook) SubmitOrder(ctx contractapi.TransactionContextInterface, orderID, trader, bondID, side string, quantity int64, price float64) (*Order, error) {
+	err := requireRole(ctx, brokerRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if orderID == "" || trader == "" {
+		return nil, fmt.Errorf("order ID and trader are required")
+	}
+	if side != sideBuy && side != sideSell {
+		return nil, fmt.Errorf("invalid side %s, expected BUY or SELL", side)
+	}
+	if quantity <= 0 {
+		return nil, fmt.Errorf("quantity must be positive")
+	}
+	cents := priceCents(price)
+	if cents <= 0 || cents > maxPriceCents {
+		return nil, fmt.Errorf("invalid price: %v", price)
+	}
+
+	existing, err := getOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("order %s already exists", orderID)
+	}
+
+	bond, err := getBond(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+	if bond.Status == "VOID" || bond.Status == "MATURED" {
+		return nil, fmt.Errorf("bond %s is %s and can no longer be traded", bondID, strings.ToLower(bond.Status))
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	submittedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	sequence, err := nextSequence(ctx, bondID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &Order{
+		ID:             orderID,
+		BondID:         bondID,
+		Trader:         trader,
+		Side:           side,
+		Price:          float64(cents) / 100,
+		Quantity:       quantity,
+		Remaining:      quantity,
+		Status:         orderOpen,
+		Sequence:       sequence,
+		SubmittedBy:    submittedBy,
+		SubmittedByMSP: mspID,
+		SubmittedAt:    now,
+	}
+
+	settlementDate := now.Truncate(24*time.Hour).AddDate(0, 0, settlementCycleDays)
+	matched, err := matchOrder(ctx, order, bond, now, settlementDate)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, resting := range matched {
+		if resting.Remaining == 0 {
+			key, err := bookKey(ctx, resting)
+			if err != nil {
+				return nil, err
+			}
+			err = ctx.GetStub().DelState(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to remove order %s from the book: %v", resting.ID, err)
+			}
+		}
+		err = putOrder(ctx, resting)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if order.Remaining > 0 {
+		key, err := bookKey(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+		err = ctx.GetStub().PutState(key, []byte{0})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add order %s to the book: %v", orderID, err)
+		}
+	}
+	err = putOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	tradeIDs := []string{}
+	for _, fill := range order.Fills {
+		err = putFill(ctx, fill)
+		if err != nil {
+			return nil, err
+		}
+		tradeIDs = append(tradeIDs, fill.TradeID)
+	}
+	details := fmt.Sprintf("%s %d tokens of %s at %.2f for %s, %d filled", side, quantity, bondID, order.Price, trader, quantity-order.Remaining)
+	err = emitOrderEvent(ctx, "ORDER_SUBMITTED", order, tradeIDs, details, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// CancelOrder cancels what is left of an open or partially filled order,
+// removing it from the book. Fills already made stand. Only the broker that
+// submitted the order may cancel it.
+func (ob *OrderBook) CancelOrder(ctx contractapi.TransactionContextInterface, orderID string) error {
+	err := requireRole(ctx, brokerRole)
+	if err != nil {
+		return err
+	}
+
+	order, err := ob.GetOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.Status != orderOpen && order.Status != orderPartiallyFilled {
+		return fmt.Errorf("order %s is %s and cannot be cancelled", orderID, order.Status)
+	}
+
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if caller != order.SubmittedBy {
+		return fmt.Errorf("order %s can only be cancelled by the broker that submitted it", orderID)
+	}
+
+	key, err := bookKey(ctx, order)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to remove order %s from the book: %v", orderID, err)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	order.Status = orderCancelled
+	order.CancelledAt = now
+
+	err = putOrder(ctx, order)
+	if err != nil {
+		return err
+	}
+
+	return emitOrderEvent(ctx, "ORDER_CANCELLED", order, nil, fmt.Sprintf("Order %s cancelled with %d tokens unfilled", orderID, order.Remaining), now)
+}
+
+// GetOrder returns an order
+func (ob *OrderBook) GetOrder(ctx contractapi.TransactionContextInterface, orderID string) (*Order, error) {
+	order, err := getOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, fmt.Errorf("order %s does not exist", orderID)
+	}
+	return order, nil
+}
+
+// GetFill returns a fill by its trade ID
+func (ob *OrderBook) GetFill(ctx contractapi.TransactionContextInterface, tradeID string) (*Fill, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(fillObjectType, []string{tradeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fill key: %v", err)
+	}
+
+	fillJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fill: %v", err)
+	}
+	if fillJSON == nil {
+		return nil, fmt.Errorf("fill %s does not exist", tradeID)
+	}
+
+	var fill Fill
+	err = json.Unmarshal(fillJSON, &fill)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fill: %v", err)
+	}
+	return &fill, nil
+}
+
+// GetOrderBook returns the resting orders of a bond, bids and asks each in
+// the price-time priority they match in
+func (ob *OrderBook) GetOrderBook(ctx contractapi.TransactionContextInterface, bondID string) (*Book, error) {
+	bids, err := restingOrders(ctx, bondID, sideBuy)
+	if err != nil {
+		return nil, err
+	}
+	asks, err := restingOrders(ctx, bondID, sideSell)
+	if err != nil {
+		return nil, err
+	}
+	return &Book{BondID: bondID, Bids: bids, Asks: asks}, nil
+}
+
+// matchOrder fills an incoming order against the resting orders on the
+// other side of its bond's book, in price-time priority, while their prices
+// cross, as far as both traders can fund each match. It returns the resting
+// orders it filled, which the caller stores along with the fills.
+func matchOrder(ctx contractapi.TransactionContextInterface, order *Order, bond *BondInfo, now, settlementDate time.Time) ([]*Order, error) {
+	opposite := sideSell
+	if order.Side == sideSell {
+		opposite = sideBuy
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(orderBookIndex, []string{order.BondID, opposite})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order book: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	// Tokens each seller and cash each buyer committed to this
+	// transaction's fills so far
+	delivering := map[string]int64{}
+	paying := map[string]float64{}
+
+	matched := []*Order{}
+	for order.Remaining > 0 && resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split order book key: %v", err)
+		}
+
+		resting, err := getOrder(ctx, attributes[4])
+		if err != nil {
+			return nil, err
+		}
+		if resting == nil {
+			return nil, fmt.Errorf("order %s is on the book but does not exist", attributes[4])
+		}
+
+		buy, sell := order, resting
+		if order.Side == sideSell {
+			buy, sell = resting, order
+		}
+		// The book is in priority order, so no later order crosses either
+		if priceCents(buy.Price) < priceCents(sell.Price) {
+			break
+		}
+		if resting.Trader == order.Trader {
+			continue
+		}
+
+		fill := &Fill{
+			TradeID:        fmt.Sprintf("%s-%d", order.ID, len(order.Fills)+1),
+			BuyOrderID:     buy.ID,
+			SellOrderID:    sell.ID,
+			Quantity:       order.Remaining,
+			Price:          resting.Price,
+			MatchedAt:      now,
+			SettlementDate: settlementDate,
+		}
+		if resting.Remaining < fill.Quantity {
+			fill.Quantity = resting.Remaining
+		}
+
+		delivery := delivering[sell.Trader] + fill.Quantity
+		payment := roundAmount(paying[buy.Trader] + float64(fill.Quantity)*fill.Price)
+		short, reason, err := fundingShortfall(ctx, bond, buy, sell, delivery, payment)
+		if err != nil {
+			return nil, err
+		}
+		if short == order {
+			return nil, fmt.Errorf("order %s cannot be filled: %s", order.ID, reason)
+		}
+		if short != nil {
+			continue
+		}
+		delivering[sell.Trader] = delivery
+		paying[buy.Trader] = payment
+
+		for _, filled := range []*Order{order, resting} {
+			filled.Remaining -= fill.Quantity
+			filled.Fills = append(filled.Fills, fill)
+			filled.Status = orderPartiallyFilled
+			if filled.Remaining == 0 {
+				filled.Status = orderFilled
+			}
+		}
+		matched = append(matched, resting)
+	}
+
+	return matched, nil
+}
+
+// fundingShortfall checks that the seller of a match can deliver quantity
+// tokens to the buyer, as BondToken's CanTransfer judges, and that the buyer
+// holds amount in the bond's currency in the CashToken contract. It returns
+// the order whose trader falls short and why, or nil if both can fund it.
+func fundingShortfall(ctx contractapi.TransactionContextInterface, bond *BondInfo, buy, sell *Order, quantity int64, amount float64) (*Order, string, error) {
+	check, err := canTransfer(ctx, sell.Trader, buy.Trader, bond.ID, quantity)
+	if err != nil {
+		return nil, "", err
+	}
+	if !check.Allowed {
+		return sell, fmt.Sprintf("%s cannot deliver %d tokens of %s: %s: %s", sell.Trader, quantity, bond.ID, check.ReasonCode, check.Reason), nil
+	}
+
+	balance, err := cashBalance(ctx, buy.Trader, bond.Currency)
+	if err != nil {
+		return nil, "", err
+	}
+	if balance < amount {
+		return buy, fmt.Sprintf("%s holds %.2f %s, %.2f required", buy.Trader, balance, bond.Currency, amount), nil
+	}
+
+	return nil, "", nil
+}
+
+// restingOrders returns the orders on one side of a bond's book in
+// price-time priority
+func restingOrders(ctx contractapi.TransactionContextInterface, bondID, side string) ([]*Order, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(orderBookIndex, []string{bondID, side})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order book: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	orders := []*Order{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResult.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split order book key: %v", err)
+		}
+
+		order, err := getOrder(ctx, attributes[4])
+		if err != nil {
+			return nil, err
+		}
+		if order != nil {
+			orders = append(orders, order)
+		}
+	}
+
+	return orders, nil
+}
+
+// bookKey returns the order book index key of an order. Asks are keyed by
+// price and bids by the price's difference from maxPriceCents, so both
+// sides sort best price first, then by sequence.
+func bookKey(ctx contractapi.TransactionContextInterface, order *Order) (string, error) {
+	cents := priceCents(order.Price)
+	if order.Side == sideBuy {
+		cents = maxPriceCents - cents
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(orderBookIndex, []string{order.BondID, order.Side, fmt.Sprintf("%012d", cents), fmt.Sprintf("%012d", order.Sequence), order.ID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create order book key: %v", err)
+	}
+	return key, nil
+}
+
+// nextSequence returns the next order sequence number of a bond and
+// stores it
+func nextSequence(ctx contractapi.TransactionContextInterface, bondID string) (int64, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(orderSequenceType, []string{bondID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create order sequence key: %v", err)
+	}
+
+	seqBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read order sequence: %v", err)
+	}
+	var sequence int64
+	if seqBytes != nil {
+		sequence, err = strconv.ParseInt(string(seqBytes), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid order sequence: %v", err)
+		}
+	}
+	sequence++
+
+	err = ctx.GetStub().PutState(key, []byte(strconv.FormatInt(sequence, 10)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to store order sequence: %v", err)
+	}
+	return sequence, nil
+}
+
+// getOrder returns an order, or nil if it does not exist
+func getOrder(ctx contractapi.TransactionContextInterface, orderID string) (*Order, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(orderObjectType, []string{orderID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order key: %v", err)
+	}
+
+	orderJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order: %v", err)
+	}
+	if orderJSON == nil {
+		return nil, nil
+	}
+
+	var order Order
+	err = json.Unmarshal(orderJSON, &order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal order: %v", err)
+	}
+	return &order, nil
+}
+
+// putOrder bumps the order's version, records the transaction and stores it
+func putOrder(ctx contractapi.TransactionContextInterface, order *Order) error {
+	order.TxID = ctx.GetStub().GetTxID()
+	order.Version++
+
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("failed to marshal order: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(orderObjectType, []string{order.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create order key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, orderJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store order: %v", err)
+	}
+	return nil
+}
+
+// putFill stores a fill under its trade ID
+func putFill(ctx contractapi.TransactionContextInterface, fill *Fill) error {
+	fillJSON, err := json.Marshal(fill)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fill: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(fillObjectType, []string{fill.TradeID})
+	if err != nil {
+		return fmt.Errorf("failed to create fill key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, fillJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store fill: %v", err)
+	}
+	return nil
+}
+
+// emitOrderEvent emits an order book event for an order
+func emitOrderEvent(ctx contractapi.TransactionContextInterface, eventType string, order *Order, tradeIDs []string, details string, now time.Time) error {
+	event := OrderBookEvent{
+		Type:      eventType,
+		OrderID:   order.ID,
+		BondID:    order.BondID,
+		Status:    order.Status,
+		TradeIDs:  tradeIDs,
+		Details:   details,
+		Timestamp: now,
+		TxID:      order.TxID,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("OrderBookEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+	return nil
+}
+
+// getBond reads a bond from the BondToken contract
+func getBond(ctx contractapi.TransactionContextInterface, bondID string) (*BondInfo, error) {
+	args := [][]byte{[]byte("GetBond"), []byte(bondID)}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get bond %s: %s", bondID, response.Message)
+	}
+
+	var bond BondInfo
+	err := json.Unmarshal(response.Payload, &bond)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bond: %v", err)
+	}
+
+	return &bond, nil
+}
+
+// canTransfer asks the BondToken contract whether quantity tokens of bondID
+// may move from one trader to another
+func canTransfer(ctx contractapi.TransactionContextInterface, from, to, bondID string, quantity int64) (*TransferCheck, error) {
+	args := [][]byte{[]byte("CanTransfer"), []byte(from), []byte(to), []byte(bondID), []byte(strconv.FormatInt(quantity, 10))}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to check transfer from %s to %s: %s", from, to, response.Message)
+	}
+
+	var check TransferCheck
+	err := json.Unmarshal(response.Payload, &check)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transfer check: %v", err)
+	}
+
+	return &check, nil
+}
+
+// cashBalance reads an account's balance in a currency from the CashToken
+// contract
+func cashBalance(ctx contractapi.TransactionContextInterface, account, currency string) (float64, error) {
+	args := [][]byte{[]byte("BalanceOf"), []byte(account), []byte(currency)}
+	response := ctx.GetStub().InvokeChaincode(cashTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return 0, fmt.Errorf("failed to get balance of %s: %s", account, response.Message)
+	}
+	balance, err := strconv.ParseFloat(strings.TrimSpace(string(response.Payload)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid balance of %s: %v", account, err)
+	}
+	return balance, nil
+}
+
+// priceCents returns a price in whole cents
+func priceCents(price float64) int64 {
+	return int64(math.Round(price * 100))
+}
+
+// roundAmount rounds a cash amount to two decimal places
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// requireRole checks that the invoking identity carries one of the given
+// values in its "role" certificate attribute
+func requireRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	for _, role := range roles {
+		if ctx.GetClientIdentity().AssertAttributeValue("role", role) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("caller is not authorized: %s role required", strings.Join(roles, " or "))
+}
+
+// txTimestamp returns the timestamp the client set in the transaction
+// proposal, so every endorsing peer computes the same dates from it
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+func main() {
+	chaincode, err := contractapi.NewChaincode(&OrderBook{})
+	if err != nil {
+		fmt.Printf("Error creating OrderBook chaincode: %s", err.Error())
+		return
+	}
+
+	if err := chaincode.Start(); err != nil {
+		fmt.Printf("Error starting OrderBook chaincode: %s", err.Error())
+	}
+}
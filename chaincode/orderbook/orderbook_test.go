@@ -0,0 +1,495 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockStub is a mock implementation of the chaincode stub. Stub methods
+// the contract does not use are left to the embedded interface and panic
+// if called.
+type MockStub struct {
+	shim.ChaincodeStubInterface
+	mock.Mock
+	state map[string][]byte
+}
+
+func (m *MockStub) GetState(key string) ([]byte, error) {
+	args := m.Called(key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockStub) PutState(key string, value []byte) error {
+	args := m.Called(key, value)
+	m.state[key] = value
+	return args.Error(0)
+}
+
+func (m *MockStub) DelState(key string) error {
+	args := m.Called(key)
+	delete(m.state, key)
+	return args.Error(0)
+}
+
+func (m *MockStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	args := m.Called(startKey, endKey)
+	return args.Get(0).(shim.StateQueryIteratorInterface), args.Error(1)
+}
+
+func (m *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	args := m.Called()
+	return args.Get(0).(*timestamp.Timestamp), args.Error(1)
+}
+
+func (m *MockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return compositeKey(objectType, attributes...), nil
+}
+
+func (m *MockStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	parts := strings.Split(strings.Trim(compositeKey, "\x00"), "\x00")
+	return parts[0], parts[1:], nil
+}
+
+func (m *MockStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	args := m.Called(objectType, keys)
+	return args.Get(0).(shim.StateQueryIteratorInterface), args.Error(1)
+}
+
+func (m *MockStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	args := m.Called(objectType, keys, pageSize, bookmark)
+	return args.Get(0).(shim.StateQueryIteratorInterface), args.Get(1).(*peer.QueryResponseMetadata), args.Error(2)
+}
+
+// compositeKey builds a composite key using the same encoding as the Fabric shim
+func compositeKey(objectType string, attributes ...string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
+}
+
+func (m *MockStub) GetTxID() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *MockStub) SetEvent(name string, payload []byte) error {
+	args := m.Called(name, payload)
+	return args.Error(0)
+}
+
+func (m *MockStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	called := m.Called(chaincodeName, args, channel)
+	return called.Get(0).(peer.Response)
+}
+
+func (m *MockStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	args := m.Called(key)
+	return args.Get(0).(shim.HistoryQueryIteratorInterface), args.Error(1)
+}
+
+// MockContext is a mock implementation of the transaction context
+type MockContext struct {
+	mock.Mock
+	stub     *MockStub
+	identity *MockClientIdentity // defaults to a client of Org1MSP without attributes
+}
+
+func (m *MockContext) GetClientIdentity() cid.ClientIdentity {
+	if m.identity != nil {
+		return m.identity
+	}
+	return &MockClientIdentity{id: "client", mspID: "Org1MSP"}
+}
+
+// MockClientIdentity is a fixed client identity
+type MockClientIdentity struct {
+	id         string
+	mspID      string
+	attributes map[string]string
+}
+
+// broker is a client holding the BROKER role
+var broker = &MockClientIdentity{id: "broker1", mspID: "MarketMakerMSP", attributes: map[string]string{"role": "BROKER"}}
+
+func (m *MockClientIdentity) GetID() (string, error) {
+	return m.id, nil
+}
+
+func (m *MockClientIdentity) GetMSPID() (string, error) {
+	return m.mspID, nil
+}
+
+func (m *MockClientIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := m.attributes[name]
+	return value, found, nil
+}
+
+func (m *MockClientIdentity) AssertAttributeValue(name, value string) error {
+	if m.attributes[name] != value {
+		return fmt.Errorf("attribute %s does not have value %s", name, value)
+	}
+	return nil
+}
+
+func (m *MockClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+func (m *MockContext) GetStub() shim.ChaincodeStubInterface {
+	return m.stub
+}
+
+// MockIterator is a mock implementation of the state query iterator
+type MockIterator struct {
+	mock.Mock
+	results [][]byte
+	keys    []string // optional; defaults to key_<n>
+	index   int
+}
+
+func (m *MockIterator) HasNext() bool {
+	return m.index < len(m.results)
+}
+
+func (m *MockIterator) Next() (*queryresult.KV, error) {
+	if m.index >= len(m.results) {
+		return nil, nil
+	}
+
+	result := &queryresult.KV{
+		Key:   fmt.Sprintf("key_%d", m.index),
+		Value: m.results[m.index],
+	}
+	if m.keys != nil {
+		result.Key = m.keys[m.index]
+	}
+	m.index++
+	return result, nil
+}
+
+func (m *MockIterator) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// restingOrder returns a stored order resting on the book
+func restingOrder(ctx *MockContext, id, trader, side string, price float64, remaining, sequence int64) *Order {
+	order := &Order{ID: id, BondID: "BOND_001", Trader: trader, Side: side, Price: price, Quantity: remaining, Remaining: remaining, Status: "OPEN", Sequence: sequence, SubmittedBy: "broker1", Version: 1}
+	orderJSON, _ := json.Marshal(order)
+	ctx.stub.On("GetState", compositeKey("ORDER", id)).Return(orderJSON, nil)
+	return order
+}
+
+// onBook mocks the range scan of one side of BOND_001's book
+func onBook(ctx *MockContext, side string, orders ...*Order) {
+	iterator := &MockIterator{}
+	for _, order := range orders {
+		key, _ := bookKey(ctx, order)
+		iterator.results = append(iterator.results, []byte{0})
+		iterator.keys = append(iterator.keys, key)
+	}
+	iterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "ORDERBOOK", []string{"BOND_001", side}).Return(iterator, nil)
+}
+
+// onDelivery mocks BondToken's verdict on quantity tokens of BOND_001
+// moving from seller to buyer
+func onDelivery(ctx *MockContext, seller, buyer string, quantity int64, check TransferCheck) {
+	checkJSON, _ := json.Marshal(check)
+	args := [][]byte{[]byte("CanTransfer"), []byte(seller), []byte(buyer), []byte("BOND_001"), []byte(fmt.Sprintf("%d", quantity))}
+	ctx.stub.On("InvokeChaincode", "bondtoken", args, "").Return(peer.Response{Status: 200, Payload: checkJSON})
+}
+
+// onCash mocks a trader's USD balance in the CashToken contract
+func onCash(ctx *MockContext, trader, balance string) {
+	ctx.stub.On("InvokeChaincode", "cashtoken", [][]byte{[]byte("BalanceOf"), []byte(trader), []byte("USD")}, "").Return(peer.Response{Status: 200, Payload: []byte(balance)})
+}
+
+// onSubmitOrder mocks everything SubmitOrder reads and writes for a new
+// order in BOND_001 other than the book itself
+func onSubmitOrder(ctx *MockContext, orderID string) {
+	bondJSON, _ := json.Marshal(BondInfo{ID: "BOND_001", Status: "ACTIVE", Currency: "USD"})
+	ctx.stub.On("GetState", compositeKey("ORDER", orderID)).Return(nil, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("GetBond"), []byte("BOND_001")}, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("ORDERSEQ", "BOND_001")).Return([]byte("10"), nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx126")
+	ctx.stub.On("SetEvent", "OrderBookEvent", mock.Anything).Return(nil)
+}
+
+func TestOrderBook_Init(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := ob.Init(ctx)
+	assert.NoError(t, err)
+}
+
+func TestOrderBook_BookKeyPriority(t *testing.T) {
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	highBid, _ := bookKey(ctx, &Order{ID: "B1", BondID: "BOND_001", Side: "BUY", Price: 101.0, Sequence: 2})
+	lowBid, _ := bookKey(ctx, &Order{ID: "B2", BondID: "BOND_001", Side: "BUY", Price: 99.5, Sequence: 1})
+	lowAsk, _ := bookKey(ctx, &Order{ID: "S1", BondID: "BOND_001", Side: "SELL", Price: 99.5, Sequence: 2})
+	highAsk, _ := bookKey(ctx, &Order{ID: "S2", BondID: "BOND_001", Side: "SELL", Price: 101.0, Sequence: 1})
+	earlierAsk, _ := bookKey(ctx, &Order{ID: "S3", BondID: "BOND_001", Side: "SELL", Price: 99.5, Sequence: 1})
+
+	assert.True(t, highBid < lowBid)
+	assert.True(t, lowAsk < highAsk)
+	assert.True(t, earlierAsk < lowAsk)
+}
+
+func TestOrderBook_SubmitOrder_Rests(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: broker}
+
+	bondJSON, _ := json.Marshal(BondInfo{ID: "BOND_001", Status: "ACTIVE", Currency: "USD"})
+	ctx.stub.On("GetState", compositeKey("ORDER", "ORD_001")).Return(nil, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("GetBond"), []byte("BOND_001")}, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("ORDERSEQ", "BOND_001")).Return([]byte("4"), nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	onBook(ctx, "SELL")
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("SetEvent", "OrderBookEvent", mock.Anything).Return(nil)
+
+	order, err := ob.SubmitOrder(ctx, "ORD_001", "alice", "BOND_001", "BUY", 10, 100.5)
+	assert.NoError(t, err)
+	assert.Equal(t, "OPEN", order.Status)
+	assert.Equal(t, int64(5), order.Sequence)
+	assert.Equal(t, "5", string(ctx.stub.state[compositeKey("ORDERSEQ", "BOND_001")]))
+
+	key, _ := bookKey(ctx, order)
+	assert.Contains(t, ctx.stub.state, key)
+	assert.Empty(t, order.Fills)
+}
+
+func TestOrderBook_SubmitOrder_Matches(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: broker}
+
+	bondJSON, _ := json.Marshal(BondInfo{ID: "BOND_001", Status: "ACTIVE", Currency: "USD"})
+	own := restingOrder(ctx, "S0", "alice", "SELL", 100.0, 5, 1)
+	best := restingOrder(ctx, "S1", "bob", "SELL", 100.5, 10, 2)
+	next := restingOrder(ctx, "S2", "carol", "SELL", 101.0, 10, 3)
+	above := &Order{ID: "S3", BondID: "BOND_001", Trader: "dave", Side: "SELL", Price: 101.5, Sequence: 4} // never read, as the book stops crossing
+	ctx.stub.On("GetState", compositeKey("ORDER", "B1")).Return(nil, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("GetBond"), []byte("BOND_001")}, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("ORDERSEQ", "BOND_001")).Return([]byte("4"), nil)
+	ctx.stub.On("PutState", mock.Anything, mock.Anything).Return(nil)
+	ctx.stub.On("DelState", mock.Anything).Return(nil)
+	onBook(ctx, "SELL", own, best, next, above)
+	onDelivery(ctx, "bob", "alice", 10, TransferCheck{Allowed: true})
+	onDelivery(ctx, "carol", "alice", 5, TransferCheck{Allowed: true})
+	onCash(ctx, "alice", "1510.00")
+	ctx.stub.On("GetTxID").Return("tx124")
+	ctx.stub.On("SetEvent", "OrderBookEvent", mock.Anything).Return(nil)
+
+	order, err := ob.SubmitOrder(ctx, "B1", "alice", "BOND_001", "BUY", 15, 101.0)
+	assert.NoError(t, err)
+	assert.Equal(t, "FILLED", order.Status)
+	assert.Len(t, order.Fills, 2)
+
+	ctx.stub.AssertExpectations(t)
+
+	// Each fill is stored for the Settlement contract to read back
+	var fill Fill
+	json.Unmarshal(ctx.stub.state[compositeKey("FILL", "B1-1")], &fill)
+	assert.Equal(t, "B1", fill.BuyOrderID)
+	assert.Equal(t, "S1", fill.SellOrderID)
+	assert.Equal(t, int64(10), fill.Quantity)
+	assert.Equal(t, 100.5, fill.Price)
+	assert.Equal(t, time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), fill.SettlementDate)
+	json.Unmarshal(ctx.stub.state[compositeKey("FILL", "B1-2")], &fill)
+	assert.Equal(t, "S2", fill.SellOrderID)
+	assert.Equal(t, int64(5), fill.Quantity)
+
+	// The filled ask leaves the book, the partly filled one stays
+	bestKey, _ := bookKey(ctx, best)
+	nextKey, _ := bookKey(ctx, next)
+	ctx.stub.AssertCalled(t, "DelState", bestKey)
+	ctx.stub.AssertNotCalled(t, "DelState", nextKey)
+
+	var stored Order
+	json.Unmarshal(ctx.stub.state[compositeKey("ORDER", "S2")], &stored)
+	assert.Equal(t, "PARTIALLY_FILLED", stored.Status)
+	assert.Equal(t, int64(5), stored.Remaining)
+
+	// The trader's own ask is not matched
+	assert.NotContains(t, ctx.stub.state, compositeKey("ORDER", "S0"))
+}
+
+func TestOrderBook_SubmitOrder_TimePriority(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: broker}
+
+	// Two asks at the same price: the earlier one fills first
+	earlier := restingOrder(ctx, "S1", "bob", "SELL", 100.0, 10, 1)
+	later := &Order{ID: "S2", BondID: "BOND_001", Trader: "carol", Side: "SELL", Price: 100.0, Sequence: 2} // never read, as the buy is filled first
+	onSubmitOrder(ctx, "B1")
+	onBook(ctx, "SELL", earlier, later)
+	onDelivery(ctx, "bob", "alice", 10, TransferCheck{Allowed: true})
+	onCash(ctx, "alice", "25000.00")
+
+	order, err := ob.SubmitOrder(ctx, "B1", "alice", "BOND_001", "BUY", 10, 100.0)
+	assert.NoError(t, err)
+	assert.Equal(t, "FILLED", order.Status)
+	assert.Len(t, order.Fills, 1)
+	assert.Equal(t, "S1", order.Fills[0].SellOrderID)
+	assert.NotContains(t, ctx.stub.state, compositeKey("ORDER", "S2"))
+}
+
+func TestOrderBook_SubmitOrder_SkipsOwnOrders(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: broker}
+
+	own := restingOrder(ctx, "S1", "alice", "SELL", 99.0, 10, 1)
+	other := restingOrder(ctx, "S2", "bob", "SELL", 100.0, 10, 2)
+	onSubmitOrder(ctx, "B1")
+	onBook(ctx, "SELL", own, other)
+	onDelivery(ctx, "bob", "alice", 5, TransferCheck{Allowed: true})
+	onCash(ctx, "alice", "25000.00")
+
+	order, err := ob.SubmitOrder(ctx, "B1", "alice", "BOND_001", "BUY", 5, 100.0)
+	assert.NoError(t, err)
+	assert.Len(t, order.Fills, 1)
+	assert.Equal(t, "S2", order.Fills[0].SellOrderID)
+	assert.Equal(t, 100.0, order.Fills[0].Price)
+
+	// The trader's own better-priced ask stays on the book untouched
+	ownKey, _ := bookKey(ctx, own)
+	ctx.stub.AssertNotCalled(t, "DelState", ownKey)
+	assert.NotContains(t, ctx.stub.state, compositeKey("ORDER", "S1"))
+}
+
+func TestOrderBook_SubmitOrder_PartialFillRests(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: broker}
+
+	ask := restingOrder(ctx, "S1", "bob", "SELL", 100.0, 4, 1)
+	onSubmitOrder(ctx, "B1")
+	onBook(ctx, "SELL", ask)
+	onDelivery(ctx, "bob", "alice", 4, TransferCheck{Allowed: true})
+	onCash(ctx, "alice", "25000.00")
+
+	order, err := ob.SubmitOrder(ctx, "B1", "alice", "BOND_001", "BUY", 10, 100.5)
+	assert.NoError(t, err)
+	assert.Equal(t, "PARTIALLY_FILLED", order.Status)
+	assert.Equal(t, int64(6), order.Remaining)
+	assert.Equal(t, int64(4), order.Fills[0].Quantity)
+	assert.Equal(t, 100.0, order.Fills[0].Price)
+
+	// The rest of the bid joins the book and the filled ask leaves it
+	key, _ := bookKey(ctx, order)
+	assert.Contains(t, ctx.stub.state, key)
+	askKey, _ := bookKey(ctx, ask)
+	ctx.stub.AssertCalled(t, "DelState", askKey)
+}
+
+func TestOrderBook_SubmitOrder_StopsWhenPricesDoNotCross(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: broker}
+
+	best := restingOrder(ctx, "B1", "alice", "BUY", 99.0, 10, 1)
+	lower := &Order{ID: "B2", BondID: "BOND_001", Trader: "carol", Side: "BUY", Price: 98.0, Sequence: 2} // never read, as the best bid already misses
+	onSubmitOrder(ctx, "S1")
+	onBook(ctx, "BUY", best, lower)
+
+	order, err := ob.SubmitOrder(ctx, "S1", "bob", "BOND_001", "SELL", 10, 99.5)
+	assert.NoError(t, err)
+	assert.Equal(t, "OPEN", order.Status)
+	assert.Empty(t, order.Fills)
+	assert.NotContains(t, ctx.stub.state, compositeKey("ORDER", "B1"))
+
+	key, _ := bookKey(ctx, order)
+	assert.Contains(t, ctx.stub.state, key)
+}
+
+func TestOrderBook_SubmitOrder_SellerCannotDeliver(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: broker}
+
+	bid := restingOrder(ctx, "B1", "alice", "BUY", 100.0, 10, 1)
+	onSubmitOrder(ctx, "S1")
+	onBook(ctx, "BUY", bid)
+	onDelivery(ctx, "bob", "alice", 10, TransferCheck{Allowed: false, ReasonCode: "INSUFFICIENT_BALANCE", Reason: "insufficient balance: 4 < 10"})
+
+	_, err := ob.SubmitOrder(ctx, "S1", "bob", "BOND_001", "SELL", 10, 100.0)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "order S1 cannot be filled: bob cannot deliver 10 tokens of BOND_001: INSUFFICIENT_BALANCE")
+	ctx.stub.AssertNotCalled(t, "InvokeChaincode", "cashtoken", [][]byte{[]byte("BalanceOf"), []byte("alice"), []byte("USD")}, "")
+}
+
+func TestOrderBook_SubmitOrder_SkipsUnfundedBids(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: broker}
+
+	// alice's best bid is short of cash, carol's next one is funded
+	unfunded := restingOrder(ctx, "B1", "alice", "BUY", 100.0, 10, 1)
+	funded := restingOrder(ctx, "B2", "carol", "BUY", 99.5, 10, 2)
+	onSubmitOrder(ctx, "S1")
+	onBook(ctx, "BUY", unfunded, funded)
+	onDelivery(ctx, "bob", "alice", 10, TransferCheck{Allowed: true})
+	onDelivery(ctx, "bob", "carol", 10, TransferCheck{Allowed: true})
+	onCash(ctx, "alice", "500.00")
+	onCash(ctx, "carol", "995.00")
+
+	order, err := ob.SubmitOrder(ctx, "S1", "bob", "BOND_001", "SELL", 10, 99.0)
+	assert.NoError(t, err)
+	assert.Equal(t, "FILLED", order.Status)
+	assert.Len(t, order.Fills, 1)
+	assert.Equal(t, "B2", order.Fills[0].BuyOrderID)
+	assert.Equal(t, 99.5, order.Fills[0].Price)
+
+	// The unfunded bid stays on the book untouched
+	unfundedKey, _ := bookKey(ctx, unfunded)
+	ctx.stub.AssertNotCalled(t, "DelState", unfundedKey)
+	assert.NotContains(t, ctx.stub.state, compositeKey("ORDER", "B1"))
+}
+
+func TestOrderBook_CancelOrder(t *testing.T) {
+	ob := &OrderBook{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: &MockClientIdentity{id: "broker2", mspID: "MarketMakerMSP", attributes: map[string]string{"role": "BROKER"}}}
+
+	order := restingOrder(ctx, "S1", "bob", "SELL", 100.5, 10, 2)
+	key, _ := bookKey(ctx, order)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("DelState", key).Return(nil)
+	ctx.stub.On("GetTxID").Return("tx125")
+	ctx.stub.On("PutState", compositeKey("ORDER", "S1"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "OrderBookEvent", mock.Anything).Return(nil)
+
+	// Only the submitting broker may cancel
+	err := ob.CancelOrder(ctx, "S1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "broker that submitted it")
+
+	ctx.identity = broker
+	err = ob.CancelOrder(ctx, "S1")
+	assert.NoError(t, err)
+	ctx.stub.AssertCalled(t, "DelState", key)
+
+	var stored Order
+	json.Unmarshal(ctx.stub.state[compositeKey("ORDER", "S1")], &stored)
+	assert.Equal(t, "CANCELLED", stored.Status)
+}
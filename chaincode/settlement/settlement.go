@@ -0,0 +1,710 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Names the other bond contracts are deployed under
+const (
+	bondTokenChaincode = "bondtoken"
+	cashTokenChaincode = "cashtoken"
+	orderBookChaincode = "orderbook"
+)
+
+// Trades are stored under TRADE~tradeID keys
+const tradeObjectType = "TRADE"
+
+// settlementAgentRole is the client identity role attribute allowed to
+// record trades and move them through settlement
+const settlementAgentRole = "SETTLEMENT_AGENT"
+
+// Trade statuses. A trade is recorded MATCHED, INSTRUCTED once both sides
+// have instructed settlement, and ends SETTLED or FAILED.
+const (
+	tradeMatched    = "MATCHED"
+	tradeInstructed = "INSTRUCTED"
+	tradeSettled    = "SETTLED"
+	tradeFailed     = "FAILED"
+)
+
+// tradeTransitions lists the statuses a trade may move to from each status
+var tradeTransitions = map[string][]string{
+	tradeMatched:    {tradeInstructed, tradeFailed},
+	tradeInstructed: {tradeSettled, tradeFailed},
+}
+
+// Settlement represents the settlement contract
+type Settlement struct {
+	contractapi.Contract
+}
+
+// Trade represents a matched secondary-market trade in a bond and its
+// delivery-versus-payment settlement
+type Trade struct {
+	ID             string    `json:"id"`
+	Buyer          string    `json:"buyer"`
+	Seller         string    `json:"seller"`
+	BondID         string    `json:"bondId"`
+	Quantity       int64     `json:"quantity"`
+	Price          float64   `json:"price"`    // per token, in Currency
+	Amount         float64   `json:"amount"`   // cash leg, Price x Quantity
+	Currency       string    `json:"currency"` // the bond's denomination currency
+	TradeDate      time.Time `json:"tradeDate"`
+	SettlementDate time.Time `json:"settlementDate"`
+	Status         string    `json:"status"` // "MATCHED", "INSTRUCTED", "SETTLED", "FAILED"
+
+	InstructedAt  time.Time `json:"instructedAt,omitempty"`
+	SettledAt     time.Time `json:"settledAt,omitempty"`
+	FailedAt      time.Time `json:"failedAt,omitempty"`
+	FailureReason string    `json:"failureReason,omitempty"`
+
+	// Client identity that recorded the trade, and the MSP of the client
+	// that last wrote the record
+	RecordedBy   string `json:"recordedBy"`
+	UpdatedByMSP string `json:"updatedByMsp"`
+
+	Version int64  `json:"version"` // incremented on every write
+	TxID    string `json:"txId"`    // transaction that last wrote the record
+}
+
+// BondInfo is the subset of the BondToken contract's bond used here
+type BondInfo struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Currency string `json:"currency"`
+}
+
+// TransferCheck is the BondToken contract's verdict on a transfer
+type TransferCheck struct {
+	Allowed    bool   `json:"allowed"`
+	ReasonCode string `json:"reasonCode"`
+	Reason     string `json:"reason"`
+}
+
+// OrderInfo is the subset of the OrderBook contract's order used here
+type OrderInfo struct {
+	ID     string      `json:"id"`
+	BondID string      `json:"bondId"`
+	Trader string      `json:"trader"`
+	Side   string      `json:"side"`
+	Price  float64     `json:"price"`
+	Fills  []*FillInfo `json:"fills"`
+}
+
+// FillInfo is the OrderBook contract's match between a buy and a sell order
+type FillInfo struct {
+	TradeID        string    `json:"tradeId"`
+	BuyOrderID     string    `json:"buyOrderId"`
+	SellOrderID    string    `json:"sellOrderId"`
+	Quantity       int64     `json:"quantity"`
+	Price          float64   `json:"price"`
+	MatchedAt      time.Time `json:"matchedAt"`
+	SettlementDate time.Time `json:"settlementDate"`
+}
+
+// SettlementEvent represents a settlement event
+type SettlementEvent struct {
+	Type      string    `json:"type"`
+	TradeID   string    `json:"tradeId"`
+	BondID    string    `json:"bondId"`
+	Status    string    `json:"status"`
+	Details   string    `json:"details"`
+	Timestamp time.Time `json:"timestamp"`
+	TxID      string    `json:"txId"`
+}
+
+// Init initializes the contract
+func (s *Settlement) Init(ctx contractapi.TransactionContextInterface) error {
+	fmt.Println("Settlement contract initialized")
+	return nil
+}
+
+// RecordTrade records a matched trade of quantity tokens of bondID from
+// seller to buyer at price per token, to settle on settlementDateStr
+// (YYYY-MM-DD). The cash leg is paid in the bond's currency. Only
+// settlement agents may record trades; trades matched in the OrderBook
+// contract are recorded with RecordOrderBookTrade.
+func (s *Settlement) RecordTrade(ctx contractapi.TransactionContextInterface, tradeID, buyer, seller, bondID string, quantity int64, price float64, settlementDateStr string) error {
+	err := requireRole(ctx, settlementAgentRole)
+	if err != nil {
+		return err
+	}
+
+	if tradeID == "" || buyer == "" || seller == "" {
+		return fmt.Errorf("trade ID, buyer and seller are required")
+	}
+	if buyer == seller {
+		return fmt.Errorf("buyer and seller must differ")
+	}
+	if quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	if price <= 0 {
+		return fmt.Errorf("price must be positive")
+	}
+
+	settlementDate, err := time.Parse("2006-01-02", settlementDateStr)
+	if err != nil {
+		return fmt.Errorf("invalid settlement date format: %v", err)
+	}
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	tradeDate := now.Truncate(24 * time.Hour)
+	if settlementDate.Before(tradeDate) {
+		return fmt.Errorf("settlement date %s is before the trade date %s", settlementDateStr, tradeDate.Format("2006-01-02"))
+	}
+
+	trade := &Trade{
+		ID:             tradeID,
+		Buyer:          buyer,
+		Seller:         seller,
+		BondID:         bondID,
+		Quantity:       quantity,
+		Price:          price,
+		TradeDate:      tradeDate,
+		SettlementDate: settlementDate,
+	}
+	return recordTrade(ctx, trade, now)
+}
+
+// RecordOrderBookTrade records the trade an OrderBook contract fill made.
+// Nothing is taken from the caller: the fill and the buy and sell orders it
+// matched are read back from the OrderBook contract, and the trade is only
+// recorded if the orders are on opposite sides of the same bond for
+// different traders, both list the fill, and its price is within both
+// limits. Anyone may record an order book trade once the match has
+// committed.
+func (s *Settlement) RecordOrderBookTrade(ctx contractapi.TransactionContextInterface, tradeID string) error {
+	fill, err := getFill(ctx, tradeID)
+	if err != nil {
+		return err
+	}
+	buy, err := getOrder(ctx, fill.BuyOrderID)
+	if err != nil {
+		return err
+	}
+	sell, err := getOrder(ctx, fill.SellOrderID)
+	if err != nil {
+		return err
+	}
+
+	err = verifyFill(fill, buy, sell)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	trade := &Trade{
+		ID:             tradeID,
+		Buyer:          buy.Trader,
+		Seller:         sell.Trader,
+		BondID:         buy.BondID,
+		Quantity:       fill.Quantity,
+		Price:          fill.Price,
+		TradeDate:      fill.MatchedAt.Truncate(24 * time.Hour),
+		SettlementDate: fill.SettlementDate,
+	}
+	return recordTrade(ctx, trade, now)
+}
+
+// InstructTrade marks a matched trade as instructed for settlement. Only
+// settlement agents may instruct trades.
+func (s *Settlement) InstructTrade(ctx contractapi.TransactionContextInterface, tradeID string) error {
+	err := requireRole(ctx, settlementAgentRole)
+	if err != nil {
+		return err
+	}
+
+	trade, err := s.GetTrade(ctx, tradeID)
+	if err != nil {
+		return err
+	}
+	err = trade.transition(tradeInstructed)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	trade.InstructedAt = now
+
+	err = putTrade(ctx, trade)
+	if err != nil {
+		return err
+	}
+
+	return emitTradeEvent(ctx, "TRADE_INSTRUCTED", trade, fmt.Sprintf("Trade %s instructed for settlement on %s", tradeID, trade.SettlementDate.Format("2006-01-02")), now)
+}
+
+// SettleTrade settles an instructed trade on or after its settlement date,
+// delivery versus payment: the tokens move from seller to buyer in the
+// BondToken contract and the cash from buyer to seller in the CashToken
+// contract in the same transaction. Both legs are checked first, the
+// securities leg with BondToken's CanTransfer, which applies the
+// Compliance contract's rules, and the cash leg against the buyer's
+// balance; a trade failing either check is marked FAILED with the reason
+// and neither leg moves. Should a leg still be rejected, the error
+// discards the whole transaction, so one leg never settles without the
+// other. Only settlement agents may settle trades.
+func (s *Settlement) SettleTrade(ctx contractapi.TransactionContextInterface, tradeID string) (*Trade, error) {
+	err := requireRole(ctx, settlementAgentRole)
+	if err != nil {
+		return nil, err
+	}
+
+	trade, err := s.GetTrade(ctx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if trade.Status != tradeInstructed {
+		return nil, fmt.Errorf("trade %s is %s, only instructed trades can settle", tradeID, trade.Status)
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(trade.SettlementDate) {
+		return nil, fmt.Errorf("trade %s does not settle until %s", tradeID, trade.SettlementDate.Format("2006-01-02"))
+	}
+
+	check, err := canTransfer(ctx, trade)
+	if err != nil {
+		return nil, err
+	}
+	if !check.Allowed {
+		err = failTrade(ctx, trade, fmt.Sprintf("SECURITIES_LEG: %s: %s", check.ReasonCode, check.Reason), now)
+		if err != nil {
+			return nil, err
+		}
+		return trade, nil
+	}
+
+	balance, err := cashBalance(ctx, trade.Buyer, trade.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if balance < trade.Amount {
+		err = failTrade(ctx, trade, fmt.Sprintf("CASH_LEG: %s holds %.2f %s, %.2f required", trade.Buyer, balance, trade.Currency, trade.Amount), now)
+		if err != nil {
+			return nil, err
+		}
+		return trade, nil
+	}
+
+	// Securities leg
+	args := [][]byte{[]byte("Transfer"), []byte(trade.Seller), []byte(trade.Buyer), []byte(trade.BondID), []byte(strconv.FormatInt(trade.Quantity, 10))}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to deliver %d tokens of %s for trade %s: %s", trade.Quantity, trade.BondID, tradeID, response.Message)
+	}
+
+	// Cash leg
+	args = [][]byte{[]byte("Transfer"), []byte(trade.Buyer), []byte(trade.Seller), []byte(trade.Currency), []byte(fmt.Sprintf("%.2f", trade.Amount))}
+	response = ctx.GetStub().InvokeChaincode(cashTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to pay %.2f %s for trade %s: %s", trade.Amount, trade.Currency, tradeID, response.Message)
+	}
+
+	err = trade.transition(tradeSettled)
+	if err != nil {
+		return nil, err
+	}
+	trade.SettledAt = now
+
+	err = putTrade(ctx, trade)
+	if err != nil {
+		return nil, err
+	}
+
+	err = emitTradeEvent(ctx, "TRADE_SETTLED", trade, fmt.Sprintf("%d tokens of %s delivered against %.2f %s", trade.Quantity, trade.BondID, trade.Amount, trade.Currency), now)
+	if err != nil {
+		return nil, err
+	}
+
+	return trade, nil
+}
+
+// FailTrade marks a matched or instructed trade as failed, such as when a
+// counterparty cancels or misses the settlement date. Only settlement
+// agents may fail trades.
+func (s *Settlement) FailTrade(ctx contractapi.TransactionContextInterface, tradeID, reason string) error {
+	err := requireRole(ctx, settlementAgentRole)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("failure reason is required")
+	}
+
+	trade, err := s.GetTrade(ctx, tradeID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	return failTrade(ctx, trade, reason, now)
+}
+
+// GetTrade returns a trade
+func (s *Settlement) GetTrade(ctx contractapi.TransactionContextInterface, tradeID string) (*Trade, error) {
+	trade, err := getTrade(ctx, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if trade == nil {
+		return nil, fmt.Errorf("trade %s does not exist", tradeID)
+	}
+	return trade, nil
+}
+
+// GetTradesByStatus returns the trades with a status
+func (s *Settlement) GetTradesByStatus(ctx contractapi.TransactionContextInterface, status string) ([]*Trade, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tradeObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trades: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	trades := []*Trade{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to iterate results: %v", err)
+		}
+
+		var trade Trade
+		err = json.Unmarshal(queryResult.Value, &trade)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal trade: %v", err)
+		}
+		if trade.Status == status {
+			trades = append(trades, &trade)
+		}
+	}
+
+	return trades, nil
+}
+
+// transition moves a trade to a status, failing if its lifecycle does not
+// allow the move
+func (t *Trade) transition(status string) error {
+	for _, allowed := range tradeTransitions[t.Status] {
+		if allowed == status {
+			t.Status = status
+			return nil
+		}
+	}
+	return fmt.Errorf("trade %s cannot move from %s to %s", t.ID, t.Status, status)
+}
+
+// recordTrade stores a new MATCHED trade, paid in its bond's currency
+func recordTrade(ctx contractapi.TransactionContextInterface, trade *Trade, now time.Time) error {
+	existing, err := getTrade(ctx, trade.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("trade %s already exists", trade.ID)
+	}
+
+	bond, err := getBond(ctx, trade.BondID)
+	if err != nil {
+		return err
+	}
+	if bond.Status == "VOID" || bond.Status == "MATURED" {
+		return fmt.Errorf("bond %s is %s and can no longer be traded", trade.BondID, strings.ToLower(bond.Status))
+	}
+
+	trade.RecordedBy, err = ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	trade.Amount = roundAmount(trade.Price * float64(trade.Quantity))
+	trade.Currency = bond.Currency
+	trade.Status = tradeMatched
+
+	err = putTrade(ctx, trade)
+	if err != nil {
+		return err
+	}
+
+	return emitTradeEvent(ctx, "TRADE_MATCHED", trade, fmt.Sprintf("%d tokens of %s from %s to %s at %.2f %s, settling %s", trade.Quantity, trade.BondID, trade.Seller, trade.Buyer, trade.Price, trade.Currency, trade.SettlementDate.Format("2006-01-02")), now)
+}
+
+// verifyFill checks that an OrderBook fill is a genuine match of the buy
+// and sell orders it names
+func verifyFill(fill *FillInfo, buy, sell *OrderInfo) error {
+	if buy.Side != "BUY" || sell.Side != "SELL" {
+		return fmt.Errorf("fill %s does not match a buy order with a sell order", fill.TradeID)
+	}
+	if buy.BondID != sell.BondID {
+		return fmt.Errorf("fill %s matches orders in different bonds", fill.TradeID)
+	}
+	if buy.Trader == sell.Trader {
+		return fmt.Errorf("fill %s matches two orders of trader %s", fill.TradeID, buy.Trader)
+	}
+	if fill.Quantity <= 0 {
+		return fmt.Errorf("fill %s has no quantity", fill.TradeID)
+	}
+	price := priceCents(fill.Price)
+	if price > priceCents(buy.Price) || price < priceCents(sell.Price) {
+		return fmt.Errorf("fill %s price %.2f is outside the orders' limits", fill.TradeID, fill.Price)
+	}
+
+	// Both orders must carry the fill as the OrderBook contract stored it
+	for _, order := range []*OrderInfo{buy, sell} {
+		listed := false
+		for _, f := range order.Fills {
+			if f.TradeID == fill.TradeID && f.BuyOrderID == fill.BuyOrderID && f.SellOrderID == fill.SellOrderID && f.Quantity == fill.Quantity && priceCents(f.Price) == price {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			return fmt.Errorf("order %s does not list fill %s", order.ID, fill.TradeID)
+		}
+	}
+	return nil
+}
+
+// failTrade marks a trade as failed with a reason, stores it and emits the
+// failure
+func failTrade(ctx contractapi.TransactionContextInterface, trade *Trade, reason string, now time.Time) error {
+	err := trade.transition(tradeFailed)
+	if err != nil {
+		return err
+	}
+	trade.FailedAt = now
+	trade.FailureReason = reason
+
+	err = putTrade(ctx, trade)
+	if err != nil {
+		return err
+	}
+
+	return emitTradeEvent(ctx, "TRADE_FAILED", trade, reason, now)
+}
+
+// getTrade returns a trade, or nil if it does not exist
+func getTrade(ctx contractapi.TransactionContextInterface, tradeID string) (*Trade, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(tradeObjectType, []string{tradeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trade key: %v", err)
+	}
+
+	tradeJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trade: %v", err)
+	}
+	if tradeJSON == nil {
+		return nil, nil
+	}
+
+	var trade Trade
+	err = json.Unmarshal(tradeJSON, &trade)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal trade: %v", err)
+	}
+	return &trade, nil
+}
+
+// putTrade bumps the trade's version, records the invoker MSP and
+// transaction and stores it
+func putTrade(ctx contractapi.TransactionContextInterface, trade *Trade) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	trade.UpdatedByMSP = mspID
+	trade.TxID = ctx.GetStub().GetTxID()
+	trade.Version++
+
+	tradeJSON, err := json.Marshal(trade)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trade: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(tradeObjectType, []string{trade.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create trade key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, tradeJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store trade: %v", err)
+	}
+	return nil
+}
+
+// emitTradeEvent emits a settlement event for a trade
+func emitTradeEvent(ctx contractapi.TransactionContextInterface, eventType string, trade *Trade, details string, now time.Time) error {
+	event := SettlementEvent{
+		Type:      eventType,
+		TradeID:   trade.ID,
+		BondID:    trade.BondID,
+		Status:    trade.Status,
+		Details:   details,
+		Timestamp: now,
+		TxID:      trade.TxID,
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("SettlementEvent", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+	return nil
+}
+
+// canTransfer asks the BondToken contract whether the securities leg of a
+// trade would be accepted
+func canTransfer(ctx contractapi.TransactionContextInterface, trade *Trade) (*TransferCheck, error) {
+	args := [][]byte{[]byte("CanTransfer"), []byte(trade.Seller), []byte(trade.Buyer), []byte(trade.BondID), []byte(strconv.FormatInt(trade.Quantity, 10))}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to check transfer for trade %s: %s", trade.ID, response.Message)
+	}
+
+	var check TransferCheck
+	err := json.Unmarshal(response.Payload, &check)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transfer check: %v", err)
+	}
+
+	return &check, nil
+}
+
+// cashBalance reads an account's balance in a currency from the CashToken
+// contract
+func cashBalance(ctx contractapi.TransactionContextInterface, account, currency string) (float64, error) {
+	args := [][]byte{[]byte("BalanceOf"), []byte(account), []byte(currency)}
+	response := ctx.GetStub().InvokeChaincode(cashTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return 0, fmt.Errorf("failed to get balance of %s: %s", account, response.Message)
+	}
+	balance, err := strconv.ParseFloat(strings.TrimSpace(string(response.Payload)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid balance of %s: %v", account, err)
+	}
+	return balance, nil
+}
+
+// getBond reads a bond from the BondToken contract
+func getBond(ctx contractapi.TransactionContextInterface, bondID string) (*BondInfo, error) {
+	args := [][]byte{[]byte("GetBond"), []byte(bondID)}
+	response := ctx.GetStub().InvokeChaincode(bondTokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get bond %s: %s", bondID, response.Message)
+	}
+
+	var bond BondInfo
+	err := json.Unmarshal(response.Payload, &bond)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bond: %v", err)
+	}
+
+	return &bond, nil
+}
+
+// getFill reads a fill from the OrderBook contract
+func getFill(ctx contractapi.TransactionContextInterface, tradeID string) (*FillInfo, error) {
+	args := [][]byte{[]byte("GetFill"), []byte(tradeID)}
+	response := ctx.GetStub().InvokeChaincode(orderBookChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get fill %s: %s", tradeID, response.Message)
+	}
+
+	var fill FillInfo
+	err := json.Unmarshal(response.Payload, &fill)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fill: %v", err)
+	}
+
+	return &fill, nil
+}
+
+// getOrder reads an order from the OrderBook contract
+func getOrder(ctx contractapi.TransactionContextInterface, orderID string) (*OrderInfo, error) {
+	args := [][]byte{[]byte("GetOrder"), []byte(orderID)}
+	response := ctx.GetStub().InvokeChaincode(orderBookChaincode, args, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get order %s: %s", orderID, response.Message)
+	}
+
+	var order OrderInfo
+	err := json.Unmarshal(response.Payload, &order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal order: %v", err)
+	}
+
+	return &order, nil
+}
+
+// requireRole checks that the invoking identity carries one of the given
+// values in its "role" certificate attribute
+func requireRole(ctx contractapi.TransactionContextInterface, roles ...string) error {
+	for _, role := range roles {
+		if ctx.GetClientIdentity().AssertAttributeValue("role", role) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("caller is not authorized: %s role required", strings.Join(roles, " or "))
+}
+
+// txTimestamp returns the timestamp the client set in the transaction
+// proposal, so every endorsing peer computes the same dates from it
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// priceCents returns a price in whole cents
+func priceCents(price float64) int64 {
+	return int64(math.Round(price * 100))
+}
+
+// roundAmount rounds a cash amount to two decimal places
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func main() {
+	chaincode, err := contractapi.NewChaincode(&Settlement{})
+	if err != nil {
+		fmt.Printf("Error creating Settlement chaincode: %s", err.Error())
+		return
+	}
+
+	if err := chaincode.Start(); err != nil {
+		fmt.Printf("Error starting Settlement chaincode: %s", err.Error())
+	}
+}
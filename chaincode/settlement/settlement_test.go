@@ -0,0 +1,463 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockStub is a mock implementation of the chaincode stub. Stub methods
+// the contract does not use are left to the embedded interface and panic
+// if called.
+type MockStub struct {
+	shim.ChaincodeStubInterface
+	mock.Mock
+	state map[string][]byte
+}
+
+func (m *MockStub) GetState(key string) ([]byte, error) {
+	args := m.Called(key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockStub) PutState(key string, value []byte) error {
+	args := m.Called(key, value)
+	m.state[key] = value
+	return args.Error(0)
+}
+
+func (m *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	args := m.Called()
+	return args.Get(0).(*timestamp.Timestamp), args.Error(1)
+}
+
+func (m *MockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return compositeKey(objectType, attributes...), nil
+}
+
+func (m *MockStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	args := m.Called(objectType, keys)
+	return args.Get(0).(shim.StateQueryIteratorInterface), args.Error(1)
+}
+
+// compositeKey builds a composite key using the same encoding as the Fabric shim
+func compositeKey(objectType string, attributes ...string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
+}
+
+func (m *MockStub) GetTxID() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *MockStub) SetEvent(name string, payload []byte) error {
+	args := m.Called(name, payload)
+	return args.Error(0)
+}
+
+func (m *MockStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	called := m.Called(chaincodeName, args, channel)
+	return called.Get(0).(peer.Response)
+}
+
+// MockContext is a mock implementation of the transaction context
+type MockContext struct {
+	mock.Mock
+	stub     *MockStub
+	identity *MockClientIdentity // defaults to a client of Org1MSP without attributes
+}
+
+func (m *MockContext) GetClientIdentity() cid.ClientIdentity {
+	if m.identity != nil {
+		return m.identity
+	}
+	return &MockClientIdentity{id: "client", mspID: "Org1MSP"}
+}
+
+// MockClientIdentity is a fixed client identity
+type MockClientIdentity struct {
+	id         string
+	mspID      string
+	attributes map[string]string
+}
+
+// settlementAgent is a client holding the SETTLEMENT_AGENT role
+var settlementAgent = &MockClientIdentity{id: "settler", mspID: "CustodianMSP", attributes: map[string]string{"role": "SETTLEMENT_AGENT"}}
+
+func (m *MockClientIdentity) GetID() (string, error) {
+	return m.id, nil
+}
+
+func (m *MockClientIdentity) GetMSPID() (string, error) {
+	return m.mspID, nil
+}
+
+func (m *MockClientIdentity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := m.attributes[name]
+	return value, found, nil
+}
+
+func (m *MockClientIdentity) AssertAttributeValue(name, value string) error {
+	if m.attributes[name] != value {
+		return fmt.Errorf("attribute %s does not have value %s", name, value)
+	}
+	return nil
+}
+
+func (m *MockClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+func (m *MockContext) GetStub() shim.ChaincodeStubInterface {
+	return m.stub
+}
+
+// MockIterator is a mock implementation of the state query iterator
+type MockIterator struct {
+	mock.Mock
+	results [][]byte
+	index   int
+}
+
+func (m *MockIterator) HasNext() bool {
+	return m.index < len(m.results)
+}
+
+func (m *MockIterator) Next() (*queryresult.KV, error) {
+	if m.index >= len(m.results) {
+		return nil, nil
+	}
+
+	result := &queryresult.KV{
+		Key:   fmt.Sprintf("key_%d", m.index),
+		Value: m.results[m.index],
+	}
+	m.index++
+	return result, nil
+}
+
+func (m *MockIterator) Close() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// instructedTrade returns a stored instructed trade of 10 tokens of
+// BOND_001 from bob to alice for 10,100.00 USD, settling on 2024-03-05
+func instructedTrade(ctx *MockContext) *Trade {
+	trade := &Trade{
+		ID:             "TRADE_001",
+		Buyer:          "alice",
+		Seller:         "bob",
+		BondID:         "BOND_001",
+		Quantity:       10,
+		Price:          1010.0,
+		Amount:         10100.0,
+		Currency:       "USD",
+		SettlementDate: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		Status:         "INSTRUCTED",
+		Version:        2,
+	}
+	tradeJSON, _ := json.Marshal(trade)
+	ctx.stub.On("GetState", compositeKey("TRADE", "TRADE_001")).Return(tradeJSON, nil)
+	return trade
+}
+
+func TestSettlement_Init(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	err := s.Init(ctx)
+	assert.NoError(t, err)
+}
+
+func TestSettlement_RecordTrade(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	bondJSON, _ := json.Marshal(BondInfo{ID: "BOND_001", Status: "ACTIVE", Currency: "USD"})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("TRADE", "TRADE_001")).Return(nil, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("GetBond"), []byte("BOND_001")}, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", compositeKey("TRADE", "TRADE_001"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "SettlementEvent", mock.Anything).Return(nil)
+
+	err := s.RecordTrade(ctx, "TRADE_001", "alice", "bob", "BOND_001", 10, 1010.0, "2024-02-28")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "before the trade date")
+
+	err = s.RecordTrade(ctx, "TRADE_001", "alice", "bob", "BOND_001", 10, 1010.0, "2024-03-05")
+	assert.NoError(t, err)
+
+	var trade Trade
+	json.Unmarshal(ctx.stub.state[compositeKey("TRADE", "TRADE_001")], &trade)
+	assert.Equal(t, "MATCHED", trade.Status)
+	assert.Equal(t, 10100.0, trade.Amount)
+	assert.Equal(t, "USD", trade.Currency)
+	assert.Equal(t, "settler", trade.RecordedBy)
+	assert.Equal(t, int64(1), trade.Version)
+
+	// Only settlement agents may record trades
+	ctx.identity = nil
+	err = s.RecordTrade(ctx, "TRADE_002", "alice", "bob", "BOND_001", 10, 1010.0, "2024-03-05")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SETTLEMENT_AGENT role required")
+}
+
+// onOrderBookFill mocks the OrderBook contract's fill B1-1 of buy order B1
+// by alice against sell order S1 by bob, and the two orders as given
+func onOrderBookFill(ctx *MockContext, buy, sell *OrderInfo) {
+	fill := &FillInfo{
+		TradeID:        "B1-1",
+		BuyOrderID:     "B1",
+		SellOrderID:    "S1",
+		Quantity:       10,
+		Price:          100.5,
+		MatchedAt:      time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		SettlementDate: time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC),
+	}
+	if buy.Fills == nil {
+		buy.Fills = []*FillInfo{fill}
+	}
+	if sell.Fills == nil {
+		sell.Fills = []*FillInfo{fill}
+	}
+	fillJSON, _ := json.Marshal(fill)
+	buyJSON, _ := json.Marshal(buy)
+	sellJSON, _ := json.Marshal(sell)
+	ctx.stub.On("InvokeChaincode", "orderbook", [][]byte{[]byte("GetFill"), []byte("B1-1")}, "").Return(peer.Response{Status: 200, Payload: fillJSON})
+	ctx.stub.On("InvokeChaincode", "orderbook", [][]byte{[]byte("GetOrder"), []byte("B1")}, "").Return(peer.Response{Status: 200, Payload: buyJSON})
+	ctx.stub.On("InvokeChaincode", "orderbook", [][]byte{[]byte("GetOrder"), []byte("S1")}, "").Return(peer.Response{Status: 200, Payload: sellJSON})
+}
+
+func TestSettlement_RecordOrderBookTrade(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	bondJSON, _ := json.Marshal(BondInfo{ID: "BOND_001", Status: "ACTIVE", Currency: "USD"})
+	onOrderBookFill(ctx,
+		&OrderInfo{ID: "B1", BondID: "BOND_001", Trader: "alice", Side: "BUY", Price: 101.0},
+		&OrderInfo{ID: "S1", BondID: "BOND_001", Trader: "bob", Side: "SELL", Price: 100.5})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetState", compositeKey("TRADE", "B1-1")).Return(nil, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("GetBond"), []byte("BOND_001")}, "").Return(peer.Response{Status: 200, Payload: bondJSON})
+	ctx.stub.On("GetTxID").Return("tx123")
+	ctx.stub.On("PutState", compositeKey("TRADE", "B1-1"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "SettlementEvent", mock.Anything).Return(nil)
+
+	// Any client may record the trade, as it is read from the order book
+	err := s.RecordOrderBookTrade(ctx, "B1-1")
+	assert.NoError(t, err)
+
+	var trade Trade
+	json.Unmarshal(ctx.stub.state[compositeKey("TRADE", "B1-1")], &trade)
+	assert.Equal(t, "MATCHED", trade.Status)
+	assert.Equal(t, "alice", trade.Buyer)
+	assert.Equal(t, "bob", trade.Seller)
+	assert.Equal(t, int64(10), trade.Quantity)
+	assert.Equal(t, 1005.0, trade.Amount)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), trade.TradeDate)
+	assert.Equal(t, time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), trade.SettlementDate)
+}
+
+func TestSettlement_RecordOrderBookTrade_Unverified(t *testing.T) {
+	s := &Settlement{}
+
+	// The sell order does not list the fill
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	onOrderBookFill(ctx,
+		&OrderInfo{ID: "B1", BondID: "BOND_001", Trader: "alice", Side: "BUY", Price: 101.0},
+		&OrderInfo{ID: "S1", BondID: "BOND_001", Trader: "bob", Side: "SELL", Price: 100.5, Fills: []*FillInfo{}})
+
+	err := s.RecordOrderBookTrade(ctx, "B1-1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "order S1 does not list fill B1-1")
+
+	// The fill's price is below the sell order's limit
+	ctx = &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	onOrderBookFill(ctx,
+		&OrderInfo{ID: "B1", BondID: "BOND_001", Trader: "alice", Side: "BUY", Price: 101.0},
+		&OrderInfo{ID: "S1", BondID: "BOND_001", Trader: "bob", Side: "SELL", Price: 100.75})
+
+	err = s.RecordOrderBookTrade(ctx, "B1-1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "outside the orders' limits")
+
+	// Both orders belong to the same trader
+	ctx = &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+	onOrderBookFill(ctx,
+		&OrderInfo{ID: "B1", BondID: "BOND_001", Trader: "alice", Side: "BUY", Price: 101.0},
+		&OrderInfo{ID: "S1", BondID: "BOND_001", Trader: "alice", Side: "SELL", Price: 100.5})
+
+	err = s.RecordOrderBookTrade(ctx, "B1-1")
+	assert.Error(t, err)
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+}
+
+func TestSettlement_InstructTrade_NotMatched(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	instructedTrade(ctx)
+
+	err := s.InstructTrade(ctx, "TRADE_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot move from INSTRUCTED to INSTRUCTED")
+}
+
+func TestSettlement_SettleTrade(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	instructedTrade(ctx)
+	checkJSON, _ := json.Marshal(TransferCheck{Allowed: true})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("CanTransfer"), []byte("bob"), []byte("alice"), []byte("BOND_001"), []byte("10")}, "").Return(peer.Response{Status: 200, Payload: checkJSON})
+	ctx.stub.On("InvokeChaincode", "cashtoken", [][]byte{[]byte("BalanceOf"), []byte("alice"), []byte("USD")}, "").Return(peer.Response{Status: 200, Payload: []byte("25000.00")})
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("Transfer"), []byte("bob"), []byte("alice"), []byte("BOND_001"), []byte("10")}, "").Return(peer.Response{Status: 200})
+	ctx.stub.On("InvokeChaincode", "cashtoken", [][]byte{[]byte("Transfer"), []byte("alice"), []byte("bob"), []byte("USD"), []byte("10100.00")}, "").Return(peer.Response{Status: 200})
+	ctx.stub.On("GetTxID").Return("tx124")
+	ctx.stub.On("PutState", compositeKey("TRADE", "TRADE_001"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "SettlementEvent", mock.Anything).Return(nil)
+
+	trade, err := s.SettleTrade(ctx, "TRADE_001")
+	assert.NoError(t, err)
+	assert.Equal(t, "SETTLED", trade.Status)
+	assert.Equal(t, int64(3), trade.Version)
+
+	ctx.stub.AssertExpectations(t)
+}
+
+func TestSettlement_SettleTrade_CashShortfall(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	instructedTrade(ctx)
+	checkJSON, _ := json.Marshal(TransferCheck{Allowed: true})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("CanTransfer"), []byte("bob"), []byte("alice"), []byte("BOND_001"), []byte("10")}, "").Return(peer.Response{Status: 200, Payload: checkJSON})
+	ctx.stub.On("InvokeChaincode", "cashtoken", [][]byte{[]byte("BalanceOf"), []byte("alice"), []byte("USD")}, "").Return(peer.Response{Status: 200, Payload: []byte("5000.00")})
+	ctx.stub.On("GetTxID").Return("tx124")
+	ctx.stub.On("PutState", compositeKey("TRADE", "TRADE_001"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "SettlementEvent", mock.Anything).Return(nil)
+
+	trade, err := s.SettleTrade(ctx, "TRADE_001")
+	assert.NoError(t, err)
+	assert.Equal(t, "FAILED", trade.Status)
+	assert.Contains(t, trade.FailureReason, "CASH_LEG")
+
+	// Neither leg moved
+	ctx.stub.AssertNotCalled(t, "InvokeChaincode", "bondtoken", [][]byte{[]byte("Transfer"), []byte("bob"), []byte("alice"), []byte("BOND_001"), []byte("10")}, "")
+}
+
+func TestSettlement_SettleTrade_BeforeSettlementDate(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	instructedTrade(ctx)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	_, err := s.SettleTrade(ctx, "TRADE_001")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not settle until 2024-03-05")
+}
+
+func TestSettlement_SettleTrade_SecuritiesLegDenied(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	instructedTrade(ctx)
+	checkJSON, _ := json.Marshal(TransferCheck{Allowed: false, ReasonCode: "NOT_COMPLIANT", Reason: "JURISDICTION_BLOCKED: jurisdiction US is blocked"})
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("InvokeChaincode", "bondtoken", [][]byte{[]byte("CanTransfer"), []byte("bob"), []byte("alice"), []byte("BOND_001"), []byte("10")}, "").Return(peer.Response{Status: 200, Payload: checkJSON})
+	ctx.stub.On("GetTxID").Return("tx124")
+	ctx.stub.On("PutState", compositeKey("TRADE", "TRADE_001"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "SettlementEvent", mock.Anything).Return(nil)
+
+	trade, err := s.SettleTrade(ctx, "TRADE_001")
+	assert.NoError(t, err)
+	assert.Equal(t, "FAILED", trade.Status)
+	assert.Equal(t, "SECURITIES_LEG: NOT_COMPLIANT: JURISDICTION_BLOCKED: jurisdiction US is blocked", trade.FailureReason)
+
+	// The cash balance is not read and neither leg moves
+	ctx.stub.AssertNotCalled(t, "InvokeChaincode", "cashtoken", mock.Anything, "")
+	ctx.stub.AssertNotCalled(t, "InvokeChaincode", "bondtoken", [][]byte{[]byte("Transfer"), []byte("bob"), []byte("alice"), []byte("BOND_001"), []byte("10")}, "")
+}
+
+func TestSettlement_FailTrade(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	instructedTrade(ctx)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+	ctx.stub.On("GetTxID").Return("tx125")
+	ctx.stub.On("PutState", compositeKey("TRADE", "TRADE_001"), mock.Anything).Return(nil)
+	ctx.stub.On("SetEvent", "SettlementEvent", mock.Anything).Return(nil)
+
+	err := s.FailTrade(ctx, "TRADE_001", "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failure reason is required")
+
+	err = s.FailTrade(ctx, "TRADE_001", "seller missed the settlement date")
+	assert.NoError(t, err)
+
+	var trade Trade
+	json.Unmarshal(ctx.stub.state[compositeKey("TRADE", "TRADE_001")], &trade)
+	assert.Equal(t, "FAILED", trade.Status)
+	assert.Equal(t, "seller missed the settlement date", trade.FailureReason)
+	assert.Equal(t, time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC), trade.FailedAt)
+}
+
+func TestSettlement_FailTrade_Settled(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}, identity: settlementAgent}
+
+	settled := Trade{ID: "TRADE_001", Status: "SETTLED"}
+	settledJSON, _ := json.Marshal(settled)
+	ctx.stub.On("GetState", compositeKey("TRADE", "TRADE_001")).Return(settledJSON, nil)
+	ctx.stub.On("GetTxTimestamp").Return(&timestamp.Timestamp{Seconds: time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC).Unix()}, nil)
+
+	err := s.FailTrade(ctx, "TRADE_001", "counterparty cancelled")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot move from SETTLED to FAILED")
+	ctx.stub.AssertNotCalled(t, "PutState", mock.Anything, mock.Anything)
+
+	// Only settlement agents may fail trades
+	ctx.identity = nil
+	err = s.FailTrade(ctx, "TRADE_001", "counterparty cancelled")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "SETTLEMENT_AGENT role required")
+}
+
+func TestSettlement_GetTradesByStatus(t *testing.T) {
+	s := &Settlement{}
+	ctx := &MockContext{stub: &MockStub{state: make(map[string][]byte)}}
+
+	matched, _ := json.Marshal(Trade{ID: "TRADE_001", Status: "MATCHED"})
+	settled, _ := json.Marshal(Trade{ID: "TRADE_002", Status: "SETTLED"})
+	iterator := &MockIterator{results: [][]byte{matched, settled}}
+	iterator.On("Close").Return(nil)
+	ctx.stub.On("GetStateByPartialCompositeKey", "TRADE", []string{}).Return(iterator, nil)
+
+	trades, err := s.GetTradesByStatus(ctx, "SETTLED")
+	assert.NoError(t, err)
+	assert.Len(t, trades, 1)
+	assert.Equal(t, "TRADE_002", trades[0].ID)
+}
@@ -27,21 +27,22 @@ show_usage() {
     echo "Usage: $0 <command> [options]"
     echo ""
     echo "Commands:"
-    echo "  create-kyc <address> <full_name> <dob> <nationality> <id_type> <id_number>"
-    echo "  approve-kyc <address> <approved_by> <risk_level>"
-    echo "  reject-kyc <address> <rejected_by> <reason>"
+    echo "  create-kyc <address> <full_name> <dob> <nationality> <id_type> <id_number> [id_expiry]"
+    echo "  approve-kyc <address> <risk_level>"
+    echo "  reject-kyc <address> <reason>"
     echo "  create-aml <address> <check_type> <risk_score> <details>"
     echo "  update-aml <address> <check_type> <status> <risk_score> <details>"
     echo "  check-compliance <address>"
     echo "  get-kyc <address>"
     echo "  get-aml <address> <check_type>"
     echo "  get-all-kyc"
+    echo "  query-kyc <status> <risk_level> <nationality> [page_size] [bookmark]"
     echo "  get-all-aml <address>"
     echo "  help"
     echo ""
     echo "Examples:"
     echo "  $0 create-kyc alice 'Alice Johnson' '1990-01-01' 'US' 'PASSPORT' 'US123456'"
-    echo "  $0 approve-kyc alice admin1 LOW"
+    echo "  $0 approve-kyc alice LOW"
     echo "  $0 create-aml alice SANCTIONS 5 'No sanctions found'"
     echo "  $0 check-compliance alice"
 }
@@ -81,13 +82,19 @@ create_kyc() {
     local nationality=$4
     local id_type=$5
     local id_number=$6
+    local id_expiry=$7
 
     echo -e "${YELLOW}Creating KYC record for: $address${NC}"
 
+    # Personal data goes in transient data so it stays off the channel ledger
+    # The identity document is taken to be issued by the investor's country
+    local pii=$(echo -n "{\"fullName\":\"$full_name\",\"dateOfBirth\":\"$dob\",\"documents\":[{\"type\":\"$id_type\",\"number\":\"$id_number\",\"issuingCountry\":\"$nationality\",\"expiryDate\":\"$id_expiry\"}]}" | base64 | tr -d '\n')
+
     peer chaincode invoke \
         -C $CHANNEL_NAME \
         -n $CHAINCODE_NAME \
-        -c "{\"Args\":[\"CreateKYC\",\"$address\",\"$full_name\",\"$dob\",\"$nationality\",\"$id_type\",\"$id_number\"]}" \
+        -c "{\"Args\":[\"CreateKYC\",\"$address\",\"$nationality\"]}" \
+        --transient "{\"kyc\":\"$pii\"}" \
         --tls \
         --cafile $ORDERER_CA
 
@@ -97,15 +104,14 @@ create_kyc() {
 # Function to approve KYC
 approve_kyc() {
     local address=$1
-    local approved_by=$2
-    local risk_level=$3
+    local risk_level=$2
 
-    echo -e "${YELLOW}Approving KYC for: $address by $approved_by with risk level: $risk_level${NC}"
+    echo -e "${YELLOW}Approving KYC for: $address with risk level: $risk_level${NC}"
 
     peer chaincode invoke \
         -C $CHANNEL_NAME \
         -n $CHAINCODE_NAME \
-        -c "{\"Args\":[\"ApproveKYC\",\"$address\",\"$approved_by\",\"$risk_level\"]}" \
+        -c "{\"Args\":[\"ApproveKYC\",\"$address\",\"$risk_level\",\"0\"]}" \
         --tls \
         --cafile $ORDERER_CA
 
@@ -115,15 +121,14 @@ approve_kyc() {
 # Function to reject KYC
 reject_kyc() {
     local address=$1
-    local rejected_by=$2
-    local reason=$3
+    local reason=$2
 
-    echo -e "${YELLOW}Rejecting KYC for: $address by $rejected_by with reason: $reason${NC}"
+    echo -e "${YELLOW}Rejecting KYC for: $address with reason: $reason${NC}"
 
     peer chaincode invoke \
         -C $CHANNEL_NAME \
         -n $CHAINCODE_NAME \
-        -c "{\"Args\":[\"RejectKYC\",\"$address\",\"$rejected_by\",\"$reason\"]}" \
+        -c "{\"Args\":[\"RejectKYC\",\"$address\",\"$reason\",\"0\"]}" \
         --tls \
         --cafile $ORDERER_CA
 
@@ -200,11 +205,10 @@ get_aml() {
 
     echo -e "${YELLOW}Querying AML check for: $address, type: $check_type${NC}"
 
-    local check_key="${address}_${check_type}"
     peer chaincode query \
         -C $CHANNEL_NAME \
         -n $CHAINCODE_NAME \
-        -c "{\"Args\":[\"GetAMLCheck\",\"$check_key\"]}"
+        -c "{\"Args\":[\"GetAMLCheck\",\"$address\",\"$check_type\"]}"
 }
 
 # Function to get all KYC records
@@ -217,6 +221,23 @@ get_all_kyc() {
         -c "{\"Args\":[\"GetAllKYC\"]}"
 }
 
+# Function to query one page of KYC records by status, risk level and
+# nationality; pass "" to match any value
+query_kyc() {
+    local status=$1
+    local risk_level=$2
+    local nationality=$3
+    local page_size=${4:-100}
+    local bookmark=$5
+
+    echo -e "${YELLOW}Querying KYC records: status=$status, risk level=$risk_level, nationality=$nationality${NC}"
+
+    peer chaincode query \
+        -C $CHANNEL_NAME \
+        -n $CHAINCODE_NAME \
+        -c "{\"Args\":[\"QueryKYC\",\"$status\",\"$risk_level\",\"$nationality\",\"$page_size\",\"$bookmark\"]}"
+}
+
 # Function to get all AML checks for an address
 get_all_aml() {
     local address=$1
@@ -244,22 +265,22 @@ main() {
     # Parse command
     case "$1" in
         "create-kyc")
-            if [ $# -ne 7 ]; then
-                handle_error "create-kyc requires 6 arguments"
+            if [ $# -ne 7 ] && [ $# -ne 8 ]; then
+                handle_error "create-kyc requires 6 or 7 arguments"
             fi
-            create_kyc "$2" "$3" "$4" "$5" "$6" "$7"
+            create_kyc "$2" "$3" "$4" "$5" "$6" "$7" "$8"
             ;;
         "approve-kyc")
-            if [ $# -ne 4 ]; then
-                handle_error "approve-kyc requires 3 arguments"
+            if [ $# -ne 3 ]; then
+                handle_error "approve-kyc requires 2 arguments"
             fi
-            approve_kyc "$2" "$3" "$4"
+            approve_kyc "$2" "$3"
             ;;
         "reject-kyc")
-            if [ $# -ne 4 ]; then
-                handle_error "reject-kyc requires 3 arguments"
+            if [ $# -ne 3 ]; then
+                handle_error "reject-kyc requires 2 arguments"
             fi
-            reject_kyc "$2" "$3" "$4"
+            reject_kyc "$2" "$3"
             ;;
         "create-aml")
             if [ $# -ne 5 ]; then
@@ -294,6 +315,12 @@ main() {
         "get-all-kyc")
             get_all_kyc
             ;;
+        "query-kyc")
+            if [ $# -lt 4 ] || [ $# -gt 6 ]; then
+                handle_error "query-kyc requires 3 to 5 arguments"
+            fi
+            query_kyc "$2" "$3" "$4" "$5" "$6"
+            ;;
         "get-all-aml")
             if [ $# -ne 2 ]; then
                 handle_error "get-all-aml requires 1 argument"
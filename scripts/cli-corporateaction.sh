@@ -37,7 +37,7 @@ show_usage() {
     echo "  get-redemptions-by-bond <bond_id>"
     echo "  get-pending-coupons"
     echo "  get-pending-redemptions"
-    echo "  calculate-coupon <bond_id> <face_value> <coupon_rate>"
+    echo "  calculate-coupon <bond_id> <face_value> <coupon_rate> [period_start period_end [day_count]]"
     echo "  help"
     echo ""
     echo "Examples:"
@@ -45,6 +45,7 @@ show_usage() {
     echo "  $0 process-coupon COUPON_001"
     echo "  $0 create-redemption BOND_001 2029-01-01 1000.00"
     echo "  $0 calculate-coupon BOND_001 1000.00 5.0"
+    echo "  $0 calculate-coupon BOND_001 1000.00 5.0 2024-04-15 2024-07-15 ACT/365"
 }
 
 # Function to check if peer CLI is available
@@ -215,13 +216,16 @@ calculate_coupon() {
     local bond_id=$1
     local face_value=$2
     local coupon_rate=$3
+    local period_start=$4
+    local period_end=$5
+    local day_count=$6
 
     echo -e "${YELLOW}Calculating coupon amount for bond: $bond_id${NC}"
 
     peer chaincode query \
         -C $CHANNEL_NAME \
         -n $CHAINCODE_NAME \
-        -c "{\"Args\":[\"CalculateCouponAmount\",\"$bond_id\",\"$face_value\",\"$coupon_rate\"]}"
+        -c "{\"Args\":[\"CalculateCouponAmount\",\"$bond_id\",\"$face_value\",\"$coupon_rate\",\"$period_start\",\"$period_end\",\"$day_count\"]}"
 }
 
 # Function to handle errors
@@ -293,10 +297,10 @@ main() {
             get_pending_redemptions
             ;;
         "calculate-coupon")
-            if [ $# -ne 4 ]; then
-                handle_error "calculate-coupon requires 3 arguments"
+            if [ $# -lt 4 ] || [ $# -gt 7 ]; then
+                handle_error "calculate-coupon requires 3 to 6 arguments"
             fi
-            calculate_coupon "$2" "$3" "$4"
+            calculate_coupon "$2" "$3" "$4" "$5" "$6" "$7"
             ;;
         "help"|"-h"|"--help")
             show_usage
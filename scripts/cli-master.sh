@@ -218,7 +218,7 @@ handle_bondtoken_operations() {
                 peer chaincode invoke \
                     -C $CHANNEL_NAME \
                     -n $BONDTOKEN_CHAINCODE \
-                    -c "{\"Args\":[\"UpdateBondStatus\",\"$bond_id\",\"$new_status\"]}" \
+                    -c "{\"Args\":[\"UpdateBondStatus\",\"$bond_id\",\"$new_status\",\"0\"]}" \
                     --tls \
                     --cafile $ORDERER_CA
                 echo -e "${GREEN}✓ Bond status updated successfully${NC}"
@@ -269,12 +269,17 @@ handle_compliance_operations() {
                 read -r id_type
                 echo -n "Enter ID Number: "
                 read -r id_number
+                echo -n "Enter ID Expiry (YYYY-MM-DD, blank if none): "
+                read -r id_expiry
                 
                 echo -e "${YELLOW}Creating KYC record for: $address${NC}"
+                # Personal data goes in transient data so it stays off the channel ledger
+                pii=$(echo -n "{\"fullName\":\"$full_name\",\"dateOfBirth\":\"$dob\",\"documents\":[{\"type\":\"$id_type\",\"number\":\"$id_number\",\"issuingCountry\":\"$nationality\",\"expiryDate\":\"$id_expiry\"}]}" | base64 | tr -d '\n')
                 peer chaincode invoke \
                     -C $CHANNEL_NAME \
                     -n $COMPLIANCE_CHAINCODE \
-                    -c "{\"Args\":[\"CreateKYC\",\"$address\",\"$full_name\",\"$dob\",\"$nationality\",\"$id_type\",\"$id_number\"]}" \
+                    -c "{\"Args\":[\"CreateKYC\",\"$address\",\"$nationality\"]}" \
+                    --transient "{\"kyc\":\"$pii\"}" \
                     --tls \
                     --cafile $ORDERER_CA
                 echo -e "${GREEN}✓ KYC record created successfully${NC}"
@@ -282,8 +287,6 @@ handle_compliance_operations() {
             2)
                 echo -n "Enter Address: "
                 read -r address
-                echo -n "Enter Approved By: "
-                read -r approved_by
                 echo -n "Enter Risk Level (LOW/MEDIUM/HIGH): "
                 read -r risk_level
                 
@@ -291,7 +294,7 @@ handle_compliance_operations() {
                 peer chaincode invoke \
                     -C $CHANNEL_NAME \
                     -n $COMPLIANCE_CHAINCODE \
-                    -c "{\"Args\":[\"ApproveKYC\",\"$address\",\"$approved_by\",\"$risk_level\"]}" \
+                    -c "{\"Args\":[\"ApproveKYC\",\"$address\",\"$risk_level\",\"0\"]}" \
                     --tls \
                     --cafile $ORDERER_CA
                 echo -e "${GREEN}✓ KYC approved successfully${NC}"
@@ -299,8 +302,6 @@ handle_compliance_operations() {
             3)
                 echo -n "Enter Address: "
                 read -r address
-                echo -n "Enter Rejected By: "
-                read -r rejected_by
                 echo -n "Enter Reason: "
                 read -r reason
                 
@@ -308,7 +309,7 @@ handle_compliance_operations() {
                 peer chaincode invoke \
                     -C $CHANNEL_NAME \
                     -n $COMPLIANCE_CHAINCODE \
-                    -c "{\"Args\":[\"RejectKYC\",\"$address\",\"$rejected_by\",\"$reason\"]}" \
+                    -c "{\"Args\":[\"RejectKYC\",\"$address\",\"$reason\",\"0\"]}" \
                     --tls \
                     --cafile $ORDERER_CA
                 echo -e "${GREEN}✓ KYC rejected successfully${NC}"
@@ -379,12 +380,11 @@ handle_compliance_operations() {
                 echo -n "Enter Check Type: "
                 read -r check_type
                 
-                local check_key="${address}_${check_type}"
                 echo -e "${YELLOW}Querying AML check for: $address${NC}"
                 peer chaincode query \
                     -C $CHANNEL_NAME \
                     -n $COMPLIANCE_CHAINCODE \
-                    -c "{\"Args\":[\"GetAMLCheck\",\"$check_key\"]}"
+                    -c "{\"Args\":[\"GetAMLCheck\",\"$address\",\"$check_type\"]}"
                 ;;
             9)
                 echo -e "${YELLOW}Querying all KYC records${NC}"
@@ -547,12 +547,18 @@ handle_corporateaction_operations() {
                 read -r face_value
                 echo -n "Enter Coupon Rate (%): "
                 read -r coupon_rate
+                echo -n "Enter Period Start (YYYY-MM-DD, blank for a regular period): "
+                read -r period_start
+                echo -n "Enter Period End (YYYY-MM-DD, blank for a regular period): "
+                read -r period_end
+                echo -n "Enter Day Count (30/360, ACT/360, ACT/365, ACT/ACT, blank for bond default): "
+                read -r day_count
                 
                 echo -e "${YELLOW}Calculating coupon amount for bond: $bond_id${NC}"
                 peer chaincode query \
                     -C $CHANNEL_NAME \
                     -n $CORPORATEACTION_CHAINCODE \
-                    -c "{\"Args\":[\"CalculateCouponAmount\",\"$bond_id\",\"$face_value\",\"$coupon_rate\"]}"
+                    -c "{\"Args\":[\"CalculateCouponAmount\",\"$bond_id\",\"$face_value\",\"$coupon_rate\",\"$period_start\",\"$period_end\",\"$day_count\"]}"
                 ;;
             12)
                 break
@@ -154,7 +154,7 @@ update_bond_status() {
     peer chaincode invoke \
         -C $CHANNEL_NAME \
         -n $CHAINCODE_NAME \
-        -c "{\"Args\":[\"UpdateBondStatus\",\"$bond_id\",\"$new_status\"]}" \
+        -c "{\"Args\":[\"UpdateBondStatus\",\"$bond_id\",\"$new_status\",\"0\"]}" \
         --tls \
         --cafile $ORDERER_CA
     
@@ -115,7 +115,7 @@ main() {
     
     # Step 4: KYC Approval (Regulator + Custodian endorsement)
     print_step "4" "KYC Approval with Custodian Validation" "Demonstrating multi-organization endorsement policy"
-    execute_command "./scripts/cli-compliance.sh approve-kyc $INVESTOR_ADDRESS 'regulator1' 'LOW'" \
+    execute_command "./scripts/cli-compliance.sh approve-kyc $INVESTOR_ADDRESS 'LOW'" \
         "Approving KYC with custodian validation"
     
     # Step 5: Bond Transfer (Seller + Custodian + Market Maker endorsement)
@@ -68,6 +68,24 @@ package_chaincode() {
         peer lifecycle chaincode package corporateaction.tar.gz --path ./corporateaction --lang golang --label corporateaction_1.0
     fi
     
+    # Package CashToken chaincode
+    if [ -d "cashtoken" ]; then
+        print_status "Packaging CashToken chaincode..."
+        peer lifecycle chaincode package cashtoken.tar.gz --path ./cashtoken --lang golang --label cashtoken_1.0
+    fi
+    
+    # Package Settlement chaincode
+    if [ -d "settlement" ]; then
+        print_status "Packaging Settlement chaincode..."
+        peer lifecycle chaincode package settlement.tar.gz --path ./settlement --lang golang --label settlement_1.0
+    fi
+    
+    # Package OrderBook chaincode
+    if [ -d "orderbook" ]; then
+        print_status "Packaging OrderBook chaincode..."
+        peer lifecycle chaincode package orderbook.tar.gz --path ./orderbook --lang golang --label orderbook_1.0
+    fi
+    
     cd ..
 }
 
@@ -98,6 +116,24 @@ install_on_issuer() {
         peer lifecycle chaincode install chaincode/corporateaction.tar.gz
         print_status "CorporateAction chaincode installed on issuer peer."
     fi
+    
+    # Install CashToken chaincode
+    if [ -f "chaincode/cashtoken.tar.gz" ]; then
+        peer lifecycle chaincode install chaincode/cashtoken.tar.gz
+        print_status "CashToken chaincode installed on issuer peer."
+    fi
+    
+    # Install Settlement chaincode
+    if [ -f "chaincode/settlement.tar.gz" ]; then
+        peer lifecycle chaincode install chaincode/settlement.tar.gz
+        print_status "Settlement chaincode installed on issuer peer."
+    fi
+    
+    # Install OrderBook chaincode
+    if [ -f "chaincode/orderbook.tar.gz" ]; then
+        peer lifecycle chaincode install chaincode/orderbook.tar.gz
+        print_status "OrderBook chaincode installed on issuer peer."
+    fi
 }
 
 # Install chaincode on investor peer
@@ -127,6 +163,24 @@ install_on_investor() {
         peer lifecycle chaincode install chaincode/corporateaction.tar.gz
         print_status "CorporateAction chaincode installed on investor peer."
     fi
+    
+    # Install CashToken chaincode
+    if [ -f "chaincode/cashtoken.tar.gz" ]; then
+        peer lifecycle chaincode install chaincode/cashtoken.tar.gz
+        print_status "CashToken chaincode installed on investor peer."
+    fi
+    
+    # Install Settlement chaincode
+    if [ -f "chaincode/settlement.tar.gz" ]; then
+        peer lifecycle chaincode install chaincode/settlement.tar.gz
+        print_status "Settlement chaincode installed on investor peer."
+    fi
+    
+    # Install OrderBook chaincode
+    if [ -f "chaincode/orderbook.tar.gz" ]; then
+        peer lifecycle chaincode install chaincode/orderbook.tar.gz
+        print_status "OrderBook chaincode installed on investor peer."
+    fi
 }
 
 # Approve chaincode definitions
@@ -143,6 +197,9 @@ approve_chaincode() {
     BONDTOKEN_PACKAGE_ID=$(peer lifecycle chaincode queryinstalled | grep "bondtoken_1.0" | awk '{print $3}' | sed 's/,//')
     COMPLIANCE_PACKAGE_ID=$(peer lifecycle chaincode queryinstalled | grep "compliance_1.0" | awk '{print $3}' | sed 's/,//')
     CORPORATEACTION_PACKAGE_ID=$(peer lifecycle chaincode queryinstalled | grep "corporateaction_1.0" | awk '{print $3}' | sed 's/,//')
+    CASHTOKEN_PACKAGE_ID=$(peer lifecycle chaincode queryinstalled | grep "cashtoken_1.0" | awk '{print $3}' | sed 's/,//')
+    SETTLEMENT_PACKAGE_ID=$(peer lifecycle chaincode queryinstalled | grep "settlement_1.0" | awk '{print $3}' | sed 's/,//')
+    ORDERBOOK_PACKAGE_ID=$(peer lifecycle chaincode queryinstalled | grep "orderbook_1.0" | awk '{print $3}' | sed 's/,//')
     
     # Approve BondToken
     if [ ! -z "$BONDTOKEN_PACKAGE_ID" ]; then
@@ -152,7 +209,7 @@ approve_chaincode() {
     
     # Approve Compliance
     if [ ! -z "$COMPLIANCE_PACKAGE_ID" ]; then
-        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name compliance --version 1.0 --package-id $COMPLIANCE_PACKAGE_ID --sequence 1
+        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name compliance --version 1.0 --package-id $COMPLIANCE_PACKAGE_ID --sequence 1 --collections-config ${PWD}/network/collections_config.json
         print_status "Compliance chaincode approved by issuer."
     fi
     
@@ -162,6 +219,24 @@ approve_chaincode() {
         print_status "CorporateAction chaincode approved by issuer."
     fi
     
+    # Approve CashToken
+    if [ ! -z "$CASHTOKEN_PACKAGE_ID" ]; then
+        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name cashtoken --version 1.0 --package-id $CASHTOKEN_PACKAGE_ID --sequence 1
+        print_status "CashToken chaincode approved by issuer."
+    fi
+    
+    # Approve Settlement
+    if [ ! -z "$SETTLEMENT_PACKAGE_ID" ]; then
+        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name settlement --version 1.0 --package-id $SETTLEMENT_PACKAGE_ID --sequence 1
+        print_status "Settlement chaincode approved by issuer."
+    fi
+    
+    # Approve OrderBook
+    if [ ! -z "$ORDERBOOK_PACKAGE_ID" ]; then
+        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name orderbook --version 1.0 --package-id $ORDERBOOK_PACKAGE_ID --sequence 1
+        print_status "OrderBook chaincode approved by issuer."
+    fi
+    
     # Approve by investor
     export CORE_PEER_LOCALMSPID=InvestorMSP
     export CORE_PEER_MSPCONFIGPATH=${PWD}/organizations/peerOrganizations/investor.bondbridge.com/users/Admin@investor.bondbridge.com/msp
@@ -174,7 +249,7 @@ approve_chaincode() {
     fi
     
     if [ ! -z "$COMPLIANCE_PACKAGE_ID" ]; then
-        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name compliance --version 1.0 --package-id $COMPLIANCE_PACKAGE_ID --sequence 1
+        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name compliance --version 1.0 --package-id $COMPLIANCE_PACKAGE_ID --sequence 1 --collections-config ${PWD}/network/collections_config.json
         print_status "Compliance chaincode approved by investor."
     fi
     
@@ -182,6 +257,21 @@ approve_chaincode() {
         peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name corporateaction --version 1.0 --package-id $CORPORATEACTION_PACKAGE_ID --sequence 1
         print_status "CorporateAction chaincode approved by investor."
     fi
+    
+    if [ ! -z "$CASHTOKEN_PACKAGE_ID" ]; then
+        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name cashtoken --version 1.0 --package-id $CASHTOKEN_PACKAGE_ID --sequence 1
+        print_status "CashToken chaincode approved by investor."
+    fi
+    
+    if [ ! -z "$SETTLEMENT_PACKAGE_ID" ]; then
+        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name settlement --version 1.0 --package-id $SETTLEMENT_PACKAGE_ID --sequence 1
+        print_status "Settlement chaincode approved by investor."
+    fi
+    
+    if [ ! -z "$ORDERBOOK_PACKAGE_ID" ]; then
+        peer lifecycle chaincode approveformyorg -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name orderbook --version 1.0 --package-id $ORDERBOOK_PACKAGE_ID --sequence 1
+        print_status "OrderBook chaincode approved by investor."
+    fi
 }
 
 # Commit chaincode definitions
@@ -202,7 +292,7 @@ commit_chaincode() {
     
     # Commit Compliance
     if [ -f "chaincode/compliance.tar.gz" ]; then
-        peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name compliance --version 1.0 --sequence 1
+        peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name compliance --version 1.0 --sequence 1 --collections-config ${PWD}/network/collections_config.json
         print_status "Compliance chaincode committed to bondchannel."
     fi
     
@@ -211,6 +301,24 @@ commit_chaincode() {
         peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name corporateaction --version 1.0 --sequence 1
         print_status "CorporateAction chaincode committed to bondchannel."
     fi
+    
+    # Commit CashToken
+    if [ -f "chaincode/cashtoken.tar.gz" ]; then
+        peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name cashtoken --version 1.0 --sequence 1
+        print_status "CashToken chaincode committed to bondchannel."
+    fi
+    
+    # Commit Settlement
+    if [ -f "chaincode/settlement.tar.gz" ]; then
+        peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name settlement --version 1.0 --sequence 1
+        print_status "Settlement chaincode committed to bondchannel."
+    fi
+    
+    # Commit OrderBook
+    if [ -f "chaincode/orderbook.tar.gz" ]; then
+        peer lifecycle chaincode commit -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com --channelID bondchannel --name orderbook --version 1.0 --sequence 1
+        print_status "OrderBook chaincode committed to bondchannel."
+    fi
 }
 
 # Test chaincode
@@ -240,6 +348,24 @@ test_chaincode() {
         peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com -C bondchannel -n corporateaction --isInit -c '{"Args":["Init"]}'
         print_status "CorporateAction chaincode initialized successfully."
     fi
+    
+    # Test CashToken initialization
+    if [ -f "chaincode/cashtoken.tar.gz" ]; then
+        peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com -C bondchannel -n cashtoken --isInit -c '{"Args":["Init"]}'
+        print_status "CashToken chaincode initialized successfully."
+    fi
+    
+    # Test Settlement initialization
+    if [ -f "chaincode/settlement.tar.gz" ]; then
+        peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com -C bondchannel -n settlement --isInit -c '{"Args":["Init"]}'
+        print_status "Settlement chaincode initialized successfully."
+    fi
+    
+    # Test OrderBook initialization
+    if [ -f "chaincode/orderbook.tar.gz" ]; then
+        peer chaincode invoke -o localhost:7050 --ordererTLSHostnameOverride orderer.bondbridge.com -C bondchannel -n orderbook --isInit -c '{"Args":["Init"]}'
+        print_status "OrderBook chaincode initialized successfully."
+    fi
 }
 
 # Main execution
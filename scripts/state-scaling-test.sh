@@ -0,0 +1,395 @@
+#!/bin/bash
+
+# BondBridge State Scaling Test
+# Generates a large synthetic dataset of holder and corporate action records
+# through the chaincode, measures query latency per access pattern (range
+# scan vs composite key vs rich query) and block sizes per transaction, and
+# writes a capacity-planning report used to guide the state index design.
+#
+# Every record is written by a committed transaction, so the world state
+# stays consistent with the ledger. The records cannot be removed again -
+# run this against a test network and tear it down afterwards. The client
+# identity must hold the compliance officer and paying agent roles, and
+# rich queries need the peer to run with stateDatabase: CouchDB.
+
+set -e
+
+# Configuration (override via environment)
+CHANNEL_NAME="${CHANNEL_NAME:-bondchannel}"
+CHAINCODE_NAME="${CHAINCODE_NAME:-bondtoken}"
+COMPLIANCE_CHAINCODE="${COMPLIANCE_CHAINCODE:-compliance}"
+CORPORATEACTION_CHAINCODE="${CORPORATEACTION_CHAINCODE:-corporateaction}"
+ORDERER_ADDRESS="${ORDERER_ADDRESS:-localhost:7050}"
+ORDERER_CA="${ORDERER_CA:-/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/ordererOrganizations/example.com/orderers/orderer.example.com/msp/tlscacerts/tlsca.example.com-cert.pem}"
+HOLDERS="${HOLDERS:-1000000}"
+BONDS="${BONDS:-500}"
+MATURITY_DATE="${MATURITY_DATE:-2056-01-01}"
+CONCURRENCY="${CONCURRENCY:-50}"
+RUNS="${RUNS:-20}"
+SAMPLE_TXS="${SAMPLE_TXS:-200}"
+WORK_DIR="${WORK_DIR:-/tmp/bondbridge-scaling}"
+REPORT_DIR="${REPORT_DIR:-./reports}"
+
+# Every synthetic investor holds one bond per BONDS holder records
+INVESTORS=$(( (HOLDERS + BONDS - 1) / BONDS ))
+if [ "$INVESTORS" -lt "$BONDS" ]; then
+    INVESTORS=$BONDS
+fi
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+show_usage() {
+    echo -e "${BLUE}BondBridge State Scaling Test${NC}"
+    echo "Usage: $0 <command>"
+    echo ""
+    echo "Commands:"
+    echo "  generate   Issue bonds, onboard investors and load holders and coupon schedules"
+    echo "  bench      Measure query latency for range scan, composite key and rich query"
+    echo "  blocks     Submit sample transactions and measure block sizes"
+    echo "  report     Write the capacity-planning report from collected results"
+    echo "  all        Run generate, bench, blocks and report"
+    echo "  clean      Delete the local work files"
+    echo ""
+    echo "Environment:"
+    echo "  HOLDERS=$HOLDERS BONDS=$BONDS MATURITY_DATE=$MATURITY_DATE CONCURRENCY=$CONCURRENCY RUNS=$RUNS"
+    echo "  CHANNEL_NAME=$CHANNEL_NAME ORDERER_ADDRESS=$ORDERER_ADDRESS ORDERER_CA=$ORDERER_CA"
+}
+
+check_prerequisites() {
+    for cmd in peer awk sort base64; do
+        if ! command -v $cmd &> /dev/null; then
+            echo -e "${RED}Error: $cmd not found${NC}"
+            exit 1
+        fi
+    done
+
+    if [ ! -f "$ORDERER_CA" ]; then
+        echo -e "${RED}Error: orderer TLS CA certificate not found at $ORDERER_CA${NC}"
+        exit 1
+    fi
+
+    if ! peer channel getinfo -c "$CHANNEL_NAME" > /dev/null 2>&1; then
+        echo -e "${RED}Error: channel $CHANNEL_NAME not reachable from this peer${NC}"
+        exit 1
+    fi
+
+    mkdir -p "$WORK_DIR" "$REPORT_DIR"
+}
+
+# Submits a transaction and waits until it is committed, so the next wave
+# reads its writes instead of failing the MVCC check
+invoke() {
+    local chaincode=$1
+    local args=$2
+    shift 2
+    peer chaincode invoke -o "$ORDERER_ADDRESS" -C "$CHANNEL_NAME" -n "$chaincode" \
+        --tls --cafile "$ORDERER_CA" --waitForEvent \
+        -c "{\"Args\":$args}" "$@" > /dev/null 2>&1
+}
+
+query() {
+    local chaincode=$1
+    local args=$2
+    peer chaincode query -C "$CHANNEL_NAME" -n "$chaincode" -c "{\"Args\":$args}" > /dev/null 2>&1
+}
+
+# Runs one invoke per input line, CONCURRENCY at a time. Each line is
+# "<chaincode>|<args-json>[|<transient-json>]". Lines within a wave must
+# touch different keys; a blank line forces a wave boundary.
+run_waves() {
+    local label=$1
+    local submitted=0
+    local failed=0
+    local inflight=0
+    local pids=()
+
+    while IFS='|' read -r chaincode args transient; do
+        if [ -n "$chaincode" ]; then
+            if [ -n "$transient" ]; then
+                invoke "$chaincode" "$args" --transient "$transient" &
+            else
+                invoke "$chaincode" "$args" &
+            fi
+            pids+=($!)
+            inflight=$((inflight + 1))
+        fi
+        if [ -z "$chaincode" ] || [ "$inflight" -ge "$CONCURRENCY" ]; then
+            for pid in "${pids[@]}"; do
+                if ! wait "$pid"; then
+                    failed=$((failed + 1))
+                fi
+            done
+            submitted=$((submitted + inflight))
+            pids=()
+            inflight=0
+            echo -ne "\r  $submitted $label submitted, $failed failed"
+        fi
+    done
+    for pid in "${pids[@]}"; do
+        if ! wait "$pid"; then
+            failed=$((failed + 1))
+        fi
+    done
+    submitted=$((submitted + inflight))
+    echo -e "\r  $submitted $label submitted, $failed failed"
+    [ "$failed" -eq 0 ]
+}
+
+bond_id() {
+    printf "BOND_%05d" "$1"
+}
+
+# Emits one transfer per holder record out of the supply IssueBond allots to
+# the issuer. Holder i goes to investor (j + d) % INVESTORS in bond j, walking
+# the diagonals d, so a wave never touches the same holding, investor or
+# issuer balance twice.
+generate_holders() {
+    awk -v holders="$HOLDERS" -v bonds="$BONDS" -v investors="$INVESTORS" -v cc="$CHAINCODE_NAME" 'BEGIN {
+        n = 0
+        for (d = 0; d < investors && n < holders; d++) {
+            for (j = 0; j < bonds && n < holders; j++) {
+                printf "%s|[\"Transfer\",\"ISSUER_SCALE\",\"inv%08d\",\"BOND_%05d\",\"%d\"]\n", cc, (j + d) % investors, j, (n % 100) + 1
+                n++
+            }
+            print ""
+        }
+    }'
+}
+
+load() {
+    local name=$1
+    local label=$2
+    local start_time=$(date +%s)
+
+    if ! run_waves "$label"; then
+        echo -e "${RED}✗ Some $label were rejected, see the peer logs${NC}"
+        exit 1
+    fi
+
+    local duration=$(( $(date +%s) - start_time ))
+    echo -e "${GREEN}✓ Loaded $label in ${duration}s${NC}"
+    echo "load_${name}_seconds=$duration" >> "$WORK_DIR/results.env"
+}
+
+generate() {
+    check_prerequisites
+    : > "$WORK_DIR/results.env"
+
+    echo -e "${YELLOW}Issuing $BONDS bonds maturing $MATURITY_DATE...${NC}"
+    local supply=$(( INVESTORS * 100 ))
+    for j in $(seq 0 $((BONDS - 1))); do
+        local bond=$(bond_id "$j")
+        echo "$CHAINCODE_NAME|[\"IssueBond\",\"$bond\",\"ISSUER_SCALE\",\"Scaling Test Issuer\",\"USD\",\"US0SCALE$j\",\"AA\",\"NONE\",\"1000\",\"5\",\"$supply\",\"$MATURITY_DATE\"]"
+    done | load bonds "bonds"
+
+    echo -e "${YELLOW}Onboarding $INVESTORS synthetic investors...${NC}"
+    local pii=$(echo -n '{"fullName":"Scaling Test Investor","dateOfBirth":"1980-01-01","documents":[{"type":"PASSPORT","number":"SCALE","issuingCountry":"US","expiryDate":"2040-01-01"}]}' | base64 | tr -d '\n')
+    for i in $(seq 0 $((INVESTORS - 1))); do
+        printf "%s|[\"CreateKYC\",\"inv%08d\",\"US\"]|{\"kyc\":\"%s\"}\n" "$COMPLIANCE_CHAINCODE" "$i" "$pii"
+    done | load kyc "KYC records"
+    for i in $(seq 0 $((INVESTORS - 1))); do
+        printf "%s|[\"ApproveKYC\",\"inv%08d\",\"LOW\",\"0\"]\n" "$COMPLIANCE_CHAINCODE" "$i"
+    done | load kyc_approval "KYC approvals"
+
+    echo -e "${YELLOW}Loading $HOLDERS holder records across $BONDS bonds...${NC}"
+    generate_holders | load holder "holder records"
+
+    echo -e "${YELLOW}Generating coupon schedules for $BONDS bonds...${NC}"
+    for j in $(seq 0 $((BONDS - 1))); do
+        echo "$CORPORATEACTION_CHAINCODE|[\"GenerateCouponSchedule\",\"$(bond_id "$j")\"]"
+    done | load coupon "coupon schedules"
+
+    # Every bond has the same terms, so the first schedule stands for all
+    local coupons=$(peer chaincode query -C "$CHANNEL_NAME" -n "$CORPORATEACTION_CHAINCODE" \
+        -c "{\"Args\":[\"GetCouponPaymentsByBond\",\"$(bond_id 0)\"]}" 2> /dev/null | grep -o '"paymentDate"' | wc -l)
+    echo "investors=$INVESTORS" >> "$WORK_DIR/results.env"
+    echo "actions=$((coupons * BONDS))" >> "$WORK_DIR/results.env"
+}
+
+# Runs a chaincode query RUNS times and records p50/p95 latency in
+# milliseconds. Latency includes the peer CLI round trip, which is the same
+# for every approach.
+measure() {
+    local name=$1
+    local chaincode=$2
+    local args=$3
+    local samples="$WORK_DIR/$name.samples"
+    : > "$samples"
+
+    for run in $(seq 1 "$RUNS"); do
+        local start=$(date +%s%N)
+        if ! query "$chaincode" "$args"; then
+            echo -e "${RED}✗ $name query failed: $args${NC}"
+            return 1
+        fi
+        echo $(( ($(date +%s%N) - start) / 1000 )) >> "$samples"
+    done
+
+    local p50=$(sort -n "$samples" | awk '{a[NR]=$1} END {printf "%.1f", a[int(NR*0.5)+(NR%2)]/1000}')
+    local p95=$(sort -n "$samples" | awk '{a[NR]=$1} END {i=int(NR*0.95); if (i<1) i=1; printf "%.1f", a[i]/1000}')
+    echo -e "  $name: p50=${p50}ms p95=${p95}ms"
+    echo "${name}_p50=$p50" >> "$WORK_DIR/results.env"
+    echo "${name}_p95=$p95" >> "$WORK_DIR/results.env"
+}
+
+bench() {
+    check_prerequisites
+    local bond=$(bond_id 1)
+    echo -e "${YELLOW}Measuring lookups for $bond over $RUNS runs...${NC}"
+
+    # Range scan: every bond record, read and returned in full
+    measure range_scan "$CHAINCODE_NAME" '["GetAllBonds"]'
+
+    # Composite key: partial key range over HOLDER~bondID
+    measure composite_key "$CHAINCODE_NAME" "[\"GetBondHolders\",\"$bond\"]"
+
+    # Composite key, one page of the same range
+    measure composite_key_paged "$CHAINCODE_NAME" "[\"GetBondHoldersWithPagination\",\"$bond\",\"100\",\"\"]"
+
+    # Rich query: CouchDB selector backed by the shipped docType/bondId/status index
+    measure rich_query "$CORPORATEACTION_CHAINCODE" "[\"QueryActions\",\"{\\\"type\\\":\\\"COUPON\\\",\\\"bondId\\\":\\\"$bond\\\"}\",\"100\",\"\"]"
+
+    # Rich query across all bonds, backed by the docType/status/amount index
+    measure rich_query_status "$CORPORATEACTION_CHAINCODE" '["QueryActions","{\"type\":\"COUPON\",\"status\":\"PENDING\"}","100",""]'
+
+    echo -e "${GREEN}✓ Benchmark complete${NC}"
+}
+
+blocks() {
+    if ! command -v peer &> /dev/null; then
+        echo -e "${YELLOW}Warning: peer CLI not found, skipping block size measurement${NC}"
+        return 0
+    fi
+    mkdir -p "$WORK_DIR/blocks"
+
+    local start_height=$(peer channel getinfo -c "$CHANNEL_NAME" | sed -n 's/.*"height":\([0-9]*\).*/\1/p')
+    echo -e "${YELLOW}Submitting $SAMPLE_TXS sample transactions from block $start_height...${NC}"
+
+    for i in $(seq 1 "$SAMPLE_TXS"); do
+        peer chaincode invoke -o "$ORDERER_ADDRESS" -C "$CHANNEL_NAME" -n "$CHAINCODE_NAME" \
+            --tls --cafile "$ORDERER_CA" \
+            -c "{\"Args\":[\"IssueBond\",\"SCALE_$i\",\"ISSUER_SCALE\",\"Scaling Test Issuer\",\"USD\",\"US000SCALE$i\",\"AA\",\"NONE\",\"1000\",\"5\",\"100000\",\"2030-01-01\"]}" \
+            > /dev/null 2>&1 &
+        if (( i % 20 == 0 )); then wait; fi
+    done
+    wait
+    sleep 5
+
+    local end_height=$(peer channel getinfo -c "$CHANNEL_NAME" | sed -n 's/.*"height":\([0-9]*\).*/\1/p')
+    local total_bytes=0
+    local block_count=0
+    for n in $(seq "$start_height" $((end_height - 1))); do
+        peer channel fetch "$n" "$WORK_DIR/blocks/$n.block" -c "$CHANNEL_NAME" -o "$ORDERER_ADDRESS" \
+            --tls --cafile "$ORDERER_CA" > /dev/null 2>&1
+        total_bytes=$((total_bytes + $(wc -c < "$WORK_DIR/blocks/$n.block")))
+        block_count=$((block_count + 1))
+    done
+
+    if [ "$block_count" -eq 0 ]; then
+        echo -e "${RED}✗ No new blocks were committed${NC}"
+        return 1
+    fi
+
+    echo "block_count=$block_count" >> "$WORK_DIR/results.env"
+    echo "block_avg_bytes=$((total_bytes / block_count))" >> "$WORK_DIR/results.env"
+    echo "tx_avg_bytes=$((total_bytes / SAMPLE_TXS))" >> "$WORK_DIR/results.env"
+    echo -e "${GREEN}✓ $block_count blocks, $((total_bytes / block_count)) bytes/block, $((total_bytes / SAMPLE_TXS)) bytes/tx${NC}"
+}
+
+report() {
+    if [ ! -f "$WORK_DIR/results.env" ]; then
+        echo -e "${RED}Error: no results found, run generate and bench first${NC}"
+        exit 1
+    fi
+    source "$WORK_DIR/results.env"
+
+    local records=$((HOLDERS + ${actions:-0}))
+    local report_file="$REPORT_DIR/capacity-report-$(date +%Y%m%d-%H%M%S).md"
+    mkdir -p "$REPORT_DIR"
+
+    cat > "$report_file" <<EOF
+# BondBridge State Capacity Report
+
+Generated: $(date -u +"%Y-%m-%dT%H:%M:%SZ")
+
+## Dataset
+
+| Item | Value |
+|------|-------|
+| Bonds | $BONDS |
+| Investors | ${investors:-n/a} |
+| Holder records | $HOLDERS |
+| Corporate action records | ${actions:-n/a} |
+| Bond issue time | ${load_bonds_seconds:-n/a}s |
+| Investor onboarding time | $(( ${load_kyc_seconds:-0} + ${load_kyc_approval_seconds:-0} ))s |
+| Holder load time | ${load_holder_seconds:-n/a}s |
+| Corporate action load time | ${load_coupon_seconds:-n/a}s |
+
+## Lookup latency (one bond, $RUNS runs, including peer CLI round trip)
+
+| Approach | Chaincode function | p50 (ms) | p95 (ms) |
+|----------|--------------------|----------|----------|
+| Full range scan (all bonds) | GetAllBonds | ${range_scan_p50:-n/a} | ${range_scan_p95:-n/a} |
+| Composite key partial range | GetBondHolders | ${composite_key_p50:-n/a} | ${composite_key_p95:-n/a} |
+| Composite key, one page of 100 | GetBondHoldersWithPagination | ${composite_key_paged_p50:-n/a} | ${composite_key_paged_p95:-n/a} |
+| Rich query (indexed, one bond) | QueryActions | ${rich_query_p50:-n/a} | ${rich_query_p95:-n/a} |
+| Rich query (indexed, pending coupons) | QueryActions | ${rich_query_status_p50:-n/a} | ${rich_query_status_p95:-n/a} |
+
+## Block sizes
+
+| Item | Value |
+|------|-------|
+| Sample transactions | $SAMPLE_TXS |
+| Blocks committed | ${block_count:-n/a} |
+| Average block size | ${block_avg_bytes:-n/a} bytes |
+| Average transaction size | ${tx_avg_bytes:-n/a} bytes |
+| Projected ledger growth for $records writes | $(( ${tx_avg_bytes:-0} * records / 1024 / 1024 )) MiB |
+
+## Notes
+
+- Range scans grow linearly with the number of records they cover and exceed
+  peer query limits (\`totalQueryLimit\`) well before the register reaches this size.
+- Composite keys keep per-bond lookups proportional to that bond's holder count
+  and work on both LevelDB and CouchDB.
+- Rich queries need CouchDB and a shipped index; unindexed selectors degrade to
+  full scans.
+EOF
+
+    echo -e "${GREEN}✓ Report written to $report_file${NC}"
+}
+
+clean() {
+    echo -e "${YELLOW}Deleting work files in $WORK_DIR...${NC}"
+    rm -rf "$WORK_DIR"
+    echo -e "${GREEN}✓ Work files deleted${NC}"
+    echo "The synthetic records are committed to the ledger; tear down the test network to remove them"
+}
+
+main() {
+    case "$1" in
+        generate) generate ;;
+        bench) bench ;;
+        blocks) blocks ;;
+        report) report ;;
+        all)
+            generate
+            bench
+            blocks
+            report
+            ;;
+        clean) clean ;;
+        help|"") show_usage ;;
+        *)
+            echo -e "${RED}Unknown command: $1${NC}"
+            show_usage
+            exit 1
+            ;;
+    esac
+}
+
+main "$@"
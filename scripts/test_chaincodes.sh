@@ -120,6 +120,9 @@ main() {
     run_chaincode_tests "BondToken" "chaincode/bondtoken"
     run_chaincode_tests "Compliance" "chaincode/compliance"
     run_chaincode_tests "CorporateAction" "chaincode/corporateaction"
+    run_chaincode_tests "CashToken" "chaincode/cashtoken"
+    run_chaincode_tests "Settlement" "chaincode/settlement"
+    run_chaincode_tests "OrderBook" "chaincode/orderbook"
     
     # Display summary
     display_summary